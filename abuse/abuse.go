@@ -0,0 +1,109 @@
+// Package abuse finds unknown sources sending mail that fails DMARC at volume,
+// likely spoofing, and composes abuse reports to the operators of their networks.
+package abuse
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/baseline"
+)
+
+// Source is a source of mail failing DMARC, with the report records as evidence.
+type Source struct {
+	SourceIP  net.IP          `json:"source_ip"`
+	Messages  int             `json:"messages"`  // Messages failing DMARC
+	Domains   []string        `json:"domains"`   // Policy domains the messages claimed, sorted
+	Reporters []string        `json:"reporters"` // Organizations which reported the messages, sorted
+	DateRange dmark.DateRange `json:"date_range"`
+	Evidence  []Evidence      `json:"evidence"`
+	Network   Network         `json:"network"` // Set by LookupNetwork
+}
+
+// Evidence is a report record of messages from a source failing DMARC.
+type Evidence struct {
+	Report dmark.ReportMetadata `json:"report"`
+	Domain string               `json:"domain"` // The policy domain
+	Record dmark.Record         `json:"record"`
+}
+
+// Find returns sources of at least minMessages messages failing DMARC, sorted by messages.
+// Sources are unknown when not in the baseline or, without one, when none of their
+// messages passed DMARC.
+func Find(ctx context.Context, reports []dmark.Feedback, b *baseline.Baseline, minMessages int) []Source {
+	sources := map[string]*Source{}
+	passed := map[string]int{}
+	domains := map[string]map[string]bool{}
+	reporters := map[string]map[string]bool{}
+
+	for i := range reports {
+		report := &reports[i]
+		for _, record := range report.Records {
+			key := record.Row.SourceIP.String()
+			if record.Row.PolicyEvaluated.DKIM || record.Row.PolicyEvaluated.SPF {
+				passed[key] += record.Row.Count
+				continue
+			}
+			if b != nil {
+				if _, ok := b.Expected(ctx, report.PolicyPublished.Domain, record); ok {
+					continue
+				}
+			}
+
+			source, ok := sources[key]
+			if !ok {
+				source = &Source{SourceIP: record.Row.SourceIP}
+				sources[key] = source
+				domains[key] = map[string]bool{}
+				reporters[key] = map[string]bool{}
+			}
+			source.Messages += record.Row.Count
+			source.Evidence = append(source.Evidence, Evidence{
+				Report: report.ReportMetadata,
+				Domain: report.PolicyPublished.Domain,
+				Record: record,
+			})
+			domains[key][strings.ToLower(report.PolicyPublished.Domain)] = true
+			reporters[key][report.ReportMetadata.OrgName] = true
+
+			dr := report.ReportMetadata.DateRange
+			if source.DateRange.Begin == 0 || dr.Begin < source.DateRange.Begin {
+				source.DateRange.Begin = dr.Begin
+			}
+			if dr.End > source.DateRange.End {
+				source.DateRange.End = dr.End
+			}
+		}
+	}
+
+	result := []Source{}
+	for key, source := range sources {
+		if source.Messages < minMessages || (b == nil && passed[key] > 0) {
+			continue
+		}
+		source.Domains = sortedKeys(domains[key])
+		source.Reporters = sortedKeys(reporters[key])
+		result = append(result, *source)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+		return result[i].SourceIP.String() < result[j].SourceIP.String()
+	})
+
+	return result
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,151 @@
+package abuse
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compose returns an abuse report about the source as an email message (RFC 5322)
+// from the address to the abuse contacts of its network, with the evidence attached as CSV.
+func Compose(source Source, from string, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	text, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"8bit"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = text.Write([]byte(strings.ReplaceAll(Text(source), "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+
+	attachment, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {`text/csv; charset=utf-8; name="evidence.csv"`},
+		"Content-Disposition": {`attachment; filename="evidence.csv"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = writeEvidence(attachment, source.Evidence); err != nil {
+		return nil, fmt.Errorf("write evidence: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	if len(source.Network.Contacts) > 0 {
+		header("To", strings.Join(source.Network.Contacts, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", Subject(source)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/mixed; boundary="`+w.Boundary()+`"`)
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// Subject returns the subject of the abuse report.
+func Subject(source Source) string {
+	network := ""
+	if source.Network.ASN != "" {
+		network = " (AS" + source.Network.ASN + ")"
+	}
+
+	return fmt.Sprintf("Spoofed mail from %s%s claiming %s", source.SourceIP, network, strings.Join(source.Domains, ", "))
+}
+
+// Text returns the body of the abuse report.
+func Text(source Source) string {
+	b := strings.Builder{}
+	b.WriteString("Hello,\n\n")
+
+	fmt.Fprintf(&b, "DMARC aggregate reports show %d messages sent from %s", source.Messages, source.SourceIP)
+	if n := source.Network; n.ASN != "" {
+		fmt.Fprintf(&b, " (AS%s %s, %s)", n.ASN, n.ASName, n.Prefix)
+	}
+	if owner := source.Network.Owner; owner != "" {
+		fmt.Fprintf(&b, ", a network of %s,", owner)
+	}
+	fmt.Fprintf(
+		&b,
+		" between %s and %s UTC, claiming to be from %s.\n",
+		day(source.DateRange.Begin),
+		day(source.DateRange.End),
+		strings.Join(source.Domains, ", "),
+	)
+	b.WriteString("The messages failed DMARC authentication: the owner of the domains has not\n")
+	b.WriteString("authorized this host to send mail on their behalf, so they are likely spoofed\n")
+	b.WriteString("or phishing.\n\n")
+	b.WriteString("Please investigate the host and stop the abuse. The report records are\n")
+	b.WriteString("attached as CSV, one row per record.\n\n")
+	fmt.Fprintf(&b, "Reported by: %s\n", strings.Join(source.Reporters, ", "))
+
+	return b.String()
+}
+
+func day(unix int) string {
+	return time.Unix(int64(unix), 0).UTC().Format("2006-01-02")
+}
+
+// writeEvidence writes the evidence records as CSV.
+func writeEvidence(w io.Writer, evidence []Evidence) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	cw.Write([]string{
+		"reporter", "report_id", "begin", "end", "domain", "source_ip", "count",
+		"disposition", "header_from", "envelope_from", "dkim", "spf",
+	})
+
+	for _, e := range evidence {
+		r := e.Record
+		dkim := []string{}
+		for _, result := range r.AuthResult.DKIM {
+			dkim = append(dkim, result.Domain+"="+text(result.Result))
+		}
+		spf := []string{}
+		for _, result := range r.AuthResult.SPF {
+			spf = append(spf, result.Domain+"="+text(result.Result))
+		}
+
+		cw.Write([]string{
+			e.Report.OrgName,
+			e.Report.ReportID,
+			time.Unix(int64(e.Report.DateRange.Begin), 0).UTC().Format(time.RFC3339),
+			time.Unix(int64(e.Report.DateRange.End), 0).UTC().Format(time.RFC3339),
+			e.Domain,
+			r.Row.SourceIP.String(),
+			strconv.Itoa(r.Row.Count),
+			text(r.Row.PolicyEvaluated.Disposition),
+			r.Identifiers.HeaderFrom,
+			r.Identifiers.EnvelopeFrom,
+			strings.Join(dkim, " "),
+			strings.Join(spf, " "),
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func text(v interface{ MarshalText() ([]byte, error) }) string {
+	b, _ := v.MarshalText()
+	return string(b)
+}
@@ -0,0 +1,170 @@
+package abuse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/rdap"
+)
+
+// whoisTimeout bounds a single WHOIS query.
+const whoisTimeout = 10 * time.Second
+
+// CymruServer maps IP addresses to their origin AS and registry.
+var CymruServer = "whois.cymru.com:43"
+
+// Registries are WHOIS servers of regional Internet registries, by the names
+// CymruServer uses, and the queries for abuse contacts of an AS number and of an IP address.
+var Registries = map[string]struct {
+	Server    string
+	ASNQuery  string
+	AddrQuery string
+}{
+	"arin":    {"whois.arin.net:43", "a + %s", "n + %s"},
+	"ripencc": {"whois.ripe.net:43", "AS%s", "%s"},
+	"apnic":   {"whois.apnic.net:43", "AS%s", "%s"},
+	"lacnic":  {"whois.lacnic.net:43", "AS%s", "%s"},
+	"afrinic": {"whois.afrinic.net:43", "AS%s", "%s"},
+}
+
+// Network is what WHOIS tells about the network of a source.
+type Network struct {
+	ASN      string   `json:"asn,omitempty"`
+	ASName   string   `json:"as_name,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"` // The announced prefix containing the IP
+	Country  string   `json:"country,omitempty"`
+	Registry string   `json:"registry,omitempty"` // One of Registries
+	Owner    string   `json:"owner,omitempty"`    // The registrant of the network, from RDAP
+	Contacts []string `json:"contacts,omitempty"` // Abuse contact addresses
+}
+
+// AddRDAP adds the owner, country and abuse contacts of the network from RDAP.
+func (n *Network) AddRDAP(r *rdap.Network) {
+	n.Owner = r.Owner
+	if n.Country == "" {
+		n.Country = r.Country
+	}
+	for _, contact := range r.AbuseContacts {
+		if !contains(n.Contacts, contact) {
+			n.Contacts = append(n.Contacts, contact)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LookupNetwork finds the origin AS of ip and the abuse contacts of the AS,
+// or of the network of ip when the registry lists none for the AS.
+func LookupNetwork(ctx context.Context, ip net.IP) (Network, error) {
+	network := Network{}
+
+	// AS    | IP      | BGP Prefix | CC | Registry | Allocated  | AS Name
+	// 15169 | 8.8.8.8 | 8.8.8.0/24 | US | arin     | 2023-12-28 | GOOGLE, US
+	text, err := whois(ctx, CymruServer, " -v "+ip.String())
+	if err != nil {
+		return network, fmt.Errorf("look up origin AS: %w", err)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 7 || strings.TrimSpace(fields[0]) == "AS" {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		network.ASN = fields[0]
+		network.Prefix = fields[2]
+		network.Country = fields[3]
+		network.Registry = fields[4]
+		network.ASName = fields[6]
+		break
+	}
+
+	registry, ok := Registries[network.Registry]
+	if !ok {
+		return network, fmt.Errorf("unknown registry %q of %s", network.Registry, ip)
+	}
+
+	if network.ASN != "" && network.ASN != "NA" {
+		text, err = whois(ctx, registry.Server, fmt.Sprintf(registry.ASNQuery, network.ASN))
+		if err != nil {
+			return network, fmt.Errorf("look up AS: %w", err)
+		}
+		network.Contacts = abuseContacts(text)
+	}
+	if len(network.Contacts) == 0 {
+		if text, err = whois(ctx, registry.Server, fmt.Sprintf(registry.AddrQuery, ip)); err != nil {
+			return network, fmt.Errorf("look up network: %w", err)
+		}
+		network.Contacts = abuseContacts(text)
+	}
+
+	return network, nil
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// abuseContacts returns addresses on lines mentioning abuse, e.g.
+// "OrgAbuseEmail: abuse@example.net", "abuse-mailbox: abuse@example.net"
+// or "% Abuse contact for 'AS64500' is 'abuse@example.net'".
+func abuseContacts(text string) []string {
+	contacts := []string{}
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(strings.ToLower(line), "abuse") {
+			continue
+		}
+		for _, address := range emailPattern.FindAllString(line, -1) {
+			address = strings.ToLower(address)
+			if !seen[address] {
+				seen[address] = true
+				contacts = append(contacts, address)
+			}
+		}
+	}
+
+	return contacts
+}
+
+// whois sends a query to a WHOIS server (RFC 3912) and returns the response.
+func whois(ctx context.Context, server, query string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, whoisTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", fmt.Errorf("connect to %s: %w", server, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err = conn.Write([]byte(query + "\r\n")); err != nil {
+		return "", fmt.Errorf("query %s: %w", server, err)
+	}
+
+	response, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("read from %s: %w", server, err)
+	}
+
+	return string(response), nil
+}
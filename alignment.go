@@ -0,0 +1,73 @@
+package dmark
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// OrganizationalDomain returns the organizational domain (RFC 7489 Section 3.2):
+// the public suffix of the domain by the Public Suffix List, with its private
+// domains like herokuapp.com and github.io, and one more label. A domain that
+// is a public suffix itself is its own organizational domain.
+func OrganizationalDomain(domain string) string {
+	domain = strings.Trim(strings.ToLower(domain), ".")
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+
+	return org
+}
+
+// Aligned reports whether an authenticated domain is aligned with the From domain:
+// the domains are equal in strict mode, or share the organizational domain in relaxed mode.
+func Aligned(authDomain, fromDomain string, mode Alignment) bool {
+	authDomain = strings.Trim(strings.ToLower(authDomain), ".")
+	fromDomain = strings.Trim(strings.ToLower(fromDomain), ".")
+	if authDomain == "" || fromDomain == "" {
+		return false
+	}
+
+	if mode == AlignmentStrict {
+		return authDomain == fromDomain
+	}
+
+	return OrganizationalDomain(authDomain) == OrganizationalDomain(fromDomain)
+}
+
+// fromDomain returns the header From domain of the record,
+// or the policy domain when the reporter left it out.
+func (r Record) fromDomain(policy PolicyPublished) string {
+	if r.Identifiers.HeaderFrom != "" {
+		return r.Identifiers.HeaderFrom
+	}
+
+	return policy.Domain
+}
+
+// DKIMAligned returns the first passing DKIM signature aligned with the From domain
+// under the policy DKIM alignment mode.
+func (r Record) DKIMAligned(policy PolicyPublished) (DKIMAuthResult, bool) {
+	from := r.fromDomain(policy)
+	for _, result := range r.AuthResult.DKIM {
+		if result.Result == DKIMResultPass && Aligned(result.Domain, from, policy.ADKIM) {
+			return result, true
+		}
+	}
+
+	return DKIMAuthResult{}, false
+}
+
+// SPFAligned returns the first passing SPF result aligned with the From domain
+// under the policy SPF alignment mode.
+func (r Record) SPFAligned(policy PolicyPublished) (SPFAuthResult, bool) {
+	from := r.fromDomain(policy)
+	for _, result := range r.AuthResult.SPF {
+		if result.Result == SPFResultPass && Aligned(result.Domain, from, policy.ASPF) {
+			return result, true
+		}
+	}
+
+	return SPFAuthResult{}, false
+}
@@ -0,0 +1,53 @@
+package dmark
+
+import "testing"
+
+func TestOrganizationalDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{"Mail.Example.COM.", "example.com"},
+		{"bounces.example.co.uk", "example.co.uk"},
+		{"a.b.example.com.au", "example.com.au"},
+		// Private suffixes: sites of different owners
+		{"a.herokuapp.com", "a.herokuapp.com"},
+		{"mail.a.herokuapp.com", "a.herokuapp.com"},
+		{"alice.github.io", "alice.github.io"},
+		// Public suffixes are their own organizational domains.
+		{"com", "com"},
+		{"herokuapp.com", "herokuapp.com"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := OrganizationalDomain(tt.domain); got != tt.want {
+			t.Errorf("OrganizationalDomain(%q): want %q, got %q", tt.domain, tt.want, got)
+		}
+	}
+}
+
+func TestAligned(t *testing.T) {
+	tests := []struct {
+		auth, from string
+		mode       Alignment
+		want       bool
+	}{
+		{"example.com", "example.com", AlignmentStrict, true},
+		{"mail.example.com", "example.com", AlignmentStrict, false},
+		{"mail.example.com", "example.com", AlignmentRelaxed, true},
+		{"bounces.example.co.uk", "example.co.uk", AlignmentRelaxed, true},
+		{"example.co.uk", "other.co.uk", AlignmentRelaxed, false},
+		{"a.herokuapp.com", "b.herokuapp.com", AlignmentRelaxed, false},
+		{"alice.github.io", "bob.github.io", AlignmentRelaxed, false},
+		{"mail.alice.github.io", "alice.github.io", AlignmentRelaxed, true},
+		{"", "example.com", AlignmentRelaxed, false},
+	}
+
+	for _, tt := range tests {
+		if got := Aligned(tt.auth, tt.from, tt.mode); got != tt.want {
+			t.Errorf("Aligned(%q, %q, %v): want %v, got %v", tt.auth, tt.from, tt.mode, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package dmark
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net"
+	"strings"
+	"unicode/utf8"
+)
+
+// AnonymizeOptions configures Anonymize.
+type AnonymizeOptions struct {
+	IPv4PrefixLen int    // Number of leading bits kept in IPv4 source addresses, 24 when zero
+	IPv6PrefixLen int    // Number of leading bits kept in IPv6 source addresses, 48 when zero
+	Salt          string // Salt for hashing envelope domains, makes hashes harder to reverse by brute force
+	KeepComments  bool   // Keep free-form comments and human readable results
+}
+
+// Anonymize masks the feedback in place, so it can be shared publicly:
+// source IPs are truncated to their network prefix, envelope and SPF domains
+// are replaced with salted hashes and free-form comments are removed.
+// Extension elements are dropped, as nothing is known about what they hold,
+// and so is the origin, as its hash links back to the raw report.
+func Anonymize(feedback *Feedback, opts AnonymizeOptions) {
+	if opts.IPv4PrefixLen == 0 {
+		opts.IPv4PrefixLen = 24
+	}
+	if opts.IPv6PrefixLen == 0 {
+		opts.IPv6PrefixLen = 48
+	}
+
+	feedback.Origin = nil
+	feedback.Extensions = nil
+	feedback.PolicyPublished.Extensions = nil
+
+	for i := range feedback.Records {
+		record := &feedback.Records[i]
+
+		record.Extensions = nil
+		record.AuthResult.Extensions = nil
+		record.Row.SourceIP = maskIP(record.Row.SourceIP, opts)
+		record.Identifiers.EnvelopeTo = hashDomain(record.Identifiers.EnvelopeTo, opts.Salt)
+		record.Identifiers.EnvelopeFrom = hashDomain(record.Identifiers.EnvelopeFrom, opts.Salt)
+		for j := range record.AuthResult.SPF {
+			// SPF is evaluated against the envelope domain, so it would leak otherwise
+			record.AuthResult.SPF[j].Domain = hashDomain(record.AuthResult.SPF[j].Domain, opts.Salt)
+		}
+
+		if opts.KeepComments {
+			continue
+		}
+		for j := range record.Row.PolicyEvaluated.Reason {
+			record.Row.PolicyEvaluated.Reason[j].Comment = ""
+		}
+		for j := range record.AuthResult.DKIM {
+			record.AuthResult.DKIM[j].HumanResult = ""
+		}
+	}
+}
+
+func maskIP(ip net.IP, opts AnonymizeOptions) net.IP {
+	if ip == nil {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(opts.IPv4PrefixLen, 32))
+	}
+
+	return ip.Mask(net.CIDRMask(opts.IPv6PrefixLen, 128))
+}
+
+func hashDomain(domain, salt string) string {
+	if domain == "" {
+		return ""
+	}
+
+	// domains are case-insensitive, hashes should not tell them apart
+	sum := sha256.Sum256([]byte(salt + strings.ToLower(domain)))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// anonymizedText are elements whose text AnonymizeXML masks, by their path.
+var anonymizedText = map[string]func(text string, opts AnonymizeOptions) string{
+	"feedback/record/row/source_ip": func(text string, opts AnonymizeOptions) string {
+		var ip net.IP
+		if ip.UnmarshalText([]byte(strings.TrimSpace(text))) != nil {
+			return ""
+		}
+		return maskIP(ip, opts).String()
+	},
+	"feedback/record/identifiers/envelope_to":   hashText,
+	"feedback/record/identifiers/envelope_from": hashText,
+	"feedback/record/auth_results/spf/domain":   hashText,
+	"feedback/record/row/policy_evaluated/reason/comment": func(text string, opts AnonymizeOptions) string {
+		if opts.KeepComments {
+			return text
+		}
+		return ""
+	},
+	"feedback/record/auth_results/dkim/human_result": func(text string, opts AnonymizeOptions) string {
+		if opts.KeepComments {
+			return text
+		}
+		return ""
+	},
+}
+
+func hashText(text string, opts AnonymizeOptions) string {
+	return hashDomain(text, opts.Salt)
+}
+
+// knownElements are the children of elements holding extensions,
+// others are dropped by AnonymizeXML.
+var knownElements = map[string]map[string]bool{
+	"feedback": {"version": true, "report_metadata": true, "policy_published": true, "record": true},
+	"feedback/policy_published": {
+		"domain": true, "adkim": true, "aspf": true, "p": true, "sp": true, "np": true,
+		"pct": true, "fo": true, "ri": true, "rua": true, "ruf": true, "testing": true,
+	},
+	"feedback/record":              {"row": true, "identifiers": true, "auth_results": true},
+	"feedback/record/auth_results": {"dkim": true, "spf": true},
+}
+
+// AnonymizeXML is like Anonymize, but masks a raw report and returns it as
+// raw XML, keeping everything else as it is: the encoding, byte order mark,
+// prolog, DOCTYPE, namespaces and whitespace, so samples sanitized with it
+// keep the quirks of their reporter. XML comments are dropped along with
+// extension elements.
+func AnonymizeXML(content []byte, opts AnonymizeOptions) ([]byte, error) {
+	if opts.IPv4PrefixLen == 0 {
+		opts.IPv4PrefixLen = 24
+	}
+	if opts.IPv6PrefixLen == 0 {
+		opts.IPv6PrefixLen = 48
+	}
+
+	normalized, err := normalizeEncoding(content)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkDoctype(normalized); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	d := xml.NewDecoder(bytes.NewReader(normalized))
+	// content is already UTF-8 at this point, whatever the prolog claims
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	path := []string{}
+	skip := 0                                      // Depth within a dropped element
+	var mask func(string, AnonymizeOptions) string // Of the element being masked
+	var text strings.Builder                       // Of the element being masked
+
+	for {
+		start := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &DecodeError{Line: lineAt(normalized, d.InputOffset()), Err: err}
+		}
+		raw := normalized[start:d.InputOffset()]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := strings.Join(path, "/")
+			path = append(path, t.Name.Local)
+			if skip > 0 {
+				skip++
+				continue
+			}
+			if known, ok := knownElements[parent]; ok && !known[t.Name.Local] {
+				skip = 1
+				continue
+			}
+			if mask != nil {
+				continue // elements within masked text are dropped
+			}
+			out.Write(raw)
+			mask = anonymizedText[strings.Join(path, "/")]
+			text.Reset()
+		case xml.EndElement:
+			current := strings.Join(path, "/")
+			path = path[:len(path)-1]
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if mask != nil {
+				if anonymizedText[current] == nil {
+					continue // within masked text
+				}
+				xml.EscapeText(&out, []byte(mask(text.String(), opts)))
+				mask = nil
+			}
+			out.Write(raw)
+		case xml.CharData:
+			switch {
+			case skip > 0:
+			case mask != nil:
+				text.Write(t)
+			default:
+				out.Write(raw)
+			}
+		case xml.Comment:
+			// free-form, may hold anything
+		default:
+			if skip == 0 && mask == nil {
+				out.Write(raw)
+			}
+		}
+	}
+
+	return encodeLike(content, out.Bytes()), nil
+}
+
+// encodeLike encodes UTF-8 content the way original is, see normalizeEncoding.
+func encodeLike(original, content []byte) []byte {
+	switch {
+	case bytes.HasPrefix(original, bomUTF8):
+		return append(append([]byte{}, bomUTF8...), content...)
+	case bytes.HasPrefix(original, bomUTF16BE):
+		return append(append([]byte{}, bomUTF16BE...), encodeUTF16(string(content), true)...)
+	case bytes.HasPrefix(original, bomUTF16LE):
+		return append(append([]byte{}, bomUTF16LE...), encodeUTF16(string(content), false)...)
+	case len(original) >= 2 && original[0] == 0 && original[1] != 0:
+		return encodeUTF16(string(content), true)
+	case len(original) >= 2 && original[0] != 0 && original[1] == 0:
+		return encodeUTF16(string(content), false)
+	case !utf8.Valid(original):
+		// Latin-1, masked values are ASCII
+		result := make([]byte, 0, len(content))
+		for _, r := range string(content) {
+			result = append(result, byte(r))
+		}
+		return result
+	}
+
+	return content
+}
@@ -0,0 +1,93 @@
+package dmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	report := `<?xml version="1.0"?>
+<feedback>
+<report_metadata><org_name>example.net</org_name><report_id>1</report_id></report_metadata>
+<policy_published><domain>example.com</domain><p>none</p><x_reporter_ip>203.0.113.10</x_reporter_ip></policy_published>
+<record>
+	<row><source_ip>203.0.113.77</source_ip><count>1</count></row>
+	<identifiers><header_from>example.com</header_from><envelope_from>mail.example.org</envelope_from></identifiers>
+	<auth_results>
+		<spf><domain>mail.example.org</domain><result>pass</result></spf>
+		<x_real_ip>203.0.113.77</x_real_ip>
+	</auth_results>
+	<x_helo>mail.example.org</x_helo>
+</record>
+<x_mailbox>postmaster@example.org</x_mailbox>
+</feedback>`
+
+	masked, err := AnonymizeXML([]byte(report), AnonymizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feedback, err := (&Parser{TrackOrigin: true}).Parse(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feedback.Records[0].AuthResult.Extensions) != 1 {
+		t.Fatalf("want an auth_results extension before Anonymize, got %+v", feedback.Records[0].AuthResult)
+	}
+
+	Anonymize(feedback, AnonymizeOptions{})
+
+	result, err := json.Marshal(feedback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"203.0.113.77", "203.0.113.10", "mail.example.org", "postmaster@example.org"} {
+		if strings.Contains(string(result), leaked) {
+			t.Errorf("anonymized report contains %q: %s", leaked, result)
+		}
+		if strings.Contains(string(masked), leaked) {
+			t.Errorf("anonymized XML contains %q: %s", leaked, masked)
+		}
+	}
+	if feedback.Origin != nil {
+		t.Errorf("want no origin, got %+v", feedback.Origin)
+	}
+	if feedback.Records[0].Row.SourceIP.String() != "203.0.113.0" {
+		t.Errorf("want source IP masked to 203.0.113.0, got %v", feedback.Records[0].Row.SourceIP)
+	}
+}
+
+// TestAnonymizeXML checks masking raw reports masks them like Anonymize,
+// keeping their encoding.
+func TestAnonymizeXML(t *testing.T) {
+	for name, content := range corpus(t) {
+		t.Run(name, func(t *testing.T) {
+			opts := AnonymizeOptions{Salt: "test"}
+			masked, err := AnonymizeXML(content, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(masked[:2], content[:2]) {
+				t.Errorf("want the encoding kept, got % x instead of % x", masked[:2], content[:2])
+			}
+
+			got, err := ParseBytes(masked)
+			if err != nil {
+				t.Fatalf("parse masked report: %v", err)
+			}
+			want, err := ParseBytes(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			Anonymize(want, opts)
+
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("want the report masked like Anonymize:\n%s\ngot:\n%s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Package baseline declares the sources expected to send mail for policy domains,
+// so that traffic from other sources claiming a domain, likely spoofing,
+// can be flagged as reports arrive.
+package baseline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/spf"
+)
+
+// Providers maps names of well-known email providers to the domains
+// whose SPF records list their sending IP addresses.
+var Providers = map[string]string{
+	"google":     "_spf.google.com",
+	"microsoft":  "spf.protection.outlook.com",
+	"amazonses":  "amazonses.com",
+	"sendgrid":   "sendgrid.net",
+	"mailchimp":  "servers.mcsv.net",
+	"mailgun":    "mailgun.org",
+	"postmark":   "spf.mtasv.net",
+	"sparkpost":  "sparkpostmail.com",
+	"zoho":       "zoho.com",
+	"salesforce": "_spf.salesforce.com",
+}
+
+// Sender is an expected source of mail, matching records by any of its fields.
+type Sender struct {
+	Name     string   `json:"name"`
+	Domains  []string `json:"domains"`  // Policy domains the sender sends for, with subdomains; any when empty
+	Provider string   `json:"provider"` // One of Providers
+	CIDRs    []string `json:"cidrs"`    // Source IP ranges, e.g. 203.0.113.0/24
+	DKIM     []string `json:"dkim"`     // Domains of DKIM signatures, with subdomains, which must pass
+	SPF      []string `json:"spf"`      // Domains whose SPF records pass for the source IP
+
+	nets []*net.IPNet
+}
+
+// Baseline is a list of expected senders.
+type Baseline struct {
+	Senders []Sender `json:"senders"`
+
+	// SPF evaluates SPF domains of senders, a Checker with the default resolver when nil.
+	SPF *spf.Checker
+
+	mu  sync.Mutex
+	spf map[string]bool // Cached SPF passes by source IP and domain
+}
+
+// Deviation is a record of a source not in the baseline.
+type Deviation struct {
+	Domain     string `json:"domain"` // The policy domain
+	OrgName    string `json:"org_name"`
+	ReportID   string `json:"report_id"`
+	SourceIP   net.IP `json:"source_ip"`
+	Count      int    `json:"count"`
+	HeaderFrom string `json:"header_from"`
+	Passed     bool   `json:"passed"` // Whether the messages passed DMARC anyway
+}
+
+// Load reads a baseline from a JSON file:
+//
+//	{"senders": [
+//	  {"name": "Workspace", "provider": "google"},
+//	  {"name": "Newsletters", "dkim": ["mcsv.net"], "domains": ["news.example.com"]},
+//	  {"name": "Office", "cidrs": ["203.0.113.0/24"]}
+//	]}
+func Load(path string) (*Baseline, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read baseline: %w", err)
+	}
+
+	b := &Baseline{}
+	if err = json.Unmarshal(content, b); err != nil {
+		return nil, fmt.Errorf("decode baseline: %w", err)
+	}
+	if err = b.Compile(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Compile validates senders and parses their CIDRs; Load calls it.
+func (b *Baseline) Compile() error {
+	for i := range b.Senders {
+		s := &b.Senders[i]
+		if s.Provider != "" {
+			if _, ok := Providers[strings.ToLower(s.Provider)]; !ok {
+				return fmt.Errorf("sender %q: unknown provider %q, expected one of %s", s.Name, s.Provider, strings.Join(providerNames(), ", "))
+			}
+		}
+
+		s.nets = nil
+		for _, cidr := range s.CIDRs {
+			if !strings.Contains(cidr, "/") {
+				if strings.Contains(cidr, ":") {
+					cidr += "/128"
+				} else {
+					cidr += "/32"
+				}
+			}
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("sender %q: %w", s.Name, err)
+			}
+			s.nets = append(s.nets, n)
+		}
+
+		if s.Provider == "" && len(s.nets) == 0 && len(s.DKIM) == 0 && len(s.SPF) == 0 {
+			return fmt.Errorf("sender %q matches nothing, set provider, cidrs, dkim or spf", s.Name)
+		}
+	}
+
+	return nil
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Expected returns the name of the first sender matching the record of the policy domain.
+func (b *Baseline) Expected(ctx context.Context, domain string, record dmark.Record) (string, bool) {
+	for _, s := range b.Senders {
+		if len(s.Domains) > 0 && !matchDomain(domain, s.Domains) {
+			continue
+		}
+		if s.matches(record) || b.matchesSPF(ctx, s, record.Row.SourceIP) {
+			return s.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// Deviations returns records of the report from sources not in the baseline.
+func (b *Baseline) Deviations(ctx context.Context, report *dmark.Feedback) []Deviation {
+	deviations := []Deviation{}
+	for _, record := range report.Records {
+		if _, ok := b.Expected(ctx, report.PolicyPublished.Domain, record); ok {
+			continue
+		}
+
+		evaluated := record.Row.PolicyEvaluated
+		deviations = append(deviations, Deviation{
+			Domain:     report.PolicyPublished.Domain,
+			OrgName:    report.ReportMetadata.OrgName,
+			ReportID:   report.ReportMetadata.ReportID,
+			SourceIP:   record.Row.SourceIP,
+			Count:      record.Row.Count,
+			HeaderFrom: record.Identifiers.HeaderFrom,
+			Passed:     bool(evaluated.DKIM || evaluated.SPF),
+		})
+	}
+
+	return deviations
+}
+
+// matches checks the sender's CIDRs and DKIM domains, which need no lookups.
+func (s Sender) matches(record dmark.Record) bool {
+	for _, n := range s.nets {
+		if n.Contains(record.Row.SourceIP) {
+			return true
+		}
+	}
+
+	for _, dkim := range record.AuthResult.DKIM {
+		if dkim.Result == dmark.DKIMResultPass && matchDomain(dkim.Domain, s.DKIM) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Baseline) matchesSPF(ctx context.Context, s Sender, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	domains := s.SPF
+	if s.Provider != "" {
+		domains = append([]string{Providers[strings.ToLower(s.Provider)]}, domains...)
+	}
+	for _, domain := range domains {
+		if b.spfPass(ctx, ip, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// spfPass evaluates the SPF record of the domain for the IP address,
+// caching the results; lookup errors count as no pass and are not cached.
+func (b *Baseline) spfPass(ctx context.Context, ip net.IP, domain string) bool {
+	key := ip.String() + " " + strings.ToLower(domain)
+
+	b.mu.Lock()
+	pass, ok := b.spf[key]
+	b.mu.Unlock()
+	if ok {
+		return pass
+	}
+
+	checker := b.SPF
+	if checker == nil {
+		checker = &spf.Checker{}
+	}
+	result, err := checker.Check(ctx, ip, domain)
+	if err != nil && result != dmark.SPFResultPermError {
+		return false
+	}
+	pass = result == dmark.SPFResultPass
+
+	b.mu.Lock()
+	if b.spf == nil {
+		b.spf = map[string]bool{}
+	}
+	b.spf[key] = pass
+	b.mu.Unlock()
+
+	return pass
+}
+
+// matchDomain reports whether the domain is one of the domains or their subdomain.
+func matchDomain(domain string, domains []string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, d := range domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
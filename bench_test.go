@@ -0,0 +1,53 @@
+package dmark
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+// BenchmarkParse and BenchmarkParseBytes run over the reports in testdata/reports,
+// see dmark-bench for larger, synthetic reports.
+func BenchmarkParse(b *testing.B) {
+	reports := corpus(b)
+	for _, name := range sortedNames(reports) {
+		content := reports[name]
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Parse(bytes.NewReader(content)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseBytes(b *testing.B) {
+	reports := corpus(b)
+	for _, name := range sortedNames(reports) {
+		content := reports[name]
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseBytes(content); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// sortedNames returns the names of reports, sorted,
+// so that benchmarks run in the same order.
+func sortedNames(reports map[string][]byte) []string {
+	names := []string{}
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
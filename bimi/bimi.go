@@ -0,0 +1,210 @@
+// Package bimi checks whether a domain meets BIMI prerequisites:
+// an enforced DMARC policy, a valid default._bimi record,
+// and a reachable SVG logo and Verified Mark Certificate.
+package bimi
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// maxFetchSize limits downloaded logos and certificates.
+const maxFetchSize = 1 << 20
+
+// Record is a BIMI assertion record.
+type Record struct {
+	Version     string // BIMI1
+	Location    string // The "l=" tag, HTTPS URL of the SVG logo
+	Certificate string // The "a=" tag, HTTPS URL of the Verified Mark Certificate
+}
+
+// Readiness is the result of Check.
+type Readiness struct {
+	Domain string   `json:"domain"`
+	Record *Record  `json:"record,omitempty"`
+	Gaps   []string `json:"gaps"` // Unmet prerequisites, empty when ready
+}
+
+// Ready reports whether all prerequisites are met.
+func (r Readiness) Ready() bool {
+	return len(r.Gaps) == 0
+}
+
+// Checker checks BIMI prerequisites.
+type Checker struct {
+	HTTPClient *http.Client // http.DefaultClient when nil
+}
+
+// Check verifies BIMI prerequisites of a domain, with its DMARC policy
+// taken from reports, e.g. DomainSummary.Policy.
+func (c *Checker) Check(ctx context.Context, domain string, policy dmark.PolicyPublished) Readiness {
+	r := Readiness{Domain: domain, Gaps: []string{}}
+	r.Gaps = append(r.Gaps, policyGaps(policy)...)
+
+	record, err := LookupRecord(ctx, domain)
+	if err != nil {
+		r.Gaps = append(r.Gaps, err.Error())
+		return r
+	}
+	r.Record = record
+
+	if err = c.checkLogo(ctx, record.Location); err != nil {
+		r.Gaps = append(r.Gaps, "logo: "+err.Error())
+	}
+
+	if record.Certificate == "" {
+		r.Gaps = append(r.Gaps, "no Verified Mark Certificate (a=), most mailbox providers require one")
+	} else if err = c.checkCertificate(ctx, record.Certificate); err != nil {
+		r.Gaps = append(r.Gaps, "certificate: "+err.Error())
+	}
+
+	return r
+}
+
+// policyGaps checks that the DMARC policy is enforced for all messages.
+func policyGaps(policy dmark.PolicyPublished) []string {
+	gaps := []string{}
+
+	if policy.P != dmark.DispositionQuarantine && policy.P != dmark.DispositionReject {
+		gaps = append(gaps, "DMARC policy must be p=quarantine or p=reject, got p="+textOf(policy.P))
+	}
+	if policy.SP == dmark.DispositionNone {
+		gaps = append(gaps, "DMARC subdomain policy must not be sp=none")
+	}
+	if policy.Pct != 0 && policy.Pct != 100 {
+		gaps = append(gaps, fmt.Sprintf("DMARC policy must apply to all messages, got pct=%d", policy.Pct))
+	}
+
+	return gaps
+}
+
+// LookupRecord retrieves and validates the default._bimi record of the domain.
+func LookupRecord(ctx context.Context, domain string) (*Record, error) {
+	name := "default._bimi." + domain
+	txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, fmt.Errorf("no BIMI record at %s", name)
+		}
+		return nil, fmt.Errorf("lookup TXT %q: %w", name, err)
+	}
+
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, "v=BIMI1") {
+			continue
+		}
+
+		record := &Record{}
+		for _, spec := range strings.Split(txt, ";") {
+			i := strings.Index(spec, "=")
+			if i < 0 {
+				continue
+			}
+			value := strings.TrimSpace(spec[i+1:])
+			switch strings.TrimSpace(spec[:i]) {
+			case "v":
+				record.Version = value
+			case "l":
+				record.Location = value
+			case "a":
+				record.Certificate = value
+			}
+		}
+
+		if record.Location == "" {
+			return record, fmt.Errorf("BIMI record at %s has no logo location (l=)", name)
+		}
+		if !strings.HasPrefix(record.Location, "https://") {
+			return record, fmt.Errorf("BIMI logo location must be an HTTPS URL, got %q", record.Location)
+		}
+		if record.Certificate != "" && !strings.HasPrefix(record.Certificate, "https://") {
+			return record, fmt.Errorf("BIMI certificate location must be an HTTPS URL, got %q", record.Certificate)
+		}
+
+		return record, nil
+	}
+
+	return nil, fmt.Errorf("no BIMI record at %s", name)
+}
+
+func (c *Checker) checkLogo(ctx context.Context, url string) error {
+	content, contentType, err := c.fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "image/svg+xml" {
+		return fmt.Errorf("content type must be image/svg+xml, got %q", mediaType)
+	}
+	if !bytes.Contains(content, []byte("<svg")) {
+		return errors.New("not an SVG document")
+	}
+	if !bytes.Contains(content, []byte(`baseProfile="tiny-ps"`)) {
+		return errors.New(`SVG must use the SVG Tiny Portable/Secure profile (baseProfile="tiny-ps")`)
+	}
+
+	return nil
+}
+
+func (c *Checker) checkCertificate(ctx context.Context, url string) error {
+	content, _, err := c.fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return errors.New("not a PEM certificate")
+	}
+	if _, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return fmt.Errorf("parse certificate: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Checker) fetch(ctx context.Context, url string) ([]byte, string, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("get %q: unexpected status %d", url, resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFetchSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("read %q: %w", url, err)
+	}
+
+	return content, resp.Header.Get("Content-Type"), nil
+}
+
+func textOf(v interface{ MarshalText() ([]byte, error) }) string {
+	text, _ := v.MarshalText()
+	return string(text)
+}
@@ -0,0 +1,72 @@
+package dmark
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which read buffers are not reused,
+// so that a single huge report does not stay in memory.
+const maxPooledBuffer = 16 << 20
+
+// BulkParser parses many reports, reusing read buffers and decoder state
+// between them instead of allocating them for every report.
+// It is meant for ingestion pipelines and is safe for concurrent use.
+// The zero value is ready to use.
+type BulkParser struct {
+	Parser
+
+	buffers  sync.Pool // *bytes.Buffer
+	decoders sync.Pool // *reportDecoder
+}
+
+// Parse is like Parser.Parse.
+func (p *BulkParser) Parse(r io.Reader) (*Feedback, error) {
+	buf, _ := p.buffers.Get().(*bytes.Buffer)
+	if buf == nil {
+		buf = &bytes.Buffer{}
+	}
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			p.buffers.Put(buf)
+		}
+	}()
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	return p.ParseBytes(buf.Bytes())
+}
+
+// ParseBytes is like Parser.ParseBytes.
+// Parsed reports do not reference content, so it can be reused afterwards.
+func (p *BulkParser) ParseBytes(content []byte) (*Feedback, error) {
+	d, _ := p.decoders.Get().(*reportDecoder)
+	if d == nil {
+		d = &reportDecoder{}
+	}
+	defer p.decoders.Put(d)
+
+	return p.Parser.parseBytes(content, d)
+}
+
+// ParseMany parses the reports one by one. Both returned slices have
+// an element for each reader: the report, or the error it failed with.
+// Once ctx is done, remaining readers are not read and fail with the context error.
+func (p *BulkParser) ParseMany(ctx context.Context, readers []io.Reader) ([]*Feedback, []error) {
+	reports := make([]*Feedback, len(readers))
+	errs := make([]error, len(readers))
+	for i, r := range readers {
+		if errs[i] = ctx.Err(); errs[i] != nil {
+			continue
+		}
+		reports[i], errs[i] = p.Parse(r)
+	}
+
+	return reports, errs
+}
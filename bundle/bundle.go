@@ -0,0 +1,228 @@
+// Package bundle packages raw reports and their summary into a tar archive
+// for retention as evidence of DMARC monitoring:
+//
+//	reports/<name>.xml  raw reports, as received
+//	summary.json        dmark.Summary of the reports
+//	manifest.json       sizes and SHA-256 hashes of the files above
+//	manifest.sig        Ed25519 signature of manifest.json, base64-encoded, when signed
+//
+// Any change to a file breaks its hash, any change to the manifest breaks the signature.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Names of the files of a bundle.
+const (
+	ReportsDir    = "reports/"
+	SummaryName   = "summary.json"
+	ManifestName  = "manifest.json"
+	SignatureName = "manifest.sig"
+)
+
+// Version is the manifest version written.
+const Version = 1
+
+// Manifest lists the files of a bundle.
+type Manifest struct {
+	Version   int         `json:"version"`
+	Created   time.Time   `json:"created"`
+	Reports   int         `json:"reports"`              // Raw reports in ReportsDir
+	Files     []FileEntry `json:"files"`                // All files but the manifest and its signature, in archive order
+	PublicKey string      `json:"public_key,omitempty"` // Base64 of the key the manifest is signed with, for reference only
+
+	Signed bool `json:"-"` // Set by Verify when the bundle has a signature
+}
+
+// FileEntry is a file of a bundle.
+type FileEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // Hex-encoded
+}
+
+// Write writes a bundle of raw reports and their summary to w as a tar archive,
+// signing the manifest when key is set. Reports are named after the base names of files.
+func Write(w io.Writer, files []dmark.File, summary dmark.Summary, key ed25519.PrivateKey) (*Manifest, error) {
+	manifest := &Manifest{
+		Version: Version,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Reports: len(files),
+		Files:   []FileEntry{},
+	}
+	if key != nil {
+		manifest.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+
+	tw := tar.NewWriter(w)
+	add := func(name string, content []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     int64(len(content)),
+			Mode:     0644,
+			ModTime:  manifest.Created,
+		})
+		if err == nil {
+			_, err = tw.Write(content)
+		}
+		if err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		name := ReportsDir + path.Base(strings.ReplaceAll(file.Name, "\\", "/"))
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate report name %q", name)
+		}
+		seen[name] = true
+
+		if err := add(name, file.Content); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, newEntry(name, file.Content))
+	}
+
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal summary: %w", err)
+	}
+	if err = add(SummaryName, summaryJSON); err != nil {
+		return nil, err
+	}
+	manifest.Files = append(manifest.Files, newEntry(SummaryName, summaryJSON))
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err = add(ManifestName, manifestJSON); err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestJSON)) + "\n"
+		if err = add(SignatureName, []byte(signature)); err != nil {
+			return nil, err
+		}
+		manifest.Signed = true
+	}
+
+	if err = tw.Close(); err != nil {
+		return nil, fmt.Errorf("close archive: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func newEntry(name string, content []byte) FileEntry {
+	sum := sha256.Sum256(content)
+	return FileEntry{Name: name, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// Verify reads a bundle from a tar archive and checks the files against the manifest:
+// none may be missing, added or changed. With key, the manifest must be signed by it;
+// without, the signature is not checked and Manifest.Signed tells whether there is one.
+func Verify(r io.Reader, key ed25519.PublicKey) (*Manifest, error) {
+	hashes := map[string]FileEntry{}
+	var manifestJSON, signature []byte
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			// added when the bundle is repacked, e.g. with tar -c reports
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %q of type %q", header.Name, header.Typeflag)
+		}
+
+		switch header.Name {
+		case ManifestName, SignatureName:
+			content, err := io.ReadAll(io.LimitReader(tr, 64<<20))
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", header.Name, err)
+			}
+			if header.Name == ManifestName {
+				manifestJSON = content
+			} else {
+				signature = content
+			}
+			continue
+		}
+
+		if _, ok := hashes[header.Name]; ok {
+			return nil, fmt.Errorf("duplicate entry %q", header.Name)
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", header.Name, err)
+		}
+		hashes[header.Name] = FileEntry{Name: header.Name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+
+	if manifestJSON == nil {
+		return nil, fmt.Errorf("no %s", ManifestName)
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(manifestJSON, manifest); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ManifestName, err)
+	}
+	if manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	manifest.Signed = signature != nil
+
+	if key != nil {
+		if signature == nil {
+			return manifest, errors.New("bundle is not signed")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+		if err != nil || !ed25519.Verify(key, manifestJSON, decoded) {
+			return manifest, errors.New("invalid signature of the manifest")
+		}
+	}
+
+	for _, entry := range manifest.Files {
+		actual, ok := hashes[entry.Name]
+		if !ok {
+			return manifest, fmt.Errorf("%s is missing", entry.Name)
+		}
+		if actual != entry {
+			return manifest, fmt.Errorf("%s does not match the manifest", entry.Name)
+		}
+		delete(hashes, entry.Name)
+	}
+	for name := range hashes {
+		return manifest, fmt.Errorf("%s is not in the manifest", name)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,175 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/zstd"
+)
+
+// Create writes a bundle to a file, compressed by its extension:
+// zstd for .tar.zst and .tzst, gzip for .tar.gz and .tgz, none for .tar.
+// A partially written file is removed on errors.
+func Create(path string, files []dmark.File, summary dmark.Summary, key ed25519.PrivateKey) (manifest *Manifest, err error) {
+	var compress func(io.Writer) io.WriteCloser
+	switch lower := strings.ToLower(path); {
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		compress = func(w io.Writer) io.WriteCloser { return zstd.NewWriter(w) }
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		compress = func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	case strings.HasSuffix(lower, ".tar"):
+	default:
+		return nil, fmt.Errorf("unsupported bundle extension of %q, want .tar.zst, .tar.gz or .tar", path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create %q: %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+		}
+	}()
+
+	buf := bufio.NewWriter(f)
+	var w io.Writer = buf
+	var c io.WriteCloser
+	if compress != nil {
+		c = compress(buf)
+		w = c
+	}
+
+	manifest, err = Write(w, files, summary, key)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		if err = c.Close(); err != nil {
+			return nil, fmt.Errorf("compress: %w", err)
+		}
+	}
+	if err = buf.Flush(); err != nil {
+		return nil, fmt.Errorf("write %q: %w", path, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return nil, fmt.Errorf("close %q: %w", path, err)
+	}
+
+	return manifest, nil
+}
+
+// VerifyFile verifies a bundle file, see Verify. Compression is detected by content.
+func VerifyFile(path string, key ed25519.PublicKey) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(4)
+	var archive io.Reader = r
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x28, 0xB5, 0x2F, 0xFD}):
+		archive = zstd.NewReader(r)
+	case bytes.HasPrefix(magic, []byte{0x1F, 0x8B}):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		archive = gz
+	}
+
+	return Verify(archive, key)
+}
+
+// GenerateKey writes a new Ed25519 private key to privatePath and its public key
+// to publicPath, both PEM-encoded like `openssl genpkey -algorithm ed25519` does.
+func GenerateKey(privatePath, publicPath string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("marshal private key: %w", err)
+	}
+	if err = os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return fmt.Errorf("write %q: %w", privatePath, err)
+	}
+
+	if der, err = x509.MarshalPKIXPublicKey(public); err != nil {
+		return fmt.Errorf("marshal public key: %w", err)
+	}
+	if err = os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("write %q: %w", publicPath, err)
+	}
+
+	return nil
+}
+
+// LoadPrivateKey reads a PEM-encoded PKCS #8 Ed25519 private key.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an Ed25519 key", path)
+	}
+
+	return private, nil
+}
+
+// LoadPublicKey reads a PEM-encoded Ed25519 public key.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an Ed25519 key", path)
+	}
+
+	return public, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", path, err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("no %s in %q", blockType, path)
+	}
+
+	return block.Bytes, nil
+}
@@ -0,0 +1,281 @@
+// Package cbor encodes reports as CBOR (RFC 8949), a compact binary format
+// for key-value stores and constrained channels.
+//
+// Structs are maps keyed by the `cbor` tag names, or the `json` tag names
+// when there is none, so the same field names as in JSON are used.
+// Enums and IP addresses are encoded as their text values.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/chuhlomin/dmark-go/internal/binenc"
+)
+
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorString = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Marshal returns the CBOR encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	w := &writer{}
+	if err := binenc.Encode(w, v, "cbor"); err != nil {
+		return nil, err
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// Unmarshal decodes CBOR data into v, which has to be a non-nil pointer.
+// Semantic tags are ignored; indefinite-length items are not supported.
+func Unmarshal(data []byte, v interface{}) error {
+	r := &reader{data: data}
+	if err := binenc.Decode(r, v, "cbor"); err != nil {
+		return fmt.Errorf("cbor: offset %d: %w", r.pos, err)
+	}
+	if r.pos != len(data) {
+		return fmt.Errorf("cbor: %d trailing bytes", len(data)-r.pos)
+	}
+
+	return nil
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		w.buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		w.buf.Write([]byte{major<<5 | 24, byte(n)})
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(major<<5 | 25)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		w.buf.WriteByte(major<<5 | 26)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		w.buf.WriteByte(major<<5 | 27)
+		w.buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func (w *writer) Nil() {
+	w.buf.WriteByte(majorSimple<<5 | 22)
+}
+
+func (w *writer) Bool(b bool) {
+	if b {
+		w.buf.WriteByte(majorSimple<<5 | 21)
+	} else {
+		w.buf.WriteByte(majorSimple<<5 | 20)
+	}
+}
+
+func (w *writer) Int(i int64) {
+	if i < 0 {
+		w.head(majorNegInt, uint64(-1-i))
+		return
+	}
+	w.head(majorUint, uint64(i))
+}
+
+func (w *writer) Uint(u uint64) {
+	w.head(majorUint, u)
+}
+
+// Float writes the shortest of single and double precision that keeps the value.
+func (w *writer) Float(f float64) {
+	if float64(float32(f)) == f || math.IsNaN(f) {
+		w.buf.WriteByte(majorSimple<<5 | 26)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(f))))
+		return
+	}
+
+	w.buf.WriteByte(majorSimple<<5 | 27)
+	w.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (w *writer) String(s string) {
+	w.head(majorString, uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *writer) Bytes(b []byte) {
+	w.head(majorBytes, uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *writer) Array(n int) {
+	w.head(majorArray, uint64(n))
+}
+
+func (w *writer) Map(n int) {
+	w.head(majorMap, uint64(n))
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) read(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, errors.New("unexpected end of data")
+	}
+
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// argument reads the value following the initial byte.
+func (r *reader) argument(info byte) (uint64, error) {
+	var size uint64
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, errors.New("indefinite-length items are not supported")
+	default:
+		return 0, fmt.Errorf("reserved additional information %d", info)
+	}
+
+	b, err := r.read(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (r *reader) Next() (binenc.Item, error) {
+	initial, err := r.read(1)
+	if err != nil {
+		return binenc.Item{}, err
+	}
+	major, info := initial[0]>>5, initial[0]&0x1f
+
+	if major == majorSimple {
+		return r.simple(info)
+	}
+
+	n, err := r.argument(info)
+	if err != nil {
+		return binenc.Item{}, err
+	}
+
+	switch major {
+	case majorUint:
+		return binenc.Item{Kind: binenc.KindUint, Uint: n}, nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return binenc.Item{}, errors.New("negative integer overflows int64")
+		}
+		return binenc.Item{Kind: binenc.KindInt, Int: -1 - int64(n)}, nil
+	case majorBytes, majorString:
+		b, err := r.read(n)
+		if err != nil {
+			return binenc.Item{}, err
+		}
+		kind := binenc.KindBytes
+		if major == majorString {
+			kind = binenc.KindString
+		}
+		return binenc.Item{Kind: kind, Bytes: b}, nil
+	case majorArray, majorMap:
+		// every item takes at least a byte, which bounds allocations for bogus lengths
+		if n > uint64(len(r.data)-r.pos) {
+			return binenc.Item{}, errors.New("unexpected end of data")
+		}
+		kind := binenc.KindArray
+		if major == majorMap {
+			kind = binenc.KindMap
+		}
+		return binenc.Item{Kind: kind, Len: int(n)}, nil
+	}
+
+	// majorTag: the tagged item is decoded as is
+	return r.Next()
+}
+
+func (r *reader) simple(info byte) (binenc.Item, error) {
+	switch info {
+	case 20:
+		return binenc.Item{Kind: binenc.KindBool, Bool: false}, nil
+	case 21:
+		return binenc.Item{Kind: binenc.KindBool, Bool: true}, nil
+	case 22, 23: // null and undefined
+		return binenc.Item{Kind: binenc.KindNil}, nil
+	case 25:
+		b, err := r.read(2)
+		if err != nil {
+			return binenc.Item{}, err
+		}
+		return binenc.Item{Kind: binenc.KindFloat, Float: float16(binary.BigEndian.Uint16(b))}, nil
+	case 26:
+		b, err := r.read(4)
+		if err != nil {
+			return binenc.Item{}, err
+		}
+		return binenc.Item{Kind: binenc.KindFloat, Float: float64(math.Float32frombits(binary.BigEndian.Uint32(b)))}, nil
+	case 27:
+		b, err := r.read(8)
+		if err != nil {
+			return binenc.Item{}, err
+		}
+		return binenc.Item{Kind: binenc.KindFloat, Float: math.Float64frombits(binary.BigEndian.Uint64(b))}, nil
+	}
+
+	return binenc.Item{}, fmt.Errorf("unsupported simple value %d", info)
+}
+
+// float16 converts a half-precision float, as written by other encoders.
+func float16(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/abuse"
+	"github.com/chuhlomin/dmark-go/baseline"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/rdap"
+)
+
+type config struct {
+	reportsPath  string
+	baselinePath string
+	minMessages  int
+	from         string
+	outPath      string
+	whois        bool
+	rdap         bool
+	rdapCache    string
+}
+
+func run(cfg config, out io.Writer) error {
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	var b *baseline.Baseline
+	if cfg.baselinePath != "" {
+		if b, err = baseline.Load(cfg.baselinePath); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	client := &rdap.Client{CacheDir: cfg.rdapCache}
+	sources := abuse.Find(ctx, reports, b, cfg.minMessages)
+	if cfg.outPath != "" {
+		if err = os.MkdirAll(cfg.outPath, 0755); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tAS\tOWNER\tMESSAGES\tDOMAINS\tCONTACTS\tREPORT\t")
+	for _, source := range sources {
+		if cfg.whois {
+			if source.Network, err = abuse.LookupNetwork(ctx, source.SourceIP); err != nil {
+				slog.Warn("Failed to look up network", "source_ip", source.SourceIP, "err", err)
+			}
+		}
+		if cfg.rdap {
+			network, err := client.Lookup(ctx, source.SourceIP)
+			if err != nil {
+				slog.Warn("Failed to look up network over RDAP", "source_ip", source.SourceIP, "err", err)
+			} else {
+				source.Network.AddRDAP(network)
+			}
+		}
+
+		path := "-"
+		if cfg.outPath != "" {
+			msg, err := abuse.Compose(source, cfg.from, time.Now())
+			if err != nil {
+				return fmt.Errorf("compose report on %s: %w", source.SourceIP, err)
+			}
+			path = filepath.Join(cfg.outPath, strings.ReplaceAll(source.SourceIP.String(), ":", "_")+".eml")
+			if err = ioutil.WriteFile(path, msg, 0644); err != nil {
+				return fmt.Errorf("write report: %w", err)
+			}
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%d\t%s\t%s\t%s\t\n",
+			source.SourceIP,
+			orDash(source.Network.ASN),
+			orDash(source.Network.Owner),
+			source.Messages,
+			strings.Join(source.Domains, ","),
+			orDash(strings.Join(source.Network.Contacts, ",")),
+			path,
+		)
+	}
+
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	baselinePath := flag.String("baseline", "", "JSON file of expected senders, see the baseline package; without it, sources are unknown when none of their messages passed DMARC")
+	minMessages := flag.Int("min", 100, "Minimum number of messages failing DMARC to report a source")
+	from := flag.String("from", "", "Sender address of abuse reports")
+	outPath := flag.String("o", "", "Directory to write abuse reports to, as <source IP>.eml files ready to send; only list sources when empty")
+	whois := flag.Bool("whois", true, "Look up the origin AS of sources and its abuse contacts over WHOIS")
+	useRDAP := flag.Bool("rdap", true, "Look up the owner, country and abuse contacts of source networks over RDAP")
+	rdapCache := flag.String("rdap-cache", rdap.DefaultCacheDir(), "Directory to cache RDAP lookups in, no cache when empty")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath:  *reportsPath,
+		baselinePath: *baselinePath,
+		minMessages:  *minMessages,
+		from:         *from,
+		outPath:      *outPath,
+		whois:        *whois,
+		rdap:         *useRDAP,
+		rdapCache:    *rdapCache,
+	}
+	if cfg.outPath != "" && cfg.from == "" {
+		logging.Fatal(errors.New("-from is required with -o"))
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	paths  []string // Report files, stdin when empty
+	outDir string   // Write masked reports to stdout when empty
+	opts   dmark.AnonymizeOptions
+}
+
+func run(cfg config, stdin io.Reader, stdout io.Writer) error {
+	if len(cfg.paths) == 0 {
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		masked, err := dmark.AnonymizeXML(content, cfg.opts)
+		if err != nil {
+			return fmt.Errorf("anonymize stdin: %w", err)
+		}
+		_, err = stdout.Write(masked)
+		return err
+	}
+
+	for _, path := range cfg.paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read file %q: %w", path, err)
+		}
+		masked, err := dmark.AnonymizeXML(content, cfg.opts)
+		if err != nil {
+			return fmt.Errorf("anonymize %q: %w", path, err)
+		}
+
+		if cfg.outDir == "" {
+			if _, err = stdout.Write(masked); err != nil {
+				return err
+			}
+			continue
+		}
+		out := filepath.Join(cfg.outDir, filepath.Base(path))
+		if err = os.WriteFile(out, masked, 0644); err != nil {
+			return fmt.Errorf("write file %q: %w", out, err)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	outDir := flag.String("o", "", "Directory to write masked reports to, under their file names; stdout when empty")
+	salt := flag.String("salt", "", "Salt for hashing envelope domains, makes hashes harder to reverse by brute force")
+	keepComments := flag.Bool("keep-comments", false, "Keep free-form comments and human readable results")
+	ipv4PrefixLen := flag.Int("ipv4-prefix", 24, "Number of leading bits kept in IPv4 source addresses")
+	ipv6PrefixLen := flag.Int("ipv6-prefix", 48, "Number of leading bits kept in IPv6 source addresses")
+	logOptions := logging.Flags()
+	cli.ParseCommand(cli.New("[report.xml...]", `Masks raw reports to share them, e.g. as test samples, keeping their encoding
+and formatting, see dmark.AnonymizeXML. Reads a report from stdin without files.`))
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	if flag.NArg() > 1 && *outDir == "" {
+		logging.Fatal(errors.New("-o is required for several reports"))
+	}
+
+	cfg := config{
+		paths:  flag.Args(),
+		outDir: *outDir,
+		opts: dmark.AnonymizeOptions{
+			IPv4PrefixLen: *ipv4PrefixLen,
+			IPv6PrefixLen: *ipv6PrefixLen,
+			Salt:          *salt,
+			KeepComments:  *keepComments,
+		},
+	}
+
+	if err := run(cfg, os.Stdin, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
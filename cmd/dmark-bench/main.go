@@ -0,0 +1,181 @@
+// Command dmark-bench measures parsing throughput on synthetic reports
+// or on reports from a directory.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+// syntheticReport returns a report with the given number of records,
+// shaped like reports from large receivers.
+func syntheticReport(records int) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" ?>
+<feedback>
+  <version>1.0</version>
+  <report_metadata>
+    <org_name>google.com</org_name>
+    <email>noreply-dmarc-support@google.com</email>
+    <extra_contact_info>https://support.google.com/a/answer/2466580</extra_contact_info>
+    <report_id>1234567890123456789</report_id>
+    <date_range>
+      <begin>1600000000</begin>
+      <end>1600086399</end>
+    </date_range>
+  </report_metadata>
+  <policy_published>
+    <domain>example.com</domain>
+    <adkim>r</adkim>
+    <aspf>r</aspf>
+    <p>quarantine</p>
+    <sp>quarantine</sp>
+    <pct>100</pct>
+    <fo>1</fo>
+  </policy_published>
+`)
+	for i := 0; i < records; i++ {
+		fmt.Fprintf(b, `  <record>
+    <row>
+      <source_ip>192.0.%d.%d</source_ip>
+      <count>%d</count>
+      <policy_evaluated>
+        <disposition>none</disposition>
+        <dkim>pass</dkim>
+        <spf>fail</spf>
+      </policy_evaluated>
+    </row>
+    <identifiers>
+      <header_from>example.com</header_from>
+    </identifiers>
+    <auth_results>
+      <dkim>
+        <domain>example.com</domain>
+        <selector>selector1</selector>
+        <result>pass</result>
+      </dkim>
+      <spf>
+        <domain>bounces.example.net</domain>
+        <result>pass</result>
+      </spf>
+    </auth_results>
+  </record>
+`, i/256%256, i%256, i%50+1)
+	}
+	b.WriteString("</feedback>\n")
+
+	return b.Bytes()
+}
+
+type input struct {
+	name    string
+	content []byte
+}
+
+func loadInputs(dir string) ([]input, error) {
+	if dir == "" {
+		return []input{
+			{"1 record", syntheticReport(1)},
+			{"100 records", syntheticReport(100)},
+			{"10000 records", syntheticReport(10000)},
+		}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+
+	inputs := []input{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", path, err)
+		}
+		inputs = append(inputs, input{filepath.Base(path), content})
+	}
+
+	return inputs, nil
+}
+
+// parsers are the benchmarked ways to parse a report.
+var parsers = []struct {
+	name  string
+	parse func(content []byte) (*dmark.Feedback, error)
+}{
+	{"Parse", func(content []byte) (*dmark.Feedback, error) {
+		return dmark.Parse(bytes.NewReader(content))
+	}},
+	{"BulkParser.Parse", func(content []byte) (*dmark.Feedback, error) {
+		return bulkParser.Parse(bytes.NewReader(content))
+	}},
+}
+
+var bulkParser = &dmark.BulkParser{}
+
+func run(dir string) error {
+	inputs, err := loadInputs(dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tPARSER\tSIZE\tNS/OP\tMB/S\tALLOCS/OP\tBYTES/OP")
+	for _, in := range inputs {
+		for _, parser := range parsers {
+			if _, err := parser.parse(in.content); err != nil {
+				return fmt.Errorf("parse %s: %w", in.name, err)
+			}
+
+			result := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(in.content)))
+				for i := 0; i < b.N; i++ {
+					if _, err := parser.parse(in.content); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			mbps := float64(len(in.content)) * float64(result.N) / result.T.Seconds() / 1e6
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%d\t%d\t%.2f\t%d\t%d\n",
+				strings.ReplaceAll(in.name, "\t", " "),
+				parser.name,
+				len(in.content),
+				result.NsPerOp(),
+				mbps,
+				result.AllocsPerOp(),
+				result.AllocedBytesPerOp(),
+			)
+		}
+	}
+
+	return w.Flush()
+}
+
+func main() {
+	dir := flag.String("r", "", "Path to directory with DMARK XML reports to benchmark, synthetic reports when empty")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	if err := run(*dir); err != nil {
+		logging.Fatal(err)
+	}
+}
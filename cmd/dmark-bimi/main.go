@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/bimi"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	reportsPath string
+	domain      string
+	dnsServer   string
+	timeout     time.Duration
+}
+
+func run(cfg config, out io.Writer) error {
+	if cfg.dnsServer != "" {
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, cfg.dnsServer)
+			},
+		}
+	}
+
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	checker := &bimi.Checker{}
+	for _, domain := range dmark.Summarize(reports).Domains {
+		if cfg.domain != "" && !strings.EqualFold(domain.Domain, cfg.domain) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+		readiness := checker.Check(ctx, domain.Domain, domain.Policy)
+		cancel()
+
+		if readiness.Ready() {
+			fmt.Fprintf(out, "%s: ready for BIMI\n", domain.Domain)
+			continue
+		}
+
+		fmt.Fprintf(out, "%s: not ready for BIMI\n", domain.Domain)
+		for _, gap := range readiness.Gaps {
+			fmt.Fprintf(out, "  - %s\n", gap)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	domain := flag.String("d", "", "Check only this policy domain")
+	dnsServer := flag.String("dns", "", "DNS server address (host:port) to use instead of the system resolver")
+	timeout := flag.Duration("timeout", 10*time.Second, "Timeout of checks for each domain")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		domain:      *domain,
+		dnsServer:   *dnsServer,
+		timeout:     *timeout,
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/bundle"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	reportsPath string
+	outPath     string
+	keyPath     string // Private key to sign with, unsigned when empty
+	verifyPath  string // Bundle to verify instead of creating one
+	publicPath  string // Public key to check the signature with
+	genKey      string // Path to write a new private key to
+}
+
+func run(cfg config) error {
+	switch {
+	case cfg.genKey != "":
+		if err := bundle.GenerateKey(cfg.genKey, cfg.genKey+".pub"); err != nil {
+			return err
+		}
+		slog.Info("Generated key", "private", cfg.genKey, "public", cfg.genKey+".pub")
+		return nil
+	case cfg.verifyPath != "":
+		return verify(cfg)
+	}
+
+	var key ed25519.PrivateKey
+	if cfg.keyPath != "" {
+		var err error
+		if key, err = bundle.LoadPrivateKey(cfg.keyPath); err != nil {
+			return err
+		}
+	}
+
+	files, reports, err := readReports(cfg.reportsPath)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Writing bundle", "path", cfg.outPath, "reports", len(files), "signed", key != nil)
+	manifest, err := bundle.Create(cfg.outPath, files, dmark.Summarize(reports), key)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	slog.Info("Bundle written", "files", len(manifest.Files), "created", manifest.Created)
+
+	return nil
+}
+
+// readReports reads raw *.xml reports in dir and parses them for the summary.
+// Reports that fail to parse are bundled, but left out of the summary.
+func readReports(dir string) ([]dmark.File, []dmark.Feedback, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	files := []dmark.File{}
+	reports := []dmark.Feedback{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".xml") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read file %q: %w", path, err)
+		}
+		files = append(files, dmark.File{Name: entry.Name(), Content: content})
+
+		report, err := dmark.ParseBytes(content)
+		if err != nil {
+			slog.Warn("Report left out of the summary", "path", path, "err", err)
+			continue
+		}
+		reports = append(reports, *report)
+	}
+
+	return files, reports, nil
+}
+
+func verify(cfg config) error {
+	var key ed25519.PublicKey
+	if cfg.publicPath != "" {
+		var err error
+		if key, err = bundle.LoadPublicKey(cfg.publicPath); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := bundle.VerifyFile(cfg.verifyPath, key)
+	if err != nil {
+		return fmt.Errorf("verify %q: %w", cfg.verifyPath, err)
+	}
+
+	if manifest.Signed && key == nil {
+		slog.Warn("Signature not checked, set -pub")
+	}
+	slog.Info(
+		"Bundle verified",
+		"reports", manifest.Reports,
+		"created", manifest.Created,
+		"signature_checked", key != nil,
+	)
+
+	return nil
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	outPath := flag.String("o", "./reports.tar.zst", "Path to the bundle to write: .tar.zst, .tar.gz or .tar")
+	keyPath := flag.String("key", "", "PEM file of an Ed25519 private key to sign the manifest with")
+	verifyPath := flag.String("verify", "", "Verify a bundle instead of creating one")
+	publicPath := flag.String("pub", "", "PEM file of the Ed25519 public key the bundle must be signed with, for -verify")
+	genKey := flag.String("genkey", "", "Write a new Ed25519 private key to this file and its public key to <file>.pub, then exit")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Starting...")
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		outPath:     *outPath,
+		keyPath:     *keyPath,
+		verifyPath:  *verifyPath,
+		publicPath:  *publicPath,
+		genKey:      *genKey,
+	}
+
+	if err := run(cfg); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Finished")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+	"github.com/spf13/cobra"
+)
+
+type config struct {
+	dir      string
+	tenant   string
+	command  string
+	date     string
+	domain   string
+	note     string
+	id       string
+	window   int
+	location *time.Location
+}
+
+func run(ctx context.Context, cfg config, out io.Writer) error {
+	s, err := store.Open(cfg.dir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if cfg.tenant != "" {
+		if s, err = s.Tenant(cfg.tenant); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	switch cfg.command {
+	case "add":
+		if cfg.date == "" {
+			return errors.New("-date is required")
+		}
+		date, err := time.Parse("2006-01-02", cfg.date)
+		if err != nil {
+			return fmt.Errorf("-date: %w", err)
+		}
+		change, err := s.AddChange(store.Change{Date: date, Domain: cfg.domain, Note: cfg.note})
+		if err != nil {
+			return fmt.Errorf("add change: %w", err)
+		}
+		fmt.Fprintf(out, "Added change %s\n", change.ID)
+	case "list":
+		changes, err := s.Changes()
+		if err != nil {
+			return err
+		}
+		var days []store.DomainDay
+		if cfg.location != nil {
+			days, err = s.DailyIn(ctx, cfg.location)
+		} else {
+			days, err = s.Daily(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("daily counts: %w", err)
+		}
+		return printImpacts(out, store.Impacts(changes, days, cfg.window))
+	case "remove":
+		if cfg.id == "" {
+			return errors.New("-id is required")
+		}
+		if err := s.RemoveChange(cfg.id); err != nil {
+			return fmt.Errorf("remove change: %w", err)
+		}
+		fmt.Fprintf(out, "Removed change %s\n", cfg.id)
+	default:
+		return fmt.Errorf("unknown command %q, expected add, list or remove", cfg.command)
+	}
+
+	return nil
+}
+
+func printImpacts(out io.Writer, impacts []store.ChangeImpact) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tDOMAIN\tBEFORE\tAFTER\tNOTE\t")
+	for _, impact := range impacts {
+		domain := impact.Domain
+		if domain == "" {
+			domain = "all"
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			impact.ID,
+			impact.Date.Format("2006-01-02"),
+			domain,
+			passRate(impact.Before),
+			passRate(impact.After),
+			impact.Note,
+		)
+	}
+
+	return w.Flush()
+}
+
+// passRate formats the pass rate with the number of messages, "-" without messages.
+func passRate(c dmark.Counts) string {
+	if c.Messages == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f%% of %d", c.PassRate()*100, c.Messages)
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.dir, "d", "./", "Path to the dmarkd reports directory")
+	flag.StringVar(&cfg.tenant, "tenant", "", "Tenant ID, for dmarkd with -tenants")
+	logOptions := logging.Flags()
+
+	var tz string
+	root := cli.New("", "")
+	root.PersistentPreRunE = func(*cobra.Command, []string) error {
+		return logOptions.Setup()
+	}
+	command := func(name, short string) *cobra.Command {
+		return &cobra.Command{
+			Use:               name,
+			Short:             short,
+			Args:              cobra.NoArgs,
+			ValidArgsFunction: cobra.NoFileCompletions,
+			RunE: func(*cobra.Command, []string) error {
+				cfg.command = name
+				if tz != "" {
+					var err error
+					if cfg.location, err = time.LoadLocation(tz); err != nil {
+						return fmt.Errorf("time zone: %w", err)
+					}
+				}
+				return run(context.Background(), cfg, os.Stdout)
+			},
+		}
+	}
+
+	add := command("add", "Record a change on -date with -note, of -domain or all domains")
+	add.Flags().StringVar(&cfg.date, "date", "", "Day of the change, e.g. 2021-03-01")
+	add.Flags().StringVar(&cfg.domain, "domain", "", "Policy domain of the change, with its subdomains; all domains when empty")
+	add.Flags().StringVar(&cfg.note, "note", "", `What changed, e.g. "added include:_spf.example.net to SPF"`)
+	list := command("list", "List changes with pass rates of -window days before and since each")
+	list.Flags().IntVar(&cfg.window, "window", 7, "Days before and since each change to compare pass rates of")
+	list.Flags().StringVar(&tz, "tz", "", `Time zone of days, e.g. "Europe/Berlin"; by the UTC day reports begin when empty`)
+	remove := command("remove", "Remove the change with -id")
+	remove.Flags().StringVar(&cfg.id, "id", "", "ID of the change to remove")
+	root.AddCommand(add, list, remove)
+
+	if err := cli.Execute(root); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+const long = `Compares two reports, or two directories of reports:
+
+  dmark-diff [flags] <before> <after>
+
+or reports of two periods, by the day their date range begins:
+
+  dmark-diff [flags] -r <dir> -before 2024-01-01..2024-01-07 -after 2024-01-08..2024-01-14`
+
+type config struct {
+	before      string
+	after       string
+	reportsPath string // Compare periods of this directory when set
+	top         int
+	where       string
+	json        bool
+}
+
+func run(cfg config, out io.Writer) error {
+	var before, after []dmark.Feedback
+	if cfg.reportsPath != "" {
+		reports, err := logging.ParseDir(cfg.reportsPath)
+		if err != nil {
+			return fmt.Errorf("read reports: %w", err)
+		}
+		if before, err = period(reports, cfg.before); err != nil {
+			return fmt.Errorf("-before: %w", err)
+		}
+		if after, err = period(reports, cfg.after); err != nil {
+			return fmt.Errorf("-after: %w", err)
+		}
+	} else {
+		var err error
+		if before, err = readReports(cfg.before); err != nil {
+			return err
+		}
+		if after, err = readReports(cfg.after); err != nil {
+			return err
+		}
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		before = where.Reports(before)
+		after = where.Reports(after)
+	}
+
+	diff := dmark.Diff(dmark.Summarize(before), dmark.Summarize(after))
+	if cfg.json {
+		return json.NewEncoder(out).Encode(diff)
+	}
+
+	printDiff(out, diff, cfg.top)
+	return nil
+}
+
+// readReports parses a report file, or the reports in a directory.
+func readReports(path string) ([]dmark.Feedback, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return logging.ParseDir(path)
+	}
+
+	feedback, err := dmark.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return []dmark.Feedback{*feedback}, nil
+}
+
+// period returns reports whose date range begins within "<from>..<to>", both days included.
+func period(reports []dmark.Feedback, value string) ([]dmark.Feedback, error) {
+	from, to, ok := strings.Cut(value, "..")
+	if !ok {
+		return nil, fmt.Errorf("expected <from>..<to>, got %q", value)
+	}
+	begin, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, fmt.Errorf("parse from: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, fmt.Errorf("parse to: %w", err)
+	}
+	end = end.AddDate(0, 0, 1)
+
+	result := []dmark.Feedback{}
+	for _, report := range reports {
+		t := time.Unix(int64(report.ReportMetadata.DateRange.Begin), 0)
+		if !t.Before(begin) && t.Before(end) {
+			result = append(result, report)
+		}
+	}
+
+	return result, nil
+}
+
+func printDiff(out io.Writer, diff dmark.SummaryDiff, top int) {
+	fmt.Fprintf(out, "All domains: %s\n", countsChange(diff.Before, diff.After))
+
+	for _, domain := range diff.Domains {
+		fmt.Fprintf(out, "\n%s: %s\n", domain.Domain, countsChange(domain.Before, domain.After))
+		switch {
+		case domain.Before.Messages == 0 && domain.After.Messages > 0:
+			fmt.Fprintln(out, "  new domain")
+		case domain.After.Messages == 0 && domain.Before.Messages > 0:
+			fmt.Fprintln(out, "  no reports after")
+		}
+		if domain.PolicyChanged {
+			p := domain.Policy
+			fmt.Fprintf(out, "  policy changed to p=%s sp=%s pct=%d adkim=%s aspf=%s\n", text(p.P), text(p.SP), p.Pct, text(p.ADKIM), text(p.ASPF))
+		}
+
+		printSources(out, "new sources", domain.New, top)
+		printChanges(out, "now failing", domain.Failing, top)
+		printChanges(out, "recovered", domain.Recovered, top)
+		printChanges(out, "volume shifts", domain.Shifted, top)
+		printSources(out, "gone sources", domain.Gone, top)
+	}
+}
+
+func printSources(out io.Writer, title string, sources []dmark.SourceSummary, top int) {
+	if len(sources) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "  %s:\n", title)
+	for i, source := range sources {
+		if i == top {
+			fmt.Fprintf(out, "    and %d more\n", len(sources)-top)
+			break
+		}
+		fmt.Fprintf(out, "    %-39s %d messages, %d failed\n", source.SourceIP, source.Messages, source.Failed())
+	}
+}
+
+func printChanges(out io.Writer, title string, changes []dmark.SourceChange, top int) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "  %s:\n", title)
+	for i, change := range changes {
+		if i == top {
+			fmt.Fprintf(out, "    and %d more\n", len(changes)-top)
+			break
+		}
+		fmt.Fprintf(
+			out,
+			"    %-39s %d/%d passed -> %d/%d passed\n",
+			change.SourceIP,
+			change.Before.Passed,
+			change.Before.Messages,
+			change.After.Passed,
+			change.After.Messages,
+		)
+	}
+}
+
+// countsChange describes the change of message volume and pass rate.
+func countsChange(before, after dmark.Counts) string {
+	return fmt.Sprintf(
+		"%d -> %d messages, %.1f%% -> %.1f%% passed DMARC",
+		before.Messages,
+		after.Messages,
+		before.PassRate()*100,
+		after.PassRate()*100,
+	)
+}
+
+func text(v interface{ MarshalText() ([]byte, error) }) string {
+	b, _ := v.MarshalText()
+	if len(b) == 0 {
+		return "-"
+	}
+
+	return string(b)
+}
+
+func main() {
+	reportsPath := flag.String("r", "", "Path to directory with DMARK XML reports, to compare -before and -after periods of")
+	before := flag.String("before", "", "Period to compare from with -r, <from>..<to> days, both included")
+	after := flag.String("after", "", "Period to compare to with -r")
+	top := flag.Int("n", 10, "Number of sources to show in each list")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	asJSON := flag.Bool("json", false, "Write the diff as JSON")
+	logOptions := logging.Flags()
+	cli.ParseCommand(cli.New("[<before> <after>]", long))
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		before:      *before,
+		after:       *after,
+		reportsPath: *reportsPath,
+		top:         *top,
+		where:       *where,
+		json:        *asJSON,
+	}
+	if cfg.reportsPath == "" {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		cfg.before, cfg.after = flag.Arg(0), flag.Arg(1)
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/spf"
+)
+
+// explainer checks DNS records behind failing DKIM and SPF results,
+// caching lookups as reports tend to repeat the same selectors and sources.
+type explainer struct {
+	timeout time.Duration
+	keys    map[string]string // DKIM key status by selector._domainkey.domain
+	spf     map[string]string // SPF status by domain and IP
+}
+
+func newExplainer(timeout time.Duration) *explainer {
+	return &explainer{
+		timeout: timeout,
+		keys:    map[string]string{},
+		spf:     map[string]string{},
+	}
+}
+
+func (e *explainer) explain(record dmark.Record) []string {
+	lines := []string{}
+
+	if !record.Row.PolicyEvaluated.DKIM {
+		if len(record.AuthResult.DKIM) == 0 {
+			lines = append(lines, "DKIM: messages were not signed")
+		}
+		for _, result := range record.AuthResult.DKIM {
+			if result.Result == dmark.DKIMResultPass {
+				continue
+			}
+			status, _ := result.Result.MarshalText()
+			lines = append(lines, fmt.Sprintf(
+				"DKIM %s for %s, selector %q: %s",
+				status,
+				result.Domain,
+				result.Selector,
+				e.keyStatus(result.Selector, result.Domain),
+			))
+		}
+	}
+
+	if !record.Row.PolicyEvaluated.SPF {
+		for _, result := range record.AuthResult.SPF {
+			lines = append(lines, fmt.Sprintf(
+				"SPF for %s: %s",
+				result.Domain,
+				e.spfStatus(record.Row.SourceIP, result.Domain),
+			))
+		}
+	}
+
+	return lines
+}
+
+func (e *explainer) keyStatus(selector, domain string) string {
+	if selector == "" {
+		return "selector not reported"
+	}
+
+	name := selector + "._domainkey." + domain
+	if status, ok := e.keys[name]; ok {
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var status string
+	key, err := dmark.LookupDKIMKey(ctx, selector, domain)
+	switch {
+	case err == dmark.ErrDKIMKeyNotFound:
+		status = "no key published at " + name
+	case err != nil:
+		status = "key lookup failed: " + err.Error()
+	case key.Revoked:
+		status = "key at " + name + " is revoked"
+	case key.Testing():
+		status = fmt.Sprintf("%s key of %d bits published, in testing mode", key.KeyType, key.Bits())
+	default:
+		status = fmt.Sprintf("%s key of %d bits published", key.KeyType, key.Bits())
+	}
+
+	e.keys[name] = status
+	return status
+}
+
+func (e *explainer) spfStatus(ip net.IP, domain string) string {
+	cacheKey := domain + " " + ip.String()
+	if status, ok := e.spf[cacheKey]; ok {
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var status string
+	result, err := spf.Check(ctx, ip, domain)
+	switch {
+	case err != nil:
+		status = "check failed: " + err.Error()
+	case result == dmark.SPFResultPass:
+		status = fmt.Sprintf("%s is authorized now, failures are alignment mismatches or past record changes", ip)
+	case result == dmark.SPFResultNone:
+		status = "no SPF record published"
+	default:
+		text, _ := result.MarshalText()
+		status = fmt.Sprintf("%s is not in SPF record (%s)", ip, text)
+	}
+
+	e.spf[cacheKey] = status
+	return status
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	reportsPath string
+	dnsServer   string
+	where       string
+	timeout     time.Duration
+}
+
+func run(cfg config, out io.Writer) error {
+	if cfg.dnsServer != "" {
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, cfg.dnsServer)
+			},
+		}
+	}
+
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		reports = where.Reports(reports)
+	}
+
+	e := newExplainer(cfg.timeout)
+	for _, report := range reports {
+		for _, record := range report.Records {
+			evaluated := record.Row.PolicyEvaluated
+			if evaluated.DKIM && evaluated.SPF {
+				continue
+			}
+
+			fmt.Fprintf(
+				out,
+				"%s %s x%d, header from %s (%s, report %s)\n",
+				report.PolicyPublished.Domain,
+				record.Row.SourceIP,
+				record.Row.Count,
+				record.Identifiers.HeaderFrom,
+				report.ReportMetadata.OrgName,
+				report.ReportMetadata.ReportID,
+			)
+			fmt.Fprintf(out, "  %s\n", record.Explain(report.PolicyPublished))
+			for _, line := range e.explain(record) {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	dnsServer := flag.String("dns", "", "DNS server address (host:port) to use instead of the system resolver")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	timeout := flag.Duration("timeout", 5*time.Second, "Timeout of each DNS lookup")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		dnsServer:   *dnsServer,
+		where:       *where,
+		timeout:     *timeout,
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+type config struct {
+	dir    string
+	tenant string
+	query  store.Query
+	where  string
+	format string
+}
+
+func run(ctx context.Context, cfg config, out io.Writer) error {
+	var where *filter.Filter
+	if cfg.where != "" {
+		var err error
+		if where, err = filter.Compile(cfg.where); err != nil {
+			return err
+		}
+	}
+
+	s, err := store.Open(cfg.dir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if cfg.tenant != "" {
+		if s, err = s.Tenant(cfg.tenant); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	w := bufio.NewWriter(out)
+	records, err := s.Export(ctx, w, cfg.format, cfg.query, where)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	slog.Debug("Exported records", "records", records)
+
+	return nil
+}
+
+func parseDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("-%s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+func main() {
+	dir := flag.String("d", "./", "Path to the store directory")
+	tenant := flag.String("tenant", "", "Tenant ID, for dmarkd with -tenants")
+	domain := flag.String("domain", "", "Policy domain, with its subdomains")
+	from := flag.String("from", "", "Reports beginning on or after the date, e.g. 2021-01-01")
+	to := flag.String("to", "", "Reports beginning before the date")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	format := flag.String("format", store.ExportCSV, "Output format: csv or ndjson, with the columns of dmark.FlatRecord")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		dir:    *dir,
+		tenant: *tenant,
+		query:  store.Query{Domain: *domain},
+		where:  *where,
+		format: *format,
+	}
+
+	var err error
+	if cfg.query.From, err = parseDate("from", *from); err != nil {
+		logging.Fatal(err)
+	}
+	if cfg.query.To, err = parseDate("to", *to); err != nil {
+		logging.Fatal(err)
+	}
+
+	if err = run(context.Background(), cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/convert"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+type config struct {
+	inPath    string
+	outPath   string
+	bolt      bool
+	statePath string
+	interval  time.Duration
+	workers   int
+	dryRun    bool
+	format    string
+}
+
+func run(ctx context.Context, cfg config) (logging.Summary, error) {
+	open := store.Open
+	if cfg.bolt {
+		open = store.OpenBolt
+	}
+	s, err := open(cfg.outPath)
+	if err != nil {
+		return logging.Summary{}, err
+	}
+	defer s.Close()
+	if !cfg.dryRun {
+		// merge counts of imported reports into counts.json, see store.Store.Refresh
+		defer func() {
+			if result, err := s.Refresh(ctx); err != nil {
+				slog.Warn("Failed to count reports", "err", err)
+			} else {
+				slog.Info("Counted reports", "reports", result.Reports, "added", result.Added)
+			}
+		}()
+	}
+
+	start := time.Now()
+	last := start
+	importer := &store.Importer{
+		Store:     s,
+		StatePath: cfg.statePath,
+		Workers:   cfg.workers,
+		DryRun:    cfg.dryRun,
+		OnReport: func(path string, file dmark.File) {
+			if cfg.dryRun {
+				slog.Info("Would import", "report", file.Name, "from", path)
+			}
+		},
+		OnSkip: func(path, name string) {
+			slog.Warn("Skipped, too large", "file", name, "from", path)
+		},
+		OnProgress: func(p store.ImportProgress) {
+			if time.Since(last) < cfg.interval && p.Done != p.Total {
+				slog.Debug("Processed", "path", p.Path)
+				return
+			}
+			last = time.Now()
+
+			elapsed := time.Since(start)
+			processed := p.Done - p.Resumed
+			var eta time.Duration
+			if processed > 0 {
+				eta = elapsed / time.Duration(processed) * time.Duration(p.Total-p.Done)
+			}
+			slog.Info(
+				"Progress",
+				"done", p.Done,
+				"total", p.Total,
+				"percent", p.Done*100/p.Total,
+				"saved", p.Saved,
+				"duplicates", p.Duplicates,
+				"invalid", p.Invalid,
+				"skipped", p.Skipped,
+				"resumed", p.Resumed,
+				"eta", eta.Round(time.Second),
+			)
+		},
+	}
+
+	slog.Info("Importing", "from", cfg.inPath, "to", cfg.outPath, "state", cfg.statePath, "workers", cfg.workers, "dry_run", cfg.dryRun)
+	var p store.ImportProgress
+	if cfg.format == "" {
+		p, err = importer.ImportDir(ctx, cfg.inPath)
+	} else {
+		p, err = importConverted(importer, cfg.format, cfg.inPath)
+	}
+	summary := logging.Summary{Parsed: p.Saved, Skipped: p.Duplicates + p.Resumed, Failed: p.Invalid + p.Skipped}
+	if errors.Is(err, context.Canceled) {
+		slog.Info("Interrupted, run again to resume", "done", p.Done, "total", p.Total, "saved", p.Saved)
+		return summary, nil
+	}
+	if err != nil {
+		return summary, fmt.Errorf("import: %w", err)
+	}
+
+	msg := "Imported"
+	if cfg.dryRun {
+		msg = "Would import, nothing saved"
+	}
+	slog.Info(
+		msg,
+		"files", p.Total,
+		"saved", p.Saved,
+		"duplicates", p.Duplicates,
+		"invalid", p.Invalid,
+		"skipped", p.Skipped,
+		"resumed", p.Resumed,
+		"duration", time.Since(start).Round(time.Millisecond),
+	)
+	return summary, nil
+}
+
+// importConverted imports reports from an export of another tool.
+func importConverted(importer *store.Importer, format, path string) (store.ImportProgress, error) {
+	read, ok := convert.Formats[format]
+	if !ok {
+		return store.ImportProgress{}, fmt.Errorf("unknown format %q", format)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return store.ImportProgress{}, fmt.Errorf("open export: %w", err)
+	}
+	defer f.Close()
+
+	reports, err := read(f)
+	if err != nil {
+		return store.ImportProgress{}, fmt.Errorf("read %s export: %w", format, err)
+	}
+
+	return importer.ImportReports(path, reports)
+}
+
+func main() {
+	inPath := flag.String("i", "./", "Path to directory or file with archived reports: XML, gzip, zip, .eml, mbox files or tarballs of them")
+	outPath := flag.String("o", "./reports", "Path to store directory")
+	bolt := flag.Bool("bolt", false, "Keep raw reports in reports.db, a BoltDB file in the -o directory, instead of XML files; directories with reports.db use it regardless")
+	statePath := flag.String("state", ".dmark-import.state", "Path to state file recording processed files, empty to disable")
+	interval := flag.Duration("progress", 10*time.Second, "Interval between progress log entries")
+	workers := flag.Int("workers", runtime.NumCPU(), "Files read and parsed in parallel")
+	dryRun := flag.Bool("dry-run", false, "Log reports that would be imported, without saving them or the state")
+	format := flag.String("format", "", "Format of the -i file exported by another tool: parsedmarc-json, parsedmarc-csv or dmarcts-mysql; report files when empty")
+	summaryJSON := logging.SummaryFlag()
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Summary{}.Exit(*summaryJSON, err)
+	}
+
+	cfg := config{
+		inPath:    *inPath,
+		outPath:   *outPath,
+		bolt:      *bolt,
+		statePath: *statePath,
+		interval:  *interval,
+		workers:   *workers,
+		dryRun:    *dryRun,
+		format:    *format,
+	}
+
+	// files being processed are finished and recorded in the state file on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := run(ctx, cfg)
+	summary.Exit(*summaryJSON, err)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/mtasts"
+)
+
+type config struct {
+	domain      string
+	reportsPath string
+	policyPath  string
+	timeout     time.Duration
+}
+
+func run(cfg config, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	policy, err := loadPolicy(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	reports, err := loadReports(cfg.reportsPath)
+	if err != nil {
+		return err
+	}
+
+	c := mtasts.Correlate(cfg.domain, policy, reports)
+
+	if policy == nil {
+		fmt.Fprintf(out, "%s: no MTA-STS policy\n", c.Domain)
+	} else {
+		fmt.Fprintf(out, "%s: mode %s, max_age %d, mx %s\n", c.Domain, policy.Mode, policy.MaxAge, strings.Join(policy.MX, ", "))
+	}
+	fmt.Fprintf(out, "TLS reports: %d, sessions: %d successful, %d failed, %d without policy\n", len(reports), c.Successful, c.Failed, c.NoPolicy)
+
+	types := make([]string, 0, len(c.FailureTypes))
+	for t := range c.FailureTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Fprintf(out, "  %s: %d\n", t, c.FailureTypes[t])
+	}
+
+	if len(c.UnknownMX) > 0 {
+		fmt.Fprintf(out, "MX hosts not allowed by the policy: %s\n", strings.Join(c.UnknownMX, ", "))
+	}
+	if c.Outdated > 0 {
+		fmt.Fprintf(out, "Reports evaluating a different policy: %d\n", c.Outdated)
+	}
+
+	return nil
+}
+
+func loadPolicy(ctx context.Context, cfg config) (*mtasts.Policy, error) {
+	if cfg.policyPath != "" {
+		file, err := os.Open(cfg.policyPath)
+		if err != nil {
+			return nil, fmt.Errorf("open %q: %w", cfg.policyPath, err)
+		}
+		defer file.Close()
+
+		return mtasts.ParsePolicy(file)
+	}
+
+	if _, err := mtasts.LookupRecord(ctx, cfg.domain); err != nil {
+		if err == mtasts.ErrNoRecord {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return mtasts.FetchPolicy(ctx, nil, cfg.domain)
+}
+
+// loadReports parses *.json and *.json.gz TLS reports in a directory.
+func loadReports(dir string) ([]mtasts.Report, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	reports := []mtasts.Report{}
+	for _, f := range files {
+		if f.IsDir() || !(strings.HasSuffix(f.Name(), ".json") || strings.HasSuffix(f.Name(), ".json.gz")) {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name())
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open %q: %w", path, err)
+		}
+		report, err := mtasts.ParseReport(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", path, err)
+		}
+
+		reports = append(reports, *report)
+	}
+
+	return reports, nil
+}
+
+func main() {
+	domain := flag.String("d", "", "Policy domain")
+	reportsPath := flag.String("r", "./", "Path to directory with TLS-RPT reports (*.json, *.json.gz)")
+	policyPath := flag.String("policy", "", "Path to a local policy file to use instead of fetching it")
+	timeout := flag.Duration("timeout", 10*time.Second, "Timeout of policy lookup")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	if *domain == "" {
+		logging.Fatal(errors.New("-d is required"))
+	}
+
+	cfg := config{
+		domain:      *domain,
+		reportsPath: *reportsPath,
+		policyPath:  *policyPath,
+		timeout:     *timeout,
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
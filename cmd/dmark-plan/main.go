@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/dmarc"
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+// fixes tell what to do about sources failing for a reason, see dmark.PlanSender.
+var fixes = map[string]string{
+	dmark.PlanStrictAlignment: "sign with, or send from, the From domain itself",
+	dmark.PlanUnaligned:       "sign with d= of the From domain, or send from it",
+	dmark.PlanUnauthenticated: "add to SPF and set up DKIM, or stop it sending as the domain",
+}
+
+type config struct {
+	reportsPath string
+	target      string // DMARC record tags of the policy to move to
+	threshold   float64
+	forwarders  string // File of known forwarder networks
+	top         int
+	where       string
+	json        bool
+}
+
+func run(cfg config, out io.Writer) error {
+	if !strings.HasPrefix(strings.TrimSpace(cfg.target), "v=") {
+		cfg.target = "v=DMARC1; " + cfg.target
+	}
+	target, err := dmarc.Parse(cfg.target)
+	if err != nil {
+		return fmt.Errorf("-target: %w", err)
+	}
+	if cfg.threshold < 0 || cfg.threshold > 1 {
+		return fmt.Errorf("-threshold %v is out of range 0..1", cfg.threshold)
+	}
+
+	detector := &dmark.ForwardingDetector{}
+	if cfg.forwarders != "" {
+		if detector.Forwarders, err = dmark.LoadForwarders(cfg.forwarders); err != nil {
+			return err
+		}
+	}
+
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		reports = where.Reports(reports)
+	}
+
+	plans := dmark.Plan(reports, target, cfg.threshold, detector)
+	if cfg.json {
+		return json.NewEncoder(out).Encode(plans)
+	}
+	if len(plans) == 0 {
+		fmt.Fprintln(out, "No reports")
+		return nil
+	}
+
+	for i, plan := range plans {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if err = printPlan(out, plan, cfg.top); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printPlan(out io.Writer, plan dmark.PolicyPlan, top int) error {
+	fmt.Fprintf(out, "%s: %s -> %s\n", plan.Domain, policyText(plan.Current), policyText(plan.Target))
+	fmt.Fprintf(out, "%d messages, %d failing under the target policy", plan.Messages, plan.Failing)
+	if plan.Forwarded > 0 {
+		fmt.Fprintf(out, ", %d of them likely forwarded", plan.Forwarded)
+	}
+	fmt.Fprintln(out)
+
+	if len(plan.Senders) > 0 {
+		fmt.Fprintln(out, "\nFix first:")
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SOURCE IP\tHEADER FROM\tMESSAGES\tFAILING\tREASON\tFIX\t")
+		for i, sender := range plan.Senders {
+			if i == top {
+				fmt.Fprintf(w, "and %d more\t\t\t\t\t\t\n", len(plan.Senders)-top)
+				break
+			}
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%d\t%d\t%s\t%s\t\n",
+				sender.SourceIP,
+				sender.HeaderFrom,
+				sender.Messages,
+				sender.Failing,
+				sender.Reason,
+				fixes[sender.Reason],
+			)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(plan.Steps) == 0 {
+		fmt.Fprintln(out, "\nNothing to roll out: the published policy is as strict as the target")
+		return nil
+	}
+
+	fmt.Fprintln(out, "\nRollout:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tPOLICY\tPASS RATE\tTHRESHOLD\tQUARANTINED\tREJECTED\tREADY\t")
+	for i, step := range plan.Steps {
+		threshold, ready := "-", "yes"
+		if step.Threshold > 0 {
+			threshold = fmt.Sprintf("%.1f%%", step.Threshold*100)
+		}
+		if !step.Ready() {
+			ready = "no"
+		}
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%.1f%%\t%s\t%d\t%d\t%s\t\n",
+			i+1,
+			policyText(step.Policy),
+			step.PassRate*100,
+			threshold,
+			step.Quarantined,
+			step.Rejected,
+			ready,
+		)
+	}
+
+	return w.Flush()
+}
+
+// policyText writes the tags of the policy a plan changes, like in a DMARC record.
+func policyText(policy dmark.PolicyPublished) string {
+	tags := []string{"p=" + text(policy.P, "none")}
+	if policy.SP != 0 {
+		tags = append(tags, "sp="+text(policy.SP, ""))
+	}
+	if policy.Pct != 0 && policy.Pct != 100 {
+		tags = append(tags, fmt.Sprintf("pct=%d", policy.Pct))
+	}
+	tags = append(tags, "adkim="+text(policy.ADKIM, "r"), "aspf="+text(policy.ASPF, "r"))
+
+	return strings.Join(tags, "; ")
+}
+
+// text returns the tag value, or the default one when the tag is absent.
+func text(v interface{ MarshalText() ([]byte, error) }, absent string) string {
+	b, _ := v.MarshalText()
+	if len(b) == 0 {
+		return absent
+	}
+
+	return string(b)
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	target := flag.String("target", "p=reject; adkim=s; aspf=s", "Policy to move to, in DMARC record tags: p, sp, pct, adkim and aspf")
+	threshold := flag.Float64("threshold", dmark.PlanThreshold, "Pass rate of mail sent directly, from 0 to 1, to reach before quarantining or rejecting messages")
+	forwarders := flag.String("forwarders", "", "File of known forwarder IP addresses or CIDRs, one per line, whose failing messages are left out of pass rates")
+	top := flag.Int("n", 10, "Number of sources to fix to show for each domain")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	asJSON := flag.Bool("json", false, "Write plans as JSON, see dmark.PolicyPlan")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		target:      *target,
+		threshold:   *threshold,
+		forwarders:  *forwarders,
+		top:         *top,
+		where:       *where,
+		json:        *asJSON,
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+func run(dir string, keep time.Duration, dryRun bool) error {
+	s, err := store.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	before := time.Now().Add(-keep)
+	slog.Info("Rolling up reports", "ended_before", before.UTC().Format(time.RFC3339))
+
+	prune, msg := s.Prune, "Pruned"
+	if dryRun {
+		prune, msg = s.PruneDryRun, "Would prune, nothing changed"
+	}
+	result, err := prune(context.Background(), before)
+	if err != nil {
+		return fmt.Errorf("prune: %w", err)
+	}
+
+	slog.Info(
+		msg,
+		"reports", result.Reports,
+		"records", result.Records,
+		"rollups", result.Rollups,
+	)
+	return nil
+}
+
+func main() {
+	dir := flag.String("d", "./", "Path to reports directory")
+	days := flag.Int("keep", 90, "Number of days to keep raw reports for")
+	dryRun := flag.Bool("dry-run", false, "Log how many reports would be removed and rollups kept, without changing the directory")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Starting...")
+
+	if err := run(*dir, time.Duration(*days)*24*time.Hour, *dryRun); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Finished")
+}
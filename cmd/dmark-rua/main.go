@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/dmarc"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	domains     []string
+	reportsPath string
+	dnsServer   string
+	timeout     time.Duration
+}
+
+// run checks report destinations of the domains, returning an error when
+// any has problems, so scripts can tell.
+func run(cfg config, out io.Writer) error {
+	if cfg.dnsServer != "" {
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, cfg.dnsServer)
+			},
+		}
+	}
+
+	domains := cfg.domains
+	if len(domains) == 0 {
+		reports, err := logging.ParseDir(cfg.reportsPath)
+		if err != nil {
+			return fmt.Errorf("read reports: %w", err)
+		}
+		for _, domain := range dmark.Summarize(reports).Domains {
+			domains = append(domains, domain.Domain)
+		}
+	}
+
+	checker := &dmarc.Checker{}
+	failed := 0
+	for _, domain := range domains {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+		ok := check(ctx, checker, domain, out)
+		cancel()
+		if !ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d domains have problems", failed, len(domains))
+	}
+
+	return nil
+}
+
+func check(ctx context.Context, checker *dmarc.Checker, domain string, out io.Writer) bool {
+	record, err := checker.LookupRecord(ctx, domain)
+	if err != nil {
+		fmt.Fprintf(out, "%s: %s\n", domain, err)
+		return false
+	}
+
+	fmt.Fprintf(out, "%s: %s\n", domain, record.Text)
+	if record.Policy.Domain != domain {
+		fmt.Fprintf(out, "  (the record of the organizational domain %s applies)\n", record.Policy.Domain)
+	}
+
+	destinations, problems := checker.Check(ctx, record.Policy)
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  - %s\n", problem)
+	}
+	ok := len(problems) == 0
+	for _, d := range destinations {
+		if len(d.Problems) == 0 {
+			fmt.Fprintf(out, "  %s %s: ok\n", d.Tag, d.URI)
+			continue
+		}
+
+		ok = false
+		fmt.Fprintf(out, "  %s %s:\n", d.Tag, d.URI)
+		for _, problem := range d.Problems {
+			fmt.Fprintf(out, "    - %s\n", problem)
+		}
+	}
+
+	return ok
+}
+
+func main() {
+	domains := flag.String("d", "", "Comma-separated domains to check, policy domains of reports in -r when empty")
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	dnsServer := flag.String("dns", "", "DNS server address (host:port) to use instead of the system resolver")
+	timeout := flag.Duration("timeout", 10*time.Second, "Timeout of checks for each domain")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		dnsServer:   *dnsServer,
+		timeout:     *timeout,
+	}
+	for _, domain := range strings.Split(*domains, ",") {
+		if domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."); domain != "" {
+			cfg.domains = append(cfg.domains, domain)
+		}
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
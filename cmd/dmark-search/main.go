@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+type config struct {
+	dir    string
+	tenant string
+	query  store.SearchQuery
+	format string
+}
+
+func run(ctx context.Context, cfg config, out io.Writer) error {
+	s, err := store.Open(cfg.dir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if cfg.tenant != "" {
+		if s, err = s.Tenant(cfg.tenant); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	reports, err := s.Search(ctx, cfg.query)
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	records := []dmark.FlatRecord{}
+	for _, report := range reports {
+		records = append(records, dmark.Flatten(report)...)
+	}
+
+	switch cfg.format {
+	case "table":
+		return printTable(out, records)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "csv":
+		w := csv.NewWriter(out)
+		if err = w.Write(dmark.FlatColumns); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err = w.Write(record.Strings()); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	return fmt.Errorf("unsupported format %q", cfg.format)
+}
+
+func printTable(out io.Writer, records []dmark.FlatRecord) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BEGIN\tORG\tREPORT ID\tDOMAIN\tSOURCE\tCOUNT\tDISPOSITION\tDKIM\tSPF\tHEADER FROM\t")
+	for _, r := range records {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t\n",
+			r.Begin.Format("2006-01-02"),
+			r.OrgName,
+			r.ReportID,
+			r.Domain,
+			r.SourceIP,
+			r.Count,
+			r.Disposition,
+			r.DKIM,
+			r.SPF,
+			r.HeaderFrom,
+		)
+	}
+
+	return w.Flush()
+}
+
+func parseDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("-%s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+func main() {
+	dir := flag.String("d", "./", "Path to the store directory")
+	tenant := flag.String("tenant", "", "Tenant ID, for dmarkd with -tenants")
+	ip := flag.String("ip", "", "Source IP address or network in CIDR notation, e.g. 203.0.113.7 or 203.0.113.0/24")
+	domain := flag.String("domain", "", "Part of the policy domain or of a header from, envelope, DKIM or SPF domain")
+	selector := flag.String("selector", "", "DKIM selector")
+	reportID := flag.String("report-id", "", "Report ID")
+	org := flag.String("org", "", "Part of the reporter name, e.g. google")
+	from := flag.String("from", "", "Reports beginning on or after the date, e.g. 2021-01-01")
+	to := flag.String("to", "", "Reports beginning before the date")
+	format := flag.String("format", "table", "Output format: table, json or csv, with the columns of dmark.FlatRecord")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		dir:    *dir,
+		tenant: *tenant,
+		query: store.SearchQuery{
+			Domain:   strings.TrimSuffix(*domain, "."),
+			Selector: *selector,
+			ReportID: *reportID,
+			OrgName:  *org,
+		},
+		format: *format,
+	}
+
+	var err error
+	if *ip != "" {
+		if cfg.query.Source, err = store.ParseSource(*ip); err != nil {
+			logging.Fatal(err)
+		}
+	}
+	if cfg.query.From, err = parseDate("from", *from); err != nil {
+		logging.Fatal(err)
+	}
+	if cfg.query.To, err = parseDate("to", *to); err != nil {
+		logging.Fatal(err)
+	}
+
+	if err = run(context.Background(), cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	addr       string
+	hostname   string
+	recipients []string
+	maxSize    int64
+	certPath   string
+	keyPath    string
+	outPath    string
+
+	shutdownTimeout time.Duration
+}
+
+func run(ctx context.Context, cfg config) error {
+	s := &server{
+		hostname:   cfg.hostname,
+		recipients: map[string]bool{},
+		maxSize:    cfg.maxSize,
+		outPath:    cfg.outPath,
+	}
+	for _, r := range cfg.recipients {
+		s.recipients[strings.ToLower(strings.TrimSpace(r))] = true
+	}
+
+	if cfg.certPath != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.certPath, cfg.keyPath)
+		if err != nil {
+			return fmt.Errorf("load certificate: %w", err)
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if err := os.MkdirAll(cfg.outPath, 0755); err != nil {
+		return fmt.Errorf("create dir %q: %w", cfg.outPath, err)
+	}
+
+	listener, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		return fmt.Errorf("listen %q: %w", cfg.addr, err)
+	}
+
+	slog.Info("Listening", "addr", cfg.addr)
+	if err = s.serve(ctx, listener); err != nil {
+		return err
+	}
+
+	slog.Info("Shutting down", "timeout", cfg.shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	if !s.wait(ctx) {
+		slog.Warn("Dropped sessions in flight")
+	}
+
+	return nil
+}
+
+func main() {
+	hostname, _ := os.Hostname()
+
+	addr := flag.String("addr", ":25", "Address to listen on")
+	flag.StringVar(&hostname, "hostname", hostname, "Host name to announce")
+	recipients := flag.String("rcpt", "", "Comma-separated rua addresses to accept mail for, any when empty")
+	maxSize := flag.Int64("max-size", 20<<20, "Maximum message size in bytes")
+	certPath := flag.String("cert", "", "Path to TLS certificate, enables STARTTLS")
+	keyPath := flag.String("key", "", "Path to TLS certificate key")
+	outPath := flag.String("o", "./", "Path to directory to save DMARK XML reports to")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Time to let sessions in flight finish on SIGINT or SIGTERM")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Starting...")
+
+	cfg := config{
+		addr:     *addr,
+		hostname: hostname,
+		maxSize:  *maxSize,
+		certPath: *certPath,
+		keyPath:  *keyPath,
+		outPath:  *outPath,
+
+		shutdownTimeout: *shutdownTimeout,
+	}
+	if *recipients != "" {
+		cfg.recipients = strings.Split(*recipients, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Stopped")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// server is a minimal SMTP server (RFC 5321) accepting report emails
+// for the configured recipients and storing the attached reports.
+type server struct {
+	hostname   string
+	recipients map[string]bool // Lower case addresses, any recipient when empty
+	maxSize    int64
+	tlsConfig  *tls.Config // STARTTLS is offered when set
+	outPath    string
+
+	closing  atomic.Bool    // Set when ctx of serve is done
+	sessions sync.WaitGroup // Connections being handled
+}
+
+// serve accepts connections until ctx is done. Sessions in flight go on
+// until their next command, which is answered with 421, see wait.
+func (s *server) serve(ctx context.Context, listener net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		s.closing.Store(true)
+		listener.Close()
+	})
+	defer stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		s.sessions.Add(1)
+		go func() {
+			defer s.sessions.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// wait waits for sessions in flight until ctx is done,
+// reporting whether all of them finished.
+func (s *server) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		s.sessions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// maxCommandLine is the maximum length of a command line including <CRLF>,
+// see RFC 5321 section 4.5.3.1.4.
+const maxCommandLine = 512
+
+var errLineTooLong = errors.New("command line too long")
+
+// session holds the state of a single SMTP transaction.
+type session struct {
+	from string
+	to   []string
+}
+
+func (s *server) handle(c net.Conn) {
+	defer c.Close()
+
+	remote := c.RemoteAddr().String()
+	// commands are read from a buffer of maxCommandLine, so that clients
+	// cannot make lines take more memory than that, see readCommand
+	r := bufio.NewReaderSize(c, maxCommandLine)
+	w := textproto.NewWriter(bufio.NewWriter(c))
+	reply := func(code int, text string) bool {
+		_ = c.SetWriteDeadline(time.Now().Add(time.Minute))
+		if err := w.PrintfLine("%d %s", code, text); err != nil {
+			slog.Error("Failed to reply", "remote", remote, "err", err)
+			return false
+		}
+		return true
+	}
+
+	if !reply(220, s.hostname+" ESMTP dmark-smtpd") {
+		return
+	}
+
+	tlsActive := false
+	sess := session{}
+	for {
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := readCommand(r)
+		if err == errLineTooLong {
+			reply(500, "Line too long")
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				slog.Error("Failed to read command", "remote", remote, "err", err)
+			}
+			return
+		}
+
+		if s.closing.Load() {
+			reply(421, s.hostname+" Service shutting down")
+			return
+		}
+
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess = session{}
+			reply(250, s.hostname)
+
+		case "EHLO":
+			sess = session{}
+			extensions := []string{s.hostname, "8BITMIME", "SIZE " + strconv.FormatInt(s.maxSize, 10)}
+			if s.tlsConfig != nil && !tlsActive {
+				extensions = append(extensions, "STARTTLS")
+			}
+			for i, ext := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				if err := w.PrintfLine("250%s%s", separator, ext); err != nil {
+					return
+				}
+			}
+
+		case "STARTTLS":
+			if s.tlsConfig == nil || tlsActive {
+				reply(502, "STARTTLS not available")
+				continue
+			}
+			if !reply(220, "Ready to start TLS") {
+				return
+			}
+			tlsConn := tls.Server(c, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				slog.Error("TLS handshake failed", "remote", remote, "err", err)
+				return
+			}
+			c = tlsConn
+			r = bufio.NewReaderSize(c, maxCommandLine)
+			w = textproto.NewWriter(bufio.NewWriter(c))
+			tlsActive = true
+			sess = session{}
+
+		case "MAIL":
+			if !strings.HasPrefix(strings.ToUpper(arg), "FROM:") {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			sess = session{from: parsePath(arg[len("FROM:"):])}
+			reply(250, "OK")
+
+		case "RCPT":
+			if !strings.HasPrefix(strings.ToUpper(arg), "TO:") {
+				reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+			to := strings.ToLower(parsePath(arg[len("TO:"):]))
+			if len(s.recipients) > 0 && !s.recipients[to] {
+				reply(550, "No such recipient")
+				continue
+			}
+			sess.to = append(sess.to, to)
+			reply(250, "OK")
+
+		case "DATA":
+			if len(sess.to) == 0 {
+				reply(503, "RCPT first")
+				continue
+			}
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+
+			_ = c.SetReadDeadline(time.Now().Add(10 * time.Minute))
+			dot := textproto.NewReader(r).DotReader()
+			data, err := ioutil.ReadAll(io.LimitReader(dot, s.maxSize+1))
+			if err != nil {
+				slog.Error("Failed to read data", "remote", remote, "err", err)
+				return
+			}
+			if int64(len(data)) > s.maxSize {
+				// drain the rest of the message to stay in sync with the client,
+				// with the same reader, which may be in the middle of a line
+				if _, err = io.Copy(ioutil.Discard, dot); err != nil {
+					slog.Error("Failed to read data", "remote", remote, "err", err)
+					return
+				}
+				reply(552, "Message too large")
+				sess = session{}
+				continue
+			}
+
+			code, text := s.deliver(remote, sess, data)
+			reply(code, text)
+			sess = session{}
+
+		case "RSET":
+			sess = session{}
+			reply(250, "OK")
+
+		case "NOOP":
+			reply(250, "OK")
+
+		case "QUIT":
+			reply(221, "Bye")
+			return
+
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// readCommand reads a command line without <CRLF>. Lines longer than
+// maxCommandLine, the size of r's buffer, are read to their end and discarded,
+// returning errLineTooLong.
+func readCommand(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		for err == bufio.ErrBufferFull {
+			_, err = r.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// deliver stores the reports attached to a message,
+// rejecting messages without any valid report.
+func (s *server) deliver(remote string, sess session, data []byte) (int, string) {
+	files, err := dmark.ExtractReports(bytes.NewReader(data))
+	if err != nil {
+		slog.Warn("No reports in message", "from", sess.from, "remote", remote, "err", err)
+		return 550, "Message is not a DMARC report"
+	}
+
+	saved := 0
+	for _, file := range files {
+		if _, err := dmark.ParseBytes(file.Content); err != nil {
+			slog.Warn("Invalid report", "from", sess.from, "remote", remote, "file", file.Name, "err", err)
+			continue
+		}
+
+		path, _, err := dmark.SaveFile(s.outPath, file)
+		if err != nil {
+			slog.Error("Failed to save report", "from", sess.from, "remote", remote, "err", err)
+			return 451, "Failed to store report, try again later"
+		}
+		slog.Info("Saved report", "path", path, "from", sess.from, "remote", remote)
+		saved++
+	}
+
+	if saved == 0 {
+		return 550, "Message has no DMARC reports attached"
+	}
+
+	return 250, "OK"
+}
+
+// parsePath returns the address of "<address>" with optional parameters, e.g. " <a@b.c> SIZE=123".
+func parsePath(path string) string {
+	path = strings.TrimSpace(path)
+	if i := strings.IndexByte(path, '>'); strings.HasPrefix(path, "<") && i > 0 {
+		return path[1:i]
+	}
+	if i := strings.IndexByte(path, ' '); i >= 0 {
+		return path[:i]
+	}
+
+	return path
+}
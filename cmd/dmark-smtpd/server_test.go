@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dial starts handling a connection of s and returns the client end,
+// after reading the greeting.
+func dial(t *testing.T, s *server) *textproto.Conn {
+	t.Helper()
+
+	client, conn := net.Pipe()
+	go s.handle(conn)
+	t.Cleanup(func() { client.Close() })
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c := textproto.NewConn(client)
+	if _, _, err := c.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// command sends line and checks the reply code.
+func command(t *testing.T, c *textproto.Conn, line string, code int) {
+	t.Helper()
+
+	if err := c.PrintfLine("%s", line); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadResponse(code); err != nil {
+		t.Fatalf("%.20s: %v %s", line, err, msg)
+	}
+}
+
+func TestHandleLongCommandLine(t *testing.T) {
+	c := dial(t, &server{hostname: "test", maxSize: 1024})
+
+	command(t, c, "HELO "+strings.Repeat("a", maxCommandLine-len("HELO \r\n")), 250)
+	command(t, c, "HELO "+strings.Repeat("a", maxCommandLine), 500)
+	command(t, c, "NOOP "+strings.Repeat("a", 64*maxCommandLine), 500)
+	command(t, c, "NOOP", 250)
+}
+
+func TestHandleOversizedData(t *testing.T) {
+	c := dial(t, &server{hostname: "test", maxSize: 10})
+
+	command(t, c, "HELO client", 250)
+	command(t, c, "MAIL FROM:<a@example.com>", 250)
+	command(t, c, "RCPT TO:<b@example.com>", 250)
+	command(t, c, "DATA", 354)
+
+	// the limit ends in the middle of the first line, right before a dot
+	// that must not be taken for the end of data
+	if err := c.PrintfLine("0123456789.\r\nXYZZY\r\n."); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadResponse(552); err != nil {
+		t.Fatalf("%v %s", err, msg)
+	}
+
+	command(t, c, "NOOP", 250)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/spf"
+)
+
+// lookupLimit is the number of DNS lookups an SPF record may take (RFC 7208 Section 4.6.4).
+const lookupLimit = 10
+
+type config struct {
+	reportsPath string
+	domain      string
+	dnsServer   string
+	prefixes    dmark.Prefixes
+	timeout     time.Duration
+}
+
+// usage counts sources of reports a mechanism authorized.
+type usage struct {
+	dmark.Counts
+	Sources int
+}
+
+func run(cfg config, out io.Writer) error {
+	if cfg.dnsServer != "" {
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, cfg.dnsServer)
+			},
+		}
+	}
+
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+	domainReports := []dmark.Feedback{}
+	for _, report := range reports {
+		if strings.EqualFold(strings.TrimSuffix(report.PolicyPublished.Domain, "."), cfg.domain) {
+			domainReports = append(domainReports, report)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	tree, err := (&spf.Checker{}).Expand(ctx, cfg.domain)
+	if err != nil {
+		return fmt.Errorf("SPF record of %s: %w", cfg.domain, err)
+	}
+
+	// sources by the mechanisms authorizing them, and those failing SPF
+	used := map[*spf.Term]*usage{}
+	unauthorized := []dmark.SourceSummary{}
+	for _, source := range dmark.Sources(domainReports) {
+		path, result := tree.Match(source.SourceIP)
+		if result != dmark.SPFResultPass {
+			unauthorized = append(unauthorized, source)
+		}
+		for _, term := range path {
+			u, ok := used[term]
+			if !ok {
+				u = &usage{}
+				used[term] = u
+			}
+			u.Merge(source.Counts)
+			u.Sources++
+		}
+	}
+
+	lookups := tree.Lookups()
+	fmt.Fprintf(out, "%s: %d DNS lookups of %d", cfg.domain, lookups, lookupLimit)
+	if lookups > lookupLimit {
+		fmt.Fprint(out, ", over the limit: receivers may fail SPF with permerror")
+	}
+	fmt.Fprintf(out, "\n%d reports, %d sources\n\n", len(domainReports), len(dmark.Sources(domainReports)))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MECHANISM\tLOOKUPS\tSOURCES\tMESSAGES\tNOTE\t")
+	printTree(w, tree, used, "")
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	// sources passing DKIM are likely legitimate senders missing from the record
+	missing := []dmark.SourceSummary{}
+	for _, source := range unauthorized {
+		if source.DKIMPassed > 0 {
+			missing = append(missing, source)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(out, "\nNot authorized by SPF, but passing DKIM:")
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NETWORK\tSOURCES\tMESSAGES\tDKIM PASS\t")
+	for _, network := range dmark.GroupSources(missing, cfg.prefixes) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", network.Network, len(network.SourceIPs), network.Messages, network.DKIMPassed)
+	}
+
+	return w.Flush()
+}
+
+// printTree writes a line for each mechanism of the tree, flagging dead weight:
+// mechanisms that authorized no sources of reports.
+func printTree(w io.Writer, tree *spf.Tree, used map[*spf.Term]*usage, indent string) {
+	for i := range tree.Terms {
+		term := &tree.Terms[i]
+		u, ok := used[term]
+		if !ok {
+			u = &usage{}
+		}
+
+		lookups := ""
+		switch term.Kind {
+		case "include", "a", "mx", "ptr", "exists":
+			lookups = fmt.Sprint(1 + term.Include.Lookups())
+		}
+
+		note := ""
+		switch {
+		case term.Err != nil:
+			note = term.Err.Error()
+		case term.Include != nil && term.Include.Err != nil:
+			note = term.Include.Err.Error()
+		case u.Sources == 0 && term.Kind != "all":
+			note = "unused"
+		}
+
+		fmt.Fprintf(w, "%s%s\t%s\t%d\t%d\t%s\t\n", indent, term.Mechanism, lookups, u.Sources, u.Messages, note)
+		if term.Include != nil {
+			printTree(w, term.Include, used, indent+"  ")
+		}
+	}
+
+	if tree.Redirect != nil {
+		note := ""
+		if tree.Redirect.Err != nil {
+			note = tree.Redirect.Err.Error()
+		}
+		fmt.Fprintf(w, "%sredirect=%s\t%d\t\t\t%s\t\n", indent, tree.Redirect.Domain, 1+tree.Redirect.Lookups(), note)
+		printTree(w, tree.Redirect, used, indent+"  ")
+	}
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	domain := flag.String("domain", "", "Policy domain whose SPF record to analyze, against sources of its reports")
+	dnsServer := flag.String("dns", "", "DNS server address (host:port) to use instead of the system resolver")
+	prefix := flag.String("prefix", "24,64", "IPv4 and IPv6 prefix lengths to group sources missing from the record by")
+	timeout := flag.Duration("timeout", 30*time.Second, "Timeout of expanding the SPF record")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+	if *domain == "" {
+		logging.Fatal(errors.New("-domain is required"))
+	}
+
+	prefixes, err := dmark.ParsePrefixes(*prefix)
+	if err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		domain:      strings.TrimSuffix(strings.ToLower(*domain), "."),
+		dnsServer:   *dnsServer,
+		prefixes:    prefixes,
+		timeout:     *timeout,
+	}
+
+	if err = run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/dmarc"
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	reportsPath string
+	where       string
+	lookup      bool // Look up DMARC records of subdomains
+	dnsServer   string
+	timeout     time.Duration
+}
+
+func run(cfg config, out io.Writer) error {
+	if cfg.dnsServer != "" {
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, cfg.dnsServer)
+			},
+		}
+	}
+
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		reports = where.Reports(reports)
+	}
+
+	policies := map[string]dmark.PolicyPublished{}
+	for _, domain := range dmark.Summarize(reports).Domains {
+		policies[domain.Domain] = domain.Policy
+	}
+
+	subdomains := dmark.Subdomains(reports)
+	if len(subdomains) == 0 {
+		fmt.Fprintln(out, "No subdomains in reports")
+		return nil
+	}
+
+	var w *tabwriter.Writer
+	for i, subdomain := range subdomains {
+		if i == 0 || subdomain.PolicyDomain != subdomains[i-1].PolicyDomain {
+			if w != nil {
+				if err = w.Flush(); err != nil {
+					return err
+				}
+				fmt.Fprintln(out)
+			}
+
+			fmt.Fprintf(out, "%s: %s\n", subdomain.PolicyDomain, subdomainPolicy(policies[subdomain.PolicyDomain]))
+			w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprint(w, "SUBDOMAIN\tHEADER FROM\tENVELOPE FROM\tSOURCES\tMESSAGES\tFAILED\tDKIM PASS\tSPF PASS\t")
+			if cfg.lookup {
+				fmt.Fprint(w, "RECORD\t")
+			}
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t",
+			subdomain.Domain,
+			subdomain.HeaderFrom,
+			subdomain.EnvelopeFrom,
+			subdomain.Sources,
+			subdomain.Messages,
+			subdomain.Failed(),
+			subdomain.DKIMPassed,
+			subdomain.SPFPassed,
+		)
+		if cfg.lookup {
+			fmt.Fprintf(w, "%s\t", ownRecord(subdomain.Domain, cfg.timeout))
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+// subdomainPolicy describes the policy subdomains are under: sp, or p when sp is absent.
+func subdomainPolicy(policy dmark.PolicyPublished) string {
+	if policy.SP == 0 {
+		p, _ := policy.P.MarshalText()
+		return fmt.Sprintf("p=%s, no sp: subdomains are under p", p)
+	}
+
+	sp, _ := policy.SP.MarshalText()
+	return fmt.Sprintf("sp=%s", sp)
+}
+
+// ownRecord tells whether the subdomain publishes its own DMARC record,
+// so sp of the policy domain does not apply to it.
+func ownRecord(domain string, timeout time.Duration) string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	record, err := dmarc.LookupRecord(ctx, domain)
+	switch {
+	case errors.Is(err, dmarc.ErrNoRecord):
+		return "-"
+	case err != nil:
+		return "?"
+	case record.Policy.Domain != domain:
+		return "inherited"
+	}
+
+	p, _ := record.Policy.P.MarshalText()
+	return fmt.Sprintf("own, p=%s", p)
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	lookup := flag.Bool("lookup", false, "Look up DMARC records of subdomains: sp= does not apply to those having their own")
+	dnsServer := flag.String("dns", "", "DNS server address (host:port) to use instead of the system resolver")
+	timeout := flag.Duration("timeout", 10*time.Second, "Timeout of looking up a DMARC record")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		where:       *where,
+		lookup:      *lookup,
+		dnsServer:   *dnsServer,
+		timeout:     *timeout,
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
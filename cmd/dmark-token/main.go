@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+	"github.com/spf13/cobra"
+)
+
+type config struct {
+	dir     string
+	tenant  string
+	command string
+	name    string
+	scopes  []string
+	id      string
+}
+
+func run(cfg config, out io.Writer) error {
+	s, err := store.Open(cfg.dir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if cfg.tenant != "" {
+		if s, err = s.Tenant(cfg.tenant); err != nil {
+			return err
+		}
+	}
+
+	switch cfg.command {
+	case "create":
+		secret, token, err := s.CreateToken(cfg.name, cfg.scopes)
+		if err != nil {
+			return fmt.Errorf("create token: %w", err)
+		}
+		fmt.Fprintf(out, "Created token %s with scopes %s, keep the secret, it is not shown again:\n", token.ID, strings.Join(token.Scopes, ","))
+		fmt.Fprintln(out, secret)
+	case "list":
+		tokens, err := s.Tokens()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED\t")
+		for _, token := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", token.ID, token.Name, strings.Join(token.Scopes, ","), token.Created.Format(time.RFC3339))
+		}
+		return w.Flush()
+	case "revoke":
+		if cfg.id == "" {
+			return errors.New("-id is required")
+		}
+		if err := s.RevokeToken(cfg.id); err != nil {
+			return fmt.Errorf("revoke token: %w", err)
+		}
+		fmt.Fprintf(out, "Revoked token %s\n", cfg.id)
+	default:
+		return fmt.Errorf("unknown command %q, expected create, list or revoke", cfg.command)
+	}
+
+	return nil
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.dir, "d", "./", "Path to the dmarkd reports directory")
+	flag.StringVar(&cfg.tenant, "tenant", "", "Tenant ID, for dmarkd with -tenants")
+	logOptions := logging.Flags()
+
+	root := cli.New("", "")
+	root.PersistentPreRunE = func(*cobra.Command, []string) error {
+		return logOptions.Setup()
+	}
+	command := func(name, short string) *cobra.Command {
+		return &cobra.Command{
+			Use:               name,
+			Short:             short,
+			Args:              cobra.NoArgs,
+			ValidArgsFunction: cobra.NoFileCompletions,
+			RunE: func(*cobra.Command, []string) error {
+				cfg.command = name
+				return run(cfg, os.Stdout)
+			},
+		}
+	}
+
+	create := command("create", "Create a token, printing its secret")
+	create.Flags().StringVar(&cfg.name, "name", "", "Name of the token, e.g. what uses it")
+	create.Flags().StringSliceVar(&cfg.scopes, "scope", []string{store.ScopeRead}, "Comma-separated scopes of the token: ingest, read, tag")
+	revoke := command("revoke", "Revoke the token with -id")
+	revoke.Flags().StringVar(&cfg.id, "id", "", "ID of the token to revoke")
+	root.AddCommand(create, command("list", "List tokens"), revoke)
+
+	if err := cli.Execute(root); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/dnsbl"
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	reportsPath string
+	top         int
+	resolve     bool
+	where       string
+	dnsbl       []string // Blocklists to check sources against
+	forwarding  bool     // Exclude records likely caused by forwarding
+	forwarders  string   // File of known forwarder networks
+	prefix      string   // Prefix lengths to group sources by, per source when empty
+}
+
+func run(cfg config, out io.Writer) error {
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		reports = where.Reports(reports)
+	}
+
+	if cfg.forwarding {
+		detector := &dmark.ForwardingDetector{}
+		if cfg.forwarders != "" {
+			if detector.Forwarders, err = dmark.LoadForwarders(cfg.forwarders); err != nil {
+				return err
+			}
+		}
+		reports = detector.Exclude(reports)
+	}
+
+	if cfg.prefix != "" {
+		prefixes, err := dmark.ParsePrefixes(cfg.prefix)
+		if err != nil {
+			return err
+		}
+		return printNetworks(out, dmark.GroupSources(dmark.Sources(reports), prefixes), cfg.top)
+	}
+
+	var checker *dnsbl.Checker
+	if len(cfg.dnsbl) > 0 {
+		checker = &dnsbl.Checker{Lists: cfg.dnsbl}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "SOURCE\tHOST\tMESSAGES\tFAILED\tDKIM PASS\tSPF PASS\tQUARANTINED\tREJECTED\t")
+	if checker != nil {
+		fmt.Fprint(w, "LISTED\t")
+	}
+	fmt.Fprintln(w)
+
+	shown := 0
+	for _, source := range dmark.Sources(reports) {
+		if shown == cfg.top || source.Failed() == 0 {
+			// sources are sorted by failed messages, the rest passed
+			break
+		}
+		shown++
+
+		host := "-"
+		if cfg.resolve {
+			host = lookupHost(source.SourceIP)
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t",
+			source.SourceIP,
+			host,
+			source.Messages,
+			source.Failed(),
+			source.DKIMPassed,
+			source.SPFPassed,
+			source.Quarantined,
+			source.Rejected,
+		)
+		if checker != nil {
+			fmt.Fprintf(w, "%s\t", listed(checker.Check(context.Background(), source.SourceIP)))
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+// printNetworks prints networks with failing messages, like sources.
+func printNetworks(out io.Writer, networks []dmark.NetworkSummary, top int) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NETWORK\tSOURCES\tMESSAGES\tFAILED\tDKIM PASS\tSPF PASS\tQUARANTINED\tREJECTED\t")
+
+	for i, network := range networks {
+		if i == top || network.Failed() == 0 {
+			break
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			network.Network,
+			len(network.SourceIPs),
+			network.Messages,
+			network.Failed(),
+			network.DKIMPassed,
+			network.SPFPassed,
+			network.Quarantined,
+			network.Rejected,
+		)
+	}
+
+	return w.Flush()
+}
+
+// listed returns the blocklists of the result, "no" when there are none,
+// or "?" when no list could be checked.
+func listed(result dnsbl.Result) string {
+	if !result.Listed {
+		if len(result.Errors) > 0 {
+			return "?"
+		}
+		return "no"
+	}
+
+	lists := []string{}
+	for _, listing := range result.Listings {
+		lists = append(lists, listing.List)
+	}
+
+	return strings.Join(lists, ",")
+}
+
+// lookupTimeout bounds a single reverse DNS lookup.
+const lookupTimeout = 5 * time.Second
+
+// lookupHost returns the first PTR name of the IP address, or "-".
+func lookupHost(ip net.IP) string {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(names) == 0 {
+		return "-"
+	}
+
+	return strings.TrimSuffix(names[0], ".")
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	top := flag.Int("n", 10, "Number of sources to show")
+	resolve := flag.Bool("resolve", false, "Resolve source IPs to host names")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	lists := flag.String("dnsbl", "", `Check sources against comma-separated DNS blocklists, "default" for common ones`)
+	prefix := flag.String("prefix", "", `Group sources by networks of these prefix lengths for IPv4 and IPv6, e.g. "24,64"`)
+	excludeForwarded := flag.Bool("exclude-forwarded", false, "Leave out records likely caused by forwarding, see dmark.ForwardingDetector")
+	forwarders := flag.String("forwarders", "", "File of known forwarder IP addresses or CIDRs, one per line, for -exclude-forwarded")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		top:         *top,
+		resolve:     *resolve,
+		where:       *where,
+		dnsbl:       dnsbl.ParseLists(*lists),
+		forwarding:  *excludeForwarded,
+		forwarders:  *forwarders,
+		prefix:      *prefix,
+	}
+
+	if err := run(cfg, os.Stdout); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+// help lists keys, shown at the bottom of the screen.
+const help = "↑↓ move  enter open  esc back  s sort  r reverse  / filter  q quit"
+
+// Default screen size, until the terminal tells.
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// Escape sequences of highlighted text.
+const (
+	reverse = "\x1b[7m"
+	bold    = "\x1b[1m"
+	reset   = "\x1b[0m"
+)
+
+type config struct {
+	reportsPath string
+	where       string
+}
+
+// browser is the stack of tables opened, from domains to records of a source.
+// It is the bubbletea model of the screen.
+type browser struct {
+	stack  []*table
+	typing bool // The filter of the top table is being typed
+
+	width, height int // Of the terminal, updated when it is resized
+}
+
+func run(cfg config) error {
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		reports = where.Reports(reports)
+	}
+	if len(reports) == 0 {
+		return fmt.Errorf("no reports in %s", cfg.reportsPath)
+	}
+
+	b := &browser{stack: []*table{domainsTable(reports)}, width: defaultWidth, height: defaultHeight}
+	if _, err = tea.NewProgram(b, tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("dmark-tui needs a terminal: %w", err)
+	}
+
+	return nil
+}
+
+func (b *browser) Init() tea.Cmd {
+	return nil
+}
+
+// Update follows the terminal size and acts on keys.
+func (b *browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		b.width, b.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		if !b.handle(keyOf(msg), rowsHeight(b.height)) {
+			return b, tea.Quit
+		}
+	}
+
+	return b, nil
+}
+
+func (b *browser) View() string {
+	return b.draw(b.width, b.height)
+}
+
+// key is a key pressed or text typed, or pasted, at once.
+type key struct {
+	name string // Of special keys, like "up" or "ctrl+c"
+	text string // Printable characters otherwise
+}
+
+func keyOf(msg tea.KeyMsg) key {
+	switch msg.Type {
+	case tea.KeyRunes:
+		return key{text: string(msg.Runes)}
+	case tea.KeySpace:
+		return key{text: " "}
+	}
+
+	return key{name: msg.String()}
+}
+
+// rowsHeight is the number of rows on a screen of height lines, below
+// the title and the header and above the help.
+func rowsHeight(height int) int {
+	return height - 3
+}
+
+// handle acts on the key, returning false to quit.
+func (b *browser) handle(k key, height int) bool {
+	t := b.stack[len(b.stack)-1]
+
+	if b.typing {
+		switch k.name {
+		case "enter":
+			b.typing = false
+		case "esc":
+			b.typing = false
+			t.filter = ""
+		case "backspace":
+			if t.filter != "" {
+				_, size := utf8.DecodeLastRuneInString(t.filter)
+				t.filter = t.filter[:len(t.filter)-size]
+			}
+		case "ctrl+c":
+			return false
+		default:
+			t.filter += k.text
+		}
+		t.apply()
+		t.scroll(height)
+		return true
+	}
+
+	switch {
+	case k.text == "q", k.name == "ctrl+c":
+		return false
+	case k.name == "up", k.text == "k":
+		t.move(-1, height)
+	case k.name == "down", k.text == "j":
+		t.move(1, height)
+	case k.name == "pgup":
+		t.move(-height, height)
+	case k.name == "pgdown", k.text == " ":
+		t.move(height, height)
+	case k.name == "home", k.text == "g":
+		t.move(-len(t.visible), height)
+	case k.name == "end", k.text == "G":
+		t.move(len(t.visible), height)
+	case k.name == "enter", k.name == "right", k.text == "l":
+		if r, ok := t.selected(); ok && t.open != nil {
+			b.stack = append(b.stack, t.open(r.key))
+		}
+	case k.name == "esc", k.name == "backspace", k.name == "left", k.text == "h":
+		if t.filter != "" {
+			t.filter = ""
+			t.apply()
+			t.scroll(height)
+		} else if len(b.stack) > 1 {
+			b.stack = b.stack[:len(b.stack)-1]
+		}
+	case k.text == "s":
+		t.sortBy = (t.sortBy + 1) % len(t.columns)
+		t.desc = false
+		t.apply()
+		t.scroll(height)
+	case k.text == "r":
+		t.desc = !t.desc
+		t.apply()
+		t.scroll(height)
+	case k.text == "/":
+		b.typing = true
+	}
+
+	return true
+}
+
+// draw returns the screen: the path of tables opened, the header and rows
+// of the top one, and the help or the filter being typed.
+func (b *browser) draw(width, height int) string {
+	t := b.stack[len(b.stack)-1]
+	t.scroll(rowsHeight(height))
+
+	titles := make([]string, len(b.stack))
+	for i, table := range b.stack {
+		titles[i] = table.title
+	}
+	title := strings.Join(titles, " > ")
+	title += fmt.Sprintf(" (%d of %d)", len(t.visible), len(t.rows))
+
+	lines := []string{bold + crop(title, width) + reset, bold + crop(t.headerLine(), width) + reset}
+	for i := t.offset; i < len(t.visible) && i < t.offset+rowsHeight(height); i++ {
+		line := crop(t.line(t.rows[t.visible[i]].cells), width)
+		if i == t.cursor {
+			line = reverse + pad(line, width) + reset
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+
+	switch {
+	case b.typing:
+		lines = append(lines, crop("/"+t.filter+"_", width))
+	case t.filter != "":
+		lines = append(lines, crop("filter: "+t.filter+"  esc clear  "+help, width))
+	default:
+		lines = append(lines, crop(help, width))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// crop cuts the line to width characters.
+func crop(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width])
+}
+
+// pad fills the line with spaces up to width characters.
+func pad(line string, width int) string {
+	if n := utf8.RuneCountInString(line); n < width {
+		return line + strings.Repeat(" ", width-n)
+	}
+	return line
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		where:       *where,
+	}
+
+	if err := run(cfg); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// columnGap separates columns, like tables of the other commands.
+const columnGap = "  "
+
+type column struct {
+	name    string
+	numeric bool // Sorted by row.values, most first
+}
+
+type row struct {
+	cells  []string
+	values []float64 // Of numeric columns, by column index
+	key    string    // What the row opens, see table.open
+}
+
+// table is a screen of rows, sorted by a column and filtered by text.
+type table struct {
+	title   string
+	columns []column
+	rows    []row
+
+	sortBy int
+	desc   bool
+	filter string // Rows shown contain it, case-insensitive
+
+	visible []int // Indexes of rows shown, in order
+	widths  []int // Of columns over the header and rows shown
+	cursor  int   // Index in visible
+	offset  int   // First index in visible on screen
+
+	open func(key string) *table // The table a row leads to, nil for none
+}
+
+// apply filters and sorts rows, keeping the cursor on the same row when shown.
+func (t *table) apply() {
+	selected := -1
+	if t.cursor < len(t.visible) {
+		selected = t.visible[t.cursor]
+	}
+
+	filter := strings.ToLower(t.filter)
+	t.visible = t.visible[:0]
+	for i, r := range t.rows {
+		if filter == "" || strings.Contains(strings.ToLower(strings.Join(r.cells, " ")), filter) {
+			t.visible = append(t.visible, i)
+		}
+	}
+
+	col := t.columns[t.sortBy]
+	sort.SliceStable(t.visible, func(i, j int) bool {
+		a, b := t.rows[t.visible[i]], t.rows[t.visible[j]]
+		var less, equal bool
+		if col.numeric {
+			x, y := a.values[t.sortBy], b.values[t.sortBy]
+			less, equal = x > y, x == y // most first when not reversed
+		} else {
+			x, y := a.cells[t.sortBy], b.cells[t.sortBy]
+			less, equal = x < y, x == y
+		}
+		if equal {
+			return false
+		}
+		return less != t.desc
+	})
+
+	t.cursor = 0
+	for i, index := range t.visible {
+		if index == selected {
+			t.cursor = i
+			break
+		}
+	}
+
+	t.widths = make([]int, len(t.columns))
+	for i, col := range t.columns {
+		t.widths[i] = utf8.RuneCountInString(t.header(i, col))
+	}
+	for _, index := range t.visible {
+		for i, cell := range t.rows[index].cells {
+			if n := utf8.RuneCountInString(cell); n > t.widths[i] {
+				t.widths[i] = n
+			}
+		}
+	}
+}
+
+// header names the column, marking the one rows are sorted by.
+func (t *table) header(i int, col column) string {
+	if i != t.sortBy {
+		return col.name
+	}
+	if col.numeric == t.desc {
+		return col.name + " ▲"
+	}
+	return col.name + " ▼"
+}
+
+// line joins cells padded to the column widths.
+func (t *table) line(cells []string) string {
+	b := strings.Builder{}
+	for i, cell := range cells {
+		if i > 0 {
+			b.WriteString(columnGap)
+		}
+		b.WriteString(cell)
+		if i < len(cells)-1 {
+			b.WriteString(strings.Repeat(" ", t.widths[i]-utf8.RuneCountInString(cell)))
+		}
+	}
+	return b.String()
+}
+
+// headerLine returns the line of column names.
+func (t *table) headerLine() string {
+	names := make([]string, len(t.columns))
+	for i, col := range t.columns {
+		names[i] = t.header(i, col)
+	}
+	return t.line(names)
+}
+
+// move moves the cursor by delta rows, keeping it on a screen of height rows.
+func (t *table) move(delta, height int) {
+	t.cursor += delta
+	if t.cursor >= len(t.visible) {
+		t.cursor = len(t.visible) - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+	t.scroll(height)
+}
+
+// scroll moves the offset for the cursor to be on a screen of height rows.
+func (t *table) scroll(height int) {
+	if height < 1 {
+		height = 1
+	}
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+height {
+		t.offset = t.cursor - height + 1
+	}
+	if t.offset > len(t.visible)-height {
+		t.offset = len(t.visible) - height
+	}
+	if t.offset < 0 {
+		t.offset = 0
+	}
+}
+
+// selected returns the row under the cursor.
+func (t *table) selected() (row, bool) {
+	if t.cursor >= len(t.visible) {
+		return row{}, false
+	}
+	return t.rows[t.visible[t.cursor]], true
+}
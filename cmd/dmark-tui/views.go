@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// domainsTable lists policy domains of the reports, opening their sources.
+func domainsTable(reports []dmark.Feedback) *table {
+	t := &table{
+		title: "Domains",
+		columns: []column{
+			{name: "DOMAIN"},
+			{name: "POLICY"},
+			{name: "REPORTS", numeric: true},
+			{name: "MESSAGES", numeric: true},
+			{name: "PASS RATE", numeric: true},
+			{name: "DKIM", numeric: true},
+			{name: "SPF", numeric: true},
+			{name: "QUARANTINED", numeric: true},
+			{name: "REJECTED", numeric: true},
+			{name: "SCORE", numeric: true},
+		},
+	}
+
+	for _, domain := range dmark.Summarize(reports).Domains {
+		t.rows = append(t.rows, row{
+			key: domain.Domain,
+			cells: []string{
+				domain.Domain,
+				"p=" + textOf(domain.Policy.P),
+				strconv.Itoa(domain.Reports),
+				strconv.Itoa(domain.Messages),
+				percent(domain.Passed, domain.Messages),
+				percent(domain.DKIMPassed, domain.Messages),
+				percent(domain.SPFPassed, domain.Messages),
+				strconv.Itoa(domain.Quarantined),
+				strconv.Itoa(domain.Rejected),
+				strconv.Itoa(domain.Score.Total),
+			},
+			values: []float64{
+				0,
+				0,
+				float64(domain.Reports),
+				float64(domain.Messages),
+				domain.PassRate(),
+				rate(domain.DKIMPassed, domain.Messages),
+				rate(domain.SPFPassed, domain.Messages),
+				float64(domain.Quarantined),
+				float64(domain.Rejected),
+				float64(domain.Score.Total),
+			},
+		})
+	}
+
+	t.open = func(domain string) *table {
+		return sourcesTable(domain, domainReports(reports, domain))
+	}
+	t.apply()
+
+	return t
+}
+
+// sourcesTable lists sources of reports of the domain, most failing first,
+// opening their records.
+func sourcesTable(domain string, reports []dmark.Feedback) *table {
+	t := &table{
+		title: domain,
+		columns: []column{
+			{name: "SOURCE IP"},
+			{name: "MESSAGES", numeric: true},
+			{name: "FAILED", numeric: true},
+			{name: "PASS RATE", numeric: true},
+			{name: "QUARANTINED", numeric: true},
+			{name: "REJECTED", numeric: true},
+		},
+		sortBy: 2,
+	}
+
+	for _, source := range dmark.Sources(reports) {
+		ip := source.SourceIP.String()
+		t.rows = append(t.rows, row{
+			key: ip,
+			cells: []string{
+				ip,
+				strconv.Itoa(source.Messages),
+				strconv.Itoa(source.Failed()),
+				percent(source.Passed, source.Messages),
+				strconv.Itoa(source.Quarantined),
+				strconv.Itoa(source.Rejected),
+			},
+			values: []float64{
+				0,
+				float64(source.Messages),
+				float64(source.Failed()),
+				source.PassRate(),
+				float64(source.Quarantined),
+				float64(source.Rejected),
+			},
+		})
+	}
+
+	t.open = func(ip string) *table {
+		return recordsTable(domain, ip, reports)
+	}
+	t.apply()
+
+	return t
+}
+
+// recordsTable lists records of reports from the source, newest first.
+func recordsTable(domain, ip string, reports []dmark.Feedback) *table {
+	t := &table{
+		title: ip,
+		columns: []column{
+			{name: "DATE", numeric: true},
+			{name: "REPORTER"},
+			{name: "COUNT", numeric: true},
+			{name: "DISPOSITION"},
+			{name: "DKIM"},
+			{name: "SPF"},
+			{name: "HEADER FROM"},
+			{name: "ENVELOPE FROM"},
+			{name: "DKIM RESULTS"},
+			{name: "SPF RESULTS"},
+			{name: "REASONS"},
+		},
+	}
+
+	for _, report := range reports {
+		for _, record := range dmark.Flatten(report) {
+			if record.SourceIP != ip {
+				continue
+			}
+			t.rows = append(t.rows, row{
+				cells: []string{
+					record.Begin.Format("2006-01-02"),
+					record.OrgName,
+					strconv.Itoa(record.Count),
+					record.Disposition,
+					record.DKIM,
+					record.SPF,
+					record.HeaderFrom,
+					record.EnvelopeFrom,
+					strings.Join(record.DKIMResults, " "),
+					strings.Join(record.SPFResults, " "),
+					strings.Join(record.Reasons, " "),
+				},
+				values: []float64{float64(record.Begin.Unix()), 0, float64(record.Count)},
+			})
+		}
+	}
+	t.apply()
+
+	return t
+}
+
+// domainReports returns reports of the policy domain.
+func domainReports(reports []dmark.Feedback, domain string) []dmark.Feedback {
+	result := []dmark.Feedback{}
+	for _, report := range reports {
+		if strings.ToLower(report.PolicyPublished.Domain) == domain {
+			result = append(result, report)
+		}
+	}
+	return result
+}
+
+func rate(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+func percent(part, total int) string {
+	return fmt.Sprintf("%.1f%%", rate(part, total)*100)
+}
+
+func textOf(v interface{ MarshalText() ([]byte, error) }) string {
+	b, _ := v.MarshalText()
+	return string(b)
+}
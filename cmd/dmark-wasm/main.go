@@ -0,0 +1,117 @@
+//go:build js && wasm
+
+// Command dmark-wasm parses and summarizes DMARC aggregate reports in the
+// browser, so they are never uploaded anywhere. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o web/dmark.wasm ./cmd/dmark-wasm
+//
+// and serve the web directory, with wasm_exec.js of the Go distribution,
+// from any static file server. web/dmark.js loads it and exposes the
+// functions registered here as window.dmark, see web/index.html:
+//
+//	parse(name, bytes)    reports of an XML, gzip, zip or .eml file, and errors
+//	summarize(reports)    dmark.Summary of parsed reports
+//	render(reports, lang) an HTML summary of parsed reports
+//
+// Reports and summaries cross the bridge as objects in the JSON encoding
+// of dmark.Feedback and dmark.Summary.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"syscall/js"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+func main() {
+	exports := js.Global().Get("Object").New()
+	exports.Set("parse", js.FuncOf(parse))
+	exports.Set("summarize", js.FuncOf(summarize))
+	exports.Set("render", js.FuncOf(render))
+	js.Global().Set("dmarkExports", exports)
+
+	// keep serving calls from JS
+	select {}
+}
+
+// parse handles parse(name, bytes), returning {reports, errors}.
+func parse(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return failure(fmt.Errorf("parse takes a file name and its bytes"))
+	}
+
+	content := make([]byte, args[1].Get("length").Int())
+	js.CopyBytesToGo(content, args[1])
+
+	reports, errs := parseFile(args[0].String(), content)
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return result(map[string]interface{}{"reports": reports, "errors": messages})
+}
+
+// summarize handles summarize(reports), returning the summary.
+func summarize(this js.Value, args []js.Value) interface{} {
+	reports, err := reportsArg(args)
+	if err != nil {
+		return failure(err)
+	}
+
+	return result(dmark.Summarize(reports))
+}
+
+// render handles render(reports, lang), returning the HTML summary.
+func render(this js.Value, args []js.Value) interface{} {
+	reports, err := reportsArg(args)
+	if err != nil {
+		return failure(err)
+	}
+
+	lang := ""
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		lang = args[1].String()
+	}
+
+	html, err := renderHTML(reports, lang)
+	if err != nil {
+		return failure(err)
+	}
+
+	return result(html)
+}
+
+// reportsArg decodes reports passed as the first argument.
+func reportsArg(args []js.Value) ([]dmark.Feedback, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("reports are missing")
+	}
+
+	encoded := js.Global().Get("JSON").Call("stringify", args[0]).String()
+	reports := []dmark.Feedback{}
+	if err := json.Unmarshal([]byte(encoded), &reports); err != nil {
+		return nil, fmt.Errorf("decode reports: %w", err)
+	}
+
+	return reports, nil
+}
+
+// result wraps v, as JSON decoded in JS, for dmark.js to return.
+func result(v interface{}) interface{} {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return failure(err)
+	}
+
+	value := js.Global().Get("JSON").Call("parse", string(encoded))
+	return map[string]interface{}{"result": value}
+}
+
+// failure wraps err for dmark.js to throw.
+func failure(err error) interface{} {
+	return map[string]interface{}{"error": err.Error()}
+}
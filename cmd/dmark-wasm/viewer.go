@@ -0,0 +1,83 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/i18n"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
+)
+
+// topSources is the number of sources listed per domain, most failing first.
+const topSources = 10
+
+//go:embed summary.html
+var summaryTemplate string
+
+// parseFile returns reports in a dropped file: XML, gzip or zip compressed,
+// or an email message with reports attached, and errors of those it skipped.
+func parseFile(name string, content []byte) ([]dmark.Feedback, []error) {
+	var (
+		files []dmark.File
+		err   error
+	)
+	if strings.HasSuffix(strings.ToLower(name), ".eml") {
+		files, err = dmark.ExtractReports(bytes.NewReader(content))
+	} else {
+		files, err = dmark.Decompress(name, content)
+	}
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	reports := []dmark.Feedback{}
+	errs := []error{}
+	for _, file := range files {
+		report, err := dmark.ParseBytes(file.Content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("parse %q: %w", file.Name, err))
+			continue
+		}
+		reports = append(reports, *report)
+	}
+
+	return reports, errs
+}
+
+// renderHTML summarizes reports in HTML, in the language of the locale
+// named lang or in English when it is empty.
+func renderHTML(reports []dmark.Feedback, lang string) (string, error) {
+	locale := i18n.English
+	if lang != "" {
+		var err error
+		if locale, err = i18n.Lookup(lang); err != nil {
+			return "", err
+		}
+	}
+
+	funcs := templatefuncs.LocalizedFuncMap(locale)
+	funcs["top"] = func(sources []dmark.SourceSummary) []dmark.SourceSummary {
+		if len(sources) > topSources {
+			return sources[:topSources]
+		}
+		return sources
+	}
+
+	tmpl, err := template.New("summary.html").Funcs(funcs).Parse(summaryTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parse template: %w", err)
+	}
+
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, dmark.Summarize(reports)); err != nil {
+		return "", fmt.Errorf("execute template: %w", err)
+	}
+
+	return buf.String(), nil
+}
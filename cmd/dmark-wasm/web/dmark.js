@@ -0,0 +1,24 @@
+// dmark.js loads dmark.wasm, built from cmd/dmark-wasm, and exposes its
+// functions as window.dmark once the returned promise resolves. Functions
+// throw an Error when the Go side fails. Needs wasm_exec.js loaded first.
+async function loadDmark(url = "dmark.wasm") {
+  const go = new Go();
+  const { instance } = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+  go.run(instance);
+
+  const exports = globalThis.dmarkExports;
+  const call = (fn) => (...args) => {
+    const { result, error } = fn(...args);
+    if (error) {
+      throw new Error(error);
+    }
+    return result;
+  };
+
+  globalThis.dmark = {
+    parse: call(exports.parse),         // (name, Uint8Array) => {reports, errors}
+    summarize: call(exports.summarize), // (reports) => summary
+    render: call(exports.render),       // (reports, lang) => HTML
+  };
+  return globalThis.dmark;
+}
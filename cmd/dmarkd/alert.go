@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/baseline"
+)
+
+// alertTimeout bounds checking a report, with SPF lookups, and posting the alert.
+const alertTimeout = time.Minute
+
+// alerter checks ingested reports against the baseline of expected senders,
+// logging records from unexpected sources and posting them to a webhook.
+type alerter struct {
+	baseline *baseline.Baseline
+	webhook  string // No alerts are posted when empty
+	client   *http.Client
+	dryRun   bool // Log alerts that would be posted instead of posting them
+
+	pending sync.WaitGroup // Checks in flight
+}
+
+// alertPayload is posted to the webhook as JSON; Text makes it
+// a message for Slack or Mattermost incoming webhooks too.
+type alertPayload struct {
+	Text       string               `json:"text"`
+	Tenant     string               `json:"tenant,omitempty"`
+	Deviations []baseline.Deviation `json:"deviations"`
+}
+
+// checkLater checks the report in the background, see wait.
+func (a *alerter) checkLater(tenantID string, report *dmark.Feedback) {
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		a.check(tenantID, report)
+	}()
+}
+
+// wait waits for checks in flight until ctx is done,
+// reporting whether all of them finished.
+func (a *alerter) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		a.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// check alerts on records of the tenant's report from unexpected sources.
+func (a *alerter) check(tenantID string, report *dmark.Feedback) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	deviations := a.baseline.Deviations(ctx, report)
+	if len(deviations) == 0 {
+		return
+	}
+
+	lines := []string{}
+	for _, d := range deviations {
+		slog.Warn(
+			"Unexpected source",
+			"tenant", tenantID,
+			"domain", d.Domain,
+			"source_ip", d.SourceIP,
+			"count", d.Count,
+			"passed", d.Passed,
+			"org", d.OrgName,
+			"report_id", d.ReportID,
+		)
+
+		result := "failing DMARC"
+		if d.Passed {
+			result = "passing DMARC"
+		}
+		lines = append(lines, fmt.Sprintf("%d messages for %s from unexpected source %s, %s", d.Count, d.Domain, d.SourceIP, result))
+	}
+
+	if a.webhook == "" {
+		return
+	}
+	payload := alertPayload{
+		Text: fmt.Sprintf(
+			"Report %s from %s:\n%s",
+			report.ReportMetadata.ReportID,
+			report.ReportMetadata.OrgName,
+			strings.Join(lines, "\n"),
+		),
+		Tenant:     tenantID,
+		Deviations: deviations,
+	}
+	if a.dryRun {
+		slog.Info("Would post alert", "webhook", a.webhook, "tenant", tenantID, "deviations", len(deviations), "text", payload.Text)
+		return
+	}
+	if err := a.post(ctx, payload); err != nil {
+		slog.Error("Failed to post alert", "err", err)
+	}
+}
+
+func (a *alerter) post(ctx context.Context, payload alertPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
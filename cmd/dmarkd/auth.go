@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// tenant is a customer whose reports are kept in its own store, see store.Tenant.
+// A single-tenant dmarkd has one tenant without an ID, using the store itself.
+type tenant struct {
+	ID      string   `json:"-"`
+	Token   string   `json:"token"`
+	Domains []string `json:"domains"` // Policy domains the tenant may upload reports for, any when empty
+
+	store *store.Store
+}
+
+// owns reports whether the tenant may upload reports for a policy domain,
+// which is one of its domains or their subdomain.
+func (t *tenant) owns(domain string) bool {
+	if len(t.Domains) == 0 {
+		return true
+	}
+
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, d := range t.Domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadTenants reads tenants from a JSON file of tenant IDs to their tokens and domains:
+//
+//	{"acme": {"token": "secret", "domains": ["acme.com"]}}
+func loadTenants(path string, s *store.Store) ([]*tenant, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants: %w", err)
+	}
+
+	byID := map[string]*tenant{}
+	if err = json.Unmarshal(content, &byID); err != nil {
+		return nil, fmt.Errorf("decode tenants: %w", err)
+	}
+
+	tenants := []*tenant{}
+	tokens := map[string]string{}
+	for id, t := range byID {
+		if t.Token == "" {
+			return nil, fmt.Errorf("tenant %q has no token", id)
+		}
+		if other, ok := tokens[t.Token]; ok {
+			return nil, fmt.Errorf("tenants %q and %q have the same token", other, id)
+		}
+		tokens[t.Token] = id
+
+		if t.store, err = s.Tenant(id); err != nil {
+			return nil, err
+		}
+		t.ID = id
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+
+	return tenants, nil
+}
+
+// authentication is the tenant whose token a request carries: the tenant
+// token, or an API token in the tenant store, see store.CreateToken.
+type authentication struct {
+	tenant *tenant      // Nil when no tenant matches
+	token  *store.Token // API token, nil for tenant tokens and requests without a token
+}
+
+// authenticate looks up the token of the request. A single tenant without
+// a token allows requests without one, unless API tokens were created.
+func authenticate(r *http.Request, tenants []*tenant) authentication {
+	secret, hasToken := bearerToken(r)
+
+	if !hasToken {
+		if len(tenants) != 1 || tenants[0].Token != "" {
+			return authentication{}
+		}
+		tokens, err := tenants[0].store.Tokens()
+		if err != nil {
+			slog.Error("Failed to read tokens", "err", err)
+			return authentication{}
+		}
+		if len(tokens) > 0 {
+			return authentication{}
+		}
+		return authentication{tenant: tenants[0]}
+	}
+
+	var found *tenant
+	for _, t := range tenants {
+		// check all tokens to take the same time whichever matches
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(t.Token)) == 1 {
+			found = t
+		}
+	}
+	if found != nil {
+		return authentication{tenant: found}
+	}
+
+	for _, t := range tenants {
+		token, ok, err := t.store.LookupToken(secret)
+		if err != nil {
+			slog.Error("Failed to read tokens", "tenant", t.ID, "err", err)
+			return authentication{}
+		}
+		if ok {
+			return authentication{tenant: t, token: &token}
+		}
+	}
+
+	return authentication{}
+}
+
+// authorize returns the tenant whose token the request carries, when the token
+// has the scope, and the API token if any; tenant tokens have all scopes.
+// The token is looked up once: the rate limiter passes what it found in the request context.
+func authorize(r *http.Request, tenants []*tenant, scope string) (*tenant, *store.Token, bool) {
+	auth, ok := r.Context().Value(authenticationKey{}).(authentication)
+	if !ok {
+		auth = authenticate(r, tenants)
+	}
+	if auth.tenant == nil {
+		return nil, nil, false
+	}
+
+	return auth.tenant, auth.token, auth.token == nil || auth.token.Allows(scope)
+}
+
+type (
+	tenantKey         struct{}
+	tokenKey          struct{}
+	authenticationKey struct{}
+)
+
+// requireToken rejects requests without "Authorization: Bearer <token>"
+// of one of the tenants with the scope, and passes the tenant and
+// the API token, if any, to next in the request context.
+func requireToken(tenants []*tenant, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, token, ok := authorize(r, tenants, scope)
+		if !ok {
+			if t != nil {
+				writeError(w, http.StatusForbidden, "token lacks the "+scope+" scope")
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dmarkd"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantKey{}, t)
+		ctx = context.WithValue(ctx, tokenKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestToken returns the API token set by requireToken, nil for tenant tokens and users.
+func requestToken(r *http.Request) *store.Token {
+	token, _ := r.Context().Value(tokenKey{}).(*store.Token)
+	return token
+}
+
+// requestTenant returns the tenant set by requireToken.
+func requestTenant(r *http.Request) *tenant {
+	return r.Context().Value(tenantKey{}).(*tenant)
+}
+
+// bearerToken returns the token of "Authorization: Bearer <token>".
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(auth, "Bearer "), true
+}
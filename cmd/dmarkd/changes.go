@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// changeWindow is the default number of days /changes compares before and since changes.
+const changeWindow = 7
+
+// changesHandler returns changes recorded with dmark-change, with counts of
+// their domains before and since each, see store.Impacts:
+// GET /changes?window=14
+type changesHandler struct {
+	location *time.Location // Days in this time zone, by the UTC day reports begin when nil
+}
+
+func (h *changesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	window := changeWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		var err error
+		if window, err = strconv.Atoi(v); err != nil || window <= 0 {
+			writeError(w, http.StatusBadRequest, "window: want a positive number of days")
+			return
+		}
+	}
+
+	s := requestTenant(r).store
+	changes, err := s.Changes()
+	if err != nil {
+		slog.Error("Failed to read changes", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read changes")
+		return
+	}
+	days, err := daily(r.Context(), s, h.location)
+	if err != nil {
+		slog.Error("Failed to get daily counts", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, store.Impacts(changes, days, window))
+}
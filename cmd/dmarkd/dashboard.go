@@ -0,0 +1,431 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/rdap"
+	"github.com/chuhlomin/dmark-go/store"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
+)
+
+// dashboardSources is the number of sources listed on the dashboard index.
+const dashboardSources = 100
+
+//go:embed dashboard/*.html
+var dashboardFiles embed.FS
+
+var dashboardTemplates = template.Must(
+	template.New("").
+		Funcs(templatefuncs.FuncMap()).
+		ParseFS(dashboardFiles, "dashboard/*.html"),
+)
+
+// dashboardHandler serves HTML pages: an index of sources, the history of a source,
+// GET /sources/<ip>, also available as JSON with ?format=json, and a table of
+// domains, GET /portfolio, available as JSON from /portfolio of the API.
+// Admins, and tokens with the ingest scope, may upload reports with POST /upload;
+// admins, and tokens with the tag scope, may tag sources with POST /tags
+// and remove tags with POST /tags/<id>/remove.
+type dashboardHandler struct {
+	prefix  string
+	resolve bool         // Look up PTR names and AS of sources
+	rdap    *rdap.Client // Look up network owners of sources when set
+	ingest  *ingestHandler
+}
+
+func (h *dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, h.prefix)
+	switch {
+	case path == "/":
+		h.index(w, r, http.StatusOK, nil)
+	case path == "/portfolio":
+		h.portfolio(w, r)
+	case path == "/upload":
+		h.upload(w, r)
+	case path == "/tags":
+		h.addTag(w, r)
+	case strings.HasPrefix(path, "/tags/") && strings.HasSuffix(path, "/remove"):
+		h.removeTag(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/tags/"), "/remove"))
+	case strings.HasPrefix(path, "/sources/"):
+		h.source(w, r, strings.TrimPrefix(path, "/sources/"))
+	case path == "":
+		http.Redirect(w, r, h.prefix+"/", http.StatusMovedPermanently)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *dashboardHandler) index(w http.ResponseWriter, r *http.Request, status int, upload *ingestResponse) {
+	sources, err := requestTenant(r).store.Sources(r.Context())
+	if err != nil {
+		slog.Error("Failed to get sources", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	data := map[string]interface{}{
+		"User":      requestUser(r),
+		"CanUpload": canUpload(r),
+		"Upload":    upload,
+		"Tenant":    requestTenant(r).ID,
+		"Prefix":    r.URL.Query().Get("prefix"),
+	}
+
+	// ?prefix=24,64 groups sources by network
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+		prefixes, err := dmark.ParsePrefixes(prefix)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		networks := dmark.GroupSources(sources, prefixes)
+		data["Total"] = len(networks)
+		if len(networks) > dashboardSources {
+			networks = networks[:dashboardSources]
+		}
+		data["Networks"] = networks
+		writeHTML(w, status, "index.html", data)
+		return
+	}
+
+	data["Total"] = len(sources)
+	if len(sources) > dashboardSources {
+		sources = sources[:dashboardSources]
+	}
+	data["Sources"] = sources
+
+	tags, err := requestTenant(r).store.Tags()
+	if err != nil {
+		slog.Error("Failed to read tags", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read tags")
+		return
+	}
+	sourceTags := map[string][]store.Tag{}
+	for _, source := range sources {
+		if matched := store.TagsOf(tags, source.SourceIP); len(matched) > 0 {
+			sourceTags[source.SourceIP.String()] = matched
+		}
+	}
+	data["Tags"] = sourceTags
+	writeHTML(w, status, "index.html", data)
+}
+
+// portfolio shows where each policy domain stands, see portfolioHandler.
+func (h *dashboardHandler) portfolio(w http.ResponseWriter, r *http.Request) {
+	days, window, err := portfolioParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	portfolio, err := readPortfolio(r.Context(), requestTenant(r).store, days, window)
+	if err != nil {
+		slog.Error("Failed to summarize domains", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	writeHTML(w, http.StatusOK, "portfolio.html", map[string]interface{}{
+		"User":    requestUser(r),
+		"Tenant":  requestTenant(r).ID,
+		"Domains": portfolio,
+		"Days":    days,
+		"Window":  window,
+	})
+}
+
+// canUpload reports whether the user is an admin, or the API token has the ingest scope.
+func canUpload(r *http.Request) bool {
+	if u := requestUser(r); u != nil {
+		return u.Role == roleAdmin
+	}
+	token := requestToken(r)
+	return token == nil || token.Allows(store.ScopeIngest)
+}
+
+// upload stores reports of a form like POST /ingest does, showing the result on the index.
+func (h *dashboardHandler) upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !canUpload(r) {
+		writeError(w, http.StatusForbidden, "only admins may upload reports")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.ingest.maxSize+1<<20)
+	file, header, err := r.FormFile("report")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read report: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, h.ingest.maxSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read report: "+err.Error())
+		return
+	}
+	if int64(len(content)) > h.ingest.maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "report too large")
+		return
+	}
+
+	resp := ingestResponse{Saved: []string{}, Skipped: []string{}}
+	files, err := extractUpload(header.Filename, header.Header.Get("Content-Type"), content)
+	if err != nil {
+		resp.skip(header.Filename, err.Error(), dmark.ErrorCode(err))
+	} else if err = h.ingest.save(requestTenant(r), files, r.RemoteAddr, &resp); err != nil {
+		slog.Error("Failed to save report", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to store report")
+		return
+	}
+
+	status := http.StatusOK
+	if len(resp.Saved) == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	h.index(w, r, status, &resp)
+}
+
+// sourceResponse is the history of a source with what DNS tells about it.
+type sourceResponse struct {
+	store.SourceHistory
+	Info sourceInfo `json:"info"`
+}
+
+func (h *dashboardHandler) source(w http.ResponseWriter, r *http.Request, value string) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, "invalid IP address "+value)
+		return
+	}
+
+	history, err := requestTenant(r).store.Source(r.Context(), ip)
+	if err != nil {
+		slog.Error("Failed to get source history", "ip", ip, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+	if history.Messages == 0 {
+		writeError(w, http.StatusNotFound, "no records of "+ip.String())
+		return
+	}
+
+	resp := sourceResponse{SourceHistory: history}
+	if h.resolve {
+		resp.Info = lookupSource(r.Context(), ip, h.rdap)
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	tags, err := requestTenant(r).store.Tags()
+	if err != nil {
+		slog.Error("Failed to read tags", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read tags")
+		return
+	}
+	changes, err := requestTenant(r).store.Changes()
+	if err != nil {
+		slog.Error("Failed to read changes", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read changes")
+		return
+	}
+
+	writeHTML(w, http.StatusOK, "source.html", map[string]interface{}{
+		"User":   requestUser(r),
+		"Source": resp,
+		"Chart":  newVolumeChart(history.Days, changes),
+		"Tags":   store.TagsOf(tags, ip),
+		"CanTag": canTag(r),
+	})
+}
+
+// addTag adds a tag of a source from the form on its page, see tagsHandler.
+func (h *dashboardHandler) addTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !canTag(r) {
+		writeError(w, http.StatusForbidden, "only admins may tag sources")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTagSize)
+	ip := net.ParseIP(r.PostFormValue("ip"))
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, "invalid IP address "+r.PostFormValue("ip"))
+		return
+	}
+	source := r.PostFormValue("source")
+	if source == "" {
+		source = ip.String()
+	}
+
+	tag, err := requestTenant(r).store.AddTag(store.Tag{
+		Source:   source,
+		ReportID: r.PostFormValue("report_id"),
+		Label:    r.PostFormValue("label"),
+		Note:     r.PostFormValue("note"),
+		Author:   requestAuthor(r),
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Info("Added tag", "id", tag.ID, "source", tag.Source, "label", tag.Label, "author", tag.Author)
+
+	http.Redirect(w, r, h.prefix+"/sources/"+ip.String(), http.StatusSeeOther)
+}
+
+// removeTag removes a tag from the page of a source.
+func (h *dashboardHandler) removeTag(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !canTag(r) {
+		writeError(w, http.StatusForbidden, "only admins may tag sources")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTagSize)
+	ip := net.ParseIP(r.PostFormValue("ip"))
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, "invalid IP address "+r.PostFormValue("ip"))
+		return
+	}
+
+	err := requestTenant(r).store.RemoveTag(id)
+	if errors.Is(err, store.ErrTagNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to remove tag", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to remove tag")
+		return
+	}
+	slog.Info("Removed tag", "id", id, "author", requestAuthor(r))
+
+	http.Redirect(w, r, h.prefix+"/sources/"+ip.String(), http.StatusSeeOther)
+}
+
+func writeHTML(w http.ResponseWriter, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := dashboardTemplates.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("Failed to render page", "template", name, "err", err)
+	}
+}
+
+// volumeChart is an SVG bar chart of daily messages, split into passed and failed,
+// with lines at changes of the domains, see store.Change.
+type volumeChart struct {
+	Width, Height float64
+	Bars          []volumeBar
+	Changes       []chartChange
+}
+
+type chartChange struct {
+	X    float64
+	Day  time.Time
+	Note string
+}
+
+type volumeBar struct {
+	X, Width     float64
+	PassedY      float64
+	PassedHeight float64
+	FailedY      float64
+	FailedHeight float64
+	Day          time.Time
+	Messages     int
+	Failed       int
+}
+
+const (
+	chartHeight   = 120
+	chartBarWidth = 6
+)
+
+func newVolumeChart(days []store.DomainDay, changes []store.Change) volumeChart {
+	// domains of the same day are combined, days are sorted already
+	combined := []store.DomainDay{}
+	for _, d := range days {
+		n := len(combined)
+		if n > 0 && combined[n-1].Day.Equal(d.Day) {
+			combined[n-1].Merge(d.Counts)
+			continue
+		}
+		combined = append(combined, d)
+	}
+
+	max := 1
+	for _, d := range combined {
+		if d.Messages > max {
+			max = d.Messages
+		}
+	}
+
+	chart := volumeChart{
+		Width:  float64(len(combined) * (chartBarWidth + 2)),
+		Height: chartHeight,
+	}
+	for i, d := range combined {
+		passed := float64(d.Passed) * chartHeight / float64(max)
+		failed := float64(d.Failed()) * chartHeight / float64(max)
+		chart.Bars = append(chart.Bars, volumeBar{
+			X:            float64(i * (chartBarWidth + 2)),
+			Width:        chartBarWidth,
+			PassedY:      chartHeight - passed,
+			PassedHeight: passed,
+			FailedY:      chartHeight - passed - failed,
+			FailedHeight: failed,
+			Day:          d.Day,
+			Messages:     d.Messages,
+			Failed:       d.Failed(),
+		})
+	}
+
+	// a line before the bar of the day of each change within the chart
+	for _, change := range changes {
+		applies := false
+		for _, d := range days {
+			applies = applies || change.Applies(d.Domain)
+		}
+		if !applies || len(combined) == 0 || change.Date.Before(combined[0].Day) || change.Date.After(combined[len(combined)-1].Day) {
+			continue
+		}
+
+		i := sort.Search(len(combined), func(i int) bool {
+			return !combined[i].Day.Before(change.Date)
+		})
+		x := float64(i*(chartBarWidth+2)) - 1 // in the gap before the bar
+		if x < 1 {
+			x = 1
+		}
+		chart.Changes = append(chart.Changes, chartChange{X: x, Day: change.Date, Note: change.Note})
+	}
+
+	return chart
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// exportHandler streams records of stored reports as CSV or NDJSON,
+// one report at a time, see store.Store.Export:
+// GET /export?format=ndjson&domain=example.com&from=2021-01-01&to=2021-04-01&where=policy_evaluated.dkim%3D%3D%22fail%22
+type exportHandler struct{}
+
+func (h *exportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	q := store.Query{Domain: params.Get("domain")}
+
+	var err error
+	if v := params.Get("from"); v != "" {
+		if q.From, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if q.To, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "to: "+err.Error())
+			return
+		}
+	}
+	var where *filter.Filter
+	if v := params.Get("where"); v != "" {
+		if where, err = filter.Compile(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	format := params.Get("format")
+	switch format {
+	case "", store.ExportCSV:
+		format = store.ExportCSV
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case store.ExportNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		writeError(w, http.StatusBadRequest, "format: want csv or ndjson")
+		return
+	}
+
+	// the status is sent with the first records, so later errors only cut the response short
+	records, err := requestTenant(r).store.Export(r.Context(), w, format, q, where)
+	if err != nil && r.Context().Err() == nil {
+		slog.Error("Failed to export records", "records", records, "err", err)
+		return
+	}
+	slog.Debug("Exported records", "format", format, "records", records)
+}
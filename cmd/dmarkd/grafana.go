@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// grafanaMetrics are metrics available for each domain, as "<domain>:<metric>" targets.
+var grafanaMetrics = map[string]func(d store.DomainDay) float64{
+	"messages":    func(d store.DomainDay) float64 { return float64(d.Messages) },
+	"passed":      func(d store.DomainDay) float64 { return float64(d.Passed) },
+	"failed":      func(d store.DomainDay) float64 { return float64(d.Failed()) },
+	"quarantined": func(d store.DomainDay) float64 { return float64(d.Quarantined) },
+	"rejected":    func(d store.DomainDay) float64 { return float64(d.Rejected) },
+	"pass_rate":   func(d store.DomainDay) float64 { return d.PassRate() * 100 },
+}
+
+// grafanaHandler implements the SimpleJSON datasource API (/, /search, /query)
+// over daily counts per domain, with changes of the store as /annotations,
+// and a flat /series endpoint for the Infinity datasource.
+type grafanaHandler struct {
+	prefix   string
+	location *time.Location // Days in this time zone, by the UTC day reports begin when nil
+}
+
+func (h *grafanaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, h.prefix) {
+	case "", "/":
+		// the datasource connection test
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case "/search":
+		h.search(w, r)
+	case "/query":
+		h.query(w, r)
+	case "/annotations":
+		h.annotations(w, r)
+	case "/series":
+		h.series(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *grafanaHandler) search(w http.ResponseWriter, r *http.Request) {
+	days, err := daily(r.Context(), requestTenant(r).store, h.location)
+	if err != nil {
+		slog.Error("Failed to get daily counts", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	domains := map[string]bool{"all": true}
+	for _, d := range days {
+		domains[d.Domain] = true
+	}
+
+	targets := []string{}
+	for domain := range domains {
+		for metric := range grafanaMetrics {
+			targets = append(targets, domain+":"+metric)
+		}
+	}
+	sort.Strings(targets)
+
+	writeJSON(w, http.StatusOK, targets)
+}
+
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"` // Value and Unix time in milliseconds
+}
+
+func (h *grafanaHandler) query(w http.ResponseWriter, r *http.Request) {
+	q := grafanaQuery{}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeError(w, http.StatusBadRequest, "decode query: "+err.Error())
+		return
+	}
+
+	result := []grafanaSeries{}
+	for _, target := range q.Targets {
+		domain, metric := splitTarget(target.Target)
+		value, ok := grafanaMetrics[metric]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unknown metric in target "+target.Target)
+			return
+		}
+
+		days, err := domainDays(r.Context(), requestTenant(r).store, domain, q.Range.From, q.Range.To, h.location)
+		if err != nil {
+			slog.Error("Failed to get daily counts", "err", err)
+			writeError(w, http.StatusInternalServerError, "failed to read reports")
+			return
+		}
+
+		series := grafanaSeries{Target: target.Target, Datapoints: [][2]float64{}}
+		for _, d := range days {
+			series.Datapoints = append(series.Datapoints, [2]float64{
+				value(d),
+				float64(d.Day.Unix() * 1000),
+			})
+		}
+		result = append(result, series)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+type grafanaAnnotationQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"` // Unix time in milliseconds
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// annotations returns changes within the range, see store.Change,
+// of the domain in the annotation query, or of all domains when empty or "all".
+func (h *grafanaHandler) annotations(w http.ResponseWriter, r *http.Request) {
+	q := grafanaAnnotationQuery{}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeError(w, http.StatusBadRequest, "decode query: "+err.Error())
+		return
+	}
+	annotation := struct {
+		Query string `json:"query"`
+	}{}
+	if len(q.Annotation) > 0 {
+		if err := json.Unmarshal(q.Annotation, &annotation); err != nil {
+			writeError(w, http.StatusBadRequest, "decode annotation: "+err.Error())
+			return
+		}
+	}
+	domain := strings.ToLower(strings.TrimSpace(annotation.Query))
+
+	changes, err := requestTenant(r).store.Changes()
+	if err != nil {
+		slog.Error("Failed to read changes", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read changes")
+		return
+	}
+
+	result := []grafanaAnnotation{}
+	for _, change := range changes {
+		if (!q.Range.From.IsZero() && change.Date.Before(q.Range.From.Truncate(24*time.Hour))) || (!q.Range.To.IsZero() && change.Date.After(q.Range.To)) {
+			continue
+		}
+		if domain != "" && domain != "all" && !change.Applies(domain) {
+			continue
+		}
+
+		tags := []string{}
+		if change.Domain != "" {
+			tags = append(tags, change.Domain)
+		}
+		result = append(result, grafanaAnnotation{
+			Annotation: q.Annotation,
+			Time:       change.Date.Unix() * 1000,
+			Title:      change.Note,
+			Text:       change.Note,
+			Tags:       tags,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// series returns daily counts as rows, for the Infinity datasource:
+// GET /series?domain=example.com&from=2021-01-01&to=2021-02-01
+func (h *grafanaHandler) series(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var from, to time.Time
+	var err error
+	if v := params.Get("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "to: "+err.Error())
+			return
+		}
+	}
+
+	domain := params.Get("domain")
+	if domain == "" {
+		domain = "all"
+	}
+
+	days, err := domainDays(r.Context(), requestTenant(r).store, domain, from, to, h.location)
+	if err != nil {
+		slog.Error("Failed to get daily counts", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	type row struct {
+		store.DomainDay
+		PassRate float64 `json:"pass_rate"`
+	}
+	rows := []row{}
+	for _, d := range days {
+		rows = append(rows, row{DomainDay: d, PassRate: d.PassRate() * 100})
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
+
+// domainDays returns daily counts of a domain, or of all domains combined for "all",
+// within the time range; zero times mean no bound.
+func domainDays(ctx context.Context, s *store.Store, domain string, from, to time.Time, loc *time.Location) ([]store.DomainDay, error) {
+	days, err := daily(ctx, s, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !from.IsZero() {
+		if loc == nil {
+			from = from.Truncate(24 * time.Hour)
+		} else {
+			from = from.In(loc)
+			from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		}
+	}
+
+	result := []store.DomainDay{}
+	for _, d := range days {
+		if (!from.IsZero() && d.Day.Before(from)) || (!to.IsZero() && d.Day.After(to)) {
+			continue
+		}
+
+		switch {
+		case domain == "all":
+			n := len(result)
+			if n > 0 && result[n-1].Day.Equal(d.Day) {
+				result[n-1].Merge(d.Counts)
+				continue
+			}
+			d.Domain = "all"
+		case !strings.EqualFold(d.Domain, domain):
+			continue
+		}
+		result = append(result, d)
+	}
+
+	return result, nil
+}
+
+// daily returns daily counts of the store, by day in loc when set.
+func daily(ctx context.Context, s *store.Store, loc *time.Location) ([]store.DomainDay, error) {
+	if loc != nil {
+		return s.DailyIn(ctx, loc)
+	}
+	return s.Daily(ctx)
+}
+
+func splitTarget(target string) (domain, metric string) {
+	i := strings.LastIndex(target, ":")
+	if i < 0 {
+		return "all", target
+	}
+
+	return strings.ToLower(target[:i]), target[i+1:]
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/pb"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// gRPC status codes used by grpcHandler.
+const (
+	grpcInvalidArgument   = 3
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnauthenticated   = 16
+)
+
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// grpcHandler serves the dmarc.v1.DMARC service of pb/dmarc.proto.
+// Requests are authorized like HTTP ones, with "authorization: Bearer <token>" metadata.
+// Compressed messages are not supported.
+type grpcHandler struct {
+	tenants  []*tenant
+	ingest   *ingestHandler
+	location *time.Location // Days of Query in this time zone, by the UTC day reports begin when nil
+}
+
+func (h *grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeError(w, http.StatusUnsupportedMediaType, "expected a gRPC request")
+		return
+	}
+
+	var resp encoding.BinaryMarshaler
+	var err error
+	scope := store.ScopeRead
+	if r.URL.Path == "/"+pb.Service+"/Ingest" {
+		scope = store.ScopeIngest
+	}
+	t, _, ok := authorize(r, h.tenants, scope)
+	switch {
+	case !ok && t != nil:
+		err = &grpcError{grpcPermissionDenied, "token lacks the " + scope + " scope"}
+	case !ok:
+		err = &grpcError{grpcUnauthenticated, "unauthorized"}
+	case r.URL.Path == "/"+pb.Service+"/Ingest":
+		resp, err = h.ingestReports(r, t)
+	case r.URL.Path == "/"+pb.Service+"/Query":
+		resp, err = h.query(r, t)
+	default:
+		err = &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path}
+	}
+
+	var message []byte
+	if err == nil {
+		message, err = resp.MarshalBinary()
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	if err != nil {
+		// trailers-only response
+		writeGRPCStatus(w.Header(), err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = writeGRPCMessage(w, message); err != nil {
+		slog.Error("Failed to write gRPC response", "err", err)
+	}
+
+	// with the body written, headers set now are sent as trailers
+	trailer := http.Header{}
+	writeGRPCStatus(trailer, err)
+	for name, values := range trailer {
+		w.Header()[http.TrailerPrefix+name] = values
+	}
+}
+
+// ingestReports handles Ingest: chunks are joined into files,
+// which are stored like uploads to /ingest.
+func (h *grpcHandler) ingestReports(r *http.Request, t *tenant) (encoding.BinaryMarshaler, error) {
+	uploads := []dmark.File{}
+	size := int64(0)
+	for {
+		message, err := readGRPCMessage(r.Body, h.ingest.maxSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := pb.ReportChunk{}
+		if err = chunk.UnmarshalBinary(message); err != nil {
+			return nil, &grpcError{grpcInvalidArgument, err.Error()}
+		}
+
+		size += int64(len(chunk.Data))
+		if size > h.ingest.maxSize {
+			return nil, &grpcError{grpcResourceExhausted, "upload too large"}
+		}
+
+		if chunk.Name != "" || len(uploads) == 0 {
+			name := chunk.Name
+			if name == "" {
+				name = "upload.xml"
+			}
+			uploads = append(uploads, dmark.File{Name: name})
+		}
+		last := &uploads[len(uploads)-1]
+		last.Content = append(last.Content, chunk.Data...)
+	}
+
+	resp := ingestResponse{Saved: []string{}, Skipped: []string{}}
+	for _, upload := range uploads {
+		files, err := extractUpload(upload.Name, "", upload.Content)
+		if err != nil {
+			resp.skip(upload.Name, err.Error(), dmark.ErrorCode(err))
+			continue
+		}
+		if err = h.ingest.save(t, files, r.RemoteAddr, &resp); err != nil {
+			slog.Error("Failed to save report", "err", err)
+			return nil, &grpcError{grpcInternal, "failed to store report"}
+		}
+	}
+
+	return &pb.IngestResponse{
+		Saved:    resp.Saved,
+		Skipped:  resp.Skipped,
+		Warnings: resp.Warnings,
+		Codes:    resp.Codes,
+	}, nil
+}
+
+// query handles Query with the daily counts served to Grafana.
+func (h *grpcHandler) query(r *http.Request, t *tenant) (encoding.BinaryMarshaler, error) {
+	message, err := readGRPCMessage(r.Body, h.ingest.maxSize)
+	if err == io.EOF {
+		return nil, &grpcError{grpcInvalidArgument, "missing request message"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := pb.SummaryRequest{}
+	if err = req.UnmarshalBinary(message); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, err.Error()}
+	}
+
+	domain := req.Domain
+	if domain == "" {
+		domain = "all"
+	}
+
+	days, err := domainDays(r.Context(), t.store, domain, req.From, req.To, h.location)
+	if err != nil {
+		slog.Error("Failed to get daily counts", "err", err)
+		return nil, &grpcError{grpcInternal, "failed to read reports"}
+	}
+
+	return &pb.SummaryResponse{Days: days}, nil
+}
+
+// readGRPCMessage reads a length-prefixed message, returning io.EOF at the end of the stream.
+func readGRPCMessage(r io.Reader, maxSize int64) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, &grpcError{grpcInvalidArgument, "read message: " + err.Error()}
+	}
+
+	if header[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if int64(size) > maxSize {
+		return nil, &grpcError{grpcResourceExhausted, fmt.Sprintf("message of %d bytes is too large", size)}
+	}
+
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "read message: " + err.Error()}
+	}
+
+	return message, nil
+}
+
+func writeGRPCMessage(w io.Writer, message []byte) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 5+len(message)))
+	buf.WriteByte(0)
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(message))))
+	buf.Write(message)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+
+	return nil
+}
+
+// writeGRPCStatus sets grpc-status and grpc-message for err, OK when nil.
+func writeGRPCStatus(h http.Header, err error) {
+	if err == nil {
+		h.Set("Grpc-Status", "0")
+		return
+	}
+
+	status, ok := err.(*grpcError)
+	if !ok {
+		status = &grpcError{grpcInternal, err.Error()}
+	}
+	h.Set("Grpc-Status", strconv.Itoa(status.code))
+	h.Set("Grpc-Message", percentEncode(status.message))
+}
+
+// percentEncode escapes a status message as required for grpc-message.
+func percentEncode(s string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
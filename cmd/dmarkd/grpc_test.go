@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/chuhlomin/dmark-go/pb"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// grpcRequest returns a gRPC request of the method with the messages as its body.
+func grpcRequest(t *testing.T, method string, messages ...interface{ MarshalBinary() ([]byte, error) }) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	for _, m := range messages {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writeGRPCMessage(&body, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/"+pb.Service+"/"+method, &body)
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("Authorization", "Bearer secret")
+	return r
+}
+
+// TestGRPCIngest checks Ingest returns warnings and codes like the HTTP endpoint.
+func TestGRPCIngest(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	h := &grpcHandler{
+		tenants: []*tenant{{Token: "secret", store: s}},
+		ingest:  &ingestHandler{maxSize: 1 << 20},
+	}
+
+	// the date range is inverted
+	report := `<feedback>
+<report_metadata><org_name>example.net</org_name><report_id>1</report_id>
+<date_range><begin>1709337600</begin><end>1709251200</end></date_range></report_metadata>
+<policy_published><domain>example.com</domain><p>none</p></policy_published>
+<record><row><source_ip>192.0.2.1</source_ip><count>1</count>
+<policy_evaluated><disposition>none</disposition><dkim>pass</dkim><spf>pass</spf></policy_evaluated></row></record>
+</feedback>`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, grpcRequest(t, "Ingest",
+		&pb.ReportChunk{Name: "report.xml", Data: []byte(report)},
+		&pb.ReportChunk{Name: "entity.xml", Data: []byte(`<!DOCTYPE feedback [<!ENTITY x SYSTEM "file:///etc/passwd">]><feedback>&x;</feedback>`)},
+	))
+
+	if status := w.Result().Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("want status 0, got %q: %s", status, w.Result().Trailer.Get("Grpc-Message"))
+	}
+	message, err := readGRPCMessage(w.Body, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp pb.IngestResponse
+	if err = resp.UnmarshalBinary(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Saved) != 1 || len(resp.Skipped) != 1 {
+		t.Errorf("want a report saved and a file skipped, got %+v", resp)
+	}
+	if len(resp.Warnings) != 1 {
+		t.Errorf("want a warning about the inverted date range, got %q", resp.Warnings)
+	}
+	if !reflect.DeepEqual(resp.Codes, []string{"external_entity"}) {
+		t.Errorf("want the code of the skipped file, got %q", resp.Codes)
+	}
+}
+
+// TestIngestResponseBinary checks IngestResponse survives encoding.
+func TestIngestResponseBinary(t *testing.T) {
+	want := pb.IngestResponse{
+		Saved:    []string{"a.xml"},
+		Skipped:  []string{"b.xml: not a DMARC report"},
+		Warnings: []string{"inverted date range"},
+		Codes:    []string{"not_dmarc"},
+	}
+	b, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got pb.IngestResponse
+	if err = got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
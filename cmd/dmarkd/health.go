@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+// readyCacheTTL is how long the result of checking the stores is reused,
+// so that frequent or concurrent probes do not write to the disk each time.
+const readyCacheTTL = 5 * time.Second
+
+// healthHandler serves /healthz, telling the process is up, and /readyz,
+// checking that stores of all tenants can be read and written to.
+// Neither needs a token.
+type healthHandler struct {
+	tenants []*tenant
+
+	mu      sync.Mutex
+	checked time.Time // When ready last checked the stores
+	err     error     // The result of the last check
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case "/readyz":
+		if err := h.ready(time.Now()); err != nil {
+			// the error has paths of the store, it is logged instead
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+				"status": "unavailable",
+				"error":  "store is not available",
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// ready checks the stores of all tenants, at most once per readyCacheTTL,
+// logging errors.
+func (h *healthHandler) ready(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.checked.IsZero() && now.Sub(h.checked) < readyCacheTTL {
+		return h.err
+	}
+
+	h.checked = now
+	h.err = nil
+	for _, t := range h.tenants {
+		if err := t.store.Check(); err != nil {
+			slog.Error("Store is not available", "tenant", t.ID, "err", err)
+			h.err = err
+			break
+		}
+	}
+
+	return h.err
+}
+
+// pprofHandler serves net/http/pprof profiles under /debug/pprof/.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+func TestReadyz(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	h := &healthHandler{tenants: []*tenant{{store: s}}}
+	readyz := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w
+	}
+
+	if w := readyz(); w.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d %s", w.Code, w.Body)
+	}
+
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last result is reused within readyCacheTTL
+	if w := readyz(); w.Code != http.StatusOK {
+		t.Fatalf("want cached 200, got %d %s", w.Code, w.Body)
+	}
+
+	h.checked = h.checked.Add(-readyCacheTTL)
+	w := readyz()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want 503, got %d %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), dir) {
+		t.Errorf("response has the store path: %s", w.Body)
+	}
+}
+
+func TestReadyCache(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	h := &healthHandler{tenants: []*tenant{{store: s}}}
+	now := time.Now()
+	if err = h.ready(now); err != nil {
+		t.Fatal(err)
+	}
+	checked := h.checked
+
+	if err = h.ready(now.Add(readyCacheTTL - time.Millisecond)); err != nil || h.checked != checked {
+		t.Errorf("want the result reused, checked at %v, %v", h.checked, err)
+	}
+	if err = h.ready(now.Add(readyCacheTTL)); err != nil || h.checked == checked {
+		t.Errorf("want the stores checked again, checked at %v, %v", h.checked, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// ingestResponse is returned by POST /ingest.
+type ingestResponse struct {
+	Saved    []string `json:"saved"`              // Names of stored reports
+	Skipped  []string `json:"skipped"`            // Reasons for skipped files
+	Warnings []string `json:"warnings,omitempty"` // Problems of saved reports, e.g. inverted date ranges
+	Codes    []string `json:"codes,omitempty"`    // Codes of the reasons in Skipped, see dmark.ErrorCode
+}
+
+// skip adds the reason a file was skipped with its code, "unknown" when empty.
+func (r *ingestResponse) skip(name, reason, code string) {
+	if code == "" {
+		code = "unknown"
+	}
+	r.Skipped = append(r.Skipped, name+": "+reason)
+	r.Codes = append(r.Codes, code)
+}
+
+// ingestHandler accepts a report as raw XML, gzip or zip,
+// or an email message (.eml) with reports attached.
+type ingestHandler struct {
+	maxSize int64
+	parser  dmark.BulkParser
+	alerts  *alerter // Checks new reports against the baseline when set
+}
+
+func (h *ingestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, h.maxSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read body: "+err.Error())
+		return
+	}
+	if int64(len(content)) > h.maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	files, err := extractUpload(uploadName(r), r.Header.Get("Content-Type"), content)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	resp := ingestResponse{Saved: []string{}, Skipped: []string{}}
+	if err = h.save(requestTenant(r), files, r.RemoteAddr, &resp); err != nil {
+		slog.Error("Failed to save report", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to store report")
+		return
+	}
+
+	status := http.StatusOK
+	if len(resp.Saved) == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, resp)
+}
+
+// save stores valid reports of the tenant's domains,
+// adding their names or the reasons they were skipped to resp.
+func (h *ingestHandler) save(t *tenant, files []dmark.File, remote string, resp *ingestResponse) error {
+	for _, file := range files {
+		feedback, err := h.parser.ParseBytes(file.Content)
+		if err != nil {
+			resp.skip(file.Name, err.Error(), dmark.ErrorCode(err))
+			continue
+		}
+		if !t.owns(feedback.PolicyPublished.Domain) {
+			resp.skip(file.Name, "policy domain "+feedback.PolicyPublished.Domain+" is not allowed", "domain_not_allowed")
+			continue
+		}
+
+		path, saved, err := t.store.Save(file)
+		if err != nil {
+			return fmt.Errorf("save %q: %w", file.Name, err)
+		}
+		slog.Info("Saved report", "path", path, "tenant", t.ID, "remote", remote)
+		_, warnings := dmark.NormalizeRanges([]dmark.Feedback{*feedback})
+		for _, w := range warnings {
+			slog.Warn("Unusual report date range", "path", path, "tenant", t.ID, "problem", w.Problem)
+			resp.Warnings = append(resp.Warnings, filepath.Base(path)+": "+w.String())
+		}
+		for _, i := range dmark.CheckReport(feedback) {
+			slog.Warn("Inconsistent record", "path", path, "tenant", t.ID, "problem", i.Problem, "record", i.Record)
+			resp.Warnings = append(resp.Warnings, filepath.Base(path)+": "+i.String())
+		}
+		if saved && h.alerts != nil {
+			h.alerts.checkLater(t.ID, feedback)
+		}
+		resp.Saved = append(resp.Saved, filepath.Base(path))
+	}
+
+	return nil
+}
+
+// uploadName returns the file name from ?name= or Content-Disposition header.
+func uploadName(r *http.Request) string {
+	if name := r.URL.Query().Get("name"); name != "" {
+		return name
+	}
+
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+
+	return "upload.xml"
+}
+
+func extractUpload(name, contentType string, content []byte) ([]dmark.File, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "message/rfc822" || strings.HasSuffix(strings.ToLower(name), ".eml") {
+		return dmark.ExtractReports(bytes.NewReader(content))
+	}
+
+	return dmark.Decompress(name, content)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const stateCookie = "dmarkd_oidc_state"
+
+// authHandler serves the login page, the OIDC login and callback, and logout under /auth/.
+type authHandler struct {
+	users     *usersConfig
+	sessions  *sessions
+	oidc      *oidcClient // nil without OIDC
+	dummyHash string      // Checked for unknown users, so they take as long as known ones
+}
+
+func newAuthHandler(users *usersConfig, s *sessions) (*authHandler, error) {
+	h := &authHandler{users: users, sessions: s}
+	if users.OIDC != nil {
+		h.oidc = newOIDCClient(*users.OIDC)
+	}
+
+	var err error
+	h.dummyHash, err = hashPassword("")
+	return h, err
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/auth/login":
+		if r.Method == http.MethodPost {
+			h.passwordLogin(w, r)
+			return
+		}
+		h.loginPage(w, r, http.StatusOK, "")
+	case "/auth/oidc":
+		h.oidcLogin(w, r)
+	case "/auth/callback":
+		h.oidcCallback(w, r)
+	case "/auth/logout":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.sessions.end(w)
+		http.Redirect(w, r, "/auth/login", http.StatusSeeOther)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *authHandler) loginPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	passwords := false
+	for _, u := range h.users.Users {
+		if u.Password != "" {
+			passwords = true
+		}
+	}
+
+	writeHTML(w, status, "login.html", map[string]interface{}{
+		"Next":      safeRedirect(r.FormValue("next")),
+		"Error":     message,
+		"Passwords": passwords,
+		"OIDC":      h.oidc != nil,
+	})
+}
+
+func (h *authHandler) passwordLogin(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.PostFormValue("username"))
+	password := r.PostFormValue("password")
+
+	u, ok := h.users.user(name)
+	hash := h.dummyHash
+	if ok && u.Password != "" {
+		hash = u.Password
+	}
+	if !checkPassword(hash, password) || !ok || u.Password == "" {
+		slog.Warn("Failed login", "user", name, "remote", r.RemoteAddr)
+		h.loginPage(w, r, http.StatusUnauthorized, "Invalid username or password.")
+		return
+	}
+
+	slog.Info("Logged in", "user", u.Name, "remote", r.RemoteAddr)
+	h.sessions.start(w, r, u.Name)
+	http.Redirect(w, r, safeRedirect(r.PostFormValue("next")), http.StatusSeeOther)
+}
+
+// oidcLogin sends the user to the provider, remembering the state and the page to return to.
+func (h *authHandler) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		writeError(w, http.StatusNotFound, "OIDC is not configured")
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		slog.Error("Failed to start login", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+
+	u, err := h.oidc.authURL(r.Context(), state)
+	if err != nil {
+		slog.Error("Failed to start login", "err", err)
+		h.loginPage(w, r, http.StatusBadGateway, "The identity provider is not available.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state + "|" + url.QueryEscape(safeRedirect(r.FormValue("next"))),
+		Path:     "/auth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+func (h *authHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		writeError(w, http.StatusNotFound, "OIDC is not configured")
+		return
+	}
+
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		h.loginPage(w, r, http.StatusBadRequest, "The login has expired, try again.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth/", MaxAge: -1})
+
+	state, next, _ := strings.Cut(cookie.Value, "|")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(r.URL.Query().Get("state"))) != 1 {
+		h.loginPage(w, r, http.StatusBadRequest, "The login has expired, try again.")
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		h.loginPage(w, r, http.StatusUnauthorized, "The identity provider refused the login: "+e)
+		return
+	}
+
+	email, err := h.oidc.email(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		slog.Error("Failed OIDC login", "err", err, "remote", r.RemoteAddr)
+		h.loginPage(w, r, http.StatusBadGateway, "Failed to sign in with the identity provider.")
+		return
+	}
+
+	u, ok := h.users.user(email)
+	if !ok {
+		slog.Warn("Unknown OIDC user", "email", email, "remote", r.RemoteAddr)
+		h.loginPage(w, r, http.StatusForbidden, email+" has no access to the dashboard.")
+		return
+	}
+
+	slog.Info("Logged in", "user", u.Name, "oidc", true, "remote", r.RemoteAddr)
+	h.sessions.start(w, r, u.Name)
+	next, _ = url.QueryUnescape(next)
+	http.Redirect(w, r, safeRedirect(next), http.StatusSeeOther)
+}
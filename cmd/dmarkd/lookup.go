@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/rdap"
+)
+
+// lookupTimeout bounds DNS lookups of a source.
+const lookupTimeout = 5 * time.Second
+
+// rdapTimeout bounds the RDAP lookup of a source, which may fetch bootstrap files first.
+const rdapTimeout = 10 * time.Second
+
+// sourceInfo is what DNS tells about a source IP.
+type sourceInfo struct {
+	Hosts   []string `json:"hosts,omitempty"` // PTR names
+	ASN     string   `json:"asn,omitempty"`
+	ASName  string   `json:"as_name,omitempty"`
+	Prefix  string   `json:"prefix,omitempty"` // The announced prefix containing the IP
+	Country string   `json:"country,omitempty"`
+	Owner   string   `json:"owner,omitempty"` // The registrant of the network, from RDAP
+	Abuse   []string `json:"abuse,omitempty"` // Abuse contacts of the network, from RDAP
+}
+
+// lookupSource resolves PTR names and the origin AS of ip, using the
+// Team Cymru IP to ASN mapping service over DNS, and the network owner over RDAP
+// when client is set. Failed lookups leave fields empty.
+func lookupSource(ctx context.Context, ip net.IP, client *rdap.Client) sourceInfo {
+	info := sourceInfo{}
+	if client != nil {
+		rdapCtx, cancel := context.WithTimeout(ctx, rdapTimeout)
+		network, err := client.Lookup(rdapCtx, ip)
+		cancel()
+		if err == nil {
+			info.Owner = network.Owner
+			info.Abuse = network.AbuseContacts
+			info.Country = network.Country
+		} else {
+			slog.Debug("Failed to look up network over RDAP", "ip", ip, "err", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	if names, err := net.DefaultResolver.LookupAddr(ctx, ip.String()); err == nil {
+		for _, name := range names {
+			info.Hosts = append(info.Hosts, strings.TrimSuffix(name, "."))
+		}
+	}
+
+	// "13335 | 1.1.1.0/24 | AU | apnic | 2011-08-11"
+	origin := cymruFields(ctx, originName(ip))
+	if len(origin) < 3 {
+		return info
+	}
+	if asns := strings.Fields(origin[0]); len(asns) > 0 {
+		info.ASN = asns[0]
+	}
+	info.Prefix = origin[1]
+	if origin[2] != "" {
+		info.Country = origin[2]
+	}
+
+	// "13335 | US | arin | 2010-07-14 | CLOUDFLARENET, US"
+	if as := cymruFields(ctx, "AS"+info.ASN+".asn.cymru.com"); len(as) >= 5 {
+		info.ASName = as[4]
+	}
+
+	return info
+}
+
+// originName returns the name to query for the origin AS of ip:
+// reversed octets under origin.asn.cymru.com for IPv4, reversed nibbles under origin6 for IPv6.
+func originName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	b := strings.Builder{}
+	ip16 := ip.To16()
+	for i := len(ip16) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip16[i]&0xf, ip16[i]>>4)
+	}
+	b.WriteString("origin6.asn.cymru.com")
+
+	return b.String()
+}
+
+// cymruFields returns the trimmed "|"-separated fields of the first TXT record of name.
+func cymruFields(ctx context.Context, name string) []string {
+	records, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil || len(records) == 0 {
+		return nil
+	}
+
+	fields := strings.Split(records[0], "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	return fields
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/baseline"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/rdap"
+	"github.com/chuhlomin/dmark-go/schedule"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+type config struct {
+	addr     string
+	grpcAddr string
+	tlsCert  string
+	tlsKey   string
+	token    string
+	tenants  string
+	users    string
+	session  string
+	maxSize  int64
+	outPath  string
+	bolt     bool
+	resolve  bool
+	rate     float64
+	burst    int
+	pprof    string
+	baseline string
+	webhook  string
+	rdap     string
+	schedule string
+	location *time.Location
+
+	alertDryRun     bool
+	refreshInterval time.Duration
+	shutdownTimeout time.Duration
+}
+
+func run(ctx context.Context, cfg config) error {
+	open := store.Open
+	if cfg.bolt {
+		open = store.OpenBolt
+	}
+	s, err := open(cfg.outPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	tenants := []*tenant{{Token: cfg.token, store: s}}
+	switch {
+	case cfg.tenants != "":
+		if tenants, err = loadTenants(cfg.tenants, s); err != nil {
+			return err
+		}
+		slog.Info("Loaded tenants", "count", len(tenants))
+	case cfg.token == "":
+		slog.Warn("INGEST_TOKEN is not set, anyone can upload and read reports until API tokens are created")
+	}
+
+	if cfg.grpcAddr != "" && cfg.tlsCert == "" {
+		// gRPC needs HTTP/2, which net/http serves over TLS only
+		return errors.New("gRPC requires -tls-cert and -tls-key")
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobsDone := make(chan struct{})
+	if cfg.schedule != "" {
+		jobs, err := schedule.Load(cfg.schedule)
+		if err != nil {
+			return err
+		}
+		slog.Info("Loaded schedule", "jobs", len(jobs))
+		go func() {
+			schedule.Run(jobsCtx, jobs, cfg.location)
+			close(jobsDone)
+		}()
+	} else {
+		close(jobsDone)
+	}
+
+	refresh := newRefresher(tenants, cfg.refreshInterval)
+	refreshDone := make(chan struct{})
+	go func() {
+		refresh.run(jobsCtx)
+		close(refreshDone)
+	}()
+
+	ingest := &ingestHandler{
+		maxSize: cfg.maxSize,
+	}
+	if cfg.baseline != "" {
+		b, err := baseline.Load(cfg.baseline)
+		if err != nil {
+			return err
+		}
+		ingest.alerts = &alerter{
+			baseline: b,
+			webhook:  cfg.webhook,
+			client:   &http.Client{Timeout: 10 * time.Second},
+			dryRun:   cfg.alertDryRun,
+		}
+		slog.Info("Loaded baseline", "senders", len(b.Senders), "webhook", cfg.webhook != "")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/ingest", requireToken(tenants, store.ScopeIngest, ingest))
+	mux.Handle("/search", requireToken(tenants, store.ScopeRead, &searchHandler{}))
+	mux.Handle("/export", requireToken(tenants, store.ScopeRead, &exportHandler{}))
+	mux.Handle("/portfolio", requireToken(tenants, store.ScopeRead, &portfolioHandler{}))
+	mux.Handle("/changes", requireToken(tenants, store.ScopeRead, &changesHandler{location: cfg.location}))
+	mux.Handle("/tags", requireToken(tenants, store.ScopeRead, &tagsHandler{}))
+	mux.Handle("/tags/", requireToken(tenants, store.ScopeRead, &tagsHandler{}))
+	mux.Handle("/grafana/", requireToken(tenants, store.ScopeRead, &grafanaHandler{
+		prefix:   "/grafana",
+		location: cfg.location,
+	}))
+
+	dashboard := &dashboardHandler{
+		prefix:  "/dashboard",
+		resolve: cfg.resolve,
+		ingest:  ingest,
+	}
+	if cfg.resolve {
+		dashboard.rdap = &rdap.Client{CacheDir: cfg.rdap}
+	}
+	if cfg.users == "" {
+		mux.Handle("/dashboard/", requireToken(tenants, store.ScopeRead, dashboard))
+	} else {
+		users, err := loadUsers(cfg.users, tenants)
+		if err != nil {
+			return err
+		}
+		key, persistent, err := sessionKey(cfg.session)
+		if err != nil {
+			return err
+		}
+		if !persistent {
+			slog.Warn("SESSION_KEY is not set, users sign in again when the server restarts")
+		}
+
+		sess := &sessions{key: key}
+		auth, err := newAuthHandler(users, sess)
+		if err != nil {
+			return err
+		}
+		mux.Handle("/auth/", auth)
+		mux.Handle("/dashboard/", requireUser(users, sess, dashboard))
+		slog.Info("Loaded users", "count", len(users.Users), "oidc", users.OIDC != nil)
+	}
+
+	// HTTP and gRPC requests share buckets
+	var limiter *rateLimiter
+	var limited http.Handler = mux
+	if cfg.rate > 0 {
+		limiter = newRateLimiter(cfg.rate, cfg.burst, tenants)
+		limited = limiter.limit(mux)
+	}
+
+	// probes and the specification need neither a token nor a rate limit
+	handler := http.NewServeMux()
+	health := &healthHandler{tenants: tenants}
+	handler.Handle("/healthz", health)
+	handler.Handle("/readyz", health)
+	handler.Handle("/openapi.json", &openAPIHandler{})
+	handler.Handle("/", limited)
+
+	servers := []*http.Server{}
+	errs := make(chan error, 3)
+	serve := func(srv *http.Server, tls bool) {
+		servers = append(servers, srv)
+		go func() {
+			errs <- listen(srv, tls, cfg)
+		}()
+	}
+
+	serve(&http.Server{Addr: cfg.addr, Handler: handler}, true)
+	if cfg.pprof != "" {
+		// profiles are served over plain HTTP, bind to a private address
+		serve(&http.Server{Addr: cfg.pprof, Handler: pprofHandler()}, false)
+	}
+	if cfg.grpcAddr != "" {
+		var grpc http.Handler = &grpcHandler{tenants: tenants, ingest: ingest, location: cfg.location}
+		if limiter != nil {
+			grpc = limiter.limit(grpc)
+		}
+		serve(&http.Server{Addr: cfg.grpcAddr, Handler: grpc}, true)
+	}
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", cfg.shutdownTimeout)
+	}
+
+	// requests in flight, running jobs and alerts being posted finish first
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			slog.Warn("Closed connections in flight", "addr", srv.Addr, "err", shutdownErr)
+			srv.Close()
+		}
+	}
+	stopJobs()
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Left jobs running")
+	}
+	select {
+	case <-refreshDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Left counts refreshing")
+	}
+	if ingest.alerts != nil && !ingest.alerts.wait(shutdownCtx) {
+		slog.Warn("Left alerts unposted")
+	}
+
+	return err
+}
+
+func printPasswordHash(r io.Reader, w io.Writer) error {
+	password, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, hash)
+	return err
+}
+
+// listen serves srv until it is shut down, over TLS when tls is set and
+// there is a certificate.
+func listen(srv *http.Server, tls bool, cfg config) error {
+	tls = tls && cfg.tlsCert != ""
+	slog.Info("Listening", "addr", srv.Addr, "tls", tls)
+
+	var err error
+	if tls {
+		err = srv.ListenAndServeTLS(cfg.tlsCert, cfg.tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	grpcAddr := flag.String("grpc-addr", "", "Address to serve gRPC on, disabled when empty")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, serve plain HTTP when empty")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	maxSize := flag.Int64("max-size", 20<<20, "Maximum upload size in bytes")
+	outPath := flag.String("o", "./", "Path to directory to save DMARK XML reports to")
+	bolt := flag.Bool("bolt", false, "Keep raw reports in reports.db, a BoltDB file in the -o directory indexed by domain and date, instead of XML files; directories with reports.db use it regardless")
+	tenants := flag.String("tenants", "", "JSON file of tenants with their tokens and domains, each with its own store in tenants/<id>; INGEST_TOKEN is not used then")
+	users := flag.String("users", "", "JSON file of dashboard users with their roles, passwords and domains, and OIDC settings; the dashboard takes tokens when empty")
+	hash := flag.Bool("hash-password", false, "Read a password from stdin, print its hash for the users file and exit")
+	rate := flag.Float64("rate-limit", 0, "Requests per second allowed per IP address and per token over HTTP and gRPC, unlimited when 0")
+	burst := flag.Int("rate-burst", 20, "Requests allowed at once per IP address and per token with -rate-limit")
+	pprofAddr := flag.String("pprof-addr", "", "Address to serve /debug/pprof on, e.g. localhost:6060, disabled when empty")
+	baselinePath := flag.String("baseline", "", "JSON file of expected senders; records of new reports from other sources are logged and posted to -alert-webhook")
+	webhook := flag.String("alert-webhook", "", "URL to post JSON alerts on unexpected sources to, e.g. a Slack incoming webhook")
+	alertDryRun := flag.Bool("alert-dry-run", false, "Log alerts that would be posted to -alert-webhook instead of posting them")
+	resolve := flag.Bool("resolve", true, "Look up host names, AS and network owners of sources on the dashboard")
+	tz := flag.String("tz", "", `Time zone of days served to Grafana and gRPC and of -schedule cron expressions, e.g. "Europe/Berlin", splitting reports spanning days; by the UTC day reports begin when empty`)
+	schedulePath := flag.String("schedule", "", "JSON file of commands to run periodically, e.g. fetching reports or sending digests")
+	rdapCache := flag.String("rdap-cache", rdap.DefaultCacheDir(), "Directory to cache RDAP lookups of source networks in, no cache when empty")
+	refreshInterval := flag.Duration("refresh", 10*time.Minute, "Interval to merge counts of ingested reports into counts.json and count reports saved by other means, like mailbox2reports, for the dashboard and Grafana; ingested reports are counted right away, 0 refreshes on start only")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Time to let requests, jobs and alerts in flight finish on SIGINT or SIGTERM")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	if *hash {
+		if err := printPasswordHash(os.Stdin, os.Stdout); err != nil {
+			logging.Fatal(err)
+		}
+		return
+	}
+
+	slog.Info("Starting...")
+
+	cfg := config{
+		addr:     *addr,
+		grpcAddr: *grpcAddr,
+		tlsCert:  *tlsCert,
+		tlsKey:   *tlsKey,
+		token:    os.Getenv("INGEST_TOKEN"),
+		tenants:  *tenants,
+		users:    *users,
+		session:  os.Getenv("SESSION_KEY"),
+		maxSize:  *maxSize,
+		outPath:  *outPath,
+		bolt:     *bolt,
+		resolve:  *resolve,
+		rate:     *rate,
+		burst:    *burst,
+		pprof:    *pprofAddr,
+		baseline: *baselinePath,
+		webhook:  *webhook,
+		rdap:     *rdapCache,
+		schedule: *schedulePath,
+
+		alertDryRun:     *alertDryRun,
+		refreshInterval: *refreshInterval,
+		shutdownTimeout: *shutdownTimeout,
+	}
+	if *tz != "" {
+		var err error
+		if cfg.location, err = time.LoadLocation(*tz); err != nil {
+			logging.Fatal(fmt.Errorf("time zone: %w", err))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Stopped")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcTimeout bounds requests to the OIDC provider.
+const oidcTimeout = 10 * time.Second
+
+// oidcConfig is the client registration at an OpenID Connect provider.
+type oidcConfig struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURL  string `json:"redirect_url"` // https://<dmarkd>/auth/callback
+}
+
+// oidcClient signs users in with the authorization code flow. Users are identified
+// by the verified email from the userinfo endpoint, requested over TLS with the
+// access token, so ID tokens are not needed.
+type oidcClient struct {
+	config oidcConfig
+	http   *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery // Fetched on the first login
+}
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+func newOIDCClient(config oidcConfig) *oidcClient {
+	return &oidcClient{
+		config: config,
+		http:   &http.Client{Timeout: oidcTimeout},
+	}
+}
+
+// discover returns the provider metadata, fetching it once it is available.
+func (c *oidcClient) discover(ctx context.Context) (*oidcDiscovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	d := &oidcDiscovery{}
+	u := strings.TrimSuffix(c.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, u, "", d); err != nil {
+		return nil, fmt.Errorf("discover provider: %w", err)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.UserinfoEndpoint == "" {
+		return nil, errors.New("discover provider: missing endpoints")
+	}
+
+	c.discovery = d
+	return d, nil
+}
+
+// authURL returns the provider URL to send the user to.
+func (c *oidcClient) authURL(ctx context.Context, state string) (string, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.config.ClientID},
+		"redirect_uri":  {c.config.RedirectURL},
+		"scope":         {"openid email"},
+		"state":         {state},
+	}
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// email exchanges an authorization code for an access token
+// and returns the verified email of the user.
+func (c *oidcClient) email(ctx context.Context, code string) (string, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {c.config.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err = c.do(req, &token); err != nil {
+		return "", fmt.Errorf("exchange code: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("exchange code: no access token")
+	}
+
+	info := struct {
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+	}{}
+	if err = c.getJSON(ctx, d.UserinfoEndpoint, token.AccessToken, &info); err != nil {
+		return "", fmt.Errorf("get userinfo: %w", err)
+	}
+	if info.Email == "" {
+		return "", errors.New("userinfo has no email")
+	}
+	if info.EmailVerified == nil || !*info.EmailVerified {
+		// without the claim, anyone may have typed the address into the IdP
+		return "", fmt.Errorf("email %s is not verified", info.Email)
+	}
+
+	return info.Email, nil
+}
+
+func (c *oidcClient) getJSON(ctx context.Context, u, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	return c.do(req, v)
+}
+
+func (c *oidcClient) do(req *http.Request, v interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
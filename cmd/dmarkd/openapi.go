@@ -0,0 +1,26 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:generate go run ../../internal/apigen -root ../.. -spec openapi.json -client ../../dmarkclient/client.go
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandler serves the OpenAPI specification of the API, generated along
+// with the dmarkclient package. It needs no token.
+type openAPIHandler struct{}
+
+func (h *openAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+const (
+	portfolioDays   = 30 // Default number of days of reports /portfolio summarizes
+	portfolioWindow = 7  // Default number of days /portfolio compares pass rates of for trends
+)
+
+// portfolioHandler returns where each policy domain stands: counts, policy,
+// score and the trend of the pass rate, see dmark.Portfolio:
+// GET /portfolio?days=30&window=7
+type portfolioHandler struct{}
+
+func (h *portfolioHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	days, window, err := portfolioParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	portfolio, err := readPortfolio(r.Context(), requestTenant(r).store, days, window)
+	if err != nil {
+		slog.Error("Failed to summarize domains", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, portfolio)
+}
+
+// portfolioParams reads the days and window parameters of portfolio requests.
+func portfolioParams(r *http.Request) (days, window int, err error) {
+	days, window = portfolioDays, portfolioWindow
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days <= 0 {
+			return 0, 0, errors.New("days: want a positive number of days")
+		}
+	}
+	if v := r.URL.Query().Get("window"); v != "" {
+		if window, err = strconv.Atoi(v); err != nil || window <= 0 {
+			return 0, 0, errors.New("window: want a positive number of days")
+		}
+	}
+
+	return days, window, nil
+}
+
+// readPortfolio summarizes reports of the store beginning in the last days.
+func readPortfolio(ctx context.Context, s *store.Store, days, window int) ([]dmark.PortfolioDomain, error) {
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -days)
+	reports, err := s.Query(ctx, store.Query{From: from})
+	if err != nil {
+		return nil, err
+	}
+
+	return dmark.Portfolio(reports, window), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits requests with token buckets per IP address and per valid
+// bearer token: a client may make burst requests at once and rate requests
+// per second on average, from each address and with each token.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	tenants []*tenant
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	cleaned time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(rate float64, burst int, tenants []*tenant) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		tenants: tenants,
+		buckets: map[string]*bucket{},
+		cleaned: time.Now(),
+	}
+}
+
+// allow takes a token from the client's bucket, or returns how long to wait for one.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clean(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+
+	return true, 0
+}
+
+// clean drops buckets of clients idle long enough to refill, once a minute.
+func (l *rateLimiter) clean(now time.Time) {
+	if now.Sub(l.cleaned) < time.Minute {
+		return
+	}
+	l.cleaned = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limit responds with 429 Too Many Requests to clients over the limit.
+// The IP address is limited before the token is looked up, so made up tokens
+// cost no more than requests without one. Tokens of tenants have a bucket of
+// their own too, shared by all addresses using them. What the lookup found is
+// passed to next in the request context, see authorize.
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		if !l.take(w, r, ipKey(r), now) {
+			return
+		}
+
+		auth := authenticate(r, l.tenants)
+		if token, ok := bearerToken(r); ok && auth.tenant != nil {
+			sum := sha256.Sum256([]byte(token))
+			if !l.take(w, r, "token "+hex.EncodeToString(sum[:8]), now) {
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticationKey{}, auth)))
+	})
+}
+
+// take takes a token from the bucket of key, or responds with 429 Too Many Requests,
+// or the RESOURCE_EXHAUSTED status to gRPC requests.
+func (l *rateLimiter) take(w http.ResponseWriter, r *http.Request, key string, now time.Time) bool {
+	ok, wait := l.allow(key, now)
+	if ok {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		// trailers-only response, see grpcHandler
+		w.Header().Set("Content-Type", "application/grpc")
+		writeGRPCStatus(w.Header(), &grpcError{grpcResourceExhausted, "rate limit exceeded"})
+		w.WriteHeader(http.StatusOK)
+		return false
+	}
+	writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+	return false
+}
+
+// ipKey identifies the client by its IP address. IPv6 clients share a bucket
+// per /64, which they usually get whole. Forwarding headers are not trusted,
+// so behind a proxy all clients share a bucket.
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "ip " + ip.Mask(net.CIDRMask(64, 128)).String()
+	}
+	return "ip " + host
+}
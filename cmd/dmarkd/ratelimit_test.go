@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/chuhlomin/dmark-go/pb"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+func TestRateLimiterIPKey(t *testing.T) {
+	request := func(remoteAddr string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/search", nil)
+		r.RemoteAddr = remoteAddr
+		return r
+	}
+
+	tests := []struct {
+		name string
+		a, b *http.Request
+		same bool
+	}{
+		{"same address", request("192.0.2.1:1000"), request("192.0.2.1:1001"), true},
+		{"other address", request("192.0.2.1:1000"), request("192.0.2.2:1000"), false},
+		{"IPv6 /64 shares a bucket", request("[2001:db8::1]:1000"), request("[2001:db8::ffff:1]:1000"), true},
+		{"other IPv6 /64", request("[2001:db8::1]:1000"), request("[2001:db8:0:1::1]:1000"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := ipKey(tt.a), ipKey(tt.b)
+			if (a == b) != tt.same {
+				t.Errorf("keys %q and %q, want same %v", a, b, tt.same)
+			}
+		})
+	}
+}
+
+// TestRateLimiterTokens checks valid tokens are limited across addresses,
+// and the tenant found is passed on instead of being looked up again.
+func TestRateLimiterTokens(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tenants := []*tenant{{ID: "acme", Token: "secret", store: s}}
+	l := newRateLimiter(0.001, 1, tenants)
+	handler := l.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no tenants to look the token up in, only the request context
+		if found, _, ok := authorize(r, nil, store.ScopeRead); !ok || found.ID != "acme" {
+			t.Errorf("want tenant acme from the context, got %v, %v", found, ok)
+		}
+	}))
+
+	codes := []int{}
+	for _, remoteAddr := range []string{"192.0.2.1:1000", "198.51.100.1:1000"} {
+		r := httptest.NewRequest(http.MethodGet, "/search", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("want the token limited from the second address, got %v", codes)
+	}
+}
+
+func TestRateLimiterMadeUpTokens(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l := newRateLimiter(0.001, 2, []*tenant{{Token: "secret", store: s}})
+	handler := l.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := []int{}
+	for _, token := range []string{"guess1", "guess2", "guess3"} {
+		r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		r.RemoteAddr = "192.0.2.1:1000"
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("want the third request limited, got %v", codes)
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("want only the IP bucket, got %d buckets", len(l.buckets))
+	}
+}
+
+// TestRateLimiterGRPC checks gRPC requests over the limit get the
+// RESOURCE_EXHAUSTED status instead of an HTTP error.
+func TestRateLimiterGRPC(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tenants := []*tenant{{Token: "secret", store: s}}
+	handler := newRateLimiter(0.001, 1, tenants).limit(&grpcHandler{tenants: tenants, ingest: &ingestHandler{maxSize: 1 << 20}})
+
+	statuses := []string{}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, grpcRequest(t, "Query", &pb.SummaryRequest{}))
+		status := w.Result().Trailer.Get("Grpc-Status")
+		if status == "" {
+			status = w.Result().Header.Get("Grpc-Status") // trailers-only response
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("want HTTP status 200, got %d", w.Code)
+		}
+		statuses = append(statuses, status)
+	}
+
+	if !reflect.DeepEqual(statuses, []string{"0", "8"}) {
+		t.Errorf("want the second request exhausted, got statuses %q", statuses)
+	}
+}
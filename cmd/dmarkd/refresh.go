@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// refresher keeps counts of tenant stores, which the dashboard and Grafana
+// read, compact in the background, see store.Store.Refresh: on start, and
+// every interval, merging counts of reports ingested since into counts.json
+// and counting reports saved by other means, like mailbox2reports.
+// Ingested reports are counted by store.Store.Save already.
+type refresher struct {
+	tenants  []*tenant
+	interval time.Duration // Refresh on start only when 0
+}
+
+func newRefresher(tenants []*tenant, interval time.Duration) *refresher {
+	return &refresher{tenants: tenants, interval: interval}
+}
+
+// run refreshes all tenant stores, then again every interval, until ctx is done.
+func (r *refresher) run(ctx context.Context) {
+	r.refresh(ctx)
+	if r.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.refresh(ctx)
+		}
+	}
+}
+
+func (r *refresher) refresh(ctx context.Context) {
+	for _, t := range r.tenants {
+		start := time.Now()
+		result, err := t.store.Refresh(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to refresh counts", "tenant", t.ID, "err", err)
+			continue
+		}
+		if result.Added > 0 || result.Removed > 0 {
+			slog.Debug(
+				"Refreshed counts",
+				"tenant", t.ID,
+				"reports", result.Reports,
+				"added", result.Added,
+				"removed", result.Removed,
+				"duration", time.Since(start),
+			)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// searchLimit is the default number of records returned by /search.
+const searchLimit = 1000
+
+// searchResponse is returned by GET /search.
+type searchResponse struct {
+	Records   []dmark.FlatRecord `json:"records"`
+	Truncated bool               `json:"truncated"` // More records matched than the limit
+}
+
+// searchHandler returns records of stored reports matching the parameters,
+// see store.SearchQuery:
+// GET /search?ip=203.0.113.0/24&domain=example&selector=s1&report_id=1&org=google&from=2021-01-01&to=2021-04-01&limit=100
+type searchHandler struct{}
+
+func (h *searchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	q := store.SearchQuery{
+		Domain:   params.Get("domain"),
+		Selector: params.Get("selector"),
+		ReportID: params.Get("report_id"),
+		OrgName:  params.Get("org"),
+	}
+
+	var err error
+	if v := params.Get("ip"); v != "" {
+		if q.Source, err = store.ParseSource(v); err != nil {
+			writeError(w, http.StatusBadRequest, "ip: "+err.Error())
+			return
+		}
+	}
+	if v := params.Get("from"); v != "" {
+		if q.From, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if q.To, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "to: "+err.Error())
+			return
+		}
+	}
+	limit := searchLimit
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "limit: want a positive number")
+			return
+		}
+	}
+
+	reports, err := requestTenant(r).store.Search(r.Context(), q)
+	if err != nil {
+		slog.Error("Failed to search reports", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+
+	resp := searchResponse{Records: []dmark.FlatRecord{}}
+	for _, report := range reports {
+		resp.Records = append(resp.Records, dmark.Flatten(report)...)
+	}
+	if len(resp.Records) > limit {
+		resp.Records, resp.Truncated = resp.Records[:limit], true
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// maxTagSize limits the body of POST /tags.
+const maxTagSize = 64 << 10
+
+// tagsHandler manages tags of sources, see store.Tag:
+// GET /tags lists them, of a source only with ?ip=203.0.113.7,
+// POST /tags adds the tag in the JSON body and DELETE /tags/<id> removes one.
+// Changing tags needs the tag scope besides read, see canTag.
+type tagsHandler struct{}
+
+func (h *tagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/tags"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.list(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		h.add(w, r)
+	case id != "" && r.Method == http.MethodDelete:
+		h.remove(w, r, id)
+	case id == "":
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		w.Header().Set("Allow", http.MethodDelete)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *tagsHandler) list(w http.ResponseWriter, r *http.Request) {
+	tags, err := requestTenant(r).store.Tags()
+	if err != nil {
+		slog.Error("Failed to read tags", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read tags")
+		return
+	}
+
+	if v := r.URL.Query().Get("ip"); v != "" {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			writeError(w, http.StatusBadRequest, "invalid IP address "+v)
+			return
+		}
+		tags = store.TagsOf(tags, ip)
+	}
+
+	writeJSON(w, http.StatusOK, tags)
+}
+
+func (h *tagsHandler) add(w http.ResponseWriter, r *http.Request) {
+	if !canTag(r) {
+		writeError(w, http.StatusForbidden, "token needs the tag scope")
+		return
+	}
+
+	tag := store.Tag{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTagSize)).Decode(&tag); err != nil {
+		writeError(w, http.StatusBadRequest, "decode tag: "+err.Error())
+		return
+	}
+	tag.Author = requestAuthor(r)
+
+	tag, err := requestTenant(r).store.AddTag(tag)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Info("Added tag", "id", tag.ID, "source", tag.Source, "label", tag.Label, "author", tag.Author)
+
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+func (h *tagsHandler) remove(w http.ResponseWriter, r *http.Request, id string) {
+	if !canTag(r) {
+		writeError(w, http.StatusForbidden, "token needs the tag scope")
+		return
+	}
+
+	err := requestTenant(r).store.RemoveTag(id)
+	if errors.Is(err, store.ErrTagNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to remove tag", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to remove tag")
+		return
+	}
+	slog.Info("Removed tag", "id", id, "author", requestAuthor(r))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// canTag reports whether the user is an admin, or the API token has the tag scope.
+func canTag(r *http.Request) bool {
+	if u := requestUser(r); u != nil {
+		return u.Role == roleAdmin
+	}
+	token := requestToken(r)
+	return token == nil || token.Allows(store.ScopeTag)
+}
+
+// requestAuthor names who made the request: the dashboard user or the API token,
+// empty for tenant tokens.
+func requestAuthor(r *http.Request) string {
+	if u := requestUser(r); u != nil {
+		return u.Name
+	}
+	if token := requestToken(r); token != nil {
+		return token.Name
+	}
+
+	return ""
+}
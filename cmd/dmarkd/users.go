@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dashboard user roles.
+const (
+	roleViewer = "viewer" // Reads the dashboard, for its domains only when set
+	roleAdmin  = "admin"  // Reads all domains of its tenant and uploads reports
+)
+
+// user is an account of the dashboard, signing in with a password or OIDC by email.
+type user struct {
+	Name     string   `json:"-"`
+	Role     string   `json:"role"`
+	Password string   `json:"password,omitempty"` // See hashPassword; OIDC only when empty
+	Domains  []string `json:"domains,omitempty"`  // Policy domains a viewer may see, all when empty
+	Tenant   string   `json:"tenant,omitempty"`   // Required with -tenants
+
+	tenant *tenant
+}
+
+// usersConfig is the file passed with -users:
+//
+//	{
+//		"oidc": {"issuer": "https://accounts.google.com", "client_id": "…", "client_secret": "…",
+//			"redirect_url": "https://dmarc.example.com/auth/callback"},
+//		"users": {
+//			"alice@example.com": {"role": "admin"},
+//			"bob": {"role": "viewer", "password": "pbkdf2-sha256$…", "domains": ["example.com"]}
+//		}
+//	}
+type usersConfig struct {
+	OIDC  *oidcConfig      `json:"oidc"`
+	Users map[string]*user `json:"users"`
+}
+
+// loadUsers reads the users file, linking users to tenants.
+func loadUsers(path string, tenants []*tenant) (*usersConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read users: %w", err)
+	}
+
+	cfg := &usersConfig{}
+	if err = json.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("decode users: %w", err)
+	}
+
+	for name, u := range cfg.Users {
+		u.Name = name
+		if u.Role != roleViewer && u.Role != roleAdmin {
+			return nil, fmt.Errorf("user %q: role must be %s or %s", name, roleViewer, roleAdmin)
+		}
+		if u.Password == "" && cfg.OIDC == nil {
+			return nil, fmt.Errorf("user %q has no password and OIDC is not configured", name)
+		}
+
+		for _, t := range tenants {
+			if t.ID == u.Tenant {
+				u.tenant = t
+			}
+		}
+		if u.tenant == nil {
+			return nil, fmt.Errorf("user %q: unknown tenant %q", name, u.Tenant)
+		}
+	}
+
+	return cfg, nil
+}
+
+// user returns a user by name, case-insensitively, as emails are.
+func (c *usersConfig) user(name string) (*user, bool) {
+	if u, ok := c.Users[name]; ok {
+		return u, true
+	}
+	for _, u := range c.Users {
+		if strings.EqualFold(u.Name, name) {
+			return u, true
+		}
+	}
+
+	return nil, false
+}
+
+// view returns the tenant the user sees on the dashboard: its store restricted
+// to the user's domains for viewers.
+func (u *user) view() *tenant {
+	if u.Role == roleAdmin || len(u.Domains) == 0 {
+		return u.tenant
+	}
+
+	t := *u.tenant
+	t.store = t.store.Domains(u.Domains...)
+	return &t
+}
+
+// Password hashes are "pbkdf2-sha256$<iterations>$<salt>$<key>" with base64 salt and key.
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+)
+
+// hashPassword returns a hash of the password for the users file.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+
+	key := pbkdf2([]byte(password), salt, passwordIterations, sha256.Size)
+	return fmt.Sprintf(
+		"%s$%d$%s$%s",
+		passwordScheme,
+		passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// checkPassword reports whether the password matches a hash of hashPassword.
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(pbkdf2([]byte(password), salt, iterations, len(key)), key) == 1
+}
+
+// pbkdf2 derives a key with PBKDF2-HMAC-SHA256 (RFC 8018).
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := []byte{}
+
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+const (
+	sessionCookie = "dmarkd_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+// sessions signs and verifies session cookies, which hold a user name and expiry.
+type sessions struct {
+	key []byte
+}
+
+func (s *sessions) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *sessions) verify(value string) ([]byte, bool) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, false
+	}
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return payload, hmac.Equal(sum, mac.Sum(nil))
+}
+
+// start sets the session cookie for a user.
+func (s *sessions) start(w http.ResponseWriter, r *http.Request, name string) {
+	expires := time.Now().Add(sessionTTL)
+	payload := strconv.FormatInt(expires.Unix(), 10) + " " + name
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.sign([]byte(payload)),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// user returns the name of the signed in user.
+func (s *sessions) user(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	payload, ok := s.verify(cookie.Value)
+	if !ok {
+		return "", false
+	}
+
+	expires, name, ok := strings.Cut(string(payload), " ")
+	if !ok {
+		return "", false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", false
+	}
+
+	return name, true
+}
+
+func (s *sessions) end(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+type userKey struct{}
+
+// requireUser redirects requests without a session of a known user to the login page,
+// and passes the user and the tenant view of the user to next in the request context.
+func requireUser(users *usersConfig, s *sessions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := s.user(r)
+		var u *user
+		if ok {
+			u, ok = users.user(name)
+		}
+		if !ok {
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userKey{}, u)
+		ctx = context.WithValue(ctx, tenantKey{}, u.view())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestUser returns the user set by requireUser, nil for requests authorized by a token.
+func requestUser(r *http.Request) *user {
+	u, _ := r.Context().Value(userKey{}).(*user)
+	return u
+}
+
+// sessionKey returns the key from SESSION_KEY, or a random one,
+// invalidating sessions when the server restarts.
+func sessionKey(value string) ([]byte, bool, error) {
+	if value != "" {
+		return []byte(value), true, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, false, fmt.Errorf("generate session key: %w", err)
+	}
+
+	return key, false, nil
+}
+
+// randomString returns a random URL-safe string, for OIDC state.
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate random string: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// safeRedirect returns next when it is a path on this server, "/dashboard/" otherwise.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.ContainsAny(next, "\\\r\n") {
+		return "/dashboard/"
+	}
+
+	return next
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/fetch"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+type config struct {
+	backend  string
+	server   string
+	username string
+	password string
+	mailbox  string
+	query    string
+	tenant   string
+	clientID string
+	secret   string
+	token    string
+	delete   bool
+	insecure bool
+	outPath  string
+	timeout  time.Duration
+	dryRun   bool
+
+	oauthFlow    string
+	provider     string
+	scopes       []string
+	refreshToken string
+	tokenFile    string
+}
+
+func newFetcher(ctx context.Context, cfg config) (fetch.Fetcher, error) {
+	tokens, err := newTokenSource(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: %w", err)
+	}
+	if tokens == nil && (cfg.backend == "graph" || cfg.backend == "gmail") {
+		return nil, fmt.Errorf("%s backend requires OAuth2, set -oauth or ACCESS_TOKEN", cfg.backend)
+	}
+
+	switch cfg.backend {
+	case "imap":
+		return &fetch.IMAP{
+			Address:  cfg.server,
+			Username: cfg.username,
+			Password: cfg.password,
+			Tokens:   tokens,
+			Mailbox:  cfg.mailbox,
+			Insecure: cfg.insecure,
+			Peek:     cfg.dryRun,
+		}, nil
+	case "pop3":
+		return &fetch.POP3{
+			Address:  cfg.server,
+			Username: cfg.username,
+			Password: cfg.password,
+			Tokens:   tokens,
+			Delete:   cfg.delete && !cfg.dryRun,
+			Insecure: cfg.insecure,
+		}, nil
+	case "graph":
+		return &fetch.Graph{
+			Mailbox: cfg.username,
+			Folder:  cfg.mailbox,
+			Tokens:  tokens,
+			Peek:    cfg.dryRun,
+		}, nil
+	case "gmail":
+		return &fetch.Gmail{
+			User:   cfg.username,
+			Query:  cfg.query,
+			Tokens: tokens,
+			Peek:   cfg.dryRun,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported backend %q", cfg.backend)
+}
+
+// saveReports extracts reports from a message and saves them to dir,
+// counting them in summary. Messages without reports are skipped,
+// but still marked as processed. With dry set, reports are only logged.
+func saveReports(dir string, msg fetch.Message, dry bool, summary *logging.Summary) error {
+	files, err := dmark.ExtractReports(bytes.NewReader(msg.Raw))
+	if err != nil {
+		slog.Warn("No reports in message", "message", msg.ID, "err", err)
+		summary.Skipped++
+		return nil
+	}
+
+	for _, file := range files {
+		if _, err := dmark.ParseBytes(file.Content); err != nil {
+			slog.Warn("Invalid report", "message", msg.ID, "file", file.Name, "err", err)
+			summary.Failed++
+			continue
+		}
+
+		if dry {
+			path, exists, err := dmark.SavedFile(dir, file)
+			if err != nil {
+				return fmt.Errorf("save report from message %q: %w", msg.ID, err)
+			}
+			if exists {
+				summary.Skipped++
+				continue
+			}
+			dryrun.Log(path, file.Content)
+			summary.Parsed++
+			continue
+		}
+
+		path, saved, err := dmark.SaveFile(dir, file)
+		if err != nil {
+			return fmt.Errorf("save report from message %q: %w", msg.ID, err)
+		}
+		if !saved {
+			summary.Skipped++
+			continue
+		}
+		slog.Info("Saved report", "path", path)
+		summary.Parsed++
+	}
+
+	return nil
+}
+
+func run(ctx context.Context, cfg config) (logging.Summary, error) {
+	summary := logging.Summary{}
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	fetcher, err := newFetcher(ctx, cfg)
+	if err != nil {
+		return summary, err
+	}
+
+	if err = dryrun.MkdirAll(cfg.outPath, cfg.dryRun); err != nil {
+		return summary, fmt.Errorf("create dir %q: %w", cfg.outPath, err)
+	}
+
+	slog.Info("Fetching reports", "backend", cfg.backend)
+	err = fetcher.Fetch(ctx, func(msg fetch.Message) error {
+		if err := saveReports(cfg.outPath, msg, cfg.dryRun, &summary); err != nil {
+			return err
+		}
+		if cfg.dryRun {
+			// fetchers leave messages as they are, see newFetcher
+			if cfg.backend == "pop3" && cfg.delete {
+				slog.Info("Would delete message", "message", msg.ID)
+			} else if cfg.backend != "pop3" {
+				slog.Info("Would mark message as seen", "message", msg.ID)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		// a message being saved is saved completely, the rest is fetched next time
+		slog.Info("Interrupted")
+		return summary, nil
+	}
+
+	return summary, err
+}
+
+func main() {
+	backend := flag.String("backend", "imap", "Mailbox backend: imap, pop3, graph or gmail")
+	server := flag.String("server", "", "IMAP or POP3 server address, host:port")
+	username := flag.String("username", "", "IMAP or POP3 username, mailbox owner for graph, user for gmail")
+	mailbox := flag.String("mailbox", "", "IMAP mailbox or graph folder")
+	query := flag.String("query", "", "Gmail search query")
+	oauthFlow := flag.String("oauth", "", "OAuth2 flow: client-credentials, refresh-token or device-code; password authentication when empty")
+	provider := flag.String("provider", "microsoft", "OAuth2 provider: microsoft or google")
+	tenant := flag.String("tenant", "common", "Microsoft Entra ID tenant")
+	clientID := flag.String("client-id", "", "OAuth2 client ID, secret is read from CLIENT_SECRET environment variable")
+	scopes := flag.String("scopes", "", "Space-separated OAuth2 scopes, defaults depend on backend and provider")
+	tokenFile := flag.String("token-file", "", "File to keep the OAuth2 refresh token in between runs")
+	deleteHandled := flag.Bool("delete", false, "Delete handled messages from POP3 server")
+	insecure := flag.Bool("insecure", false, "Connect to IMAP or POP3 server without TLS")
+	outPath := flag.String("o", "./", "Path to directory to save DMARK XML reports to")
+	timeout := flag.Duration("timeout", 0, "Stop fetching after this time, no limit when 0")
+	dryRun := flag.Bool("dry-run", false, "Log the reports that would be saved and the messages that would be deleted or marked as seen, without changing either")
+	summaryJSON := logging.SummaryFlag()
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Summary{}.Exit(*summaryJSON, err)
+	}
+	slog.Info("Starting...")
+
+	cfg := config{
+		backend:  *backend,
+		server:   *server,
+		username: *username,
+		password: os.Getenv("MAILBOX_PASSWORD"),
+		mailbox:  *mailbox,
+		query:    *query,
+		tenant:   *tenant,
+		clientID: *clientID,
+		secret:   os.Getenv("CLIENT_SECRET"),
+		token:    os.Getenv("ACCESS_TOKEN"),
+		delete:   *deleteHandled,
+		insecure: *insecure,
+		outPath:  *outPath,
+		timeout:  *timeout,
+		dryRun:   *dryRun,
+
+		oauthFlow:    *oauthFlow,
+		provider:     *provider,
+		scopes:       strings.Fields(*scopes),
+		refreshToken: os.Getenv("REFRESH_TOKEN"),
+		tokenFile:    *tokenFile,
+	}
+
+	// stop between messages on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := run(ctx, cfg)
+	slog.Info("Stopped", "saved", summary.Parsed, "skipped", summary.Skipped, "failed", summary.Failed)
+	summary.Exit(*summaryJSON, err)
+}
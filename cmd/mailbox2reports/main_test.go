@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chuhlomin/dmark-go/fetch"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+const message = "From: noreply-dmarc-support@google.com\r\n" +
+	"Subject: Report domain: example.com\r\n" +
+	"Content-Type: text/xml; name=\"google.com!example.com!1700000000!1700086399.xml\"\r\n" +
+	"\r\n" +
+	"<feedback><report_metadata><org_name>google.com</org_name><report_id>1</report_id></report_metadata>" +
+	"<policy_published><domain>example.com</domain><p>none</p></policy_published></feedback>\r\n"
+
+func TestSaveReportsDryRun(t *testing.T) {
+	dir := t.TempDir()
+	msg := fetch.Message{ID: "1", Raw: []byte(message)}
+
+	summary := logging.Summary{}
+	if err := saveReports(dir, msg, true, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Parsed != 1 {
+		t.Errorf("want 1 report that would be saved, got %+v", summary)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("want no files written, got %d", len(files))
+	}
+
+	summary = logging.Summary{}
+	if err := saveReports(dir, msg, false, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "google.com!example.com!1700000000!1700086399.xml")); err != nil {
+		t.Fatal(err)
+	}
+
+	// already saved reports are skipped, as they would be without -dry-run
+	summary = logging.Summary{}
+	if err := saveReports(dir, msg, true, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Skipped != 1 || summary.Parsed != 0 {
+		t.Errorf("want the report skipped, got %+v", summary)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go/fetch"
+)
+
+// defaultScopes returns OAuth2 scopes for a backend, provider and flow.
+func defaultScopes(backend, provider, flow string) []string {
+	app := flow == "client-credentials"
+
+	switch {
+	case backend == "gmail":
+		return []string{fetch.GmailScope}
+	case backend == "graph" && app:
+		return []string{fetch.GraphScope}
+	case backend == "graph":
+		return []string{fetch.MicrosoftGraphMailScope, fetch.OfflineAccessScope}
+	case provider == "google":
+		return []string{fetch.GoogleMailScope}
+	case app:
+		return []string{fetch.MicrosoftAppMailScope}
+	case backend == "pop3":
+		return []string{fetch.MicrosoftPOPScope, fetch.OfflineAccessScope}
+	}
+
+	return []string{fetch.MicrosoftIMAPScope, fetch.OfflineAccessScope}
+}
+
+// newTokenSource returns nil when OAuth2 is not configured.
+func newTokenSource(ctx context.Context, cfg config) (fetch.TokenSource, error) {
+	if cfg.oauthFlow == "" {
+		if cfg.token != "" {
+			return fetch.StaticToken(cfg.token), nil
+		}
+		return nil, nil
+	}
+
+	var tokenURL, deviceURL string
+	switch cfg.provider {
+	case "microsoft":
+		tokenURL = fetch.MicrosoftTokenURL(cfg.tenant)
+		deviceURL = fetch.MicrosoftDeviceCodeURL(cfg.tenant)
+	case "google":
+		tokenURL = fetch.GoogleTokenURL
+		deviceURL = fetch.GoogleDeviceCodeURL
+	default:
+		return nil, fmt.Errorf("unsupported OAuth2 provider %q", cfg.provider)
+	}
+
+	scopes := cfg.scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes(cfg.backend, cfg.provider, cfg.oauthFlow)
+	}
+
+	switch cfg.oauthFlow {
+	case "client-credentials":
+		return &fetch.ClientCredentials{
+			TokenURL:     tokenURL,
+			ClientID:     cfg.clientID,
+			ClientSecret: cfg.secret,
+			Scopes:       scopes,
+		}, nil
+
+	case "refresh-token", "device-code":
+		refreshToken := cfg.refreshToken
+		if refreshToken == "" && cfg.tokenFile != "" {
+			content, err := ioutil.ReadFile(cfg.tokenFile)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("read token file %q: %w", cfg.tokenFile, err)
+			}
+			refreshToken = strings.TrimSpace(string(content))
+		}
+
+		var source *fetch.RefreshToken
+		switch {
+		case refreshToken != "":
+			source = &fetch.RefreshToken{
+				TokenURL:     tokenURL,
+				ClientID:     cfg.clientID,
+				ClientSecret: cfg.secret,
+				RefreshToken: refreshToken,
+				Scopes:       scopes,
+			}
+		case cfg.oauthFlow == "device-code":
+			var err error
+			source, err = fetch.DeviceCode(ctx, deviceURL, tokenURL, cfg.clientID, cfg.secret, scopes, func(uri, code string) {
+				fmt.Fprintf(os.Stderr, "To sign in, open %s and enter the code %s\n", uri, code)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("device code: %w", err)
+			}
+			saveRefreshToken(cfg.tokenFile, source.RefreshToken)
+		default:
+			return nil, errors.New("refresh token is required, set REFRESH_TOKEN or -token-file")
+		}
+
+		source.OnRotate = func(refreshToken string) {
+			saveRefreshToken(cfg.tokenFile, refreshToken)
+		}
+
+		return source, nil
+	}
+
+	return nil, fmt.Errorf("unsupported OAuth2 flow %q", cfg.oauthFlow)
+}
+
+func saveRefreshToken(path, refreshToken string) {
+	if path == "" || refreshToken == "" {
+		return
+	}
+
+	if err := ioutil.WriteFile(path, []byte(refreshToken+"\n"), 0600); err != nil {
+		slog.Error("Failed to save refresh token", "path", path, "err", err)
+	}
+}
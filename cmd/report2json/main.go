@@ -1,31 +1,126 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
 
 	"github.com/chuhlomin/dmark-go"
-	"github.com/pkg/errors"
+	"github.com/chuhlomin/dmark-go/convert"
+	"github.com/chuhlomin/dmark-go/dnsbl"
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/yaml"
 )
 
-func run() error {
-	content, err := ioutil.ReadAll(os.Stdin)
+// explainedFeedback shadows Feedback records to add their explanations
+// and blocklist status.
+type explainedFeedback struct {
+	*dmark.Feedback
+	Records []explainedRecord `json:"record"`
+}
+
+type explainedRecord struct {
+	dmark.Record
+	Explanation string        `json:"explanation,omitempty"`
+	Forwarded   string        `json:"forwarded,omitempty"` // Why the record is likely forwarded mail, see dmark.ForwardingDetector
+	DNSBL       *dnsbl.Result `json:"dnsbl,omitempty"`     // Only for records failing DMARC
+}
+
+func explain(feedback *dmark.Feedback, withExplanations bool, checker *dnsbl.Checker) explainedFeedback {
+	result := explainedFeedback{Feedback: feedback, Records: []explainedRecord{}}
+	for _, record := range feedback.Records {
+		explained := explainedRecord{Record: record}
+		if withExplanations {
+			explained.Explanation = record.Explain(feedback.PolicyPublished)
+			explained.Forwarded, _ = (&dmark.ForwardingDetector{}).Forwarded(record, feedback.PolicyPublished)
+		}
+
+		evaluated := record.Row.PolicyEvaluated
+		if checker != nil && !evaluated.DKIM && !evaluated.SPF && record.Row.SourceIP != nil {
+			status := checker.Check(context.Background(), record.Row.SourceIP)
+			explained.DNSBL = &status
+		}
+
+		result.Records = append(result.Records, explained)
+	}
+
+	return result
+}
+
+type config struct {
+	path             string // Report file, stdin when empty
+	anonymize        bool
+	salt             string
+	withExplanations bool
+	withOrigin       bool
+	checker          *dnsbl.Checker
+	format           string
+	numeric          bool // Encode enums as numbers in JSON, see dmark.JSONOptions
+	where            *filter.Filter
+	order            []dmark.RecordOrder // Sort records when set
+	validate         bool                // Check JSON output against dmark.JSONSchema
+}
+
+func run(cfg config) error {
+	parser := &dmark.Parser{TrackOrigin: cfg.withOrigin}
+	var feedback *dmark.Feedback
+	var err error
+	if cfg.path != "" {
+		feedback, err = parser.ParseFile(cfg.path)
+	} else if feedback, err = parser.Parse(os.Stdin); err != nil {
+		err = fmt.Errorf("parse stdin: %w", err)
+	}
 	if err != nil {
-		return errors.Wrap(err, "read stdin")
+		return err
+	}
+
+	if cfg.where != nil {
+		cfg.where.Apply(feedback)
+	}
+
+	if cfg.order != nil {
+		dmark.SortRecords(feedback.Records, cfg.order...)
+	}
+
+	if cfg.anonymize {
+		dmark.Anonymize(feedback, dmark.AnonymizeOptions{Salt: cfg.salt})
 	}
 
-	feedback := dmark.Feedback{}
-	if err = xml.Unmarshal([]byte(content), &feedback); err != nil {
-		return errors.Wrap(err, "xml unmarshal")
+	var v interface{} = feedback
+	if cfg.withExplanations || cfg.checker != nil {
+		v = explain(feedback, cfg.withExplanations, cfg.checker)
 	}
 
-	result, err := json.Marshal(feedback)
+	var result []byte
+	switch cfg.format {
+	case "json":
+		result, err = dmark.JSONOptions{NumericEnums: cfg.numeric}.Marshal(v)
+	case "yaml":
+		result, err = yaml.Marshal(v)
+	case "csv":
+		// a row per record, see dmark.FlatRecord
+		result, err = flatCSV(feedback)
+	case "parsedmarc":
+		// explanations have no place in the parsedmarc schema
+		result, err = json.Marshal(convert.Parsedmarc(feedback))
+	default:
+		return fmt.Errorf("unsupported format %q", cfg.format)
+	}
 	if err != nil {
-		return errors.Wrap(err, "json marshal")
+		return fmt.Errorf("%s marshal: %w", cfg.format, err)
+	}
+
+	if cfg.validate {
+		if err = dmark.ValidateJSON(result); err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
 	}
 
 	fmt.Print(string(result))
@@ -33,8 +128,100 @@ func run() error {
 	return nil
 }
 
+// flatCSV returns a CSV header and a row per record.
+func flatCSV(feedback *dmark.Feedback) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(dmark.FlatColumns); err != nil {
+		return nil, err
+	}
+	for _, record := range dmark.Flatten(*feedback) {
+		if err := w.Write(record.Strings()); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// parseOrder parses the -sort flag, "default" meaning dmark.DefaultRecordOrder.
+func parseOrder(spec string) ([]dmark.RecordOrder, error) {
+	if spec == "default" {
+		return []dmark.RecordOrder{}, nil
+	}
+
+	return dmark.ParseRecordOrder(spec)
+}
+
 func main() {
-	if err := run(); err != nil {
-		log.Fatalf("ERROR: %v", err)
+	anonymize := flag.Bool("anonymize", false, "Mask source IPs, hash envelope domains and strip comments")
+	salt := flag.String("salt", "", "Salt for hashing envelope domains with -anonymize")
+	withExplanations := flag.Bool("explain", false, "Add a human-readable explanation to each record")
+	format := flag.String("format", "json", "Output format: json, yaml, csv (a row per record, see dmark.FlatRecord) or parsedmarc, the schema of parsedmarc JSON output")
+	lists := flag.String("dnsbl", "", `Check source IPs of records failing DMARC against comma-separated DNS blocklists, "default" for common ones`)
+	whereExpr := flag.String("where", "", `Keep only records matching an expression, e.g. 'policy_evaluated.dkim == "fail" && row.count > 10'`)
+	sortSpec := flag.String("sort", "", `Sort records, e.g. "count desc,source_ip" (see dmark.ParseRecordOrder), "default" for most messages first; reporter order when empty`)
+	numeric := flag.Bool("numeric-enums", false, "Encode enums as numbers and DMARC results as booleans in JSON, for consumers of old output, see dmark.JSONOptions")
+	withOrigin := flag.Bool("origin", false, "Add the origin of the report: its file name, the SHA-256 of the XML and the time it was read")
+	validate := flag.Bool("validate", false, "Check the JSON output against the JSON Schema of reports, see -schema, failing instead of writing it when it does not match")
+	printSchema := flag.Bool("schema", false, "Write the JSON Schema of the JSON output and exit, see dmark.JSONSchema")
+	logOptions := logging.Flags()
+	cli.ParseCommand(cli.New("[report.xml]", "Converts a report to JSON, YAML and other formats. Reads the report from stdin without a file."))
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	if *printSchema {
+		os.Stdout.Write(dmark.JSONSchema())
+		return
+	}
+
+	if *validate && (*format != "json" || *numeric) {
+		// the schema describes the JSON of dmark.Feedback, with enums as strings
+		logging.Fatal(errors.New("-validate works with -format json only, without -numeric-enums"))
+	}
+
+	if *anonymize && *withOrigin {
+		// the hash of the raw XML links the output back to the report
+		logging.Fatal(errors.New("-origin does not work with -anonymize"))
+	}
+
+	cfg := config{
+		path:             flag.Arg(0),
+		anonymize:        *anonymize,
+		salt:             *salt,
+		withExplanations: *withExplanations,
+		withOrigin:       *withOrigin,
+		format:           *format,
+		numeric:          *numeric,
+		validate:         *validate,
+	}
+
+	if *whereExpr != "" {
+		var err error
+		if cfg.where, err = filter.Compile(*whereExpr); err != nil {
+			logging.Fatal(err)
+		}
+	}
+
+	if *sortSpec != "" {
+		var err error
+		if cfg.order, err = parseOrder(*sortSpec); err != nil {
+			logging.Fatal(err)
+		}
+	}
+
+	if *lists != "" {
+		if *anonymize {
+			// masked IPs are meaningless to blocklists
+			logging.Fatal(errors.New("-dnsbl does not work with -anonymize"))
+		}
+		cfg.checker = &dnsbl.Checker{Lists: dnsbl.ParseLists(*lists)}
+	}
+
+	if err := run(cfg); err != nil {
+		logging.Fatal(err)
 	}
 }
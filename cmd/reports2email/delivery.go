@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/i18n"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// delivery is a digest of some domains, or of a tenant, sent to its own
+// recipients on its own schedule, e.g. to each client of an MSP.
+// Deliveries are read from the -deliveries file, see loadDeliveries;
+// the flags make a single delivery otherwise.
+type delivery struct {
+	Name     string   `json:"name"`
+	Domains  []string `json:"domains"`  // Policy domains, with their subdomains; all domains when empty
+	Tenant   string   `json:"tenant"`   // Reports of the tenant of the store in -r instead, see store.Store.Tenant
+	To       []string `json:"to"`       // Recipient addresses
+	Subject  string   `json:"subject"`  // -subject when empty
+	Every    string   `json:"every"`    // Interval, e.g. "24h"; or
+	Cron     string   `json:"cron"`     // Crontab expression, e.g. "0 9 * * mon", see schedule.ParseCron
+	Days     int      `json:"days"`     // -days when zero
+	Lang     string   `json:"lang"`     // -lang when empty
+	Template string   `json:"template"` // -t when empty
+	TZ       string   `json:"tz"`       // -tz when empty; also the time zone of cron
+	PDF      bool     `json:"pdf"`      // Attach the digest as a PDF document, -pdf when false
+
+	location *time.Location
+	template *template.Template
+}
+
+// loadDeliveries reads deliveries from a JSON file, {"deliveries": [{"name": ..., "to": [...], "cron": ...}]},
+// filling in settings they leave out from the flags in cfg.
+func loadDeliveries(path string, cfg config) ([]delivery, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read deliveries: %w", err)
+	}
+
+	file := struct {
+		Deliveries []delivery `json:"deliveries"`
+	}{}
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("decode deliveries: %w", err)
+	}
+
+	names := map[string]bool{}
+	for i := range file.Deliveries {
+		d := &file.Deliveries[i]
+		if d.Name == "" {
+			return nil, fmt.Errorf("delivery %d has no name", i+1)
+		}
+		if names[d.Name] {
+			return nil, fmt.Errorf("duplicate delivery %q", d.Name)
+		}
+		names[d.Name] = true
+
+		if err = d.init(cfg); err != nil {
+			return nil, fmt.Errorf("delivery %q: %w", d.Name, err)
+		}
+	}
+
+	return file.Deliveries, nil
+}
+
+// init fills in settings from cfg, then loads the template and time zone.
+func (d *delivery) init(cfg config) error {
+	if d.Tenant != "" && len(d.Domains) > 0 {
+		return errors.New("both tenant and domains are set")
+	}
+	for i, domain := range d.Domains {
+		d.Domains[i] = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	}
+
+	if d.Subject == "" {
+		d.Subject = cfg.mail.subject
+	}
+	if d.Days == 0 {
+		d.Days = cfg.days
+	}
+	if d.Days < 0 {
+		return fmt.Errorf("invalid days %d", d.Days)
+	}
+	if d.Lang == "" {
+		d.Lang = cfg.lang
+	}
+	if d.Template == "" {
+		d.Template = cfg.templatePath
+	}
+	d.PDF = d.PDF || cfg.pdf
+
+	d.location = cfg.location
+	if d.TZ != "" {
+		var err error
+		if d.location, err = time.LoadLocation(d.TZ); err != nil {
+			return fmt.Errorf("time zone: %w", err)
+		}
+	}
+
+	locale, err := i18n.Lookup(d.Lang)
+	if err != nil {
+		return err
+	}
+	if d.template, err = loadTemplate(d.Template, locale); err != nil {
+		return fmt.Errorf("load template: %w", err)
+	}
+
+	return nil
+}
+
+// reports reads reports of the delivery, with changes of its domains:
+// from the tenant store, or from reportsPath and changesPath.
+func (d *delivery) reports(ctx context.Context, reportsPath, changesPath string) ([]dmark.Feedback, []store.Change, error) {
+	if d.Tenant != "" {
+		s, err := store.Open(reportsPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer s.Close()
+
+		tenant, err := s.Tenant(d.Tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer tenant.Close()
+
+		reports, err := tenant.Reports(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read reports of tenant %q: %w", d.Tenant, err)
+		}
+		changes, err := tenant.Changes()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return reports, changes, nil
+	}
+
+	reports, err := logging.ParseDir(reportsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read reports: %w", err)
+	}
+	changes := []store.Change{}
+	if changesPath != "" {
+		if changes, err = store.LoadChanges(changesPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(d.Domains) == 0 {
+		return reports, changes, nil
+	}
+
+	kept := []dmark.Feedback{}
+	for _, report := range reports {
+		if d.covers(report.PolicyPublished.Domain) {
+			kept = append(kept, report)
+		}
+	}
+	keptChanges := []store.Change{}
+	for _, change := range changes {
+		if change.Domain == "" || d.covers(change.Domain) {
+			keptChanges = append(keptChanges, change)
+			continue
+		}
+		for _, domain := range d.Domains {
+			if change.Applies(domain) {
+				keptChanges = append(keptChanges, change)
+				break
+			}
+		}
+	}
+
+	return kept, keptChanges, nil
+}
+
+// covers reports whether the domain is one of the domains of the delivery, or their subdomain.
+func (d *delivery) covers(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, parent := range d.Domains {
+		if domain == parent || strings.HasSuffix(domain, "."+parent) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// attachment is a file attached to the digest, like its PDF version.
+type attachment struct {
+	name        string
+	contentType string
+	content     []byte
+}
+
+type mailConfig struct {
+	server   string
+	username string
+	password string
+	from     string
+	to       []string
+	subject  string
+	insecure bool // Allow plain text connections when the server does not support STARTTLS
+}
+
+// sendMail sends an HTML message with attachments, upgrading the connection
+// with STARTTLS and authenticating when a username is set.
+func sendMail(cfg mailConfig, html []byte, attachments ...attachment) error {
+	if cfg.from == "" || len(cfg.to) == 0 {
+		return errors.New("sender and recipients are required")
+	}
+
+	host, _, err := net.SplitHostPort(cfg.server)
+	if err != nil {
+		return fmt.Errorf("parse server address %q: %w", cfg.server, err)
+	}
+
+	client, err := smtp.Dial(cfg.server)
+	if err != nil {
+		return fmt.Errorf("dial %q: %w", cfg.server, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	} else if !cfg.insecure {
+		return fmt.Errorf("server %q does not support STARTTLS", cfg.server)
+	}
+
+	if cfg.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", cfg.username, cfg.password, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err = client.Mail(cfg.from); err != nil {
+		return fmt.Errorf("mail from %q: %w", cfg.from, err)
+	}
+	for _, to := range cfg.to {
+		if err = client.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt to %q: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err = w.Write(composeMessage(cfg, html, attachments...)); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("close data: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// composeMessage returns the HTML message, in a multipart/mixed one
+// with the attachments when there are any.
+func composeMessage(cfg mailConfig, html []byte, attachments ...attachment) []byte {
+	msg := bytes.Buffer{}
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", cfg.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		msg.WriteString("\r\n")
+		writeQuotedPrintable(&msg, html)
+		return msg.Bytes()
+	}
+
+	// writing to bytes.Buffer does not fail
+	mw := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	writeQuotedPrintable(part, html)
+
+	for _, a := range attachments {
+		part, _ = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.name})},
+		})
+		writeBase64(part, a.content)
+	}
+	_ = mw.Close()
+
+	return msg.Bytes()
+}
+
+func writeQuotedPrintable(w io.Writer, content []byte) {
+	qw := quotedprintable.NewWriter(w)
+	_, _ = qw.Write(content)
+	_ = qw.Close()
+}
+
+// writeBase64 writes content in base64 lines of 76 characters (RFC 2045 Section 6.8).
+func writeBase64(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		fmt.Fprintf(w, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(w, "%s\r\n", encoded)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/i18n"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/schedule"
+	"github.com/chuhlomin/dmark-go/store"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
+)
+
+// digest is the data passed to the template.
+type digest struct {
+	Days       int
+	Since      time.Time
+	Until      time.Time
+	Summary    dmark.Summary
+	Trend      []trendDay
+	Changes    []store.Change        // Changes made since Since, see store.Change
+	TopFailing []dmark.SourceSummary // Sources with failing messages, most failing first
+	NewSenders []dmark.SourceSummary // Sources not seen in reports before Since
+}
+
+// trendDay is a day of the trend with changes made on it, see store.Change.
+type trendDay struct {
+	dmark.DayCounts
+	Changes []store.Change
+}
+
+// newDigest builds the digest of reports of the last days,
+// with the trend by day in loc, or by the UTC day reports begin when nil,
+// and changes on those days.
+func newDigest(reports []dmark.Feedback, changes []store.Change, now time.Time, days, top int, loc *time.Location) digest {
+	since := now.Add(-time.Duration(days) * 24 * time.Hour)
+
+	recent := []dmark.Feedback{}
+	previous := []dmark.Feedback{}
+	for _, report := range reports {
+		if int64(report.ReportMetadata.DateRange.End) >= since.Unix() {
+			recent = append(recent, report)
+		} else {
+			previous = append(previous, report)
+		}
+	}
+
+	known := map[string]bool{}
+	for _, source := range dmark.Sources(previous) {
+		known[source.SourceIP.String()] = true
+	}
+
+	d := digest{
+		Days:    days,
+		Since:   since,
+		Until:   now,
+		Summary: dmark.Summarize(recent),
+	}
+	trend := dmark.DailyCounts(recent)
+	if loc != nil {
+		trend = dmark.DailyCountsIn(recent, loc)
+	}
+	for _, change := range changes {
+		if !change.Date.Before(since.Truncate(24*time.Hour)) && !change.Date.After(now) {
+			d.Changes = append(d.Changes, change)
+		}
+	}
+	for _, day := range trend {
+		t := trendDay{DayCounts: day}
+		for _, change := range changes {
+			if change.Date.Format("2006-01-02") == day.Day.Format("2006-01-02") {
+				t.Changes = append(t.Changes, change)
+			}
+		}
+		d.Trend = append(d.Trend, t)
+	}
+
+	for _, source := range dmark.Sources(recent) {
+		if source.Failed() > 0 && len(d.TopFailing) < top {
+			d.TopFailing = append(d.TopFailing, source)
+		}
+		if !known[source.SourceIP.String()] {
+			d.NewSenders = append(d.NewSenders, source)
+		}
+	}
+
+	return d
+}
+
+// loadTemplate parses the digest template, the built-in one when templatePath
+// is empty, with text of the built-in one translated to the language of locale.
+func loadTemplate(templatePath string, locale *i18n.Locale) (*template.Template, error) {
+	t := template.New("digest").Funcs(templatefuncs.LocalizedFuncMap(locale))
+
+	if templatePath == "" {
+		return t.Parse(defaultTemplate)
+	}
+
+	t, err := t.ParseFiles(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("template parse %q: %w", templatePath, err)
+	}
+
+	return t.Lookup(filepath.Base(templatePath)), nil
+}
+
+type config struct {
+	reportsPath  string
+	templatePath string
+	days         int
+	top          int
+	outPath      string // A file, or a directory of <name>.html files with -deliveries
+	location     *time.Location
+	lang         string
+	changes      string // changes.json of a store, see store.Change
+	pdf          bool   // Attach the digest as a PDF document
+	deliveries   string // JSON file of deliveries, see loadDeliveries
+	only         string // Name of the only delivery to send
+	now          bool   // Send deliveries once instead of on their schedules
+	mail         mailConfig
+	dryRun       bool
+}
+
+func run(ctx context.Context, cfg config) error {
+	if cfg.deliveries == "" {
+		d := delivery{Name: "digest", To: cfg.mail.to}
+		if err := d.init(cfg); err != nil {
+			return err
+		}
+		return send(ctx, cfg, d, cfg.outPath)
+	}
+
+	deliveries, err := loadDeliveries(cfg.deliveries, cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.only != "" {
+		selected := []delivery{}
+		for _, d := range deliveries {
+			if d.Name == cfg.only {
+				selected = append(selected, d)
+			}
+		}
+		if len(selected) == 0 {
+			return fmt.Errorf("no delivery %q in %s", cfg.only, cfg.deliveries)
+		}
+		deliveries = selected
+	}
+
+	if cfg.now {
+		failed := 0
+		for _, d := range deliveries {
+			if err = send(ctx, cfg, d, deliveryPath(cfg.outPath, d)); err != nil {
+				slog.Error("Failed to deliver digest", "delivery", d.Name, "err", err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d deliveries failed", failed, len(deliveries))
+		}
+		return nil
+	}
+
+	// each delivery runs on its own, for cron in its time zone
+	wg := sync.WaitGroup{}
+	for _, d := range deliveries {
+		d := d
+		job, err := schedule.FuncJob(d.Name, d.Every, d.Cron, "", func(ctx context.Context) error {
+			return send(ctx, cfg, d, deliveryPath(cfg.outPath, d))
+		})
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			schedule.Run(ctx, []schedule.Job{job}, d.location)
+		}()
+	}
+	slog.Info("Scheduled deliveries", "count", len(deliveries))
+	wg.Wait()
+
+	return nil
+}
+
+// deliveryPath is the file in the -o directory the digest of the delivery is written to.
+func deliveryPath(outPath string, d delivery) string {
+	if outPath == "" {
+		return ""
+	}
+	return filepath.Join(outPath, d.Name+".html")
+}
+
+// send builds the digest of the delivery and mails it, or writes it to outPath
+// when set, with the PDF version next to it.
+func send(ctx context.Context, cfg config, d delivery, outPath string) error {
+	slog.Info("Loading reports", "delivery", d.Name, "path", cfg.reportsPath)
+	reports, changes, err := d.reports(ctx, cfg.reportsPath, cfg.changes)
+	if err != nil {
+		return err
+	}
+
+	dg := newDigest(reports, changes, time.Now(), d.Days, cfg.top, d.location)
+	body := bytes.Buffer{}
+	if err = d.template.Execute(&body, dg); err != nil {
+		return fmt.Errorf("template execute: %w", err)
+	}
+	attachments := []attachment{}
+	if d.PDF {
+		attachments = append(attachments, attachment{
+			name:        "dmarc-digest-" + dg.Until.Format("2006-01-02") + ".pdf",
+			contentType: "application/pdf",
+			content:     renderPDF(dg),
+		})
+	}
+
+	if outPath != "" {
+		files := map[string][]byte{outPath: body.Bytes()}
+		for _, a := range attachments {
+			files[strings.TrimSuffix(outPath, filepath.Ext(outPath))+".pdf"] = a.content
+		}
+		for path, content := range files {
+			if cfg.dryRun {
+				dryrun.Log(path, content)
+				continue
+			}
+			slog.Info("Writing digest", "delivery", d.Name, "path", path)
+			if err = ioutil.WriteFile(path, content, 0644); err != nil {
+				return fmt.Errorf("write file %q: %w", path, err)
+			}
+		}
+		return nil
+	}
+
+	mail := cfg.mail
+	mail.to, mail.subject = d.To, d.Subject
+	if cfg.dryRun {
+		slog.Info("Would send digest", "delivery", d.Name, "to", mail.to, "server", mail.server, "subject", mail.subject, "bytes", body.Len(), "attachments", len(attachments))
+		return nil
+	}
+
+	slog.Info("Sending digest", "delivery", d.Name, "to", mail.to, "server", mail.server)
+	if err = sendMail(mail, body.Bytes(), attachments...); err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+
+	return nil
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports, or the store with tenants of -deliveries")
+	templatePath := flag.String("t", "", "Path to digest template file, built-in template when empty")
+	days := flag.Int("days", 7, "Number of days to include in the digest")
+	top := flag.Int("top", 10, "Number of top failing sources to list")
+	outPath := flag.String("o", "", "Write digest HTML to a file instead of sending it; a directory of <name>.html files with -deliveries")
+	tz := flag.String("tz", "", `Time zone of trend days, e.g. "Europe/Berlin", splitting reports spanning days; by the UTC day reports begin when empty`)
+	lang := flag.String("lang", "en", "Language of the built-in template: "+strings.Join(i18n.Languages(), ", "))
+	server := flag.String("smtp", "localhost:587", "SMTP server address, host:port")
+	username := flag.String("username", "", "SMTP username, password is read from SMTP_PASSWORD environment variable")
+	from := flag.String("from", "", "Sender address")
+	to := flag.String("to", "", "Comma-separated recipient addresses")
+	subject := flag.String("subject", "DMARC digest", "Email subject")
+	insecure := flag.Bool("insecure", false, "Allow sending without STARTTLS")
+	changes := flag.String("changes", "", "Path to changes.json of a store, to show DNS changes on trend days, see dmark-change")
+	attachPDF := flag.Bool("pdf", false, "Attach the digest as a PDF document, written next to the -o file")
+	deliveries := flag.String("deliveries", "", "JSON file of digests of domains or tenants with their own recipients, schedules, languages and templates; runs until interrupted, sending each when due")
+	only := flag.String("delivery", "", "Name of the only delivery of -deliveries to send")
+	now := flag.Bool("now", false, "Send deliveries of -deliveries once and exit, instead of on their schedules")
+	dryRun := flag.Bool("dry-run", false, "Log the digest that would be sent, or how the -o file would change, without sending or writing it")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Starting...")
+
+	cfg := config{
+		reportsPath:  *reportsPath,
+		templatePath: *templatePath,
+		days:         *days,
+		top:          *top,
+		outPath:      *outPath,
+		lang:         *lang,
+		changes:      *changes,
+		pdf:          *attachPDF,
+		deliveries:   *deliveries,
+		only:         *only,
+		now:          *now,
+		dryRun:       *dryRun,
+		mail: mailConfig{
+			server:   *server,
+			username: *username,
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     *from,
+			subject:  *subject,
+			insecure: *insecure,
+		},
+	}
+	if *tz != "" {
+		var err error
+		if cfg.location, err = time.LoadLocation(*tz); err != nil {
+			logging.Fatal(fmt.Errorf("time zone: %w", err))
+		}
+	}
+	if *to != "" {
+		cfg.mail.to = strings.Split(*to, ",")
+	}
+
+	// a delivery being sent finishes on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Stopped")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chuhlomin/dmark-go/internal/pdf"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
+)
+
+// x positions of table columns
+var (
+	domainColumns = []float64{pdf.Margin, 300, 380, 460}
+	dayColumns    = []float64{pdf.Margin, 140, 220, 300}
+	sourceColumns = []float64{pdf.Margin, 300, 380}
+)
+
+// renderPDF writes the digest as a PDF document, in English: the standard
+// PDF fonts have no glyphs for most other scripts.
+func renderPDF(d digest) []byte {
+	doc := &pdf.Document{}
+
+	doc.Line(20)
+	doc.Text(pdf.Margin, 16, true, 0, "DMARC digest")
+	doc.Line(16)
+	doc.Text(pdf.Margin, 10, false, 0, fmt.Sprintf(
+		"%s - %s: %d reports, %d messages, %s passed DMARC, %d quarantined, %d rejected",
+		d.Since.Format("2006-01-02"),
+		d.Until.Format("2006-01-02"),
+		d.Summary.Reports,
+		d.Summary.Messages,
+		templatefuncs.Percent(d.Summary.Passed, d.Summary.Messages),
+		d.Summary.Quarantined,
+		d.Summary.Rejected,
+	))
+
+	doc.Line(28)
+	doc.Text(pdf.Margin, 13, true, 0, "Domains")
+	table(doc, []string{"Domain", "Messages", "Passed", "Score"}, domainColumns)
+	for _, domain := range d.Summary.Domains {
+		row(doc, domainColumns, domain.Domain, fmt.Sprint(domain.Messages), templatefuncs.Percent(domain.Passed, domain.Messages), fmt.Sprint(domain.Score.Total))
+	}
+
+	doc.Line(28)
+	doc.Text(pdf.Margin, 13, true, 0, "Pass rate")
+	table(doc, []string{"Day", "Messages", "Passed", "Changes"}, dayColumns)
+	for _, day := range d.Trend {
+		changes := ""
+		for i, change := range day.Changes {
+			if i > 0 {
+				changes += "; "
+			}
+			changes += change.Note
+		}
+		row(doc, dayColumns, day.Day.Format("2006-01-02"), fmt.Sprint(day.Messages), templatefuncs.Percent(day.Passed, day.Messages), changes)
+	}
+
+	doc.Line(28)
+	doc.Text(pdf.Margin, 13, true, 0, "Top failing sources")
+	table(doc, []string{"Source IP", "Failed", "Messages"}, sourceColumns)
+	for _, source := range d.TopFailing {
+		row(doc, sourceColumns, source.SourceIP.String(), fmt.Sprint(source.Failed()), fmt.Sprint(source.Messages))
+	}
+
+	doc.Line(28)
+	doc.Text(pdf.Margin, 13, true, 0, "New senders")
+	table(doc, []string{"Source IP", "Messages", "Passed"}, sourceColumns)
+	for _, source := range d.NewSenders {
+		row(doc, sourceColumns, source.SourceIP.String(), fmt.Sprint(source.Messages), templatefuncs.Percent(source.Passed, source.Messages))
+	}
+
+	buf := bytes.Buffer{}
+	_, _ = doc.WriteTo(&buf) // writing to bytes.Buffer does not fail
+	return buf.Bytes()
+}
+
+// table writes a header line of columns starting at xs.
+func table(doc *pdf.Document, titles []string, xs []float64) {
+	doc.Line(16)
+	for i, title := range titles {
+		doc.Text(xs[i], 9, true, columnWidth(xs, i), title)
+	}
+}
+
+// row writes a line of values in columns starting at xs.
+func row(doc *pdf.Document, xs []float64, values ...string) {
+	doc.Line(12)
+	for i, value := range values {
+		doc.Text(xs[i], 9, false, columnWidth(xs, i), value)
+	}
+}
+
+// columnWidth is the space up to the next column, or to the right margin.
+func columnWidth(xs []float64, i int) float64 {
+	if i+1 < len(xs) {
+		return xs[i+1] - xs[i] - 5
+	}
+	return pdf.PageWidth - pdf.Margin - xs[i]
+}
@@ -0,0 +1,83 @@
+package main
+
+const defaultTemplate = `<!DOCTYPE html>
+<html lang="{{ lang }}">
+<head>
+<meta charset="utf-8">
+<style>
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.25rem 0.5rem; }
+.pass { background-color: #dfd; }
+.fail { background-color: #fdd; }
+</style>
+</head>
+<body>
+
+<h1>{{ t "DMARC digest" }}</h1>
+
+<p>
+{{ .Since.Format "2006-01-02" }} – {{ .Until.Format "2006-01-02" }}:
+{{ tn "%s reports" .Summary.Reports }},
+{{ tn "%s messages" .Summary.Messages }},
+{{ percent .Summary.Passed .Summary.Messages }} {{ t "passed DMARC" }},
+{{ tn "%s quarantined" .Summary.Quarantined }},
+{{ tn "%s rejected" .Summary.Rejected }}.
+</p>
+
+<h2>{{ t "Pass rate" }}</h2>
+<table>
+    <tr><th>{{ t "Day" }}</th><th>{{ t "Messages" }}</th><th>{{ t "Passed" }}</th><th>{{ t "Changes" }}</th></tr>
+    {{ range .Trend }}
+    <tr>
+        <td>{{ .Day.Format "2006-01-02" }}</td>
+        <td>{{ humanizeCount .Messages }}</td>
+        <td>{{ percent .Passed .Messages }}</td>
+        <td>{{ range .Changes }}{{ with .Domain }}{{ . }}: {{ end }}{{ .Note }}<br>{{ end }}</td>
+    </tr>
+    {{ end }}
+</table>
+
+{{ with .Changes }}
+<h2>{{ t "Changes" }}</h2>
+<ul>
+    {{ range . }}
+    <li>{{ .Date.Format "2006-01-02" }}{{ with .Domain }}, {{ . }}{{ end }}: {{ .Note }}</li>
+    {{ end }}
+</ul>
+{{ end }}
+
+<h2>{{ t "Top failing sources" }}</h2>
+{{ if .TopFailing }}
+<table>
+    <tr><th>{{ t "Source IP" }}</th><th>{{ t "Failed" }}</th><th>{{ t "Messages" }}</th></tr>
+    {{ range .TopFailing }}
+    <tr>
+        <td>{{ .SourceIP }}</td>
+        <td class="fail">{{ humanizeCount .Failed }}</td>
+        <td>{{ humanizeCount .Messages }}</td>
+    </tr>
+    {{ end }}
+</table>
+{{ else }}
+<p>{{ t "No failing sources." }}</p>
+{{ end }}
+
+<h2>{{ t "New senders" }}</h2>
+{{ if .NewSenders }}
+<table>
+    <tr><th>{{ t "Source IP" }}</th><th>{{ t "Messages" }}</th><th>{{ t "Passed" }}</th></tr>
+    {{ range .NewSenders }}
+    <tr>
+        <td>{{ .SourceIP }}</td>
+        <td>{{ humanizeCount .Messages }}</td>
+        <td>{{ percent .Passed .Messages }}</td>
+    </tr>
+    {{ end }}
+</table>
+{{ else }}
+<p>{{ t "No new senders." }}</p>
+{{ end }}
+
+</body>
+</html>
+`
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+)
+
+// renderJSON writes the summary as indented JSON, for comparing domains
+// and receivers in other tools.
+func renderJSON(filePath string, summary dmark.Summary, dryRun bool) error {
+	file, err := dryrun.Create(filePath, dryRun)
+	if err != nil {
+		return fmt.Errorf("open file %q: %w", filePath, err)
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(summary); err != nil {
+		if err2 := file.Close(); err2 != nil {
+			slog.Error("Failed to close file", "path", filePath, "err", err2)
+		}
+		return fmt.Errorf("encode summary: %w", err)
+	}
+
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("close file %q: %w", filePath, err)
+	}
+
+	return nil
+}
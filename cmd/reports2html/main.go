@@ -1,118 +1,283 @@
 package main
 
 import (
-	"encoding"
-	"encoding/xml"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"plugin"
 	"strings"
 
 	"github.com/chuhlomin/dmark-go"
-	"github.com/pkg/errors"
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/i18n"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
 )
 
-func loadTemplate(templatePath string) (*template.Template, error) {
-	t, err := template.New("template.html").
-		Funcs(template.FuncMap{
-			"string": func(val encoding.TextMarshaler) string {
-				text, err := val.MarshalText()
-				if err != nil {
-					log.Printf("ERROR marshal text: %v", err)
-					return ""
-				}
-				return string(text)
-			},
-		}).
-		ParseFiles(templatePath)
+// layoutName is the template executed when -t points to a directory.
+const layoutName = "layout.html"
+
+// loadTemplate parses a single template file, or all *.html files in a directory,
+// where layout.html is the entry point and other files are partials
+// referenced by their file names, e.g. {{ template "records.html" . }}.
+func loadTemplate(templatePath string, funcs template.FuncMap) (*template.Template, error) {
+	info, err := os.Stat(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("stat %q: %w", templatePath, err)
+	}
+
+	if !info.IsDir() {
+		t, err := template.New(filepath.Base(templatePath)).
+			Funcs(funcs).
+			ParseFiles(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("template parse %q: %w", templatePath, err)
+		}
+
+		return t, nil
+	}
+
+	t, err := template.New(layoutName).
+		Funcs(funcs).
+		ParseGlob(filepath.Join(templatePath, "*.html"))
 	if err != nil {
-		return nil, errors.Wrapf(err, "template parse %q", templatePath)
+		return nil, fmt.Errorf("template parse %q: %w", templatePath, err)
+	}
+	if t.Lookup(layoutName) == nil || t.Lookup(layoutName).Tree == nil {
+		return nil, fmt.Errorf("no %s in %q", layoutName, templatePath)
 	}
 
 	return t, nil
 }
 
-func readReports(dir string) ([]dmark.Feedback, error) {
-	files, err := ioutil.ReadDir(dir)
+// executeTemplate writes the named template to filePath, see dryrun.Create for dryRun.
+func executeTemplate(filePath string, template *template.Template, name string, data interface{}, dryRun bool) error {
+	file, err := dryrun.Create(filePath, dryRun)
 	if err != nil {
-		return nil, errors.Wrap(err, "read dir")
+		return fmt.Errorf("open file %q: %w", filePath, err)
 	}
 
-	result := []dmark.Feedback{}
-
-	for _, f := range files {
-		if !strings.HasSuffix(f.Name(), ".xml") {
-			continue
+	if err := template.ExecuteTemplate(file, name, data); err != nil {
+		if err2 := file.Close(); err2 != nil {
+			slog.Error("Failed to close file", "path", filePath, "err", err2)
 		}
+		return fmt.Errorf("template execute: %w", err)
+	}
 
-		content, err := ioutil.ReadFile(f.Name())
-		if err != nil {
-			return result, errors.Wrapf(err, "read file %q", f.Name())
-		}
-		feedback := dmark.Feedback{}
-		if err = xml.Unmarshal([]byte(content), &feedback); err != nil {
-			return result, errors.Wrapf(err, "xml unmarshal %q", f.Name())
-		}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("close file %q: %w", filePath, err)
+	}
+
+	return nil
+}
 
-		result = append(result, feedback)
+// loadPlugins opens Go plugins, which register their template functions
+// with templatefuncs.Register in init.
+func loadPlugins(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("open plugin %q: %w", path, err)
+		}
 	}
 
-	return result, nil
+	return nil
 }
 
-func executeTemplate(filePath string, template *template.Template, reports []dmark.Feedback) error {
-	file, err := os.Create(filePath)
+type config struct {
+	templatePath string
+	reportsPath  string
+	outPath      string
+	plugins      []string
+	site         bool
+	format       string
+	where        string
+	lang         string
+	maxRecords   int
+	forwarding   bool   // Exclude records likely caused by forwarding
+	forwarders   string // File of known forwarder networks
+	resolve      bool   // Look up host names of sources
+	tags         string // tags.json of a store, see store.Tag
+	trendWindow  int    // Days of trends of pass rates, see dmark.Portfolio
+	legacy       bool   // Pass templates []dmark.Feedback instead of the view
+	dryRun       bool   // Log files that would be written instead of writing them
+	order        []dmark.RecordOrder
+}
+
+func run(cfg config) error {
+	if len(cfg.plugins) > 0 {
+		slog.Info("Loading plugins", "paths", cfg.plugins)
+		if err := loadPlugins(cfg.plugins); err != nil {
+			return fmt.Errorf("load plugins: %w", err)
+		}
+	}
+
+	slog.Info("Loading reports", "path", cfg.reportsPath)
+	reports, err := logging.ParseDir(cfg.reportsPath)
 	if err != nil {
-		return errors.Wrapf(err, "open file %q", filePath)
+		return fmt.Errorf("read reports: %w", err)
 	}
 
-	if err := template.Execute(file, reports); err != nil {
-		if err2 := file.Close(); err2 != nil {
-			log.Printf("ERROR close file %q: %v", filePath, err)
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
 		}
-		return errors.Wrap(err, "template execute")
+		reports = where.Reports(reports)
 	}
 
-	if err = file.Close(); err != nil {
-		return errors.Wrapf(err, "close file %q", filePath)
+	if cfg.forwarding {
+		detector := &dmark.ForwardingDetector{}
+		if cfg.forwarders != "" {
+			if detector.Forwarders, err = dmark.LoadForwarders(cfg.forwarders); err != nil {
+				return err
+			}
+		}
+		reports = detector.Exclude(reports)
 	}
 
-	return nil
-}
+	// records are listed in the same order whatever order reporters used
+	for i := range reports {
+		dmark.SortRecords(reports[i].Records, cfg.order...)
+	}
+
+	if cfg.legacy && (cfg.format != "html" || cfg.site || cfg.maxRecords > 0) {
+		return errors.New("-legacy works with a single HTML file only, without -site and -max-records")
+	}
+
+	tags := []store.Tag{}
+	if cfg.tags != "" {
+		if tags, err = store.LoadTags(cfg.tags); err != nil {
+			return err
+		}
+	}
+
+	v := newView(reports, cfg.resolve, tags, cfg.trendWindow)
+
+	switch cfg.format {
+	case "html":
+	case "pdf":
+		slog.Info("Rendering PDF", "path", cfg.outPath)
+		if err := renderPDF(cfg.outPath, v, cfg.dryRun); err != nil {
+			return fmt.Errorf("render pdf: %w", err)
+		}
+		return nil
+	case "xlsx":
+		slog.Info("Rendering workbook", "path", cfg.outPath)
+		if err := renderXLSX(cfg.outPath, v, cfg.dryRun); err != nil {
+			return fmt.Errorf("render xlsx: %w", err)
+		}
+		return nil
+	case "json":
+		slog.Info("Writing summary", "path", cfg.outPath)
+		if err := renderJSON(cfg.outPath, v.Summary, cfg.dryRun); err != nil {
+			return fmt.Errorf("render json: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q", cfg.format)
+	}
 
-func run(templatePath, reportsPath, outPath string) error {
-	log.Printf("Loading template from %q...", templatePath)
-	template, err := loadTemplate(templatePath)
+	locale, err := i18n.Lookup(cfg.lang)
 	if err != nil {
-		return errors.Wrap(err, "read reports")
+		return err
 	}
 
-	log.Printf("Loading reports from %q...", reportsPath)
-	reports, err := readReports(reportsPath)
+	slog.Info("Loading template", "path", cfg.templatePath, "lang", locale.Lang)
+	template, err := loadTemplate(cfg.templatePath, templatefuncs.LocalizedFuncMap(locale))
 	if err != nil {
-		return errors.Wrap(err, "read reports")
+		return fmt.Errorf("load template: %w", err)
 	}
 
-	log.Printf("Rendering template to %q...", outPath)
-	if err := executeTemplate(outPath, template, reports); err != nil {
-		return errors.Wrap(err, "read reports")
+	if cfg.site {
+		slog.Info("Generating site", "path", cfg.outPath)
+		if err := generateSite(cfg.outPath, template, v, cfg.maxRecords, cfg.dryRun); err != nil {
+			return fmt.Errorf("generate site: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.maxRecords > 0 {
+		slog.Info("Writing drill-down pages", "max-records", cfg.maxRecords)
+		if err := writeDomainPages(cfg.outPath, template, &v, cfg.maxRecords, cfg.dryRun); err != nil {
+			return fmt.Errorf("write domain pages: %w", err)
+		}
+	}
+
+	var data interface{} = v
+	if cfg.legacy {
+		data = reports
+	}
+
+	slog.Info("Rendering template", "path", cfg.outPath)
+	if err := executeTemplate(cfg.outPath, template, template.Name(), data, cfg.dryRun); err != nil {
+		return fmt.Errorf("execute template: %w", err)
 	}
 
 	return nil
 }
 
 func main() {
-	log.Println("Starting...")
-
-	templatePath := flag.String("t", "./template.html", "Path to template file")
+	templatePath := flag.String("t", "./templates", "Path to template file or directory with layout.html and partials")
 	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
-	outPath := flag.String("o", "./report.html", "Path to output HTML report")
-	flag.Parse()
+	outPath := flag.String("o", "./report.html", "Path to output HTML report, or output directory with -site")
+	plugins := flag.String("plugin", "", "Comma-separated paths to Go plugins registering template functions")
+	site := flag.Bool("site", false, "Generate a multi-page site with an index, per-domain and per-month pages")
+	format := flag.String("format", "html", "Output format: html, pdf (a tabular summary), xlsx (a workbook with a sheet per domain) or json (dmark.Summary); templates are used for html only")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	lang := flag.String("lang", "en", "Language of the HTML report: "+strings.Join(i18n.Languages(), ", "))
+	maxRecords := flag.Int("max-records", 0, "Show at most this many records per domain, with drill-down pages for the rest (per month page with -site); 0 shows all")
+	excludeForwarded := flag.Bool("exclude-forwarded", false, "Leave out records likely caused by forwarding, see dmark.ForwardingDetector")
+	forwarders := flag.String("forwarders", "", "File of known forwarder IP addresses or CIDRs, one per line, for -exclude-forwarded")
+	resolve := flag.Bool("resolve", false, "Resolve sources failing DMARC to host names")
+	trendWindow := flag.Int("trend-window", 7, "Days of trends of pass rates of domains: the last days against as many days before them")
+	tags := flag.String("tags", "", "Path to tags.json of a store, to show tags of sources, see dmarkd /tags")
+	legacy := flag.Bool("legacy", false, "Pass templates the list of reports, as before templates got summaries, for old single-file templates")
+	sortSpec := flag.String("sort", "", `Order of records, e.g. "source_ip,count desc" (see dmark.ParseRecordOrder); most messages first by default`)
+	dryRun := flag.Bool("dry-run", false, "Log files that would be created or changed, with counts of changed lines, without writing them; changed lines are logged with -log-level debug")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+	slog.Info("Starting...")
+
+	cfg := config{
+		templatePath: *templatePath,
+		reportsPath:  *reportsPath,
+		outPath:      *outPath,
+		site:         *site,
+		format:       *format,
+		where:        *where,
+		lang:         *lang,
+		maxRecords:   *maxRecords,
+		forwarding:   *excludeForwarded,
+		forwarders:   *forwarders,
+		resolve:      *resolve,
+		tags:         *tags,
+		trendWindow:  *trendWindow,
+		legacy:       *legacy,
+		dryRun:       *dryRun,
+	}
+	if *sortSpec != "" {
+		var err error
+		if cfg.order, err = dmark.ParseRecordOrder(*sortSpec); err != nil {
+			logging.Fatal(err)
+		}
+	}
+	if *plugins != "" {
+		cfg.plugins = strings.Split(*plugins, ",")
+	}
 
-	if err := run(*templatePath, *reportsPath, *outPath); err != nil {
-		log.Fatalf("ERROR %v", err)
+	if err := run(cfg); err != nil {
+		logging.Fatal(err)
 	}
-	log.Println("Stopped")
+	slog.Info("Stopped")
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+)
+
+// recordPageName is the template of drill-down pages written by writeDomainPages.
+const recordPageName = "records_page.html"
+
+// pageLink links to a page of records.
+type pageLink struct {
+	Number  int
+	Href    string
+	Current bool
+}
+
+// recordPageView is the data of a drill-down page with a part of the records of a domain.
+type recordPageView struct {
+	Domain  string
+	Back    string // Link to the report the page belongs to
+	Pages   []pageLink
+	Reports []dmark.Feedback
+}
+
+// paginate splits records of reports into pages of at most size records.
+// A report spanning pages is repeated on each of them with a part of its records.
+func paginate(reports []dmark.Feedback, size int) [][]dmark.Feedback {
+	pages := [][]dmark.Feedback{}
+	page := []dmark.Feedback{}
+	n := 0
+
+	for _, report := range reports {
+		records := report.Records
+		for {
+			if n == size {
+				pages = append(pages, page)
+				page, n = []dmark.Feedback{}, 0
+			}
+
+			k := min(size-n, len(records))
+			part := report
+			part.Records = records[:k:k]
+			page = append(page, part)
+			n += k
+
+			records = records[k:]
+			if len(records) == 0 {
+				break
+			}
+		}
+	}
+
+	if len(page) > 0 {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+func countRecords(reports []dmark.Feedback) int {
+	n := 0
+	for _, report := range reports {
+		n += len(report.Records)
+	}
+
+	return n
+}
+
+// pageLinks returns links to count pages, marking page current (1-based), if any.
+func pageLinks(count, current int, href func(n int) string) []pageLink {
+	links := make([]pageLink, count)
+	for i := range links {
+		links[i] = pageLink{
+			Number:  i + 1,
+			Href:    href(i + 1),
+			Current: i+1 == current,
+		}
+	}
+
+	return links
+}
+
+// writeDomainPages limits records of each domain in v to the first maxRecords,
+// and writes all records of domains with more to drill-down pages of maxRecords each,
+// in a directory named like outPath without the extension, e.g. report/example.com-2.html.
+func writeDomainPages(outPath string, t *template.Template, v *view, maxRecords int, dryRun bool) error {
+	if t.Lookup(recordPageName) == nil {
+		return fmt.Errorf("template %s not found", recordPageName)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(outPath), filepath.Ext(outPath))
+	dir := filepath.Join(filepath.Dir(outPath), base)
+
+	for i := range v.Domains {
+		domain := &v.Domains[i]
+
+		pages := paginate(domain.Reports, maxRecords)
+		if len(pages) <= 1 {
+			continue
+		}
+
+		if err := dryrun.MkdirAll(dir, dryRun); err != nil {
+			return fmt.Errorf("create dir %q: %w", dir, err)
+		}
+
+		href := func(n int) string {
+			return fmt.Sprintf("%s-%d.html", domain.Slug, n)
+		}
+		for n, reports := range pages {
+			page := recordPageView{
+				Domain:  domain.Domain,
+				Back:    "../" + filepath.Base(outPath),
+				Pages:   pageLinks(len(pages), n+1, href),
+				Reports: reports,
+			}
+			if err := executeTemplate(filepath.Join(dir, href(n+1)), t, recordPageName, page, dryRun); err != nil {
+				return err
+			}
+		}
+
+		domain.Hidden = countRecords(domain.Reports) - countRecords(pages[0])
+		domain.Reports = pages[0]
+		domain.Pages = pageLinks(len(pages), 0, func(n int) string {
+			return base + "/" + href(n)
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+	"github.com/chuhlomin/dmark-go/internal/pdf"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
+)
+
+// recordColumns are x positions and widths of the record table columns.
+var recordColumns = []struct {
+	title string
+	x     float64
+	width float64
+}{
+	{"Source IP", pdf.Margin, 150},
+	{"Count", 195, 45},
+	{"Disposition", 245, 60},
+	{"SPF", 310, 30},
+	{"DKIM", 345, 30},
+	{"Header from", 380, pdf.PageWidth - pdf.Margin - 380},
+}
+
+// renderPDF writes a tabular summary of reports, without using templates.
+func renderPDF(filePath string, v view, dryRun bool) error {
+	doc := &pdf.Document{}
+
+	doc.Line(20)
+	doc.Text(pdf.Margin, 16, true, 0, "DMARC reports")
+	doc.Line(16)
+	doc.Text(pdf.Margin, 10, false, 0, fmt.Sprintf(
+		"%d reports from %s to %s",
+		v.Summary.Reports,
+		templatefuncs.FormatTime(v.Summary.DateRange.Begin),
+		templatefuncs.FormatTime(v.Summary.DateRange.End),
+	))
+	doc.Line(14)
+	doc.Text(pdf.Margin, 10, false, 0, fmt.Sprintf(
+		"%d messages, %s passed, %d quarantined, %d rejected",
+		v.Summary.Messages,
+		templatefuncs.Percent(v.Summary.Passed, v.Summary.Messages),
+		v.Summary.Quarantined,
+		v.Summary.Rejected,
+	))
+
+	for _, domain := range v.Domains {
+		doc.Line(28)
+		doc.Text(pdf.Margin, 13, true, 0, domain.Domain)
+		doc.Line(14)
+		doc.Text(pdf.Margin, 10, false, 0, fmt.Sprintf(
+			"p=%s sp=%s pct=%d; %d messages, %s passed; score %d/100",
+			templatefuncs.String(domain.Policy.P),
+			templatefuncs.String(domain.Policy.SP),
+			domain.Policy.Pct,
+			domain.Messages,
+			templatefuncs.Percent(domain.Passed, domain.Messages),
+			domain.Score.Total,
+		))
+
+		for _, report := range domain.Reports {
+			doc.Line(20)
+			doc.Text(pdf.Margin, 10, true, 0, fmt.Sprintf(
+				"%s, %s - %s",
+				report.ReportMetadata.OrgName,
+				templatefuncs.FormatTime(report.ReportMetadata.DateRange.Begin),
+				templatefuncs.FormatTime(report.ReportMetadata.DateRange.End),
+			))
+
+			doc.Line(14)
+			for _, column := range recordColumns {
+				doc.Text(column.x, 9, true, column.width, column.title)
+			}
+
+			for _, record := range report.Records {
+				evaluated := record.Row.PolicyEvaluated
+				values := []string{
+					record.Row.SourceIP.String(),
+					fmt.Sprintf("%d", record.Row.Count),
+					templatefuncs.String(evaluated.Disposition),
+					templatefuncs.String(evaluated.SPF),
+					templatefuncs.String(evaluated.DKIM),
+					record.Identifiers.HeaderFrom,
+				}
+
+				doc.Line(12)
+				for i, column := range recordColumns {
+					doc.Text(column.x, 9, false, column.width, values[i])
+				}
+			}
+		}
+	}
+
+	file, err := dryrun.Create(filePath, dryRun)
+	if err != nil {
+		return fmt.Errorf("open file %q: %w", filePath, err)
+	}
+
+	if _, err := doc.WriteTo(file); err != nil {
+		if err2 := file.Close(); err2 != nil {
+			slog.Error("Failed to close file", "path", filePath, "err", err2)
+		}
+		return fmt.Errorf("write pdf: %w", err)
+	}
+
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("close file %q: %w", filePath, err)
+	}
+
+	return nil
+}
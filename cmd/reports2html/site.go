@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+)
+
+// Templates used by generateSite, in addition to partials.
+const (
+	siteIndexName  = "site_index.html"
+	siteDomainName = "site_domain.html"
+	siteMonthName  = "site_month.html"
+)
+
+// generateSite writes a multi-page site to dir:
+//
+//	index.html             all domains
+//	<domain>/index.html    domain summary with links to months
+//	<domain>/<month>.html  records of the domain for the month
+//
+// With maxRecords, month pages are split into <month>.html, <month>-2.html and so on,
+// with at most maxRecords records each.
+func generateSite(dir string, t *template.Template, v view, maxRecords int, dryRun bool) error {
+	for _, name := range []string{siteIndexName, siteDomainName, siteMonthName} {
+		if t.Lookup(name) == nil {
+			return fmt.Errorf("template %s not found", name)
+		}
+	}
+
+	if err := dryrun.MkdirAll(dir, dryRun); err != nil {
+		return fmt.Errorf("create dir %q: %w", dir, err)
+	}
+
+	if err := executeTemplate(filepath.Join(dir, "index.html"), t, siteIndexName, v, dryRun); err != nil {
+		return err
+	}
+
+	for _, domain := range v.Domains {
+		domainDir := filepath.Join(dir, domain.Slug)
+		if err := dryrun.MkdirAll(domainDir, dryRun); err != nil {
+			return fmt.Errorf("create dir %q: %w", domainDir, err)
+		}
+
+		if err := executeTemplate(filepath.Join(domainDir, "index.html"), t, siteDomainName, domain, dryRun); err != nil {
+			return err
+		}
+
+		for _, month := range domain.Months {
+			if err := writeMonth(domainDir, t, month, maxRecords, dryRun); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeMonth(domainDir string, t *template.Template, month monthView, maxRecords int, dryRun bool) error {
+	pages := [][]dmark.Feedback{month.Reports}
+	if maxRecords > 0 {
+		pages = paginate(month.Reports, maxRecords)
+	}
+
+	href := func(n int) string {
+		if n == 1 {
+			return month.Month + ".html"
+		}
+		return fmt.Sprintf("%s-%d.html", month.Month, n)
+	}
+
+	for n, reports := range pages {
+		page := month
+		page.Reports = reports
+		if len(pages) > 1 {
+			page.Pages = pageLinks(len(pages), n+1, href)
+		}
+		if err := executeTemplate(filepath.Join(domainDir, href(n+1)), t, siteMonthName, page, dryRun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
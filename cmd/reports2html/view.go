@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// topSources is the number of sources listed per domain, most failing first.
+const topSources = 10
+
+// lookupTimeout bounds a single reverse DNS lookup with -resolve.
+const lookupTimeout = 5 * time.Second
+
+// view is the data passed to templates, with totals computed once,
+// unlike the bare []dmark.Feedback templates got before (see -legacy).
+type view struct {
+	Summary   dmark.Summary
+	Reports   []dmark.Feedback
+	Domains   []domainView // Sorted by domain name
+	Coverage  coverage
+	Generated time.Time
+}
+
+// coverage tells which UTC days of the date range reports cover.
+type coverage struct {
+	Days    int      // Days with at least one report
+	Missing []string // Days without reports in "2006-01-02" format, sorted
+}
+
+// sourceView is a source with what lookups told about it.
+type sourceView struct {
+	dmark.SourceSummary
+	Host string      // The first PTR name with -resolve
+	Tags []store.Tag // Tags of the source in reports of the domain, with -tags
+}
+
+type domainView struct {
+	dmark.DomainSummary
+	Slug     string // Safe to use as a file name
+	Reports  []dmark.Feedback
+	Coverage coverage
+	Top      []sourceView          // Up to topSources sources failing DMARC, most failing first
+	Trend    dmark.PortfolioDomain // The trend of the pass rate, see dmark.Portfolio
+	Months   []monthView           // Sorted by month
+	Hidden   int                   // Records not in Reports with -max-records, see Pages
+	Pages    []pageLink            // Drill-down pages with all records, when some are hidden
+}
+
+type monthView struct {
+	dmark.Counts
+	Domain  string
+	Month   string // In "2006-01" format, by the beginning of the report date range
+	Reports []dmark.Feedback
+	Pages   []pageLink // Pages of the month with -max-records, when there are several
+}
+
+// newView computes the view of reports, looking up host names of sources
+// listed per domain when resolve is set, and tagging them with tags.
+// Trends of pass rates compare the last window days against those before.
+func newView(reports []dmark.Feedback, resolve bool, tags []store.Tag, window int) view {
+	summary := dmark.Summarize(reports)
+	hosts := map[string]string{}
+	portfolio := dmark.Portfolio(reports, window) // sorted like summary.Domains
+
+	byDomain := map[string][]dmark.Feedback{}
+	for _, report := range reports {
+		domain := strings.ToLower(report.PolicyPublished.Domain)
+		byDomain[domain] = append(byDomain[domain], report)
+	}
+
+	domains := make([]domainView, 0, len(summary.Domains))
+	for i, domain := range summary.Domains {
+		domains = append(domains, domainView{
+			DomainSummary: domain,
+			Slug:          slug(domain.Domain),
+			Reports:       byDomain[domain.Domain],
+			Coverage:      newCoverage(byDomain[domain.Domain]),
+			Top:           topFailing(domain.Sources, byDomain[domain.Domain], tags, resolve, hosts),
+			Months:        newMonthViews(domain.Domain, byDomain[domain.Domain]),
+			Trend:         portfolio[i],
+		})
+	}
+
+	return view{
+		Summary:   summary,
+		Reports:   reports,
+		Domains:   domains,
+		Coverage:  newCoverage(reports),
+		Generated: time.Now().UTC(),
+	}
+}
+
+// newCoverage finds days without reports between the first and the last day reports cover.
+func newCoverage(reports []dmark.Feedback) coverage {
+	ranges, _ := dmark.NormalizeRanges(reports)
+	covered := map[string]bool{}
+	first, last := time.Time{}, time.Time{}
+	for _, r := range ranges {
+		if r == (dmark.DateRange{}) {
+			continue // within another report
+		}
+		begin := time.Unix(int64(r.Begin), 0).UTC().Truncate(24 * time.Hour)
+		end := time.Unix(int64(r.End), 0).UTC()
+		if r.End > r.Begin {
+			end = end.Add(-time.Second) // ranges usually end at midnight of the next day
+		}
+		for day := begin; !day.After(end); day = day.Add(24 * time.Hour) {
+			covered[day.Format("2006-01-02")] = true
+			if first.IsZero() || day.Before(first) {
+				first = day
+			}
+			if day.After(last) {
+				last = day
+			}
+		}
+	}
+
+	c := coverage{Days: len(covered), Missing: []string{}}
+	for day := first; !first.IsZero() && !day.After(last); day = day.Add(24 * time.Hour) {
+		if !covered[day.Format("2006-01-02")] {
+			c.Missing = append(c.Missing, day.Format("2006-01-02"))
+		}
+	}
+
+	return c
+}
+
+// topFailing returns up to topSources sources failing DMARC, sorted like dmark.Sources,
+// with their host names when resolve is set and tags matching their records in reports.
+// hosts caches lookups across domains.
+func topFailing(sources []dmark.SourceSummary, reports []dmark.Feedback, tags []store.Tag, resolve bool, hosts map[string]string) []sourceView {
+	top := []sourceView{}
+	for _, source := range sources {
+		if len(top) == topSources || source.Failed() == 0 {
+			break
+		}
+
+		sv := sourceView{SourceSummary: source}
+		if resolve {
+			host, ok := hosts[source.SourceIP.String()]
+			if !ok {
+				host = lookupHost(source.SourceIP)
+				hosts[source.SourceIP.String()] = host
+			}
+			sv.Host = host
+		}
+		sv.Tags = sourceTags(source.SourceIP, reports, tags)
+		top = append(top, sv)
+	}
+
+	return top
+}
+
+// sourceTags returns tags matching records of the source IP in reports.
+func sourceTags(ip net.IP, reports []dmark.Feedback, tags []store.Tag) []store.Tag {
+	result := []store.Tag{}
+tags:
+	for _, tag := range tags {
+		for _, report := range reports {
+			for _, record := range report.Records {
+				if record.Row.SourceIP.Equal(ip) && tag.Matches(report.ReportMetadata.ReportID, ip) {
+					result = append(result, tag)
+					continue tags
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// lookupHost returns the first PTR name of the IP address, empty when there is none.
+func lookupHost(ip net.IP) string {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(names[0], ".")
+}
+
+func newMonthViews(domain string, reports []dmark.Feedback) []monthView {
+	byMonth := map[string][]dmark.Feedback{}
+	for _, report := range reports {
+		month := time.Unix(int64(report.ReportMetadata.DateRange.Begin), 0).UTC().Format("2006-01")
+		byMonth[month] = append(byMonth[month], report)
+	}
+
+	months := make([]monthView, 0, len(byMonth))
+	for month, reports := range byMonth {
+		months = append(months, monthView{
+			Counts:  dmark.Summarize(reports).Counts,
+			Domain:  domain,
+			Month:   month,
+			Reports: reports,
+		})
+	}
+	sort.Slice(months, func(i, j int) bool {
+		return months[i].Month < months[j].Month
+	})
+
+	return months
+}
+
+// slug makes a domain name safe to use as a file name.
+func slug(domain string) string {
+	result := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, domain)
+
+	if result == "" || strings.Trim(result, ".") == "" {
+		return "_"
+	}
+
+	return result
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+	"github.com/chuhlomin/dmark-go/templatefuncs"
+)
+
+// Cell styles, indexes into cellXfs of xlsxStyles.
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStylePercent
+	xlsxStyleDate
+)
+
+// Differential formats for conditional formatting, indexes into dxfs of xlsxStyles.
+const (
+	xlsxFormatPass = iota
+	xlsxFormatFail
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="10" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+<dxfs count="2">
+<dxf><font><color rgb="FF006100"/></font><fill><patternFill><bgColor rgb="FFC6EFCE"/></patternFill></fill></dxf>
+<dxf><font><color rgb="FF9C0006"/></font><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf>
+</dxfs>
+</styleSheet>
+`
+
+// xlsxCell is a string or a number; empty strings are left out.
+type xlsxCell struct {
+	text    string
+	number  float64
+	numeric bool
+	style   int
+}
+
+func xlsxString(s string) xlsxCell {
+	return xlsxCell{text: s}
+}
+
+func xlsxNumber(n float64, style int) xlsxCell {
+	return xlsxCell{number: n, numeric: true, style: style}
+}
+
+// xlsxDate converts Unix time to an Excel serial date, days since 1899-12-30.
+func xlsxDate(epoch int) xlsxCell {
+	return xlsxNumber(float64(epoch)/86400+25569, xlsxStyleDate)
+}
+
+// xlsxRule highlights cells of a column equal to a value.
+type xlsxRule struct {
+	column int
+	value  string
+	format int
+}
+
+type xlsxSheet struct {
+	name    string
+	header  []string
+	widths  []float64 // Column widths in characters
+	rows    [][]xlsxCell
+	rules   []xlsxRule
+	filters bool // Add filter buttons to the header
+}
+
+// xlsxWorkbook is a minimal SpreadsheetML writer: inline strings, a few fixed styles,
+// a frozen header row and conditional formatting.
+type xlsxWorkbook struct {
+	sheets []*xlsxSheet
+	names  map[string]bool
+}
+
+// addSheet adds a sheet with a name made valid and unique:
+// at most 31 characters, without []:*?/\.
+func (w *xlsxWorkbook) addSheet(name string, header []string, widths []float64) *xlsxSheet {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "_"
+	}
+
+	if w.names == nil {
+		w.names = map[string]bool{}
+	}
+	unique := truncateRunes(name, 31)
+	for i := 2; w.names[strings.ToLower(unique)]; i++ {
+		suffix := "~" + strconv.Itoa(i)
+		unique = truncateRunes(name, 31-len(suffix)) + suffix
+	}
+	w.names[strings.ToLower(unique)] = true
+
+	sheet := &xlsxSheet{name: unique, header: header, widths: widths}
+	w.sheets = append(w.sheets, sheet)
+	return sheet
+}
+
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+func (w *xlsxWorkbook) WriteTo(out io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	add := func(name, content string) error {
+		f, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	const header = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	const relationship = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	const mainType = "application/vnd.openxmlformats-officedocument.spreadsheetml"
+
+	types := &strings.Builder{}
+	workbook := &strings.Builder{}
+	rels := &strings.Builder{}
+	for i := range w.sheets {
+		fmt.Fprintf(types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="%s.worksheet+xml"/>`, i+1, mainType)
+		fmt.Fprintf(workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(w.sheets[i].name), i+1, i+1)
+		fmt.Fprintf(rels, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, relationship, i+1)
+	}
+	fmt.Fprintf(rels, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, len(w.sheets)+1, relationship)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", header +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="` + mainType + `.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="` + mainType + `.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", header +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + relationship + `/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", header +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="` + relationship + `">` +
+			`<sheets>` + workbook.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", header +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range w.sheets {
+		files = append(files, struct{ name, content string }{
+			fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1),
+			header + sheet.xml(),
+		})
+	}
+
+	for _, f := range files {
+		if err := add(f.name, f.content); err != nil {
+			return 0, fmt.Errorf("add %s: %w", f.name, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return 0, err
+	}
+
+	return buf.WriteTo(out)
+}
+
+func (s *xlsxSheet) xml() string {
+	b := &strings.Builder{}
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">`)
+	b.WriteString(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	b.WriteString(`</sheetView></sheetViews>`)
+
+	if len(s.widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, width := range s.widths {
+			fmt.Fprintf(b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString(`</cols>`)
+	}
+
+	b.WriteString(`<sheetData>`)
+	header := make([]xlsxCell, len(s.header))
+	for i, title := range s.header {
+		header[i] = xlsxCell{text: title, style: xlsxStyleHeader}
+	}
+	for i, row := range append([][]xlsxCell{header}, s.rows...) {
+		fmt.Fprintf(b, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			ref := xlsxColumn(j) + strconv.Itoa(i+1)
+			style := ""
+			if cell.style != xlsxStyleDefault {
+				style = fmt.Sprintf(` s="%d"`, cell.style)
+			}
+			switch {
+			case cell.numeric:
+				fmt.Fprintf(b, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(cell.number, 'g', -1, 64))
+			case cell.text != "":
+				fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(cell.text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+
+	last := strconv.Itoa(len(s.rows) + 1)
+	if s.filters && len(s.header) > 0 {
+		fmt.Fprintf(b, `<autoFilter ref="A1:%s%s"/>`, xlsxColumn(len(s.header)-1), last)
+	}
+
+	rules := s.rules
+	if len(s.rows) == 0 {
+		rules = nil
+	}
+	for i, rule := range rules {
+		column := xlsxColumn(rule.column)
+		fmt.Fprintf(b, `<conditionalFormatting sqref="%s2:%s%s">`, column, column, last)
+		fmt.Fprintf(b, `<cfRule type="cellIs" dxfId="%d" priority="%d" operator="equal"><formula>"%s"</formula></cfRule>`,
+			rule.format, i+1, xmlEscape(strings.ReplaceAll(rule.value, `"`, `""`)))
+		b.WriteString(`</conditionalFormatting>`)
+	}
+
+	b.WriteString(`</worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn returns the column name for a zero-based index: A, B, ..., Z, AA, ...
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	b := &strings.Builder{}
+	_ = xml.EscapeText(b, []byte(s)) // writing to strings.Builder does not fail
+	return b.String()
+}
+
+// renderXLSX writes a workbook with a summary sheet and a sheet of records per domain,
+// where DMARC, SPF and DKIM results are highlighted.
+func renderXLSX(filePath string, v view, dryRun bool) error {
+	wb := &xlsxWorkbook{}
+
+	summary := wb.addSheet("Summary",
+		[]string{"Domain", "Reports", "Messages", "Passed", "Failed", "Pass rate", "Quarantined", "Rejected", "p", "sp", "pct", "Score"},
+		[]float64{30, 10, 12, 12, 12, 10, 12, 10, 12, 12, 6, 8},
+	)
+	for _, domain := range v.Domains {
+		summary.rows = append(summary.rows, []xlsxCell{
+			xlsxString(domain.Domain),
+			xlsxNumber(float64(domain.DomainSummary.Reports), xlsxStyleDefault),
+			xlsxNumber(float64(domain.Messages), xlsxStyleDefault),
+			xlsxNumber(float64(domain.Passed), xlsxStyleDefault),
+			xlsxNumber(float64(domain.Failed()), xlsxStyleDefault),
+			xlsxNumber(domain.PassRate(), xlsxStylePercent),
+			xlsxNumber(float64(domain.Quarantined), xlsxStyleDefault),
+			xlsxNumber(float64(domain.Rejected), xlsxStyleDefault),
+			xlsxString(templatefuncs.String(domain.Policy.P)),
+			xlsxString(templatefuncs.String(domain.Policy.SP)),
+			xlsxNumber(float64(domain.Policy.Pct), xlsxStyleDefault),
+			xlsxNumber(float64(domain.Score.Total), xlsxStyleDefault),
+		})
+	}
+	summary.rows = append(summary.rows, []xlsxCell{
+		{text: "Total", style: xlsxStyleHeader},
+		xlsxNumber(float64(v.Summary.Reports), xlsxStyleDefault),
+		xlsxNumber(float64(v.Summary.Messages), xlsxStyleDefault),
+		xlsxNumber(float64(v.Summary.Passed), xlsxStyleDefault),
+		xlsxNumber(float64(v.Summary.Failed()), xlsxStyleDefault),
+		xlsxNumber(v.Summary.PassRate(), xlsxStylePercent),
+		xlsxNumber(float64(v.Summary.Quarantined), xlsxStyleDefault),
+		xlsxNumber(float64(v.Summary.Rejected), xlsxStyleDefault),
+	})
+
+	for _, domain := range v.Domains {
+		sheet := wb.addSheet(domain.Domain,
+			[]string{"Reporter", "Begin", "End", "Source IP", "Count", "Disposition", "DMARC", "SPF", "DKIM", "Header from", "Envelope from"},
+			[]float64{24, 17, 17, 24, 8, 12, 8, 8, 8, 28, 28},
+		)
+		sheet.filters = true
+		for column := 6; column <= 8; column++ {
+			sheet.rules = append(sheet.rules,
+				xlsxRule{column: column, value: "pass", format: xlsxFormatPass},
+				xlsxRule{column: column, value: "fail", format: xlsxFormatFail},
+			)
+		}
+
+		for _, report := range domain.Reports {
+			for _, record := range dmark.Flatten(report) {
+				sheet.rows = append(sheet.rows, []xlsxCell{
+					xlsxString(record.OrgName),
+					xlsxDate(report.ReportMetadata.DateRange.Begin),
+					xlsxDate(report.ReportMetadata.DateRange.End),
+					xlsxString(record.SourceIP),
+					xlsxNumber(float64(record.Count), xlsxStyleDefault),
+					xlsxString(record.Disposition),
+					xlsxString(record.DMARC),
+					xlsxString(record.SPF),
+					xlsxString(record.DKIM),
+					xlsxString(record.HeaderFrom),
+					xlsxString(record.EnvelopeFrom),
+				})
+			}
+		}
+	}
+
+	file, err := dryrun.Create(filePath, dryRun)
+	if err != nil {
+		return fmt.Errorf("open file %q: %w", filePath, err)
+	}
+
+	if _, err := wb.WriteTo(file); err != nil {
+		if err2 := file.Close(); err2 != nil {
+			slog.Error("Failed to close file", "path", filePath, "err", err2)
+		}
+		return fmt.Errorf("write xlsx: %w", err)
+	}
+
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("close file %q: %w", filePath, err)
+	}
+
+	return nil
+}
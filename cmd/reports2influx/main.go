@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/chuhlomin/dmark-go/influx"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/dryrun"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+type config struct {
+	reportsPath string
+	mode        string
+	outPath     string
+	location    *time.Location // Days of the daily mode, by the UTC day reports begin when nil
+	client      influx.Client
+	dryRun      bool
+}
+
+func run(cfg config) error {
+	var points []influx.Point
+	switch cfg.mode {
+	case "records":
+		reports, err := logging.ParseDir(cfg.reportsPath)
+		if err != nil {
+			return fmt.Errorf("read reports: %w", err)
+		}
+		points = influx.RecordPoints(reports)
+	case "daily":
+		s, err := store.Open(cfg.reportsPath)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		days, err := s.Daily(context.Background())
+		if cfg.location != nil {
+			days, err = s.DailyIn(context.Background(), cfg.location)
+		}
+		if err != nil {
+			return fmt.Errorf("daily counts: %w", err)
+		}
+		points = influx.DailyPoints(days)
+	default:
+		return fmt.Errorf("unsupported mode %q", cfg.mode)
+	}
+
+	if cfg.client.URL == "" {
+		if cfg.outPath == "-" {
+			return influx.Write(os.Stdout, points)
+		}
+
+		file, err := dryrun.Create(cfg.outPath, cfg.dryRun)
+		if err != nil {
+			return fmt.Errorf("create %q: %w", cfg.outPath, err)
+		}
+		if err = influx.Write(file, points); err != nil {
+			file.Close()
+			return fmt.Errorf("write %q: %w", cfg.outPath, err)
+		}
+		return file.Close()
+	}
+
+	if cfg.dryRun {
+		measurements := map[string]int{}
+		for _, p := range points {
+			measurements[p.Measurement]++
+		}
+		slog.Info("Would write points", "count", len(points), "url", cfg.client.URL, "measurements", measurements)
+		return nil
+	}
+
+	slog.Info("Writing points", "count", len(points), "url", cfg.client.URL)
+	return cfg.client.Write(context.Background(), points)
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	mode := flag.String("mode", "daily", "Points to write: records (one per record) or daily (per domain and day)")
+	outPath := flag.String("o", "-", "Path to output line protocol file when -url is not set, - for stdout")
+	tz := flag.String("tz", "", `Time zone of days in the daily mode, e.g. "Europe/Berlin", splitting reports spanning days; by the UTC day reports begin when empty`)
+	url := flag.String("url", "", "InfluxDB URL, e.g. http://localhost:8086")
+	database := flag.String("db", "", "InfluxDB 1.x database")
+	retention := flag.String("rp", "", "InfluxDB 1.x retention policy")
+	username := flag.String("username", "", "InfluxDB 1.x username, password is read from INFLUX_PASSWORD")
+	org := flag.String("org", "", "InfluxDB 2.x organization")
+	bucket := flag.String("bucket", "", "InfluxDB 2.x bucket, token is read from INFLUX_TOKEN")
+	dryRun := flag.Bool("dry-run", false, "Log how many points would be written to -url, or how the -o file would change, without writing them")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		mode:        *mode,
+		outPath:     *outPath,
+		dryRun:      *dryRun,
+		client: influx.Client{
+			URL:             *url,
+			Database:        *database,
+			RetentionPolicy: *retention,
+			Username:        *username,
+			Password:        os.Getenv("INFLUX_PASSWORD"),
+			Org:             *org,
+			Bucket:          *bucket,
+			Token:           os.Getenv("INFLUX_TOKEN"),
+		},
+	}
+
+	if *tz != "" {
+		var err error
+		if cfg.location, err = time.LoadLocation(*tz); err != nil {
+			logging.Fatal(fmt.Errorf("time zone: %w", err))
+		}
+	}
+
+	if err := run(cfg); err != nil {
+		logging.Fatal(err)
+	}
+}
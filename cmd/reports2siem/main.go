@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/chuhlomin/dmark-go/filter"
+	"github.com/chuhlomin/dmark-go/internal/cli"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/siem"
+)
+
+type config struct {
+	reportsPath string
+	format      string
+	network     string
+	addr        string
+	insecure    bool
+	where       string
+	dryRun      bool
+}
+
+func run(cfg config) error {
+	format, ok := siem.Formats[cfg.format]
+	if !ok {
+		return fmt.Errorf("unsupported format %q", cfg.format)
+	}
+
+	reports, err := logging.ParseDir(cfg.reportsPath)
+	if err != nil {
+		return fmt.Errorf("read reports: %w", err)
+	}
+
+	if cfg.where != "" {
+		where, err := filter.Compile(cfg.where)
+		if err != nil {
+			return err
+		}
+		reports = where.Reports(reports)
+	}
+
+	hostname, _ := os.Hostname()
+	events := siem.Events(reports)
+
+	if cfg.addr == "" {
+		for _, e := range events {
+			fmt.Println(siem.Syslog(e, hostname, format(e)))
+		}
+		return nil
+	}
+
+	if cfg.dryRun {
+		for _, e := range events {
+			slog.Debug("Would send event", "message", siem.Syslog(e, hostname, format(e)))
+		}
+		slog.Info("Would send events", "count", len(events), "network", cfg.network, "addr", cfg.addr)
+		return nil
+	}
+
+	ctx := context.Background()
+	sender, err := siem.Dial(ctx, cfg.network, cfg.addr, &tls.Config{InsecureSkipVerify: cfg.insecure})
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	for _, e := range events {
+		if err = sender.Send(ctx, siem.Syslog(e, hostname, format(e))); err != nil {
+			return fmt.Errorf("send event: %w", err)
+		}
+	}
+	slog.Info("Sent events", "count", len(events), "addr", cfg.addr)
+
+	return nil
+}
+
+func main() {
+	reportsPath := flag.String("r", "./", "Path to directory with DMARK XML reports")
+	format := flag.String("format", "syslog", "Event format: syslog, cef or leef")
+	network := flag.String("network", "udp", "Network to send events over: udp, tcp or tls")
+	addr := flag.String("addr", "", "Syslog collector address (host:port), events are printed when empty")
+	insecure := flag.Bool("insecure", false, "Skip TLS certificate verification")
+	where := flag.String("where", "", "Keep only records matching an expression, see the filter package")
+	dryRun := flag.Bool("dry-run", false, "Log how many events would be sent to -addr without connecting; events are logged with -log-level debug")
+	logOptions := logging.Flags()
+	cli.Parse()
+
+	if err := logOptions.Setup(); err != nil {
+		logging.Fatal(err)
+	}
+
+	cfg := config{
+		reportsPath: *reportsPath,
+		format:      *format,
+		network:     *network,
+		addr:        *addr,
+		insecure:    *insecure,
+		where:       *where,
+		dryRun:      *dryRun,
+	}
+
+	if err := run(cfg); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+package dmark
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// Contact is an address of the email field of report metadata.
+type Contact struct {
+	Name    string `json:"name,omitempty"` // Display name, e.g. "Yahoo DMARC"
+	Address string `json:"address"`        // E.g. "dmarchelp@yahooinc.com"
+}
+
+// ContactError describes a part of the email field that is not an address.
+type ContactError struct {
+	Value string
+	Err   error
+}
+
+func (e *ContactError) Error() string {
+	return fmt.Sprintf("invalid contact %q: %v", e.Value, e.Err)
+}
+
+func (e *ContactError) Unwrap() error {
+	return e.Err
+}
+
+// Contacts parses the email field, which reporters fill with a single address,
+// an address with a display name, or several of them separated by commas,
+// semicolons or spaces. Valid addresses are returned along with a *ContactError
+// for each invalid part, joined.
+func (m ReportMetadata) Contacts() ([]Contact, error) {
+	result := []Contact{}
+	value := strings.TrimSpace(strings.ReplaceAll(m.Email, ";", ","))
+	if value == "" {
+		return result, nil
+	}
+
+	if addresses, err := mail.ParseAddressList(value); err == nil {
+		for _, address := range addresses {
+			result = append(result, Contact{Name: address.Name, Address: address.Address})
+		}
+		return result, nil
+	}
+
+	// parse parts one by one, keeping the valid ones
+	var errs []error
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		address, err := mail.ParseAddress(part)
+		if err == nil {
+			result = append(result, Contact{Name: address.Name, Address: address.Address})
+			continue
+		}
+
+		// "a@example.com b@example.com"
+		fields := strings.Fields(part)
+		valid := len(fields) > 1
+		addresses := make([]Contact, 0, len(fields))
+		for _, field := range fields {
+			address, err := mail.ParseAddress(field)
+			if err != nil {
+				valid = false
+				break
+			}
+			addresses = append(addresses, Contact{Address: address.Address})
+		}
+		if valid {
+			result = append(result, addresses...)
+			continue
+		}
+
+		errs = append(errs, &ContactError{Value: part, Err: err})
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// ContactURLs extracts http, https and mailto URLs from the extra_contact_info
+// field, e.g. a help page of the reporter, in the order they appear.
+func (m ReportMetadata) ContactURLs() []*url.URL {
+	result := []*url.URL{}
+	for _, field := range strings.Fields(m.ExtraContactInfo) {
+		// URLs in text are often enclosed in brackets or followed by punctuation
+		field = strings.TrimLeft(field, `<([{"'`)
+		field = strings.TrimRight(field, `>)]}"'.,;:!?`)
+
+		lower := strings.ToLower(field)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "mailto:") {
+			continue
+		}
+
+		u, err := url.Parse(field)
+		if err != nil || (u.Scheme != "mailto" && u.Host == "") || (u.Scheme == "mailto" && u.Opaque == "") {
+			continue
+		}
+		result = append(result, u)
+	}
+
+	return result
+}
@@ -0,0 +1,107 @@
+// Package convert reads reports exported by other DMARC tools,
+// for migrating their history to a store, see dmark.MarshalFile:
+// parsedmarc JSON and CSV output and dmarcts-report-parser MySQL dumps.
+package convert
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Format reads all reports of an export.
+type Format func(r io.Reader) ([]dmark.Feedback, error)
+
+// Formats by name.
+var Formats = map[string]Format{
+	"parsedmarc-json": ParsedmarcJSON,
+	"parsedmarc-csv":  ParsedmarcCSV,
+	"dmarcts-mysql":   DmarctsDump,
+}
+
+// dateLayouts are the layouts of dates in exports, which are taken as UTC.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+// unixTime parses a date of an export.
+func unixTime(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return int(t.Unix()), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unexpected date %q", value)
+}
+
+// setText sets an enum from its text value, leaving it unset when the value is empty.
+// Unknown values are kept as the Unknown value of the enum.
+func setText(v interface{ UnmarshalText([]byte) error }, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		_ = v.UnmarshalText([]byte(value))
+	}
+}
+
+// result returns whether a policy evaluation result is a pass.
+func result(value string) dmark.Result {
+	var r dmark.Result
+	setText(&r, value)
+	return r
+}
+
+// policyOverrides returns override reasons from their types and comments.
+func policyOverrides(types, comments []string) []dmark.PolicyOverrideReason {
+	reasons := []dmark.PolicyOverrideReason{}
+	for i, value := range types {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		reason := dmark.PolicyOverrideReason{}
+		setText(&reason.Type, value)
+		if i < len(comments) {
+			reason.Comment = strings.TrimSpace(comments[i])
+		}
+		reasons = append(reasons, reason)
+	}
+
+	return reasons
+}
+
+func policyPublished(domain, adkim, aspf, p, sp, pct, fo string) dmark.PolicyPublished {
+	pp := dmark.PolicyPublished{Domain: domain}
+	setText(&pp.ADKIM, adkim)
+	setText(&pp.ASPF, aspf)
+	setText(&pp.P, p)
+	setText(&pp.SP, sp)
+	setText(&pp.Fo, fo)
+	pp.Pct, _ = strconv.Atoi(strings.TrimSpace(pct))
+
+	return pp
+}
+
+func dkimResult(domain, selector, result string) dmark.DKIMAuthResult {
+	r := dmark.DKIMAuthResult{Domain: strings.TrimSpace(domain), Selector: selector}
+	if selector == "none" {
+		// parsedmarc writes "none" for missing selectors
+		r.Selector = ""
+	}
+	setText(&r.Result, result)
+
+	return r
+}
+
+func spfResult(domain, scope, result string) dmark.SPFAuthResult {
+	r := dmark.SPFAuthResult{Domain: strings.TrimSpace(domain)}
+	setText(&r.Scope, scope)
+	setText(&r.Result, result)
+
+	return r
+}
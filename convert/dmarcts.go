@@ -0,0 +1,474 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// DmarctsDump reads reports from a mysqldump of a dmarcts-report-parser database,
+// its report and rptrecord tables. Reports with the raw_xml column set are parsed
+// from it; others are rebuilt from the columns, which keep a single DKIM and SPF
+// result per record and no envelope identifiers.
+func DmarctsDump(r io.Reader) ([]dmark.Feedback, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read dump: %w", err)
+	}
+
+	tables, err := (&dumpReader{data: content}).read()
+	if err != nil {
+		return nil, err
+	}
+	if len(tables["report"]) == 0 {
+		return nil, errors.New("no rows in the report table, not a dmarcts-report-parser dump")
+	}
+
+	reports := []dmark.Feedback{}
+	bySerial := map[string]int{}
+	rebuilt := map[string]bool{}
+	for _, row := range tables["report"] {
+		serial := row["serial"].value
+		if raw := row["raw_xml"]; !raw.null && strings.TrimSpace(raw.value) != "" {
+			feedback, err := dmark.ParseBytes([]byte(raw.value))
+			if err == nil {
+				bySerial[serial] = len(reports)
+				reports = append(reports, *feedback)
+				continue
+			}
+		}
+
+		f := dmark.Feedback{
+			ReportMetadata: dmark.ReportMetadata{
+				OrgName:          row["org"].value,
+				Email:            row["email"].value,
+				ExtraContactInfo: row["extra_contact_info"].value,
+				ReportID:         row["reportid"].value,
+			},
+			PolicyPublished: policyPublished(
+				row["domain"].value,
+				row["policy_adkim"].value,
+				row["policy_aspf"].value,
+				row["policy_p"].value,
+				row["policy_sp"].value,
+				row["policy_pct"].value,
+				"",
+			),
+		}
+		if f.ReportMetadata.DateRange.Begin, err = unixTime(row["mindate"].value); err != nil {
+			return nil, fmt.Errorf("report %s: %w", serial, err)
+		}
+		if !row["maxdate"].null {
+			if f.ReportMetadata.DateRange.End, err = unixTime(row["maxdate"].value); err != nil {
+				return nil, fmt.Errorf("report %s: %w", serial, err)
+			}
+		}
+
+		bySerial[serial] = len(reports)
+		rebuilt[serial] = true
+		reports = append(reports, f)
+	}
+
+	for _, row := range tables["rptrecord"] {
+		serial := row["serial"].value
+		i, ok := bySerial[serial]
+		if !ok || !rebuilt[serial] {
+			continue
+		}
+
+		record := dmark.Record{}
+		record.Row.SourceIP = dmarctsIP(row["ip"], row["ip6"])
+		if record.Row.Count, err = strconv.Atoi(row["rcount"].value); err != nil {
+			return nil, fmt.Errorf("record of report %s: rcount: %w", serial, err)
+		}
+		setText(&record.Row.PolicyEvaluated.Disposition, row["disposition"].value)
+		record.Row.PolicyEvaluated.DKIM = result(row["dkim_align"].value)
+		record.Row.PolicyEvaluated.SPF = result(row["spf_align"].value)
+		record.Row.PolicyEvaluated.Reason = policyOverrides([]string{row["reason"].value}, nil)
+		record.Identifiers.HeaderFrom = row["identifier_hfrom"].value
+		if domain := row["dkimdomain"].value; domain != "" {
+			record.AuthResult.DKIM = append(record.AuthResult.DKIM, dkimResult(domain, "", row["dkimresult"].value))
+		}
+		if domain := row["spfdomain"].value; domain != "" {
+			record.AuthResult.SPF = append(record.AuthResult.SPF, spfResult(domain, "", row["spfresult"].value))
+		}
+
+		reports[i].Records = append(reports[i].Records, record)
+	}
+
+	return reports, nil
+}
+
+// dmarctsIP returns the source IP of a record, stored as an unsigned integer
+// for IPv4 or as 16 bytes for IPv6.
+func dmarctsIP(ip, ip6 dumpValue) net.IP {
+	if !ip.null {
+		if n, err := strconv.ParseUint(ip.value, 10, 32); err == nil {
+			result := make(net.IP, 4)
+			binary.BigEndian.PutUint32(result, uint32(n))
+			return result
+		}
+	}
+	if !ip6.null && len(ip6.value) == net.IPv6len {
+		return net.IP(ip6.value)
+	}
+
+	return nil
+}
+
+// dumpValue is a column value of a row in a dump.
+type dumpValue struct {
+	value string
+	null  bool
+}
+
+// dumpReader reads rows of INSERT statements in a mysqldump, by table,
+// taking column names from CREATE TABLE statements or INSERT column lists.
+// Other statements are skipped.
+type dumpReader struct {
+	data []byte
+	pos  int
+}
+
+func (d *dumpReader) read() (map[string][]map[string]dumpValue, error) {
+	tables := map[string][]map[string]dumpValue{}
+	columns := map[string][]string{}
+
+	for {
+		d.skipSpace()
+		if d.pos >= len(d.data) {
+			return tables, nil
+		}
+
+		switch {
+		case d.keyword("CREATE") && d.keyword("TABLE"):
+			d.keyword("IF")
+			d.keyword("NOT")
+			d.keyword("EXISTS")
+			table := d.ident()
+			names, err := d.createColumns()
+			if err != nil {
+				return nil, fmt.Errorf("CREATE TABLE %s: %w", table, err)
+			}
+			columns[table] = names
+		case d.keyword("INSERT"):
+			d.keyword("IGNORE")
+			if !d.keyword("INTO") {
+				break
+			}
+			table := d.ident()
+			names := columns[table]
+			d.skipSpace()
+			if d.peek() == '(' {
+				names = d.insertColumns()
+			}
+			if !d.keyword("VALUES") {
+				break
+			}
+			if len(names) == 0 {
+				return nil, fmt.Errorf("no columns of table %s, the dump needs CREATE TABLE statements", table)
+			}
+			rows, err := d.rows(names)
+			if err != nil {
+				return nil, fmt.Errorf("INSERT INTO %s: %w", table, err)
+			}
+			tables[table] = append(tables[table], rows...)
+		}
+
+		d.skipStatement()
+	}
+}
+
+// createColumns reads column names of a CREATE TABLE definition, skipping keys.
+func (d *dumpReader) createColumns() ([]string, error) {
+	d.skipSpace()
+	if d.peek() != '(' {
+		return nil, errors.New("expected (")
+	}
+	d.pos++
+
+	names := []string{}
+	for {
+		d.skipSpace()
+		if d.pos >= len(d.data) {
+			return nil, errors.New("unexpected end of dump")
+		}
+		if d.peek() == ')' {
+			d.pos++
+			return names, nil
+		}
+
+		isColumn := d.peek() == '`'
+		name := d.ident()
+		switch strings.ToUpper(name) {
+		case "PRIMARY", "KEY", "UNIQUE", "INDEX", "CONSTRAINT", "FOREIGN", "FULLTEXT", "SPATIAL", "CHECK":
+			if !isColumn {
+				name = ""
+			}
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+
+		// skip the definition up to the next comma or the closing parenthesis
+		for depth := 0; d.pos < len(d.data); {
+			switch c := d.peek(); {
+			case c == '\'' || c == '"':
+				d.quoted()
+				continue
+			case c == '(':
+				depth++
+			case c == ')' && depth == 0:
+				goto next
+			case c == ')':
+				depth--
+			case c == ',' && depth == 0:
+				d.pos++
+				goto next
+			}
+			d.pos++
+		}
+	next:
+	}
+}
+
+// insertColumns reads the column list of an INSERT statement.
+func (d *dumpReader) insertColumns() []string {
+	d.pos++ // (
+	names := []string{}
+	for d.pos < len(d.data) {
+		d.skipSpace()
+		switch d.peek() {
+		case ')':
+			d.pos++
+			return names
+		case ',':
+			d.pos++
+		default:
+			names = append(names, d.ident())
+		}
+	}
+
+	return names
+}
+
+// rows reads the value tuples of an INSERT statement.
+func (d *dumpReader) rows(names []string) ([]map[string]dumpValue, error) {
+	rows := []map[string]dumpValue{}
+	for {
+		d.skipSpace()
+		if d.peek() != '(' {
+			return nil, fmt.Errorf("expected ( at offset %d", d.pos)
+		}
+		d.pos++
+
+		row := map[string]dumpValue{}
+		for i := 0; ; i++ {
+			d.skipSpace()
+			value, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			if i < len(names) {
+				row[names[i]] = value
+			}
+
+			d.skipSpace()
+			c := d.peek()
+			d.pos++
+			if c == ')' {
+				break
+			}
+			if c != ',' {
+				return nil, fmt.Errorf("expected , or ) at offset %d", d.pos-1)
+			}
+		}
+		rows = append(rows, row)
+
+		d.skipSpace()
+		if d.peek() != ',' {
+			return rows, nil
+		}
+		d.pos++
+	}
+}
+
+// value reads a literal: a quoted string, possibly prefixed with _binary,
+// a hexadecimal 0x literal, NULL or a number.
+func (d *dumpReader) value() (dumpValue, error) {
+	if d.keyword("NULL") {
+		return dumpValue{null: true}, nil
+	}
+	if d.keyword("_binary") || d.keyword("_utf8mb4") || d.keyword("_latin1") {
+		d.skipSpace()
+	}
+
+	switch c := d.peek(); {
+	case c == '\'' || c == '"':
+		return dumpValue{value: d.quoted()}, nil
+	case bytes.HasPrefix(d.data[d.pos:], []byte("0x")):
+		d.pos += 2
+		start := d.pos
+		for d.pos < len(d.data) && isHexDigit(d.data[d.pos]) {
+			d.pos++
+		}
+		value, err := hex.DecodeString(string(d.data[start:d.pos]))
+		if err != nil {
+			return dumpValue{}, fmt.Errorf("hex literal at offset %d: %w", start, err)
+		}
+		return dumpValue{value: string(value)}, nil
+	}
+
+	start := d.pos
+	for d.pos < len(d.data) && !strings.ContainsRune(",) \t\r\n", rune(d.data[d.pos])) {
+		d.pos++
+	}
+	if start == d.pos {
+		return dumpValue{}, fmt.Errorf("expected a value at offset %d", start)
+	}
+
+	return dumpValue{value: string(d.data[start:d.pos])}, nil
+}
+
+// quoted reads a quoted string with backslash escapes and doubled quotes.
+func (d *dumpReader) quoted() string {
+	quote := d.data[d.pos]
+	d.pos++
+
+	var buf bytes.Buffer
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		d.pos++
+		switch {
+		case c == '\\' && d.pos < len(d.data):
+			e := d.data[d.pos]
+			d.pos++
+			switch e {
+			case '0':
+				buf.WriteByte(0)
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'Z':
+				buf.WriteByte(26)
+			default:
+				buf.WriteByte(e)
+			}
+		case c == quote && d.peek() == quote:
+			buf.WriteByte(quote)
+			d.pos++
+		case c == quote:
+			return buf.String()
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
+
+// ident reads a backquoted or bare identifier.
+func (d *dumpReader) ident() string {
+	d.skipSpace()
+	if d.peek() == '`' {
+		d.pos++
+		end := bytes.IndexByte(d.data[d.pos:], '`')
+		if end < 0 {
+			end = len(d.data) - d.pos
+		}
+		name := string(d.data[d.pos : d.pos+end])
+		d.pos = min(d.pos+end+1, len(d.data))
+		return name
+	}
+
+	start := d.pos
+	for d.pos < len(d.data) && isIdentByte(d.data[d.pos]) {
+		d.pos++
+	}
+	return string(d.data[start:d.pos])
+}
+
+// keyword consumes a case-insensitive keyword, if it follows.
+func (d *dumpReader) keyword(kw string) bool {
+	d.skipSpace()
+	end := d.pos + len(kw)
+	if end > len(d.data) || !strings.EqualFold(string(d.data[d.pos:end]), kw) {
+		return false
+	}
+	if end < len(d.data) && isIdentByte(d.data[end]) {
+		return false
+	}
+	d.pos = end
+
+	return true
+}
+
+// skipStatement skips to the end of the statement.
+func (d *dumpReader) skipStatement() {
+	for d.pos < len(d.data) {
+		switch d.peek() {
+		case '\'', '"':
+			d.quoted()
+		case ';':
+			d.pos++
+			return
+		default:
+			d.pos++
+		}
+	}
+}
+
+// skipSpace skips white space and comments.
+func (d *dumpReader) skipSpace() {
+	for d.pos < len(d.data) {
+		rest := d.data[d.pos:]
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(rest[0])):
+			d.pos++
+		case bytes.HasPrefix(rest, []byte("-- ")) || bytes.HasPrefix(rest, []byte("--\n")) || rest[0] == '#':
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			d.pos += end + 1
+		case bytes.HasPrefix(rest, []byte("/*")):
+			end := bytes.Index(rest, []byte("*/"))
+			if end < 0 {
+				end = len(rest) - 2
+			}
+			d.pos += end + 2
+		default:
+			return
+		}
+	}
+}
+
+func (d *dumpReader) peek() byte {
+	if d.pos < len(d.data) {
+		return d.data[d.pos]
+	}
+
+	return 0
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,496 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// parsedmarcReport is an aggregate report in parsedmarc JSON output.
+type parsedmarcReport struct {
+	ReportMetadata struct {
+		OrgName             string     `json:"org_name"`
+		OrgEmail            string     `json:"org_email"`
+		OrgExtraContactInfo string     `json:"org_extra_contact_info"`
+		ReportID            flexString `json:"report_id"`
+		BeginDate           string     `json:"begin_date"`
+		EndDate             string     `json:"end_date"`
+		Errors              []string   `json:"errors"`
+	} `json:"report_metadata"`
+	PolicyPublished struct {
+		Domain string     `json:"domain"`
+		ADKIM  string     `json:"adkim"`
+		ASPF   string     `json:"aspf"`
+		P      string     `json:"p"`
+		SP     string     `json:"sp"`
+		Pct    flexString `json:"pct"`
+		Fo     flexString `json:"fo"`
+	} `json:"policy_published"`
+	Records []struct {
+		Source struct {
+			IPAddress string `json:"ip_address"`
+		} `json:"source"`
+		Count           int `json:"count"`
+		PolicyEvaluated struct {
+			Disposition           string `json:"disposition"`
+			DKIM                  string `json:"dkim"`
+			SPF                   string `json:"spf"`
+			PolicyOverrideReasons []struct {
+				Type    string `json:"type"`
+				Comment string `json:"comment"`
+			} `json:"policy_override_reasons"`
+		} `json:"policy_evaluated"`
+		Identifiers struct {
+			HeaderFrom   string `json:"header_from"`
+			EnvelopeFrom string `json:"envelope_from"`
+			EnvelopeTo   string `json:"envelope_to"`
+		} `json:"identifiers"`
+		AuthResults struct {
+			DKIM []struct {
+				Domain   string `json:"domain"`
+				Selector string `json:"selector"`
+				Result   string `json:"result"`
+			} `json:"dkim"`
+			SPF []struct {
+				Domain string `json:"domain"`
+				Scope  string `json:"scope"`
+				Result string `json:"result"`
+			} `json:"spf"`
+		} `json:"auth_results"`
+	} `json:"records"`
+}
+
+// flexString is a JSON string, number or null, which parsedmarc uses interchangeably.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, (*string)(s))
+	}
+
+	*s = flexString(data)
+	return nil
+}
+
+// ParsedmarcJSON reads aggregate reports from parsedmarc JSON output: the array
+// written to aggregate.json, or the object printed with "aggregate_reports",
+// or reports one per line.
+func ParsedmarcJSON(r io.Reader) ([]dmark.Feedback, error) {
+	reports := []dmark.Feedback{}
+
+	dec := json.NewDecoder(r)
+	for {
+		var value json.RawMessage
+		err := dec.Decode(&value)
+		if err == io.EOF {
+			return reports, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode JSON: %w", err)
+		}
+
+		var batch []parsedmarcReport
+		switch value = bytes.TrimSpace(value); {
+		case bytes.HasPrefix(value, []byte("[")):
+			err = json.Unmarshal(value, &batch)
+		case bytes.Contains(value, []byte(`"aggregate_reports"`)):
+			var output struct {
+				AggregateReports []parsedmarcReport `json:"aggregate_reports"`
+			}
+			err = json.Unmarshal(value, &output)
+			batch = output.AggregateReports
+		default:
+			batch = make([]parsedmarcReport, 1)
+			err = json.Unmarshal(value, &batch[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode parsedmarc report: %w", err)
+		}
+
+		for _, report := range batch {
+			feedback, err := report.feedback()
+			if err != nil {
+				return nil, fmt.Errorf("report %q: %w", report.ReportMetadata.ReportID, err)
+			}
+			reports = append(reports, feedback)
+		}
+	}
+}
+
+func (report parsedmarcReport) feedback() (dmark.Feedback, error) {
+	meta := report.ReportMetadata
+	f := dmark.Feedback{
+		ReportMetadata: dmark.ReportMetadata{
+			OrgName:          meta.OrgName,
+			Email:            meta.OrgEmail,
+			ExtraContactInfo: meta.OrgExtraContactInfo,
+			ReportID:         string(meta.ReportID),
+			Errors:           meta.Errors,
+		},
+	}
+
+	var err error
+	if f.ReportMetadata.DateRange.Begin, err = unixTime(meta.BeginDate); err != nil {
+		return f, err
+	}
+	if f.ReportMetadata.DateRange.End, err = unixTime(meta.EndDate); err != nil {
+		return f, err
+	}
+
+	pp := report.PolicyPublished
+	f.PolicyPublished = policyPublished(pp.Domain, pp.ADKIM, pp.ASPF, pp.P, pp.SP, string(pp.Pct), string(pp.Fo))
+
+	for _, rec := range report.Records {
+		record := dmark.Record{}
+		record.Row.SourceIP = net.ParseIP(rec.Source.IPAddress)
+		record.Row.Count = rec.Count
+		setText(&record.Row.PolicyEvaluated.Disposition, rec.PolicyEvaluated.Disposition)
+		record.Row.PolicyEvaluated.DKIM = result(rec.PolicyEvaluated.DKIM)
+		record.Row.PolicyEvaluated.SPF = result(rec.PolicyEvaluated.SPF)
+
+		types, comments := []string{}, []string{}
+		for _, reason := range rec.PolicyEvaluated.PolicyOverrideReasons {
+			types = append(types, reason.Type)
+			comments = append(comments, reason.Comment)
+		}
+		record.Row.PolicyEvaluated.Reason = policyOverrides(types, comments)
+
+		record.Identifiers = dmark.Identifiers{
+			EnvelopeTo:   rec.Identifiers.EnvelopeTo,
+			EnvelopeFrom: rec.Identifiers.EnvelopeFrom,
+			HeaderFrom:   rec.Identifiers.HeaderFrom,
+		}
+		for _, dkim := range rec.AuthResults.DKIM {
+			record.AuthResult.DKIM = append(record.AuthResult.DKIM, dkimResult(dkim.Domain, dkim.Selector, dkim.Result))
+		}
+		for _, spf := range rec.AuthResults.SPF {
+			record.AuthResult.SPF = append(record.AuthResult.SPF, spfResult(spf.Domain, spf.Scope, spf.Result))
+		}
+
+		f.Records = append(f.Records, record)
+	}
+
+	return f, nil
+}
+
+// ParsedmarcCSV reads aggregate reports from parsedmarc CSV output,
+// which has a row per record, grouping rows into reports by report ID.
+func ParsedmarcCSV(r io.Reader) ([]dmark.Feedback, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"report_id", "begin_date", "end_date", "domain", "source_ip_address", "count"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("no %q column, not parsedmarc aggregate CSV", name)
+		}
+	}
+
+	reports := []dmark.Feedback{}
+	byKey := map[string]int{}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return reports, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read CSV: %w", err)
+		}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		key := get("org_name") + "\x00" + get("report_id") + "\x00" + get("domain")
+		i, ok := byKey[key]
+		if !ok {
+			f := dmark.Feedback{
+				ReportMetadata: dmark.ReportMetadata{
+					OrgName:          get("org_name"),
+					Email:            get("org_email"),
+					ExtraContactInfo: get("org_extra_contact_info"),
+					ReportID:         get("report_id"),
+				},
+				PolicyPublished: policyPublished(get("domain"), get("adkim"), get("aspf"), get("p"), get("sp"), get("pct"), get("fo")),
+			}
+			if errs := get("errors"); errs != "" {
+				f.ReportMetadata.Errors = []string{errs}
+			}
+			if f.ReportMetadata.DateRange.Begin, err = unixTime(get("begin_date")); err != nil {
+				return nil, fmt.Errorf("report %q: %w", get("report_id"), err)
+			}
+			if f.ReportMetadata.DateRange.End, err = unixTime(get("end_date")); err != nil {
+				return nil, fmt.Errorf("report %q: %w", get("report_id"), err)
+			}
+
+			i = len(reports)
+			byKey[key] = i
+			reports = append(reports, f)
+		}
+
+		record := dmark.Record{}
+		record.Row.SourceIP = net.ParseIP(get("source_ip_address"))
+		if record.Row.Count, err = strconv.Atoi(get("count")); err != nil {
+			return nil, fmt.Errorf("report %q: count: %w", get("report_id"), err)
+		}
+		setText(&record.Row.PolicyEvaluated.Disposition, get("disposition"))
+		// the CSV has alignment instead of policy evaluated results, which are the same
+		record.Row.PolicyEvaluated.DKIM = dmark.Result(strings.EqualFold(get("dkim_aligned"), "true"))
+		record.Row.PolicyEvaluated.SPF = dmark.Result(strings.EqualFold(get("spf_aligned"), "true"))
+		record.Row.PolicyEvaluated.Reason = policyOverrides(splitList(get("policy_override_reasons")), splitList(get("policy_override_comments")))
+		record.Identifiers = dmark.Identifiers{
+			EnvelopeTo:   get("envelope_to"),
+			EnvelopeFrom: get("envelope_from"),
+			HeaderFrom:   get("header_from"),
+		}
+
+		domains, selectors, results := splitList(get("dkim_domains")), splitList(get("dkim_selectors")), splitList(get("dkim_results"))
+		for j, domain := range domains {
+			record.AuthResult.DKIM = append(record.AuthResult.DKIM, dkimResult(domain, item(selectors, j), item(results, j)))
+		}
+		domains, scopes, results := splitList(get("spf_domains")), splitList(get("spf_scopes")), splitList(get("spf_results"))
+		for j, domain := range domains {
+			record.AuthResult.SPF = append(record.AuthResult.SPF, spfResult(domain, item(scopes, j), item(results, j)))
+		}
+
+		reports[i].Records = append(reports[i].Records, record)
+	}
+}
+
+// splitList splits a comma-separated CSV value.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+func item(values []string, i int) string {
+	if i < len(values) {
+		return strings.TrimSpace(values[i])
+	}
+
+	return ""
+}
+
+// ParsedmarcReport is an aggregate report in the schema of parsedmarc JSON
+// output, which its Elasticsearch and Splunk dashboards are built for.
+type ParsedmarcReport struct {
+	XMLSchema       string                    `json:"xml_schema"`
+	ReportMetadata  ParsedmarcMetadata        `json:"report_metadata"`
+	PolicyPublished ParsedmarcPolicyPublished `json:"policy_published"`
+	Records         []ParsedmarcRecord        `json:"records"`
+}
+
+type ParsedmarcMetadata struct {
+	OrgName             string   `json:"org_name"`
+	OrgEmail            string   `json:"org_email"`
+	OrgExtraContactInfo *string  `json:"org_extra_contact_info"`
+	ReportID            string   `json:"report_id"`
+	BeginDate           string   `json:"begin_date"` // UTC, "2006-01-02 15:04:05"
+	EndDate             string   `json:"end_date"`
+	Errors              []string `json:"errors"`
+}
+
+type ParsedmarcPolicyPublished struct {
+	Domain string `json:"domain"`
+	ADKIM  string `json:"adkim"`
+	ASPF   string `json:"aspf"`
+	P      string `json:"p"`
+	SP     string `json:"sp"`
+	Pct    string `json:"pct"`
+	Fo     string `json:"fo"`
+}
+
+type ParsedmarcRecord struct {
+	Source          ParsedmarcSource          `json:"source"`
+	Count           int                       `json:"count"`
+	Alignment       ParsedmarcAlignment       `json:"alignment"`
+	PolicyEvaluated ParsedmarcPolicyEvaluated `json:"policy_evaluated"`
+	Identifiers     ParsedmarcIdentifiers     `json:"identifiers"`
+	AuthResults     ParsedmarcAuthResults     `json:"auth_results"`
+}
+
+// ParsedmarcSource is the source of a record. Country, reverse DNS and
+// base domain, which parsedmarc looks up, are left null for the caller to fill in.
+type ParsedmarcSource struct {
+	IPAddress  string  `json:"ip_address"`
+	Country    *string `json:"country"`
+	ReverseDNS *string `json:"reverse_dns"`
+	BaseDomain *string `json:"base_domain"`
+}
+
+type ParsedmarcAlignment struct {
+	SPF   bool `json:"spf"`
+	DKIM  bool `json:"dkim"`
+	DMARC bool `json:"dmarc"`
+}
+
+type ParsedmarcPolicyEvaluated struct {
+	Disposition           string                     `json:"disposition"`
+	DKIM                  string                     `json:"dkim"`
+	SPF                   string                     `json:"spf"`
+	PolicyOverrideReasons []ParsedmarcOverrideReason `json:"policy_override_reasons"`
+}
+
+type ParsedmarcOverrideReason struct {
+	Type    string  `json:"type"`
+	Comment *string `json:"comment"`
+}
+
+type ParsedmarcIdentifiers struct {
+	HeaderFrom   string  `json:"header_from"`
+	EnvelopeFrom *string `json:"envelope_from"`
+	EnvelopeTo   *string `json:"envelope_to"`
+}
+
+type ParsedmarcAuthResults struct {
+	DKIM []ParsedmarcDKIM `json:"dkim"`
+	SPF  []ParsedmarcSPF  `json:"spf"`
+}
+
+type ParsedmarcDKIM struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	Result   string `json:"result"`
+}
+
+type ParsedmarcSPF struct {
+	Domain string `json:"domain"`
+	Scope  string `json:"scope"`
+	Result string `json:"result"`
+}
+
+// Parsedmarc returns the report in the schema of parsedmarc JSON output,
+// filling in empty values the way parsedmarc does.
+func Parsedmarc(f *dmark.Feedback) ParsedmarcReport {
+	meta := f.ReportMetadata
+	pp := f.PolicyPublished
+
+	report := ParsedmarcReport{
+		XMLSchema: "draft",
+		ReportMetadata: ParsedmarcMetadata{
+			OrgName:             meta.OrgName,
+			OrgEmail:            meta.Email,
+			OrgExtraContactInfo: nullable(meta.ExtraContactInfo),
+			ReportID:            meta.ReportID,
+			BeginDate:           parsedmarcDate(meta.DateRange.Begin),
+			EndDate:             parsedmarcDate(meta.DateRange.End),
+			Errors:              append([]string{}, meta.Errors...),
+		},
+		PolicyPublished: ParsedmarcPolicyPublished{
+			Domain: pp.Domain,
+			ADKIM:  textOr(pp.ADKIM, "r"),
+			ASPF:   textOr(pp.ASPF, "r"),
+			P:      textOr(pp.P, ""),
+			SP:     textOr(pp.SP, textOr(pp.P, "")),
+			Pct:    "100",
+			Fo:     textOr(pp.Fo, "0"),
+		},
+		Records: []ParsedmarcRecord{},
+	}
+	if f.Version != 0 {
+		report.XMLSchema = strconv.FormatFloat(f.Version, 'f', 1, 64)
+	}
+	if pp.Pct != 0 {
+		report.PolicyPublished.Pct = strconv.Itoa(pp.Pct)
+	}
+
+	for _, r := range f.Records {
+		pe := r.Row.PolicyEvaluated
+		record := ParsedmarcRecord{
+			Source: ParsedmarcSource{IPAddress: r.Row.SourceIP.String()},
+			Count:  r.Row.Count,
+			Alignment: ParsedmarcAlignment{
+				SPF:   bool(pe.SPF),
+				DKIM:  bool(pe.DKIM),
+				DMARC: bool(pe.SPF || pe.DKIM),
+			},
+			PolicyEvaluated: ParsedmarcPolicyEvaluated{
+				Disposition:           textOr(pe.Disposition, "none"),
+				DKIM:                  textOr(&pe.DKIM, ""),
+				SPF:                   textOr(&pe.SPF, ""),
+				PolicyOverrideReasons: []ParsedmarcOverrideReason{},
+			},
+			Identifiers: ParsedmarcIdentifiers{
+				HeaderFrom:   r.Identifiers.HeaderFrom,
+				EnvelopeFrom: nullable(r.Identifiers.EnvelopeFrom),
+				EnvelopeTo:   nullable(r.Identifiers.EnvelopeTo),
+			},
+			AuthResults: ParsedmarcAuthResults{
+				DKIM: []ParsedmarcDKIM{},
+				SPF:  []ParsedmarcSPF{},
+			},
+		}
+		for _, reason := range pe.Reason {
+			record.PolicyEvaluated.PolicyOverrideReasons = append(record.PolicyEvaluated.PolicyOverrideReasons, ParsedmarcOverrideReason{
+				Type:    textOr(reason.Type, ""),
+				Comment: nullable(reason.Comment),
+			})
+		}
+		for _, dkim := range r.AuthResult.DKIM {
+			record.AuthResults.DKIM = append(record.AuthResults.DKIM, ParsedmarcDKIM{
+				Domain:   dkim.Domain,
+				Selector: dkim.Selector,
+				Result:   textOr(dkim.Result, "none"),
+			})
+			if dkim.Selector == "" {
+				record.AuthResults.DKIM[len(record.AuthResults.DKIM)-1].Selector = "none"
+			}
+		}
+		for _, spf := range r.AuthResult.SPF {
+			record.AuthResults.SPF = append(record.AuthResults.SPF, ParsedmarcSPF{
+				Domain: spf.Domain,
+				Scope:  textOr(spf.Scope, "mfrom"),
+				Result: textOr(spf.Result, "none"),
+			})
+		}
+
+		report.Records = append(report.Records, record)
+	}
+
+	return report
+}
+
+func parsedmarcDate(unix int) string {
+	return time.Unix(int64(unix), 0).UTC().Format("2006-01-02 15:04:05")
+}
+
+// textOr returns the text value of an enum, or def when it is empty.
+func textOr(v interface{ MarshalText() ([]byte, error) }, def string) string {
+	text, err := v.MarshalText()
+	if err != nil || len(text) == 0 {
+		return def
+	}
+
+	return string(text)
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,134 @@
+package dmark
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxDateRange is the longest date range kept by normalization, longer ranges
+// are clamped to end where they end. Reporters send daily reports by default.
+const MaxDateRange = 7 * 24 * time.Hour
+
+// Date range problems found by NormalizeRanges.
+const (
+	RangeInverted = "inverted" // End before begin, the bounds are swapped
+	RangeTooLong  = "too long" // Longer than MaxDateRange, begin is clamped
+	RangeOverlap  = "overlap"  // Begins before another report of the same reporter and domain ends
+)
+
+// RangeWarning describes a date range problem of a report.
+type RangeWarning struct {
+	Problem  string    `json:"problem"`
+	OrgName  string    `json:"org_name"`
+	ReportID string    `json:"report_id"`
+	Domain   string    `json:"domain"`
+	Range    DateRange `json:"range"`           // The range as reported
+	Other    string    `json:"other,omitempty"` // Report ID of the overlapped report
+	Clamped  bool      `json:"clamped"`         // Whether the normalized range differs
+}
+
+func (w RangeWarning) String() string {
+	s := fmt.Sprintf(
+		"report %q of %s for %s: %s date range %d-%d",
+		w.ReportID, w.OrgName, w.Domain, w.Problem, w.Range.Begin, w.Range.End,
+	)
+	if w.Other != "" {
+		s += fmt.Sprintf(" with report %q", w.Other)
+	}
+
+	return s
+}
+
+// Times returns the bounds of the range, with inverted ranges swapped
+// and ranges longer than MaxDateRange clamped.
+func (r DateRange) Times() (begin, end time.Time) {
+	begin, end = time.Unix(int64(r.Begin), 0), time.Unix(int64(r.End), 0)
+	if end.Before(begin) {
+		begin, end = end, begin
+	}
+	if end.Sub(begin) > MaxDateRange {
+		begin = end.Add(-MaxDateRange)
+	}
+
+	return begin, end
+}
+
+// Normalized returns the range with bounds from Times.
+func (r DateRange) Normalized() DateRange {
+	begin, end := r.Times()
+	return DateRange{Begin: int(begin.Unix()), End: int(end.Unix())}
+}
+
+// NormalizeRanges returns normalized date ranges of the reports, in the same order,
+// with warnings about their problems. Ranges are normalized by Times, then
+// ranges overlapping an earlier range of the same reporter and policy domain
+// are clamped to begin where it ends, so messages are not counted twice in
+// the overlap by proportional splitting. Ranges within an earlier range,
+// likely resent reports, have nothing left after clamping: they are the zero
+// DateRange, and their messages are not counted. Reports are not modified.
+func NormalizeRanges(reports []Feedback) ([]DateRange, []RangeWarning) {
+	ranges := make([]DateRange, len(reports))
+	warnings := []RangeWarning{}
+	warn := func(i int, problem, other string) {
+		meta := reports[i].ReportMetadata
+		warnings = append(warnings, RangeWarning{
+			Problem:  problem,
+			OrgName:  meta.OrgName,
+			ReportID: meta.ReportID,
+			Domain:   reports[i].PolicyPublished.Domain,
+			Range:    meta.DateRange,
+			Other:    other,
+			Clamped:  ranges[i] != meta.DateRange,
+		})
+	}
+
+	order := make([]int, len(reports))
+	for i, report := range reports {
+		order[i] = i
+		ranges[i] = report.ReportMetadata.DateRange.Normalized()
+
+		switch original := report.ReportMetadata.DateRange; {
+		case original.End < original.Begin:
+			warn(i, RangeInverted, "")
+		case ranges[i] != original:
+			warn(i, RangeTooLong, "")
+		}
+	}
+
+	key := func(i int) string {
+		return reports[i].ReportMetadata.OrgName + " " + strings.ToLower(reports[i].PolicyPublished.Domain)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if key(i) != key(j) {
+			return key(i) < key(j)
+		}
+		return ranges[i].Begin < ranges[j].Begin
+	})
+
+	previous := -1
+	for _, i := range order {
+		if previous < 0 || key(previous) != key(i) {
+			previous = i
+			continue
+		}
+
+		prev := ranges[previous]
+		switch {
+		case ranges[i].Begin >= prev.End:
+			// no overlap
+		case ranges[i].End <= prev.End:
+			ranges[i] = DateRange{}
+			warn(i, RangeOverlap, reports[previous].ReportMetadata.ReportID)
+			continue // keep the longer range to compare the next ones with
+		default:
+			ranges[i].Begin = prev.End
+			warn(i, RangeOverlap, reports[previous].ReportMetadata.ReportID)
+		}
+		previous = i
+	}
+
+	return ranges, warnings
+}
@@ -0,0 +1,76 @@
+package dmark
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeRanges(t *testing.T) {
+	const day = 86400
+	report := func(org, id string, begin, end int) Feedback {
+		var f Feedback
+		f.ReportMetadata.OrgName = org
+		f.ReportMetadata.ReportID = id
+		f.ReportMetadata.DateRange = DateRange{Begin: begin, End: end}
+		f.PolicyPublished.Domain = "example.com"
+		return f
+	}
+
+	reports := []Feedback{
+		report("example.net", "inverted", 2*day, day),
+		report("example.net", "overlapping", day+day/2, 3*day),
+		report("example.net", "contained", 2*day, 2*day+day/2),
+		report("example.net", "too long", 10*day, 20*day),
+		report("example.org", "other reporter", day, 2*day),
+	}
+	ranges, warnings := NormalizeRanges(reports)
+
+	wantRanges := []DateRange{
+		{Begin: day, End: 2 * day},
+		{Begin: 2 * day, End: 3 * day},
+		{}, // within overlapping, not counted
+		{Begin: 13 * day, End: 20 * day},
+		{Begin: day, End: 2 * day},
+	}
+	if !reflect.DeepEqual(ranges, wantRanges) {
+		t.Errorf("want ranges %v, got %v", wantRanges, ranges)
+	}
+
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.ReportID+": "+w.Problem+" "+w.Other)
+	}
+	want := []string{
+		"inverted: inverted ",
+		"too long: too long ",
+		"overlapping: overlap inverted",
+		"contained: overlap overlapping",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want warnings %q, got %q", want, got)
+	}
+}
+
+// TestDailyCountsContained checks messages of a report within another one
+// of the same reporter, like a resent one, are not counted twice.
+func TestDailyCountsContained(t *testing.T) {
+	const day = 86400
+	report := func(id string, begin, end, count int) Feedback {
+		var f Feedback
+		f.ReportMetadata.OrgName = "example.net"
+		f.ReportMetadata.ReportID = id
+		f.ReportMetadata.DateRange = DateRange{Begin: begin, End: end}
+		f.PolicyPublished.Domain = "example.com"
+		f.Records = []Record{{Row: Row{Count: count}}}
+		return f
+	}
+
+	days := DailyCountsIn([]Feedback{
+		report("daily", day, 2*day, 10),
+		report("resent", day, 2*day, 10),
+		report("hourly", day+3600, day+7200, 4),
+	}, nil)
+	if len(days) != 1 || days[0].Messages != 10 {
+		t.Errorf("want 10 messages on one day, got %+v", days)
+	}
+}
@@ -0,0 +1,770 @@
+package dmark
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// errSlowPath is returned by reportDecoder for anything it does not handle:
+// syntax errors, unknown values, DOCTYPE declarations, non-ASCII names
+// and extension elements.
+// Such reports are decoded again with encoding/xml, which also produces the errors.
+var errSlowPath = errors.New("slow path")
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenStart
+	tokenEnd
+	tokenText
+)
+
+// reportDecoder is a decoder for the fixed schema of aggregate reports,
+// several times faster than encoding/xml as it does not use reflection
+// and does not allocate for element names and text without entities.
+// For successfully decoded reports the result is the same as with encoding/xml.
+type reportDecoder struct {
+	content []byte
+	pos     int
+
+	name       []byte // Raw name of the last start or end element
+	text       []byte // Last text token with entities replaced, valid until scratch is reset
+	pendingEnd bool   // Last start element was self-closing
+
+	scratch []byte            // Text with entities replaced
+	joined  []byte            // Element text split by comments or CDATA sections
+	strings map[string]string // Short strings seen in the report, as domains repeat in every record
+}
+
+// maxInterned is the length of the longest string shared between records.
+const maxInterned = 64
+
+// decode decodes a report, reusing the buffers of previous calls.
+func (d *reportDecoder) decode(content []byte) (*Feedback, error) {
+	d.content = content
+	d.pos = 0
+	d.pendingEnd = false
+	if d.strings == nil {
+		d.strings = map[string]string{}
+	}
+	defer func() {
+		clear(d.strings)
+		// the decoder may be pooled, content belongs to the caller
+		d.content, d.name, d.text = nil, nil, nil
+	}()
+
+	for {
+		kind, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if kind == tokenStart {
+			break
+		}
+		if kind != tokenText || len(bytes.Trim(d.text, " \t\r\n")) != 0 {
+			return nil, errSlowPath
+		}
+	}
+
+	feedback := &Feedback{}
+	if err := d.feedback(d.name, feedback); err != nil {
+		return nil, err
+	}
+	if feedback.Records == nil {
+		// like the encoding/xml path, reports without records have an empty list
+		feedback.Records = []Record{}
+	}
+
+	return feedback, nil
+}
+
+func (d *reportDecoder) feedback(name []byte, f *Feedback) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "version":
+			return d.float(child, &f.Version)
+		case "report_metadata":
+			return d.reportMetadata(child, &f.ReportMetadata)
+		case "policy_published":
+			return d.policyPublished(child, &f.PolicyPublished)
+		case "record":
+			f.Records = append(f.Records, Record{})
+			return d.record(child, &f.Records[len(f.Records)-1])
+		}
+
+		// extension elements are kept as raw XML by encoding/xml
+		return errSlowPath
+	})
+}
+
+func (d *reportDecoder) reportMetadata(name []byte, m *ReportMetadata) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "org_name":
+			return d.string(child, &m.OrgName)
+		case "email":
+			return d.string(child, &m.Email)
+		case "extra_contact_info":
+			return d.string(child, &m.ExtraContactInfo)
+		case "report_id":
+			return d.string(child, &m.ReportID)
+		case "date_range":
+			return d.children(child, func(child []byte) error {
+				switch string(localName(child)) {
+				case "begin":
+					return d.int(child, &m.DateRange.Begin)
+				case "end":
+					return d.int(child, &m.DateRange.End)
+				}
+
+				return d.skip(child)
+			})
+		case "error":
+			m.Errors = append(m.Errors, "")
+			return d.string(child, &m.Errors[len(m.Errors)-1])
+		}
+
+		return d.skip(child)
+	})
+}
+
+func (d *reportDecoder) policyPublished(name []byte, pp *PolicyPublished) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "domain":
+			return d.string(child, &pp.Domain)
+		case "adkim":
+			return d.textValue(child, &pp.ADKIM)
+		case "aspf":
+			return d.textValue(child, &pp.ASPF)
+		case "p":
+			return d.textValue(child, &pp.P)
+		case "sp":
+			return d.textValue(child, &pp.SP)
+		case "np":
+			return d.textValue(child, &pp.NP)
+		case "pct":
+			return d.int(child, &pp.Pct)
+		case "fo":
+			return d.textValue(child, &pp.Fo)
+		case "ri":
+			return d.int(child, &pp.RI)
+		case "rua":
+			return d.string(child, &pp.RUA)
+		case "ruf":
+			return d.string(child, &pp.RUF)
+		case "testing":
+			return d.string(child, &pp.Testing)
+		}
+
+		// same as Extensions.UnmarshalXML
+		var value string
+		if err := d.string(child, &value); err != nil {
+			return err
+		}
+		if pp.Extensions == nil {
+			pp.Extensions = Extensions{}
+		}
+		local := string(localName(child))
+		if prev, ok := pp.Extensions[local]; ok {
+			value = prev + "," + value
+		}
+		pp.Extensions[local] = value
+
+		return nil
+	})
+}
+
+func (d *reportDecoder) record(name []byte, r *Record) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "row":
+			return d.row(child, &r.Row)
+		case "identifiers":
+			return d.identifiers(child, &r.Identifiers)
+		case "auth_results":
+			return d.authResult(child, &r.AuthResult)
+		}
+
+		// extension elements are kept as raw XML by encoding/xml
+		return errSlowPath
+	})
+}
+
+func (d *reportDecoder) row(name []byte, row *Row) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "source_ip":
+			return d.textValue(child, &row.SourceIP)
+		case "count":
+			return d.int(child, &row.Count)
+		case "policy_evaluated":
+			return d.policyEvaluated(child, &row.PolicyEvaluated)
+		}
+
+		return d.skip(child)
+	})
+}
+
+func (d *reportDecoder) policyEvaluated(name []byte, pe *PolicyEvaluated) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "disposition":
+			return d.textValue(child, &pe.Disposition)
+		case "dkim":
+			return d.textValue(child, &pe.DKIM)
+		case "spf":
+			return d.textValue(child, &pe.SPF)
+		case "reason":
+			pe.Reason = append(pe.Reason, PolicyOverrideReason{})
+			reason := &pe.Reason[len(pe.Reason)-1]
+			return d.children(child, func(child []byte) error {
+				switch string(localName(child)) {
+				case "type":
+					return d.textValue(child, &reason.Type)
+				case "comment":
+					return d.string(child, &reason.Comment)
+				}
+
+				return d.skip(child)
+			})
+		}
+
+		return d.skip(child)
+	})
+}
+
+func (d *reportDecoder) identifiers(name []byte, ids *Identifiers) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "envelope_to":
+			return d.string(child, &ids.EnvelopeTo)
+		case "envelope_from":
+			return d.string(child, &ids.EnvelopeFrom)
+		case "header_from":
+			return d.string(child, &ids.HeaderFrom)
+		}
+
+		return d.skip(child)
+	})
+}
+
+func (d *reportDecoder) authResult(name []byte, ar *AuthResult) error {
+	return d.children(name, func(child []byte) error {
+		switch string(localName(child)) {
+		case "dkim":
+			ar.DKIM = append(ar.DKIM, DKIMAuthResult{})
+			dkim := &ar.DKIM[len(ar.DKIM)-1]
+			return d.children(child, func(child []byte) error {
+				switch string(localName(child)) {
+				case "domain":
+					return d.string(child, &dkim.Domain)
+				case "selector":
+					return d.string(child, &dkim.Selector)
+				case "result":
+					return d.textValue(child, &dkim.Result)
+				case "human_result":
+					return d.string(child, &dkim.HumanResult)
+				}
+
+				return d.skip(child)
+			})
+		case "spf":
+			ar.SPF = append(ar.SPF, SPFAuthResult{})
+			spf := &ar.SPF[len(ar.SPF)-1]
+			return d.children(child, func(child []byte) error {
+				switch string(localName(child)) {
+				case "domain":
+					return d.string(child, &spf.Domain)
+				case "scope":
+					return d.textValue(child, &spf.Scope)
+				case "result":
+					return d.textValue(child, &spf.Result)
+				}
+
+				return d.skip(child)
+			})
+		}
+
+		// extension elements are kept as raw XML by encoding/xml
+		return errSlowPath
+	})
+}
+
+// children calls fn for every child element of the element with the given name,
+// fn has to consume the child up to and including its end element.
+// Text between child elements is ignored, as encoding/xml does for structs.
+func (d *reportDecoder) children(name []byte, fn func(child []byte) error) error {
+	for {
+		kind, err := d.next()
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case tokenStart:
+			if err = fn(d.name); err != nil {
+				return err
+			}
+		case tokenEnd:
+			if !bytes.Equal(d.name, name) {
+				return errSlowPath
+			}
+			return nil
+		case tokenEOF:
+			return errSlowPath
+		}
+	}
+}
+
+func (d *reportDecoder) skip(name []byte) error {
+	return d.children(name, d.skip)
+}
+
+// value returns the text of an element without child elements.
+func (d *reportDecoder) value(name []byte) ([]byte, error) {
+	d.scratch = d.scratch[:0]
+
+	var value []byte
+	pieces := 0
+	for {
+		kind, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case tokenText:
+			text := d.normalizeNewlines(d.text)
+			switch pieces {
+			case 0:
+				value = text
+			case 1:
+				d.joined = append(append(d.joined[:0], value...), text...)
+				value = d.joined
+			default:
+				d.joined = append(d.joined, text...)
+				value = d.joined
+			}
+			pieces++
+		case tokenEnd:
+			if !bytes.Equal(d.name, name) {
+				return nil, errSlowPath
+			}
+			return value, nil
+		default:
+			return nil, errSlowPath
+		}
+	}
+}
+
+func (d *reportDecoder) string(name []byte, s *string) error {
+	value, err := d.value(name)
+	if err != nil {
+		return err
+	}
+
+	if len(value) > maxInterned {
+		*s = string(value)
+		return nil
+	}
+
+	str, ok := d.strings[string(value)]
+	if !ok {
+		str = string(value)
+		d.strings[str] = str
+	}
+
+	*s = str
+	return nil
+}
+
+// int parses integers the same way encoding/xml does.
+func (d *reportDecoder) int(name []byte, i *int) error {
+	value, err := d.value(name)
+	if err != nil {
+		return err
+	}
+
+	if len(value) == 0 {
+		*i = 0
+		return nil
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(string(value)), 10, strconv.IntSize)
+	if err != nil {
+		return errSlowPath
+	}
+
+	*i = int(n)
+	return nil
+}
+
+func (d *reportDecoder) float(name []byte, f *float64) error {
+	value, err := d.value(name)
+	if err != nil {
+		return err
+	}
+
+	if len(value) == 0 {
+		*f = 0
+		return nil
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+	if err != nil {
+		return errSlowPath
+	}
+
+	*f = n
+	return nil
+}
+
+func (d *reportDecoder) textValue(name []byte, v interface{ UnmarshalText([]byte) error }) error {
+	value, err := d.value(name)
+	if err != nil {
+		return err
+	}
+
+	if v.UnmarshalText(value) != nil {
+		// left to encoding/xml to report as RecordError, or to OnPolicyError,
+		// with its position
+		return errSlowPath
+	}
+
+	return nil
+}
+
+// next reads the next token. Comments and processing instructions are skipped.
+func (d *reportDecoder) next() (tokenKind, error) {
+	if d.pendingEnd {
+		d.pendingEnd = false
+		return tokenEnd, nil
+	}
+
+	for {
+		if d.pos >= len(d.content) {
+			return tokenEOF, nil
+		}
+
+		rest := d.content[d.pos:]
+		if rest[0] != '<' {
+			return tokenText, d.readText()
+		}
+
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			// "--" is only allowed as the end of a comment
+			end := bytes.Index(rest[4:], []byte("--"))
+			if end < 0 || 4+end+2 >= len(rest) || rest[4+end+2] != '>' {
+				return 0, errSlowPath
+			}
+			d.pos += 4 + end + 3
+		case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+			end := bytes.Index(rest[9:], []byte("]]>"))
+			if end < 0 || !validChars(rest[9:9+end]) {
+				return 0, errSlowPath
+			}
+			d.text = rest[9 : 9+end]
+			d.pos += 9 + end + 3
+			return tokenText, nil
+		case bytes.HasPrefix(rest, []byte("<?")):
+			end := bytes.Index(rest[2:], []byte("?>"))
+			if end < 0 || !validProcInst(rest[2:2+end]) {
+				return 0, errSlowPath
+			}
+			d.pos += 2 + end + 2
+		case bytes.HasPrefix(rest, []byte("<!DOCTYPE")):
+			end := doctypeEnd(rest)
+			if end < 0 {
+				return 0, errSlowPath
+			}
+			d.pos += end
+		case bytes.HasPrefix(rest, []byte("<!")):
+			return 0, errSlowPath
+		case bytes.HasPrefix(rest, []byte("</")):
+			d.pos += 2
+			if !d.readName() {
+				return 0, errSlowPath
+			}
+			d.skipSpace()
+			if d.pos >= len(d.content) || d.content[d.pos] != '>' {
+				return 0, errSlowPath
+			}
+			d.pos++
+			return tokenEnd, nil
+		default:
+			d.pos++
+			if !d.readName() || !d.readAttrs() {
+				return 0, errSlowPath
+			}
+			return tokenStart, nil
+		}
+	}
+}
+
+func (d *reportDecoder) readName() bool {
+	start := d.pos
+	for d.pos < len(d.content) && isNameByte(d.content[d.pos], d.pos == start) {
+		d.pos++
+	}
+	d.name = d.content[start:d.pos]
+
+	// names with several colons are rejected by some versions of encoding/xml
+	return len(d.name) > 0 && bytes.Count(d.name, []byte(":")) <= 1
+}
+
+// readAttrs skips attributes up to the end of the start element.
+func (d *reportDecoder) readAttrs() bool {
+	for {
+		d.skipSpace()
+		if d.pos >= len(d.content) {
+			return false
+		}
+
+		switch d.content[d.pos] {
+		case '>':
+			d.pos++
+			return true
+		case '/':
+			if d.pos+1 >= len(d.content) || d.content[d.pos+1] != '>' {
+				return false
+			}
+			d.pos += 2
+			d.pendingEnd = true
+			return true
+		}
+
+		name := d.name
+		if !d.readName() {
+			return false
+		}
+		d.name = name
+
+		d.skipSpace()
+		if d.pos >= len(d.content) || d.content[d.pos] != '=' {
+			return false
+		}
+		d.pos++
+		d.skipSpace()
+		if d.pos >= len(d.content) || (d.content[d.pos] != '"' && d.content[d.pos] != '\'') {
+			return false
+		}
+
+		end := bytes.IndexByte(d.content[d.pos+1:], d.content[d.pos])
+		if end < 0 {
+			return false
+		}
+		value := d.content[d.pos+1 : d.pos+1+end]
+		if bytes.ContainsAny(value, "<&") || !validChars(value) {
+			return false
+		}
+		d.pos += end + 2
+	}
+}
+
+func (d *reportDecoder) skipSpace() {
+	for d.pos < len(d.content) && isSpace(d.content[d.pos]) {
+		d.pos++
+	}
+}
+
+// readText reads text up to the next element, replacing entities.
+// The result points into content when there is nothing to replace.
+func (d *reportDecoder) readText() error {
+	end := bytes.IndexByte(d.content[d.pos:], '<')
+	if end < 0 {
+		end = len(d.content) - d.pos
+	}
+	text := d.content[d.pos : d.pos+end]
+	d.pos += end
+
+	if !validChars(text) {
+		return errSlowPath
+	}
+
+	if bytes.IndexByte(text, '&') < 0 {
+		d.text = text
+		return nil
+	}
+
+	start := len(d.scratch)
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '&')
+		if i < 0 {
+			d.scratch = append(d.scratch, text...)
+			break
+		}
+		d.scratch = append(d.scratch, text[:i]...)
+		text = text[i+1:]
+
+		semi := bytes.IndexByte(text, ';')
+		if semi < 0 {
+			return errSlowPath
+		}
+		r, ok := entityRune(text[:semi])
+		if !ok {
+			return errSlowPath
+		}
+		d.scratch = utf8.AppendRune(d.scratch, r)
+		text = text[semi+1:]
+	}
+	d.text = d.scratch[start:]
+
+	return nil
+}
+
+// normalizeNewlines replaces "\r\n" and "\r" with "\n" in a text token,
+// like encoding/xml does.
+func (d *reportDecoder) normalizeNewlines(text []byte) []byte {
+	if bytes.IndexByte(text, '\r') < 0 {
+		return text
+	}
+
+	start := len(d.scratch)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\r' {
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+			d.scratch = append(d.scratch, '\n')
+			continue
+		}
+		d.scratch = append(d.scratch, text[i])
+	}
+
+	return d.scratch[start:]
+}
+
+func entityRune(name []byte) (rune, bool) {
+	switch string(name) {
+	case "lt":
+		return '<', true
+	case "gt":
+		return '>', true
+	case "amp":
+		return '&', true
+	case "apos":
+		return '\'', true
+	case "quot":
+		return '"', true
+	}
+
+	if len(name) < 2 || name[0] != '#' {
+		return 0, false
+	}
+
+	var n uint64
+	var err error
+	if name[1] == 'x' {
+		n, err = strconv.ParseUint(string(name[2:]), 16, 32)
+	} else {
+		n, err = strconv.ParseUint(string(name[1:]), 10, 32)
+	}
+	// encoding/xml keeps "&#13;" as is, unlike a literal "\r"
+	if err != nil || !isXMLChar(rune(n)) || n == '\r' {
+		return 0, false
+	}
+
+	return rune(n), true
+}
+
+// doctypeEnd returns the length of a DOCTYPE declaration without an internal subset,
+// or -1 when there is one, as it may define entities used later on.
+func doctypeEnd(decl []byte) int {
+	var quote byte
+	for i, b := range decl {
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '[' || b == '<' && i > 0:
+			return -1
+		case b == '>':
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// validProcInst accepts processing instructions encoding/xml accepts:
+// the XML declaration has to declare version 1.0, if any.
+func validProcInst(inst []byte) bool {
+	target := inst
+	if i := bytes.IndexAny(inst, " \t\r\n"); i >= 0 {
+		target = inst[:i]
+	}
+	if len(target) == 0 {
+		return false
+	}
+	for i, b := range target {
+		if !isNameByte(b, i == 0) {
+			return false
+		}
+	}
+	if string(target) != "xml" {
+		return true
+	}
+
+	return !bytes.Contains(inst, []byte("version")) ||
+		bytes.Contains(inst, []byte(`version="1.0"`)) ||
+		bytes.Contains(inst, []byte(`version='1.0'`))
+}
+
+// validChars reports whether text has no characters forbidden in XML.
+// Content is valid UTF-8 at this point, see normalizeEncoding,
+// so only control characters and U+FFFE, U+FFFF need to be checked.
+func validChars(text []byte) bool {
+	for i, b := range text {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			return false
+		}
+		if b == 0xEF && i+2 < len(text) && text[i+1] == 0xBF && (text[i+2] == 0xBE || text[i+2] == 0xBF) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+// isNameByte accepts ASCII name characters only,
+// names with other characters go to encoding/xml.
+func isNameByte(b byte, first bool) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', b == '_', b == ':':
+		return true
+	case '0' <= b && b <= '9', b == '-', b == '.':
+		return !first
+	}
+
+	return false
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// localName strips the namespace prefix like encoding/xml does.
+func localName(name []byte) []byte {
+	i := bytes.IndexByte(name, ':')
+	if i <= 0 || i == len(name)-1 {
+		return name
+	}
+
+	return name[i+1:]
+}
@@ -0,0 +1,161 @@
+package dmark
+
+import (
+	"net"
+	"sort"
+)
+
+// SummaryDiff describes changes between two summaries,
+// e.g. of the weeks before and after an infrastructure migration.
+type SummaryDiff struct {
+	Before  Counts       `json:"before"`
+	After   Counts       `json:"after"`
+	Domains []DomainDiff `json:"domains"` // Of either summary, sorted by domain name
+}
+
+// DomainDiff describes changes of a policy domain.
+type DomainDiff struct {
+	Domain        string          `json:"domain"`
+	Before        Counts          `json:"before"`
+	After         Counts          `json:"after"`
+	PolicyChanged bool            `json:"policy_changed"` // p, sp, pct or alignment modes differ
+	Policy        PolicyPublished `json:"policy"`         // The policy after, or before when the domain is gone
+	New           []SourceSummary `json:"new"`            // Sources seen after only, by messages
+	Gone          []SourceSummary `json:"gone"`           // Sources seen before only, by messages
+	Failing       []SourceChange  `json:"failing"`        // Sources mostly passing DMARC before and failing after
+	Recovered     []SourceChange  `json:"recovered"`      // Sources mostly failing DMARC before and passing after
+	Shifted       []SourceChange  `json:"shifted"`        // Other sources whose volume at least halved or grew by half
+}
+
+// Changed reports whether the domain has changes other than its message counts.
+func (d DomainDiff) Changed() bool {
+	return d.PolicyChanged ||
+		len(d.New) > 0 ||
+		len(d.Gone) > 0 ||
+		len(d.Failing) > 0 ||
+		len(d.Recovered) > 0 ||
+		len(d.Shifted) > 0
+}
+
+// SourceChange holds counts of a source before and after.
+type SourceChange struct {
+	SourceIP net.IP `json:"source_ip"`
+	Before   Counts `json:"before"`
+	After    Counts `json:"after"`
+}
+
+// Diff compares summaries of two reports or two periods, see Summarize.
+// A source is passing when most of its messages pass DMARC.
+func Diff(a, b Summary) SummaryDiff {
+	diff := SummaryDiff{Before: a.Counts, After: b.Counts, Domains: []DomainDiff{}}
+
+	before := map[string]DomainSummary{}
+	for _, domain := range a.Domains {
+		before[domain.Domain] = domain
+	}
+	after := map[string]DomainSummary{}
+	for _, domain := range b.Domains {
+		after[domain.Domain] = domain
+	}
+
+	for name, domain := range before {
+		if _, ok := after[name]; !ok {
+			diff.Domains = append(diff.Domains, diffDomain(domain, DomainSummary{Domain: name}))
+		}
+	}
+	for name, domain := range after {
+		diff.Domains = append(diff.Domains, diffDomain(before[name], domain))
+	}
+	sort.Slice(diff.Domains, func(i, j int) bool {
+		return diff.Domains[i].Domain < diff.Domains[j].Domain
+	})
+
+	return diff
+}
+
+func diffDomain(a, b DomainSummary) DomainDiff {
+	diff := DomainDiff{
+		Domain:    b.Domain,
+		Before:    a.Counts,
+		After:     b.Counts,
+		Policy:    b.Policy,
+		New:       []SourceSummary{},
+		Gone:      []SourceSummary{},
+		Failing:   []SourceChange{},
+		Recovered: []SourceChange{},
+		Shifted:   []SourceChange{},
+	}
+	if b.Reports == 0 {
+		diff.Policy = a.Policy
+	}
+	if a.Reports > 0 && b.Reports > 0 {
+		pa, pb := a.Policy, b.Policy
+		diff.PolicyChanged = pa.P != pb.P || pa.SP != pb.SP || pa.Pct != pb.Pct || pa.ADKIM != pb.ADKIM || pa.ASPF != pb.ASPF
+	}
+
+	before := map[string]Counts{}
+	for _, source := range a.Sources {
+		before[source.SourceIP.String()] = source.Counts
+	}
+	seen := map[string]bool{}
+
+	for _, source := range b.Sources {
+		key := source.SourceIP.String()
+		seen[key] = true
+
+		counts, ok := before[key]
+		if !ok {
+			diff.New = append(diff.New, source)
+			continue
+		}
+
+		change := SourceChange{SourceIP: source.SourceIP, Before: counts, After: source.Counts}
+		switch wasPassing, passing := counts.passing(), source.passing(); {
+		case wasPassing && !passing:
+			diff.Failing = append(diff.Failing, change)
+		case !wasPassing && passing:
+			diff.Recovered = append(diff.Recovered, change)
+		case 2*source.Messages <= counts.Messages || 2*source.Messages >= 3*counts.Messages:
+			diff.Shifted = append(diff.Shifted, change)
+		}
+	}
+	for _, source := range a.Sources {
+		if !seen[source.SourceIP.String()] {
+			diff.Gone = append(diff.Gone, source)
+		}
+	}
+
+	sortByMessages(diff.New)
+	sortByMessages(diff.Gone)
+	sortChanges(diff.Failing, func(c SourceChange) int { return c.After.Failed() })
+	sortChanges(diff.Recovered, func(c SourceChange) int { return c.After.Passed })
+	sortChanges(diff.Shifted, func(c SourceChange) int {
+		delta := c.After.Messages - c.Before.Messages
+		if delta < 0 {
+			return -delta
+		}
+		return delta
+	})
+
+	return diff
+}
+
+func (c Counts) passing() bool {
+	return 2*c.Passed > c.Messages
+}
+
+func sortByMessages(sources []SourceSummary) {
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Messages > sources[j].Messages
+	})
+}
+
+// sortChanges sorts changes by key, descending, then by source IP.
+func sortChanges(changes []SourceChange, key func(SourceChange) int) {
+	sort.Slice(changes, func(i, j int) bool {
+		if ki, kj := key(changes[i]), key(changes[j]); ki != kj {
+			return ki > kj
+		}
+		return changes[i].SourceIP.String() < changes[j].SourceIP.String()
+	})
+}
@@ -0,0 +1,154 @@
+package dmark
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrDKIMKeyNotFound is returned by LookupDKIMKey when the selector has no key record.
+var ErrDKIMKeyNotFound = errors.New("DKIM key not found")
+
+// DKIMKey is a DKIM public key record (RFC 6376 Section 3.6.1).
+type DKIMKey struct {
+	Version   string           // The "v=" tag, DKIM1 when present
+	KeyType   string           // The "k=" tag, rsa by default
+	Hashes    []string         // The "h=" tag, acceptable hash algorithms
+	Services  []string         // The "s=" tag, service types
+	Flags     []string         // The "t=" tag, "y" means testing mode
+	Notes     string           // The "n=" tag
+	PublicKey crypto.PublicKey // *rsa.PublicKey or ed25519.PublicKey, nil for revoked keys
+	Revoked   bool             // The "p=" tag is empty
+}
+
+// Bits returns the public key size in bits.
+func (k *DKIMKey) Bits() int {
+	switch key := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case ed25519.PublicKey:
+		return len(key) * 8
+	}
+
+	return 0
+}
+
+// Testing reports whether the domain is testing DKIM ("t=y").
+func (k *DKIMKey) Testing() bool {
+	for _, flag := range k.Flags {
+		if flag == "y" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LookupDKIMKey retrieves and parses the key record at selector._domainkey.domain.
+func LookupDKIMKey(ctx context.Context, selector, domain string) (*DKIMKey, error) {
+	name := selector + "._domainkey." + domain
+	txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ErrDKIMKeyNotFound
+		}
+		return nil, fmt.Errorf("lookup TXT %q: %w", name, err)
+	}
+
+	for _, txt := range txts {
+		tags := parseTagList(txt)
+		if _, ok := tags["p"]; !ok {
+			continue
+		}
+
+		key, err := parseDKIMKey(tags)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", name, err)
+		}
+		return key, nil
+	}
+
+	return nil, ErrDKIMKeyNotFound
+}
+
+func parseDKIMKey(tags map[string]string) (*DKIMKey, error) {
+	key := &DKIMKey{
+		Version:  tags["v"],
+		KeyType:  strings.ToLower(tags["k"]),
+		Hashes:   splitTagValue(tags["h"]),
+		Services: splitTagValue(tags["s"]),
+		Flags:    splitTagValue(tags["t"]),
+		Notes:    tags["n"],
+	}
+	if key.KeyType == "" {
+		key.KeyType = "rsa"
+	}
+	if key.Version != "" && key.Version != "DKIM1" {
+		return nil, fmt.Errorf("unsupported version %q", key.Version)
+	}
+
+	data := strings.Join(strings.Fields(tags["p"]), "")
+	if data == "" {
+		key.Revoked = true
+		return key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode public key: %w", err)
+	}
+
+	switch key.KeyType {
+	case "rsa":
+		if key.PublicKey, err = x509.ParsePKIXPublicKey(raw); err != nil {
+			// some signers publish a bare RSAPublicKey
+			if key.PublicKey, err = x509.ParsePKCS1PublicKey(raw); err != nil {
+				return nil, fmt.Errorf("parse RSA public key: %w", err)
+			}
+		}
+		if _, ok := key.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, errors.New("public key is not RSA")
+		}
+	case "ed25519":
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ed25519 public key of %d bytes", len(raw))
+		}
+		key.PublicKey = ed25519.PublicKey(raw)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.KeyType)
+	}
+
+	return key, nil
+}
+
+// parseTagList parses "tag=value; tag=value" lists used by DKIM, DMARC and BIMI records.
+func parseTagList(text string) map[string]string {
+	tags := map[string]string{}
+	for _, spec := range strings.Split(text, ";") {
+		i := strings.Index(spec, "=")
+		if i < 0 {
+			continue
+		}
+		tags[strings.TrimSpace(spec[:i])] = strings.TrimSpace(spec[i+1:])
+	}
+
+	return tags
+}
+
+func splitTagValue(value string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, ":") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
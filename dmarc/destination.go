@@ -0,0 +1,187 @@
+package dmarc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// minMaxSize is the size limit of report destinations under which Check
+// warns: aggregate reports of busy domains are larger, and are not sent.
+const minMaxSize = 1 << 20
+
+// URI is a report destination of rua or ruf (RFC 7489 Section 6.2),
+// e.g. "mailto:dmarc@example.com!10m".
+type URI struct {
+	Scheme  string // Lower-cased, mailto in practice
+	Address string // Of mailto, or the rest of the URI of other schemes
+	MaxSize int64  // In bytes, 0 without a limit
+}
+
+// sizeUnits are multipliers of size limit units.
+var sizeUnits = map[byte]int64{'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30, 't': 1 << 40}
+
+// ParseURI parses a report destination with an optional size limit.
+func ParseURI(s string) (URI, error) {
+	uri := URI{}
+	s = strings.TrimSpace(s)
+
+	if i := strings.LastIndex(s, "!"); i >= 0 {
+		limit := strings.ToLower(s[i+1:])
+		s = s[:i]
+
+		multiplier := int64(1)
+		if n := len(limit); n > 0 && sizeUnits[limit[n-1]] != 0 {
+			multiplier = sizeUnits[limit[n-1]]
+			limit = limit[:n-1]
+		}
+		size, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || size <= 0 {
+			return uri, fmt.Errorf("invalid size limit %q, want a number with an optional unit k, m, g or t", s[i+1:])
+		}
+		uri.MaxSize = size * multiplier
+	}
+
+	scheme, rest, ok := strings.Cut(s, ":")
+	if !ok || scheme == "" || rest == "" {
+		return uri, fmt.Errorf("invalid URI %q, want mailto:<address>", s)
+	}
+	uri.Scheme, uri.Address = strings.ToLower(scheme), rest
+
+	if uri.Scheme == "mailto" {
+		address, err := mail.ParseAddress(rest)
+		if err != nil || address.Name != "" || address.Address != rest {
+			return uri, fmt.Errorf("invalid address %q", rest)
+		}
+	}
+
+	return uri, nil
+}
+
+// Domain returns the domain of the mailto address, empty for other schemes.
+func (u URI) Domain() string {
+	if u.Scheme != "mailto" {
+		return ""
+	}
+
+	i := strings.LastIndex(u.Address, "@")
+	return strings.TrimSuffix(strings.ToLower(u.Address[i+1:]), ".")
+}
+
+// Destination is a report destination of a DMARC record with what is wrong with it.
+type Destination struct {
+	Tag      string   `json:"tag"` // rua or ruf
+	URI      string   `json:"uri"` // As published
+	Problems []string `json:"problems"`
+}
+
+// Check verifies the report destinations of the policy of a domain,
+// usually a live Record: that rua is set, URIs are mailto addresses with
+// reasonable size limits, their domains accept mail, and destinations outside
+// the organizational domain authorize reports for it with a
+// <domain>._report._dmarc.<destination> record (RFC 7489 Section 7.1).
+// It returns a destination for each URI, and problems of the policy itself.
+func (c *Checker) Check(ctx context.Context, policy dmark.PolicyPublished) ([]Destination, []string) {
+	problems := []string{}
+	if strings.TrimSpace(policy.RUA) == "" {
+		problems = append(problems, "no rua: aggregate reports are not sent")
+	}
+
+	destinations := []Destination{}
+	for _, tag := range []struct{ name, value string }{{"rua", policy.RUA}, {"ruf", policy.RUF}} {
+		for _, s := range strings.Split(tag.value, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			destinations = append(destinations, Destination{
+				Tag:      tag.name,
+				URI:      s,
+				Problems: c.checkURI(ctx, policy.Domain, s),
+			})
+		}
+	}
+
+	return destinations, problems
+}
+
+func (c *Checker) checkURI(ctx context.Context, domain, s string) []string {
+	problems := []string{}
+
+	uri, err := ParseURI(s)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	if uri.Scheme != "mailto" {
+		return append(problems, fmt.Sprintf("%s: reporters send reports by mail only, use mailto:", uri.Scheme))
+	}
+	if uri.MaxSize > 0 && uri.MaxSize < minMaxSize {
+		limit := s[strings.LastIndex(s, "!")+1:]
+		problems = append(problems, fmt.Sprintf("size limit %s is under 1m: larger reports are not sent, and reports of busy domains are larger", limit))
+	}
+
+	destination := uri.Domain()
+	if err = c.checkMail(ctx, destination); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if dmark.OrganizationalDomain(destination) != dmark.OrganizationalDomain(domain) {
+		if err = c.checkAuthorization(ctx, domain, destination); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
+
+// checkMail checks that the domain accepts mail: it has MX records,
+// or an address for the implicit MX (RFC 5321 Section 5.1).
+func (c *Checker) checkMail(ctx context.Context, domain string) error {
+	mxs, err := c.resolver().LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		if len(mxs) == 1 && mxs[0].Host == "." {
+			return fmt.Errorf("%s accepts no mail, it has a null MX", domain)
+		}
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("lookup MX %q: %w", domain, err)
+	}
+
+	addrs, err := c.resolver().LookupIPAddr(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("lookup %q: %w", domain, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s has no MX or address records, mail to it bounces", domain)
+	}
+
+	return nil
+}
+
+// checkAuthorization checks that the external destination accepts reports
+// for the domain (RFC 7489 Section 7.1); a wildcard record authorizes all domains.
+func (c *Checker) checkAuthorization(ctx context.Context, domain, destination string) error {
+	name := domain + "._report._dmarc." + destination
+	txts, err := c.resolver().LookupTXT(ctx, name)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("lookup TXT %q: %w", name, err)
+	}
+
+	for _, txt := range txts {
+		if isRecord(txt) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("external destination %s does not accept reports for %s: no v=DMARC1 record at %s", destination, domain, name)
+}
+
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
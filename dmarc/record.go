@@ -0,0 +1,153 @@
+// Package dmarc looks up DMARC records (RFC 7489 Section 6) published in DNS
+// and checks where they send reports.
+package dmarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// ErrNoRecord is returned by LookupRecord when neither the domain nor its
+// organizational domain publishes a DMARC record.
+var ErrNoRecord = errors.New("no DMARC record")
+
+// Record is a published DMARC record.
+type Record struct {
+	Name   string                // Where it was found, _dmarc.<domain>
+	Text   string                // As published
+	Policy dmark.PolicyPublished // With the domain it was found for, like in reports
+}
+
+// Checker looks up DMARC records and checks their report destinations.
+type Checker struct {
+	Resolver *net.Resolver // net.DefaultResolver when nil
+}
+
+func (c *Checker) resolver() *net.Resolver {
+	if c.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return c.Resolver
+}
+
+// LookupRecord fetches and parses the DMARC record of the domain, falling
+// back to that of its organizational domain like receivers do
+// (RFC 7489 Section 6.6.3), see dmark.OrganizationalDomain.
+func LookupRecord(ctx context.Context, domain string) (*Record, error) {
+	return (&Checker{}).LookupRecord(ctx, domain)
+}
+
+// LookupRecord fetches and parses the DMARC record of the domain, see LookupRecord.
+func (c *Checker) LookupRecord(ctx context.Context, domain string) (*Record, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	record, err := c.lookup(ctx, domain)
+	if errors.Is(err, ErrNoRecord) {
+		if org := dmark.OrganizationalDomain(domain); org != domain {
+			return c.lookup(ctx, org)
+		}
+	}
+
+	return record, err
+}
+
+func (c *Checker) lookup(ctx context.Context, domain string) (*Record, error) {
+	name := "_dmarc." + domain
+	txts, err := c.resolver().LookupTXT(ctx, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, fmt.Errorf("%w at %s", ErrNoRecord, name)
+		}
+		return nil, fmt.Errorf("lookup TXT %q: %w", name, err)
+	}
+
+	found := []string{}
+	for _, txt := range txts {
+		if isRecord(txt) {
+			found = append(found, txt)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%w at %s", ErrNoRecord, name)
+	case 1:
+	default:
+		// receivers ignore all of them (RFC 7489 Section 6.6.3)
+		return nil, fmt.Errorf("%d DMARC records at %s, receivers ignore them all", len(found), name)
+	}
+
+	policy, err := Parse(found[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	policy.Domain = domain
+
+	return &Record{Name: name, Text: found[0], Policy: policy}, nil
+}
+
+// isRecord reports whether the TXT record starts with "v=DMARC1".
+func isRecord(txt string) bool {
+	tag, _, _ := strings.Cut(txt, ";")
+	name, value, ok := strings.Cut(tag, "=")
+	return ok && strings.TrimSpace(name) == "v" && strings.TrimSpace(value) == "DMARC1"
+}
+
+// Parse parses the text of a DMARC record, like "v=DMARC1; p=reject; rua=mailto:dmarc@example.com",
+// into the policy reports have. Unknown tags are ignored; pct is 100 when absent.
+func Parse(text string) (dmark.PolicyPublished, error) {
+	policy := dmark.PolicyPublished{Pct: 100}
+	if !isRecord(text) {
+		return policy, fmt.Errorf("not a DMARC record: %q", text)
+	}
+
+	hasPolicy := false
+	for _, spec := range strings.Split(text, ";") {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			continue
+		}
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+
+		var err error
+		switch name {
+		case "p":
+			err = policy.P.UnmarshalText([]byte(value))
+			hasPolicy = true
+		case "sp":
+			err = policy.SP.UnmarshalText([]byte(value))
+		case "np":
+			err = policy.NP.UnmarshalText([]byte(value))
+		case "adkim":
+			err = policy.ADKIM.UnmarshalText([]byte(value))
+		case "aspf":
+			err = policy.ASPF.UnmarshalText([]byte(value))
+		case "fo":
+			err = policy.Fo.UnmarshalText([]byte(value))
+		case "pct":
+			if policy.Pct, err = strconv.Atoi(value); err == nil && (policy.Pct < 0 || policy.Pct > 100) {
+				err = errors.New("out of range")
+			}
+		case "ri":
+			policy.RI, err = strconv.Atoi(value)
+		case "rua":
+			policy.RUA = value
+		case "ruf":
+			policy.RUF = value
+		case "t":
+			policy.Testing = value
+		}
+		if err != nil {
+			return policy, fmt.Errorf("invalid %s=%s: %w", name, value, err)
+		}
+	}
+	if !hasPolicy {
+		return policy, errors.New("no policy (p=)")
+	}
+
+	return policy, nil
+}
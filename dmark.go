@@ -4,11 +4,35 @@ package dmark
 // https://tools.ietf.org/html/rfc7489#appendix-C
 
 import (
-	"fmt"
+	"bytes"
+	"encoding"
 	"net"
 	"strings"
 )
 
+// Enum types marshal by value and unmarshal by pointer, so values encode
+// the same whether they are addressable or not, e.g. in maps and interfaces.
+// Their empty text is the zero value, the absent element.
+var (
+	_ encoding.TextMarshaler = Alignment(0)
+	_ encoding.TextMarshaler = Disposition(0)
+	_ encoding.TextMarshaler = Fo(0)
+	_ encoding.TextMarshaler = Result(false)
+	_ encoding.TextMarshaler = PolicyOverride(0)
+	_ encoding.TextMarshaler = DKIMResult(0)
+	_ encoding.TextMarshaler = SPFDomainScope(0)
+	_ encoding.TextMarshaler = SPFResult(0)
+
+	_ encoding.TextUnmarshaler = (*Alignment)(nil)
+	_ encoding.TextUnmarshaler = (*Disposition)(nil)
+	_ encoding.TextUnmarshaler = (*Fo)(nil)
+	_ encoding.TextUnmarshaler = (*Result)(nil)
+	_ encoding.TextUnmarshaler = (*PolicyOverride)(nil)
+	_ encoding.TextUnmarshaler = (*DKIMResult)(nil)
+	_ encoding.TextUnmarshaler = (*SPFDomainScope)(nil)
+	_ encoding.TextUnmarshaler = (*SPFResult)(nil)
+)
+
 // The time range in UTC covered by messages in this report, specified in seconds since epoch.
 type DateRange struct {
 	Begin int `xml:"begin" json:"begin"`
@@ -25,11 +49,26 @@ type ReportMetadata struct {
 	Errors           []string  `xml:"error,omitempty" json:"error,omitempty"`
 }
 
+// enumValue trims and lower-cases an enum value for matching,
+// allocating only when the value has upper-case or non-ASCII letters.
+func enumValue(text []byte) []byte {
+	text = bytes.TrimSpace(text)
+	for _, b := range text {
+		if b >= 0x80 || 'A' <= b && b <= 'Z' {
+			return bytes.ToLower(text)
+		}
+	}
+
+	return text
+}
+
 // Alignment mode (relaxed or strict) for DKIM and SPF.
+// The zero value means the element was absent.
 type Alignment int
 
 const (
-	AlignmentRelaxed Alignment = iota
+	AlignmentUnknown Alignment = iota + 1 // Unrecognized value
+	AlignmentRelaxed
 	AlignmentStrict
 )
 
@@ -37,6 +76,8 @@ func (a Alignment) MarshalText() (text []byte, err error) {
 	switch a {
 	default:
 		return []byte("unknown"), nil
+	case 0:
+		return []byte{}, nil
 	case AlignmentRelaxed:
 		return []byte("r"), nil
 	case AlignmentStrict:
@@ -45,9 +86,14 @@ func (a Alignment) MarshalText() (text []byte, err error) {
 }
 
 func (a *Alignment) UnmarshalText(text []byte) error {
-	switch strings.ToLower(string(text)) {
+	switch string(enumValue(text)) {
+	case "":
+		*a = 0
+	case "unknown":
+		*a = AlignmentUnknown
 	default:
-		return fmt.Errorf("unexpected Alignment value %q", string(text))
+		*a = AlignmentUnknown
+		return &UnknownValueError{Field: "Alignment", Value: string(text)}
 	case "r":
 		*a = AlignmentRelaxed
 	case "s":
@@ -58,10 +104,12 @@ func (a *Alignment) UnmarshalText(text []byte) error {
 }
 
 // The policy actions specified by p and sp in the DMARC record.
+// The zero value means the element was absent.
 type Disposition int
 
 const (
-	DispositionNone Disposition = iota
+	DispositionUnknown Disposition = iota + 1 // Unrecognized value
+	DispositionNone
 	DispositionQuarantine
 	DispositionReject
 )
@@ -70,6 +118,8 @@ func (disp Disposition) MarshalText() (text []byte, err error) {
 	switch disp {
 	default:
 		return []byte("unknown"), nil
+	case 0:
+		return []byte{}, nil
 	case DispositionNone:
 		return []byte("none"), nil
 	case DispositionQuarantine:
@@ -80,9 +130,14 @@ func (disp Disposition) MarshalText() (text []byte, err error) {
 }
 
 func (disp *Disposition) UnmarshalText(text []byte) error {
-	switch strings.ToLower(string(text)) {
+	switch string(enumValue(text)) {
+	case "":
+		*disp = 0
+	case "unknown":
+		*disp = DispositionUnknown
 	default:
-		return fmt.Errorf("unexpected Disposition value %q", string(text))
+		*disp = DispositionUnknown
+		return &UnknownValueError{Field: "Disposition", Value: string(text)}
 	case "none":
 		*disp = DispositionNone
 	case "quarantine":
@@ -94,6 +149,75 @@ func (disp *Disposition) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Failure reporting options, a set of Fo* values.
+// The zero value means the element was absent, which is equivalent to Fo0.
+type Fo int
+
+const (
+	Fo0 Fo = 1 << iota // Report if all underlying authentication mechanisms fail to produce an aligned "pass" result
+	Fo1                // Report if any underlying authentication mechanism produced something other than an aligned "pass" result
+	FoD                // Report if the message had a signature that failed evaluation
+	FoS                // Report if the message failed SPF evaluation
+)
+
+var foValues = []struct {
+	fo   Fo
+	text string
+}{
+	{Fo0, "0"},
+	{Fo1, "1"},
+	{FoD, "d"},
+	{FoS, "s"},
+}
+
+// Has reports whether all options in opt are set.
+func (fo Fo) Has(opt Fo) bool {
+	return fo&opt == opt
+}
+
+func (fo Fo) MarshalText() (text []byte, err error) {
+	options := []string{}
+	for _, v := range foValues {
+		if fo.Has(v.fo) {
+			options = append(options, v.text)
+		}
+	}
+
+	return []byte(strings.Join(options, ":")), nil
+}
+
+// UnmarshalText sets the options recognized in text, returning
+// an UnknownValueError with the rest, separated with ":", if any.
+func (fo *Fo) UnmarshalText(text []byte) error {
+	*fo = 0
+
+	unknown := []string{}
+	for _, option := range strings.Split(string(text), ":") {
+		option = strings.ToLower(strings.TrimSpace(option))
+		if option == "" {
+			continue
+		}
+
+		found := false
+		for _, v := range foValues {
+			if v.text == option {
+				*fo |= v.fo
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, option)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return &UnknownValueError{Field: "Fo", Value: strings.Join(unknown, ":")}
+	}
+
+	return nil
+}
+
 // The DMARC policy that applied to the messages in this report.
 type PolicyPublished struct {
 	Domain string      `xml:"domain" json:"domain"`                   // The domain at which the DMARC record was found.
@@ -101,36 +225,69 @@ type PolicyPublished struct {
 	ASPF   Alignment   `xml:"aspf,omitempty" json:"aspf,omitempty"`   // The SPF alignment mode.
 	P      Disposition `xml:"p" json:"p"`                             // The policy to apply to messages from the domain.
 	SP     Disposition `xml:"sp" json:"sp"`                           // The policy to apply to messages from subdomains.
+	NP     Disposition `xml:"np,omitempty" json:"np,omitempty"`       // The policy to apply to messages from non-existent subdomains (RFC 9091).
 	Pct    int         `xml:"pct" json:"pct"`                         // The percent of messages to which policy applies.
-	Fo     string      `xml:"fo" json:"fo"`                           // Failure reporting options in effect.
+	Fo     Fo          `xml:"fo" json:"fo"`                           // Failure reporting options in effect.
+
+	// Elements below are not part of RFC 7489 schema, but are sent by some reporters.
+	RI         int        `xml:"ri,omitempty" json:"ri,omitempty"`           // The requested report interval in seconds.
+	RUA        string     `xml:"rua,omitempty" json:"rua,omitempty"`         // Addresses to which aggregate feedback is to be sent.
+	RUF        string     `xml:"ruf,omitempty" json:"ruf,omitempty"`         // Addresses to which failure reports are to be sent.
+	Testing    string     `xml:"testing,omitempty" json:"testing,omitempty"` // The testing mode flag.
+	Extensions Extensions `xml:",any,omitempty" json:"extensions,omitempty"` // Any other elements.
+}
+
+// PolicyFor returns the policy requested for messages from the given domain,
+// falling back from np to sp to p when the more specific policy is absent.
+// nonExistent tells whether domain does not exist in DNS (see RFC 9091).
+func (pp PolicyPublished) PolicyFor(domain string, nonExistent bool) Disposition {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if domain == strings.TrimSuffix(strings.ToLower(pp.Domain), ".") {
+		return pp.P
+	}
+
+	if nonExistent && pp.NP != 0 {
+		return pp.NP
+	}
+	if pp.SP != 0 {
+		return pp.SP
+	}
+
+	return pp.P
 }
 
 // The DMARC-aligned authentication result.
 // true - "pass", false – "fail"
 type Result bool
 
-func (r *Result) MarshalText() (text []byte, err error) {
-	if *r {
+func (r Result) MarshalText() (text []byte, err error) {
+	if r {
 		return []byte("pass"), nil
 	}
 
 	return []byte("fail"), nil
 }
 
+// UnmarshalText sets r for "pass". Any other value, including empty,
+// is a fail: reporters use "softfail" or "none" for policy_evaluated too.
 func (r *Result) UnmarshalText(text []byte) error {
-	*r = strings.ToLower(string(text)) == "pass"
+	*r = string(enumValue(text)) == "pass"
 
 	return nil
 }
 
 // Reasons that may affect DMARC disposition or execution thereof.
+// The zero value means the element was absent.
 type PolicyOverride int
 
 const (
+	// The reporter used a value not listed below.
+	PolicyOverrideUnknown PolicyOverride = iota + 1
+
 	// The message was relayed via a known forwarder, or local
 	// heuristics identified the message as likely having been forwarded.
 	// There is no expectation that authentication would pass.
-	PolicyOverrideForwarded PolicyOverride = iota
+	PolicyOverrideForwarded
 
 	// The message was exempted from application of policy
 	// by the "pct" setting in the DMARC policy record.
@@ -157,6 +314,8 @@ func (po PolicyOverride) MarshalText() (text []byte, err error) {
 	switch po {
 	default:
 		return []byte("unknown"), nil
+	case 0:
+		return []byte{}, nil
 	case PolicyOverrideForwarded:
 		return []byte("forwarded"), nil
 	case PolicyOverrideSampledOut:
@@ -173,9 +332,14 @@ func (po PolicyOverride) MarshalText() (text []byte, err error) {
 }
 
 func (po *PolicyOverride) UnmarshalText(text []byte) error {
-	switch strings.ToLower(string(text)) {
+	switch string(enumValue(text)) {
+	case "":
+		*po = 0
+	case "unknown":
+		*po = PolicyOverrideUnknown
 	default:
-		return fmt.Errorf("unexpected PolicyOverride value %q", string(text))
+		*po = PolicyOverrideUnknown
+		return &UnknownValueError{Field: "PolicyOverride", Value: string(text)}
 	case "forwarded":
 		*po = PolicyOverrideForwarded
 	case "sampled_out":
@@ -221,10 +385,12 @@ type Identifiers struct {
 }
 
 // DKIM verification result, according to RFC 7001 Section 2.6.1.
+// The zero value means the element was absent.
 type DKIMResult int
 
 const (
-	DKIMResultNone DKIMResult = iota
+	DKIMResultUnknown DKIMResult = iota + 1 // Unrecognized value
+	DKIMResultNone
 	DKIMResultPass
 	DKIMResultFail
 	DKIMResultPolicy
@@ -237,6 +403,8 @@ func (dkimr DKIMResult) MarshalText() (text []byte, err error) {
 	switch dkimr {
 	default:
 		return []byte("unknown"), nil
+	case 0:
+		return []byte{}, nil
 	case DKIMResultNone:
 		return []byte("none"), nil
 	case DKIMResultPass:
@@ -255,9 +423,14 @@ func (dkimr DKIMResult) MarshalText() (text []byte, err error) {
 }
 
 func (dkimr *DKIMResult) UnmarshalText(text []byte) error {
-	switch strings.ToLower(string(text)) {
+	switch string(enumValue(text)) {
+	case "":
+		*dkimr = 0
+	case "unknown":
+		*dkimr = DKIMResultUnknown
 	default:
-		return fmt.Errorf("unexpected SPFResult value %q", string(text))
+		*dkimr = DKIMResultUnknown
+		return &UnknownValueError{Field: "DKIMResult", Value: string(text)}
 	case "none":
 		*dkimr = DKIMResultNone
 	case "pass":
@@ -285,10 +458,12 @@ type DKIMAuthResult struct {
 }
 
 // SPF domain scope
+// The zero value means the element was absent.
 type SPFDomainScope int
 
 const (
-	SPFDomainScopeHelo SPFDomainScope = iota
+	SPFDomainScopeUnknown SPFDomainScope = iota + 1 // Unrecognized value
+	SPFDomainScopeHelo
 	SPFDomainScopeMFrom
 )
 
@@ -296,6 +471,8 @@ func (sds SPFDomainScope) MarshalText() (text []byte, err error) {
 	switch sds {
 	default:
 		return []byte("unknown"), nil
+	case 0:
+		return []byte{}, nil
 	case SPFDomainScopeHelo:
 		return []byte("helo"), nil
 	case SPFDomainScopeMFrom:
@@ -304,9 +481,14 @@ func (sds SPFDomainScope) MarshalText() (text []byte, err error) {
 }
 
 func (sds *SPFDomainScope) UnmarshalText(text []byte) error {
-	switch strings.ToLower(string(text)) {
+	switch string(enumValue(text)) {
+	case "":
+		*sds = 0
+	case "unknown":
+		*sds = SPFDomainScopeUnknown
 	default:
-		return fmt.Errorf("unexpected SPFDomainScope value %q", string(text))
+		*sds = SPFDomainScopeUnknown
+		return &UnknownValueError{Field: "SPFDomainScope", Value: string(text)}
 	case "helo":
 		*sds = SPFDomainScopeHelo
 	case "mfrom":
@@ -316,10 +498,13 @@ func (sds *SPFDomainScope) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// SPF verification result, according to RFC 7001 Section 2.6.2.
+// The zero value means the element was absent.
 type SPFResult int
 
 const (
-	SPFResultNone SPFResult = iota
+	SPFResultUnknown SPFResult = iota + 1 // Unrecognized value
+	SPFResultNone
 	SPFResultNeutral
 	SPFResultPass
 	SPFResultFail
@@ -332,6 +517,8 @@ func (spfr SPFResult) MarshalText() (text []byte, err error) {
 	switch spfr {
 	default:
 		return []byte("unknown"), nil
+	case 0:
+		return []byte{}, nil
 	case SPFResultNone:
 		return []byte("none"), nil
 	case SPFResultNeutral:
@@ -350,9 +537,14 @@ func (spfr SPFResult) MarshalText() (text []byte, err error) {
 }
 
 func (spfr *SPFResult) UnmarshalText(text []byte) error {
-	switch strings.ToLower(string(text)) {
+	switch string(enumValue(text)) {
+	case "":
+		*spfr = 0
+	case "unknown":
+		*spfr = SPFResultUnknown
 	default:
-		return fmt.Errorf("unexpected SPFResult value %q", string(text))
+		*spfr = SPFResultUnknown
+		return &UnknownValueError{Field: "SPFResult", Value: string(text)}
 	case "none":
 		*spfr = SPFResultNone
 	case "neutral":
@@ -373,15 +565,17 @@ func (spfr *SPFResult) UnmarshalText(text []byte) error {
 }
 
 type SPFAuthResult struct {
-	Domain string         `xml:"domain" json:"domain"` // The checked domain
-	Scope  SPFDomainScope `xml:"scope" json:"scope"`   // The scope of the checked domain
-	Result SPFResult      `xml:"result" json:"result"` // The SPF verification result
+	Domain string         `xml:"domain" json:"domain"`         // The checked domain
+	Scope  SPFDomainScope `xml:"scope,omitempty" json:"scope"` // The scope of the checked domain
+	Result SPFResult      `xml:"result" json:"result"`         // The SPF verification result
 }
 
 // This element contains DKIM and SPF results, uninterpreted with respect to DMARC
 type AuthResult struct {
 	DKIM []DKIMAuthResult `xml:"dkim" json:"dkim"` // There may be no DKIM signatures, or multiple DKIM signatures
 	SPF  []SPFAuthResult  `xml:"spf" json:"spf"`   // There will always be at least one SPF result
+
+	Extensions []RawElement `xml:",any" json:"extensions,omitempty"` // Any other elements
 }
 
 // This element contains all the authentication results that were evaluated
@@ -390,12 +584,18 @@ type Record struct {
 	Row         Row         `xml:"row" json:"row"`
 	Identifiers Identifiers `xml:"identifiers" json:"identifiers"`
 	AuthResult  AuthResult  `xml:"auth_results" json:"auth_results"`
+
+	Extensions []RawElement `xml:",any" json:"extensions,omitempty"` // Any other elements
 }
 
 // Parent
 type Feedback struct {
-	Version         int             `xml:"version,omitempty" json:"version,omitempty"` // The "version" for reports generated per this specification MUST be the value 1.0.
+	Version         float64         `xml:"version,omitempty" json:"version,omitempty"` // The "version" for reports generated per this specification MUST be the value 1.0.
 	ReportMetadata  ReportMetadata  `xml:"report_metadata" json:"report_metadata"`
 	PolicyPublished PolicyPublished `xml:"policy_published" json:"policy_published"`
-	Record          []Record        `xml:"record" json:"record"`
+	Records         []Record        `xml:"record" json:"record"`
+
+	Extensions []RawElement `xml:",any" json:"extensions,omitempty"` // Any other elements, e.g. extensions of RFC 7489 Appendix C
+
+	Origin *Origin `xml:"-" json:"origin,omitempty"` // The raw report, with Parser.TrackOrigin
 }
@@ -0,0 +1,120 @@
+package dmark
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type roundTripper interface {
+	comparable
+	encoding.TextMarshaler
+	json.Marshaler
+	driver.Valuer
+	MarshalYAML() (interface{}, error)
+}
+
+type roundTripperPtr[T any] interface {
+	*T
+	encoding.TextUnmarshaler
+	json.Unmarshaler
+	sql.Scanner
+}
+
+// testRoundTrip checks values come back the same from their text, JSON,
+// numeric JSON, YAML and SQL forms, without errors.
+func testRoundTrip[T roundTripper, P roundTripperPtr[T]](t *testing.T, values ...T) {
+	t.Helper()
+
+	for _, v := range values {
+		text, err := v.MarshalText()
+		if err != nil {
+			t.Fatalf("%T(%v): marshal text: %v", v, v, err)
+		}
+
+		var got T
+		if err = P(&got).UnmarshalText(text); err != nil || got != v {
+			t.Errorf("%T(%v): text %q unmarshalled to %v, %v", v, v, text, got, err)
+		}
+
+		for _, numeric := range []bool{false, true} {
+			data, err := JSONOptions{NumericEnums: numeric}.Marshal(v)
+			if err != nil {
+				t.Fatalf("%T(%v): marshal JSON: %v", v, v, err)
+			}
+
+			got = *new(T)
+			if err = json.Unmarshal(data, P(&got)); err != nil || got != v {
+				t.Errorf("%T(%v): JSON %s unmarshalled to %v, %v", v, v, data, got, err)
+			}
+		}
+
+		yaml, err := v.MarshalYAML()
+		if err != nil {
+			t.Fatalf("%T(%v): marshal YAML: %v", v, v, err)
+		}
+		s, ok := yaml.(string)
+		if !ok {
+			t.Fatalf("%T(%v): YAML is %T, want string", v, v, yaml)
+		}
+		got = *new(T)
+		if err = P(&got).UnmarshalText([]byte(s)); err != nil || got != v {
+			t.Errorf("%T(%v): YAML %q unmarshalled to %v, %v", v, v, s, got, err)
+		}
+
+		value, err := v.Value()
+		if err != nil {
+			t.Fatalf("%T(%v): SQL value: %v", v, v, err)
+		}
+		got = *new(T)
+		if err = P(&got).Scan(value); err != nil || got != v {
+			t.Errorf("%T(%v): SQL value %#v scanned to %v, %v", v, v, value, got, err)
+		}
+	}
+}
+
+func TestEnumRoundTrip(t *testing.T) {
+	t.Run("Alignment", func(t *testing.T) {
+		testRoundTrip(t, 0, AlignmentUnknown, AlignmentRelaxed, AlignmentStrict)
+	})
+	t.Run("Disposition", func(t *testing.T) {
+		testRoundTrip(t, 0, DispositionUnknown, DispositionNone, DispositionQuarantine, DispositionReject)
+	})
+	t.Run("Fo", func(t *testing.T) {
+		testRoundTrip(t, 0, Fo0, Fo1, FoD, FoS, Fo1|FoD|FoS)
+	})
+	t.Run("Result", func(t *testing.T) {
+		testRoundTrip(t, Result(false), Result(true))
+	})
+	t.Run("PolicyOverride", func(t *testing.T) {
+		testRoundTrip(t, 0, PolicyOverrideUnknown, PolicyOverrideForwarded, PolicyOverrideSampledOut,
+			PolicyOverrideTrustedForwarder, PolicyOverrideMailingList, PolicyOverrideLocalPolicy, PolicyOverrideOther)
+	})
+	t.Run("DKIMResult", func(t *testing.T) {
+		testRoundTrip(t, 0, DKIMResultUnknown, DKIMResultNone, DKIMResultPass, DKIMResultFail,
+			DKIMResultPolicy, DKIMResultNeutral, DKIMResultTempError, DKIMResultPermError)
+	})
+	t.Run("SPFDomainScope", func(t *testing.T) {
+		testRoundTrip(t, 0, SPFDomainScopeUnknown, SPFDomainScopeHelo, SPFDomainScopeMFrom)
+	})
+	t.Run("SPFResult", func(t *testing.T) {
+		testRoundTrip(t, 0, SPFResultUnknown, SPFResultNone, SPFResultNeutral, SPFResultPass, SPFResultFail,
+			SPFResultSoftFail, SPFResultTempError, SPFResultPermError)
+	})
+}
+
+func TestUnmarshalTextUnrecognized(t *testing.T) {
+	var disp Disposition
+	err := disp.UnmarshalText([]byte("bogus"))
+
+	var unknownErr *UnknownValueError
+	if !errors.As(err, &unknownErr) || unknownErr.Field != "Disposition" || unknownErr.Value != "bogus" {
+		t.Errorf("want UnknownValueError for Disposition %q, got %v", "bogus", err)
+	}
+	if disp != DispositionUnknown {
+		t.Errorf("want DispositionUnknown, got %v", disp)
+	}
+}
@@ -0,0 +1,122 @@
+// Package dmarkclient is a client of the dmarkd HTTP API, described by the
+// OpenAPI specification dmarkd serves at /openapi.json. Methods of Client are
+// generated from the same operations as the specification, see client.go.
+//
+//	c := dmarkclient.New("https://dmarc.example.com", os.Getenv("DMARKD_TOKEN"))
+//	portfolio, err := c.Portfolio(ctx, dmarkclient.PortfolioParams{Days: 7})
+package dmarkclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// maxErrorSize limits the body of error responses read.
+const maxErrorSize = 64 << 10
+
+// Client calls the API of a dmarkd server.
+type Client struct {
+	BaseURL    string       // Like "https://dmarc.example.com", without the trailing slash
+	Token      string       // Tenant or API token sent as "Authorization: Bearer <token>", see dmark-token
+	HTTPClient *http.Client // http.DefaultClient when nil
+}
+
+// New returns a client of the server at baseURL authenticating with token.
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// Error is returned for responses with a status other than 2xx,
+// with the message of their {"error": ...} body.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dmarkd: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IngestResponse is returned by Client.Ingest.
+type IngestResponse struct {
+	Saved    []string `json:"saved"`              // Names of stored reports
+	Skipped  []string `json:"skipped"`            // Reasons for skipped files
+	Warnings []string `json:"warnings,omitempty"` // Problems of saved reports, e.g. inverted date ranges
+	Codes    []string `json:"codes,omitempty"`    // Codes of the reasons in Skipped, see dmark.ErrorCode
+}
+
+// SearchResponse is returned by Client.Search.
+type SearchResponse struct {
+	Records   []dmark.FlatRecord `json:"records"`
+	Truncated bool               `json:"truncated"` // More records matched than the limit
+}
+
+// Health is returned by Client.Healthz and Client.Readyz.
+type Health struct {
+	Status string `json:"status"`          // "ok" or "unavailable"
+	Error  string `json:"error,omitempty"` // Why the server is unavailable
+}
+
+// send makes a request, returning the response when its status is 2xx.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, header http.Header, body io.Reader) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	content, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	errorBody := struct {
+		Error string `json:"error"`
+	}{}
+	if json.Unmarshal(content, &errorBody) == nil && errorBody.Error != "" {
+		apiErr.Message = errorBody.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(content))
+	}
+
+	return nil, apiErr
+}
+
+// decode reads the JSON body of the response into v, closing it.
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package dnsbl checks IP addresses against DNS blocklists (RFC 5782),
+// which tells spammers from misconfigured legitimate senders among sources failing DMARC.
+package dnsbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLists are commonly used blocklists. Spamhaus refuses queries
+// from public resolvers, use a local one or a Data Query Service zone.
+var DefaultLists = []string{"zen.spamhaus.org", "bl.spamcop.net", "b.barracudacentral.org"}
+
+// lookupTimeout bounds the lookups of an IP address in all lists.
+const lookupTimeout = 5 * time.Second
+
+// Listing is an entry of an IP address on a blocklist.
+type Listing struct {
+	List  string   `json:"list"`
+	Codes []string `json:"codes"` // Return codes, e.g. 127.0.0.2, which the list documents
+}
+
+// Result is the status of an IP address on the checked lists.
+type Result struct {
+	Listed   bool      `json:"listed"`
+	Listings []Listing `json:"listings,omitempty"`
+	Errors   []string  `json:"errors,omitempty"` // Lists that could not be checked
+}
+
+// Checker looks up IP addresses in blocklists, caching results.
+type Checker struct {
+	Lists    []string
+	Resolver *net.Resolver // net.DefaultResolver when nil
+
+	mu    sync.Mutex
+	cache map[string]Result
+}
+
+// Check looks up the IP address in all lists in parallel.
+func (c *Checker) Check(ctx context.Context, ip net.IP) Result {
+	key := ip.String()
+	c.mu.Lock()
+	result, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, list := range c.Lists {
+		wg.Add(1)
+		go func(list string) {
+			defer wg.Done()
+			codes, err := c.lookup(ctx, ip, list)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				result.Errors = append(result.Errors, list+": "+err.Error())
+			case len(codes) > 0:
+				result.Listed = true
+				result.Listings = append(result.Listings, Listing{List: list, Codes: codes})
+			}
+		}(list)
+	}
+	wg.Wait()
+
+	sort.Slice(result.Listings, func(i, j int) bool {
+		return result.Listings[i].List < result.Listings[j].List
+	})
+	sort.Strings(result.Errors)
+
+	if len(result.Errors) == 0 {
+		c.mu.Lock()
+		if c.cache == nil {
+			c.cache = map[string]Result{}
+		}
+		c.cache[key] = result
+		c.mu.Unlock()
+	}
+
+	return result
+}
+
+// lookup returns the codes the list returns for ip, none when it is not listed.
+func (c *Checker) lookup(ctx context.Context, ip net.IP, list string) ([]string, error) {
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	addrs, err := resolver.LookupHost(ctx, queryName(ip, list))
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for _, addr := range addrs {
+		code := net.ParseIP(addr)
+		if code == nil || code.To4() == nil || code.To4()[0] != 127 {
+			continue
+		}
+		if strings.HasPrefix(addr, "127.255.255.") {
+			// Spamhaus error codes, e.g. 127.255.255.254 for queries via public resolvers
+			return nil, fmt.Errorf("query refused with %s", addr)
+		}
+		codes = append(codes, addr)
+	}
+	sort.Strings(codes)
+
+	return codes, nil
+}
+
+// queryName returns the name to look up: reversed octets of IPv4 addresses,
+// or reversed nibbles of IPv6 addresses, under the list zone.
+func queryName(ip net.IP, list string) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.%s", ip4[3], ip4[2], ip4[1], ip4[0], list)
+	}
+
+	b := strings.Builder{}
+	ip16 := ip.To16()
+	for i := len(ip16) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip16[i]&0xf, ip16[i]>>4)
+	}
+	b.WriteString(list)
+
+	return b.String()
+}
+
+// ParseLists splits a comma-separated list of zones; "default" stands for DefaultLists.
+func ParseLists(value string) []string {
+	lists := []string{}
+	for _, list := range strings.Split(value, ",") {
+		switch list = strings.TrimSpace(list); list {
+		case "":
+		case "default":
+			lists = append(lists, DefaultLists...)
+		default:
+			lists = append(lists, list)
+		}
+	}
+
+	return lists
+}
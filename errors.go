@@ -0,0 +1,143 @@
+package dmark
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Error is a kind of error callers can tell apart with errors.Is,
+// with a code that stays the same across versions, e.g. for API responses.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Kinds of errors returned by parsing and saving reports.
+var (
+	// ErrNotXML is matched by errors of content that is not well-formed XML.
+	ErrNotXML = &Error{Code: "not_xml", Message: "not an XML document"}
+	// ErrSchemaViolation is matched by errors of values a report
+	// can't have according to the DMARK XML Schema.
+	ErrSchemaViolation = &Error{Code: "schema_violation", Message: "report violates the schema"}
+	// ErrDuplicateReport is matched by errors of saving a report that is already saved.
+	ErrDuplicateReport = &Error{Code: "duplicate_report", Message: "report already exists"}
+	// ErrEncoding is matched by errors of content in an unsupported or
+	// broken character encoding, like invalid UTF-8.
+	ErrEncoding = &Error{Code: "unsupported_encoding", Message: "report encoding is not supported"}
+	// ErrExternalEntity is matched by errors of reports declaring external entities.
+	ErrExternalEntity = &Error{Code: "external_entity", Message: "report declares external entities"}
+)
+
+// ErrorCode returns the code of the kind of err, see Error, or empty when
+// err is of none of them.
+func ErrorCode(err error) string {
+	for _, kind := range []*Error{ErrNotXML, ErrSchemaViolation, ErrDuplicateReport, ErrEncoding, ErrExternalEntity} {
+		if errors.Is(err, kind) {
+			return kind.Code
+		}
+	}
+
+	return ""
+}
+
+// encodingError is an error of decoding report content to UTF-8.
+type encodingError string
+
+func (e encodingError) Error() string {
+	return string(e)
+}
+
+// Is matches ErrEncoding.
+func (e encodingError) Is(target error) bool {
+	return target == ErrEncoding
+}
+
+// errExternalEntities is returned for reports declaring external entities.
+var errExternalEntities = &externalEntityError{}
+
+type externalEntityError struct{}
+
+func (e *externalEntityError) Error() string {
+	return "external entities are not allowed"
+}
+
+// Is matches ErrExternalEntity.
+func (e *externalEntityError) Is(target error) bool {
+	return target == ErrExternalEntity
+}
+
+// UnknownValueError is returned by UnmarshalText methods
+// when the value is not defined by the DMARK XML Schema.
+// They set the Unknown value of the type along with it, which marshals
+// to "unknown" and is unmarshalled back from it without an error.
+type UnknownValueError struct {
+	Field string // The type being unmarshalled, e.g. "Disposition"
+	Value string // The value as found in the report, for Fo the unknown options
+}
+
+func (e *UnknownValueError) Error() string {
+	return fmt.Sprintf("unexpected %s value %q", e.Field, e.Value)
+}
+
+// Is matches ErrSchemaViolation.
+func (e *UnknownValueError) Is(target error) bool {
+	return target == ErrSchemaViolation
+}
+
+// DecodeError is returned when a report could not be decoded.
+// Line and Offset point into the report content converted to UTF-8.
+type DecodeError struct {
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("line %d (offset %d): %v", e.Line, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrNotXML for syntax errors and content ending early,
+// and ErrSchemaViolation for other errors, like counts that are not numbers.
+func (e *DecodeError) Is(target error) bool {
+	var syntaxErr *xml.SyntaxError
+	notXML := errors.As(e.Err, &syntaxErr) || errors.Is(e.Err, io.EOF) || errors.Is(e.Err, io.ErrUnexpectedEOF)
+
+	switch target {
+	case ErrNotXML:
+		return notXML
+	case ErrSchemaViolation:
+		return !notXML
+	}
+	return false
+}
+
+// RecordError is passed to Parser.OnRecordError when a record could not be decoded.
+type RecordError struct {
+	Index  int // Position of the record in the report, starting from 0
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d, line %d (offset %d): %v", e.Index, e.Line, e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrSchemaViolation, as the record is well-formed XML.
+func (e *RecordError) Is(target error) bool {
+	return target == ErrSchemaViolation
+}
@@ -0,0 +1,55 @@
+package dmark
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"not XML", "report", "not_xml"},
+		{"truncated", "<feedback><report_metadata>", "not_xml"},
+		{"unknown value", "<feedback><policy_published><p>bogus</p></policy_published></feedback>", "schema_violation"},
+		{"odd UTF-16", "\xff\xfe<\x00f", "unsupported_encoding"},
+		{"invalid UTF-8", "<feedback><org_name>Caf\xe9</org_name></feedback>", "unsupported_encoding"},
+		{"invalid UTF-8 after BOM", "\xef\xbb\xbf<feedback>\xe9</feedback>", "unsupported_encoding"},
+		{"unsupported encoding", "<?xml version=\"1.0\" encoding=\"KOI8-R\"?><feedback>\xf0</feedback>", "unsupported_encoding"},
+		{"external entity", `<!DOCTYPE feedback [<!ENTITY x SYSTEM "file:///etc/passwd">]><feedback>&x;</feedback>`, "external_entity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBytes([]byte(tt.content))
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if got := ErrorCode(err); got != tt.want {
+				t.Errorf("want code %q, got %q for %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestErrorCodeDuplicateReport(t *testing.T) {
+	dir := t.TempDir()
+	file := File{Name: "report.xml", Content: []byte("<feedback/>")}
+	if _, err := CreateFile(dir, file); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := CreateFile(dir, file)
+	if got := ErrorCode(err); got != "duplicate_report" {
+		t.Errorf("want code duplicate_report, got %q for %v", got, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "report.xml")); err != nil {
+		t.Error(err)
+	}
+	if got := ErrorCode(os.ErrNotExist); got != "" {
+		t.Errorf("want no code for other errors, got %q", got)
+	}
+}
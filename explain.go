@@ -0,0 +1,112 @@
+package dmark
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explain returns a human-readable diagnosis of the record DMARC result, e.g.
+// "SPF passed for bounces.example.net but is not aligned with example.com under strict mode."
+func (r Record) Explain(policy PolicyPublished) string {
+	from := r.fromDomain(policy)
+	sentences := []string{}
+
+	if result, ok := r.DKIMAligned(policy); ok {
+		sentences = append(sentences, fmt.Sprintf(
+			"DKIM passed for %s, aligned with %s.", result.Domain, from,
+		))
+	} else {
+		sentences = append(sentences, r.explainDKIM(from, policy.ADKIM)...)
+	}
+
+	if result, ok := r.SPFAligned(policy); ok {
+		sentences = append(sentences, fmt.Sprintf(
+			"SPF passed for %s, aligned with %s.", result.Domain, from,
+		))
+	} else {
+		sentences = append(sentences, r.explainSPF(from, policy.ASPF)...)
+	}
+
+	evaluated := r.Row.PolicyEvaluated
+	if evaluated.DKIM || evaluated.SPF {
+		sentences = append(sentences, "DMARC passed.")
+	} else {
+		sentences = append(sentences, "DMARC failed.")
+	}
+
+	for _, reason := range evaluated.Reason {
+		sentence := "Policy was overridden: " + textOf(reason.Type)
+		if reason.Comment != "" {
+			sentence += " (" + reason.Comment + ")"
+		}
+		sentences = append(sentences, sentence+".")
+	}
+
+	if evaluated.Disposition != 0 {
+		sentences = append(sentences, "Disposition: "+textOf(evaluated.Disposition)+".")
+	}
+
+	return strings.Join(sentences, " ")
+}
+
+func (r Record) explainDKIM(from string, mode Alignment) []string {
+	if len(r.AuthResult.DKIM) == 0 {
+		return []string{"No DKIM signature."}
+	}
+
+	sentences := []string{}
+	for _, result := range r.AuthResult.DKIM {
+		if result.Result != DKIMResultPass {
+			sentence := fmt.Sprintf("DKIM signature of %s", result.Domain)
+			if result.Selector != "" {
+				sentence += fmt.Sprintf(" (selector %s)", result.Selector)
+			}
+			sentences = append(sentences, sentence+" did not pass: "+textOf(result.Result)+".")
+			continue
+		}
+
+		sentences = append(sentences, fmt.Sprintf(
+			"DKIM passed for %s but is not aligned with %s under %s mode.",
+			result.Domain, from, alignmentMode(mode),
+		))
+	}
+
+	return sentences
+}
+
+func (r Record) explainSPF(from string, mode Alignment) []string {
+	if len(r.AuthResult.SPF) == 0 {
+		return []string{"No SPF result."}
+	}
+
+	sentences := []string{}
+	for _, result := range r.AuthResult.SPF {
+		if result.Result != SPFResultPass {
+			sentences = append(sentences, fmt.Sprintf(
+				"SPF for %s did not pass: %s.", result.Domain, textOf(result.Result),
+			))
+			continue
+		}
+
+		sentences = append(sentences, fmt.Sprintf(
+			"SPF passed for %s but is not aligned with %s under %s mode.",
+			result.Domain, from, alignmentMode(mode),
+		))
+	}
+
+	return sentences
+}
+
+func alignmentMode(mode Alignment) string {
+	if mode == AlignmentStrict {
+		return "strict"
+	}
+
+	return "relaxed"
+}
+
+// textOf returns the text of an enum value.
+func textOf(v interface{ MarshalText() ([]byte, error) }) string {
+	text, _ := v.MarshalText()
+	return string(text)
+}
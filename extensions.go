@@ -0,0 +1,100 @@
+package dmark
+
+import (
+	"encoding/xml"
+	"sort"
+)
+
+// Extensions holds the text of elements not known to this package, keyed by element name.
+// Values of repeated elements are joined with a comma.
+type Extensions map[string]string
+
+func (e *Extensions) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var value string
+	if err := d.DecodeElement(&value, &start); err != nil {
+		return err
+	}
+
+	if *e == nil {
+		*e = Extensions{}
+	}
+
+	name := start.Name.Local
+	if prev, ok := (*e)[name]; ok {
+		value = prev + "," + value
+	}
+	(*e)[name] = value
+
+	return nil
+}
+
+func (e Extensions) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := enc.EncodeElement(e[name], xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RawElement is an element not known to this package, kept as raw XML,
+// e.g. an extension element allowed by RFC 7489 or a reporter-specific one.
+type RawElement struct {
+	Name  string            `json:"name"`                // Local name
+	Space string            `json:"namespace,omitempty"` // Namespace URI
+	Attrs map[string]string `json:"attrs,omitempty"`     // Attributes by local name
+	XML   string            `json:"xml"`                 // Inner XML, as found in the report
+}
+
+// rawElement is how RawElement is decoded and encoded.
+type rawElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+func (e *RawElement) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	raw := rawElement{}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*e = RawElement{
+		Name:  start.Name.Local,
+		Space: start.Name.Space,
+		XML:   raw.Inner,
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue // namespace declarations are resolved in Space
+		}
+		if e.Attrs == nil {
+			e.Attrs = map[string]string{}
+		}
+		e.Attrs[attr.Name.Local] = attr.Value
+	}
+
+	return nil
+}
+
+func (e RawElement) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	names := make([]string, 0, len(e.Attrs))
+	for name := range e.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	raw := rawElement{XMLName: xml.Name{Space: e.Space, Local: e.Name}, Inner: e.XML}
+	for _, name := range names {
+		raw.Attrs = append(raw.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: e.Attrs[name]})
+	}
+
+	return enc.Encode(raw)
+}
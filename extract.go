@@ -0,0 +1,255 @@
+package dmark
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"strings"
+)
+
+// File is a named raw report.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// Limits protecting from decompression bombs: maxDecompressedSize for
+// a single decompressed report, maxDecompressedTotal for all reports of
+// an archive or message, and maxFiles for the number of its files.
+const (
+	maxDecompressedSize  = 64 << 20
+	maxDecompressedTotal = 256 << 20
+	maxFiles             = 1000
+)
+
+// decompressLimit is what is left of the limits for an archive or message.
+type decompressLimit struct {
+	size  int // Bytes of decompressed reports and of attachments
+	files int // Files, including zip entries that are not reports
+}
+
+func newDecompressLimit() *decompressLimit {
+	return &decompressLimit{size: maxDecompressedTotal, files: maxFiles}
+}
+
+// Decompress returns the XML reports stored in content,
+// which may be plain XML, gzip or zip compressed.
+func Decompress(name string, content []byte) ([]File, error) {
+	return decompress(name, content, newDecompressLimit())
+}
+
+func decompress(name string, content []byte, limit *decompressLimit) ([]File, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0x1F, 0x8B}):
+		r, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("gzip %q: %w", name, err)
+		}
+		defer r.Close()
+
+		xml, err := limit.read(r)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip %q: %w", name, err)
+		}
+
+		innerName := r.Name
+		if innerName == "" {
+			innerName = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".gzip")
+		}
+
+		return []File{{Name: innerName, Content: xml}}, nil
+
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, fmt.Errorf("zip %q: %w", name, err)
+		}
+
+		if err = limit.take(len(r.File)); err != nil {
+			return nil, fmt.Errorf("zip %q: %w", name, err)
+		}
+
+		result := []File{}
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() || !strings.HasSuffix(strings.ToLower(f.Name), ".xml") {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("open %q in %q: %w", f.Name, name, err)
+			}
+			xml, err := limit.read(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("unzip %q in %q: %w", f.Name, name, err)
+			}
+
+			result = append(result, File{Name: path.Base(f.Name), Content: xml})
+		}
+
+		return result, nil
+	}
+
+	if looksLikeXML(content) {
+		return []File{{Name: name, Content: content}}, nil
+	}
+
+	return nil, fmt.Errorf("%q is not XML, gzip or zip", name)
+}
+
+// read reads r whole, failing when it exceeds maxDecompressedSize
+// or what is left of maxDecompressedTotal.
+func (l *decompressLimit) read(r io.Reader) ([]byte, error) {
+	max := maxDecompressedSize
+	if l.size < max {
+		max = l.size
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > max {
+		if max < maxDecompressedSize {
+			return nil, fmt.Errorf("total decompressed size exceeds %d bytes", maxDecompressedTotal)
+		}
+		return nil, fmt.Errorf("decompressed size exceeds %d bytes", maxDecompressedSize)
+	}
+	l.size -= len(content)
+
+	return content, nil
+}
+
+// take counts n files, failing when there are more than maxFiles in total.
+func (l *decompressLimit) take(n int) error {
+	if n > l.files {
+		return fmt.Errorf("more than %d files", maxFiles)
+	}
+	l.files -= n
+
+	return nil
+}
+
+func looksLikeXML(content []byte) bool {
+	content = bytes.TrimPrefix(content, bomUTF8)
+	content = bytes.TrimLeft(content, " \t\r\n")
+
+	return bytes.HasPrefix(content, []byte("<")) ||
+		bytes.HasPrefix(content, bomUTF16BE) ||
+		bytes.HasPrefix(content, bomUTF16LE)
+}
+
+// ExtractReports returns the reports attached to an email message (RFC 5322),
+// decompressing gzip and zip attachments. Parts that are not reports are ignored.
+func ExtractReports(message io.Reader) ([]File, error) {
+	msg, err := mail.ReadMessage(message)
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+
+	return extractPart(
+		msg.Header.Get("Content-Type"),
+		msg.Header.Get("Content-Disposition"),
+		msg.Header.Get("Content-Transfer-Encoding"),
+		msg.Body,
+		newDecompressLimit(),
+	)
+}
+
+func extractPart(contentType, disposition, encoding string, body io.Reader, limit *decompressLimit) ([]File, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		result := []File{}
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return result, nil
+			}
+			if err != nil {
+				return result, fmt.Errorf("read part: %w", err)
+			}
+
+			files, err := extractPart(
+				part.Header.Get("Content-Type"),
+				part.Header.Get("Content-Disposition"),
+				part.Header.Get("Content-Transfer-Encoding"),
+				part,
+				limit,
+			)
+			if err != nil {
+				return result, err
+			}
+			result = append(result, files...)
+		}
+	}
+
+	name := params["name"]
+	if _, dispositionParams, err := mime.ParseMediaType(disposition); err == nil && dispositionParams["filename"] != "" {
+		name = dispositionParams["filename"]
+	}
+
+	if !isReportPart(mediaType, name) {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	if err = limit.take(1); err != nil {
+		return nil, err
+	}
+	content, err := limit.read(body)
+	if err != nil {
+		return nil, fmt.Errorf("read attachment %q: %w", name, err)
+	}
+
+	if name == "" {
+		name = "report.xml"
+	}
+
+	return decompress(name, content, limit)
+}
+
+var reportMediaTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/x-zip":            true,
+	"application/x-zip-compressed": true,
+	"application/xml":              true,
+	"text/xml":                     true,
+}
+
+func isReportPart(mediaType, name string) bool {
+	if reportMediaTypes[mediaType] {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	for _, ext := range []string{".xml", ".gz", ".gzip", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package dmark
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// zipFiles returns a zip archive of count files named report<i>.xml,
+// each of size bytes, stored compressed.
+func zipFiles(t *testing.T, count, size int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	content := append([]byte("<feedback>"), bytes.Repeat([]byte(" "), size-len("<feedback>"))...)
+	for i := 0; i < count; i++ {
+		f, err := w.Create(fmt.Sprintf("report%d.xml", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecompressLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr string
+	}{
+		{
+			name:    "within limits",
+			content: zipFiles(t, 2, maxDecompressedSize),
+		},
+		{
+			name:    "report too large",
+			content: zipFiles(t, 1, maxDecompressedSize+1),
+			wantErr: fmt.Sprintf("decompressed size exceeds %d bytes", maxDecompressedSize),
+		},
+		{
+			name:    "total too large",
+			content: zipFiles(t, 5, maxDecompressedSize),
+			wantErr: fmt.Sprintf("total decompressed size exceeds %d bytes", maxDecompressedTotal),
+		},
+		{
+			name:    "too many files",
+			content: zipFiles(t, maxFiles+1, len("<feedback>")),
+			wantErr: fmt.Sprintf("more than %d files", maxFiles),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decompress("reports.zip", tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("want error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
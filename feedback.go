@@ -0,0 +1,76 @@
+package dmark
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// Record returns the records of the report, for templates written before
+// the field was renamed to Records.
+//
+// Deprecated: use Records.
+func (f Feedback) Record() []Record {
+	return f.Records
+}
+
+// TotalMessages returns the number of messages of all records.
+func (f Feedback) TotalMessages() int {
+	total := 0
+	for _, record := range f.Records {
+		total += record.Row.Count
+	}
+
+	return total
+}
+
+// FailedMessages returns the number of messages failing DMARC,
+// with neither aligned DKIM nor aligned SPF passing.
+func (f Feedback) FailedMessages() int {
+	failed := 0
+	for _, record := range f.Records {
+		evaluated := record.Row.PolicyEvaluated
+		if !evaluated.DKIM && !evaluated.SPF {
+			failed += record.Row.Count
+		}
+	}
+
+	return failed
+}
+
+// SourceIPs returns the distinct source IPs of records, IPv4 first, sorted.
+func (f Feedback) SourceIPs() []net.IP {
+	seen := map[string]bool{}
+	result := []net.IP{}
+	for _, record := range f.Records {
+		ip := record.Row.SourceIP
+		if ip == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		result = append(result, ip)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return compareIPs(result[i], result[j]) < 0
+	})
+
+	return result
+}
+
+// Domains returns the distinct header From domains of records, lower-cased
+// and sorted; the policy domain stands for records without header_from.
+func (f Feedback) Domains() []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, record := range f.Records {
+		domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(record.fromDomain(f.PolicyPublished)), "."))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		result = append(result, domain)
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,41 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// dial connects to a mail server, over TLS unless insecure is set.
+// Reads and writes on the connection fail once ctx is done,
+// until the returned stop function is called.
+func dial(ctx context.Context, address string, insecure bool) (conn net.Conn, stop func() bool, err error) {
+	if insecure {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	} else {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = (&tls.Dialer{Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial %q: %w", address, err)
+	}
+
+	stop = context.AfterFunc(ctx, func() {
+		// a deadline in the past unblocks pending reads and writes
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	return conn, stop, nil
+}
+
+// contextError returns the context error instead of err
+// when the operation failed because ctx is done.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
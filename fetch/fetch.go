@@ -0,0 +1,25 @@
+// Package fetch retrieves DMARK report emails from mailboxes.
+//
+// Backends implement the Fetcher interface: IMAP, POP3,
+// Microsoft Graph API and Gmail API.
+package fetch
+
+import "context"
+
+// Message is a raw email message (RFC 5322).
+type Message struct {
+	ID  string // Backend specific message identifier
+	Raw []byte
+}
+
+// Handler processes a fetched message. When it returns nil, the message
+// is marked as processed (seen, read or deleted, depending on the backend)
+// and will not be fetched again.
+type Handler func(msg Message) error
+
+// Fetcher retrieves unprocessed messages from a mailbox.
+type Fetcher interface {
+	// Fetch calls handle for every unprocessed message,
+	// stopping on the first error or when ctx is done.
+	Fetch(ctx context.Context, handle Handler) error
+}
@@ -0,0 +1,102 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GmailScope is the OAuth2 scope allowing to read messages and mark them as read.
+const GmailScope = "https://www.googleapis.com/auth/gmail.modify"
+
+const gmailURL = "https://gmail.googleapis.com/gmail/v1"
+
+// Gmail fetches messages matching a search query using Gmail API
+// and removes the UNREAD label once handled, unless Peek is set.
+type Gmail struct {
+	User       string      // "me" when empty
+	Query      string      // Gmail search query, "is:unread has:attachment" when empty
+	Tokens     TokenSource // Needs GmailScope
+	HTTPClient *http.Client
+	Peek       bool // Leave messages unread
+}
+
+func (g *Gmail) Fetch(ctx context.Context, handle Handler) error {
+	api := apiClient{client: g.HTTPClient, tokens: g.Tokens}
+
+	user := g.User
+	if user == "" {
+		user = "me"
+	}
+	query := g.Query
+	if query == "" {
+		query = "is:unread has:attachment"
+	}
+	messages := gmailURL + "/users/" + url.PathEscape(user) + "/messages"
+
+	ids := []string{}
+	pageToken := ""
+	for {
+		params := url.Values{"q": {query}}
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+
+		page := struct {
+			Messages []struct {
+				ID string `json:"id"`
+			} `json:"messages"`
+			NextPageToken string `json:"nextPageToken"`
+		}{}
+		if _, err := api.do(ctx, http.MethodGet, messages+"?"+params.Encode(), nil, &page); err != nil {
+			return fmt.Errorf("list messages: %w", err)
+		}
+
+		for _, msg := range page.Messages {
+			ids = append(ids, msg.ID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		message := messages + "/" + url.PathEscape(id)
+
+		msg := struct {
+			Raw string `json:"raw"`
+		}{}
+		if _, err := api.do(ctx, http.MethodGet, message+"?format=raw", nil, &msg); err != nil {
+			return fmt.Errorf("get message %q: %w", id, err)
+		}
+
+		raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+		if err != nil {
+			// some responses omit padding
+			if raw, err = base64.RawURLEncoding.DecodeString(msg.Raw); err != nil {
+				return fmt.Errorf("decode message %q: %w", id, err)
+			}
+		}
+
+		if err = handle(Message{ID: id, Raw: raw}); err != nil {
+			return err
+		}
+
+		if g.Peek {
+			continue
+		}
+		modify := map[string][]string{"removeLabelIds": {"UNREAD"}}
+		if _, err = api.do(ctx, http.MethodPost, message+"/modify", modify, nil); err != nil {
+			return fmt.Errorf("mark message %q as read: %w", id, err)
+		}
+	}
+
+	return nil
+}
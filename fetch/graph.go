@@ -0,0 +1,84 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GraphScope is the OAuth2 scope for application access to Microsoft Graph.
+const GraphScope = "https://graph.microsoft.com/.default"
+
+const graphURL = "https://graph.microsoft.com/v1.0"
+
+// Graph fetches unread messages with attachments from a Microsoft 365 mailbox
+// using Microsoft Graph API and marks them as read once handled, unless Peek is set.
+// The application needs the Mail.ReadWrite permission.
+type Graph struct {
+	Mailbox    string      // User ID or user principal name of the mailbox owner
+	Folder     string      // Well-known folder name or folder ID, "inbox" when empty
+	Tokens     TokenSource // Usually ClientCredentials with MicrosoftTokenURL and GraphScope
+	HTTPClient *http.Client
+	Peek       bool // Leave messages unread
+}
+
+func (g *Graph) Fetch(ctx context.Context, handle Handler) error {
+	api := apiClient{client: g.HTTPClient, tokens: g.Tokens}
+
+	folder := g.Folder
+	if folder == "" {
+		folder = "inbox"
+	}
+	user := graphURL + "/users/" + url.PathEscape(g.Mailbox)
+
+	next := user + "/mailFolders/" + url.PathEscape(folder) + "/messages?" + url.Values{
+		"$filter": {"isRead eq false and hasAttachments eq true"},
+		"$select": {"id"},
+		"$top":    {"50"},
+	}.Encode()
+
+	ids := []string{}
+	for next != "" {
+		page := struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}{}
+		if _, err := api.do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return fmt.Errorf("list messages: %w", err)
+		}
+
+		for _, msg := range page.Value {
+			ids = append(ids, msg.ID)
+		}
+		next = page.NextLink
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		message := user + "/messages/" + url.PathEscape(id)
+
+		raw, err := api.do(ctx, http.MethodGet, message+"/$value", nil, nil)
+		if err != nil {
+			return fmt.Errorf("get message %q: %w", id, err)
+		}
+
+		if err = handle(Message{ID: id, Raw: raw}); err != nil {
+			return err
+		}
+
+		if g.Peek {
+			continue
+		}
+		if _, err = api.do(ctx, http.MethodPatch, message, map[string]bool{"isRead": true}, nil); err != nil {
+			return fmt.Errorf("mark message %q as read: %w", id, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// apiClient calls JSON REST APIs with OAuth2 bearer tokens.
+type apiClient struct {
+	client *http.Client
+	tokens TokenSource
+}
+
+// do sends a request with an optional JSON body, decoding a JSON response into out
+// unless out is nil. It returns the raw response body.
+func (c apiClient) do(ctx context.Context, method, url string, body, out interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("json marshal: %w", err)
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response %s %s: %w", method, url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, url, resp.StatusCode, bytes.TrimSpace(content))
+	}
+
+	if out != nil {
+		if err = json.Unmarshal(content, out); err != nil {
+			return nil, fmt.Errorf("decode response %s %s: %w", method, url, err)
+		}
+	}
+
+	return content, nil
+}
@@ -0,0 +1,213 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IMAP fetches unseen messages from an IMAP mailbox over TLS
+// and flags them as seen once handled, unless Peek is set.
+type IMAP struct {
+	Address  string // host:port, usually port 993
+	Username string
+	Password string
+	Tokens   TokenSource // Authenticate with XOAUTH2 instead of the password when set
+	Mailbox  string      // INBOX when empty
+	Insecure bool        // Connect without TLS
+	Peek     bool        // Open the mailbox read-only, leaving messages unseen
+}
+
+func (i *IMAP) Fetch(ctx context.Context, handle Handler) error {
+	return contextError(ctx, i.fetch(ctx, handle))
+}
+
+func (i *IMAP) fetch(ctx context.Context, handle Handler) error {
+	conn, err := i.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	if i.Tokens != nil {
+		response, err := xoauth2(ctx, i.Username, i.Tokens)
+		if err != nil {
+			return err
+		}
+		if _, err = conn.command("AUTHENTICATE XOAUTH2 %s", response); err != nil {
+			return fmt.Errorf("authenticate: %w", err)
+		}
+	} else if _, err = conn.command("LOGIN %s %s", imapQuote(i.Username), imapQuote(i.Password)); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+
+	mailbox := i.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	selectCommand := "SELECT"
+	if i.Peek {
+		selectCommand = "EXAMINE"
+	}
+	if _, err = conn.command("%s %s", selectCommand, imapQuote(mailbox)); err != nil {
+		return fmt.Errorf("select %q: %w", mailbox, err)
+	}
+
+	responses, err := conn.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+
+	uids := []string{}
+	for _, r := range responses {
+		if strings.HasPrefix(r.text, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(r.text, "* SEARCH"))...)
+		}
+	}
+
+	for _, uid := range uids {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		responses, err := conn.command("UID FETCH %s BODY.PEEK[]", uid)
+		if err != nil {
+			return fmt.Errorf("fetch %s: %w", uid, err)
+		}
+
+		for _, r := range responses {
+			if !strings.Contains(r.text, " FETCH ") || len(r.literals) == 0 {
+				continue
+			}
+
+			if err = handle(Message{ID: uid, Raw: r.literals[0]}); err != nil {
+				return err
+			}
+
+			if i.Peek {
+				continue
+			}
+			if _, err = conn.command(`UID STORE %s +FLAGS.SILENT (\Seen)`, uid); err != nil {
+				return fmt.Errorf("store %s: %w", uid, err)
+			}
+		}
+	}
+
+	_, err = conn.command("LOGOUT")
+	return err
+}
+
+func (i *IMAP) dial(ctx context.Context) (*imapConn, error) {
+	c, stop, err := dial(ctx, i.Address, i.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &imapConn{conn: c, r: bufio.NewReader(c), stop: stop}
+	greeting, err := conn.readResponse()
+	if err != nil {
+		conn.close()
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") {
+		conn.close()
+		return nil, fmt.Errorf("unexpected greeting %q", greeting.text)
+	}
+
+	return conn, nil
+}
+
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	stop func() bool // Stops watching the context
+}
+
+// imapResponse is a response line, with literals ({n} followed by n bytes) cut out.
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+var imapLiteral = regexp.MustCompile(`\{(\d+)\}$`)
+
+func (c *imapConn) readResponse() (imapResponse, error) {
+	r := imapResponse{}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return r, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		r.text += line
+
+		m := imapLiteral.FindStringSubmatch(line)
+		if m == nil {
+			return r, nil
+		}
+
+		size, err := strconv.Atoi(m[1])
+		if err != nil {
+			return r, fmt.Errorf("literal size %q: %w", m[1], err)
+		}
+		literal := make([]byte, size)
+		if _, err = io.ReadFull(c.r, literal); err != nil {
+			return r, fmt.Errorf("read literal: %w", err)
+		}
+		r.literals = append(r.literals, literal)
+	}
+}
+
+// command sends a command and returns untagged responses,
+// or an error unless the server completed the command with OK.
+func (c *imapConn) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	untagged := []imapResponse{}
+	for {
+		r, err := c.readResponse()
+		if err != nil {
+			return untagged, err
+		}
+
+		if strings.HasPrefix(r.text, "+") {
+			// a continuation request here is the server reporting a failed
+			// authentication, an empty response makes it complete the command
+			if _, err := fmt.Fprint(c.conn, "\r\n"); err != nil {
+				return untagged, err
+			}
+			continue
+		}
+
+		if strings.HasPrefix(r.text, tag+" ") {
+			status := strings.TrimPrefix(r.text, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return untagged, errors.New(status)
+			}
+			return untagged, nil
+		}
+
+		untagged = append(untagged, r)
+	}
+}
+
+func (c *imapConn) close() {
+	c.stop()
+	c.conn.Close()
+}
+
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
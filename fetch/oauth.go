@@ -0,0 +1,308 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource returns OAuth2 access tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is an access token obtained elsewhere.
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Google OAuth2 endpoints.
+const (
+	GoogleTokenURL      = "https://oauth2.googleapis.com/token"
+	GoogleDeviceCodeURL = "https://oauth2.googleapis.com/device/code"
+)
+
+// OAuth2 scopes for mailbox protocols.
+const (
+	GoogleMailScope         = "https://mail.google.com/"                         // IMAP and POP3 access to Gmail
+	MicrosoftIMAPScope      = "https://outlook.office.com/IMAP.AccessAsUser.All" // Delegated IMAP access to Microsoft 365
+	MicrosoftPOPScope       = "https://outlook.office.com/POP.AccessAsUser.All"  // Delegated POP3 access to Microsoft 365
+	MicrosoftAppMailScope   = "https://outlook.office365.com/.default"           // Application IMAP and POP3 access to Microsoft 365
+	MicrosoftGraphMailScope = "https://graph.microsoft.com/Mail.ReadWrite"       // Delegated access to Microsoft Graph
+	OfflineAccessScope      = "offline_access"                                   // Microsoft scope required to get refresh tokens
+)
+
+// MicrosoftTokenURL returns the token endpoint of a Microsoft Entra ID tenant.
+func MicrosoftTokenURL(tenant string) string {
+	return "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+}
+
+// MicrosoftDeviceCodeURL returns the device authorization endpoint of a Microsoft Entra ID tenant.
+func MicrosoftDeviceCodeURL(tenant string) string {
+	return "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0/devicecode"
+}
+
+// ClientCredentials obtains access tokens with the OAuth2 client credentials grant
+// and caches them until they expire.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client // http.DefaultClient when nil
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	resp, err := requestToken(ctx, c.HTTPClient, c.TokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"scope":         {strings.Join(c.Scopes, " ")},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.token = resp.AccessToken
+	c.expiry = resp.expiry()
+
+	return c.token, nil
+}
+
+// RefreshToken obtains access tokens with the OAuth2 refresh token grant
+// and caches them until they expire.
+type RefreshToken struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string // Optional for public clients
+	RefreshToken string
+	Scopes       []string
+	HTTPClient   *http.Client // http.DefaultClient when nil
+
+	// OnRotate is called when the server issues a new refresh token,
+	// so it can be persisted for the next run.
+	OnRotate func(refreshToken string)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (r *RefreshToken) Token(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token != "" && time.Now().Before(r.expiry) {
+		return r.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {r.ClientID},
+		"refresh_token": {r.RefreshToken},
+	}
+	if r.ClientSecret != "" {
+		form.Set("client_secret", r.ClientSecret)
+	}
+	if len(r.Scopes) > 0 {
+		form.Set("scope", strings.Join(r.Scopes, " "))
+	}
+
+	resp, err := requestToken(ctx, r.HTTPClient, r.TokenURL, form)
+	if err != nil {
+		return "", err
+	}
+
+	r.token = resp.AccessToken
+	r.expiry = resp.expiry()
+	r.rotate(resp.RefreshToken)
+
+	return r.token, nil
+}
+
+func (r *RefreshToken) rotate(refreshToken string) {
+	if refreshToken == "" || refreshToken == r.RefreshToken {
+		return
+	}
+
+	r.RefreshToken = refreshToken
+	if r.OnRotate != nil {
+		r.OnRotate(refreshToken)
+	}
+}
+
+// DeviceCode runs the OAuth2 device authorization grant (RFC 8628):
+// prompt is called with the URL the user has to visit and the code to enter there,
+// then the token endpoint is polled until the user completes the sign-in.
+// The returned RefreshToken already holds the obtained access token.
+// Polling stops when ctx is done.
+func DeviceCode(
+	ctx context.Context,
+	deviceURL, tokenURL, clientID, clientSecret string,
+	scopes []string,
+	prompt func(verificationURI, userCode string),
+) (*RefreshToken, error) {
+	form := url.Values{
+		"client_id": {clientID},
+		"scope":     {strings.Join(scopes, " ")},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	resp, err := postForm(ctx, nil, deviceURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	device := struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURI string `json:"verification_uri"`
+		VerificationURL string `json:"verification_url"` // Google's name for verification_uri
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return nil, fmt.Errorf("decode device authorization response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || device.DeviceCode == "" {
+		return nil, fmt.Errorf("device authorization request: unexpected status %d", resp.StatusCode)
+	}
+
+	uri := device.VerificationURI
+	if uri == "" {
+		uri = device.VerificationURL
+	}
+	prompt(uri, device.UserCode)
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+
+	form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"client_id":   {clientID},
+		"device_code": {device.DeviceCode},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token, err := requestToken(ctx, nil, tokenURL, form)
+		if token != nil {
+			switch token.Error {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &RefreshToken{
+			TokenURL:     tokenURL,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RefreshToken: token.RefreshToken,
+			Scopes:       scopes,
+			token:        token.AccessToken,
+			expiry:       token.expiry(),
+		}, nil
+	}
+
+	return nil, errors.New("device code expired before sign-in was completed")
+}
+
+// xoauth2 returns the initial client response for SASL XOAUTH2 mechanism,
+// used by IMAP and POP3 servers of Gmail and Microsoft 365.
+func xoauth2(ctx context.Context, username string, tokens TokenSource) (string, error) {
+	token, err := tokens.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get token: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte("user=" + username + "\x01auth=Bearer " + token + "\x01\x01")), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// expiry returns the token expiration time, with a minute to spare.
+func (t tokenResponse) expiry() time.Time {
+	return time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+}
+
+func requestToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*tokenResponse, error) {
+	resp, err := postForm(ctx, client, tokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	token := tokenResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("decode token response, status %d: %w", resp.StatusCode, err)
+	}
+	if token.Error != "" {
+		return &token, fmt.Errorf("token request: %s: %s", token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("token request: unexpected status %d", resp.StatusCode)
+	}
+
+	return &token, nil
+}
+
+// postForm is like http.Client.PostForm, but with a context.
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return client.Do(req)
+}
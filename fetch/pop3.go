@@ -0,0 +1,139 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+)
+
+// POP3 fetches messages from a POP3 mailbox over TLS.
+// POP3 has no notion of seen messages, so handled messages
+// are deleted when Delete is set and fetched again otherwise.
+type POP3 struct {
+	Address  string // host:port, usually port 995
+	Username string
+	Password string
+	Tokens   TokenSource // Authenticate with XOAUTH2 instead of the password when set
+	Delete   bool        // Delete handled messages from the server
+	Insecure bool        // Connect without TLS
+}
+
+func (p *POP3) Fetch(ctx context.Context, handle Handler) error {
+	return contextError(ctx, p.fetch(ctx, handle))
+}
+
+func (p *POP3) fetch(ctx context.Context, handle Handler) error {
+	conn, stop, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer stop()
+
+	if err = p.authenticate(ctx, conn); err != nil {
+		return err
+	}
+
+	if _, err = pop3Command(conn, "UIDL"); err != nil {
+		return fmt.Errorf("uidl: %w", err)
+	}
+	lines, err := conn.ReadDotLines()
+	if err != nil {
+		return fmt.Errorf("read uidl: %w", err)
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		number, uid := fields[0], fields[1]
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err = pop3Command(conn, "RETR %s", number); err != nil {
+			return fmt.Errorf("retr %s: %w", number, err)
+		}
+		raw, err := ioutil.ReadAll(conn.DotReader())
+		if err != nil {
+			return fmt.Errorf("read message %s: %w", number, err)
+		}
+
+		if err = handle(Message{ID: uid, Raw: raw}); err != nil {
+			return err
+		}
+
+		if p.Delete {
+			if _, err = pop3Command(conn, "DELE %s", number); err != nil {
+				return fmt.Errorf("dele %s: %w", number, err)
+			}
+		}
+	}
+
+	// deletions are only applied when the session ends with QUIT
+	_, err = pop3Command(conn, "QUIT")
+	return err
+}
+
+func (p *POP3) authenticate(ctx context.Context, conn *textproto.Conn) error {
+	if p.Tokens != nil {
+		response, err := xoauth2(ctx, p.Username, p.Tokens)
+		if err != nil {
+			return err
+		}
+		if _, err = pop3Command(conn, "AUTH XOAUTH2 %s", response); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := pop3Command(conn, "USER %s", p.Username); err != nil {
+		return fmt.Errorf("user: %w", err)
+	}
+	if _, err := pop3Command(conn, "PASS %s", p.Password); err != nil {
+		return fmt.Errorf("pass: %w", err)
+	}
+
+	return nil
+}
+
+func (p *POP3) dial(ctx context.Context) (*textproto.Conn, func() bool, error) {
+	c, stop, err := dial(ctx, p.Address, p.Insecure)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn := textproto.NewConn(c)
+	if _, err = pop3Response(conn); err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, fmt.Errorf("read greeting: %w", err)
+	}
+
+	return conn, stop, nil
+}
+
+func pop3Command(conn *textproto.Conn, format string, args ...interface{}) (string, error) {
+	if err := conn.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+
+	return pop3Response(conn)
+}
+
+func pop3Response(conn *textproto.Conn) (string, error) {
+	line, err := conn.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return "", errors.New(line)
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+}
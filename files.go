@@ -0,0 +1,238 @@
+package dmark
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseFile parses the report stored in a file.
+func ParseFile(path string) (*Feedback, error) {
+	return (&Parser{}).ParseFile(path)
+}
+
+// ParseFile parses the report stored in a file.
+func (p *Parser) ParseFile(path string) (*Feedback, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file %q: %w", path, err)
+	}
+
+	feedback, err := p.ParseBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", path, err)
+	}
+
+	if feedback.Origin != nil {
+		feedback.Origin.File = filepath.Base(path)
+		// files are written once on ingestion, see SaveFile
+		if info, err := os.Stat(path); err == nil {
+			feedback.Origin.Ingested = info.ModTime().UTC()
+		}
+	}
+
+	return feedback, nil
+}
+
+// ParseDir parses all *.xml reports in a directory, ordered by file name.
+func ParseDir(dir string) ([]Feedback, error) {
+	return (&Parser{}).ParseDir(context.Background(), dir)
+}
+
+// ParseDir is like the package level ParseDir, but uses the Parser options
+// and stops with the context error once ctx is done.
+func (p *Parser) ParseDir(ctx context.Context, dir string) ([]Feedback, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	result := []Feedback{}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".xml") {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+
+		feedback, err := p.ParseFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, *feedback)
+	}
+
+	return result, nil
+}
+
+// SaveFile writes a raw report to dir and returns its path. When a file with
+// the same name and content already exists, it is kept and saved is false;
+// when the content differs, a hash of the content is added to the name.
+func SaveFile(dir string, file File) (path string, saved bool, err error) {
+	path, err = CreateFile(dir, file)
+	if errors.Is(err, ErrDuplicateReport) {
+		return path, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return path, true, nil
+}
+
+// CreateFile is like SaveFile, but fails with an error matching
+// ErrDuplicateReport, along with the path, when the report is already in dir.
+// Files are created exclusively, so concurrent saves never overwrite each other.
+func CreateFile(dir string, file File) (string, error) {
+	name := SavedFileName(file.Name)
+
+	path := filepath.Join(dir, name)
+	created, same, err := createFile(path, file.Content)
+	if err == nil && !created && !same {
+		path = filepath.Join(dir, HashedFileName(name, file.Content))
+		created, same, err = createFile(path, file.Content)
+	}
+	switch {
+	case err != nil:
+		return "", err
+	case same:
+		return path, fmt.Errorf("%s: %w", filepath.Base(path), ErrDuplicateReport)
+	case !created:
+		return "", fmt.Errorf("create file %q: %w", path, os.ErrExist)
+	}
+
+	return path, nil
+}
+
+// createFile writes content to a new file at path, unless the file exists;
+// same tells whether the existing file has the same content. The content is
+// written to an exclusively created temporary file first, then linked to path,
+// so that a concurrent save never reads a partially written report.
+func createFile(path string, content []byte) (created, same bool, err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return false, false, fmt.Errorf("create file %q: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("write file %q: %w", path, err)
+	}
+
+	err = os.Link(f.Name(), path)
+	if errors.Is(err, os.ErrExist) {
+		existing, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, false, fmt.Errorf("read file %q: %w", path, err)
+		}
+		return false, bytes.Equal(existing, content), nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("create file %q: %w", path, err)
+	}
+
+	return true, false, nil
+}
+
+// SavedFile returns the path SaveFile writes the report to in dir,
+// and whether the same report is already there.
+func SavedFile(dir string, file File) (path string, exists bool, err error) {
+	name := SavedFileName(file.Name)
+
+	path = filepath.Join(dir, name)
+	existing, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil && bytes.Equal(existing, file.Content):
+		return path, true, nil
+	case err == nil:
+		path = filepath.Join(dir, HashedFileName(name, file.Content))
+		if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, file.Content) {
+			return path, true, nil
+		}
+	case !os.IsNotExist(err):
+		return "", false, fmt.Errorf("read file %q: %w", path, err)
+	}
+
+	return path, false, nil
+}
+
+// SavedFileName returns the name SaveFile gives a report file: the base name,
+// without characters unsafe in file names, with the .xml extension.
+func SavedFileName(name string) string {
+	name = safeFileName(name)
+	if !strings.HasSuffix(strings.ToLower(name), ".xml") {
+		name += ".xml"
+	}
+
+	return name
+}
+
+// HashedFileName returns the name SaveFile gives a report file when another
+// report already has the name: a hash of the content is added to it.
+func HashedFileName(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	return strings.TrimSuffix(name, ".xml") + "-" + hex.EncodeToString(sum[:6]) + ".xml"
+}
+
+// MarshalFile encodes a report as an XML file, named the way receivers name
+// report attachments: <org name>!<policy domain>!<begin>!<end>!<report ID>.xml.
+func MarshalFile(feedback *Feedback) (File, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.EncodeElement(feedback, xml.StartElement{Name: xml.Name{Local: "feedback"}}); err != nil {
+		return File{}, fmt.Errorf("encode report: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	meta := feedback.ReportMetadata
+	name := fmt.Sprintf(
+		"%s!%s!%d!%d",
+		meta.OrgName,
+		feedback.PolicyPublished.Domain,
+		meta.DateRange.Begin,
+		meta.DateRange.End,
+	)
+	if meta.ReportID != "" {
+		name += "!" + meta.ReportID
+	}
+
+	return File{Name: safeFileName(name) + ".xml", Content: buf.Bytes()}, nil
+}
+
+// safeFileName strips directories and characters unsafe in file names.
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', 0:
+			return '_'
+		}
+		return r
+	}, filepath.Base(name))
+
+	if name == "" || name == "." || name == ".." {
+		return "report"
+	}
+
+	return name
+}
@@ -0,0 +1,45 @@
+package dmark
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestCreateFileConcurrent(t *testing.T) {
+	dir := t.TempDir()
+
+	const n = 8
+	paths := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file := File{Name: "upload.xml", Content: []byte(fmt.Sprintf("<feedback>%d</feedback>", i%2))}
+			paths[i], errs[i] = CreateFile(dir, file)
+		}(i)
+	}
+	wg.Wait()
+
+	saved := map[string]bool{}
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, ErrDuplicateReport) {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("<feedback>%d</feedback>", i%2); string(content) != want {
+			t.Errorf("upload %d: want %s in %s, got %s", i, want, paths[i], content)
+		}
+		saved[paths[i]] = true
+	}
+	if len(saved) != 2 {
+		t.Errorf("want both reports saved once, got %v", saved)
+	}
+}
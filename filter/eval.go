@@ -0,0 +1,229 @@
+package filter
+
+import (
+	"encoding"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// env holds values fields are looked up in, in order.
+type env []reflect.Value
+
+// scopes are types of env values, used to resolve fields at compile time.
+var scopes = []reflect.Type{
+	reflect.TypeOf(dmark.Record{}),
+	reflect.TypeOf(dmark.Row{}),
+	reflect.TypeOf(dmark.Identifiers{}),
+	reflect.TypeOf(dmark.Feedback{}),
+}
+
+type node interface {
+	eval(e env) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(e env) bool { return n.left.eval(e) && n.right.eval(e) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(e env) bool { return n.left.eval(e) || n.right.eval(e) }
+
+type notNode struct{ operand node }
+
+func (n notNode) eval(e env) bool { return !n.operand.eval(e) }
+
+// field is a resolved field path.
+type field struct {
+	scope int   // Index in env
+	index []int // Struct field indexes, slices are traversed
+}
+
+// resolveField finds a field by its dotted XML path.
+func resolveField(path string) (field, error) {
+	names := strings.Split(path, ".")
+	for scope, t := range scopes {
+		if index, ok := fieldIndex(t, names); ok {
+			return field{scope: scope, index: index}, nil
+		}
+	}
+
+	return field{}, fmt.Errorf("unknown field %q", path)
+}
+
+func fieldIndex(t reflect.Type, names []string) ([]int, bool) {
+	index := []int{}
+	for _, name := range names {
+		for t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, false
+		}
+
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("xml"), ",")[0]
+			if tag == name {
+				index = append(index, i)
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	return index, true
+}
+
+// values returns the field as strings, one for each element of traversed slices.
+func (f field) values(e env) []string {
+	return collect(e[f.scope], f.index, nil)
+}
+
+func collect(v reflect.Value, index []int, result []string) []string {
+	if len(index) == 0 {
+		return append(result, valueString(v)...)
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct {
+		for i := 0; i < v.Len(); i++ {
+			result = collect(v.Index(i), index, result)
+		}
+		return result
+	}
+
+	return collect(v.Field(index[0]), index[1:], result)
+}
+
+func valueString(v reflect.Value) []string {
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			text, _ := m.MarshalText()
+			return []string{string(text)}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return []string{v.String()}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(v.Int(), 10)}
+	case reflect.Float32, reflect.Float64:
+		return []string{strconv.FormatFloat(v.Float(), 'f', -1, 64)}
+	case reflect.Bool:
+		return []string{strconv.FormatBool(v.Bool())}
+	case reflect.Slice:
+		result := []string{}
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, valueString(v.Index(i))...)
+		}
+		return result
+	}
+
+	return nil
+}
+
+type compareNode struct {
+	field field
+	op    string
+	value string
+	num   float64      // value as a number, for <, <=, >, >=
+	nets  []*net.IPNet // for "in" with CIDRs
+	list  []string     // for "in" with a list
+}
+
+func newCompareNode(f field, op, value string) (node, error) {
+	n := compareNode{field: f, op: op, value: value}
+
+	switch op {
+	case "==", "!=":
+	case "<", "<=", ">", ">=":
+		num, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a number, got %q", op, value)
+		}
+		n.num = num
+	case "in":
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if !strings.Contains(item, "/") {
+				n.list = append(n.list, item)
+				continue
+			}
+			_, ipNet, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, fmt.Errorf("parse CIDR %q: %w", item, err)
+			}
+			n.nets = append(n.nets, ipNet)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+
+	return n, nil
+}
+
+func (n compareNode) eval(e env) bool {
+	values := n.field.values(e)
+	if n.op == "!=" {
+		for _, v := range values {
+			if strings.EqualFold(v, n.value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, v := range values {
+		if n.match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n compareNode) match(v string) bool {
+	switch n.op {
+	case "==":
+		return strings.EqualFold(v, n.value)
+	case "in":
+		for _, item := range n.list {
+			if strings.EqualFold(v, item) {
+				return true
+			}
+		}
+		if ip := net.ParseIP(v); ip != nil {
+			for _, ipNet := range n.nets {
+				if ipNet.Contains(ip) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	num, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return num < n.num
+	case "<=":
+		return num <= n.num
+	case ">":
+		return num > n.num
+	case ">=":
+		return num >= n.num
+	}
+	return false
+}
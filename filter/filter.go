@@ -0,0 +1,80 @@
+// Package filter evaluates expressions against report records, e.g.
+//
+//	policy_evaluated.dkim == "fail" && row.count > 10 && source_ip in "66.249.0.0/16"
+//
+// Fields are XML element names joined with dots. They are looked up in the record,
+// then in its row and identifiers, then in the report, so "row.count" and "count"
+// both refer to the same field. Fields within repeated elements, such as
+// "auth_results.dkim.result", match when any of the elements matches.
+//
+// Operators are ==, !=, <, <=, >, >= (numeric), "in" (a CIDR or a comma-separated list),
+// && (or "and"), || (or "or"), ! (or "not") and parentheses.
+// String comparison is case-insensitive.
+package filter
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Filter is a compiled expression.
+type Filter struct {
+	expr string
+	root node
+}
+
+// Compile parses an expression.
+func Compile(expr string) (*Filter, error) {
+	p := parser{}
+	if err := p.tokenize(expr); err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// String returns the source expression.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether the record of the report matches the expression.
+func (f *Filter) Match(report *dmark.Feedback, record *dmark.Record) bool {
+	return f.root.eval(env{
+		reflect.ValueOf(record).Elem(),
+		reflect.ValueOf(&record.Row).Elem(),
+		reflect.ValueOf(&record.Identifiers).Elem(),
+		reflect.ValueOf(report).Elem(),
+	})
+}
+
+// Apply removes records that don't match the expression from the report.
+func (f *Filter) Apply(report *dmark.Feedback) {
+	records := report.Records[:0]
+	for i := range report.Records {
+		if f.Match(report, &report.Records[i]) {
+			records = append(records, report.Records[i])
+		}
+	}
+	report.Records = records
+}
+
+// Reports applies the filter to each report and drops reports left without records.
+func (f *Filter) Reports(reports []dmark.Feedback) []dmark.Feedback {
+	result := reports[:0]
+	for _, report := range reports {
+		f.Apply(&report)
+		if len(report.Records) > 0 {
+			result = append(result, report)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,213 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"}
+
+// keywords are spelled-out aliases of operators.
+var keywords = map[string]string{"and": "&&", "or": "||", "not": "!", "in": "in"}
+
+func (p *parser) tokenize(expr string) error {
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return fmt.Errorf("unterminated string at %d", i)
+			}
+			text, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return fmt.Errorf("string at %d: %w", i, err)
+			}
+			p.tokens = append(p.tokens, token{tokenString, text, i})
+			i = end + 1
+
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(expr) && (expr[end] == '.' || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, expr[i:end], i})
+			i = end
+
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(expr) && (expr[end] == '_' || expr[end] == '.' ||
+				unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			word := expr[i:end]
+			if op, ok := keywords[strings.ToLower(word)]; ok {
+				p.tokens = append(p.tokens, token{tokenOp, op, i})
+			} else {
+				p.tokens = append(p.tokens, token{tokenIdent, word, i})
+			}
+			i = end
+
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(expr[i:], op) {
+					p.tokens = append(p.tokens, token{tokenOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unexpected %q at %d", c, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptOp(op string) bool {
+	if t := p.peek(); t != nil && t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.acceptOp("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+
+	if p.acceptOp("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptOp(")") {
+			return nil, errors.New("missing )")
+		}
+		return n, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	t := p.next()
+	if t == nil {
+		return nil, errors.New("unexpected end of expression")
+	}
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("expected field at %d, got %q", t.pos, t.text)
+	}
+	f, err := resolveField(t.text)
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	if op == nil || op.kind != tokenOp {
+		return nil, fmt.Errorf("expected operator after %q", t.text)
+	}
+
+	value := p.next()
+	if value == nil || (value.kind != tokenString && value.kind != tokenNumber && value.kind != tokenIdent) {
+		return nil, fmt.Errorf("expected value after %q", op.text)
+	}
+
+	return newCompareNode(f, op.text, value.text)
+}
@@ -0,0 +1,135 @@
+package dmark
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlatRecord is a record with its report metadata and published policy,
+// in plain values, for exports of a row per record: CSV files, spreadsheets,
+// SIEM events, search indexes and SQL tables. Enums are their text, like
+// "reject" or "pass", empty when absent.
+type FlatRecord struct {
+	OrgName  string    `json:"org_name"`
+	Email    string    `json:"email"`
+	ReportID string    `json:"report_id"`
+	Begin    time.Time `json:"begin"` // The report date range, UTC
+	End      time.Time `json:"end"`
+
+	Domain string `json:"domain"` // The policy domain, lower-cased
+	ADKIM  string `json:"adkim"`
+	ASPF   string `json:"aspf"`
+	P      string `json:"p"`
+	SP     string `json:"sp"`
+	NP     string `json:"np"`
+	Pct    int    `json:"pct"`
+
+	SourceIP    string   `json:"source_ip"`
+	Count       int      `json:"count"`
+	Disposition string   `json:"disposition"`
+	DMARC       string   `json:"dmarc"` // "pass" when aligned DKIM or SPF passed, "fail" otherwise
+	DKIM        string   `json:"dkim"`  // DMARC-aligned DKIM result
+	SPF         string   `json:"spf"`   // DMARC-aligned SPF result
+	Reasons     []string `json:"reasons"`
+
+	HeaderFrom   string `json:"header_from"`
+	EnvelopeFrom string `json:"envelope_from"`
+	EnvelopeTo   string `json:"envelope_to"`
+
+	// The first DKIM signature and SPF check
+	DKIMDomain   string `json:"dkim_domain"`
+	DKIMSelector string `json:"dkim_selector"`
+	DKIMResult   string `json:"dkim_result"`
+	SPFDomain    string `json:"spf_domain"`
+	SPFScope     string `json:"spf_scope"`
+	SPFResult    string `json:"spf_result"`
+
+	// All of them, as "domain=result"
+	DKIMResults []string `json:"dkim_results"`
+	SPFResults  []string `json:"spf_results"`
+}
+
+// FlatColumns names the values of FlatRecord.Strings, e.g. for a CSV header.
+var FlatColumns = []string{
+	"org_name", "email", "report_id", "begin", "end",
+	"domain", "adkim", "aspf", "p", "sp", "np", "pct",
+	"source_ip", "count", "disposition", "dmarc", "dkim", "spf", "reasons",
+	"header_from", "envelope_from", "envelope_to",
+	"dkim_domain", "dkim_selector", "dkim_result", "spf_domain", "spf_scope", "spf_result",
+	"dkim_results", "spf_results",
+}
+
+// Flatten returns a FlatRecord per record of the report, in order.
+func Flatten(report Feedback) []FlatRecord {
+	meta, policy := report.ReportMetadata, report.PolicyPublished
+	begin, end := meta.DateRange.Times()
+	base := FlatRecord{
+		OrgName:  meta.OrgName,
+		Email:    meta.Email,
+		ReportID: meta.ReportID,
+		Begin:    begin.UTC(),
+		End:      end.UTC(),
+		Domain:   strings.ToLower(policy.Domain),
+		ADKIM:    textOf(policy.ADKIM),
+		ASPF:     textOf(policy.ASPF),
+		P:        textOf(policy.P),
+		SP:       textOf(policy.SP),
+		NP:       textOf(policy.NP),
+		Pct:      policy.Pct,
+	}
+
+	result := make([]FlatRecord, 0, len(report.Records))
+	for _, record := range report.Records {
+		evaluated := record.Row.PolicyEvaluated
+		flat := base
+		if record.Row.SourceIP != nil {
+			flat.SourceIP = record.Row.SourceIP.String()
+		}
+		flat.Count = record.Row.Count
+		flat.Disposition = textOf(evaluated.Disposition)
+		flat.DMARC = textOf(evaluated.DKIM || evaluated.SPF)
+		flat.DKIM = textOf(evaluated.DKIM)
+		flat.SPF = textOf(evaluated.SPF)
+		flat.Reasons = make([]string, 0, len(evaluated.Reason))
+		for _, reason := range evaluated.Reason {
+			flat.Reasons = append(flat.Reasons, textOf(reason.Type))
+		}
+
+		flat.HeaderFrom = record.Identifiers.HeaderFrom
+		flat.EnvelopeFrom = record.Identifiers.EnvelopeFrom
+		flat.EnvelopeTo = record.Identifiers.EnvelopeTo
+
+		flat.DKIMResults = make([]string, 0, len(record.AuthResult.DKIM))
+		for i, dkim := range record.AuthResult.DKIM {
+			if i == 0 {
+				flat.DKIMDomain, flat.DKIMSelector, flat.DKIMResult = dkim.Domain, dkim.Selector, textOf(dkim.Result)
+			}
+			flat.DKIMResults = append(flat.DKIMResults, dkim.Domain+"="+textOf(dkim.Result))
+		}
+		flat.SPFResults = make([]string, 0, len(record.AuthResult.SPF))
+		for i, spf := range record.AuthResult.SPF {
+			if i == 0 {
+				flat.SPFDomain, flat.SPFScope, flat.SPFResult = spf.Domain, textOf(spf.Scope), textOf(spf.Result)
+			}
+			flat.SPFResults = append(flat.SPFResults, spf.Domain+"="+textOf(spf.Result))
+		}
+
+		result = append(result, flat)
+	}
+
+	return result
+}
+
+// Strings returns the values named by FlatColumns: times in RFC 3339,
+// lists separated by spaces.
+func (f FlatRecord) Strings() []string {
+	return []string{
+		f.OrgName, f.Email, f.ReportID, f.Begin.Format(time.RFC3339), f.End.Format(time.RFC3339),
+		f.Domain, f.ADKIM, f.ASPF, f.P, f.SP, f.NP, strconv.Itoa(f.Pct),
+		f.SourceIP, strconv.Itoa(f.Count), f.Disposition, f.DMARC, f.DKIM, f.SPF, strings.Join(f.Reasons, " "),
+		f.HeaderFrom, f.EnvelopeFrom, f.EnvelopeTo,
+		f.DKIMDomain, f.DKIMSelector, f.DKIMResult, f.SPFDomain, f.SPFScope, f.SPFResult,
+		strings.Join(f.DKIMResults, " "), strings.Join(f.SPFResults, " "),
+	}
+}
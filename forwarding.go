@@ -0,0 +1,106 @@
+package dmark
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Reasons a record is likely caused by forwarding, see ForwardingDetector.
+const (
+	ForwardingOverride = "override"        // The reporter applied a forwarded, trusted_forwarder or mailing_list override
+	ForwardingKnownIP  = "known forwarder" // The source IP is in a network of a known forwarder
+	ForwardingDKIMOnly = "dkim only"       // Aligned DKIM passed, aligned SPF did not: forwarders keep signatures, but send from their own IPs
+)
+
+// ForwardingDetector flags records likely caused by forwarding, which
+// lowers pass rates with failures the domain owner cannot fix.
+// The zero value uses overrides and DKIM results only.
+type ForwardingDetector struct {
+	Forwarders []*net.IPNet // Networks of known forwarders, e.g. mailing list servers
+}
+
+// Forwarded returns why the record is likely forwarded mail, if it is.
+func (d *ForwardingDetector) Forwarded(record Record, policy PolicyPublished) (string, bool) {
+	for _, reason := range record.Row.PolicyEvaluated.Reason {
+		switch reason.Type {
+		case PolicyOverrideForwarded, PolicyOverrideTrustedForwarder, PolicyOverrideMailingList:
+			return ForwardingOverride, true
+		}
+	}
+
+	for _, network := range d.Forwarders {
+		if network.Contains(record.Row.SourceIP) {
+			return ForwardingKnownIP, true
+		}
+	}
+
+	if _, ok := record.DKIMAligned(policy); ok {
+		if _, ok = record.SPFAligned(policy); !ok {
+			return ForwardingDKIMOnly, true
+		}
+	}
+
+	return "", false
+}
+
+// Exclude returns copies of the reports without records likely caused by forwarding,
+// for pass rates of mail sent directly. Reports left without records are kept.
+func (d *ForwardingDetector) Exclude(reports []Feedback) []Feedback {
+	result := make([]Feedback, 0, len(reports))
+	for _, report := range reports {
+		records := make([]Record, 0, len(report.Records))
+		for _, record := range report.Records {
+			if _, forwarded := d.Forwarded(record, report.PolicyPublished); !forwarded {
+				records = append(records, record)
+			}
+		}
+		report.Records = records
+		result = append(result, report)
+	}
+
+	return result
+}
+
+// LoadForwarders reads networks of known forwarders from a file
+// with an IP address or CIDR per line; "#" starts a comment.
+func LoadForwarders(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	result := []*net.IPNet{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		if !strings.Contains(line, "/") {
+			if ip := net.ParseIP(line); ip != nil && ip.To4() != nil {
+				line += "/32"
+			} else {
+				line += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		result = append(result, network)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("read %q: %w", path, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package dmark
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzParse checks Parse never panics, and that reports the fast
+// reportDecoder accepts decode the same with encoding/xml.
+func FuzzParse(f *testing.F) {
+	for _, content := range corpus(f) {
+		f.Add(content)
+	}
+	f.Add([]byte(`<feedback><record><row><count>1</count></row></record></feedback>`))
+	f.Add([]byte(`<feedback><policy_published><p>bogus</p></policy_published></feedback>`))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		ParseBytes(content) //nolint:errcheck // only panics matter here
+
+		normalized, err := normalizeEncoding(content)
+		if err != nil || checkDoctype(normalized) != nil {
+			return
+		}
+
+		fast, err := (&reportDecoder{}).decode(normalized)
+		if err != nil {
+			return
+		}
+		slow, err := (&Parser{}).decodeXML(normalized)
+		if err != nil {
+			t.Fatalf("decoded by reportDecoder, but encoding/xml failed: %v", err)
+		}
+
+		fastJSON, _ := json.Marshal(fast)
+		slowJSON, _ := json.Marshal(slow)
+		if string(fastJSON) != string(slowJSON) {
+			t.Fatalf("reportDecoder and encoding/xml differ:\n%s\n%s", fastJSON, slowJSON)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package dmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite golden files in testdata/golden")
+
+// corpus returns reports in testdata/reports by file name, hand-written
+// to reproduce what reporters send, with their quirks.
+func corpus(tb testing.TB) map[string][]byte {
+	tb.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "reports", "*.xml"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(paths) == 0 {
+		tb.Fatal("no reports in testdata/reports")
+	}
+
+	reports := map[string][]byte{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		reports[filepath.Base(path)] = content
+	}
+
+	return reports
+}
+
+// TestParseGolden compares reports parsed with the default quirks to
+// testdata/golden/<name>.json. Run go test -run TestParseGolden -update
+// after intended changes and review the diff.
+func TestParseGolden(t *testing.T) {
+	for name, content := range corpus(t) {
+		t.Run(name, func(t *testing.T) {
+			feedback, err := ParseBytes(content)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			got, err := json.MarshalIndent(feedback, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "golden", strings.TrimSuffix(name, ".xml")+".json")
+			if *update {
+				if err = os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden file, run with -update to create it: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parsed report differs from %s, run with -update to accept it:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestParseGoldenValid checks golden files match the JSON schema of reports.
+func TestParseGoldenValid(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ValidateJSON(content); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
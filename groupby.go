@@ -0,0 +1,117 @@
+package dmark
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// KeyFunc returns the key of the group a record belongs to.
+type KeyFunc func(record Record) string
+
+// Group aggregates records sharing a key.
+type Group struct {
+	Counts
+	Key     string `json:"key"`
+	Records int    `json:"records"`
+}
+
+// GroupBy aggregates records by their keys, sorted by messages, most first, then by key.
+// Records with an empty key form a group too, e.g. unsigned ones with ByDKIMDomain.
+func GroupBy(records []Record, key KeyFunc) []Group {
+	groups := map[string]*Group{}
+	for _, record := range records {
+		k := key(record)
+		group, ok := groups[k]
+		if !ok {
+			group = &Group{Key: k}
+			groups[k] = group
+		}
+		group.Add(record)
+		group.Records++
+	}
+
+	result := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+// GroupReports aggregates records of all reports by their keys, see GroupBy.
+func GroupReports(reports []Feedback, key KeyFunc) []Group {
+	records := []Record{}
+	for _, report := range reports {
+		records = append(records, report.Records...)
+	}
+
+	return GroupBy(records, key)
+}
+
+// BySourceIP groups records by the connecting IP address.
+func BySourceIP(record Record) string {
+	return record.Row.SourceIP.String()
+}
+
+// ByHeaderFrom groups records by the RFC5322.From domain.
+func ByHeaderFrom(record Record) string {
+	return strings.ToLower(record.Identifiers.HeaderFrom)
+}
+
+// ByDisposition groups records by the disposition applied: "none", "quarantine" or "reject".
+func ByDisposition(record Record) string {
+	text, _ := record.Row.PolicyEvaluated.Disposition.MarshalText()
+	return string(text)
+}
+
+// ByDKIMDomain groups records by the domain of the first passing DKIM signature,
+// or of the first signature when none pass, empty for unsigned messages.
+func ByDKIMDomain(record Record) string {
+	signatures := record.AuthResult.DKIM
+	for _, signature := range signatures {
+		if signature.Result == DKIMResultPass {
+			return strings.ToLower(signature.Domain)
+		}
+	}
+	if len(signatures) > 0 {
+		return strings.ToLower(signatures[0].Domain)
+	}
+
+	return ""
+}
+
+// ByASN groups records by the origin AS of the source IP, told by lookup,
+// e.g. from the Team Cymru IP to ASN mapping service.
+// The returned function looks up each IP address once.
+func ByASN(lookup func(ip net.IP) string) KeyFunc {
+	return bySource(lookup)
+}
+
+// ByCountry groups records by the country of the source IP, told by lookup,
+// e.g. from rdap.Client. The returned function looks up each IP address once.
+func ByCountry(lookup func(ip net.IP) string) KeyFunc {
+	return bySource(func(ip net.IP) string {
+		return strings.ToUpper(lookup(ip))
+	})
+}
+
+// bySource memoizes lookup of source IP addresses. The cache is not safe for concurrent use.
+func bySource(lookup func(ip net.IP) string) KeyFunc {
+	cache := map[string]string{}
+	return func(record Record) string {
+		ip := record.Row.SourceIP.String()
+		key, ok := cache[ip]
+		if !ok {
+			key = lookup(record.Row.SourceIP)
+			cache[ip] = key
+		}
+		return key
+	}
+}
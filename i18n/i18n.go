@@ -0,0 +1,221 @@
+// Package i18n localizes text, numbers and dates of HTML reports.
+//
+// Message catalogs are JSON files in locales/, keyed by the English text,
+// so that text missing from a catalog is shown in English. A message is
+// either a string or an object of plural forms ("one", "few", "many", "other")
+// chosen by the count, following CLDR plural rules of the language:
+//
+//	{
+//		"Messages": "Сообщения",
+//		"%s rejected": {"one": "%s отклонено", "few": "%s отклонены", "many": "%s отклонено"}
+//	}
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed locales/*.json
+var catalogs embed.FS
+
+// Locale formats text, numbers and dates for a language.
+type Locale struct {
+	Lang string // ISO 639-1 code, e.g. "ru"
+
+	messages   map[string]message
+	decimal    string // Decimal separator
+	group      string // Thousands separator
+	percent    string // Format of a percentage, e.g. "%s%%"
+	timeLayout string
+	plural     func(n int) string // Returns the plural form for a count
+}
+
+// message is a translation, with plural forms keyed by form name.
+type message struct {
+	text  string
+	forms map[string]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, &m.forms)
+}
+
+// locales are the supported languages, see loadLocales.
+var locales = loadLocales(map[string]*Locale{
+	"en": {
+		decimal:    ".",
+		group:      ",",
+		percent:    "%s%%",
+		timeLayout: "2006-01-02 15:04:05 UTC",
+		plural: func(n int) string {
+			if n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	},
+	"ru": {
+		decimal:    ",",
+		group:      "\u00a0",
+		percent:    "%s\u00a0%%",
+		timeLayout: "02.01.2006 15:04:05 UTC",
+		plural: func(n int) string {
+			if n < 0 {
+				n = -n
+			}
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			}
+			return "many"
+		},
+	},
+})
+
+// English is the default locale, with text as written in templates.
+var English = locales["en"]
+
+// loadLocales sets the language codes and loads catalogs from locales/<lang>.json.
+func loadLocales(locales map[string]*Locale) map[string]*Locale {
+	for lang, l := range locales {
+		l.Lang = lang
+
+		content, err := catalogs.ReadFile(path.Join("locales", lang+".json"))
+		if err != nil {
+			panic(err)
+		}
+		if err = json.Unmarshal(content, &l.messages); err != nil {
+			panic(fmt.Errorf("parse %s catalog: %w", lang, err))
+		}
+	}
+
+	return locales
+}
+
+// Languages returns codes of supported languages, sorted.
+func Languages() []string {
+	langs := make([]string, 0, len(locales))
+	for lang := range locales {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// Lookup returns the locale for a language code; region subtags are ignored,
+// so "ru-RU" and "ru_RU.UTF-8" are both "ru".
+func Lookup(lang string) (*Locale, error) {
+	code := strings.ToLower(lang)
+	if i := strings.IndexAny(code, "-_."); i >= 0 {
+		code = code[:i]
+	}
+
+	l, ok := locales[code]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q, supported: %s", lang, strings.Join(Languages(), ", "))
+	}
+
+	return l, nil
+}
+
+// Translate returns the translation of key, formatted with args like fmt.Sprintf when there are any.
+func (l *Locale) Translate(key string, args ...interface{}) string {
+	text := key
+	if m, ok := l.messages[key]; ok && m.text != "" {
+		text = m.text
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Plural returns the plural form of key for n, formatted with n as a localized number, e.g.
+// Plural("%s messages", 2) is "2 messages" in English and "2 сообщения" in Russian.
+func (l *Locale) Plural(key string, n int) string {
+	text := key
+	if m, ok := l.messages[key]; ok {
+		if form, ok := m.forms[l.plural(n)]; ok {
+			text = form
+		} else if form, ok := m.forms["other"]; ok {
+			text = form
+		}
+	}
+
+	return fmt.Sprintf(text, l.FormatNumber(n))
+}
+
+// FormatNumber formats an integer with thousands separators, e.g. "1,234,567".
+func (l *Locale) FormatNumber(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	return sign + l.groupDigits(digits)
+}
+
+func (l *Locale) groupDigits(digits string) string {
+	b := strings.Builder{}
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// FormatFloat formats f with the given number of decimals.
+func (l *Locale) FormatFloat(f float64, decimals int) string {
+	s := strconv.FormatFloat(f, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	s = sign + l.groupDigits(whole)
+	if fraction != "" {
+		s += l.decimal + fraction
+	}
+
+	return s
+}
+
+// Percent returns part of total as a percentage with one decimal, e.g. "42.5%".
+func (l *Locale) Percent(part, total int) string {
+	value := 0.0
+	if total != 0 {
+		value = float64(part) * 100 / float64(total)
+	}
+
+	return fmt.Sprintf(l.percent, l.FormatFloat(value, 1))
+}
+
+// FormatTime formats seconds since epoch in UTC, using the optional layout or the locale one.
+func (l *Locale) FormatTime(epoch int, layout ...string) string {
+	lt := l.timeLayout
+	if len(layout) > 0 {
+		lt = layout[0]
+	}
+
+	return time.Unix(int64(epoch), 0).UTC().Format(lt)
+}
@@ -0,0 +1,81 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client sends points to InfluxDB.
+// With Bucket set it uses the 2.x API (/api/v2/write), otherwise the 1.x API (/write).
+type Client struct {
+	URL        string // e.g. http://localhost:8086
+	HTTPClient *http.Client
+
+	// 1.x API
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// 2.x API
+	Org    string
+	Bucket string
+	Token  string
+}
+
+// Write sends points in a single request.
+func (c *Client) Write(ctx context.Context, points []Point) error {
+	body := &bytes.Buffer{}
+	if err := Write(body, points); err != nil {
+		return err
+	}
+
+	var endpoint string
+	params := url.Values{"precision": {"s"}}
+	if c.Bucket != "" {
+		endpoint = "/api/v2/write"
+		params.Set("org", c.Org)
+		params.Set("bucket", c.Bucket)
+	} else {
+		endpoint = "/write"
+		params.Set("db", c.Database)
+		if c.RetentionPolicy != "" {
+			params.Set("rp", c.RetentionPolicy)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+endpoint+"?"+params.Encode(), body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Token "+c.Token)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("write request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("write request: unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package influx writes DMARC metrics as InfluxDB line protocol
+// and sends them with InfluxDB 1.x or 2.x write APIs.
+package influx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// Measurement names.
+const (
+	RecordMeasurement = "dmarc_record"
+	DailyMeasurement  = "dmarc_daily"
+)
+
+// Point is a single line protocol point.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{} // int, float64, bool or string values
+	Time        time.Time
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// WriteTo writes the point as a line, with the time in seconds.
+func (p Point) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	for _, key := range sortedKeys(p.Tags) {
+		if p.Tags[key] == "" {
+			// empty tag values are not allowed
+			continue
+		}
+		b.WriteString("," + tagEscaper.Replace(key) + "=" + tagEscaper.Replace(p.Tags[key]))
+	}
+
+	for i, key := range sortedFieldKeys(p.Fields) {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(key) + "=")
+
+		switch v := p.Fields[key].(type) {
+		case int:
+			b.WriteString(strconv.Itoa(v) + "i")
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case string:
+			b.WriteString(`"` + stringEscaper.Replace(v) + `"`)
+		default:
+			b.WriteString(`"` + stringEscaper.Replace(fmt.Sprint(v)) + `"`)
+		}
+	}
+
+	b.WriteString(" " + strconv.FormatInt(p.Time.Unix(), 10) + "\n")
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// RecordPoints returns a point per distinct record of each report, timed at the report begin.
+// Records with equal tags are summed, as InfluxDB would keep only the last of them.
+func RecordPoints(reports []dmark.Feedback) []Point {
+	points := []Point{}
+	for _, report := range reports {
+		index := map[string]int{}
+		for _, record := range report.Records {
+			evaluated := record.Row.PolicyEvaluated
+			tags := map[string]string{
+				"domain":      strings.ToLower(report.PolicyPublished.Domain),
+				"org_name":    report.ReportMetadata.OrgName,
+				"source_ip":   record.Row.SourceIP.String(),
+				"header_from": strings.ToLower(record.Identifiers.HeaderFrom),
+				"disposition": textOf(evaluated.Disposition),
+				"dkim":        resultText(bool(evaluated.DKIM)),
+				"spf":         resultText(bool(evaluated.SPF)),
+			}
+
+			key := fmt.Sprint(tags)
+			if i, ok := index[key]; ok {
+				points[i].Fields["count"] = points[i].Fields["count"].(int) + record.Row.Count
+				continue
+			}
+			index[key] = len(points)
+
+			points = append(points, Point{
+				Measurement: RecordMeasurement,
+				Tags:        tags,
+				Fields: map[string]interface{}{
+					"count":     record.Row.Count,
+					"report_id": report.ReportMetadata.ReportID,
+				},
+				Time: time.Unix(int64(report.ReportMetadata.DateRange.Begin), 0),
+			})
+		}
+	}
+
+	return points
+}
+
+// DailyPoints returns a point per day and domain.
+func DailyPoints(days []store.DomainDay) []Point {
+	points := make([]Point, 0, len(days))
+	for _, d := range days {
+		points = append(points, Point{
+			Measurement: DailyMeasurement,
+			Tags:        map[string]string{"domain": d.Domain},
+			Fields: map[string]interface{}{
+				"messages":    d.Messages,
+				"passed":      d.Passed,
+				"failed":      d.Failed(),
+				"dkim_passed": d.DKIMPassed,
+				"spf_passed":  d.SPFPassed,
+				"quarantined": d.Quarantined,
+				"rejected":    d.Rejected,
+				"pass_rate":   d.PassRate(),
+			},
+			Time: d.Day,
+		})
+	}
+
+	return points
+}
+
+// Write writes points as line protocol.
+func Write(w io.Writer, points []Point) error {
+	for _, p := range points {
+		if _, err := p.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFieldKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func resultText(pass bool) string {
+	if pass {
+		return "pass"
+	}
+	return "fail"
+}
+
+func textOf(v interface{ MarshalText() ([]byte, error) }) string {
+	text, _ := v.MarshalText()
+	return string(text)
+}
@@ -0,0 +1,604 @@
+// Command apigen writes the OpenAPI specification of the dmarkd API, which
+// dmarkd serves at /openapi.json, and the methods of the dmarkclient package,
+// from the operations listed here and the Go types of their responses.
+// Run go generate in cmd/dmarkd after changing the API.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/dmarkclient"
+	"github.com/chuhlomin/dmark-go/internal/jsonschema"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// Kinds of parameters.
+const (
+	kindString  = "string"
+	kindInteger = "integer"
+	kindDate    = "date" // A day, 2006-01-02
+)
+
+type param struct {
+	Name        string // As sent
+	In          string // "query", "path" or "header"
+	Kind        string // kindString, kindInteger or kindDate
+	Description string
+}
+
+// GoName is the name of the param in Go, like ReportID for report_id.
+func (p param) GoName() string {
+	name := ""
+	for _, part := range strings.FieldsFunc(p.Name, func(r rune) bool { return r == '_' || r == '-' }) {
+		switch upper := strings.ToUpper(part); upper {
+		case "ID", "IP", "URL":
+			name += upper
+		default:
+			name += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return name
+}
+
+// GoType is the type of the param in Go.
+func (p param) GoType() string {
+	switch p.Kind {
+	case kindInteger:
+		return "int"
+	case kindDate:
+		return "time.Time"
+	}
+	return "string"
+}
+
+type operation struct {
+	ID          string // Method of dmarkclient.Client and operationId
+	Method      string
+	Path        string // With {name} path params
+	Summary     string
+	Description string
+	Scope       string // Scope of the token required, none when empty
+	Params      []param
+	Body        reflect.Type // JSON request body, if any
+	RawBody     string       // Content types of a raw request body, if any
+	Status      int          // Of success
+	Response    reflect.Type // JSON response body, none when nil
+	Stream      string       // Content types of a response streamed as is, if any
+}
+
+var dateParams = []param{
+	{Name: "from", In: "query", Kind: kindDate, Description: "Reports beginning on this day or later, UTC"},
+	{Name: "to", In: "query", Kind: kindDate, Description: "Reports beginning before this day, UTC"},
+}
+
+var operations = []operation{
+	{
+		ID:          "Ingest",
+		Method:      http.MethodPost,
+		Path:        "/ingest",
+		Summary:     "Store reports",
+		Description: "Accepts a report as raw XML, gzip or zip, or an email message with reports attached. Responds with 422 when no report was saved.",
+		Scope:       store.ScopeIngest,
+		Params: []param{
+			{Name: "name", In: "query", Kind: kindString, Description: "File name of the upload, telling its format, like report.xml.gz; from Content-Disposition when empty"},
+			{Name: "Content-Type", In: "header", Kind: kindString, Description: "message/rfc822 for email messages"},
+		},
+		RawBody:  "application/octet-stream",
+		Status:   http.StatusOK,
+		Response: reflect.TypeOf(dmarkclient.IngestResponse{}),
+	},
+	{
+		ID:          "Search",
+		Method:      http.MethodGet,
+		Path:        "/search",
+		Summary:     "Search records",
+		Description: "Returns records of stored reports matching all parameters, see store.SearchQuery.",
+		Scope:       store.ScopeRead,
+		Params: append([]param{
+			{Name: "ip", In: "query", Kind: kindString, Description: "Source IP address or network in CIDR notation"},
+			{Name: "domain", In: "query", Kind: kindString, Description: "Part of the policy, header_from, envelope_from, DKIM or SPF domain"},
+			{Name: "selector", In: "query", Kind: kindString, Description: "DKIM selector"},
+			{Name: "report_id", In: "query", Kind: kindString, Description: "Report ID"},
+			{Name: "org", In: "query", Kind: kindString, Description: "Part of the reporter organization name"},
+			{Name: "limit", In: "query", Kind: kindInteger, Description: "Maximum number of records, 1000 by default"},
+		}, dateParams...),
+		Status:   http.StatusOK,
+		Response: reflect.TypeOf(dmarkclient.SearchResponse{}),
+	},
+	{
+		ID:          "Export",
+		Method:      http.MethodGet,
+		Path:        "/export",
+		Summary:     "Export records",
+		Description: "Streams records of stored reports as CSV or NDJSON, a row per record, see dmark.FlatRecord.",
+		Scope:       store.ScopeRead,
+		Params: append([]param{
+			{Name: "format", In: "query", Kind: kindString, Description: "csv, the default, or ndjson"},
+			{Name: "domain", In: "query", Kind: kindString, Description: "Policy domain"},
+			{Name: "where", In: "query", Kind: kindString, Description: "Keep only records matching an expression, see the filter package"},
+		}, dateParams...),
+		Status: http.StatusOK,
+		Stream: "text/csv, application/x-ndjson",
+	},
+	{
+		ID:          "Portfolio",
+		Method:      http.MethodGet,
+		Path:        "/portfolio",
+		Summary:     "Summarize domains",
+		Description: "Returns where each policy domain stands: counts, policy, score and the trend of the pass rate, see dmark.Portfolio.",
+		Scope:       store.ScopeRead,
+		Params: []param{
+			{Name: "days", In: "query", Kind: kindInteger, Description: "Number of days of reports to summarize, 30 by default"},
+			{Name: "window", In: "query", Kind: kindInteger, Description: "Number of days to compare pass rates of for trends, 7 by default"},
+		},
+		Status:   http.StatusOK,
+		Response: reflect.TypeOf([]dmark.PortfolioDomain{}),
+	},
+	{
+		ID:          "Changes",
+		Method:      http.MethodGet,
+		Path:        "/changes",
+		Summary:     "List DNS changes",
+		Description: "Returns changes recorded with dmark-change, with counts of their domains before and since each, see store.Impacts.",
+		Scope:       store.ScopeRead,
+		Params: []param{
+			{Name: "window", In: "query", Kind: kindInteger, Description: "Number of days to compare before and since changes, 7 by default"},
+		},
+		Status:   http.StatusOK,
+		Response: reflect.TypeOf([]store.ChangeImpact{}),
+	},
+	{
+		ID:          "Tags",
+		Method:      http.MethodGet,
+		Path:        "/tags",
+		Summary:     "List tags",
+		Description: "Returns tags of sources, see store.Tag.",
+		Scope:       store.ScopeRead,
+		Params: []param{
+			{Name: "ip", In: "query", Kind: kindString, Description: "Only tags applying to this source IP address"},
+		},
+		Status:   http.StatusOK,
+		Response: reflect.TypeOf([]store.Tag{}),
+	},
+	{
+		ID:          "AddTag",
+		Method:      http.MethodPost,
+		Path:        "/tags",
+		Summary:     "Add a tag",
+		Description: "Tags a source; the ID, author and time of creation are set by the server. Needs the tag scope besides read.",
+		Scope:       store.ScopeRead,
+		Body:        reflect.TypeOf(store.Tag{}),
+		Status:      http.StatusCreated,
+		Response:    reflect.TypeOf(store.Tag{}),
+	},
+	{
+		ID:          "RemoveTag",
+		Method:      http.MethodDelete,
+		Path:        "/tags/{id}",
+		Summary:     "Remove a tag",
+		Description: "Needs the tag scope besides read.",
+		Scope:       store.ScopeRead,
+		Params: []param{
+			{Name: "id", In: "path", Kind: kindString, Description: "ID of the tag"},
+		},
+		Status: http.StatusNoContent,
+	},
+	{
+		ID:       "Healthz",
+		Method:   http.MethodGet,
+		Path:     "/healthz",
+		Summary:  "Check the server is up",
+		Status:   http.StatusOK,
+		Response: reflect.TypeOf(dmarkclient.Health{}),
+	},
+	{
+		ID:          "Readyz",
+		Method:      http.MethodGet,
+		Path:        "/readyz",
+		Summary:     "Check stores of all tenants can be read and written to",
+		Description: "Responds with 503 when they can not. The result is reused for 5 seconds.",
+		Status:      http.StatusOK,
+		Response:    reflect.TypeOf(dmarkclient.Health{}),
+	},
+}
+
+// packages are where descriptions of types in responses come from,
+// by import path, relative to the module root.
+var packages = map[string]string{
+	"github.com/chuhlomin/dmark-go":             ".",
+	"github.com/chuhlomin/dmark-go/dmarkclient": "dmarkclient",
+	"github.com/chuhlomin/dmark-go/store":       "store",
+}
+
+func spec(root string) ([]byte, error) {
+	g := &jsonschema.Generator{
+		Docs:      map[string]string{},
+		Defs:      map[string]jsonschema.Schema{},
+		RefPrefix: "#/components/schemas/",
+	}
+	for pkgPath, dir := range packages {
+		if err := jsonschema.ParseDocs(g.Docs, filepath.Join(root, dir), pkgPath); err != nil {
+			return nil, err
+		}
+	}
+
+	errorResponse := jsonschema.Schema{
+		"description": "Error",
+		"content": jsonschema.Schema{
+			"application/json": jsonschema.Schema{"schema": jsonschema.Schema{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+
+	paths := jsonschema.Schema{}
+	for _, op := range operations {
+		o := jsonschema.Schema{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"responses":   jsonschema.Schema{"default": errorResponse},
+		}
+		description := op.Description
+		if op.Scope != "" {
+			description = strings.TrimSpace(description + " Needs a token with the " + op.Scope + " scope.")
+		} else {
+			o["security"] = []jsonschema.Schema{}
+		}
+		if description != "" {
+			o["description"] = description
+		}
+
+		parameters := []jsonschema.Schema{}
+		for _, p := range op.Params {
+			schema := jsonschema.Schema{"type": p.Kind}
+			if p.Kind == kindDate {
+				schema = jsonschema.Schema{"type": "string", "format": "date"}
+			}
+			parameters = append(parameters, jsonschema.Schema{
+				"name":        p.Name,
+				"in":          p.In,
+				"required":    p.In == "path",
+				"description": p.Description,
+				"schema":      schema,
+			})
+		}
+		if len(parameters) > 0 {
+			o["parameters"] = parameters
+		}
+
+		switch {
+		case op.Body != nil:
+			o["requestBody"] = jsonschema.Schema{
+				"required": true,
+				"content":  jsonschema.Schema{"application/json": jsonschema.Schema{"schema": g.Schema(op.Body)}},
+			}
+		case op.RawBody != "":
+			o["requestBody"] = jsonschema.Schema{
+				"required": true,
+				"content":  jsonschema.Schema{op.RawBody: jsonschema.Schema{"schema": jsonschema.Schema{"type": "string", "format": "binary"}}},
+			}
+		}
+
+		success := jsonschema.Schema{"description": http.StatusText(op.Status)}
+		switch {
+		case op.Response != nil:
+			schema := g.Schema(op.Response)
+			if op.Response.Kind() == reflect.Slice {
+				schema["type"] = "array" // handlers encode empty lists as []
+			}
+			success["content"] = jsonschema.Schema{"application/json": jsonschema.Schema{"schema": schema}}
+		case op.Stream != "":
+			content := jsonschema.Schema{}
+			for _, contentType := range strings.Split(op.Stream, ", ") {
+				content[contentType] = jsonschema.Schema{"schema": jsonschema.Schema{"type": "string"}}
+			}
+			success["content"] = content
+		}
+		o["responses"].(jsonschema.Schema)[fmt.Sprint(op.Status)] = success
+
+		path, ok := paths[op.Path].(jsonschema.Schema)
+		if !ok {
+			path = jsonschema.Schema{}
+			paths[op.Path] = path
+		}
+		path[strings.ToLower(op.Method)] = o
+	}
+
+	g.Defs["Error"] = jsonschema.Schema{
+		"type":       "object",
+		"properties": jsonschema.Schema{"error": jsonschema.Schema{"type": "string"}},
+		"required":   []string{"error"},
+	}
+
+	doc := jsonschema.Schema{
+		"openapi": "3.1.0",
+		"info": jsonschema.Schema{
+			"title":       "dmarkd",
+			"version":     "1",
+			"description": "Stores DMARC aggregate reports and serves what they tell. Tokens are tenant tokens, or API tokens created with dmark-token.",
+		},
+		"paths": paths,
+		"components": jsonschema.Schema{
+			"schemas": g.Defs,
+			"securitySchemes": jsonschema.Schema{
+				"bearer": jsonschema.Schema{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []jsonschema.Schema{{"bearer": []string{}}},
+	}
+
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// goType returns the name of the type in the dmarkclient package.
+func goType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + goType(t.Elem())
+	case reflect.Ptr:
+		return "*" + goType(t.Elem())
+	}
+	if t.PkgPath() == reflect.TypeOf(dmarkclient.Client{}).PkgPath() {
+		return t.Name()
+	}
+	return t.String()
+}
+
+var funcs = template.FuncMap{
+	"goType": goType,
+	"lower":  strings.ToLower,
+	"title": func(s string) string {
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"pathExpr": func(op operation) string {
+		path := fmt.Sprintf("%q", op.Path)
+		for _, p := range op.Params {
+			if p.In == "path" {
+				path = strings.Replace(path, "{"+p.Name+"}", `"+url.PathEscape(`+strings.ToLower(p.GoName())+`)+"`, 1)
+			}
+		}
+		return strings.TrimSuffix(path, `+""`)
+	},
+}
+
+// HasParams reports whether the operation has query or header params, passed in a struct.
+func (op operation) HasParams() bool {
+	for _, p := range op.Params {
+		if p.In != "path" {
+			return true
+		}
+	}
+	return false
+}
+
+// PathParams returns params in the path, passed as arguments.
+func (op operation) PathParams() []param {
+	result := []param{}
+	for _, p := range op.Params {
+		if p.In == "path" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Doc is the doc comment of the method.
+func (op operation) Doc() string {
+	text := op.ID + " calls " + op.Method + " " + op.Path + ": " + strings.ToLower(op.Summary[:1]) + op.Summary[1:] + "."
+	if op.Description != "" {
+		text += " " + op.Description
+	}
+
+	lines := []string{}
+	line := "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 80 && line != "//" {
+			lines = append(lines, line)
+			line = "//"
+		}
+		line += " " + word
+	}
+
+	return strings.Join(append(lines, line), "\n")
+}
+
+// IsSlice reports whether the response is a list, returned by value.
+func (op operation) IsSlice() bool {
+	return op.Response != nil && op.Response.Kind() == reflect.Slice
+}
+
+var clientTemplate = template.Must(template.New("client").Funcs(funcs).Parse(`// Code generated by go run ./internal/apigen; DO NOT EDIT.
+
+package dmarkclient
+
+import (
+{{- range $i, $group := .Imports }}{{ if $i }}
+{{ end }}
+{{- range $group }}
+	"{{ . }}"
+{{- end }}
+{{- end }}
+)
+{{ range .Operations }}{{ if .HasParams }}
+// {{ .ID }}Params are parameters of Client.{{ .ID }}; zero values are not sent.
+type {{ .ID }}Params struct {
+{{- range .Params }}{{ if ne .In "path" }}
+	{{ .GoName }} {{ .GoType }} // {{ .Description }}
+{{- end }}{{ end }}
+}
+{{ end }}
+{{ .Doc }}
+func (c *Client) {{ .ID }}(ctx context.Context
+	{{- range .PathParams }}, {{ lower .GoName }} string{{ end }}
+	{{- if .HasParams }}, params {{ .ID }}Params{{ end }}
+	{{- if .Body }}, body {{ goType .Body }}{{ end }}
+	{{- if .RawBody }}, body io.Reader{{ end }}) (
+	{{- if .Response }}{{ if .IsSlice }}{{ goType .Response }}{{ else }}*{{ goType .Response }}{{ end }}, {{ end }}
+	{{- if .Stream }}io.ReadCloser, {{ end }}error) {
+	query := url.Values{}
+	header := http.Header{}
+{{- range .Params }}
+{{- if eq .In "query" }}
+{{- if eq .Kind "integer" }}
+	if params.{{ .GoName }} != 0 {
+		query.Set("{{ .Name }}", strconv.Itoa(params.{{ .GoName }}))
+	}
+{{- else if eq .Kind "date" }}
+	if !params.{{ .GoName }}.IsZero() {
+		query.Set("{{ .Name }}", params.{{ .GoName }}.Format("2006-01-02"))
+	}
+{{- else }}
+	if params.{{ .GoName }} != "" {
+		query.Set("{{ .Name }}", params.{{ .GoName }})
+	}
+{{- end }}
+{{- else if eq .In "header" }}
+	if params.{{ .GoName }} != "" {
+		header.Set("{{ .Name }}", params.{{ .GoName }})
+	}
+{{- end }}
+{{- end }}
+{{- if .Body }}
+	content, err := json.Marshal(body)
+	if err != nil {
+		return {{ if .Response }}nil, {{ end }}err
+	}
+	header.Set("Content-Type", "application/json")
+	resp, err := c.send(ctx, http.Method{{ title (lower .Method) }}, {{ pathExpr . }}, query, header, bytes.NewReader(content))
+{{- else if .RawBody }}
+	resp, err := c.send(ctx, http.Method{{ title (lower .Method) }}, {{ pathExpr . }}, query, header, body)
+{{- else }}
+	resp, err := c.send(ctx, http.Method{{ title (lower .Method) }}, {{ pathExpr . }}, query, header, nil)
+{{- end }}
+	if err != nil {
+		return {{ if or .Response .Stream }}nil, {{ end }}err
+	}
+{{- if .Stream }}
+
+	return resp.Body, nil
+{{- else if .Response }}
+
+	var result {{ goType .Response }}
+	if err = decode(resp, &result); err != nil {
+		return nil, err
+	}
+
+	return {{ if not .IsSlice }}&{{ end }}result, nil
+{{- else }}
+	resp.Body.Close()
+
+	return nil
+{{- end }}
+}
+{{ end }}`))
+
+// imports lists packages the client methods of the operations use,
+// standard ones first, like goimports groups them.
+func imports(ops []operation) [][]string {
+	used := map[string]bool{"context": true, "net/http": true, "net/url": true}
+	addType := func(t reflect.Type) {
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.PkgPath() != reflect.TypeOf(dmarkclient.Client{}).PkgPath() {
+			used[t.PkgPath()] = true
+		}
+	}
+	for _, op := range ops {
+		if op.Body != nil {
+			used["bytes"], used["encoding/json"] = true, true
+			addType(op.Body)
+		}
+		if op.RawBody != "" || op.Stream != "" {
+			used["io"] = true
+		}
+		if op.Response != nil {
+			addType(op.Response)
+		}
+		for _, p := range op.Params {
+			switch {
+			case p.In == "query" && p.Kind == kindInteger:
+				used["strconv"] = true
+			case p.In == "query" && p.Kind == kindDate:
+				used["time"] = true
+			}
+		}
+	}
+
+	std, module := []string{}, []string{}
+	for path := range used {
+		if strings.Contains(path, ".") {
+			module = append(module, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(module)
+
+	return [][]string{std, module}
+}
+
+func client() ([]byte, error) {
+	ops := make([]operation, len(operations))
+	copy(ops, operations)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+
+	buf := bytes.Buffer{}
+	if err := clientTemplate.Execute(&buf, map[string]interface{}{"Operations": ops, "Imports": imports(ops)}); err != nil {
+		return nil, err
+	}
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format client: %w\n%s", err, buf.Bytes())
+	}
+
+	return source, nil
+}
+
+func run(root, specPath, clientPath string) error {
+	content, err := spec(root)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(specPath, content, 0644); err != nil {
+		return err
+	}
+
+	if content, err = client(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(clientPath, content, 0644)
+}
+
+func main() {
+	root := flag.String("root", ".", "Root of the module, for descriptions of types")
+	specPath := flag.String("spec", "openapi.json", "Output file of the OpenAPI specification")
+	clientPath := flag.String("client", "dmarkclient/client.go", "Output file of the client methods")
+	flag.Parse()
+
+	if err := run(*root, *specPath, *clientPath); err != nil {
+		logging.Fatal(err)
+	}
+}
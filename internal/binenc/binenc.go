@@ -0,0 +1,463 @@
+// Package binenc maps Go values to the data model shared by CBOR and MessagePack:
+// nil, booleans, integers, floats, strings, byte strings, arrays and maps.
+// Format packages implement Writer and Reader for their wire encoding.
+//
+// Structs are maps keyed by field names taken from the format tag
+// (e.g. `cbor:"name,omitempty"`), then from the json tag, then the field name.
+// Values implementing encoding.TextMarshaler, like enums and net.IP,
+// are strings; empty strings decode to zero values.
+// Map keys are sorted, so the encoding is deterministic.
+package binenc
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Writer writes items in a wire format.
+type Writer interface {
+	Nil()
+	Bool(b bool)
+	Int(i int64)
+	Uint(u uint64)
+	Float(f float64)
+	String(s string)
+	Bytes(b []byte)
+	Array(n int) // Header of an array of n items
+	Map(n int)   // Header of a map of n key-value pairs
+}
+
+// Kind is the kind of an item read by Reader.
+type Kind int
+
+const (
+	KindNil Kind = iota + 1
+	KindBool
+	KindInt
+	KindUint
+	KindFloat
+	KindString
+	KindBytes
+	KindArray
+	KindMap
+)
+
+// Item is an item read by Reader. Arrays and maps are followed by
+// Len items or key-value pairs.
+type Item struct {
+	Kind  Kind
+	Bool  bool
+	Int   int64
+	Uint  uint64
+	Float float64
+	Bytes []byte // String and byte string content
+	Len   int
+}
+
+// Reader reads items in a wire format.
+type Reader interface {
+	Next() (Item, error)
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Encode writes v, using tag to name struct fields.
+func Encode(w Writer, v interface{}, tag string) error {
+	return encode(w, reflect.ValueOf(v), tag)
+}
+
+func encode(w Writer, v reflect.Value, tag string) error {
+	if !v.IsValid() {
+		w.Nil()
+		return nil
+	}
+
+	if v.Type().Implements(textMarshalerType) ||
+		v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() || v.Kind() == reflect.Slice && v.IsNil() {
+			w.Nil()
+			return nil
+		}
+		m, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok {
+			m = v.Addr().Interface().(encoding.TextMarshaler)
+		}
+		text, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		w.String(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		w.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.Int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		w.Uint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		w.Float(v.Float())
+	case reflect.String:
+		w.String(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			w.Nil()
+			return nil
+		}
+		return encode(w, v.Elem(), tag)
+	case reflect.Slice:
+		if v.IsNil() {
+			w.Nil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.Bytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		w.Array(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encode(w, v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.Nil()
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		w.Map(len(keys))
+		for _, key := range keys {
+			w.String(key.String())
+			if err := encode(w, v.MapIndex(key), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return encodeStruct(w, v, tag)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func encodeStruct(w Writer, v reflect.Value, tag string) error {
+	fields := structFields(v.Type(), tag)
+
+	present := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if f.omitEmpty && v.Field(f.index).IsZero() {
+			continue
+		}
+		present = append(present, f)
+	}
+
+	// fields of a copied struct are not addressable, pointer receivers need them to be
+	if !v.CanAddr() {
+		addressable := reflect.New(v.Type()).Elem()
+		addressable.Set(v)
+		v = addressable
+	}
+
+	w.Map(len(present))
+	for _, f := range present {
+		w.String(f.name)
+		if err := encode(w, v.Field(f.index), tag); err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type, tag string) []field {
+	fields := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		spec, ok := sf.Tag.Lookup(tag)
+		if !ok {
+			spec = sf.Tag.Get("json")
+		}
+		name, options, _ := strings.Cut(spec, ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, field{
+			name:      name,
+			index:     i,
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+		})
+	}
+
+	return fields
+}
+
+// Decode reads an item into v, which has to be a non-nil pointer.
+func Decode(r Reader, v interface{}, tag string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode into non-pointer %T", v)
+	}
+
+	item, err := r.Next()
+	if err != nil {
+		return err
+	}
+
+	return decode(r, item, rv.Elem(), tag)
+}
+
+func decode(r Reader, item Item, v reflect.Value, tag string) error {
+	if item.Kind == KindNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decode(r, item, v.Elem(), tag)
+	}
+
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		if item.Kind != KindString && item.Kind != KindBytes {
+			return mismatch(item, v)
+		}
+		if len(item.Bytes) == 0 {
+			// enums marshal their zero value, meaning absent, as ""
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(item.Bytes)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if item.Kind != KindBool {
+			return mismatch(item, v)
+		}
+		v.SetBool(item.Bool)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := item.int()
+		if !ok || v.OverflowInt(i) {
+			return mismatch(item, v)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, ok := item.uint()
+		if !ok || v.OverflowUint(u) {
+			return mismatch(item, v)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch item.Kind {
+		case KindFloat:
+			v.SetFloat(item.Float)
+		case KindInt:
+			v.SetFloat(float64(item.Int))
+		case KindUint:
+			v.SetFloat(float64(item.Uint))
+		default:
+			return mismatch(item, v)
+		}
+	case reflect.String:
+		if item.Kind != KindString && item.Kind != KindBytes {
+			return mismatch(item, v)
+		}
+		v.SetString(string(item.Bytes))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && (item.Kind == KindBytes || item.Kind == KindString) {
+			v.SetBytes(append([]byte{}, item.Bytes...))
+			return nil
+		}
+		if item.Kind != KindArray {
+			return mismatch(item, v)
+		}
+		slice := reflect.MakeSlice(v.Type(), item.Len, item.Len)
+		for i := 0; i < item.Len; i++ {
+			if err := decodeNext(r, slice.Index(i), tag); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		if item.Kind != KindArray || item.Len != v.Len() {
+			return mismatch(item, v)
+		}
+		for i := 0; i < item.Len; i++ {
+			if err := decodeNext(r, v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if item.Kind != KindMap || v.Type().Key().Kind() != reflect.String {
+			return mismatch(item, v)
+		}
+		m := reflect.MakeMapWithSize(v.Type(), item.Len)
+		for i := 0; i < item.Len; i++ {
+			key, err := readKey(r)
+			if err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err = decodeNext(r, value, tag); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		if item.Kind != KindMap {
+			return mismatch(item, v)
+		}
+		fields := map[string]int{}
+		for _, f := range structFields(v.Type(), tag) {
+			fields[f.name] = f.index
+		}
+		for i := 0; i < item.Len; i++ {
+			key, err := readKey(r)
+			if err != nil {
+				return err
+			}
+			index, ok := fields[key]
+			if !ok {
+				if err = skip(r); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = decodeNext(r, v.Field(index), tag); err != nil {
+				return fmt.Errorf("field %s: %w", key, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func decodeNext(r Reader, v reflect.Value, tag string) error {
+	item, err := r.Next()
+	if err != nil {
+		return err
+	}
+
+	return decode(r, item, v, tag)
+}
+
+func readKey(r Reader) (string, error) {
+	item, err := r.Next()
+	if err != nil {
+		return "", err
+	}
+	if item.Kind != KindString && item.Kind != KindBytes {
+		return "", errors.New("map key is not a string")
+	}
+
+	return string(item.Bytes), nil
+}
+
+// skip reads the next item, including nested items.
+func skip(r Reader) error {
+	item, err := r.Next()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	switch item.Kind {
+	case KindArray:
+		n = item.Len
+	case KindMap:
+		n = 2 * item.Len
+	}
+	for i := 0; i < n; i++ {
+		if err = skip(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (item Item) int() (int64, bool) {
+	switch item.Kind {
+	case KindInt:
+		return item.Int, true
+	case KindUint:
+		return int64(item.Uint), item.Uint <= math.MaxInt64
+	}
+
+	return 0, false
+}
+
+func (item Item) uint() (uint64, bool) {
+	switch item.Kind {
+	case KindUint:
+		return item.Uint, true
+	case KindInt:
+		return uint64(item.Int), item.Int >= 0
+	}
+
+	return 0, false
+}
+
+func mismatch(item Item, v reflect.Value) error {
+	return fmt.Errorf("cannot decode %s into %s", item.Kind, v.Type())
+}
+
+func (k Kind) String() string {
+	switch k {
+	case KindNil:
+		return "nil"
+	case KindBool:
+		return "bool"
+	case KindInt, KindUint:
+		return "integer"
+	case KindFloat:
+		return "float"
+	case KindString:
+		return "string"
+	case KindBytes:
+		return "bytes"
+	case KindArray:
+		return "array"
+	case KindMap:
+		return "map"
+	}
+
+	return "unknown"
+}
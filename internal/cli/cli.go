@@ -0,0 +1,159 @@
+// Package cli runs dmark commands as cobra commands. Flags they register on
+// the command line flag set become flags of the command, and every command
+// has completion and man subcommands writing its completion script for
+// bash, zsh or fish and its man pages:
+//
+//	dmark-plan completion bash > /etc/bash_completion.d/dmark-plan
+//	dmark-plan man /usr/local/share/man/man1
+//
+// Completion scripts call the command back, so values are completed by the
+// command itself: domains of its store for domain flags and paths for file
+// and directory flags and report arguments.
+//
+// Flags of more than one letter take one dash or two, -log-level like
+// --log-level, for command lines of the flag package to keep working.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// summaries describe commands in their help and man pages, by name.
+var summaries = map[string]string{
+	"dmark-abuse":      "List unknown sources failing DMARC and write abuse reports about them",
+	"dmark-bench":      "Measure parsing throughput",
+	"dmark-bimi":       "Check BIMI prerequisites of policy domains",
+	"dmark-bundle":     "Package raw reports with their summary into a signed archive",
+	"dmark-change":     "Record DNS and infrastructure changes and compare pass rates around them",
+	"dmark-diff":       "Compare two reports, directories or periods of reports",
+	"dmark-explain":    "Check DNS behind records failing DKIM or SPF",
+	"dmark-export":     "Export records of a store as CSV or NDJSON",
+	"dmark-import":     "Import a directory tree of archived reports into a store",
+	"dmark-mtasts":     "Correlate TLS reports with the published MTA-STS policy",
+	"dmark-plan":       "Plan rollouts of stricter DMARC policies",
+	"dmark-prune":      "Roll up and remove old reports of a store",
+	"dmark-rua":        "Check where DMARC records of domains send reports",
+	"dmark-search":     "Find records in a store",
+	"dmark-smtpd":      "Receive reports over SMTP",
+	"dmark-spf":        "Expand the SPF record of a policy domain against sources of its reports",
+	"dmark-subdomains": "List subdomains seen in reports",
+	"dmark-token":      "Manage API tokens of dmarkd",
+	"dmark-top":        "Print sources with the most messages failing DMARC",
+	"dmark-tui":        "Browse reports in the terminal",
+	"dmarkd":           "Accept reports over HTTP and serve the dashboard and API",
+	"mailbox2reports":  "Fetch report emails and save the attached reports",
+	"report2json":      "Convert a report to JSON, YAML and other formats",
+	"reports2email":    "Send a digest of reports by email",
+	"reports2html":     "Render reports as HTML, PDF or XLSX",
+	"reports2influx":   "Write reports as InfluxDB line protocol",
+	"reports2siem":     "Emit events of records failing DMARC to a SIEM",
+}
+
+// New returns the root command of the running command, named after it.
+// Args is the usage of its positional arguments, e.g. "[report.xml...]",
+// completed as paths, and long is its description in help and man pages,
+// the summary of the command when empty. Flags of the command line flag
+// set are persistent flags of the command, so its subcommands take them too.
+func New(args, long string) *cobra.Command {
+	name := filepath.Base(os.Args[0])
+	cmd := &cobra.Command{
+		Use:   strings.TrimSpace(name + " " + args),
+		Short: summaries[name],
+		Long:  long,
+		// Commands check their arguments themselves, like with flag.Parse.
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeFiles,
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+	}
+	if args == "" {
+		cmd.ValidArgsFunction = cobra.NoFileCompletions
+	}
+	cmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	cmd.AddCommand(manCommand())
+
+	return cmd
+}
+
+// Parse parses the command line like flag.Parse, with the command New
+// returns for a command without positional arguments.
+func Parse() {
+	ParseCommand(New("", ""))
+}
+
+// ParseCommand parses the command line with the root command, leaving its
+// positional arguments to flag.Args like flag.Parse does. When the command
+// line asks for help, completions or man pages instead, they are written
+// and the command exits, with status 2 on errors like flag.Parse.
+func ParseCommand(cmd *cobra.Command) {
+	parsed := false
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		parsed = true
+		// Flags are set already, "--" leaves all the arguments positional.
+		flag.CommandLine.Parse(append([]string{"--"}, args...))
+	}
+	flag.Usage = func() {
+		cmd.SetOut(os.Stderr)
+		cmd.Help()
+	}
+
+	if err := Execute(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\nRun '%s --help' for usage.\n", err, cmd.CommandPath())
+		os.Exit(2)
+	}
+	if !parsed {
+		os.Exit(0)
+	}
+}
+
+// Execute runs the root command with the arguments of the command line,
+// registering completions of flags of it and its subcommands, see kindOf.
+func Execute(cmd *cobra.Command) error {
+	registerCompletions(cmd)
+	cmd.SetArgs(longFlags(cmd, os.Args[1:]))
+
+	return cmd.Execute()
+}
+
+// longFlags returns the arguments with a second dash added to flags of more
+// than one letter of the command and its subcommands, which pflag would take
+// for a group of one-letter flags otherwise. Arguments after "--" are kept.
+func longFlags(cmd *cobra.Command, args []string) []string {
+	names := map[string]bool{}
+	var collect func(c *cobra.Command)
+	collect = func(c *cobra.Command) {
+		for _, flags := range []*pflag.FlagSet{c.Flags(), c.PersistentFlags()} {
+			flags.VisitAll(func(f *pflag.Flag) {
+				if len(f.Name) > 1 {
+					names[f.Name] = true
+				}
+			})
+		}
+		for _, sub := range c.Commands() {
+			collect(sub)
+		}
+	}
+	collect(cmd)
+
+	result := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			copy(result[i:], args[i:])
+			break
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		if strings.HasPrefix(name, "-") && !strings.HasPrefix(name, "--") && names[name[1:]] {
+			arg = "-" + arg
+		}
+		result[i] = arg
+	}
+
+	return result
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func TestLongFlags(t *testing.T) {
+	root := &cobra.Command{Use: "dmark-token"}
+	root.PersistentFlags().StringP("d", "d", "./", "Path to the store directory")
+	root.PersistentFlags().String("log-level", "info", "Log level")
+	create := &cobra.Command{Use: "create"}
+	create.Flags().String("name", "", "Name of the token")
+	root.AddCommand(create)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"-d", "./reports", "-log-level=debug", "create", "-name", "ci"},
+			[]string{"-d", "./reports", "--log-level=debug", "create", "--name", "ci"},
+		},
+		{
+			[]string{"--log-level", "debug", "create", "--name=ci"},
+			[]string{"--log-level", "debug", "create", "--name=ci"},
+		},
+		{
+			// Unknown flags are left to cobra to report, arguments after "--" are kept.
+			[]string{"-unknown", "create", "--", "-name"},
+			[]string{"-unknown", "create", "--", "-name"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := longFlags(root, tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("longFlags(%q): want %q, got %q", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage string
+		want  int
+	}{
+		{"o", "Path to store directory", kindDir},
+		{"i", "Path to directory or file with archived reports", kindFile},
+		{"quirks", "JSON file of reporter quirk profiles", kindFile},
+		{"domain", "Policy domain, with its subdomains", kindDomain},
+		{"tenant", "Tenant ID, for dmarkd with -tenants", kindTenant},
+		{"where", "Keep only records matching an expression", kindNone},
+	}
+
+	for _, tt := range tests {
+		f := &pflag.Flag{Name: tt.name, Usage: tt.usage}
+		if got := kindOf(f); got != tt.want {
+			t.Errorf("kindOf(-%s): want %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCompleteDomains(t *testing.T) {
+	root := &cobra.Command{Use: "dmark-export", Run: func(*cobra.Command, []string) {}}
+	root.Flags().StringP("r", "r", "./", "Path to directory with DMARC XML reports")
+	root.Flags().String("domain", "", "Policy domain, with its subdomains")
+	registerCompletions(root)
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{cobra.ShellCompRequestCmd, "-r", "../../testdata/reports", "--domain", "ex"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "example.com\n:4\n" // Domains of the reports, then ShellCompDirectiveNoFileComp
+	if got := out.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/store"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Kinds of flag values, by what completes them.
+const (
+	kindNone   = iota // Nothing, or no value for boolean flags
+	kindFile          // File and directory paths
+	kindDir           // Directory paths
+	kindDomain        // Policy domains of the store of the command
+	kindTenant        // Tenants of the store of the command
+)
+
+// storeFlags name flags holding the store of a command, in order of preference.
+var storeFlags = []string{"d", "r", "o"}
+
+// completion is a completion function of cobra.
+type completion func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// completions complete values of flags, by kind.
+var completions = map[int]completion{
+	kindNone:   cobra.NoFileCompletions,
+	kindFile:   completeFiles,
+	kindDir:    completeDirs,
+	kindDomain: completeDomains,
+	kindTenant: completeTenants,
+}
+
+// registerCompletions registers completions of flags of the command and its
+// subcommands by their kinds. Boolean flags take no values to complete.
+func registerCompletions(cmd *cobra.Command) {
+	for _, flags := range []*pflag.FlagSet{cmd.LocalNonPersistentFlags(), cmd.PersistentFlags()} {
+		flags.VisitAll(func(f *pflag.Flag) {
+			if f.NoOptDefVal != "" {
+				return
+			}
+			// Registered twice only with a flag of the same name on both sets.
+			_ = cmd.RegisterFlagCompletionFunc(f.Name, completions[kindOf(f)])
+		})
+	}
+	for _, sub := range cmd.Commands() {
+		registerCompletions(sub)
+	}
+}
+
+// kindOf tells what values of the flag are, by its usage text: flags of
+// paths start with "Path to", or mention a file or a directory before the
+// first comma; flags of domains mention a policy domain.
+func kindOf(f *pflag.Flag) int {
+	if f.Name == "tenant" {
+		return kindTenant
+	}
+
+	usage := strings.ToLower(f.Usage)
+	clause, _, _ := strings.Cut(usage, ",")
+	switch {
+	case strings.Contains(usage, "policy domain"):
+		return kindDomain
+	case strings.Contains(clause, "directory") && !strings.Contains(clause, "file"):
+		return kindDir
+	case strings.HasPrefix(usage, "path to") || strings.Contains(clause, "file") || strings.Contains(clause, "paths"):
+		return kindFile
+	}
+
+	return kindNone
+}
+
+func completeFiles(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveDefault
+}
+
+func completeDirs(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
+
+func completeDomains(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return withPrefix(storeDomains(cmd), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeTenants(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return withPrefix(storeTenants(cmd), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// storeMarkers are files of store directories, see store.Open: the layout
+// version and the BoltDB file of reports.
+var storeMarkers = []string{"schema.json", "reports.db"}
+
+// storeDir returns the directory of the first store flag of the command,
+// as typed on the command line being completed, empty when there is none.
+func storeDir(cmd *cobra.Command) string {
+	for _, name := range storeFlags {
+		if f := cmd.Flag(name); f != nil && kindOf(f) == kindDir {
+			return f.Value.String()
+		}
+	}
+
+	return ""
+}
+
+// openStore opens the store the command would use. Directories without
+// store files are not opened, for store.Open not to write them there.
+func openStore(cmd *cobra.Command) (*store.Store, error) {
+	dir := storeDir(cmd)
+	for _, marker := range storeMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			return store.Open(dir)
+		}
+	}
+
+	return nil, fmt.Errorf("no store in %q", dir)
+}
+
+// storeDomains returns policy domains of the store, of its -tenant when set,
+// or of reports in the directory when it is not a store. Errors leave the
+// list empty, completing nothing.
+func storeDomains(cmd *cobra.Command) []string {
+	s, err := openStore(cmd)
+	if err != nil {
+		reports, err := dmark.ParseDir(storeDir(cmd))
+		if err != nil {
+			return nil
+		}
+		domains := []string{}
+		for _, report := range reports {
+			domains = append(domains, strings.ToLower(report.PolicyPublished.Domain))
+		}
+		return unique(domains)
+	}
+	defer s.Close()
+
+	if f := cmd.Flag("tenant"); f != nil && f.Value.String() != "" {
+		tenant := f.Value.String()
+		if tenants, err := s.Tenants(); err != nil || !contains(tenants, tenant) {
+			return nil
+		}
+		t, err := s.Tenant(tenant)
+		if err != nil {
+			return nil
+		}
+		defer t.Close()
+		s = t
+	}
+
+	days, err := s.Daily(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	domains := make([]string, 0, len(days))
+	for _, day := range days {
+		domains = append(domains, day.Domain)
+	}
+
+	return unique(domains)
+}
+
+// unique sorts words, removing duplicates.
+func unique(words []string) []string {
+	sort.Strings(words)
+	result := []string{}
+	for i, word := range words {
+		if word != "" && (i == 0 || word != words[i-1]) {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// storeTenants returns IDs of tenants of the store.
+func storeTenants(cmd *cobra.Command) []string {
+	s, err := openStore(cmd)
+	if err != nil {
+		return nil
+	}
+	defer s.Close()
+
+	tenants, _ := s.Tenants()
+	return tenants
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+func withPrefix(words []string, prefix string) []string {
+	result := []string{}
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			result = append(result, word)
+		}
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// manCommand returns the man subcommand, writing man pages of the root
+// command and each of its subcommands, like dmark-token.1 and
+// dmark-token-create.1, to a directory.
+func manCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "man [dir]",
+		Short:             "Write man pages of the command and its subcommands to a directory",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+			header := &doc.GenManHeader{Section: "1", Source: "dmark-go", Manual: "dmark-go commands"}
+			return doc.GenManTree(root, header, dir)
+		},
+	}
+}
@@ -0,0 +1,112 @@
+// Package dryrun lets commands show what they would write with -dry-run,
+// instead of writing it.
+package dryrun
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// maxDiffLines limits the changed lines logged for a file at the debug level.
+const maxDiffLines = 20
+
+// Create creates the file at path like os.Create. With dry set, nothing is
+// written: the returned writer logs on Close how its content would change
+// the file, see Log.
+func Create(path string, dry bool) (io.WriteCloser, error) {
+	if !dry {
+		return os.Create(path)
+	}
+
+	return &file{path: path}, nil
+}
+
+// MkdirAll is os.MkdirAll, doing nothing with dry set.
+func MkdirAll(path string, dry bool) error {
+	if dry {
+		return nil
+	}
+
+	return os.MkdirAll(path, 0755)
+}
+
+type file struct {
+	bytes.Buffer
+	path string
+}
+
+func (f *file) Close() error {
+	Log(f.path, f.Bytes())
+	return nil
+}
+
+// Log logs how writing content to the file at path would change it:
+// created, unchanged, or changed with counts of added and removed lines,
+// which are logged themselves at the debug level.
+func Log(path string, content []byte) {
+	existing, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		slog.Info("Would create", "path", path, "bytes", len(content))
+		return
+	case err != nil:
+		slog.Warn("Would overwrite unreadable file", "path", path, "bytes", len(content), "err", err)
+		return
+	case bytes.Equal(existing, content):
+		slog.Info("Would leave unchanged", "path", path)
+		return
+	}
+
+	added, removed := diffLines(existing, content)
+	slog.Info(
+		"Would change",
+		"path", path,
+		"bytes", len(content),
+		"bytes_before", len(existing),
+		"lines_added", len(added),
+		"lines_removed", len(removed),
+	)
+	for i, line := range removed {
+		if i == maxDiffLines {
+			break
+		}
+		slog.Debug("-", "path", path, "line", line)
+	}
+	for i, line := range added {
+		if i == maxDiffLines {
+			break
+		}
+		slog.Debug("+", "path", path, "line", line)
+	}
+}
+
+// diffLines returns lines of after missing in before, and lines of before
+// missing in after, regardless of their order: a full diff takes too long
+// for generated files of megabytes.
+func diffLines(before, after []byte) (added, removed []string) {
+	counts := map[string]int{}
+	for _, line := range bytes.Split(before, []byte("\n")) {
+		counts[string(line)]++
+	}
+
+	added = []string{}
+	for _, line := range bytes.Split(after, []byte("\n")) {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			continue
+		}
+		added = append(added, string(line))
+	}
+
+	removed = []string{}
+	for _, line := range bytes.Split(before, []byte("\n")) {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			removed = append(removed, string(line))
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,226 @@
+// Package jsonschema describes Go types in JSON Schema (draft 2020-12), as
+// encoding/json encodes them, for the schemas the module publishes: that of
+// reports, see dmark.JSONSchema, and those of the dmarkd API.
+package jsonschema
+
+import (
+	"encoding"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// maxEnum is the largest enum number tried when listing enum values.
+const maxEnum = 32
+
+var (
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	ipType        = reflect.TypeOf(net.IP{})
+	timeType      = reflect.TypeOf(time.Time{})
+	foType        = reflect.TypeOf(dmark.Fo(0))
+)
+
+// Schema is a JSON Schema object.
+type Schema map[string]interface{}
+
+// Generator describes types, collecting schemas of structs in Defs.
+type Generator struct {
+	Docs      map[string]string // Descriptions, see ParseDocs
+	Defs      map[string]Schema // Schemas of structs, by type name
+	RefPrefix string            // Where Defs are, "#/$defs/" when empty
+}
+
+// Schema returns the schema of the type, a reference to Defs for structs.
+func (g *Generator) Schema(t reflect.Type) Schema {
+	switch {
+	case t == ipType:
+		return Schema{"type": "string", "description": "An IPv4 or IPv6 address"}
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == foType:
+		return Schema{"type": "string", "pattern": "^([01ds](:[01ds])*)?$", "description": "Colon-separated failure reporting options"}
+	case t.Implements(textMarshaler):
+		return Schema{"type": "string", "enum": enumValues(t)}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.Schema(t.Elem())
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice:
+		return Schema{"type": []string{"array", "null"}, "items": g.Schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": []string{"object", "null"}, "additionalProperties": g.Schema(t.Elem())}
+	case reflect.Struct:
+		if g.Defs == nil {
+			g.Defs = map[string]Schema{}
+		}
+		if _, ok := g.Defs[t.Name()]; !ok {
+			g.Defs[t.Name()] = nil // a placeholder for recursive types
+			g.Defs[t.Name()] = g.Object(t)
+		}
+		return Schema{"$ref": g.ref() + t.Name()}
+	}
+
+	panic(fmt.Sprintf("unsupported type %s", t))
+}
+
+func (g *Generator) ref() string {
+	if g.RefPrefix == "" {
+		return "#/$defs/"
+	}
+	return g.RefPrefix
+}
+
+// Object describes a struct by its JSON fields, with those of embedded
+// structs; fields without omitempty are required.
+func (g *Generator) Object(t reflect.Type) Schema {
+	properties := Schema{}
+	required := []string{}
+	g.fields(t, properties, &required)
+
+	object := Schema{"type": "object", "properties": properties, "required": required}
+	if doc := g.Docs[docKey(t, "")]; doc != "" {
+		object["description"] = doc
+	}
+
+	return object
+}
+
+func (g *Generator) fields(t reflect.Type, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			g.fields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.Schema(field.Type)
+		if strings.Contains(options, "omitempty") {
+			// nil slices and maps are left out instead of being null
+			if types, ok := property["type"].([]string); ok {
+				property["type"] = types[0]
+			}
+		} else {
+			*required = append(*required, name)
+		}
+		if doc := g.Docs[docKey(t, field.Name)]; doc != "" {
+			if _, ok := property["$ref"]; ok {
+				property = Schema{"allOf": []Schema{property}}
+			}
+			property["description"] = doc
+		}
+		properties[name] = property
+	}
+}
+
+// docKey is the key of descriptions of a type, or of its field, in Generator.Docs.
+func docKey(t reflect.Type, field string) string {
+	if field == "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.PkgPath() + "." + t.Name() + "." + field
+}
+
+// enumValues lists texts of the enum type, by trying its numbers.
+func enumValues(t reflect.Type) []string {
+	values := []string{}
+	seen := map[string]bool{}
+	add := func(v reflect.Value) {
+		text, _ := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if !seen[string(text)] {
+			seen[string(text)] = true
+			values = append(values, string(text))
+		}
+	}
+
+	v := reflect.New(t).Elem()
+	if t.Kind() == reflect.Bool {
+		for _, b := range []bool{true, false} {
+			v.SetBool(b)
+			add(v)
+		}
+		return values
+	}
+	for n := int64(0); n <= maxEnum; n++ {
+		v.SetInt(n)
+		add(v)
+	}
+
+	return values
+}
+
+// ParseDocs adds comments of types and struct fields of the package in dir,
+// imported as pkgPath, to docs.
+func ParseDocs(docs map[string]string, dir, pkgPath string) error {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", dir, err)
+	}
+
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					doc := typeSpec.Doc
+					if doc == nil && len(gen.Specs) == 1 {
+						doc = gen.Doc
+					}
+					name := pkgPath + "." + typeSpec.Name.Name
+					docs[name] = commentText(doc)
+
+					structType, ok := typeSpec.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range structType.Fields.List {
+						text := commentText(field.Comment)
+						if text == "" {
+							text = commentText(field.Doc)
+						}
+						for _, fieldName := range field.Names {
+							docs[name+"."+fieldName.Name] = text
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func commentText(group *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
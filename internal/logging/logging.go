@@ -0,0 +1,168 @@
+// Package logging configures structured logging (log/slog) for dmark commands.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Options are set by -log-level, -log-format and -quirks flags.
+type Options struct {
+	Level  string
+	Format string
+	Quirks string // JSON file of reporter quirk profiles
+}
+
+// Flags registers -log-level, -log-format and -quirks on the command line flag set.
+func Flags() *Options {
+	o := &Options{}
+	flag.StringVar(&o.Level, "log-level", "info", "Log level: debug, info, warn or error")
+	flag.StringVar(&o.Format, "log-format", "text", "Log format: text or json")
+	flag.StringVar(&o.Quirks, "quirks", "", "JSON file of reporter quirk profiles fixing their reports, in addition to the built-in ones")
+	return o
+}
+
+// Setup makes a logger writing to stderr the default one.
+// Output of the standard log package goes through it as well.
+// Quirk profiles from -quirks replace dmark.DefaultQuirks.
+func (o *Options) Setup() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+		return fmt.Errorf("unsupported log level %q", o.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: errorText}
+	switch strings.ToLower(o.Format) {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("unsupported log format %q", o.Format)
+	}
+
+	if o.Quirks != "" {
+		profiles, err := dmark.LoadQuirks(o.Quirks)
+		if err != nil {
+			return err
+		}
+		dmark.DefaultQuirks = profiles
+	}
+
+	return nil
+}
+
+// errorText logs errors by their messages, whatever other formatting
+// their types implement.
+func errorText(groups []string, a slog.Attr) slog.Attr {
+	if err, ok := a.Value.Any().(error); ok {
+		return slog.String(a.Key, err.Error())
+	}
+
+	return a
+}
+
+// Fatal logs the error and exits with status 1.
+func Fatal(err error) {
+	slog.Error("Failed", "err", err.Error())
+	os.Exit(1)
+}
+
+// ParseDir parses all *.xml reports in a directory, ordered by file name,
+// like dmark.ParseDir, logging per-file diagnostics: a debug entry for each
+// parsed file and a warning for each record that could not be fully decoded.
+// Such records are kept with the values decoded so far, and unknown values of
+// policy_published are kept as Unknown with a warning too. Date range problems
+// found by dmark.NormalizeRanges and records inconsistent with their policies
+// found by dmark.CheckReports are logged as warnings too.
+func ParseDir(dir string) ([]dmark.Feedback, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	result := []dmark.Feedback{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".xml") {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name())
+		parser := &dmark.Parser{
+			OnRecordError: func(err *dmark.RecordError) error {
+				slog.Warn(
+					"Record decoded partially",
+					"file", path,
+					"record", err.Index,
+					"line", err.Line,
+					"err", err.Err,
+				)
+				return nil
+			},
+			OnPolicyError: func(err *dmark.DecodeError) error {
+				slog.Warn(
+					"Unknown policy value",
+					"file", path,
+					"line", err.Line,
+					"err", err.Err,
+				)
+				return nil
+			},
+		}
+
+		start := time.Now()
+		feedback, err := parser.ParseFile(path)
+		if err != nil {
+			slog.Error("Failed to parse report", "file", path, "err", err)
+			return result, err
+		}
+		slog.Debug(
+			"Parsed report",
+			"file", path,
+			"domain", feedback.PolicyPublished.Domain,
+			"org", feedback.ReportMetadata.OrgName,
+			"records", len(feedback.Records),
+			"duration", time.Since(start),
+		)
+
+		result = append(result, *feedback)
+	}
+
+	_, warnings := dmark.NormalizeRanges(result)
+	for _, w := range warnings {
+		slog.Warn(
+			"Unusual report date range",
+			"problem", w.Problem,
+			"org", w.OrgName,
+			"report_id", w.ReportID,
+			"domain", w.Domain,
+			"begin", w.Range.Begin,
+			"end", w.Range.End,
+			"other", w.Other,
+			"clamped", w.Clamped,
+		)
+	}
+	for _, i := range dmark.CheckReports(result) {
+		slog.Warn(
+			"Inconsistent record",
+			"problem", i.Problem,
+			"org", i.OrgName,
+			"report_id", i.ReportID,
+			"domain", i.Domain,
+			"record", i.Record,
+			"source_ip", i.SourceIP,
+			"disposition", i.Disposition,
+			"policy", i.Policy,
+		)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Exit statuses of commands ingesting reports, besides 0 and 1 for errors.
+const (
+	ExitPartial = 2 // Some files failed, others were ingested
+	ExitNothing = 3 // No report was ingested
+)
+
+// Summary counts files a command ingested reports from.
+type Summary struct {
+	Parsed  int `json:"parsed"`  // Reports parsed and saved
+	Skipped int `json:"skipped"` // Reports saved earlier, and files without reports
+	Failed  int `json:"failed"`  // Invalid reports
+
+	Error string `json:"error,omitempty"` // Error the command stopped with
+}
+
+// SummaryFlag registers -summary-json on the command line flag set.
+func SummaryFlag() *bool {
+	return flag.Bool("summary-json", false, "Print counts of parsed, skipped and failed files to stdout as JSON when done")
+}
+
+// ExitCode returns ExitNothing when no report was parsed, ExitPartial
+// when some failed, and 0 otherwise.
+func (s Summary) ExitCode() int {
+	switch {
+	case s.Parsed == 0:
+		return ExitNothing
+	case s.Failed > 0:
+		return ExitPartial
+	}
+	return 0
+}
+
+// Exit prints the summary to stdout as JSON when printJSON is set,
+// and exits with the status of ExitCode, or 1 when err is not nil.
+// The summary then counts reports ingested before the error.
+func (s Summary) Exit(printJSON bool, err error) {
+	os.Exit(s.exit(os.Stdout, printJSON, err))
+}
+
+func (s Summary) exit(w io.Writer, printJSON bool, err error) int {
+	code := s.ExitCode()
+	if err != nil {
+		slog.Error("Failed", "err", err.Error())
+		s.Error = err.Error()
+		code = 1
+	}
+
+	if printJSON {
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			slog.Error("Failed to print summary", "err", err.Error())
+			return 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSummaryExit(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary Summary
+		err     error
+		want    string
+		code    int
+	}{
+		{"ingested", Summary{Parsed: 2, Skipped: 1}, nil, `{"parsed":2,"skipped":1,"failed":0}`, 0},
+		{"partial", Summary{Parsed: 2, Failed: 1}, nil, `{"parsed":2,"skipped":0,"failed":1}`, ExitPartial},
+		{"nothing", Summary{Skipped: 3}, nil, `{"parsed":0,"skipped":3,"failed":0}`, ExitNothing},
+		{
+			"error",
+			Summary{Parsed: 4},
+			errors.New("connection reset"),
+			`{"parsed":4,"skipped":0,"failed":0,"error":"connection reset"}`,
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			code := tt.summary.exit(&b, true, tt.err)
+			if code != tt.code {
+				t.Errorf("want exit code %d, got %d", tt.code, code)
+			}
+			if got := bytes.TrimSpace(b.Bytes()); string(got) != tt.want {
+				t.Errorf("want summary %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package pdf writes minimal text-only PDF documents, like the summaries of
+// reports2html -format=pdf and the digests reports2email attaches.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page in points, with content laid out from the top left corner.
+const (
+	PageWidth  = 595
+	PageHeight = 842
+	Margin     = 40
+)
+
+// Document is a minimal PDF writer for text-only pages,
+// using the standard Helvetica fonts which need no embedding.
+type Document struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = PageHeight - Margin
+}
+
+// Line moves to the next line of the given height, starting a new page when needed.
+func (d *Document) Line(height float64) {
+	if len(d.pages) == 0 || d.y-height < Margin {
+		d.newPage()
+	}
+	d.y -= height
+}
+
+// Text writes s at x on the current line, truncated to width points.
+func (d *Document) Text(x, size float64, bold bool, width float64, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+
+	// Helvetica glyphs are about half as wide as the font size on average
+	if maxChars := int(width / (size * 0.5)); width > 0 && maxChars > 1 {
+		if runes := []rune(s); len(runes) > maxChars {
+			s = string(runes[:maxChars-1]) + "…"
+		}
+	}
+
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, d.y, escape(s))
+}
+
+// escape escapes a string literal, replacing characters outside of Latin-1.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '…':
+			b.WriteString(`\205`) // ellipsis in WinAnsiEncoding
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		case r > 127:
+			fmt.Fprintf(&b, `\%03o`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// WriteTo writes the document, with an empty page when nothing was written.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+
+	buf := &bytes.Buffer{}
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// objects 1-4 are fixed, then each page takes two: the page and its content
+	kids := []string{}
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, 6+2*i,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.WriteTo(w)
+}
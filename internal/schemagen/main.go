@@ -0,0 +1,55 @@
+// Command schemagen writes the JSON Schema of the JSON encoding of dmark.Feedback,
+// which the dmark package embeds, see dmark.JSONSchema. Descriptions come from
+// comments of the types and their fields. Run go generate in the module root
+// after changing them.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"reflect"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/internal/jsonschema"
+	"github.com/chuhlomin/dmark-go/internal/logging"
+)
+
+// schemaID is where the schema is published.
+const schemaID = "https://raw.githubusercontent.com/chuhlomin/dmark-go/main/feedback.schema.json"
+
+func run(out, dir string) error {
+	feedback := reflect.TypeOf(dmark.Feedback{})
+	g := &jsonschema.Generator{Docs: map[string]string{}, Defs: map[string]jsonschema.Schema{}}
+	if err := jsonschema.ParseDocs(g.Docs, dir, feedback.PkgPath()); err != nil {
+		return err
+	}
+
+	root := g.Object(feedback)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = schemaID
+	root["title"] = "DMARC aggregate report"
+	root["description"] = "A DMARC aggregate report (RFC 7489 Appendix C) as dmark.Feedback encodes it in JSON"
+	root["$defs"] = g.Defs
+
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+
+	return os.WriteFile(out, buf.Bytes(), 0644)
+}
+
+func main() {
+	out := flag.String("o", "feedback.schema.json", "Output file")
+	dir := flag.String("dir", ".", "Directory of the dmark package, for descriptions")
+	flag.Parse()
+
+	if err := run(*out, *dir); err != nil {
+		logging.Fatal(err)
+	}
+}
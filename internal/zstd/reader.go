@@ -0,0 +1,394 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxWindowSize limits the memory a frame may ask for.
+const maxWindowSize = 64 << 20
+
+// ErrUnsupported is returned for compressed blocks using Huffman-coded literals
+// or custom FSE tables, which only the writers of other tools produce.
+var ErrUnsupported = errors.New("zstd: block encoding not supported, decompress with zstd -d first")
+
+// Reader decompresses frames read from an underlying reader.
+type Reader struct {
+	r   io.Reader
+	out []byte // The window followed by bytes not read yet
+	pos int    // Bytes of out read
+	err error
+
+	// current frame
+	inFrame  bool
+	window   int
+	checksum bool
+	hash     *xxhash
+	reps     [3]uint32
+}
+
+// NewReader returns a Reader decompressing frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for z.pos == len(z.out) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+
+	n := copy(p, z.out[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+// next decodes the next block, starting a frame when needed.
+func (z *Reader) next() error {
+	if !z.inFrame {
+		return z.readFrameHeader()
+	}
+
+	if len(z.out) > 2*z.window {
+		shift := len(z.out) - z.window
+		z.out = z.out[:copy(z.out, z.out[shift:])]
+		z.pos -= shift
+	}
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(z.r, header); err != nil {
+		return unexpected(err, "read block header")
+	}
+	h := uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16
+	last, blockType, size := h&1 == 1, h>>1&3, int(h>>3)
+	if size > maxBlockSize || size > z.window {
+		return fmt.Errorf("zstd: block of %d bytes is too large", size)
+	}
+
+	start := len(z.out)
+	switch blockType {
+	case blockRaw:
+		content := make([]byte, size)
+		if _, err := io.ReadFull(z.r, content); err != nil {
+			return unexpected(err, "read block")
+		}
+		z.out = append(z.out, content...)
+	case blockRLE:
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(z.r, b); err != nil {
+			return unexpected(err, "read block")
+		}
+		for i := 0; i < size; i++ {
+			z.out = append(z.out, b[0])
+		}
+	case blockCompressed:
+		content := make([]byte, size)
+		if _, err := io.ReadFull(z.r, content); err != nil {
+			return unexpected(err, "read block")
+		}
+		if err := z.decompress(content); err != nil {
+			return err
+		}
+	default:
+		return errors.New("zstd: reserved block type")
+	}
+	z.hash.Write(z.out[start:])
+
+	if !last {
+		return nil
+	}
+
+	z.inFrame = false
+	if !z.checksum {
+		return nil
+	}
+	checksum := make([]byte, 4)
+	if _, err := io.ReadFull(z.r, checksum); err != nil {
+		return unexpected(err, "read checksum")
+	}
+	if binary.LittleEndian.Uint32(checksum) != uint32(z.hash.Sum64()) {
+		return errors.New("zstd: checksum mismatch")
+	}
+
+	return nil
+}
+
+// readFrameHeader starts the next frame, skipping skippable ones.
+// It returns io.EOF at the end of the input.
+func (z *Reader) readFrameHeader() error {
+	b := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(z.r, b); err != nil {
+			if err == io.EOF {
+				return io.EOF
+			}
+			return unexpected(err, "read frame magic")
+		}
+		m := binary.LittleEndian.Uint32(b)
+		if m == magic {
+			break
+		}
+		if m&skippableMask != skippableBase {
+			return errors.New("zstd: not a zstd frame")
+		}
+		if _, err := io.ReadFull(z.r, b); err != nil {
+			return unexpected(err, "read skippable frame")
+		}
+		if _, err := io.CopyN(io.Discard, z.r, int64(binary.LittleEndian.Uint32(b))); err != nil {
+			return unexpected(err, "read skippable frame")
+		}
+	}
+
+	if _, err := io.ReadFull(z.r, b[:1]); err != nil {
+		return unexpected(err, "read frame header")
+	}
+	descriptor := b[0]
+	if descriptor&0x08 != 0 {
+		return errors.New("zstd: reserved frame header bit set")
+	}
+	single := descriptor&0x20 != 0
+	dictSize := []int{0, 1, 2, 4}[descriptor&3]
+	sizeSize := []int{0, 2, 4, 8}[descriptor>>6]
+	if sizeSize == 0 && single {
+		sizeSize = 1
+	}
+
+	rest := 0
+	if !single {
+		rest = 1
+	}
+	header := make([]byte, rest+dictSize+sizeSize)
+	if _, err := io.ReadFull(z.r, header); err != nil {
+		return unexpected(err, "read frame header")
+	}
+
+	if !single {
+		exponent, mantissa := header[0]>>3, header[0]&7
+		base := uint64(1) << (10 + exponent)
+		window := base + base/8*uint64(mantissa)
+		if window > maxWindowSize {
+			return fmt.Errorf("zstd: window of %d bytes is too large", window)
+		}
+		z.window = int(window)
+	}
+	for _, b := range header[rest : rest+dictSize] {
+		if b != 0 {
+			return errors.New("zstd: dictionaries are not supported")
+		}
+	}
+	if single {
+		size := uint64(0)
+		for i, b := range header[rest+dictSize:] {
+			size |= uint64(b) << (8 * i)
+		}
+		if sizeSize == 2 {
+			size += 256
+		}
+		if size > maxWindowSize {
+			return fmt.Errorf("zstd: window of %d bytes is too large", size)
+		}
+		z.window = int(size)
+	}
+
+	z.inFrame = true
+	z.checksum = descriptor&0x04 != 0
+	z.hash = newXXHash()
+	z.reps = [3]uint32{1, 4, 8}
+	// matches never reach into previous frames
+	z.out = z.out[:copy(z.out, z.out[z.pos:])]
+	z.pos = 0
+
+	return nil
+}
+
+// decompress appends the content of a compressed block to out.
+func (z *Reader) decompress(block []byte) error {
+	if len(block) == 0 {
+		return errors.New("zstd: empty compressed block")
+	}
+
+	// literals section
+	literalsType := block[0] & 3
+	if literalsType > blockRLE {
+		return ErrUnsupported
+	}
+	var size, headerSize int
+	switch block[0] >> 2 & 3 {
+	case 0, 2:
+		size, headerSize = int(block[0]>>3), 1
+	case 1:
+		if len(block) < 2 {
+			return errors.New("zstd: truncated literals header")
+		}
+		size, headerSize = int(block[0]>>4)|int(block[1])<<4, 2
+	case 3:
+		if len(block) < 3 {
+			return errors.New("zstd: truncated literals header")
+		}
+		size, headerSize = int(block[0]>>4)|int(block[1])<<4|int(block[2])<<12, 3
+	}
+	if size > maxBlockSize {
+		return errors.New("zstd: literals too large")
+	}
+	block = block[headerSize:]
+
+	var literals []byte
+	if literalsType == blockRaw {
+		if len(block) < size {
+			return errors.New("zstd: truncated literals")
+		}
+		literals, block = block[:size], block[size:]
+	} else {
+		if len(block) < 1 {
+			return errors.New("zstd: truncated literals")
+		}
+		literals = make([]byte, size)
+		for i := range literals {
+			literals[i] = block[0]
+		}
+		block = block[1:]
+	}
+
+	// sequences section
+	if len(block) < 1 {
+		return errors.New("zstd: truncated sequences header")
+	}
+	count := int(block[0])
+	switch {
+	case count == 0:
+		z.out = append(z.out, literals...)
+		return nil
+	case count < 128:
+		block = block[1:]
+	case count < 255:
+		if len(block) < 2 {
+			return errors.New("zstd: truncated sequences header")
+		}
+		count, block = (count-128)<<8|int(block[1]), block[2:]
+	default:
+		if len(block) < 3 {
+			return errors.New("zstd: truncated sequences header")
+		}
+		count, block = int(block[1])|int(block[2])<<8+0x7F00, block[3:]
+	}
+	if len(block) < 1 {
+		return errors.New("zstd: truncated sequences header")
+	}
+	if block[0] != 0 {
+		return ErrUnsupported
+	}
+
+	r, err := newBitReader(block[1:])
+	if err != nil {
+		return fmt.Errorf("zstd: sequences: %w", err)
+	}
+
+	readState := func(t *fseTable) (uint32, error) {
+		v, err := r.read(uint(t.log))
+		return uint32(v), err
+	}
+	stateLL, err := readState(llTable)
+	if err != nil {
+		return fmt.Errorf("zstd: sequences: %w", err)
+	}
+	stateOF, err := readState(ofTable)
+	if err != nil {
+		return fmt.Errorf("zstd: sequences: %w", err)
+	}
+	stateML, err := readState(mlTable)
+	if err != nil {
+		return fmt.Errorf("zstd: sequences: %w", err)
+	}
+
+	for i := 0; i < count; i++ {
+		llCode, ofCode, mlCode := llTable.symbols[stateLL], ofTable.symbols[stateOF], mlTable.symbols[stateML]
+		if int(llCode) >= len(llBase) || int(mlCode) >= len(mlBase) || ofCode > 31 {
+			return errors.New("zstd: invalid sequence code")
+		}
+
+		ofExtra, err := r.read(uint(ofCode))
+		if err != nil {
+			return fmt.Errorf("zstd: sequences: %w", err)
+		}
+		mlExtra, err := r.read(uint(mlBits[mlCode]))
+		if err != nil {
+			return fmt.Errorf("zstd: sequences: %w", err)
+		}
+		llExtra, err := r.read(uint(llBits[llCode]))
+		if err != nil {
+			return fmt.Errorf("zstd: sequences: %w", err)
+		}
+		litLen := int(llBase[llCode]) + int(llExtra)
+		matchLen := int(mlBase[mlCode]) + int(mlExtra)
+		offset := z.offset(uint32(1)<<ofCode+uint32(ofExtra), litLen)
+
+		if litLen > len(literals) {
+			return errors.New("zstd: literals overflow")
+		}
+		z.out = append(z.out, literals[:litLen]...)
+		literals = literals[litLen:]
+
+		if offset == 0 || int(offset) > len(z.out) || int(offset) > z.window {
+			return fmt.Errorf("zstd: invalid offset %d", offset)
+		}
+		from := len(z.out) - int(offset)
+		for j := 0; j < matchLen; j++ {
+			z.out = append(z.out, z.out[from+j])
+		}
+
+		if i == count-1 {
+			break
+		}
+		for _, s := range []struct {
+			t     *fseTable
+			state *uint32
+		}{{llTable, &stateLL}, {mlTable, &stateML}, {ofTable, &stateOF}} {
+			bits, err := r.read(uint(s.t.nbBits[*s.state]))
+			if err != nil {
+				return fmt.Errorf("zstd: sequences: %w", err)
+			}
+			*s.state = uint32(s.t.newState[*s.state]) + uint32(bits)
+		}
+	}
+
+	z.out = append(z.out, literals...)
+	return nil
+}
+
+// offset resolves an offset value, which is either an offset plus 3
+// or one of the repeat offsets, and updates them.
+func (z *Reader) offset(value uint32, litLen int) uint32 {
+	if value > 3 {
+		offset := value - 3
+		z.reps = [3]uint32{offset, z.reps[0], z.reps[1]}
+		return offset
+	}
+
+	index := value - 1
+	if litLen == 0 {
+		index++
+	}
+	switch index {
+	case 0:
+		return z.reps[0]
+	case 1:
+		z.reps = [3]uint32{z.reps[1], z.reps[0], z.reps[2]}
+	case 2:
+		z.reps = [3]uint32{z.reps[2], z.reps[0], z.reps[1]}
+	default:
+		z.reps = [3]uint32{z.reps[0] - 1, z.reps[0], z.reps[1]}
+	}
+
+	return z.reps[0]
+}
+
+func unexpected(err error, message string) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("zstd: %s: %w", message, err)
+}
@@ -0,0 +1,242 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	windowSize = 1 << windowLog
+	minMatch   = 4
+	hashLog    = 16
+)
+
+// Writer compresses data written to it into a single frame
+// with a content checksum, written out on Close.
+type Writer struct {
+	w      io.Writer
+	hist   []byte  // The window followed by data of the next block
+	start  int     // Where the next block begins in hist
+	base   int     // Position of hist[0] in the content
+	table  []int32 // Content position + 1 of the last 4 bytes with the hash, 0 for none
+	hash   *xxhash
+	header bool
+	err    error
+}
+
+// NewWriter returns a Writer compressing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:     w,
+		table: make([]int32, 1<<hashLog),
+		hash:  newXXHash(),
+	}
+}
+
+// Write compresses p, writing out full blocks.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+
+	z.hash.Write(p)
+	z.hist = append(z.hist, p...)
+	for len(z.hist)-z.start > maxBlockSize {
+		if z.err = z.writeBlock(z.start+maxBlockSize, false); z.err != nil {
+			return 0, z.err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close writes the last block and the checksum. It does not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.err = z.writeBlock(len(z.hist), true); z.err != nil {
+		return z.err
+	}
+
+	checksum := binary.LittleEndian.AppendUint32(nil, uint32(z.hash.Sum64()))
+	if _, err := z.w.Write(checksum); err != nil {
+		z.err = fmt.Errorf("write checksum: %w", err)
+		return z.err
+	}
+
+	z.err = errors.New("zstd: writer is closed")
+	return nil
+}
+
+// writeBlock writes hist from start to end as a block, compressed when that saves space.
+func (z *Writer) writeBlock(end int, last bool) error {
+	out := []byte{}
+	if !z.header {
+		out = binary.LittleEndian.AppendUint32(out, magic)
+		out = append(out, 0x04, (windowLog-10)<<3) // content checksum, no content size; window
+		z.header = true
+	}
+
+	src := z.hist[z.start:end]
+	compressed := z.compress(end)
+	blockType, content := blockRaw, src
+	if compressed != nil && len(compressed) < len(src) {
+		blockType, content = blockCompressed, compressed
+	}
+
+	header := uint32(len(content))<<3 | uint32(blockType)<<1
+	if last {
+		header |= 1
+	}
+	out = append(out, byte(header), byte(header>>8), byte(header>>16))
+	out = append(out, content...)
+	if _, err := z.w.Write(out); err != nil {
+		return fmt.Errorf("write block: %w", err)
+	}
+
+	z.start = end
+	if z.start > 2*windowSize {
+		// keep the window only
+		shift := z.start - windowSize
+		z.hist = z.hist[:copy(z.hist, z.hist[shift:])]
+		z.base += shift
+		z.start -= shift
+	}
+
+	return nil
+}
+
+type sequence struct {
+	litLen   uint32
+	matchLen uint32
+	offset   uint32
+}
+
+// compress returns hist from start to end as the content of a compressed block:
+// raw literals and sequences of matches found in the window, nil without matches.
+func (z *Writer) compress(end int) []byte {
+	literals := []byte{}
+	sequences := []sequence{}
+
+	lit := z.start
+	for i := z.start; i+minMatch <= end; {
+		h := binary.LittleEndian.Uint32(z.hist[i:]) * 2654435761 >> (32 - hashLog)
+		candidate := int(z.table[h]) - 1 - z.base
+		z.table[h] = int32(z.base + i + 1)
+
+		// positions wrap around after 2 GiB of content
+		if candidate < 0 || candidate >= i || i-candidate > windowSize ||
+			binary.LittleEndian.Uint32(z.hist[candidate:]) != binary.LittleEndian.Uint32(z.hist[i:]) {
+			i++
+			continue
+		}
+
+		length := minMatch
+		for i+length < end && z.hist[candidate+length] == z.hist[i+length] {
+			length++
+		}
+
+		literals = append(literals, z.hist[lit:i]...)
+		sequences = append(sequences, sequence{
+			litLen:   uint32(i - lit),
+			matchLen: uint32(length),
+			offset:   uint32(i - candidate),
+		})
+
+		// index positions within the match for later ones
+		for j := i + 1; j < i+length && j+minMatch <= end; j++ {
+			h := binary.LittleEndian.Uint32(z.hist[j:]) * 2654435761 >> (32 - hashLog)
+			z.table[h] = int32(z.base + j + 1)
+		}
+
+		i += length
+		lit = i
+	}
+	if len(sequences) == 0 {
+		return nil
+	}
+	literals = append(literals, z.hist[lit:end]...)
+
+	out := []byte{}
+	switch n := len(literals); {
+	case n < 32:
+		out = append(out, byte(n<<3))
+	case n < 4096:
+		out = append(out, byte(0x04|n<<4), byte(n>>4))
+	default:
+		out = append(out, byte(0x0C|n<<4), byte(n>>4), byte(n>>12))
+	}
+	out = append(out, literals...)
+
+	switch n := len(sequences); {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7F00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		out = append(out, 0xFF, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	out = append(out, 0) // predefined tables for all codes
+
+	return append(out, encodeSequences(sequences)...)
+}
+
+// encodeSequences writes the sequences bitstream, last sequence first,
+// so decoders read them in order.
+func encodeSequences(sequences []sequence) []byte {
+	type codes struct {
+		ll, ml, of                uint8
+		llExtra, mlExtra, ofExtra uint64
+	}
+	coded := make([]codes, len(sequences))
+	for i, s := range sequences {
+		c := codes{
+			ll: code(llBase[:], s.litLen),
+			ml: code(mlBase[:], s.matchLen),
+		}
+		c.llExtra = uint64(s.litLen - llBase[c.ll])
+		c.mlExtra = uint64(s.matchLen - mlBase[c.ml])
+		// offsets are never repeat codes, which take values 1 to 3
+		value := s.offset + 3
+		c.of = uint8(highBit(value))
+		c.ofExtra = uint64(value - 1<<c.of)
+		coded[i] = c
+	}
+
+	w := &bitWriter{}
+	last := coded[len(coded)-1]
+	stateML := mlTable.initState(last.ml)
+	stateOF := ofTable.initState(last.of)
+	stateLL := llTable.initState(last.ll)
+	w.add(last.llExtra, uint(llBits[last.ll]))
+	w.add(last.mlExtra, uint(mlBits[last.ml]))
+	w.add(last.ofExtra, uint(last.of))
+
+	for i := len(coded) - 2; i >= 0; i-- {
+		c := coded[i]
+		stateOF = ofTable.encode(w, stateOF, c.of)
+		stateML = mlTable.encode(w, stateML, c.ml)
+		stateLL = llTable.encode(w, stateLL, c.ll)
+		w.add(c.llExtra, uint(llBits[c.ll]))
+		w.add(c.mlExtra, uint(mlBits[c.ml]))
+		w.add(c.ofExtra, uint(c.of))
+	}
+
+	w.add(uint64(stateML), uint(mlTable.log))
+	w.add(uint64(stateOF), uint(ofTable.log))
+	w.add(uint64(stateLL), uint(llTable.log))
+
+	return w.close()
+}
+
+// code returns the last code with the baseline not above v.
+func code(base []uint32, v uint32) uint8 {
+	c := len(base) - 1
+	for base[c] > v {
+		c--
+	}
+	return uint8(c)
+}
@@ -0,0 +1,95 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XXH64 primes.
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// xxhash computes XXH64 with seed 0 incrementally, for frame content checksums.
+type xxhash struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int // Bytes in buf
+}
+
+func newXXHash() *xxhash {
+	p1, p2 := prime1, prime2 // wrapping around, unlike constants
+	return &xxhash{v: [4]uint64{p1 + p2, p2, 0, -p1}}
+}
+
+func (h *xxhash) Write(p []byte) {
+	h.total += uint64(len(p))
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], p)
+		h.n += c
+		p = p[c:]
+		if h.n < 32 {
+			return
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buf[:], p)
+}
+
+func (h *xxhash) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = round(h.v[i], binary.LittleEndian.Uint64(p[i*8:]))
+	}
+}
+
+func (h *xxhash) Sum64() uint64 {
+	var sum uint64
+	if h.total >= 32 {
+		sum = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			sum ^= round(0, v)
+			sum = sum*prime1 + prime4
+		}
+	} else {
+		sum = prime5
+	}
+	sum += h.total
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		sum ^= round(0, binary.LittleEndian.Uint64(p))
+		sum = bits.RotateLeft64(sum, 27)*prime1 + prime4
+	}
+	if len(p) >= 4 {
+		sum ^= uint64(binary.LittleEndian.Uint32(p)) * prime1
+		sum = bits.RotateLeft64(sum, 23)*prime2 + prime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		sum ^= uint64(b) * prime5
+		sum = bits.RotateLeft64(sum, 11) * prime1
+	}
+
+	sum ^= sum >> 33
+	sum *= prime2
+	sum ^= sum >> 29
+	sum *= prime3
+	sum ^= sum >> 32
+
+	return sum
+}
+
+func round(acc, lane uint64) uint64 {
+	acc += lane * prime2
+	return bits.RotateLeft64(acc, 31) * prime1
+}
@@ -0,0 +1,259 @@
+// Package zstd reads and writes Zstandard frames (RFC 8878) without dependencies.
+//
+// The writer compresses with a greedy LZ77 match finder, raw literals and the
+// predefined FSE tables for sequences: ratios are well below the zstd tool's,
+// but far better than none for XML reports, and any zstd decoder reads the output.
+// The reader decodes frames of raw, RLE and such compressed blocks only;
+// decompress frames written by other tools with `zstd -d` first.
+package zstd
+
+import (
+	"errors"
+	"math/bits"
+)
+
+const (
+	magic         = 0xFD2FB528
+	skippableMask = 0xFFFFFFF0
+	skippableBase = 0x184D2A50
+
+	windowLog    = 20 // 1 MiB
+	maxBlockSize = 128 << 10
+
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+)
+
+// Sequence codes: baselines and extra bits of literal and match lengths.
+var (
+	llBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	mlBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// Predefined distributions of literal length, match length and offset codes.
+var (
+	llTable = newFSETable([]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}, 6)
+	mlTable = newFSETable([]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}, 6)
+	ofTable = newFSETable([]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}, 5)
+)
+
+// fseTable holds both directions of a finite state entropy table.
+type fseTable struct {
+	log int
+
+	// encoding
+	states []uint16 // Next states, tableSize + table index
+	deltas []fseDelta
+
+	// decoding, by state
+	symbols  []uint8
+	nbBits   []uint8
+	newState []uint16
+}
+
+type fseDelta struct {
+	nbBits    uint32
+	findState int32
+}
+
+// newFSETable builds the tables of a normalized distribution, where -1 stands
+// for symbols less probable than 1/tableSize, following the reference implementation.
+func newFSETable(norm []int16, log int) *fseTable {
+	size := 1 << log
+	mask := size - 1
+	t := &fseTable{
+		log:      log,
+		states:   make([]uint16, size),
+		deltas:   make([]fseDelta, len(norm)),
+		symbols:  make([]uint8, size),
+		nbBits:   make([]uint8, size),
+		newState: make([]uint16, size),
+	}
+
+	// low probability symbols go to the end of the table
+	high := size - 1
+	cumul := make([]int, len(norm)+1)
+	for s, n := range norm {
+		if n == -1 {
+			cumul[s+1] = cumul[s] + 1
+			t.symbols[high] = uint8(s)
+			high--
+		} else {
+			cumul[s+1] = cumul[s] + int(n)
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	position := 0
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			t.symbols[position] = uint8(s)
+			position = (position + step) & mask
+			for position > high {
+				position = (position + step) & mask
+			}
+		}
+	}
+
+	next := make([]int, len(norm))
+	copy(next, cumul)
+	for u := 0; u < size; u++ {
+		s := t.symbols[u]
+		t.states[next[s]] = uint16(size + u)
+		next[s]++
+	}
+
+	total := int32(0)
+	for s, n := range norm {
+		switch n {
+		case 0:
+			t.deltas[s].nbBits = uint32(log+1)<<16 - uint32(size)
+		case -1, 1:
+			t.deltas[s] = fseDelta{uint32(log)<<16 - uint32(size), total - 1}
+			total++
+		default:
+			maxBitsOut := uint32(log - highBit(uint32(n-1)))
+			minStatePlus := uint32(n) << maxBitsOut
+			t.deltas[s] = fseDelta{maxBitsOut<<16 - minStatePlus, total - int32(n)}
+			total += int32(n)
+		}
+	}
+
+	symbolNext := make([]int, len(norm))
+	for s, n := range norm {
+		symbolNext[s] = int(n)
+		if n == -1 {
+			symbolNext[s] = 1
+		}
+	}
+	for u := 0; u < size; u++ {
+		s := t.symbols[u]
+		nextState := symbolNext[s]
+		symbolNext[s]++
+		t.nbBits[u] = uint8(log - highBit(uint32(nextState)))
+		t.newState[u] = uint16(nextState<<t.nbBits[u] - size)
+	}
+
+	return t
+}
+
+// initState returns the encoder state to start with for the last symbol.
+func (t *fseTable) initState(symbol uint8) uint32 {
+	d := t.deltas[symbol]
+	nbBitsOut := (d.nbBits + 1<<15) >> 16
+	value := nbBitsOut<<16 - d.nbBits
+	return uint32(t.states[int32(value>>nbBitsOut)+d.findState])
+}
+
+// encode writes the bits of state leading to symbol and returns the next state.
+func (t *fseTable) encode(w *bitWriter, state uint32, symbol uint8) uint32 {
+	d := t.deltas[symbol]
+	nbBitsOut := (state + d.nbBits) >> 16
+	w.add(uint64(state), uint(nbBitsOut))
+	return uint32(t.states[int32(state>>nbBitsOut)+d.findState])
+}
+
+func highBit(v uint32) int {
+	return bits.Len32(v) - 1
+}
+
+// bitWriter appends bits to a little-endian stream read backwards by decoders.
+type bitWriter struct {
+	out []byte
+	acc uint64
+	n   uint
+}
+
+func (w *bitWriter) add(v uint64, n uint) {
+	if n == 0 {
+		return
+	}
+	w.acc |= (v & (1<<n - 1)) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+// close marks the end of the stream, so readers find where it starts.
+func (w *bitWriter) close() []byte {
+	w.add(1, 1)
+	if w.n > 0 {
+		w.out = append(w.out, byte(w.acc))
+	}
+	return w.out
+}
+
+// bitReader reads a stream written by bitWriter, from the last bit written.
+type bitReader struct {
+	data []byte
+	pos  int // Bits left to read
+}
+
+func newBitReader(data []byte) (*bitReader, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errors.New("invalid bitstream end")
+	}
+
+	last := data[len(data)-1]
+	return &bitReader{data: data, pos: (len(data)-1)*8 + highBit(uint32(last))}, nil
+}
+
+func (r *bitReader) read(n uint) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if int(n) > r.pos {
+		return 0, errors.New("bitstream overflow")
+	}
+
+	r.pos -= int(n)
+	v := uint64(0)
+	for i := uint(0); i < n; {
+		bit := uint(r.pos) + i
+		offset := bit % 8
+		take := 8 - offset
+		if take > n-i {
+			take = n - i
+		}
+		v |= uint64(r.data[bit/8]>>offset&(1<<take-1)) << i
+		i += take
+	}
+
+	return v, nil
+}
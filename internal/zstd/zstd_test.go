@@ -0,0 +1,196 @@
+package zstd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// seq returns the output of seq 1 n, the content of the testdata frames.
+func seq(n int) []byte {
+	var b bytes.Buffer
+	for i := 1; i <= n; i++ {
+		fmt.Fprintln(&b, i)
+	}
+	return b.Bytes()
+}
+
+func decompress(t *testing.T, frame []byte) ([]byte, error) {
+	t.Helper()
+	return io.ReadAll(NewReader(bytes.NewReader(frame)))
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// TestReaderReference decodes frames written by the reference zstd CLI (v1.5.6).
+func TestReaderReference(t *testing.T) {
+	seqFrame, err := os.ReadFile("testdata/seq.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  []byte
+	}{
+		// printf '' | zstd --no-check
+		{"empty", mustHex("28b52ffd2000010000"), nil},
+		// printf 'hello, world' | zstd
+		{"raw block", mustHex("28b52ffd045861000068656c6c6f2c20776f726c6442121b6d"), []byte("hello, world")},
+		// printf 'a%.0s' $(seq 1 5000) | zstd
+		{"repeat offset", mustHex("28b52ffd6488124d0000106161010083d3032cd63c80d4"), bytes.Repeat([]byte("a"), 5000)},
+		// printf 'abc%.0s' $(seq 1 12) | zstd --no-compress-literals
+		{"raw literals", mustHex("28b52ffd04584d00001861626301008e6e08101c69be"), bytes.Repeat([]byte("abc"), 12)},
+		// seq 1 200 | zstd --no-compress-literals
+		{"predefined sequences", seqFrame, seq(200)},
+		// a skippable frame followed by two frames
+		{
+			"concatenated",
+			mustHex("502a4d180300000001020328b52ffd2000010000" + "28b52ffd045861000068656c6c6f2c20776f726c6442121b6d"),
+			[]byte("hello, world"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decompress(t, tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReaderUnsupported(t *testing.T) {
+	// seq 1 200 | zstd -19, with Huffman-coded literals
+	frame, err := os.ReadFile("testdata/seq-huffman.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decompress(t, frame); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("want ErrUnsupported, got %v", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	frame := mustHex("28b52ffd045861000068656c6c6f2c20776f726c6442121b6d")
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  string
+	}{
+		{"checksum mismatch", append(bytes.Clone(frame[:len(frame)-1]), 0), "checksum mismatch"},
+		{"truncated", frame[:len(frame)-6], "unexpected EOF"},
+		{"not zstd", []byte("<?xml version"), "not a zstd frame"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decompress(t, tt.frame)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("want error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	random := make([]byte, 300<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := map[string][]byte{
+		"empty":       nil,
+		"short":       []byte("hello"),
+		"repetitive":  bytes.Repeat([]byte("<record><row><source_ip>192.0.2.1</source_ip></row></record>\n"), 10000),
+		"many blocks": seq(100000),
+		"random":      random,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := NewWriter(&b)
+			// Write in uneven pieces to cross block boundaries mid-write.
+			for rest := content; len(rest) > 0; {
+				n := min(len(rest), 70000)
+				if _, err := w.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := decompress(t, b.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("round trip changed %d bytes into %d bytes", len(content), len(got))
+			}
+
+			// Frames must be readable by the reference implementation too.
+			path, err := exec.LookPath("zstd")
+			if err != nil {
+				return
+			}
+			cmd := exec.Command(path, "-d", "-c")
+			cmd.Stdin = &b
+			got, err = cmd.Output()
+			if err != nil {
+				t.Fatalf("zstd -d: %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("zstd -d decoded %d bytes into %d bytes", len(content), len(got))
+			}
+		})
+	}
+}
+
+func TestXXHash(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+
+	for _, tt := range tests {
+		h := newXXHash()
+		h.Write([]byte(tt.input))
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("XXH64(%q): want %#x, got %#x", tt.input, tt.want, got)
+		}
+
+		// Writing byte by byte must not change the sum.
+		h = newXXHash()
+		for i := 0; i < len(tt.input); i++ {
+			h.Write([]byte{tt.input[i]})
+		}
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("XXH64(%q) written byte by byte: want %#x, got %#x", tt.input, tt.want, got)
+		}
+	}
+}
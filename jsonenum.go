@@ -0,0 +1,488 @@
+package dmark
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// JSONOptions changes how values with reports encode in JSON.
+type JSONOptions struct {
+	// NumericEnums encodes enum types as numbers, and Result as a boolean,
+	// as some versions did, for consumers expecting them. Decoding accepts
+	// both forms regardless.
+	//
+	// Numbers are those of versions before absent and Unknown values were added,
+	// counting from 0 in the order of the constants: for Disposition "none" is 0,
+	// "quarantine" 1 and "reject" 2. Absent values encode as null and Unknown
+	// ones as -1, which those versions did not have. Fo is a set of bits and
+	// encodes as the sum of its Fo* values.
+	NumericEnums bool
+}
+
+// Marshal is like json.Marshal, encoding the values of this package in v,
+// including those in structs, slices, maps and pointers, with the options.
+func (o JSONOptions) Marshal(v interface{}) ([]byte, error) {
+	if o.NumericEnums {
+		var err error
+		if v, err = (&numericCopier{}).copy(reflect.ValueOf(v)); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// legacyEnumOffset is the number of values before the first defined one,
+// absent and Unknown, by which enum numbers differ from legacy JSON numbers.
+const legacyEnumOffset = 2
+
+// legacyEnum is an enum number encoding as the legacy JSON number.
+type legacyEnum int
+
+func (n legacyEnum) MarshalJSON() ([]byte, error) {
+	switch {
+	case n == 0:
+		return []byte("null"), nil
+	case n < legacyEnumOffset:
+		return []byte("-1"), nil
+	}
+	return strconv.AppendInt(nil, int64(n-legacyEnumOffset), 10), nil
+}
+
+// numericTypes maps enum types to the types they encode as with NumericEnums.
+var numericTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(Alignment(0)):      reflect.TypeOf(legacyEnum(0)),
+	reflect.TypeOf(Disposition(0)):    reflect.TypeOf(legacyEnum(0)),
+	reflect.TypeOf(PolicyOverride(0)): reflect.TypeOf(legacyEnum(0)),
+	reflect.TypeOf(DKIMResult(0)):     reflect.TypeOf(legacyEnum(0)),
+	reflect.TypeOf(SPFDomainScope(0)): reflect.TypeOf(legacyEnum(0)),
+	reflect.TypeOf(SPFResult(0)):      reflect.TypeOf(legacyEnum(0)),
+	reflect.TypeOf(Fo(0)):             reflect.TypeOf(0),
+	reflect.TypeOf(Result(false)):     reflect.TypeOf(false),
+}
+
+var (
+	numericMirrors sync.Map // reflect.Type -> reflect.Type, numericType results
+	heldEnums      sync.Map // reflect.Type -> bool, holdsEnums results
+	heldInterfaces sync.Map // reflect.Type -> bool, holdsInterface results
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	anyType           = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// encodesItself reports whether t has its own JSON encoding, like netip.Addr and time.Time.
+func encodesItself(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// holdsType reports whether values of t may hold values of a type leaf is
+// true for, outside of types encoding themselves. Types in walking are being
+// checked further up, so self-referential types are walked once.
+func holdsType(t reflect.Type, leaf func(reflect.Type) bool, walking map[reflect.Type]bool) bool {
+	if leaf(t) {
+		return true
+	}
+	if walking[t] || encodesItself(t) {
+		return false
+	}
+	walking[t] = true
+	defer delete(walking, t)
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return holdsType(t.Elem(), leaf, walking)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() && holdsType(f.Type, leaf, walking) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// holdsEnums reports whether values of t may hold enums of numericTypes.
+func holdsEnums(t reflect.Type) bool {
+	if held, ok := heldEnums.Load(t); ok {
+		return held.(bool)
+	}
+
+	held := holdsType(t, func(t reflect.Type) bool {
+		_, ok := numericTypes[t]
+		return ok
+	}, map[reflect.Type]bool{})
+	heldEnums.Store(t, held)
+	return held
+}
+
+// holdsInterface reports whether values of t may hold interfaces, whose
+// dynamic values may be enums even though numericType(t) is t.
+func holdsInterface(t reflect.Type) bool {
+	if held, ok := heldInterfaces.Load(t); ok {
+		return held.(bool)
+	}
+
+	held := holdsType(t, func(t reflect.Type) bool {
+		return t.Kind() == reflect.Interface
+	}, map[reflect.Type]bool{})
+	heldInterfaces.Store(t, held)
+	return held
+}
+
+// numericType returns the type values of t are copied to for NumericEnums,
+// t itself when it holds no enums. Struct types are mirrored with
+// reflect.StructOf, keeping field names, tags and embedding, so copies
+// encode like the values except for the enums.
+func numericType(t reflect.Type) reflect.Type {
+	return mirrorType(t, map[reflect.Type]bool{})
+}
+
+// mirrorType is numericType, with the types being mirrored in walking.
+// A type cannot refer to its mirror while it is built, so self-referential
+// types refer to themselves as interface{} values holding their copies.
+func mirrorType(t reflect.Type, walking map[reflect.Type]bool) reflect.Type {
+	if m, ok := numericTypes[t]; ok {
+		return m
+	}
+	if !holdsEnums(t) {
+		return t
+	}
+	if m, ok := numericMirrors.Load(t); ok {
+		return m.(reflect.Type)
+	}
+	if walking[t] {
+		return anyType
+	}
+	walking[t] = true
+	defer delete(walking, t)
+
+	m := t
+	switch t.Kind() {
+	case reflect.Pointer:
+		if elem := mirrorType(t.Elem(), walking); elem != t.Elem() {
+			m = reflect.PointerTo(elem)
+		}
+	case reflect.Slice:
+		if elem := mirrorType(t.Elem(), walking); elem != t.Elem() {
+			m = reflect.SliceOf(elem)
+		}
+	case reflect.Array:
+		if elem := mirrorType(t.Elem(), walking); elem != t.Elem() {
+			m = reflect.ArrayOf(t.Len(), elem)
+		}
+	case reflect.Map:
+		if elem := mirrorType(t.Elem(), walking); elem != t.Elem() {
+			m = reflect.MapOf(t.Key(), elem)
+		}
+	case reflect.Struct:
+		m = mirrorStruct(t, walking)
+	}
+
+	numericMirrors.Store(t, m)
+	return m
+}
+
+// mirrorStruct returns a struct type with the exported fields of t, which
+// encoding/json encodes, with their numeric types; t when none has enums.
+func mirrorStruct(t reflect.Type, walking map[reflect.Type]bool) reflect.Type {
+	fields := []reflect.StructField{}
+	changed := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			if f.Anonymous {
+				// promoted fields of unexported types cannot be mirrored
+				return t
+			}
+			continue
+		}
+
+		m := mirrorType(f.Type, walking)
+		if f.Anonymous && (m.Kind() == reflect.Interface ||
+			m == f.Type && m.NumMethod()+reflect.PointerTo(m).NumMethod() > 0) {
+			// reflect.StructOf does not embed types with methods,
+			// and encoding/json does not promote fields of interfaces
+			return t
+		}
+		changed = changed || m != f.Type
+		fields = append(fields, reflect.StructField{Name: f.Name, Type: m, Tag: f.Tag, Anonymous: f.Anonymous})
+	}
+	if !changed {
+		return t
+	}
+
+	return reflect.StructOf(fields)
+}
+
+// numericCopier copies values to their numericType.
+type numericCopier struct {
+	copying map[copiedPointer]bool // Pointers and maps being copied
+}
+
+type copiedPointer struct {
+	p unsafe.Pointer
+	t reflect.Type // Pointers to structs and to their first fields are equal
+}
+
+// copy returns a copy of v with enums replaced by numericTypes.
+func (c *numericCopier) copy(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	copied, err := c.convert(v, numericType(v.Type()))
+	if err != nil {
+		return nil, err
+	}
+	return copied.Interface(), nil
+}
+
+// convert copies v to a value of m, its numericType. Like json.Marshal,
+// it fails for cyclic values.
+func (c *numericCopier) convert(v reflect.Value, m reflect.Type) (reflect.Value, error) {
+	t := v.Type()
+	if t == m && !holdsInterface(t) {
+		return v, nil
+	}
+	if _, ok := numericTypes[t]; ok {
+		return v.Convert(m), nil
+	}
+
+	out := reflect.New(m).Elem()
+	if m.Kind() == reflect.Interface {
+		// interfaces, and self-referential types, are copied by their dynamic type
+		copied, err := c.copy(v)
+		if err != nil || copied == nil {
+			return out, err
+		}
+		out.Set(reflect.ValueOf(copied))
+		return out, nil
+	}
+
+	if (t.Kind() == reflect.Pointer || t.Kind() == reflect.Map) && !v.IsNil() {
+		key := copiedPointer{v.UnsafePointer(), t}
+		if c.copying[key] {
+			return out, &json.UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", t)}
+		}
+		if c.copying == nil {
+			c.copying = map[copiedPointer]bool{}
+		}
+		c.copying[key] = true
+		defer delete(c.copying, key)
+	}
+
+	if t == m {
+		// keeps unexported fields, exported ones are copied below
+		out.Set(v)
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			elem, err := c.convert(v.Elem(), m.Elem())
+			if err != nil {
+				return out, err
+			}
+			out.Set(reflect.New(m.Elem()))
+			out.Elem().Set(elem)
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			out.Set(reflect.MakeSlice(m, v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				elem, err := c.convert(v.Index(i), m.Elem())
+				if err != nil {
+					return out, err
+				}
+				out.Index(i).Set(elem)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem, err := c.convert(v.Index(i), m.Elem())
+			if err != nil {
+				return out, err
+			}
+			out.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			out.Set(reflect.MakeMapWithSize(m, v.Len()))
+			for iter := v.MapRange(); iter.Next(); {
+				elem, err := c.convert(iter.Value(), m.Elem())
+				if err != nil {
+					return out, err
+				}
+				out.SetMapIndex(iter.Key(), elem)
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < m.NumField(); i++ {
+			f := m.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			field := v.FieldByName(f.Name)
+			if f.Type.Kind() == reflect.Interface && field.Kind() != reflect.Interface && omitted(field, f.Tag) {
+				// left nil, as the self-referential type would be omitted
+				continue
+			}
+			copied, err := c.convert(field, f.Type)
+			if err != nil {
+				return out, err
+			}
+			out.Field(i).Set(copied)
+		}
+	}
+
+	return out, nil
+}
+
+// omitted reports whether encoding/json omits the field v with tag as empty.
+func omitted(v reflect.Value, tag reflect.StructTag) bool {
+	_, options, _ := strings.Cut(tag.Get("json"), ",")
+	if !strings.Contains(","+options+",", ",omitempty,") {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// marshalEnumJSON encodes the text of v as a JSON string.
+func marshalEnumJSON(v encoding.TextMarshaler) ([]byte, error) {
+	text, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(string(text))
+}
+
+// unmarshalEnumJSON decodes a JSON string with v.UnmarshalText, or a legacy
+// number with set, given the enum number for it.
+func unmarshalEnumJSON(data []byte, v encoding.TextUnmarshaler, set func(n int)) error {
+	return unmarshalJSON(data, v, func(n int) {
+		if n < 0 {
+			set(legacyEnumOffset - 1)
+			return
+		}
+		set(n + legacyEnumOffset)
+	})
+}
+
+// unmarshalJSON decodes a JSON string with v.UnmarshalText, or a number with set.
+func unmarshalJSON(data []byte, v encoding.TextUnmarshaler, set func(n int)) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		text := ""
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return v.UnmarshalText([]byte(text))
+	}
+
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid enum value %s, want a string or a number", data)
+	}
+	set(n)
+
+	return nil
+}
+
+func (a Alignment) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(a)
+}
+
+func (a *Alignment) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, a, func(n int) { *a = Alignment(n) })
+}
+
+func (disp Disposition) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(disp)
+}
+
+func (disp *Disposition) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, disp, func(n int) { *disp = Disposition(n) })
+}
+
+func (fo Fo) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(fo)
+}
+
+func (fo *Fo) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(data, fo, func(n int) { *fo = Fo(n) })
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(r)
+}
+
+func (r *Result) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*r = true
+		return nil
+	case "false":
+		*r = false
+		return nil
+	}
+
+	return unmarshalJSON(data, r, func(n int) { *r = n != 0 })
+}
+
+func (po PolicyOverride) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(po)
+}
+
+func (po *PolicyOverride) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, po, func(n int) { *po = PolicyOverride(n) })
+}
+
+func (dkimr DKIMResult) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(dkimr)
+}
+
+func (dkimr *DKIMResult) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, dkimr, func(n int) { *dkimr = DKIMResult(n) })
+}
+
+func (sds SPFDomainScope) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(sds)
+}
+
+func (sds *SPFDomainScope) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, sds, func(n int) { *sds = SPFDomainScope(n) })
+}
+
+func (spfr SPFResult) MarshalJSON() ([]byte, error) {
+	return marshalEnumJSON(spfr)
+}
+
+func (spfr *SPFResult) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, spfr, func(n int) { *spfr = SPFResult(n) })
+}
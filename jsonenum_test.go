@@ -0,0 +1,149 @@
+package dmark
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNumericEnumsLegacyNumbers(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{Disposition(0), "null"},
+		{DispositionUnknown, "-1"},
+		{DispositionNone, "0"},
+		{DispositionQuarantine, "1"},
+		{DispositionReject, "2"},
+		{AlignmentRelaxed, "0"},
+		{AlignmentStrict, "1"},
+		{PolicyOverrideForwarded, "0"},
+		{PolicyOverrideOther, "5"},
+		{DKIMResultNone, "0"},
+		{DKIMResultPermError, "6"},
+		{SPFDomainScopeHelo, "0"},
+		{SPFDomainScopeMFrom, "1"},
+		{SPFResultNone, "0"},
+		{SPFResultSoftFail, "4"},
+		{Fo0 | FoD, "5"},
+		{Result(true), "true"},
+	}
+
+	for _, tt := range tests {
+		got, err := JSONOptions{NumericEnums: true}.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("%T(%v): %v", tt.value, tt.value, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%T(%v): want %s, got %s", tt.value, tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestUnmarshalLegacyNumbers(t *testing.T) {
+	var policy PolicyPublished
+	err := json.Unmarshal([]byte(`{"adkim":1,"p":2,"sp":0,"np":-1,"fo":3}`), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := PolicyPublished{ADKIM: AlignmentStrict, P: DispositionReject, SP: DispositionNone, NP: DispositionUnknown, Fo: Fo0 | Fo1}
+	if policy.ADKIM != want.ADKIM || policy.P != want.P || policy.SP != want.SP || policy.NP != want.NP || policy.Fo != want.Fo {
+		t.Errorf("want %+v, got %+v", want, policy)
+	}
+}
+
+// TestNumericEnumsNested checks enums within reports and types embedding them
+// encode as numbers, and the rest as without NumericEnums.
+func TestNumericEnumsNested(t *testing.T) {
+	type annotated struct {
+		*Feedback
+		Note    string            `json:"note"`
+		Results map[string]Result `json:"results,omitempty"`
+	}
+
+	for name, content := range corpus(t) {
+		t.Run(name, func(t *testing.T) {
+			feedback, err := ParseBytes(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := json.Marshal(annotated{Feedback: feedback, Note: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := JSONOptions{NumericEnums: true}.Marshal(annotated{Feedback: feedback, Note: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), `"disposition":`+strconv.Itoa(int(feedback.Records[0].Row.PolicyEvaluated.Disposition)-legacyEnumOffset)) {
+				t.Errorf("want numeric dispositions, got %s", data)
+			}
+
+			decoded := annotated{Feedback: &Feedback{}}
+			if err = json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("want numeric JSON to decode to\n%s\ngot\n%s", want, got)
+			}
+		})
+	}
+
+	data, err := JSONOptions{NumericEnums: true}.Marshal(map[string]interface{}{"dkim": []Result{true, false}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"dkim":[true,false]}` {
+		t.Errorf(`want {"dkim":[true,false]}, got %s`, data)
+	}
+}
+
+// TestNumericEnumsRecursive checks self-referential types encode like
+// without NumericEnums, except for the enums, and cyclic values fail.
+func TestNumericEnumsRecursive(t *testing.T) {
+	type node struct {
+		D    Disposition `json:"d"`
+		Next *node       `json:"next,omitempty"`
+	}
+	type tree struct {
+		R        Result `json:"r"`
+		Children []tree `json:"children"`
+	}
+	type forest []forest
+
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{&node{}, `{"d":null}`},
+		{&node{D: DispositionReject, Next: &node{D: DispositionNone}}, `{"d":2,"next":{"d":0}}`},
+		{tree{R: true, Children: []tree{{}, {Children: []tree{}}}}, `{"r":true,"children":[{"r":false,"children":null},{"r":false,"children":[]}]}`},
+		{forest{{}, {{}}}, `[[],[[]]]`},
+	}
+
+	for _, tt := range tests {
+		got, err := JSONOptions{NumericEnums: true}.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("%T: %v", tt.value, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%T: want %s, got %s", tt.value, tt.want, got)
+		}
+	}
+
+	cyclic := &node{}
+	cyclic.Next = cyclic
+	var unsupported *json.UnsupportedValueError
+	if _, err := (JSONOptions{NumericEnums: true}).Marshal(cyclic); !errors.As(err, &unsupported) {
+		t.Errorf("want *json.UnsupportedValueError for a cyclic value, got %v", err)
+	}
+}
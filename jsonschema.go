@@ -0,0 +1,232 @@
+package dmark
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:generate go run ./internal/schemagen -o feedback.schema.json
+
+//go:embed feedback.schema.json
+var jsonSchema []byte
+
+// maxSchemaProblems limits problems listed by JSONSchemaError.Error.
+const maxSchemaProblems = 10
+
+// JSONSchema returns the JSON Schema (draft 2020-12) of Feedback encoded in
+// JSON, for consumers to validate against and generate code from. It is
+// feedback.schema.json of the module, generated from the types. Enums are
+// described as strings; JSONOptions.NumericEnums output does not match it.
+func JSONSchema() []byte {
+	return bytes.Clone(jsonSchema)
+}
+
+// JSONSchemaError is returned by ValidateJSON for a document not matching JSONSchema.
+type JSONSchemaError struct {
+	Problems []string // Like "/record/0/row/count: want integer, got string"
+}
+
+func (e *JSONSchemaError) Error() string {
+	problems := e.Problems
+	more := ""
+	if len(problems) > maxSchemaProblems {
+		more = fmt.Sprintf("; and %d more", len(problems)-maxSchemaProblems)
+		problems = problems[:maxSchemaProblems]
+	}
+
+	return "does not match the JSON schema: " + strings.Join(problems, "; ") + more
+}
+
+// Is matches ErrSchemaViolation.
+func (e *JSONSchemaError) Is(target error) bool {
+	return target == ErrSchemaViolation
+}
+
+var (
+	parsedSchema     map[string]interface{}
+	parsedSchemaOnce sync.Once
+)
+
+// ValidateJSON checks a JSON document of a report against JSONSchema, returning
+// a *JSONSchemaError listing where it differs. Only keywords the schema uses
+// are checked: type, enum, pattern, format date-time, properties, required,
+// items, additionalProperties, allOf and $ref to its $defs.
+func ValidateJSON(data []byte) error {
+	parsedSchemaOnce.Do(func() {
+		if err := json.Unmarshal(jsonSchema, &parsedSchema); err != nil {
+			panic(fmt.Sprintf("embedded JSON schema: %v", err))
+		}
+	})
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var document interface{}
+	if err := dec.Decode(&document); err != nil {
+		return fmt.Errorf("decode JSON: %w", err)
+	}
+
+	v := &schemaValidator{root: parsedSchema}
+	v.validate(parsedSchema, document, "")
+	if len(v.problems) > 0 {
+		return &JSONSchemaError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+type schemaValidator struct {
+	root     map[string]interface{}
+	problems []string
+}
+
+func (v *schemaValidator) problem(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "/"
+	}
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		defs, _ := v.root["$defs"].(map[string]interface{})
+		def, ok := defs[name].(map[string]interface{})
+		if !ok {
+			v.problem(path, "unresolved $ref %q", ref)
+			return
+		}
+		v.validate(def, value, path)
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			if s, ok := s.(map[string]interface{}); ok {
+				v.validate(s, value, path)
+			}
+		}
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		v.problem(path, "want %s, got %s", typeNames(types), jsonType(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.problem(path, "unexpected value %v", value)
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(s) {
+				v.problem(path, "%q does not match %s", s, pattern)
+			}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				v.problem(path, "%q is not a date-time", s)
+			}
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				v.problem(path, "missing %s", name)
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				v.validate(property, value[name], path+"/"+name)
+			} else if additional != nil {
+				v.validate(additional, value[name], path+"/"+name)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				v.validate(items, item, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+	}
+}
+
+// matchesType reports whether the value is of the type, or one of the types, of a schema.
+func matchesType(types interface{}, value interface{}) bool {
+	switch types := types.(type) {
+	case string:
+		return typeMatches(types, value)
+	case []interface{}:
+		for _, t := range types {
+			if t, ok := t.(string); ok && typeMatches(t, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func typeMatches(t string, value interface{}) bool {
+	actual := jsonType(value)
+	return actual == t || (t == "number" && actual == "integer")
+}
+
+// jsonType returns the JSON Schema type of a value decoded with UseNumber.
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func typeNames(types interface{}) string {
+	if list, ok := types.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, t := range list {
+			names = append(names, fmt.Sprint(t))
+		}
+		return strings.Join(names, " or ")
+	}
+
+	return fmt.Sprint(types)
+}
@@ -0,0 +1,268 @@
+// Package msgpack encodes reports as MessagePack, a compact binary format
+// for key-value stores and constrained channels.
+//
+// Structs are maps keyed by the `msgpack` tag names, or the `json` tag names
+// when there is none, so the same field names as in JSON are used.
+// Enums and IP addresses are encoded as their text values.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/chuhlomin/dmark-go/internal/binenc"
+)
+
+// Marshal returns the MessagePack encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	w := &writer{}
+	if err := binenc.Encode(w, v, "msgpack"); err != nil {
+		return nil, err
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// Unmarshal decodes MessagePack data into v, which has to be a non-nil pointer.
+// Extension types are not supported.
+func Unmarshal(data []byte, v interface{}) error {
+	r := &reader{data: data}
+	if err := binenc.Decode(r, v, "msgpack"); err != nil {
+		return fmt.Errorf("msgpack: offset %d: %w", r.pos, err)
+	}
+	if r.pos != len(data) {
+		return fmt.Errorf("msgpack: %d trailing bytes", len(data)-r.pos)
+	}
+
+	return nil
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+// sized writes a header with the smallest of 8, 16 or 32 bit sizes.
+func (w *writer) sized(code8, code16, code32 byte, n int) {
+	switch {
+	case code8 != 0 && n <= math.MaxUint8:
+		w.buf.Write([]byte{code8, byte(n)})
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(code16)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		w.buf.WriteByte(code32)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func (w *writer) Nil() {
+	w.buf.WriteByte(0xc0)
+}
+
+func (w *writer) Bool(b bool) {
+	if b {
+		w.buf.WriteByte(0xc3)
+	} else {
+		w.buf.WriteByte(0xc2)
+	}
+}
+
+func (w *writer) Int(i int64) {
+	switch {
+	case i >= 0:
+		w.Uint(uint64(i))
+	case i >= -32:
+		w.buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		w.buf.Write([]byte{0xd0, byte(i)})
+	case i >= math.MinInt16:
+		w.buf.WriteByte(0xd1)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		w.buf.WriteByte(0xd2)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		w.buf.WriteByte(0xd3)
+		w.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+func (w *writer) Uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		w.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		w.buf.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		w.buf.WriteByte(0xcd)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(u)))
+	case u <= math.MaxUint32:
+		w.buf.WriteByte(0xce)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(u)))
+	default:
+		w.buf.WriteByte(0xcf)
+		w.buf.Write(binary.BigEndian.AppendUint64(nil, u))
+	}
+}
+
+// Float writes float 32 when it keeps the value, float 64 otherwise.
+func (w *writer) Float(f float64) {
+	if float64(float32(f)) == f || math.IsNaN(f) {
+		w.buf.WriteByte(0xca)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(f))))
+		return
+	}
+
+	w.buf.WriteByte(0xcb)
+	w.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (w *writer) String(s string) {
+	if len(s) <= 31 {
+		w.buf.WriteByte(0xa0 | byte(len(s)))
+	} else {
+		w.sized(0xd9, 0xda, 0xdb, len(s))
+	}
+	w.buf.WriteString(s)
+}
+
+func (w *writer) Bytes(b []byte) {
+	w.sized(0xc4, 0xc5, 0xc6, len(b))
+	w.buf.Write(b)
+}
+
+func (w *writer) Array(n int) {
+	if n <= 15 {
+		w.buf.WriteByte(0x90 | byte(n))
+		return
+	}
+	w.sized(0, 0xdc, 0xdd, n)
+}
+
+func (w *writer) Map(n int) {
+	if n <= 15 {
+		w.buf.WriteByte(0x80 | byte(n))
+		return
+	}
+	w.sized(0, 0xde, 0xdf, n)
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) read(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, errors.New("unexpected end of data")
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of the given size in bytes.
+func (r *reader) uint(size int) (uint64, error) {
+	b, err := r.read(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (r *reader) Next() (binenc.Item, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return binenc.Item{}, err
+	}
+	code := b[0]
+
+	switch {
+	case code <= 0x7f:
+		return binenc.Item{Kind: binenc.KindUint, Uint: uint64(code)}, nil
+	case code >= 0xe0:
+		return binenc.Item{Kind: binenc.KindInt, Int: int64(int8(code))}, nil
+	case code&0xf0 == 0x80:
+		return r.container(binenc.KindMap, uint64(code&0x0f))
+	case code&0xf0 == 0x90:
+		return r.container(binenc.KindArray, uint64(code&0x0f))
+	case code&0xe0 == 0xa0:
+		return r.bytes(binenc.KindString, uint64(code&0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return binenc.Item{Kind: binenc.KindNil}, nil
+	case 0xc2, 0xc3:
+		return binenc.Item{Kind: binenc.KindBool, Bool: code == 0xc3}, nil
+	case 0xc4, 0xc5, 0xc6:
+		return r.sizedBytes(binenc.KindBytes, 1<<(code-0xc4))
+	case 0xca:
+		n, err := r.uint(4)
+		return binenc.Item{Kind: binenc.KindFloat, Float: float64(math.Float32frombits(uint32(n)))}, err
+	case 0xcb:
+		n, err := r.uint(8)
+		return binenc.Item{Kind: binenc.KindFloat, Float: math.Float64frombits(n)}, err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := r.uint(1 << (code - 0xcc))
+		return binenc.Item{Kind: binenc.KindUint, Uint: n}, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		n, err := r.uint(size)
+		// sign-extend from the encoded size
+		shift := 64 - 8*size
+		return binenc.Item{Kind: binenc.KindInt, Int: int64(n<<shift) >> shift}, err
+	case 0xd9, 0xda, 0xdb:
+		return r.sizedBytes(binenc.KindString, 1<<(code-0xd9))
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (code - 0xdc))
+		if err != nil {
+			return binenc.Item{}, err
+		}
+		return r.container(binenc.KindArray, n)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (code - 0xde))
+		if err != nil {
+			return binenc.Item{}, err
+		}
+		return r.container(binenc.KindMap, n)
+	}
+
+	return binenc.Item{}, fmt.Errorf("unsupported type code 0x%02x", code)
+}
+
+func (r *reader) sizedBytes(kind binenc.Kind, size int) (binenc.Item, error) {
+	n, err := r.uint(size)
+	if err != nil {
+		return binenc.Item{}, err
+	}
+
+	return r.bytes(kind, n)
+}
+
+func (r *reader) bytes(kind binenc.Kind, n uint64) (binenc.Item, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return binenc.Item{}, errors.New("unexpected end of data")
+	}
+
+	b, err := r.read(int(n))
+	return binenc.Item{Kind: kind, Bytes: b}, err
+}
+
+func (r *reader) container(kind binenc.Kind, n uint64) (binenc.Item, error) {
+	// every item takes at least a byte, which bounds allocations for bogus lengths
+	if n > uint64(len(r.data)-r.pos) {
+		return binenc.Item{}, errors.New("unexpected end of data")
+	}
+
+	return binenc.Item{Kind: kind, Len: int(n)}, nil
+}
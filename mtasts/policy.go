@@ -0,0 +1,177 @@
+// Package mtasts fetches MTA-STS policies (RFC 8461) and correlates them
+// with TLS-RPT reports (RFC 8460), the reporting channels usually managed
+// together with DMARC.
+package mtasts
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrNoRecord is returned by LookupRecord when the domain has no _mta-sts record.
+var ErrNoRecord = errors.New("no MTA-STS record")
+
+// maxPolicySize limits the policy file size, RFC 8461 recommends 64 KiB.
+const maxPolicySize = 64 << 10
+
+// Record is the _mta-sts TXT record announcing the policy.
+type Record struct {
+	Version string // STSv1
+	ID      string // Changes whenever the policy changes
+}
+
+// Mode of an MTA-STS policy.
+type Mode string
+
+const (
+	ModeEnforce Mode = "enforce"
+	ModeTesting Mode = "testing"
+	ModeNone    Mode = "none"
+)
+
+// Policy is an MTA-STS policy file.
+type Policy struct {
+	Version string   `json:"version"`
+	Mode    Mode     `json:"mode"`
+	MX      []string `json:"mx"` // MX host patterns, possibly with a leading "*."
+	MaxAge  int      `json:"max_age"`
+}
+
+// LookupRecord retrieves the _mta-sts TXT record of the domain.
+func LookupRecord(ctx context.Context, domain string) (*Record, error) {
+	name := "_mta-sts." + domain
+	txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ErrNoRecord
+		}
+		return nil, fmt.Errorf("lookup TXT %q: %w", name, err)
+	}
+
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, "v=STSv1") {
+			continue
+		}
+
+		record := &Record{}
+		for _, field := range strings.Split(txt, ";") {
+			key, value := splitPair(field, "=")
+			switch key {
+			case "v":
+				record.Version = value
+			case "id":
+				record.ID = value
+			}
+		}
+		return record, nil
+	}
+
+	return nil, ErrNoRecord
+}
+
+// FetchPolicy downloads the policy from https://mta-sts.<domain>/.well-known/mta-sts.txt.
+// Redirects are not followed, as required by RFC 8461.
+func FetchPolicy(ctx context.Context, client *http.Client, domain string) (*Policy, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	url := "https://mta-sts." + domain + "/.well-known/mta-sts.txt"
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := noRedirects.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("get %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %q: unexpected status %d", url, resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/plain" {
+		return nil, fmt.Errorf("get %q: unexpected content type %q", url, mediaType)
+	}
+
+	return ParsePolicy(io.LimitReader(resp.Body, maxPolicySize))
+}
+
+// ParsePolicy parses a policy file.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	policy := &Policy{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value := splitPair(scanner.Text(), ":")
+		switch key {
+		case "version":
+			policy.Version = value
+		case "mode":
+			policy.Mode = Mode(value)
+		case "mx":
+			policy.MX = append(policy.MX, strings.ToLower(value))
+		case "max_age":
+			maxAge, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("parse max_age %q: %w", value, err)
+			}
+			policy.MaxAge = maxAge
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+
+	if policy.Version != "STSv1" {
+		return nil, fmt.Errorf("unsupported policy version %q", policy.Version)
+	}
+	switch policy.Mode {
+	case ModeEnforce, ModeTesting, ModeNone:
+	default:
+		return nil, fmt.Errorf("unknown policy mode %q", policy.Mode)
+	}
+
+	return policy, nil
+}
+
+// Matches reports whether an MX host is allowed by the policy.
+// A "*." pattern matches a single leftmost label.
+func (p *Policy) Matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range p.MX {
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			i := strings.Index(host, ".")
+			if i > 0 && host[i+1:] == pattern[2:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func splitPair(s, sep string) (key, value string) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return strings.TrimSpace(s), ""
+	}
+
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(sep):])
+}
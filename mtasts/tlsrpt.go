@@ -0,0 +1,161 @@
+package mtasts
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report is an SMTP TLS report (RFC 8460 Section 4.4).
+type Report struct {
+	OrganizationName string         `json:"organization-name"`
+	DateRange        ReportRange    `json:"date-range"`
+	ContactInfo      string         `json:"contact-info"`
+	ReportID         string         `json:"report-id"`
+	Policies         []PolicyResult `json:"policies"`
+}
+
+type ReportRange struct {
+	Start time.Time `json:"start-datetime"`
+	End   time.Time `json:"end-datetime"`
+}
+
+// PolicyResult holds session counts for a single evaluated policy.
+type PolicyResult struct {
+	Policy         ReportPolicy    `json:"policy"`
+	Summary        ResultSummary   `json:"summary"`
+	FailureDetails []FailureDetail `json:"failure-details,omitempty"`
+}
+
+type ReportPolicy struct {
+	Type   string   `json:"policy-type"`   // sts, tlsa or no-policy-found
+	String []string `json:"policy-string"` // Lines of the evaluated policy
+	Domain string   `json:"policy-domain"`
+	MXHost []string `json:"mx-host"`
+}
+
+type ResultSummary struct {
+	TotalSuccessful int `json:"total-successful-session-count"`
+	TotalFailure    int `json:"total-failure-session-count"`
+}
+
+type FailureDetail struct {
+	ResultType            string `json:"result-type"` // e.g. certificate-expired, sts-policy-invalid
+	SendingMTAIP          string `json:"sending-mta-ip"`
+	ReceivingMXHostname   string `json:"receiving-mx-hostname"`
+	ReceivingMXHelo       string `json:"receiving-mx-helo,omitempty"`
+	ReceivingIP           string `json:"receiving-ip"`
+	FailedSessionCount    int    `json:"failed-session-count"`
+	AdditionalInformation string `json:"additional-information,omitempty"`
+	FailureReasonCode     string `json:"failure-reason-code,omitempty"`
+}
+
+// ParseReport parses a TLS report, plain or gzip-compressed JSON.
+func ParseReport(r io.Reader) (*Report, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	report := &Report{}
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		return nil, fmt.Errorf("decode TLS report: %w", err)
+	}
+
+	return report, nil
+}
+
+// Correlation summarizes TLS reports for a domain against its current MTA-STS policy.
+type Correlation struct {
+	Domain       string         `json:"domain"`
+	Policy       *Policy        `json:"policy"` // The currently published policy, nil when none
+	Successful   int            `json:"successful"`
+	Failed       int            `json:"failed"`
+	NoPolicy     int            `json:"no_policy"`     // Sessions of senders that found no policy
+	FailureTypes map[string]int `json:"failure_types"` // Failed sessions by result type
+	UnknownMX    []string       `json:"unknown_mx"`    // MX hosts seen in reports, not allowed by the policy
+	Outdated     int            `json:"outdated"`      // Reports evaluating a policy different from the current one
+}
+
+// Correlate aggregates TLS reports of the domain and checks them against the policy.
+func Correlate(domain string, policy *Policy, reports []Report) Correlation {
+	c := Correlation{
+		Domain:       domain,
+		Policy:       policy,
+		FailureTypes: map[string]int{},
+		UnknownMX:    []string{},
+	}
+	unknown := map[string]bool{}
+
+	for _, report := range reports {
+		outdated := false
+		for _, result := range report.Policies {
+			if !strings.EqualFold(result.Policy.Domain, domain) {
+				continue
+			}
+
+			switch result.Policy.Type {
+			case "no-policy-found":
+				c.NoPolicy += result.Summary.TotalSuccessful + result.Summary.TotalFailure
+				continue
+			case "sts":
+				if policy != nil && !samePolicy(policy, result.Policy.String) {
+					outdated = true
+				}
+			}
+
+			c.Successful += result.Summary.TotalSuccessful
+			c.Failed += result.Summary.TotalFailure
+
+			for _, detail := range result.FailureDetails {
+				c.FailureTypes[detail.ResultType] += detail.FailedSessionCount
+				host := strings.ToLower(strings.TrimSuffix(detail.ReceivingMXHostname, "."))
+				if policy != nil && host != "" && !policy.Matches(host) {
+					unknown[host] = true
+				}
+			}
+		}
+		if outdated {
+			c.Outdated++
+		}
+	}
+
+	for host := range unknown {
+		c.UnknownMX = append(c.UnknownMX, host)
+	}
+	sort.Strings(c.UnknownMX)
+
+	return c
+}
+
+// samePolicy compares the policy with the policy-string of a report.
+func samePolicy(policy *Policy, lines []string) bool {
+	reported, err := ParsePolicy(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return false
+	}
+
+	if reported.Mode != policy.Mode || reported.MaxAge != policy.MaxAge || len(reported.MX) != len(policy.MX) {
+		return false
+	}
+	for i := range reported.MX {
+		if reported.MX[i] != policy.MX[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,124 @@
+package dmark
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefixes are the lengths of network prefixes sources are grouped by.
+type Prefixes struct {
+	IPv4 int
+	IPv6 int
+}
+
+// DefaultPrefixes group IPv4 sources by /24 and IPv6 sources by /64,
+// the blocks senders commonly rotate addresses within.
+var DefaultPrefixes = Prefixes{IPv4: 24, IPv6: 64}
+
+// ParsePrefixes parses prefix lengths for IPv4 and IPv6, e.g. "24,48" or "/24,/48".
+// Without the IPv6 length, the one of DefaultPrefixes is used.
+func ParsePrefixes(value string) (Prefixes, error) {
+	p := DefaultPrefixes
+	parts := strings.Split(value, ",")
+	if len(parts) > 2 {
+		return p, fmt.Errorf("invalid prefixes %q, want IPv4 and IPv6 lengths, e.g. 24,64", value)
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(part), "/"))
+		if err != nil || n < 0 || (i == 0 && n > 32) || n > 128 {
+			return p, fmt.Errorf("invalid prefix length %q", part)
+		}
+		if i == 0 {
+			p.IPv4 = n
+		} else {
+			p.IPv6 = n
+		}
+	}
+
+	return p, nil
+}
+
+// Network returns the network of the IP address with the prefix length of its family.
+func (p Prefixes) Network(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(p.IPv4, 32)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+
+	mask := net.CIDRMask(p.IPv6, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// NetworkSummary aggregates records sent from addresses within a network.
+type NetworkSummary struct {
+	Counts
+	Network   string   `json:"network"`    // In CIDR notation
+	SourceIPs []net.IP `json:"source_ips"` // Sorted like Sources
+}
+
+// GroupSources aggregates sources by their networks, sorted like Sources:
+// by failed messages, then by total messages.
+func GroupSources(sources []SourceSummary, p Prefixes) []NetworkSummary {
+	sorted := append([]SourceSummary{}, sources...)
+	sortSources(sorted)
+
+	networks := map[string]*NetworkSummary{}
+	order := []string{}
+	for _, source := range sorted {
+		key := p.Network(source.SourceIP).String()
+		network, ok := networks[key]
+		if !ok {
+			network = &NetworkSummary{Network: key}
+			networks[key] = network
+			order = append(order, key)
+		}
+		network.Merge(source.Counts)
+		if !containsIP(network.SourceIPs, source.SourceIP) {
+			network.SourceIPs = append(network.SourceIPs, source.SourceIP)
+		}
+	}
+
+	result := make([]NetworkSummary, 0, len(order))
+	for _, key := range order {
+		result = append(result, *networks[key])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Failed() != result[j].Failed() {
+			return result[i].Failed() > result[j].Failed()
+		}
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+		return result[i].Network < result[j].Network
+	})
+
+	return result
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, other := range ips {
+		if other.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Networks groups sources of the domain by network, see GroupSources.
+func (d DomainSummary) Networks(p Prefixes) []NetworkSummary {
+	return GroupSources(d.Sources, p)
+}
+
+// Networks groups sources of all domains by network, see GroupSources.
+func (s Summary) Networks(p Prefixes) []NetworkSummary {
+	sources := []SourceSummary{}
+	for _, domain := range s.Domains {
+		sources = append(sources, domain.Sources...)
+	}
+
+	return GroupSources(sources, p)
+}
@@ -0,0 +1,25 @@
+package dmark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Origin identifies the raw report a Feedback was parsed from, for audits.
+type Origin struct {
+	File     string    `json:"file,omitempty"` // Base name of the file, empty for reports read from a stream
+	SHA256   string    `json:"sha256"`         // Hex-encoded hash of the raw XML as read
+	Ingested time.Time `json:"ingested"`       // When the file was saved, or when the report was parsed
+}
+
+// NewOrigin returns the origin of a raw report.
+func NewOrigin(file string, content []byte, ingested time.Time) *Origin {
+	sum := sha256.Sum256(content)
+
+	return &Origin{
+		File:     file,
+		SHA256:   hex.EncodeToString(sum[:]),
+		Ingested: ingested.UTC(),
+	}
+}
@@ -0,0 +1,98 @@
+package dmark
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxOverrideComments limits the distinct comments kept per OverrideSummary.
+const maxOverrideComments = 5
+
+// OverrideSummary counts records a receiver applied an override reason to,
+// telling domain owners who departs from their policy and why.
+type OverrideSummary struct {
+	OrgName  string         `json:"org_name"` // The receiver sending the reports
+	Reason   PolicyOverride `json:"reason"`
+	Messages int            `json:"messages"`
+	Records  int            `json:"records"`
+	Comments []string       `json:"comments,omitempty"` // Distinct comments of the reason, up to 5
+}
+
+type overrideKey struct {
+	orgName string
+	reason  PolicyOverride
+}
+
+// overrideCounts aggregates override reasons by receiver and reason.
+type overrideCounts map[overrideKey]*OverrideSummary
+
+// add counts the record for each of its reasons; a record with several
+// reasons of the same type counts once for it.
+func (o overrideCounts) add(orgName string, record Record) {
+	orgName = strings.TrimSpace(orgName)
+	seen := map[PolicyOverride]bool{}
+	for _, reason := range record.Row.PolicyEvaluated.Reason {
+		if reason.Type == 0 {
+			continue
+		}
+
+		key := overrideKey{orgName: orgName, reason: reason.Type}
+		summary, ok := o[key]
+		if !ok {
+			summary = &OverrideSummary{OrgName: orgName, Reason: reason.Type}
+			o[key] = summary
+		}
+		if !seen[reason.Type] {
+			seen[reason.Type] = true
+			summary.Messages += record.Row.Count
+			summary.Records++
+		}
+		summary.addComment(reason.Comment)
+	}
+}
+
+func (s *OverrideSummary) addComment(comment string) {
+	comment = strings.TrimSpace(comment)
+	if comment == "" || len(s.Comments) == maxOverrideComments {
+		return
+	}
+	for _, c := range s.Comments {
+		if c == comment {
+			return
+		}
+	}
+	s.Comments = append(s.Comments, comment)
+}
+
+// summaries sorts counts by messages, then by receiver and reason.
+func (o overrideCounts) summaries() []OverrideSummary {
+	result := make([]OverrideSummary, 0, len(o))
+	for _, summary := range o {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+		if result[i].OrgName != result[j].OrgName {
+			return result[i].OrgName < result[j].OrgName
+		}
+		return result[i].Reason < result[j].Reason
+	})
+
+	return result
+}
+
+// Overrides breaks down records with policy override reasons (forwarded,
+// mailing_list, local_policy...) by the receiver reporting them and the reason,
+// sorted by messages, most first.
+func Overrides(reports []Feedback) []OverrideSummary {
+	counts := overrideCounts{}
+	for _, report := range reports {
+		for _, record := range report.Records {
+			counts.add(report.ReportMetadata.OrgName, record)
+		}
+	}
+
+	return counts.summaries()
+}
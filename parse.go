@@ -0,0 +1,388 @@
+package dmark
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrSkipRecord can be returned by Parser.OnRecordError to drop the record.
+var ErrSkipRecord = errors.New("skip record")
+
+// Parser parses DMARK aggregate reports. The zero value is ready to use.
+type Parser struct {
+	// OnRecordError is called for every record that could not be decoded,
+	// e.g. because of an unknown enum value. Returning nil keeps the record
+	// with the values decoded so far, returning ErrSkipRecord drops it,
+	// any other error stops parsing. When nil, parsing stops on the first error.
+	OnRecordError func(err *RecordError) error
+
+	// OnPolicyError is called for every unknown value of p, sp, np, adkim,
+	// aspf or fo in policy_published, with an UnknownValueError in err.Err.
+	// Returning nil keeps the Unknown value, for fo the options recognized,
+	// any other error stops parsing. When nil, parsing stops on the first
+	// error, as the report cannot be evaluated without its policy.
+	OnPolicyError func(err *DecodeError) error
+
+	// Quirks are profiles of reporters whose reports are fixed after parsing,
+	// DefaultQuirks when nil. An empty slice disables fixes.
+	Quirks []QuirkProfile
+
+	// TrackOrigin sets Feedback.Origin of parsed reports,
+	// so rows derived from them can be traced back to the raw report.
+	TrackOrigin bool
+}
+
+// Parse reads a DMARK aggregate report and unmarshals it into Feedback.
+//
+// Unlike plain xml.Unmarshal it tolerates the quirks found in reports sent by
+// real-world reporters: byte order marks, UTF-16 and Latin-1 content,
+// encodings declared in the XML prolog that do not match the actual content
+// and DOCTYPE declarations. Documents declaring external entities are rejected.
+// Namespaced elements (<feedback xmlns="..."> or <dmarc:feedback>) are matched
+// by their local names.
+func Parse(r io.Reader) (*Feedback, error) {
+	return (&Parser{}).Parse(r)
+}
+
+// ParseBytes is like Parse, but takes the raw report content.
+func ParseBytes(content []byte) (*Feedback, error) {
+	return (&Parser{}).ParseBytes(content)
+}
+
+// Parse is like the package level Parse, but uses the Parser options.
+func (p *Parser) Parse(r io.Reader) (*Feedback, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	return p.ParseBytes(content)
+}
+
+// ParseBytes is like the package level ParseBytes, but uses the Parser options.
+func (p *Parser) ParseBytes(content []byte) (*Feedback, error) {
+	return p.parseBytes(content, &reportDecoder{})
+}
+
+func (p *Parser) parseBytes(content []byte, d *reportDecoder) (*Feedback, error) {
+	feedback, err := p.decodeBytes(content, d)
+	if err == nil && p.TrackOrigin {
+		feedback.Origin = NewOrigin("", content, time.Now())
+	}
+
+	return feedback, err
+}
+
+func (p *Parser) decodeBytes(content []byte, d *reportDecoder) (*Feedback, error) {
+	content, err := normalizeEncoding(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkDoctype(content); err != nil {
+		return nil, err
+	}
+
+	feedback, err := d.decode(content)
+	if err != nil {
+		if feedback, err = p.decodeXML(content); err != nil {
+			return nil, err
+		}
+	}
+	p.applyQuirks(feedback)
+
+	return feedback, nil
+}
+
+// decodeXML decodes normalized content with encoding/xml, the slow path
+// for reports reportDecoder does not handle, which also reports errors.
+func (p *Parser) decodeXML(content []byte) (*Feedback, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	// content is already UTF-8 at this point, whatever the prolog claims
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	parsed := parseFeedback{}
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, newDecodeError(content, decoder.InputOffset(), err)
+	}
+
+	feedback := parsed.Feedback
+	policy, err := p.policyPublished(content, parsed.PolicyPublished)
+	if err != nil {
+		return nil, err
+	}
+	feedback.PolicyPublished = policy
+
+	feedback.Records = make([]Record, 0, len(parsed.Records))
+	for i, record := range parsed.Records {
+		if record.err != nil {
+			recordErr := &RecordError{
+				Index:  i,
+				Line:   lineAt(content, record.offset),
+				Offset: record.offset,
+				Err:    record.err,
+			}
+			if p.OnRecordError == nil {
+				return nil, recordErr
+			}
+			if err := p.OnRecordError(recordErr); err == ErrSkipRecord {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		feedback.Records = append(feedback.Records, record.Record)
+	}
+
+	return &feedback, nil
+}
+
+// policyPublished unmarshals the enum values of policy_published,
+// passing unknown ones to OnPolicyError.
+func (p *Parser) policyPublished(content []byte, parsed parsePolicyPublished) (PolicyPublished, error) {
+	policy := parsed.PolicyPublished
+	values := []struct {
+		value policyValue
+		v     encoding.TextUnmarshaler
+	}{
+		{parsed.ADKIM, &policy.ADKIM},
+		{parsed.ASPF, &policy.ASPF},
+		{parsed.P, &policy.P},
+		{parsed.SP, &policy.SP},
+		{parsed.NP, &policy.NP},
+		{parsed.Fo, &policy.Fo},
+	}
+
+	for _, value := range values {
+		if err := value.v.UnmarshalText([]byte(value.value.text)); err != nil {
+			decodeErr := newDecodeError(content, value.value.offset, err)
+			if p.OnPolicyError == nil {
+				return policy, decodeErr
+			}
+			if err = p.OnPolicyError(decodeErr); err != nil {
+				return policy, err
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// parseFeedback decodes records one by one,
+// so that a broken record does not fail the whole report.
+type parseFeedback struct {
+	Feedback
+	PolicyPublished parsePolicyPublished `xml:"policy_published"` // shadows Feedback.PolicyPublished
+	Records         []parseRecord        `xml:"record"`           // shadows Feedback.Records
+}
+
+// parsePolicyPublished decodes enum values as text, unmarshalled by
+// Parser.policyPublished, so that unknown ones do not stop decoding.
+type parsePolicyPublished struct {
+	PolicyPublished
+	ADKIM policyValue `xml:"adkim"` // shadows PolicyPublished.ADKIM
+	ASPF  policyValue `xml:"aspf"`  // shadows PolicyPublished.ASPF
+	P     policyValue `xml:"p"`     // shadows PolicyPublished.P
+	SP    policyValue `xml:"sp"`    // shadows PolicyPublished.SP
+	NP    policyValue `xml:"np"`    // shadows PolicyPublished.NP
+	Fo    policyValue `xml:"fo"`    // shadows PolicyPublished.Fo
+}
+
+// policyValue is the text of an element with its offset, for errors.
+type policyValue struct {
+	text   string
+	offset int64
+}
+
+func (v *policyValue) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	v.offset = d.InputOffset()
+
+	return d.DecodeElement(&v.text, &start)
+}
+
+type parseRecord struct {
+	Record
+	offset int64
+	err    error
+}
+
+func (r *parseRecord) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	r.offset = d.InputOffset()
+
+	err := d.DecodeElement(&r.Record, &start)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*xml.SyntaxError); ok {
+		return err
+	}
+
+	r.err = err
+
+	// records never nest, so the first matching end element closes this one
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if end, ok := token.(xml.EndElement); ok && end.Name.Local == start.Name.Local {
+			return nil
+		}
+	}
+}
+
+func newDecodeError(content []byte, offset int64, err error) *DecodeError {
+	if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+		return &DecodeError{Line: syntaxErr.Line, Offset: offset, Err: err}
+	}
+
+	return &DecodeError{Line: lineAt(content, offset), Offset: offset, Err: err}
+}
+
+func lineAt(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	return bytes.Count(content[:offset], []byte{'\n'}) + 1
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+
+	prologEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\bencoding\s*=\s*["']([^"']+)["']`)
+	externalEntity = regexp.MustCompile(`(?is)<!ENTITY[^>]*\b(SYSTEM|PUBLIC)\b`)
+)
+
+// normalizeEncoding converts content to UTF-8 without a byte order mark.
+func normalizeEncoding(content []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		// the rest of the decoders relies on content being valid UTF-8
+		content = content[len(bomUTF8):]
+		if !utf8.Valid(content) {
+			return nil, encodingError("invalid UTF-8 after UTF-8 byte order mark")
+		}
+		return content, nil
+	case bytes.HasPrefix(content, bomUTF16BE):
+		return decodeUTF16(content[len(bomUTF16BE):], true)
+	case bytes.HasPrefix(content, bomUTF16LE):
+		return decodeUTF16(content[len(bomUTF16LE):], false)
+	case len(content) >= 2 && content[0] == 0 && content[1] != 0:
+		return decodeUTF16(content, true)
+	case len(content) >= 2 && content[0] != 0 && content[1] == 0:
+		return decodeUTF16(content, false)
+	}
+
+	if utf8.Valid(content) {
+		// encodings like UTF-16 declared for UTF-8 content are ignored
+		return content, nil
+	}
+
+	m := prologEncoding.FindSubmatch(content)
+	if m == nil {
+		return nil, encodingError("invalid UTF-8 without a declared encoding")
+	}
+
+	switch label := strings.ToLower(string(m[1])); label {
+	case "utf-8", "utf8":
+		return nil, encodingError("invalid UTF-8 in content declared as UTF-8")
+	case "iso-8859-1", "iso8859-1", "latin1", "l1", "windows-1252", "cp1252", "us-ascii", "ascii":
+		// windows-1252 is a superset of Latin-1 used by mislabelled reports,
+		// decoding it as Latin-1 only misses a few punctuation characters
+		return decodeLatin1(content), nil
+	default:
+		return nil, encodingError(fmt.Sprintf("unsupported encoding %q", label))
+	}
+}
+
+func decodeUTF16(content []byte, bigEndian bool) ([]byte, error) {
+	if len(content)%2 != 0 {
+		return nil, encodingError("odd UTF-16 content length")
+	}
+
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		} else {
+			units[i] = uint16(content[2*i+1])<<8 | uint16(content[2*i])
+		}
+	}
+
+	result := make([]byte, 0, len(units)+len(units)/2)
+	for _, r := range utf16.Decode(units) {
+		result = utf8.AppendRune(result, r)
+	}
+
+	return result, nil
+}
+
+// encodeUTF16 returns s in UTF-16 with the given byte order, without a BOM.
+func encodeUTF16(s string, bigEndian bool) []byte {
+	units := utf16.Encode([]rune(s))
+	content := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		if bigEndian {
+			content = append(content, byte(u>>8), byte(u))
+		} else {
+			content = append(content, byte(u), byte(u>>8))
+		}
+	}
+
+	return content
+}
+
+func decodeLatin1(content []byte) []byte {
+	result := make([]byte, 0, len(content)+len(content)/8)
+	for _, b := range content {
+		result = utf8.AppendRune(result, rune(b))
+	}
+
+	return result
+}
+
+// checkDoctype rejects documents declaring external entities.
+// encoding/xml never resolves entities itself, but refusing such documents
+// keeps them from reaching less careful consumers of the raw content.
+func checkDoctype(content []byte) error {
+	if !hasEntityDeclaration(content) {
+		return nil
+	}
+
+	if externalEntity.Match(content) {
+		return errExternalEntities
+	}
+
+	return nil
+}
+
+// hasEntityDeclaration is a quick check for "<!ENTITY" in any case,
+// which spares running externalEntity over most reports.
+func hasEntityDeclaration(content []byte) bool {
+	for {
+		i := bytes.Index(content, []byte("<!"))
+		if i < 0 {
+			return false
+		}
+		content = content[i+2:]
+		if len(content) >= 6 && bytes.EqualFold(content[:6], []byte("ENTITY")) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dmark
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEncoding(t *testing.T) {
+	const report = `<?xml version="1.0" encoding="UTF-16"?><feedback><org_name>Ümlaut Mail</org_name></feedback>`
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "UTF-8",
+			content: []byte(`<feedback><org_name>Ümlaut Mail</org_name></feedback>`),
+			want:    `<feedback><org_name>Ümlaut Mail</org_name></feedback>`,
+		},
+		{
+			name:    "UTF-8 with BOM",
+			content: append([]byte{0xEF, 0xBB, 0xBF}, "<feedback/>"...),
+			want:    "<feedback/>",
+		},
+		{
+			name:    "Latin-1 with UTF-8 BOM",
+			content: append([]byte{0xEF, 0xBB, 0xBF}, "<feedback><org_name>Caf\xe9</org_name></feedback>"...),
+			wantErr: "invalid UTF-8 after UTF-8 byte order mark",
+		},
+		{
+			name:    "UTF-16 LE with BOM",
+			content: append([]byte{0xFF, 0xFE}, encodeUTF16(report, false)...),
+			want:    report,
+		},
+		{
+			name:    "UTF-16 BE with BOM",
+			content: append([]byte{0xFE, 0xFF}, encodeUTF16(report, true)...),
+			want:    report,
+		},
+		{
+			name:    "UTF-16 LE without BOM",
+			content: encodeUTF16(report, false),
+			want:    report,
+		},
+		{
+			name:    "UTF-16 BE without BOM",
+			content: encodeUTF16(report, true),
+			want:    report,
+		},
+		{
+			name:    "UTF-16 with odd length",
+			content: append([]byte{0xFF, 0xFE}, encodeUTF16(report, false)[1:]...),
+			wantErr: "odd UTF-16 content length",
+		},
+		{
+			name:    "UTF-8 declared as UTF-16",
+			content: []byte(report),
+			want:    report,
+		},
+		{
+			name:    "Latin-1 declared",
+			content: []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><feedback><org_name>\xDCmlaut Mail</org_name></feedback>"),
+			want:    `<?xml version="1.0" encoding="ISO-8859-1"?><feedback><org_name>Ümlaut Mail</org_name></feedback>`,
+		},
+		{
+			name:    "windows-1252 declared",
+			content: []byte("<?xml version='1.0' encoding='windows-1252'?><feedback><org_name>\xDCmlaut Mail</org_name></feedback>"),
+			want:    `<?xml version='1.0' encoding='windows-1252'?><feedback><org_name>Ümlaut Mail</org_name></feedback>`,
+		},
+		{
+			name:    "Latin-1 undeclared",
+			content: []byte("<feedback><org_name>\xDCmlaut Mail</org_name></feedback>"),
+			wantErr: "invalid UTF-8 without a declared encoding",
+		},
+		{
+			name:    "Latin-1 declared as UTF-8",
+			content: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?><feedback><org_name>\xDCmlaut Mail</org_name></feedback>"),
+			wantErr: "invalid UTF-8 in content declared as UTF-8",
+		},
+		{
+			name:    "unsupported encoding",
+			content: []byte("<?xml version=\"1.0\" encoding=\"KOI8-R\"?><feedback><org_name>\xF0\xD2\xC9</org_name></feedback>"),
+			wantErr: `unsupported encoding "koi8-r"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeEncoding(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("want error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckDoctype(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "no DOCTYPE",
+			content: `<feedback/>`,
+		},
+		{
+			name:    "DOCTYPE without declarations",
+			content: `<!DOCTYPE feedback><feedback/>`,
+		},
+		{
+			name:    "internal DOCTYPE",
+			content: `<!DOCTYPE feedback [<!ELEMENT feedback ANY><!ENTITY org "Example">]><feedback>&org;</feedback>`,
+		},
+		{
+			name:    "SYSTEM entity",
+			content: `<!DOCTYPE feedback [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><feedback>&xxe;</feedback>`,
+			wantErr: true,
+		},
+		{
+			name:    "PUBLIC entity",
+			content: `<!DOCTYPE feedback [<!ENTITY xxe PUBLIC "-//X//Y" "http://example.com/x">]><feedback>&xxe;</feedback>`,
+			wantErr: true,
+		},
+		{
+			name:    "lowercase SYSTEM entity",
+			content: "<!DOCTYPE feedback [<!entity xxe\n  system \"file:///etc/passwd\">]><feedback>&xxe;</feedback>",
+			wantErr: true,
+		},
+		{
+			name:    "SYSTEM outside an entity",
+			content: `<!DOCTYPE feedback SYSTEM "feedback.dtd"><feedback><org_name>SYSTEM</org_name></feedback>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDoctype([]byte(tt.content))
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "external entities")) {
+				t.Fatalf("want external entities error, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("want no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParserOnPolicyError(t *testing.T) {
+	const report = `<feedback>
+<policy_published>
+	<domain>example.com</domain>
+	<adkim>x</adkim>
+	<p>reject</p>
+	<sp>bogus</sp>
+	<fo>z:1:x:d</fo>
+	<rua>mailto:dmarc@example.com</rua>
+</policy_published>
+<record><row><source_ip>192.0.2.1</source_ip><count>1</count></row></record>
+</feedback>`
+
+	_, err := ParseBytes([]byte(report))
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 4 {
+		t.Fatalf("want DecodeError on line 4 without OnPolicyError, got %v", err)
+	}
+
+	values := []string{}
+	lines := []int{}
+	parser := &Parser{
+		OnPolicyError: func(err *DecodeError) error {
+			var unknownErr *UnknownValueError
+			if !errors.As(err, &unknownErr) {
+				t.Errorf("want UnknownValueError, got %v", err.Err)
+			}
+			values = append(values, unknownErr.Value)
+			lines = append(lines, err.Line)
+			return nil
+		},
+	}
+	feedback, err := parser.ParseBytes([]byte(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(values, ",") != "x,bogus,z:x" {
+		t.Errorf("want unknown values x,bogus,z:x, got %v", values)
+	}
+	if fmt.Sprint(lines) != "[4 6 7]" {
+		t.Errorf("want errors on lines [4 6 7], got %v", lines)
+	}
+	policy := feedback.PolicyPublished
+	if policy.ADKIM != AlignmentUnknown || policy.P != DispositionReject || policy.SP != DispositionUnknown ||
+		policy.Fo != Fo1|FoD || policy.RUA != "mailto:dmarc@example.com" || len(feedback.Records) != 1 {
+		t.Errorf("unexpected report %+v", feedback)
+	}
+
+	stop := errors.New("stop")
+	parser.OnPolicyError = func(err *DecodeError) error { return stop }
+	if _, err = parser.ParseBytes([]byte(report)); err != stop {
+		t.Errorf("want error of OnPolicyError, got %v", err)
+	}
+}
@@ -0,0 +1,449 @@
+// Package pb encodes reports as Protocol Buffers, following the messages
+// of dmarc.proto, so that services in other languages can generate
+// their types from the schema and read reports without parsing XML.
+//
+// Enums keep their numbers, so values unknown to this package survive a round trip.
+package pb
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Marshal returns the dmarc.v1.Feedback encoding of the report.
+func Marshal(f *dmark.Feedback) []byte {
+	e := encoder{}
+	encodeFeedback(&e, f)
+	return e.buf
+}
+
+// Unmarshal decodes a dmarc.v1.Feedback message.
+func Unmarshal(data []byte) (*dmark.Feedback, error) {
+	f := &dmark.Feedback{}
+	if err := decodeFeedback(&decoder{data: data}, f); err != nil {
+		return nil, fmt.Errorf("pb: feedback: %w", err)
+	}
+
+	return f, nil
+}
+
+// MarshalRecord returns the dmarc.v1.Record encoding of the record.
+func MarshalRecord(r *dmark.Record) []byte {
+	e := encoder{}
+	encodeRecord(&e, r)
+	return e.buf
+}
+
+// UnmarshalRecord decodes a dmarc.v1.Record message.
+func UnmarshalRecord(data []byte) (*dmark.Record, error) {
+	r := &dmark.Record{}
+	if err := decodeRecord(&decoder{data: data}, r); err != nil {
+		return nil, fmt.Errorf("pb: record: %w", err)
+	}
+
+	return r, nil
+}
+
+func encodeFeedback(e *encoder, f *dmark.Feedback) {
+	e.double(1, f.Version)
+	e.message(2, false, func(e *encoder) {
+		m := f.ReportMetadata
+		e.string(1, m.OrgName)
+		e.string(2, m.Email)
+		e.string(3, m.ExtraContactInfo)
+		e.string(4, m.ReportID)
+		e.message(5, false, func(e *encoder) {
+			e.int(1, int64(m.DateRange.Begin))
+			e.int(2, int64(m.DateRange.End))
+		})
+		for _, s := range m.Errors {
+			e.repeatedString(6, s)
+		}
+	})
+	e.message(3, false, func(e *encoder) {
+		p := f.PolicyPublished
+		e.string(1, p.Domain)
+		e.int(2, int64(p.ADKIM))
+		e.int(3, int64(p.ASPF))
+		e.int(4, int64(p.P))
+		e.int(5, int64(p.SP))
+		e.int(6, int64(p.NP))
+		e.int(7, int64(p.Pct))
+		e.uint(8, uint64(p.Fo))
+		e.int(9, int64(p.RI))
+		e.string(10, p.RUA)
+		e.string(11, p.RUF)
+		e.string(12, p.Testing)
+		e.stringMap(13, p.Extensions)
+	})
+	for i := range f.Records {
+		e.message(4, true, func(e *encoder) {
+			encodeRecord(e, &f.Records[i])
+		})
+	}
+	encodeRawElements(e, 5, f.Extensions)
+}
+
+func encodeRawElements(e *encoder, field int, elements []dmark.RawElement) {
+	for _, el := range elements {
+		e.message(field, true, func(e *encoder) {
+			e.string(1, el.Name)
+			e.string(2, el.Space)
+			e.stringMap(3, el.Attrs)
+			e.string(4, el.XML)
+		})
+	}
+}
+
+func encodeRecord(e *encoder, r *dmark.Record) {
+	e.message(1, false, func(e *encoder) {
+		row := r.Row
+		if ip4 := row.SourceIP.To4(); ip4 != nil {
+			e.bytes(1, ip4)
+		} else {
+			e.bytes(1, row.SourceIP)
+		}
+		e.int(2, int64(row.Count))
+		e.message(3, false, func(e *encoder) {
+			p := row.PolicyEvaluated
+			e.int(1, int64(p.Disposition))
+			e.bool(2, bool(p.DKIM))
+			e.bool(3, bool(p.SPF))
+			for _, reason := range p.Reason {
+				e.message(4, true, func(e *encoder) {
+					e.int(1, int64(reason.Type))
+					e.string(2, reason.Comment)
+				})
+			}
+		})
+	})
+	e.message(2, false, func(e *encoder) {
+		e.string(1, r.Identifiers.EnvelopeTo)
+		e.string(2, r.Identifiers.EnvelopeFrom)
+		e.string(3, r.Identifiers.HeaderFrom)
+	})
+	e.message(3, false, func(e *encoder) {
+		for _, dkim := range r.AuthResult.DKIM {
+			e.message(1, true, func(e *encoder) {
+				e.string(1, dkim.Domain)
+				e.string(2, dkim.Selector)
+				e.int(3, int64(dkim.Result))
+				e.string(4, dkim.HumanResult)
+			})
+		}
+		for _, spf := range r.AuthResult.SPF {
+			e.message(2, true, func(e *encoder) {
+				e.string(1, spf.Domain)
+				e.int(2, int64(spf.Scope))
+				e.int(3, int64(spf.Result))
+			})
+		}
+		encodeRawElements(e, 3, r.AuthResult.Extensions)
+	})
+	encodeRawElements(e, 4, r.Extensions)
+}
+
+func decodeFeedback(d *decoder, f *dmark.Feedback) error {
+	return d.fields(func(field int) (err error) {
+		switch field {
+		case 1:
+			f.Version, err = d.double()
+		case 2:
+			err = d.message(func(d *decoder) error {
+				return decodeReportMetadata(d, &f.ReportMetadata)
+			})
+		case 3:
+			err = d.message(func(d *decoder) error {
+				return decodePolicyPublished(d, &f.PolicyPublished)
+			})
+		case 4:
+			r := dmark.Record{}
+			err = d.message(func(d *decoder) error {
+				return decodeRecord(d, &r)
+			})
+			f.Records = append(f.Records, r)
+		case 5:
+			f.Extensions, err = decodeRawElement(d, f.Extensions)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+// decodeRawElement decodes a RawElement message and appends it to elements.
+func decodeRawElement(d *decoder, elements []dmark.RawElement) ([]dmark.RawElement, error) {
+	el := dmark.RawElement{}
+	err := d.message(func(d *decoder) error {
+		return d.fields(func(field int) (err error) {
+			switch field {
+			case 1:
+				el.Name, err = d.string()
+			case 2:
+				el.Space, err = d.string()
+			case 3:
+				if el.Attrs == nil {
+					el.Attrs = map[string]string{}
+				}
+				err = d.stringMapEntry(el.Attrs)
+			case 4:
+				el.XML, err = d.string()
+			default:
+				err = d.skip()
+			}
+			return err
+		})
+	})
+
+	return append(elements, el), err
+}
+
+func decodeReportMetadata(d *decoder, m *dmark.ReportMetadata) error {
+	return d.fields(func(field int) (err error) {
+		switch field {
+		case 1:
+			m.OrgName, err = d.string()
+		case 2:
+			m.Email, err = d.string()
+		case 3:
+			m.ExtraContactInfo, err = d.string()
+		case 4:
+			m.ReportID, err = d.string()
+		case 5:
+			err = d.message(func(d *decoder) error {
+				return d.fields(func(field int) (err error) {
+					var v int64
+					switch field {
+					case 1:
+						v, err = d.int()
+						m.DateRange.Begin = int(v)
+					case 2:
+						v, err = d.int()
+						m.DateRange.End = int(v)
+					default:
+						err = d.skip()
+					}
+					return err
+				})
+			})
+		case 6:
+			var s string
+			s, err = d.string()
+			m.Errors = append(m.Errors, s)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+func decodePolicyPublished(d *decoder, p *dmark.PolicyPublished) error {
+	return d.fields(func(field int) (err error) {
+		var v int
+		switch field {
+		case 1:
+			p.Domain, err = d.string()
+		case 2:
+			v, err = d.int32()
+			p.ADKIM = dmark.Alignment(v)
+		case 3:
+			v, err = d.int32()
+			p.ASPF = dmark.Alignment(v)
+		case 4:
+			v, err = d.int32()
+			p.P = dmark.Disposition(v)
+		case 5:
+			v, err = d.int32()
+			p.SP = dmark.Disposition(v)
+		case 6:
+			v, err = d.int32()
+			p.NP = dmark.Disposition(v)
+		case 7:
+			p.Pct, err = d.int32()
+		case 8:
+			v, err = d.int32()
+			p.Fo = dmark.Fo(v)
+		case 9:
+			p.RI, err = d.int32()
+		case 10:
+			p.RUA, err = d.string()
+		case 11:
+			p.RUF, err = d.string()
+		case 12:
+			p.Testing, err = d.string()
+		case 13:
+			if p.Extensions == nil {
+				p.Extensions = dmark.Extensions{}
+			}
+			err = d.stringMapEntry(p.Extensions)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+func decodeRecord(d *decoder, r *dmark.Record) error {
+	return d.fields(func(field int) (err error) {
+		switch field {
+		case 1:
+			err = d.message(func(d *decoder) error {
+				return decodeRow(d, &r.Row)
+			})
+		case 2:
+			err = d.message(func(d *decoder) error {
+				return decodeIdentifiers(d, &r.Identifiers)
+			})
+		case 3:
+			err = d.message(func(d *decoder) error {
+				return decodeAuthResult(d, &r.AuthResult)
+			})
+		case 4:
+			r.Extensions, err = decodeRawElement(d, r.Extensions)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+func decodeRow(d *decoder, row *dmark.Row) error {
+	return d.fields(func(field int) (err error) {
+		switch field {
+		case 1:
+			var b []byte
+			if b, err = d.bytes(); err != nil {
+				return err
+			}
+			switch len(b) {
+			case net.IPv4len:
+				row.SourceIP = net.IPv4(b[0], b[1], b[2], b[3])
+			case net.IPv6len:
+				row.SourceIP = append(net.IP{}, b...)
+			default:
+				err = fmt.Errorf("invalid IP address length %d", len(b))
+			}
+		case 2:
+			var v int64
+			v, err = d.int()
+			row.Count = int(v)
+		case 3:
+			err = d.message(func(d *decoder) error {
+				return decodePolicyEvaluated(d, &row.PolicyEvaluated)
+			})
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+func decodePolicyEvaluated(d *decoder, p *dmark.PolicyEvaluated) error {
+	return d.fields(func(field int) (err error) {
+		var v int
+		var b bool
+		switch field {
+		case 1:
+			v, err = d.int32()
+			p.Disposition = dmark.Disposition(v)
+		case 2:
+			b, err = d.bool()
+			p.DKIM = dmark.Result(b)
+		case 3:
+			b, err = d.bool()
+			p.SPF = dmark.Result(b)
+		case 4:
+			reason := dmark.PolicyOverrideReason{}
+			err = d.message(func(d *decoder) error {
+				return d.fields(func(field int) (err error) {
+					switch field {
+					case 1:
+						v, err = d.int32()
+						reason.Type = dmark.PolicyOverride(v)
+					case 2:
+						reason.Comment, err = d.string()
+					default:
+						err = d.skip()
+					}
+					return err
+				})
+			})
+			p.Reason = append(p.Reason, reason)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+func decodeIdentifiers(d *decoder, ids *dmark.Identifiers) error {
+	return d.fields(func(field int) (err error) {
+		switch field {
+		case 1:
+			ids.EnvelopeTo, err = d.string()
+		case 2:
+			ids.EnvelopeFrom, err = d.string()
+		case 3:
+			ids.HeaderFrom, err = d.string()
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+func decodeAuthResult(d *decoder, a *dmark.AuthResult) error {
+	return d.fields(func(field int) (err error) {
+		var v int
+		switch field {
+		case 1:
+			dkim := dmark.DKIMAuthResult{}
+			err = d.message(func(d *decoder) error {
+				return d.fields(func(field int) (err error) {
+					switch field {
+					case 1:
+						dkim.Domain, err = d.string()
+					case 2:
+						dkim.Selector, err = d.string()
+					case 3:
+						v, err = d.int32()
+						dkim.Result = dmark.DKIMResult(v)
+					case 4:
+						dkim.HumanResult, err = d.string()
+					default:
+						err = d.skip()
+					}
+					return err
+				})
+			})
+			a.DKIM = append(a.DKIM, dkim)
+		case 2:
+			spf := dmark.SPFAuthResult{}
+			err = d.message(func(d *decoder) error {
+				return d.fields(func(field int) (err error) {
+					switch field {
+					case 1:
+						spf.Domain, err = d.string()
+					case 2:
+						v, err = d.int32()
+						spf.Scope = dmark.SPFDomainScope(v)
+					case 3:
+						v, err = d.int32()
+						spf.Result = dmark.SPFResult(v)
+					default:
+						err = d.skip()
+					}
+					return err
+				})
+			})
+			a.SPF = append(a.SPF, spf)
+		case 3:
+			a.Extensions, err = decodeRawElement(d, a.Extensions)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
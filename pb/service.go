@@ -0,0 +1,219 @@
+package pb
+
+import (
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/store"
+)
+
+// Service is the full name of the DMARC service, gRPC methods are "/<Service>/<Method>".
+const Service = "dmarc.v1.DMARC"
+
+// ReportChunk is a part of an uploaded file, see dmarc.v1.ReportChunk.
+type ReportChunk struct {
+	Name string // Starts a new file when not empty
+	Data []byte
+}
+
+func (c *ReportChunk) MarshalBinary() ([]byte, error) {
+	e := encoder{}
+	e.string(1, c.Name)
+	e.bytes(2, c.Data)
+	return e.buf, nil
+}
+
+func (c *ReportChunk) UnmarshalBinary(data []byte) error {
+	*c = ReportChunk{}
+	d := &decoder{data: data}
+	return d.fields(func(field int) (err error) {
+		switch field {
+		case 1:
+			c.Name, err = d.string()
+		case 2:
+			var b []byte
+			b, err = d.bytes()
+			c.Data = append(c.Data, b...)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+// IngestResponse is the result of Ingest, see dmarc.v1.IngestResponse.
+type IngestResponse struct {
+	Saved    []string // Names of stored reports
+	Skipped  []string // Reasons for skipped files
+	Warnings []string // Problems of saved reports, e.g. inverted date ranges
+	Codes    []string // Codes of the reasons in Skipped, see dmark.ErrorCode
+}
+
+func (r *IngestResponse) MarshalBinary() ([]byte, error) {
+	e := encoder{}
+	for _, s := range r.Saved {
+		e.repeatedString(1, s)
+	}
+	for _, s := range r.Skipped {
+		e.repeatedString(2, s)
+	}
+	for _, s := range r.Warnings {
+		e.repeatedString(3, s)
+	}
+	for _, s := range r.Codes {
+		e.repeatedString(4, s)
+	}
+	return e.buf, nil
+}
+
+func (r *IngestResponse) UnmarshalBinary(data []byte) error {
+	*r = IngestResponse{}
+	d := &decoder{data: data}
+	return d.fields(func(field int) (err error) {
+		var s string
+		switch field {
+		case 1:
+			s, err = d.string()
+			r.Saved = append(r.Saved, s)
+		case 2:
+			s, err = d.string()
+			r.Skipped = append(r.Skipped, s)
+		case 3:
+			s, err = d.string()
+			r.Warnings = append(r.Warnings, s)
+		case 4:
+			s, err = d.string()
+			r.Codes = append(r.Codes, s)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+// SummaryRequest selects daily counts to return by Query, see dmarc.v1.SummaryRequest.
+type SummaryRequest struct {
+	Domain   string    // All domains combined when empty
+	From, To time.Time // Zero times mean no bound
+}
+
+func (r *SummaryRequest) MarshalBinary() ([]byte, error) {
+	e := encoder{}
+	e.string(1, r.Domain)
+	e.int(2, unixTime(r.From))
+	e.int(3, unixTime(r.To))
+	return e.buf, nil
+}
+
+func (r *SummaryRequest) UnmarshalBinary(data []byte) error {
+	*r = SummaryRequest{}
+	d := &decoder{data: data}
+	return d.fields(func(field int) (err error) {
+		var v int64
+		switch field {
+		case 1:
+			r.Domain, err = d.string()
+		case 2:
+			v, err = d.int()
+			r.From = fromUnix(v)
+		case 3:
+			v, err = d.int()
+			r.To = fromUnix(v)
+		default:
+			err = d.skip()
+		}
+		return err
+	})
+}
+
+// SummaryResponse holds daily counts sorted by day, see dmarc.v1.SummaryResponse.
+type SummaryResponse struct {
+	Days []store.DomainDay
+}
+
+func (r *SummaryResponse) MarshalBinary() ([]byte, error) {
+	e := encoder{}
+	for _, day := range r.Days {
+		e.message(1, true, func(e *encoder) {
+			e.int(1, unixTime(day.Day))
+			e.string(2, day.Domain)
+			e.message(3, false, func(e *encoder) {
+				e.int(1, int64(day.Messages))
+				e.int(2, int64(day.Passed))
+				e.int(3, int64(day.DKIMPassed))
+				e.int(4, int64(day.SPFPassed))
+				e.int(5, int64(day.Quarantined))
+				e.int(6, int64(day.Rejected))
+			})
+		})
+	}
+	return e.buf, nil
+}
+
+func (r *SummaryResponse) UnmarshalBinary(data []byte) error {
+	*r = SummaryResponse{}
+	d := &decoder{data: data}
+	return d.fields(func(field int) (err error) {
+		if field != 1 {
+			return d.skip()
+		}
+
+		day := store.DomainDay{}
+		err = d.message(func(d *decoder) error {
+			return d.fields(func(field int) (err error) {
+				var v int64
+				switch field {
+				case 1:
+					v, err = d.int()
+					day.Day = fromUnix(v)
+				case 2:
+					day.Domain, err = d.string()
+				case 3:
+					err = d.message(func(d *decoder) error {
+						return decodeCounts(d, &day.Counts)
+					})
+				default:
+					err = d.skip()
+				}
+				return err
+			})
+		})
+		r.Days = append(r.Days, day)
+		return err
+	})
+}
+
+func decodeCounts(d *decoder, c *dmark.Counts) error {
+	counts := map[int]*int{
+		1: &c.Messages,
+		2: &c.Passed,
+		3: &c.DKIMPassed,
+		4: &c.SPFPassed,
+		5: &c.Quarantined,
+		6: &c.Rejected,
+	}
+	return d.fields(func(field int) error {
+		count, ok := counts[field]
+		if !ok {
+			return d.skip()
+		}
+		v, err := d.int()
+		*count = int(v)
+		return err
+	})
+}
+
+// unixTime returns t as Unix time, 0 for the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0).UTC()
+}
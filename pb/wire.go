@@ -0,0 +1,268 @@
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Wire types used by dmarc.proto.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder appends fields to buf. Zero values are skipped, as proto3 does.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) key(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.key(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+// int writes v in two's complement, like int32 and int64 proto fields.
+func (e *encoder) int(field int, v int64) {
+	e.uint(field, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *encoder) double(field int, v float64) {
+	if v == 0 && !math.Signbit(v) {
+		return
+	}
+	e.key(field, wireFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *encoder) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.key(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) string(field int, v string) {
+	if v != "" {
+		e.repeatedString(field, v)
+	}
+}
+
+// repeatedString writes an element of a repeated field, even when empty.
+func (e *encoder) repeatedString(field int, v string) {
+	e.key(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// message writes the fields written by fn as an embedded message.
+// Empty messages are skipped unless repeated, where they keep their place.
+func (e *encoder) message(field int, repeated bool, fn func(e *encoder)) {
+	sub := encoder{}
+	fn(&sub)
+	if len(sub.buf) == 0 && !repeated {
+		return
+	}
+	e.key(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(sub.buf)))
+	e.buf = append(e.buf, sub.buf...)
+}
+
+// stringMap writes a map<string, string> field with keys in sorted order.
+func (e *encoder) stringMap(field int, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		e.message(field, true, func(e *encoder) {
+			e.string(1, k)
+			e.string(2, m[k])
+		})
+	}
+}
+
+// decoder reads fields of a single message.
+type decoder struct {
+	data []byte
+	pos  int
+
+	wire int // Wire type of the field read last
+}
+
+// next reads the next field key, returning false at the end of the message.
+func (d *decoder) next() (field int, ok bool, err error) {
+	if d.pos == len(d.data) {
+		return 0, false, nil
+	}
+
+	key, err := d.varint()
+	if err != nil {
+		return 0, false, err
+	}
+	if key>>3 == 0 || key>>3 > math.MaxInt32 {
+		return 0, false, fmt.Errorf("invalid field number %d", key>>3)
+	}
+
+	d.wire = int(key & 7)
+	return int(key >> 3), true, nil
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errors.New("invalid varint")
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *decoder) expect(wire int) error {
+	if d.wire != wire {
+		return fmt.Errorf("unexpected wire type %d", d.wire)
+	}
+	return nil
+}
+
+func (d *decoder) uint() (uint64, error) {
+	if err := d.expect(wireVarint); err != nil {
+		return 0, err
+	}
+	return d.varint()
+}
+
+func (d *decoder) int() (int64, error) {
+	v, err := d.uint()
+	return int64(v), err
+}
+
+// int32 reads an int32 field, which other encoders may sign-extend to 64 bits.
+func (d *decoder) int32() (int, error) {
+	v, err := d.uint()
+	return int(int32(v)), err
+}
+
+func (d *decoder) bool() (bool, error) {
+	v, err := d.uint()
+	return v != 0, err
+}
+
+func (d *decoder) double() (float64, error) {
+	if err := d.expect(wireFixed64); err != nil {
+		return 0, err
+	}
+	if len(d.data)-d.pos < 8 {
+		return 0, errors.New("unexpected end of data")
+	}
+	v := binary.LittleEndian.Uint64(d.data[d.pos:])
+	d.pos += 8
+	return math.Float64frombits(v), nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	if err := d.expect(wireBytes); err != nil {
+		return nil, err
+	}
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *decoder) string() (string, error) {
+	b, err := d.bytes()
+	return string(b), err
+}
+
+// message decodes an embedded message with fn.
+func (d *decoder) message(fn func(d *decoder) error) error {
+	b, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	return fn(&decoder{data: b})
+}
+
+// stringMapEntry reads an entry of a map<string, string> field into m.
+func (d *decoder) stringMapEntry(m map[string]string) error {
+	var k, v string
+	err := d.message(func(d *decoder) error {
+		return d.fields(func(field int) (err error) {
+			switch field {
+			case 1:
+				k, err = d.string()
+			case 2:
+				v, err = d.string()
+			default:
+				err = d.skip()
+			}
+			return err
+		})
+	})
+	m[k] = v
+	return err
+}
+
+// fields calls fn for every field of the message. fn has to read or skip the value.
+func (d *decoder) fields(fn func(field int) error) error {
+	for {
+		field, ok, err := d.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err = fn(field); err != nil {
+			return fmt.Errorf("field %d: %w", field, err)
+		}
+	}
+}
+
+// skip reads a value of an unknown field.
+func (d *decoder) skip() error {
+	switch d.wire {
+	case wireVarint:
+		_, err := d.varint()
+		return err
+	case wireBytes:
+		_, err := d.bytes()
+		return err
+	case wireFixed64, wireFixed32:
+		size := 8
+		if d.wire == wireFixed32 {
+			size = 4
+		}
+		if len(d.data)-d.pos < size {
+			return errors.New("unexpected end of data")
+		}
+		d.pos += size
+		return nil
+	}
+
+	return fmt.Errorf("unsupported wire type %d", d.wire)
+}
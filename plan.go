@@ -0,0 +1,314 @@
+package dmark
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// Reasons messages of a source fail DMARC under the target policy, see PlanSender.
+const (
+	PlanStrictAlignment = "strict alignment" // Aligned in relaxed mode only: sign with, or send from, the From domain itself
+	PlanUnaligned       = "unaligned"        // DKIM or SPF passed for another domain: sign with d= of the From domain, or send from it
+	PlanUnauthenticated = "unauthenticated"  // Neither DKIM nor SPF passed: authorize the source, or stop it sending as the domain
+	PlanForwarded       = "forwarded"        // Likely forwarded mail the domain owner cannot fix, see ForwardingDetector
+)
+
+// PlanThreshold is the default pass rate, from 0 to 1, of mail sent directly
+// required before publishing a step quarantining or rejecting messages.
+const PlanThreshold = 0.98
+
+// planPcts are pct values enforcing steps go through, see Plan.
+var planPcts = []int{10, 25, 50, 100}
+
+// PolicyPlan tells what moving a policy domain to the target policy would do,
+// and how to get there, see Plan.
+type PolicyPlan struct {
+	Domain    string          `json:"domain"`
+	Current   PolicyPublished `json:"current"` // The policy from the most recent report
+	Target    PolicyPublished `json:"target"`
+	Messages  int             `json:"messages"`
+	Failing   int             `json:"failing"`   // Messages failing DMARC under alignment of the target
+	Forwarded int             `json:"forwarded"` // Failing messages likely forwarded, not in Senders
+	Senders   []PlanSender    `json:"senders"`   // Sources to fix first, most failing messages first
+	Steps     []PlanStep      `json:"steps"`     // Policies to publish in turn, the last one being the target; none when it is reached
+}
+
+// PlanSender is a source of messages failing DMARC under the target policy.
+type PlanSender struct {
+	SourceIP   net.IP `json:"source_ip"`
+	HeaderFrom string `json:"header_from"` // Of most of its failing messages
+	Messages   int    `json:"messages"`
+	Failing    int    `json:"failing"`
+	Reason     string `json:"reason"` // Why most of its messages fail, one of Plan* reasons
+}
+
+// PlanStep is a policy to publish on the way to the target one, with the
+// messages it would quarantine or reject estimated from the reports.
+type PlanStep struct {
+	Policy      PolicyPublished `json:"policy"`
+	PassRate    float64         `json:"pass_rate"`   // Of mail sent directly under alignment of the step, from 0 to 1
+	Threshold   float64         `json:"threshold"`   // PassRate to reach before publishing the step, 0 when it enforces nothing
+	Quarantined int             `json:"quarantined"` // Failing messages quarantined, including those sampled out of reject by pct
+	Rejected    int             `json:"rejected"`
+}
+
+// Ready reports whether the pass rate is at the threshold of the step.
+func (s PlanStep) Ready() bool {
+	return s.PassRate >= s.Threshold
+}
+
+// Plan compares the reports of each policy domain against the target
+// policy, which may raise p, pct and alignment modes: which messages would
+// fail, which sources to fix first, and the steps to roll the policy out in.
+// Alignment is tightened first, keeping the published policy, then p goes
+// from quarantine to reject through pct of 10, 25, 50 and 100, with sp of
+// the target, or p when sp is stricter.
+// Steps enforcing a policy wait for threshold, the pass rate of mail sent
+// directly, as forwarded mail detected by forwarding fails whatever the
+// domain owner does; forwarding may be nil. Plans are sorted by domain.
+func Plan(reports []Feedback, target PolicyPublished, threshold float64, forwarding *ForwardingDetector) []PolicyPlan {
+	byDomain := map[string][]Feedback{}
+	for _, report := range reports {
+		domain := strings.ToLower(report.PolicyPublished.Domain)
+		byDomain[domain] = append(byDomain[domain], report)
+	}
+
+	summary := Summarize(reports)
+	plans := make([]PolicyPlan, 0, len(summary.Domains))
+	for _, d := range summary.Domains {
+		target := target
+		target.Domain = d.Domain
+		if target.Pct == 0 || target.Pct > 100 {
+			target.Pct = 100
+		}
+
+		plan := PolicyPlan{
+			Domain:   d.Domain,
+			Current:  d.Policy,
+			Target:   target,
+			Messages: d.Messages,
+			Senders:  []PlanSender{},
+		}
+		plan.Failing, plan.Forwarded, plan.Senders = planSenders(byDomain[d.Domain], target, forwarding)
+		plan.Steps = planSteps(byDomain[d.Domain], d.Policy, target, threshold, forwarding)
+		plans = append(plans, plan)
+	}
+
+	return plans
+}
+
+// planSenders aggregates sources of messages failing under the policy, but
+// forwarded ones, returning them with counts of failing and forwarded messages.
+func planSenders(reports []Feedback, policy PolicyPublished, forwarding *ForwardingDetector) (int, int, []PlanSender) {
+	failing, forwarded := 0, 0
+	senders := map[string]*PlanSender{}
+	reasons := map[string]map[string]int{} // Per source IP, failing messages by reason
+	froms := map[string]map[string]int{}   // Per source IP, failing messages by header_from
+
+	for _, report := range reports {
+		for _, record := range report.Records {
+			ip := record.Row.SourceIP.String()
+			sender, ok := senders[ip]
+			if !ok {
+				sender = &PlanSender{SourceIP: record.Row.SourceIP}
+				senders[ip] = sender
+				reasons[ip] = map[string]int{}
+				froms[ip] = map[string]int{}
+			}
+			sender.Messages += record.Row.Count
+
+			if planPasses(record, report.PolicyPublished, policy) {
+				continue
+			}
+			failing += record.Row.Count
+			reason := planReason(record, policy, forwarding)
+			if reason == PlanForwarded {
+				forwarded += record.Row.Count
+				continue
+			}
+			sender.Failing += record.Row.Count
+			reasons[ip][reason] += record.Row.Count
+			froms[ip][strings.ToLower(record.fromDomain(report.PolicyPublished))] += record.Row.Count
+		}
+	}
+
+	result := []PlanSender{}
+	for ip, sender := range senders {
+		if sender.Failing == 0 {
+			continue
+		}
+		sender.Reason = mostCounted(reasons[ip])
+		sender.HeaderFrom = mostCounted(froms[ip])
+		result = append(result, *sender)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Failing != result[j].Failing {
+			return result[i].Failing > result[j].Failing
+		}
+		return result[i].SourceIP.String() < result[j].SourceIP.String()
+	})
+
+	return failing, forwarded, result
+}
+
+// planSteps lists policies between the current and the target one.
+func planSteps(reports []Feedback, current, target PolicyPublished, threshold float64, forwarding *ForwardingDetector) []PlanStep {
+	p := current.P
+	if p == 0 || p == DispositionUnknown {
+		p = DispositionNone
+	}
+	pct := current.Pct
+	if pct == 0 || pct > 100 {
+		pct = 100
+	}
+
+	policies := []PolicyPublished{}
+	if stricter(target.ADKIM, current.ADKIM) || stricter(target.ASPF, current.ASPF) {
+		policy := current
+		policy.ADKIM, policy.ASPF, policy.P, policy.Pct = target.ADKIM, target.ASPF, p, pct
+		policies = append(policies, policy)
+	}
+	for _, disp := range []Disposition{DispositionQuarantine, DispositionReject} {
+		if disp > target.P || disp < p {
+			continue
+		}
+		for _, stepPct := range planPcts {
+			if disp == target.P && stepPct > target.Pct {
+				stepPct = target.Pct
+			}
+			if disp == p && stepPct <= pct {
+				continue
+			}
+			policies = append(policies, planPolicy(target, disp, stepPct))
+			if disp == target.P && stepPct == target.Pct {
+				break
+			}
+		}
+	}
+
+	steps := make([]PlanStep, 0, len(policies))
+	for _, policy := range policies {
+		steps = append(steps, planStep(reports, policy, threshold, forwarding))
+	}
+
+	return steps
+}
+
+// planPolicy returns the target policy with p and pct of a step;
+// sp follows p up to sp of the target, when the target has one.
+func planPolicy(target PolicyPublished, p Disposition, pct int) PolicyPublished {
+	policy := target
+	policy.P, policy.Pct = p, pct
+	if target.SP > p {
+		policy.SP = p
+	}
+
+	return policy
+}
+
+// planStep estimates what publishing the policy would do to messages of the reports.
+func planStep(reports []Feedback, policy PolicyPublished, threshold float64, forwarding *ForwardingDetector) PlanStep {
+	step := PlanStep{Policy: policy}
+	direct, passed := 0, 0
+	failing := map[Disposition]int{}
+	for _, report := range reports {
+		for _, record := range report.Records {
+			pass := planPasses(record, report.PolicyPublished, policy)
+			if pass || planReason(record, policy, forwarding) != PlanForwarded {
+				direct += record.Row.Count
+				if pass {
+					passed += record.Row.Count
+				}
+			}
+			if !pass {
+				failing[policy.PolicyFor(record.fromDomain(report.PolicyPublished), false)] += record.Row.Count
+			}
+		}
+	}
+
+	if direct > 0 {
+		step.PassRate = float64(passed) / float64(direct)
+	}
+
+	// messages sampled out by pct get the next less strict policy (RFC 7489 Section 6.6.4)
+	quarantined := sampled(failing[DispositionQuarantine], policy.Pct)
+	rejected := sampled(failing[DispositionReject], policy.Pct)
+	step.Quarantined = quarantined + failing[DispositionReject] - rejected
+	step.Rejected = rejected
+	if step.Quarantined+step.Rejected > 0 {
+		step.Threshold = threshold
+	}
+
+	return step
+}
+
+// planPasses reports whether the record passes DMARC under the policy. Records
+// are evaluated again from auth_results when its alignment modes differ from
+// those of the reported policy, and trusted as reported otherwise.
+func planPasses(record Record, reported, policy PolicyPublished) bool {
+	if reported.ADKIM == policy.ADKIM && reported.ASPF == policy.ASPF {
+		evaluated := record.Row.PolicyEvaluated
+		return bool(evaluated.DKIM || evaluated.SPF)
+	}
+
+	policy.Domain = reported.Domain
+	if _, ok := record.DKIMAligned(policy); ok {
+		return true
+	}
+	_, ok := record.SPFAligned(policy)
+	return ok
+}
+
+// planReason tells why the record fails DMARC under the policy, one of Plan* reasons.
+func planReason(record Record, policy PolicyPublished, forwarding *ForwardingDetector) string {
+	if forwarding != nil {
+		if _, ok := forwarding.Forwarded(record, policy); ok {
+			return PlanForwarded
+		}
+	}
+
+	relaxed := policy
+	relaxed.ADKIM, relaxed.ASPF = AlignmentRelaxed, AlignmentRelaxed
+	if _, ok := record.DKIMAligned(relaxed); ok {
+		return PlanStrictAlignment
+	}
+	if _, ok := record.SPFAligned(relaxed); ok {
+		return PlanStrictAlignment
+	}
+
+	for _, result := range record.AuthResult.DKIM {
+		if result.Result == DKIMResultPass {
+			return PlanUnaligned
+		}
+	}
+	for _, result := range record.AuthResult.SPF {
+		if result.Result == SPFResultPass {
+			return PlanUnaligned
+		}
+	}
+
+	return PlanUnauthenticated
+}
+
+// stricter reports whether the alignment mode a is stricter than b; relaxed is the default.
+func stricter(a, b Alignment) bool {
+	return a == AlignmentStrict && b != AlignmentStrict
+}
+
+// sampled returns the share of messages pct applies to.
+func sampled(messages, pct int) int {
+	return (messages*pct + 50) / 100
+}
+
+// mostCounted returns the key with the largest count, the first by name on ties.
+func mostCounted(counts map[string]int) string {
+	most := ""
+	for key, count := range counts {
+		if most == "" || count > counts[most] || (count == counts[most] && key < most) {
+			most = key
+		}
+	}
+
+	return most
+}
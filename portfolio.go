@@ -0,0 +1,102 @@
+package dmark
+
+import (
+	"strings"
+	"time"
+)
+
+// Trends of the pass rate of a domain, see PortfolioDomain.
+const (
+	TrendUp   = "up"
+	TrendDown = "down"
+	TrendFlat = "flat"
+)
+
+// trendThreshold is the change of the pass rate, from 0 to 1, under which the trend is flat.
+const trendThreshold = 0.01
+
+// PortfolioDomain is where a policy domain stands, a row of Portfolio.
+type PortfolioDomain struct {
+	Counts
+	Domain   string          `json:"domain"`
+	Policy   PolicyPublished `json:"policy"` // The policy from the most recent report
+	Reports  int             `json:"reports"`
+	Score    Score           `json:"score"`
+	Recent   Counts          `json:"recent"`          // Of the last window days
+	Previous Counts          `json:"previous"`        // Of the window days before them
+	Trend    string          `json:"trend,omitempty"` // TrendUp, TrendDown or TrendFlat of the pass rate; empty without messages in either period
+}
+
+// Arrow returns an arrow of the trend, empty when it is unknown.
+func (d PortfolioDomain) Arrow() string {
+	switch d.Trend {
+	case TrendUp:
+		return "↑"
+	case TrendDown:
+		return "↓"
+	case TrendFlat:
+		return "→"
+	}
+	return ""
+}
+
+// Portfolio summarizes each policy domain of the reports, for those monitoring
+// many domains: counts and scores like Summarize, and the trend of the pass
+// rate over the last window days against the window days before them.
+// Days are UTC days reports begin, see DailyCounts; the last day is that of
+// the latest report of all domains, so domains no longer reported trend
+// against the rest. Domains are sorted by name, like Summary.Domains.
+func Portfolio(reports []Feedback, window int) []PortfolioDomain {
+	byDomain := map[string][]Feedback{}
+	var last time.Time
+	for _, report := range reports {
+		domain := strings.ToLower(report.PolicyPublished.Domain)
+		byDomain[domain] = append(byDomain[domain], report)
+
+		begin, _ := report.ReportMetadata.DateRange.Times()
+		if day := begin.UTC().Truncate(24 * time.Hour); day.After(last) {
+			last = day
+		}
+	}
+	recentFrom := last.AddDate(0, 0, 1-window)
+	previousFrom := recentFrom.AddDate(0, 0, -window)
+
+	summary := Summarize(reports)
+	portfolio := make([]PortfolioDomain, 0, len(summary.Domains))
+	for _, d := range summary.Domains {
+		domain := PortfolioDomain{
+			Counts:  d.Counts,
+			Domain:  d.Domain,
+			Policy:  d.Policy,
+			Reports: d.Reports,
+			Score:   d.Score,
+		}
+		for _, day := range DailyCounts(byDomain[d.Domain]) {
+			switch {
+			case !day.Day.Before(recentFrom):
+				domain.Recent.Merge(day.Counts)
+			case !day.Day.Before(previousFrom):
+				domain.Previous.Merge(day.Counts)
+			}
+		}
+		domain.Trend = trend(domain.Previous, domain.Recent)
+		portfolio = append(portfolio, domain)
+	}
+
+	return portfolio
+}
+
+func trend(previous, recent Counts) string {
+	if previous.Messages == 0 || recent.Messages == 0 {
+		return ""
+	}
+
+	change := recent.PassRate() - previous.PassRate()
+	switch {
+	case change >= trendThreshold:
+		return TrendUp
+	case change <= -trendThreshold:
+		return TrendDown
+	}
+	return TrendFlat
+}
@@ -0,0 +1,153 @@
+package dmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// QuirkProfile describes known deviations of a reporter from RFC 7489
+// and the fixes Parser applies to its reports. Enum values are matched
+// ignoring case for all reporters, so casing needs no profile.
+type QuirkProfile struct {
+	Name     string   `json:"name"`
+	OrgNames []string `json:"org_names,omitempty"` // Matched against org_name, ignoring case
+	Emails   []string `json:"emails,omitempty"`    // Addresses, or domains of addresses, matched against email
+
+	Version          float64 `json:"version,omitempty"`           // Version to set when it is missing
+	InheritSP        bool    `json:"inherit_sp,omitempty"`        // Set a missing sp to p, as receivers apply p to subdomains then
+	DefaultAlignment bool    `json:"default_alignment,omitempty"` // Set missing adkim and aspf to relaxed, the default
+	NoneSelector     bool    `json:"none_selector,omitempty"`     // Clear DKIM selectors reported as "none"
+	LowercaseDomains bool    `json:"lowercase_domains,omitempty"` // Lower-case domains of identifiers and auth results
+}
+
+// DefaultQuirks are profiles of reporters known to deviate from the schema,
+// used by parsers without their own. Commands add profiles with -quirks.
+var DefaultQuirks = []QuirkProfile{
+	{
+		Name:      "yahoo",
+		OrgNames:  []string{"Yahoo", "Yahoo! Inc."},
+		Emails:    []string{"yahoo.com", "yahooinc.com"},
+		Version:   1,
+		InheritSP: true,
+	},
+	{
+		Name:             "microsoft",
+		OrgNames:         []string{"Enterprise Outlook", "Outlook.com"},
+		Emails:           []string{"microsoft.com"},
+		Version:          1,
+		DefaultAlignment: true,
+		LowercaseDomains: true,
+	},
+	{
+		Name:         "mail.ru",
+		OrgNames:     []string{"Mail.Ru"},
+		Emails:       []string{"corp.mail.ru"},
+		NoneSelector: true,
+	},
+}
+
+// LoadQuirks reads a JSON array of profiles from a file and returns them
+// with DefaultQuirks; a profile with the name of a default one replaces it.
+func LoadQuirks(path string) ([]QuirkProfile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file %q: %w", path, err)
+	}
+
+	loaded := []QuirkProfile{}
+	if err = json.Unmarshal(content, &loaded); err != nil {
+		return nil, fmt.Errorf("parse quirks %q: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for _, profile := range loaded {
+		names[strings.ToLower(profile.Name)] = true
+	}
+
+	result := []QuirkProfile{}
+	for _, profile := range DefaultQuirks {
+		if !names[strings.ToLower(profile.Name)] {
+			result = append(result, profile)
+		}
+	}
+
+	return append(result, loaded...), nil
+}
+
+// Matches reports whether the profile applies to reports with the metadata.
+func (q QuirkProfile) Matches(meta ReportMetadata) bool {
+	for _, name := range q.OrgNames {
+		if strings.EqualFold(strings.TrimSpace(meta.OrgName), name) {
+			return true
+		}
+	}
+
+	email := strings.ToLower(strings.TrimSpace(meta.Email))
+	for _, e := range q.Emails {
+		e = strings.ToLower(e)
+		if email == e || strings.HasSuffix(email, "@"+e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply fixes the report as the profile says.
+func (q QuirkProfile) Apply(f *Feedback) {
+	if f.Version == 0 {
+		f.Version = q.Version
+	}
+
+	pp := &f.PolicyPublished
+	if q.InheritSP && pp.SP == 0 {
+		pp.SP = pp.P
+	}
+	if q.DefaultAlignment {
+		if pp.ADKIM == 0 {
+			pp.ADKIM = AlignmentRelaxed
+		}
+		if pp.ASPF == 0 {
+			pp.ASPF = AlignmentRelaxed
+		}
+	}
+
+	for i := range f.Records {
+		r := &f.Records[i]
+		if q.LowercaseDomains {
+			r.Identifiers.HeaderFrom = strings.ToLower(r.Identifiers.HeaderFrom)
+			r.Identifiers.EnvelopeFrom = strings.ToLower(r.Identifiers.EnvelopeFrom)
+			r.Identifiers.EnvelopeTo = strings.ToLower(r.Identifiers.EnvelopeTo)
+		}
+		for j := range r.AuthResult.DKIM {
+			dkim := &r.AuthResult.DKIM[j]
+			if q.LowercaseDomains {
+				dkim.Domain = strings.ToLower(dkim.Domain)
+			}
+			if q.NoneSelector && strings.EqualFold(dkim.Selector, "none") {
+				dkim.Selector = ""
+			}
+		}
+		if q.LowercaseDomains {
+			for j := range r.AuthResult.SPF {
+				r.AuthResult.SPF[j].Domain = strings.ToLower(r.AuthResult.SPF[j].Domain)
+			}
+		}
+	}
+}
+
+// applyQuirks applies the profiles of the Parser matching the reporter.
+func (p *Parser) applyQuirks(f *Feedback) {
+	profiles := p.Quirks
+	if profiles == nil {
+		profiles = DefaultQuirks
+	}
+
+	for _, profile := range profiles {
+		if profile.Matches(f.ReportMetadata) {
+			profile.Apply(f)
+		}
+	}
+}
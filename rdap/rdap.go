@@ -0,0 +1,227 @@
+// Package rdap looks up the networks of IP addresses with the Registration Data
+// Access Protocol (RFC 9082, RFC 9083): their owner, abuse contacts and country,
+// finding the registry to ask with the IANA bootstrap files (RFC 9224).
+package rdap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BootstrapURLs are the IANA bootstrap files of registries serving IPv4 and IPv6 networks.
+var BootstrapURLs = []string{
+	"https://data.iana.org/rdap/ipv4.json",
+	"https://data.iana.org/rdap/ipv6.json",
+}
+
+// defaultTTL is how long looked up networks are cached for.
+const defaultTTL = 7 * 24 * time.Hour
+
+// Network is the registered network containing an IP address.
+type Network struct {
+	Handle        string   `json:"handle"`
+	Name          string   `json:"name"`
+	Range         string   `json:"range"`   // "<start address> - <end address>"
+	Owner         string   `json:"owner"`   // The registrant
+	Country       string   `json:"country"` // The country the network is allocated to, if the registry tells
+	AbuseContacts []string `json:"abuse_contacts"`
+}
+
+// Client looks up networks, caching them in files.
+type Client struct {
+	HTTP     *http.Client  // http.DefaultClient when nil
+	CacheDir string        // Networks are not cached when empty
+	TTL      time.Duration // Seven days when zero
+
+	mu       sync.Mutex
+	services []service // From the bootstrap files, fetched once
+}
+
+// service is a registry RDAP service and the networks it serves.
+type service struct {
+	nets []*net.IPNet
+	url  string
+}
+
+// DefaultCacheDir returns the dmark/rdap directory in the user cache directory.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "dmark", "rdap")
+}
+
+// Lookup returns the network of the IP address.
+func (c *Client) Lookup(ctx context.Context, ip net.IP) (*Network, error) {
+	if network, ok := c.cached(ip); ok {
+		return network, nil
+	}
+
+	base, err := c.serviceURL(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ipNetwork
+	if err = c.get(ctx, strings.TrimSuffix(base, "/")+"/ip/"+ip.String(), &resp); err != nil {
+		return nil, err
+	}
+
+	network := resp.network()
+	c.cache(ip, network)
+
+	return network, nil
+}
+
+// serviceURL returns the base URL of the RDAP service of the registry of ip.
+func (c *Client) serviceURL(ctx context.Context, ip net.IP) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.services == nil {
+		for _, u := range BootstrapURLs {
+			var bootstrap struct {
+				Services [][][]string `json:"services"`
+			}
+			if err := c.get(ctx, u, &bootstrap); err != nil {
+				return "", fmt.Errorf("bootstrap: %w", err)
+			}
+			for _, entry := range bootstrap.Services {
+				if len(entry) < 2 {
+					continue
+				}
+				s := service{url: httpsURL(entry[1])}
+				for _, cidr := range entry[0] {
+					if _, n, err := net.ParseCIDR(cidr); err == nil {
+						s.nets = append(s.nets, n)
+					}
+				}
+				if s.url != "" {
+					c.services = append(c.services, s)
+				}
+			}
+		}
+	}
+
+	// the longest matching prefix wins
+	url, longest := "", -1
+	for _, s := range c.services {
+		for _, n := range s.nets {
+			if ones, _ := n.Mask.Size(); n.Contains(ip) && ones > longest {
+				url, longest = s.url, ones
+			}
+		}
+	}
+	if url == "" {
+		return "", fmt.Errorf("no RDAP service for %s", ip)
+	}
+
+	return url, nil
+}
+
+// httpsURL returns the first HTTPS URL, or else the first URL.
+func httpsURL(urls []string) string {
+	for _, u := range urls {
+		if strings.HasPrefix(u, "https://") {
+			return u
+		}
+	}
+	if len(urls) > 0 {
+		return urls[0]
+	}
+
+	return ""
+}
+
+func (c *Client) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: %s", url, resp.Status)
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", url, err)
+	}
+
+	return nil
+}
+
+// cacheEntry is a network cached in a file.
+type cacheEntry struct {
+	Fetched time.Time `json:"fetched"`
+	Network *Network  `json:"network"`
+}
+
+func (c *Client) cachePath(ip net.IP) string {
+	sum := sha256.Sum256([]byte(ip.String()))
+	return filepath.Join(c.CacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func (c *Client) cached(ip net.IP) (*Network, bool) {
+	if c.CacheDir == "" {
+		return nil, false
+	}
+
+	content, err := ioutil.ReadFile(c.cachePath(ip))
+	if err != nil {
+		return nil, false
+	}
+	entry := cacheEntry{}
+	if err = json.Unmarshal(content, &entry); err != nil || entry.Network == nil {
+		return nil, false
+	}
+
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	if time.Since(entry.Fetched) > ttl {
+		return nil, false
+	}
+
+	return entry.Network, true
+}
+
+// cache writes the network to the cache; failures only cost a lookup next time.
+func (c *Client) cache(ip net.IP, network *Network) {
+	if c.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		return
+	}
+
+	content, err := json.Marshal(cacheEntry{Fetched: time.Now(), Network: network})
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(c.cachePath(ip), content, 0644)
+}
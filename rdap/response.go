@@ -0,0 +1,94 @@
+package rdap
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ipNetwork is an IP network object class (RFC 9083 Section 5.4).
+type ipNetwork struct {
+	Handle       string   `json:"handle"`
+	Name         string   `json:"name"`
+	StartAddress string   `json:"startAddress"`
+	EndAddress   string   `json:"endAddress"`
+	Country      string   `json:"country"`
+	Entities     []entity `json:"entities"`
+}
+
+// entity is an entity object class (RFC 9083 Section 5.1), with its contact as a jCard (RFC 7095).
+type entity struct {
+	Handle     string            `json:"handle"`
+	Roles      []string          `json:"roles"`
+	VCardArray []json.RawMessage `json:"vcardArray"`
+	Entities   []entity          `json:"entities"`
+}
+
+func (n ipNetwork) network() *Network {
+	network := &Network{
+		Handle:        n.Handle,
+		Name:          n.Name,
+		Country:       n.Country,
+		AbuseContacts: []string{},
+	}
+	if n.StartAddress != "" {
+		network.Range = n.StartAddress + " - " + n.EndAddress
+	}
+
+	seen := map[string]bool{}
+	var walk func(entities []entity)
+	walk = func(entities []entity) {
+		for _, e := range entities {
+			if e.hasRole("registrant") && network.Owner == "" {
+				network.Owner = e.property("fn")
+			}
+			if e.hasRole("abuse") {
+				if email := strings.ToLower(e.property("email")); email != "" && !seen[email] {
+					seen[email] = true
+					network.AbuseContacts = append(network.AbuseContacts, email)
+				}
+			}
+			walk(e.Entities)
+		}
+	}
+	walk(n.Entities)
+
+	return network
+}
+
+func (e entity) hasRole(role string) bool {
+	for _, r := range e.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// property returns the first text value of the jCard property:
+//
+//	["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example"]]]
+func (e entity) property(name string) string {
+	if len(e.VCardArray) < 2 {
+		return ""
+	}
+
+	var properties [][]json.RawMessage
+	if err := json.Unmarshal(e.VCardArray[1], &properties); err != nil {
+		return ""
+	}
+	for _, p := range properties {
+		if len(p) < 4 {
+			continue
+		}
+		var key, value string
+		if json.Unmarshal(p[0], &key) != nil || !strings.EqualFold(key, name) {
+			continue
+		}
+		if json.Unmarshal(p[3], &value) == nil {
+			return value
+		}
+	}
+
+	return ""
+}
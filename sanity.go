@@ -0,0 +1,94 @@
+package dmark
+
+import (
+	"fmt"
+)
+
+// Problems found by CheckReport.
+const (
+	ProblemZeroCount        = "zero count"           // Record of no messages
+	ProblemStricter         = "stricter than policy" // Disposition stricter than the published policy, without an override reason
+	ProblemPassNotNone      = "passed but not none"  // DMARC passed, yet disposition is not none, without an override reason
+	ProblemPolicyNotApplied = "policy not applied"   // DMARC failed under a policy for all messages, yet disposition is none, without an override reason
+)
+
+// Inconsistency describes a record contradicting the policy published in
+// its report, or itself. Such records are likely caused by reporter bugs.
+type Inconsistency struct {
+	Problem     string      `json:"problem"`
+	OrgName     string      `json:"org_name"`
+	ReportID    string      `json:"report_id"`
+	Domain      string      `json:"domain"`
+	Record      int         `json:"record"` // Index of the record in the report
+	SourceIP    string      `json:"source_ip"`
+	Disposition Disposition `json:"disposition"`
+	Policy      Disposition `json:"policy"` // Published policy for the header From domain of the record
+}
+
+func (i Inconsistency) String() string {
+	return fmt.Sprintf(
+		"report %q of %s for %s: record %d from %s: %s, disposition %s under policy %s",
+		i.ReportID, i.OrgName, i.Domain, i.Record, i.SourceIP, i.Problem, textOf(i.Disposition), textOf(i.Policy),
+	)
+}
+
+// CheckReport returns inconsistencies of records of the report with its published policy.
+// Records with override reasons are only checked for their counts, as receivers
+// may apply local policies then.
+func CheckReport(report *Feedback) []Inconsistency {
+	result := []Inconsistency{}
+	policy := report.PolicyPublished
+
+	for i, record := range report.Records {
+		evaluated := record.Row.PolicyEvaluated
+		from := record.fromDomain(policy)
+		// existence of subdomains is not reported, take the more lenient
+		// and the stricter of sp and np
+		lenient, strict := policy.PolicyFor(from, false), policy.PolicyFor(from, true)
+		if strict < lenient {
+			lenient, strict = strict, lenient
+		}
+
+		add := func(problem string, published Disposition) {
+			result = append(result, Inconsistency{
+				Problem:     problem,
+				OrgName:     report.ReportMetadata.OrgName,
+				ReportID:    report.ReportMetadata.ReportID,
+				Domain:      policy.Domain,
+				Record:      i,
+				SourceIP:    record.Row.SourceIP.String(),
+				Disposition: evaluated.Disposition,
+				Policy:      published,
+			})
+		}
+
+		if record.Row.Count == 0 {
+			add(ProblemZeroCount, lenient)
+		}
+		if len(evaluated.Reason) > 0 || evaluated.Disposition < DispositionNone || lenient < DispositionNone {
+			continue
+		}
+
+		passed := bool(evaluated.DKIM || evaluated.SPF)
+		switch {
+		case passed && evaluated.Disposition != DispositionNone:
+			add(ProblemPassNotNone, strict)
+		case evaluated.Disposition > strict:
+			add(ProblemStricter, strict)
+		case !passed && evaluated.Disposition == DispositionNone && lenient > DispositionNone && policy.Pct == 100:
+			add(ProblemPolicyNotApplied, lenient)
+		}
+	}
+
+	return result
+}
+
+// CheckReports returns inconsistencies of all reports, see CheckReport.
+func CheckReports(reports []Feedback) []Inconsistency {
+	result := []Inconsistency{}
+	for i := range reports {
+		result = append(result, CheckReport(&reports[i])...)
+	}
+
+	return result
+}
@@ -0,0 +1,195 @@
+// Package schedule runs commands periodically, like fetching reports from
+// a mailbox every 15 minutes or sending a digest on Mondays at 09:00,
+// so a server needs no crontab next to it.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is a command run on a schedule.
+type Job struct {
+	Name    string   `json:"name"`
+	Every   string   `json:"every"`   // Interval, e.g. "15m"; or
+	Cron    string   `json:"cron"`    // Crontab expression, e.g. "0 9 * * mon"
+	Command []string `json:"command"` // Program and its arguments, e.g. ["reports2html", "-r", "./reports"]
+	Dir     string   `json:"dir"`     // Working directory, the server's when empty
+	Timeout string   `json:"timeout"` // Kills the command after this long, e.g. "10m"; no limit when empty
+
+	schedule Schedule
+	timeout  time.Duration
+	fn       func(ctx context.Context) error // Called instead of running Command, see FuncJob
+}
+
+// Load reads jobs from a JSON file: {"jobs": [{"name": ..., "every": ..., "command": [...]}]}.
+func Load(path string) ([]Job, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schedule: %w", err)
+	}
+
+	file := struct {
+		Jobs []Job `json:"jobs"`
+	}{}
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("decode schedule: %w", err)
+	}
+
+	names := map[string]bool{}
+	for i := range file.Jobs {
+		job := &file.Jobs[i]
+		if job.Name == "" {
+			job.Name = strings.Join(job.Command, " ")
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("duplicate job %q", job.Name)
+		}
+		names[job.Name] = true
+
+		if err = job.init(); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+	}
+
+	return file.Jobs, nil
+}
+
+// FuncJob returns a job calling fn on the schedule of every or cron, one of
+// which is set like in Job, for programs scheduling their own work, like
+// reports2email sending digests. Calls are bounded by timeout when it is set.
+func FuncJob(name, every, cron, timeout string, fn func(ctx context.Context) error) (Job, error) {
+	job := Job{Name: name, Every: every, Cron: cron, Timeout: timeout, fn: fn}
+	if err := job.init(); err != nil {
+		return job, fmt.Errorf("job %q: %w", name, err)
+	}
+
+	return job, nil
+}
+
+func (j *Job) init() error {
+	if len(j.Command) == 0 && j.fn == nil {
+		return errors.New("no command")
+	}
+
+	switch {
+	case j.Every != "" && j.Cron != "":
+		return errors.New("both every and cron are set")
+	case j.Every != "":
+		d, err := time.ParseDuration(j.Every)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("invalid interval %q, want at least 1m", j.Every)
+		}
+		j.schedule = Every(d)
+	case j.Cron != "":
+		c, err := ParseCron(j.Cron)
+		if err != nil {
+			return err
+		}
+		j.schedule = c
+	default:
+		return errors.New("neither every nor cron is set")
+	}
+
+	if j.Timeout != "" {
+		d, err := time.ParseDuration(j.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", j.Timeout)
+		}
+		j.timeout = d
+	}
+
+	return nil
+}
+
+// Run runs jobs on their schedules until ctx is done, evaluating cron
+// expressions in loc (local time when nil). A job still running when
+// it is due again is skipped that time. Command output goes to the
+// server's stdout and stderr. Run waits for running commands before returning.
+func Run(ctx context.Context, jobs []Job, loc *time.Location) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	wg := sync.WaitGroup{}
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			job.loop(ctx, loc)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (j Job) loop(ctx context.Context, loc *time.Location) {
+	// commands are run by this goroutine, so runs never overlap
+	next := j.schedule.Next(time.Now().In(loc))
+	for !next.IsZero() {
+		slog.Debug("Job scheduled", "job", j.Name, "at", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		j.run(ctx)
+
+		next = j.schedule.Next(time.Now().In(loc))
+	}
+
+	slog.Warn("Job never runs again", "job", j.Name)
+}
+
+func (j Job) run(ctx context.Context) {
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+
+	if j.fn != nil {
+		slog.Info("Running job", "job", j.Name)
+		start := time.Now()
+		if err := j.fn(ctx); err != nil {
+			slog.Error("Job failed", "job", j.Name, "duration", time.Since(start).Round(time.Millisecond), "err", err)
+			return
+		}
+		slog.Info("Job finished", "job", j.Name, "duration", time.Since(start).Round(time.Millisecond))
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, j.Command[0], j.Command[1:]...)
+	cmd.Dir = j.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// let the command exit on its own when the server stops
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 10 * time.Second
+
+	slog.Info("Running job", "job", j.Name)
+	start := time.Now()
+	err := cmd.Run()
+	if err != nil && ctx.Err() != nil && cmd.ProcessState != nil && cmd.ProcessState.Success() {
+		// exited on its own after the interrupt
+		slog.Info("Job stopped", "job", j.Name, "duration", time.Since(start).Round(time.Millisecond), "reason", ctx.Err())
+		return
+	}
+	if err != nil {
+		slog.Error("Job failed", "job", j.Name, "duration", time.Since(start).Round(time.Millisecond), "err", err)
+		return
+	}
+	slog.Info("Job finished", "job", j.Name, "duration", time.Since(start).Round(time.Millisecond))
+}
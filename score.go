@@ -0,0 +1,71 @@
+package dmark
+
+// Maximum points of each Score component.
+const (
+	scorePassRate  = 40
+	scorePolicy    = 30
+	scoreAlignment = 10
+	scoreSources   = 20
+)
+
+// Score rates DMARC compliance of a domain from 0 to 100.
+type Score struct {
+	Total     int `json:"total"`
+	PassRate  int `json:"pass_rate"` // Up to 40 points for the share of messages passing DMARC
+	Policy    int `json:"policy"`    // Up to 30 points for p and sp strictness, scaled by pct
+	Alignment int `json:"alignment"` // Up to 10 points for strict DKIM and SPF alignment
+	Sources   int `json:"sources"`   // Up to 20 points for the share of messages from known sources
+}
+
+// ComplianceScore rates a domain by its published policy, counts of its messages,
+// and the number of messages from unknown sources: sources with no message passing DMARC.
+func ComplianceScore(policy PolicyPublished, counts Counts, unknownMessages int) Score {
+	score := Score{
+		PassRate:  int(counts.PassRate()*scorePassRate + 0.5),
+		Policy:    policyPoints(policy),
+		Alignment: alignmentPoints(policy.ADKIM) + alignmentPoints(policy.ASPF),
+	}
+
+	if counts.Messages > 0 {
+		known := float64(counts.Messages-unknownMessages) / float64(counts.Messages)
+		score.Sources = int(known*scoreSources + 0.5)
+	}
+
+	score.Total = score.PassRate + score.Policy + score.Alignment + score.Sources
+	return score
+}
+
+// policyPoints gives two thirds of policy points for p and one third for sp.
+func policyPoints(policy PolicyPublished) int {
+	sp := policy.SP
+	if sp == 0 {
+		sp = policy.P // sp defaults to p
+	}
+
+	pct := policy.Pct
+	if pct == 0 || pct > 100 {
+		pct = 100 // pct defaults to 100
+	}
+
+	points := dispositionPoints(policy.P)*2/3 + dispositionPoints(sp)/3
+	return int(points*float64(pct)/100 + 0.5)
+}
+
+func dispositionPoints(disp Disposition) float64 {
+	switch disp {
+	case DispositionReject:
+		return scorePolicy
+	case DispositionQuarantine:
+		return scorePolicy * 0.6
+	}
+
+	return 0
+}
+
+func alignmentPoints(alignment Alignment) int {
+	if alignment == AlignmentStrict {
+		return scoreAlignment / 2
+	}
+
+	return scoreAlignment / 5 // relaxed is the default
+}
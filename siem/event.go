@@ -0,0 +1,69 @@
+// Package siem emits DMARC failures as syslog (RFC 5424), CEF or LEEF events
+// for security information and event management systems.
+package siem
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Event is a failing record with normalized fields.
+type Event struct {
+	Time         time.Time // The report date range begin
+	Domain       string    // The policy domain
+	OrgName      string    // The reporting organization
+	ReportID     string
+	SourceIP     net.IP
+	Count        int
+	HeaderFrom   string
+	EnvelopeFrom string
+	Disposition  string // none, quarantine or reject
+	DKIM         string // DMARC-aligned DKIM result, pass or fail
+	SPF          string // DMARC-aligned SPF result, pass or fail
+	DKIMDomains  []string
+	SPFDomains   []string
+	Explanation  string
+}
+
+// Events returns an event per record failing DMARC.
+func Events(reports []dmark.Feedback) []Event {
+	events := []Event{}
+	for _, report := range reports {
+		for i, flat := range dmark.Flatten(report) {
+			if flat.DMARC == "pass" {
+				continue
+			}
+
+			record := report.Records[i]
+			events = append(events, Event{
+				Time:         flat.Begin,
+				Domain:       flat.Domain,
+				OrgName:      flat.OrgName,
+				ReportID:     flat.ReportID,
+				SourceIP:     record.Row.SourceIP,
+				Count:        flat.Count,
+				HeaderFrom:   strings.ToLower(flat.HeaderFrom),
+				EnvelopeFrom: strings.ToLower(flat.EnvelopeFrom),
+				Disposition:  flat.Disposition,
+				DKIM:         flat.DKIM,
+				SPF:          flat.SPF,
+				DKIMDomains:  flat.DKIMResults,
+				SPFDomains:   flat.SPFResults,
+				Explanation:  record.Explain(report.PolicyPublished),
+			})
+		}
+	}
+
+	return events
+}
+
+// severity returns the syslog severity: warning for rejected messages, notice otherwise.
+func (e Event) severity() int {
+	if e.Disposition == "reject" {
+		return 4
+	}
+	return 5
+}
@@ -0,0 +1,153 @@
+package siem
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format renders an event as a message body.
+type Format func(e Event) string
+
+// Formats by name.
+var Formats = map[string]Format{
+	"syslog": SyslogMessage,
+	"cef":    CEF,
+	"leef":   LEEF,
+}
+
+const (
+	vendor  = "chuhlomin"
+	product = "dmark-go"
+	version = "1.0"
+	eventID = "dmarc-fail"
+
+	// sdID is the structured data ID, with the enterprise number reserved for examples (RFC 5612).
+	sdID = "dmarc@32473"
+)
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`)
+
+// SyslogMessage renders the event as RFC 5424 structured data followed by the explanation.
+func SyslogMessage(e Event) string {
+	params := [][2]string{
+		{"domain", e.Domain},
+		{"org", e.OrgName},
+		{"report_id", e.ReportID},
+		{"src", e.SourceIP.String()},
+		{"count", strconv.Itoa(e.Count)},
+		{"header_from", e.HeaderFrom},
+		{"envelope_from", e.EnvelopeFrom},
+		{"disposition", e.Disposition},
+		{"dkim", e.DKIM},
+		{"spf", e.SPF},
+		{"dkim_domains", strings.Join(e.DKIMDomains, ",")},
+		{"spf_domains", strings.Join(e.SPFDomains, ",")},
+	}
+
+	var b strings.Builder
+	b.WriteString("[" + sdID)
+	for _, p := range params {
+		b.WriteString(" " + p[0] + `="` + sdEscaper.Replace(p[1]) + `"`)
+	}
+	b.WriteString("] " + e.Explanation)
+
+	return b.String()
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// CEF renders the event in ArcSight Common Event Format.
+func CEF(e Event) string {
+	header := []string{
+		"CEF:0", vendor, product, version, eventID,
+		"DMARC failure for " + e.Domain,
+		strconv.Itoa(10 - e.severity()), // CEF severity grows from 0 to 10
+	}
+	for i := range header[1:] {
+		header[i+1] = cefHeaderEscaper.Replace(header[i+1])
+	}
+
+	extensions := [][2]string{
+		{"rt", strconv.FormatInt(e.Time.Unix()*1000, 10)},
+		{"src", e.SourceIP.String()},
+		{"cnt", strconv.Itoa(e.Count)},
+		{"act", e.Disposition},
+		{"dhost", e.Domain},
+		{"suser", e.EnvelopeFrom},
+		{"duser", e.HeaderFrom},
+		{"cs1Label", "reporter"},
+		{"cs1", e.OrgName},
+		{"cs2Label", "reportId"},
+		{"cs2", e.ReportID},
+		{"cs3Label", "dkimResults"},
+		{"cs3", strings.Join(e.DKIMDomains, ",")},
+		{"cs4Label", "spfResults"},
+		{"cs4", strings.Join(e.SPFDomains, ",")},
+		{"msg", e.Explanation},
+	}
+
+	parts := []string{}
+	for _, ext := range extensions {
+		parts = append(parts, ext[0]+"="+cefExtensionEscaper.Replace(ext[1]))
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(parts, " ")
+}
+
+var leefEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// LEEF renders the event in IBM QRadar Log Event Extended Format 1.0.
+func LEEF(e Event) string {
+	attributes := [][2]string{
+		{"devTime", e.Time.Format("Jan 02 2006 15:04:05")},
+		{"devTimeFormat", "MMM dd yyyy HH:mm:ss"},
+		{"src", e.SourceIP.String()},
+		{"sev", strconv.Itoa(10 - e.severity())},
+		{"count", strconv.Itoa(e.Count)},
+		{"domain", e.Domain},
+		{"reporter", e.OrgName},
+		{"reportId", e.ReportID},
+		{"sender", e.EnvelopeFrom},
+		{"headerFrom", e.HeaderFrom},
+		{"disposition", e.Disposition},
+		{"dkimResults", strings.Join(e.DKIMDomains, ",")},
+		{"spfResults", strings.Join(e.SPFDomains, ",")},
+		{"msg", e.Explanation},
+	}
+
+	parts := []string{}
+	for _, attr := range attributes {
+		parts = append(parts, attr[0]+"="+leefEscaper.Replace(attr[1]))
+	}
+
+	return fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|", vendor, product, version, eventID) + strings.Join(parts, "\t")
+}
+
+// facility is local0.
+const facility = 16
+
+// Syslog wraps a message body into an RFC 5424 syslog message.
+// Bodies not starting with structured data get an empty one.
+func Syslog(e Event, hostname, body string) string {
+	if hostname == "" {
+		hostname = "-"
+	}
+	if !strings.HasPrefix(body, "[") {
+		body = "- " + body
+	}
+
+	return fmt.Sprintf(
+		"<%d>1 %s %s %s - %s %s",
+		facility*8+e.severity(),
+		e.Time.Format(time.RFC3339),
+		hostname,
+		product,
+		eventID,
+		body,
+	)
+}
@@ -0,0 +1,72 @@
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Sender sends syslog messages over UDP, TCP or TLS.
+// Over TCP and TLS, messages are framed with octet counting (RFC 6587).
+type Sender struct {
+	conn   net.Conn
+	stream bool
+}
+
+// Dial connects to a syslog collector; network is udp, tcp or tls.
+func Dial(ctx context.Context, network, address string, config *tls.Config) (*Sender, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch network {
+	case "udp", "tcp":
+		conn, err = (&net.Dialer{}).DialContext(ctx, network, address)
+	case "tls":
+		conn, err = (&tls.Dialer{Config: config}).DialContext(ctx, "tcp", address)
+	default:
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dial %s %q: %w", network, address, err)
+	}
+
+	return &Sender{conn: conn, stream: network != "udp"}, nil
+}
+
+// Send sends a single message, giving up at the ctx deadline
+// or when ctx is cancelled.
+func (s *Sender) Send(ctx context.Context, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	message = strings.TrimRight(message, "\n")
+	if s.stream {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return fmt.Errorf("set deadline: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// a deadline in the past unblocks a pending write
+		s.conn.SetWriteDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	_, err := s.conn.Write([]byte(message))
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Close closes the connection.
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
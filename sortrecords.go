@@ -0,0 +1,115 @@
+package dmark
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// RecordOrder reports whether record a sorts before record b.
+type RecordOrder func(a, b Record) bool
+
+// Record orders, ascending; see RecordOrder.Desc. Unlike the KeyFunc of the
+// same field, OrderBySourceIP compares addresses numerically.
+var (
+	OrderByCount       RecordOrder = func(a, b Record) bool { return a.Row.Count < b.Row.Count }
+	OrderBySourceIP    RecordOrder = func(a, b Record) bool { return compareIPs(a.Row.SourceIP, b.Row.SourceIP) < 0 }
+	OrderByDisposition RecordOrder = func(a, b Record) bool {
+		return a.Row.PolicyEvaluated.Disposition < b.Row.PolicyEvaluated.Disposition
+	}
+	OrderByHeaderFrom RecordOrder = func(a, b Record) bool {
+		return strings.ToLower(a.Identifiers.HeaderFrom) < strings.ToLower(b.Identifiers.HeaderFrom)
+	}
+)
+
+// DefaultRecordOrder puts records of most messages first, then orders
+// by source IP, header From domain and disposition.
+var DefaultRecordOrder = []RecordOrder{OrderByCount.Desc(), OrderBySourceIP, OrderByHeaderFrom, OrderByDisposition}
+
+// recordOrders are names of orders for ParseRecordOrder.
+var recordOrders = map[string]RecordOrder{
+	"count":       OrderByCount,
+	"source_ip":   OrderBySourceIP,
+	"disposition": OrderByDisposition,
+	"header_from": OrderByHeaderFrom,
+}
+
+// Desc returns the reverse order.
+func (o RecordOrder) Desc() RecordOrder {
+	return func(a, b Record) bool { return o(b, a) }
+}
+
+// SortRecords sorts records by the orders, records equal by one order
+// by the next one, then by DefaultRecordOrder, so the result does not
+// depend on the order reporters listed records in. Records equal by
+// all orders keep their order.
+func SortRecords(records []Record, orders ...RecordOrder) {
+	orders = append(orders[:len(orders):len(orders)], DefaultRecordOrder...)
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, less := range orders {
+			switch {
+			case less(records[i], records[j]):
+				return true
+			case less(records[j], records[i]):
+				return false
+			}
+		}
+		return false
+	})
+}
+
+// ParseRecordOrder parses comma-separated order names, each optionally
+// followed by "desc", e.g. "count desc,source_ip". Names are count,
+// source_ip, disposition and header_from.
+func ParseRecordOrder(spec string) ([]RecordOrder, error) {
+	result := []RecordOrder{}
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Fields(strings.ToLower(part))
+		if len(fields) == 0 {
+			continue
+		}
+
+		order, ok := recordOrders[fields[0]]
+		if !ok || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid record order %q, want count, source_ip, disposition or header_from, optionally followed by asc or desc", strings.TrimSpace(part))
+		}
+		if len(fields) == 2 {
+			switch fields[1] {
+			case "asc":
+			case "desc":
+				order = order.Desc()
+			default:
+				return nil, fmt.Errorf("invalid direction %q of record order %q, want asc or desc", fields[1], fields[0])
+			}
+		}
+		result = append(result, order)
+	}
+
+	return result, nil
+}
+
+// compareIPs compares addresses with IPv4 ones first, missing ones last.
+func compareIPs(a, b net.IP) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	a4, b4 := a.To4(), b.To4()
+	switch {
+	case a4 != nil && b4 != nil:
+		return bytes.Compare(a4, b4)
+	case a4 != nil:
+		return -1
+	case b4 != nil:
+		return 1
+	}
+
+	return bytes.Compare(a.To16(), b.To16())
+}
@@ -0,0 +1,332 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// maxLookups is the limit of mechanisms and modifiers causing DNS lookups (RFC 7208 Section 4.6.4).
+const maxLookups = 10
+
+// ErrNoRecord is returned by Lookup when the domain publishes no SPF record.
+var ErrNoRecord = errors.New("no SPF record")
+
+// Checker looks up and evaluates SPF records.
+type Checker struct {
+	Resolver *net.Resolver // net.DefaultResolver when nil
+}
+
+// Lookup fetches and parses the SPF record of the domain.
+func Lookup(ctx context.Context, domain string) (*Record, error) {
+	return (&Checker{}).Lookup(ctx, domain)
+}
+
+// Check evaluates the SPF record of the domain for the IP address, see Checker.Check.
+func Check(ctx context.Context, ip net.IP, domain string) (dmark.SPFResult, error) {
+	return (&Checker{}).Check(ctx, ip, domain)
+}
+
+func (c *Checker) resolver() *net.Resolver {
+	if c.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return c.Resolver
+}
+
+// Lookup fetches and parses the SPF record of the domain.
+func (c *Checker) Lookup(ctx context.Context, domain string) (*Record, error) {
+	record, _, err := c.lookup(ctx, domain)
+	return record, err
+}
+
+// lookup also returns the SPF result for lookup errors:
+// none without a record, temperror on DNS errors and permerror on invalid records.
+func (c *Checker) lookup(ctx context.Context, domain string) (*Record, dmark.SPFResult, error) {
+	txts, err := c.resolver().LookupTXT(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, dmark.SPFResultNone, ErrNoRecord
+		}
+		return nil, dmark.SPFResultTempError, fmt.Errorf("lookup TXT %q: %w", domain, err)
+	}
+
+	found := []string{}
+	for _, txt := range txts {
+		if strings.EqualFold(txt, "v=spf1") || strings.HasPrefix(strings.ToLower(txt), "v=spf1 ") {
+			found = append(found, txt)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, dmark.SPFResultNone, ErrNoRecord
+	case 1:
+		record, err := Parse(found[0])
+		if err != nil {
+			return nil, dmark.SPFResultPermError, err
+		}
+		return record, 0, nil
+	}
+
+	return nil, dmark.SPFResultPermError, fmt.Errorf("%d SPF records for %q", len(found), domain)
+}
+
+// Check evaluates the SPF record of the domain for the IP address.
+// SPFResultPass means the IP is authorized to send mail for the domain.
+// On errors, the result is SPFResultTempError or SPFResultPermError.
+func (c *Checker) Check(ctx context.Context, ip net.IP, domain string) (dmark.SPFResult, error) {
+	ch := &check{Checker: c, ip: ip, sender: domain}
+	return ch.evaluate(ctx, domain)
+}
+
+// check holds the state of a single Check call.
+type check struct {
+	*Checker
+	ip      net.IP
+	sender  string
+	lookups int
+}
+
+func (ch *check) countLookup() error {
+	ch.lookups++
+	if ch.lookups > maxLookups {
+		return fmt.Errorf("more than %d DNS lookups", maxLookups)
+	}
+	return nil
+}
+
+func (ch *check) evaluate(ctx context.Context, domain string) (dmark.SPFResult, error) {
+	record, result, err := ch.Checker.lookup(ctx, domain)
+	if err == ErrNoRecord {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	for _, m := range record.Mechanisms {
+		matched, result, err := ch.match(ctx, m, domain)
+		if err != nil {
+			return result, fmt.Errorf("%s in %q: %w", m, domain, err)
+		}
+		if matched {
+			return qualifierResult(m.Qualifier), nil
+		}
+	}
+
+	if record.Redirect != "" {
+		if err := ch.countLookup(); err != nil {
+			return dmark.SPFResultPermError, err
+		}
+		target, err := ch.expand(record.Redirect, domain)
+		if err != nil {
+			return dmark.SPFResultPermError, err
+		}
+		result, err := ch.evaluate(ctx, target)
+		if result == dmark.SPFResultNone {
+			return dmark.SPFResultPermError, fmt.Errorf("redirect to %q without SPF record", target)
+		}
+		return result, err
+	}
+
+	return dmark.SPFResultNeutral, nil
+}
+
+// match reports whether the mechanism matches the IP,
+// on errors it also returns the result to return.
+func (ch *check) match(ctx context.Context, m Mechanism, domain string) (bool, dmark.SPFResult, error) {
+	target := domain
+	if m.Domain != "" {
+		expanded, err := ch.expand(m.Domain, domain)
+		if err != nil {
+			return false, dmark.SPFResultPermError, err
+		}
+		target = expanded
+	}
+
+	switch m.Kind {
+	case "all":
+		return true, 0, nil
+
+	case "ip4", "ip6":
+		return m.Net.Contains(ch.ip), 0, nil
+
+	case "include":
+		if err := ch.countLookup(); err != nil {
+			return false, dmark.SPFResultPermError, err
+		}
+		result, err := ch.evaluate(ctx, target)
+		switch result {
+		case dmark.SPFResultPass:
+			return true, 0, nil
+		case dmark.SPFResultFail, dmark.SPFResultSoftFail, dmark.SPFResultNeutral:
+			return false, 0, nil
+		case dmark.SPFResultNone:
+			return false, dmark.SPFResultPermError, fmt.Errorf("include of %q without SPF record", target)
+		}
+		return false, result, err
+
+	case "a":
+		if err := ch.countLookup(); err != nil {
+			return false, dmark.SPFResultPermError, err
+		}
+		matched, err := ch.matchHost(ctx, target, m.Prefix4, m.Prefix6)
+		if err != nil {
+			return false, dmark.SPFResultTempError, err
+		}
+		return matched, 0, nil
+
+	case "mx":
+		if err := ch.countLookup(); err != nil {
+			return false, dmark.SPFResultPermError, err
+		}
+		mxs, err := ch.resolver().LookupMX(ctx, target)
+		if err != nil && !isNotFound(err) {
+			return false, dmark.SPFResultTempError, err
+		}
+		for _, mx := range mxs {
+			matched, err := ch.matchHost(ctx, mx.Host, m.Prefix4, m.Prefix6)
+			if err != nil {
+				return false, dmark.SPFResultTempError, err
+			}
+			if matched {
+				return true, 0, nil
+			}
+		}
+		return false, 0, nil
+
+	case "exists":
+		if err := ch.countLookup(); err != nil {
+			return false, dmark.SPFResultPermError, err
+		}
+		addrs, err := ch.resolver().LookupIPAddr(ctx, target)
+		if err != nil && !isNotFound(err) {
+			return false, dmark.SPFResultTempError, err
+		}
+		return len(addrs) > 0, 0, nil
+
+	case "ptr":
+		if err := ch.countLookup(); err != nil {
+			return false, dmark.SPFResultPermError, err
+		}
+		names, _ := ch.resolver().LookupAddr(ctx, ch.ip.String())
+		for _, name := range names {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			target = strings.ToLower(target)
+			if name != target && !strings.HasSuffix(name, "."+target) {
+				continue
+			}
+			// the name must resolve back to the IP
+			if matched, _ := ch.matchHost(ctx, name, 32, 128); matched {
+				return true, 0, nil
+			}
+		}
+		return false, 0, nil
+	}
+
+	return false, dmark.SPFResultPermError, fmt.Errorf("unknown mechanism %q", m.Kind)
+}
+
+func (ch *check) matchHost(ctx context.Context, host string, prefix4, prefix6 int) (bool, error) {
+	addrs, err := ch.resolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, addr := range addrs {
+		mask := net.CIDRMask(prefix6, 128)
+		if addr.IP.To4() != nil {
+			mask = net.CIDRMask(prefix4, 32)
+		}
+		if (&net.IPNet{IP: addr.IP.Mask(mask), Mask: mask}).Contains(ch.ip) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// expand expands macros (RFC 7208 Section 7) without transformers,
+// which are rarely used in practice.
+func (ch *check) expand(spec, domain string) (string, error) {
+	if !strings.Contains(spec, "%") {
+		return spec, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			b.WriteByte(spec[i])
+			continue
+		}
+		if i+1 >= len(spec) {
+			return "", fmt.Errorf("invalid macro in %q", spec)
+		}
+
+		i++
+		switch spec[i] {
+		case '%':
+			b.WriteByte('%')
+			continue
+		case '_':
+			b.WriteByte(' ')
+			continue
+		case '-':
+			b.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", fmt.Errorf("invalid macro in %q", spec)
+		}
+
+		end := strings.IndexByte(spec[i:], '}')
+		if end != 2 {
+			return "", fmt.Errorf("unsupported macro in %q", spec)
+		}
+		switch spec[i+1] {
+		case 'd', 'o', 'h':
+			b.WriteString(domain)
+		case 's':
+			b.WriteString("postmaster@" + ch.sender)
+		case 'l':
+			b.WriteString("postmaster")
+		case 'i':
+			b.WriteString(ch.ip.String())
+		case 'v':
+			if ch.ip.To4() != nil {
+				b.WriteString("in-addr")
+			} else {
+				b.WriteString("ip6")
+			}
+		default:
+			return "", fmt.Errorf("unsupported macro in %q", spec)
+		}
+		i += end
+	}
+
+	return b.String(), nil
+}
+
+func qualifierResult(q Qualifier) dmark.SPFResult {
+	switch q {
+	case QualifierFail:
+		return dmark.SPFResultFail
+	case QualifierSoftFail:
+		return dmark.SPFResultSoftFail
+	case QualifierNeutral:
+		return dmark.SPFResultNeutral
+	}
+	return dmark.SPFResultPass
+}
+
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
@@ -0,0 +1,178 @@
+// Package spf fetches and evaluates SPF records (RFC 7208),
+// to tell whether a source IP from a DMARC report is authorized to send for a domain.
+package spf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Qualifier is the result of a matching mechanism.
+type Qualifier byte
+
+const (
+	QualifierPass     Qualifier = '+'
+	QualifierFail     Qualifier = '-'
+	QualifierSoftFail Qualifier = '~'
+	QualifierNeutral  Qualifier = '?'
+)
+
+// Mechanism is a single SPF mechanism, e.g. "-all" or "ip4:192.0.2.0/24".
+type Mechanism struct {
+	Qualifier Qualifier
+	Kind      string     // all, include, a, mx, ptr, ip4, ip6 or exists
+	Domain    string     // For include, a, mx, ptr and exists; the checked domain when empty
+	Net       *net.IPNet // For ip4 and ip6
+	Prefix4   int        // CIDR prefix length for a and mx, 32 when not set
+	Prefix6   int        // CIDR prefix length for a and mx, 128 when not set
+}
+
+func (m Mechanism) String() string {
+	s := ""
+	if m.Qualifier != QualifierPass {
+		s = string(m.Qualifier)
+	}
+	s += m.Kind
+
+	switch {
+	case m.Net != nil:
+		s += ":" + m.Net.String()
+	case m.Domain != "":
+		s += ":" + m.Domain
+	}
+	if m.Prefix4 != 32 && (m.Kind == "a" || m.Kind == "mx") {
+		s += "/" + strconv.Itoa(m.Prefix4)
+	}
+	if m.Prefix6 != 128 && (m.Kind == "a" || m.Kind == "mx") {
+		s += "//" + strconv.Itoa(m.Prefix6)
+	}
+
+	return s
+}
+
+// Record is a parsed SPF record.
+type Record struct {
+	Mechanisms []Mechanism
+	Redirect   string // The redirect= modifier
+	Exp        string // The exp= modifier
+}
+
+// Parse parses the text of an SPF record, starting with "v=spf1".
+func Parse(text string) (*Record, error) {
+	terms := strings.Fields(text)
+	if len(terms) == 0 || !strings.EqualFold(terms[0], "v=spf1") {
+		return nil, fmt.Errorf("not an SPF record: %q", text)
+	}
+
+	record := &Record{}
+	for _, term := range terms[1:] {
+		if name, value, ok := cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+			switch strings.ToLower(name) {
+			case "redirect":
+				record.Redirect = value
+			case "exp":
+				record.Exp = value
+			}
+			// unknown modifiers must be ignored
+			continue
+		}
+
+		m, err := parseMechanism(term)
+		if err != nil {
+			return nil, err
+		}
+		record.Mechanisms = append(record.Mechanisms, m)
+	}
+
+	return record, nil
+}
+
+func parseMechanism(term string) (Mechanism, error) {
+	m := Mechanism{Qualifier: QualifierPass, Prefix4: 32, Prefix6: 128}
+
+	switch Qualifier(term[0]) {
+	case QualifierPass, QualifierFail, QualifierSoftFail, QualifierNeutral:
+		m.Qualifier = Qualifier(term[0])
+		term = term[1:]
+	}
+
+	kind, value, hasValue := cut(term, ":")
+	if !hasValue {
+		// "a/24" and "mx//64" have prefixes without a domain
+		if i := strings.Index(kind, "/"); i >= 0 {
+			kind, value = kind[:i], kind[i:]
+		}
+	}
+	m.Kind = strings.ToLower(kind)
+
+	switch m.Kind {
+	case "all":
+		if value != "" {
+			return m, fmt.Errorf("unexpected value in %q", term)
+		}
+
+	case "ip4", "ip6":
+		if !strings.Contains(value, "/") {
+			if m.Kind == "ip4" {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return m, fmt.Errorf("parse %q: %w", term, err)
+		}
+		m.Net = ipNet
+
+	case "a", "mx":
+		domain, prefix4, prefix6, err := parseDualCIDR(value)
+		if err != nil {
+			return m, fmt.Errorf("parse %q: %w", term, err)
+		}
+		m.Domain, m.Prefix4, m.Prefix6 = domain, prefix4, prefix6
+
+	case "include", "exists":
+		if value == "" {
+			return m, fmt.Errorf("missing domain in %q", term)
+		}
+		m.Domain = value
+
+	case "ptr":
+		m.Domain = value
+
+	default:
+		return m, fmt.Errorf("unknown mechanism %q", term)
+	}
+
+	return m, nil
+}
+
+// parseDualCIDR parses "domain/24//64", where all parts are optional.
+func parseDualCIDR(value string) (domain string, prefix4, prefix6 int, err error) {
+	prefix4, prefix6 = 32, 128
+
+	if i := strings.Index(value, "//"); i >= 0 {
+		if prefix6, err = strconv.Atoi(value[i+2:]); err != nil || prefix6 > 128 {
+			return "", 0, 0, fmt.Errorf("invalid IPv6 prefix length %q", value[i+2:])
+		}
+		value = value[:i]
+	}
+	if i := strings.Index(value, "/"); i >= 0 {
+		if prefix4, err = strconv.Atoi(value[i+1:]); err != nil || prefix4 > 32 {
+			return "", 0, 0, fmt.Errorf("invalid IPv4 prefix length %q", value[i+1:])
+		}
+		value = value[:i]
+	}
+
+	return value, prefix4, prefix6, nil
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,183 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// maxDepth limits nested includes and redirects expanded by Expand.
+const maxDepth = 10
+
+// Tree is the SPF record of a domain with the records it includes and
+// redirects to, and the addresses its mechanisms resolve to, see Checker.Expand.
+type Tree struct {
+	Domain   string
+	Record   *Record // Nil when Err is set
+	Err      error   // Of looking up or parsing the record
+	Terms    []Term  // Mechanisms of Record, in order
+	Redirect *Tree   // The record of the redirect= modifier
+}
+
+// Term is a mechanism of an expanded record.
+type Term struct {
+	Mechanism
+	Networks []*net.IPNet // Of ip4 and ip6, and the addresses a and mx resolve to
+	Include  *Tree        // The included record
+	Err      error        // Of resolving the mechanism; exists, ptr and macros are not resolved
+}
+
+// Expand fetches the SPF record of the domain and, recursively, records it
+// includes and redirects to, resolving a and mx mechanisms to their addresses,
+// for analysis: the number of DNS lookups it takes (see Tree.Lookups) and
+// what authorizes a source (see Tree.Match). Errors of nested records are kept
+// in the tree; only the error of the record of the domain is returned.
+func (c *Checker) Expand(ctx context.Context, domain string) (*Tree, error) {
+	tree := c.expandTree(ctx, domain, nil)
+	return tree, tree.Err
+}
+
+func (c *Checker) expandTree(ctx context.Context, domain string, parents []string) *Tree {
+	tree := &Tree{Domain: domain}
+	for _, parent := range parents {
+		if strings.EqualFold(parent, domain) {
+			tree.Err = fmt.Errorf("loop: %s includes itself", domain)
+			return tree
+		}
+	}
+	if len(parents) > maxDepth {
+		tree.Err = fmt.Errorf("more than %d nested records", maxDepth)
+		return tree
+	}
+	parents = append(parents, domain)
+
+	if tree.Record, _, tree.Err = c.lookup(ctx, domain); tree.Err != nil {
+		return tree
+	}
+
+	for _, m := range tree.Record.Mechanisms {
+		term := Term{Mechanism: m}
+		target := domain
+		if m.Domain != "" {
+			target = m.Domain
+		}
+
+		switch {
+		case m.Kind == "ip4" || m.Kind == "ip6":
+			term.Networks = []*net.IPNet{m.Net}
+		case m.Kind == "all":
+		case strings.Contains(target, "%"):
+			term.Err = errors.New("depends on the sender, macros are not expanded")
+		case m.Kind == "include":
+			term.Include = c.expandTree(ctx, target, parents)
+		case m.Kind == "a":
+			term.Networks, term.Err = c.resolveHost(ctx, target, m.Prefix4, m.Prefix6)
+		case m.Kind == "mx":
+			mxs, err := c.resolver().LookupMX(ctx, target)
+			if err != nil && !isNotFound(err) {
+				term.Err = err
+				break
+			}
+			for _, mx := range mxs {
+				networks, err := c.resolveHost(ctx, mx.Host, m.Prefix4, m.Prefix6)
+				if err != nil {
+					term.Err = err
+					break
+				}
+				term.Networks = append(term.Networks, networks...)
+			}
+		default:
+			term.Err = fmt.Errorf("%s depends on the sender, not resolved", m.Kind)
+		}
+		tree.Terms = append(tree.Terms, term)
+	}
+
+	if tree.Record.Redirect != "" && !strings.Contains(tree.Record.Redirect, "%") {
+		tree.Redirect = c.expandTree(ctx, tree.Record.Redirect, parents)
+	}
+
+	return tree
+}
+
+func (c *Checker) resolveHost(ctx context.Context, host string, prefix4, prefix6 int) ([]*net.IPNet, error) {
+	addrs, err := c.resolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	networks := []*net.IPNet{}
+	for _, addr := range addrs {
+		mask := net.CIDRMask(prefix6, 128)
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			addr.IP, mask = ip4, net.CIDRMask(prefix4, 32)
+		}
+		networks = append(networks, &net.IPNet{IP: addr.IP.Mask(mask), Mask: mask})
+	}
+
+	return networks, nil
+}
+
+// Lookups returns the number of DNS lookups evaluating the record may take,
+// counted against the limit of 10 (RFC 7208 Section 4.6.4): one for each
+// include, a, mx, ptr and exists mechanism and the redirect modifier, with
+// those of included records.
+func (t *Tree) Lookups() int {
+	if t == nil {
+		return 0
+	}
+
+	lookups := 0
+	for _, term := range t.Terms {
+		switch term.Kind {
+		case "include", "a", "mx", "ptr", "exists":
+			lookups += 1 + term.Include.Lookups()
+		}
+	}
+	if t.Record != nil && t.Record.Redirect != "" {
+		lookups += 1 + t.Redirect.Lookups()
+	}
+
+	return lookups
+}
+
+// Match evaluates the expanded record for the IP address like Checker.Check,
+// without DNS lookups: it returns the result with the path of mechanisms
+// deciding it, from an include of the record down to the matching mechanism,
+// nil when none matched. Mechanisms that were not resolved never match;
+// the lookup limit is not enforced.
+func (t *Tree) Match(ip net.IP) ([]*Term, dmark.SPFResult) {
+	if t == nil || t.Record == nil {
+		return nil, dmark.SPFResultNone
+	}
+
+	for i := range t.Terms {
+		term := &t.Terms[i]
+		switch term.Kind {
+		case "all":
+			return []*Term{term}, qualifierResult(term.Qualifier)
+		case "include":
+			if path, result := term.Include.Match(ip); result == dmark.SPFResultPass {
+				return append([]*Term{term}, path...), qualifierResult(term.Qualifier)
+			}
+		default:
+			for _, network := range term.Networks {
+				if network.Contains(ip) {
+					return []*Term{term}, qualifierResult(term.Qualifier)
+				}
+			}
+		}
+	}
+
+	if t.Redirect != nil {
+		return t.Redirect.Match(ip)
+	}
+
+	return nil, dmark.SPFResultNeutral
+}
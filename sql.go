@@ -0,0 +1,187 @@
+package dmark
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"fmt"
+	"net"
+)
+
+// Enum types and IP implement sql.Scanner and driver.Valuer, storing their
+// text, like "reject" or "pass", and NULL for absent values. Scanning also
+// accepts integers, the enum numbers.
+var (
+	_ driver.Valuer = Alignment(0)
+	_ driver.Valuer = Disposition(0)
+	_ driver.Valuer = Fo(0)
+	_ driver.Valuer = Result(false)
+	_ driver.Valuer = PolicyOverride(0)
+	_ driver.Valuer = DKIMResult(0)
+	_ driver.Valuer = SPFDomainScope(0)
+	_ driver.Valuer = SPFResult(0)
+	_ driver.Valuer = IP(nil)
+
+	_ sql.Scanner = (*Alignment)(nil)
+	_ sql.Scanner = (*Disposition)(nil)
+	_ sql.Scanner = (*Fo)(nil)
+	_ sql.Scanner = (*Result)(nil)
+	_ sql.Scanner = (*PolicyOverride)(nil)
+	_ sql.Scanner = (*DKIMResult)(nil)
+	_ sql.Scanner = (*SPFDomainScope)(nil)
+	_ sql.Scanner = (*SPFResult)(nil)
+	_ sql.Scanner = (*IP)(nil)
+)
+
+// sqlValue returns the text of v, nil when absent.
+func sqlValue(v encoding.TextMarshaler, absent bool) (driver.Value, error) {
+	if absent {
+		return nil, nil
+	}
+
+	text, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return string(text), nil
+}
+
+// scanEnum sets v from text with UnmarshalText, or from an integer with set.
+// NULL sets the zero value.
+func scanEnum(src interface{}, v encoding.TextUnmarshaler, set func(n int)) error {
+	switch src := src.(type) {
+	case nil:
+		set(0)
+		return nil
+	case string:
+		return v.UnmarshalText([]byte(src))
+	case []byte:
+		return v.UnmarshalText(src)
+	case int64:
+		set(int(src))
+		return nil
+	}
+
+	return fmt.Errorf("scan %T into %T", src, v)
+}
+
+func (a Alignment) Value() (driver.Value, error) {
+	return sqlValue(a, a == 0)
+}
+
+func (a *Alignment) Scan(src interface{}) error {
+	return scanEnum(src, a, func(n int) { *a = Alignment(n) })
+}
+
+func (disp Disposition) Value() (driver.Value, error) {
+	return sqlValue(disp, disp == 0)
+}
+
+func (disp *Disposition) Scan(src interface{}) error {
+	return scanEnum(src, disp, func(n int) { *disp = Disposition(n) })
+}
+
+// Value returns options like "0:d", NULL when none are set.
+func (fo Fo) Value() (driver.Value, error) {
+	return sqlValue(fo, fo == 0)
+}
+
+func (fo *Fo) Scan(src interface{}) error {
+	return scanEnum(src, fo, func(n int) { *fo = Fo(n) })
+}
+
+// Value returns "pass" or "fail"; the result is never absent.
+func (r Result) Value() (driver.Value, error) {
+	return sqlValue(r, false)
+}
+
+// Scan accepts booleans too, as drivers return them for boolean columns.
+func (r *Result) Scan(src interface{}) error {
+	if b, ok := src.(bool); ok {
+		*r = Result(b)
+		return nil
+	}
+
+	return scanEnum(src, r, func(n int) { *r = n != 0 })
+}
+
+func (po PolicyOverride) Value() (driver.Value, error) {
+	return sqlValue(po, po == 0)
+}
+
+func (po *PolicyOverride) Scan(src interface{}) error {
+	return scanEnum(src, po, func(n int) { *po = PolicyOverride(n) })
+}
+
+func (dkimr DKIMResult) Value() (driver.Value, error) {
+	return sqlValue(dkimr, dkimr == 0)
+}
+
+func (dkimr *DKIMResult) Scan(src interface{}) error {
+	return scanEnum(src, dkimr, func(n int) { *dkimr = DKIMResult(n) })
+}
+
+func (sds SPFDomainScope) Value() (driver.Value, error) {
+	return sqlValue(sds, sds == 0)
+}
+
+func (sds *SPFDomainScope) Scan(src interface{}) error {
+	return scanEnum(src, sds, func(n int) { *sds = SPFDomainScope(n) })
+}
+
+func (spfr SPFResult) Value() (driver.Value, error) {
+	return sqlValue(spfr, spfr == 0)
+}
+
+func (spfr *SPFResult) Scan(src interface{}) error {
+	return scanEnum(src, spfr, func(n int) { *spfr = SPFResult(n) })
+}
+
+// IP stores a net.IP in SQL databases as text, e.g. "192.0.2.1",
+// NULL when nil:
+//
+//	db.Exec("INSERT INTO records (source_ip) VALUES (?)", dmark.IP(record.Row.SourceIP))
+type IP net.IP
+
+func (ip IP) Value() (driver.Value, error) {
+	if ip == nil {
+		return nil, nil
+	}
+
+	return net.IP(ip).String(), nil
+}
+
+// Scan parses text, or takes 4 or 16 bytes as the binary form of the address
+// when they are not the text of one, e.g. from BINARY(16) columns.
+func (ip *IP) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*ip = nil
+		return nil
+	case string:
+		return ip.parse(src)
+	case []byte:
+		if parsed := net.ParseIP(string(src)); parsed != nil {
+			*ip = IP(parsed)
+			return nil
+		}
+		if len(src) == net.IPv4len || len(src) == net.IPv6len {
+			*ip = IP(append(net.IP{}, src...))
+			return nil
+		}
+		return ip.parse(string(src))
+	}
+
+	return fmt.Errorf("scan %T into %T", src, ip)
+}
+
+func (ip *IP) parse(text string) error {
+	parsed := net.ParseIP(text)
+	if parsed == nil {
+		return fmt.Errorf("invalid IP address %q", text)
+	}
+	*ip = IP(parsed)
+
+	return nil
+}
@@ -0,0 +1,424 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// boltFile is the BoltDB file of stores keeping raw reports in it, see OpenBolt.
+const boltFile = "reports.db"
+
+var (
+	reportsBucket = []byte("reports")   // name → raw report
+	metaBucket    = []byte("meta")      // name → boltMeta
+	domainIndex   = []byte("by_domain") // reversed domain, 0, begin, name → nothing
+	beginIndex    = []byte("by_begin")  // begin, name → nothing
+)
+
+// boltMeta is what the indexes of a report were built from.
+type boltMeta struct {
+	Domain   string    `json:"domain"` // Lower-cased
+	Begin    time.Time `json:"begin"`  // See DateRange.Times
+	End      time.Time `json:"end"`
+	Ingested time.Time `json:"ingested"`
+}
+
+// BoltDB locks its file for the process; stores of the same directory
+// opened more than once, e.g. tenants, share the database.
+var (
+	boltMu  sync.Mutex
+	boltDBs = map[string]*sharedBolt{}
+)
+
+type sharedBolt struct {
+	db   *bolt.DB
+	refs int
+}
+
+// boltReports keeps raw reports in a BoltDB file, indexed by policy domain
+// and date range begin, so queries read matching reports only. The file is
+// opened on first use, so stores used for tokens or rollups only, e.g. by
+// dmark-token, do not wait for the lock of a running dmarkd.
+type boltReports struct {
+	path string
+
+	once sync.Once
+	db   *bolt.DB
+	err  error
+}
+
+func (r *boltReports) open() (*bolt.DB, error) {
+	r.once.Do(func() {
+		r.db, r.err = openBolt(r.path)
+	})
+
+	return r.db, r.err
+}
+
+func openBolt(path string) (*bolt.DB, error) {
+	boltMu.Lock()
+	defer boltMu.Unlock()
+
+	shared, ok := boltDBs[path]
+	if !ok {
+		db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("open %q: locked by another process", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open %q: %w", path, err)
+		}
+
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{reportsBucket, metaBucket, domainIndex, beginIndex} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create buckets in %q: %w", path, err)
+		}
+
+		shared = &sharedBolt{db: db}
+		boltDBs[path] = shared
+	}
+	shared.refs++
+
+	return shared.db, nil
+}
+
+func (r *boltReports) close() error {
+	opened := true
+	r.once.Do(func() { opened = false })
+	if !opened || r.err != nil {
+		return nil
+	}
+
+	boltMu.Lock()
+	defer boltMu.Unlock()
+
+	shared, ok := boltDBs[r.path]
+	if !ok {
+		return nil
+	}
+	if shared.refs--; shared.refs > 0 {
+		return nil
+	}
+	delete(boltDBs, r.path)
+
+	return shared.db.Close()
+}
+
+// save is like dmark.SaveFile, with names in the database for file names.
+// The path returned is that of the database joined with the name.
+func (r *boltReports) save(file dmark.File) (string, bool, error) {
+	db, err := r.open()
+	if err != nil {
+		return "", false, err
+	}
+
+	name := dmark.SavedFileName(file.Name)
+	report, err := dmark.ParseBytes(file.Content)
+	if err != nil {
+		return "", false, fmt.Errorf("index %q: %w", name, err)
+	}
+	begin, end := report.ReportMetadata.DateRange.Times()
+	meta := boltMeta{
+		Domain:   strings.TrimSuffix(strings.ToLower(report.PolicyPublished.Domain), "."),
+		Begin:    begin.UTC(),
+		End:      end.UTC(),
+		Ingested: time.Now().UTC(),
+	}
+	metaContent, err := json.Marshal(meta)
+	if err != nil {
+		return "", false, fmt.Errorf("encode %q metadata: %w", name, err)
+	}
+
+	saved := false
+	err = db.Update(func(tx *bolt.Tx) error {
+		var exists bool
+		if name, exists = savedName(tx, name, file.Content); exists {
+			return nil
+		}
+
+		if err := tx.Bucket(reportsBucket).Put([]byte(name), file.Content); err != nil {
+			return err
+		}
+		if err := tx.Bucket(metaBucket).Put([]byte(name), metaContent); err != nil {
+			return err
+		}
+		if err := tx.Bucket(domainIndex).Put(domainKey(meta, name), nil); err != nil {
+			return err
+		}
+		if err := tx.Bucket(beginIndex).Put(beginKey(meta.Begin, name), nil); err != nil {
+			return err
+		}
+		saved = true
+		return nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("save %q: %w", name, err)
+	}
+
+	return filepath.Join(r.path, name), saved, nil
+}
+
+func (r *boltReports) has(file dmark.File) (bool, error) {
+	db, err := r.open()
+	if err != nil {
+		return false, err
+	}
+
+	exists := false
+	err = db.View(func(tx *bolt.Tx) error {
+		_, exists = savedName(tx, dmark.SavedFileName(file.Name), file.Content)
+		return nil
+	})
+
+	return exists, err
+}
+
+// savedName is like dmark.SavedFile for names in the reports bucket.
+func savedName(tx *bolt.Tx, name string, content []byte) (string, bool) {
+	reports := tx.Bucket(reportsBucket)
+	existing := reports.Get([]byte(name))
+	if existing == nil {
+		return name, false
+	}
+	if bytes.Equal(existing, content) {
+		return name, true
+	}
+
+	name = dmark.HashedFileName(name, content)
+	return name, bytes.Equal(reports.Get([]byte(name)), content)
+}
+
+// each reads names of matching reports from the indexes, then parses the
+// reports with get.
+func (r *boltReports) each(ctx context.Context, q Query, fn func(report *dmark.Feedback) error) error {
+	db, err := r.open()
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	err = db.View(func(tx *bolt.Tx) error {
+		switch {
+		case q.Domain != "":
+			names = queryDomain(tx, q)
+		case !q.From.IsZero() || !q.To.IsZero():
+			names = queryBegin(tx.Bucket(beginIndex).Cursor(), nil, q)
+		default:
+			return tx.Bucket(reportsBucket).ForEach(func(k, _ []byte) error {
+				names = append(names, string(k))
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("query %q: %w", r.path, err)
+	}
+	sort.Strings(names)
+
+	return r.get(ctx, names, fn)
+}
+
+func (r *boltReports) names() ([]string, error) {
+	db, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(reportsBucket).ForEach(func(k, _ []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %q: %w", r.path, err)
+	}
+
+	return names, nil
+}
+
+func (r *boltReports) get(ctx context.Context, names []string, fn func(report *dmark.Feedback) error) error {
+	db, err := r.open()
+	if err != nil {
+		return err
+	}
+
+	parser := &dmark.Parser{TrackOrigin: true}
+	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		var content, metaContent []byte
+		err = db.View(func(tx *bolt.Tx) error {
+			// values are only valid in the transaction
+			if value := tx.Bucket(reportsBucket).Get([]byte(name)); value != nil {
+				content = append([]byte{}, value...)
+			}
+			metaContent = append([]byte{}, tx.Bucket(metaBucket).Get([]byte(name))...)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("read %q: %w", name, err)
+		}
+		if content == nil {
+			continue // pruned meanwhile
+		}
+
+		report, err := parser.ParseBytes(content)
+		if err != nil {
+			return fmt.Errorf("parse %q: %w", name, err)
+		}
+		meta := boltMeta{}
+		if err = json.Unmarshal(metaContent, &meta); err != nil {
+			return fmt.Errorf("decode %q metadata: %w", name, err)
+		}
+		report.Origin.File = name
+		report.Origin.Ingested = meta.Ingested
+
+		if err = fn(report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryDomain returns names of reports of the domain and its subdomains:
+// keys of the domain index start with the reversed domain, e.g. "com.example"
+// for example.com, followed by 0 for the domain or "." for subdomains.
+func queryDomain(tx *bolt.Tx, q Query) []string {
+	reversed := reverseDomain(strings.TrimSuffix(strings.ToLower(q.Domain), "."))
+	index := tx.Bucket(domainIndex)
+
+	names := queryBegin(index.Cursor(), []byte(reversed+"\x00"), q)
+	c := index.Cursor()
+	prefix := []byte(reversed + ".")
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		// the reversed subdomain ends with the first 0
+		key := k[bytes.IndexByte(k, 0)+1:]
+		if name, ok := beginMatches(key, q); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// queryBegin returns names of reports whose keys are the prefix,
+// the date range begin and the name, with the begin matching q.
+func queryBegin(c *bolt.Cursor, prefix []byte, q Query) []string {
+	start := prefix
+	if !q.From.IsZero() {
+		start = append(append([]byte{}, prefix...), beginBytes(q.From)...)
+	}
+
+	names := []string{}
+	for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		name, ok := beginMatches(k[len(prefix):], q)
+		if !ok {
+			break // keys are ordered by begin, only To can fail
+		}
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// beginMatches returns the name of the key of the begin and the name,
+// and whether the begin is in the date range of q.
+func beginMatches(key []byte, q Query) (string, bool) {
+	if len(key) < 8 {
+		return "", false
+	}
+
+	begin := time.Unix(int64(binary.BigEndian.Uint64(key)^1<<63), 0)
+	q.Domain = "" // matched by the key prefix
+	return string(key[8:]), q.matches("", begin)
+}
+
+func (r *boltReports) remove(names []string) error {
+	db, err := r.open()
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			meta := boltMeta{}
+			if err := json.Unmarshal(tx.Bucket(metaBucket).Get([]byte(name)), &meta); err != nil {
+				return fmt.Errorf("decode %q metadata: %w", name, err)
+			}
+
+			if err := tx.Bucket(domainIndex).Delete(domainKey(meta, name)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(beginIndex).Delete(beginKey(meta.Begin, name)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(metaBucket).Delete([]byte(name)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(reportsBucket).Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("remove from %q: %w", r.path, err)
+	}
+
+	return nil
+}
+
+func domainKey(meta boltMeta, name string) []byte {
+	return append([]byte(reverseDomain(meta.Domain)+"\x00"), beginKey(meta.Begin, name)...)
+}
+
+func beginKey(begin time.Time, name string) []byte {
+	return append(beginBytes(begin), name...)
+}
+
+// beginBytes encodes the time in 8 bytes that sort as the times do,
+// with the sign bit flipped for times before 1970.
+func beginBytes(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.Unix())^1<<63)
+
+	return b
+}
+
+// reverseDomain returns the labels of the domain in reverse order,
+// "com.example.mail" for mail.example.com, so subdomains share a prefix.
+func reverseDomain(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	return strings.Join(labels, ".")
+}
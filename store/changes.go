@@ -0,0 +1,170 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+const changesFile = "changes.json"
+
+// ErrChangeNotFound is returned by RemoveChange for unknown IDs.
+var ErrChangeNotFound = errors.New("change not found")
+
+// Change is a DNS or infrastructure change, like a new SPF include or
+// a rotated DKIM key, recorded to tell what shifted pass rates, see Impacts.
+// Changes are kept in changes.json of the store.
+type Change struct {
+	ID      string    `json:"id"`
+	Date    time.Time `json:"date"`             // The day of the change, midnight UTC
+	Domain  string    `json:"domain,omitempty"` // Policy domain, with its subdomains; all domains when empty
+	Note    string    `json:"note"`
+	Author  string    `json:"author,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Applies reports whether the change applies to the policy domain.
+func (c Change) Applies(domain string) bool {
+	return c.Domain == "" || subdomainOf(domain, c.Domain)
+}
+
+// LoadChanges reads changes from changes.json of a store, for tools reading
+// reports elsewhere, like reports2email.
+func LoadChanges(path string) ([]Change, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []Change{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read changes: %w", err)
+	}
+
+	changes := []Change{}
+	if err = json.Unmarshal(content, &changes); err != nil {
+		return nil, fmt.Errorf("decode changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// Changes returns changes recorded in the store, sorted by date.
+func (s *Store) Changes() ([]Change, error) {
+	return LoadChanges(filepath.Join(s.dir, changesFile))
+}
+
+// AddChange validates the change and adds it with a new ID and creation time,
+// returning the added change. The date is truncated to the UTC day.
+func (s *Store) AddChange(change Change) (Change, error) {
+	change.Note = strings.TrimSpace(change.Note)
+	change.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(change.Domain)), ".")
+	if change.Note == "" {
+		return change, errors.New("change needs a note")
+	}
+	if change.Date.IsZero() {
+		return change, errors.New("change needs a date")
+	}
+	change.Date = change.Date.UTC().Truncate(24 * time.Hour)
+
+	changes, err := s.Changes()
+	if err != nil {
+		return change, err
+	}
+
+	random := make([]byte, 6)
+	if _, err = rand.Read(random); err != nil {
+		return change, fmt.Errorf("generate change ID: %w", err)
+	}
+	change.ID = hex.EncodeToString(random)
+	change.Created = time.Now().UTC().Truncate(time.Second)
+
+	if err = s.writeChanges(append(changes, change)); err != nil {
+		return change, err
+	}
+
+	return change, nil
+}
+
+// RemoveChange removes the change with the ID.
+func (s *Store) RemoveChange(id string) error {
+	changes, err := s.Changes()
+	if err != nil {
+		return err
+	}
+
+	kept := changes[:0]
+	for _, change := range changes {
+		if change.ID != id {
+			kept = append(kept, change)
+		}
+	}
+	if len(kept) == len(changes) {
+		return fmt.Errorf("%w: %q", ErrChangeNotFound, id)
+	}
+
+	return s.writeChanges(kept)
+}
+
+func (s *Store) writeChanges(changes []Change) error {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Date.Before(changes[j].Date)
+	})
+
+	content, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode changes: %w", err)
+	}
+
+	tmp := filepath.Join(s.dir, changesFile+".tmp")
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("write changes: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, changesFile)); err != nil {
+		return fmt.Errorf("replace changes: %w", err)
+	}
+
+	return nil
+}
+
+// ChangeImpact compares counts of the domains of a change before and since it.
+type ChangeImpact struct {
+	Change
+	Before dmark.Counts `json:"before"` // Of the window days before the change
+	After  dmark.Counts `json:"after"`  // Of the window days from the day of the change
+}
+
+// Impacts compares counts of days (see Daily and DailyIn) of the domains each
+// change applies to, over window days before it and window days from its day,
+// so a shift of the pass rate can be attributed to it.
+func Impacts(changes []Change, days []DomainDay, window int) []ChangeImpact {
+	impacts := make([]ChangeImpact, 0, len(changes))
+	for _, change := range changes {
+		impact := ChangeImpact{Change: change}
+		for _, d := range days {
+			if !change.Applies(d.Domain) {
+				continue
+			}
+
+			// days of DailyIn are midnights in its location
+			date := time.Date(change.Date.Year(), change.Date.Month(), change.Date.Day(), 0, 0, 0, 0, d.Day.Location())
+			switch {
+			case !d.Day.Before(date.AddDate(0, 0, -window)) && d.Day.Before(date):
+				impact.Before.Merge(d.Counts)
+			case !d.Day.Before(date) && d.Day.Before(date.AddDate(0, 0, window)):
+				impact.After.Merge(d.Counts)
+			}
+		}
+		impacts = append(impacts, impact)
+	}
+
+	return impacts
+}
@@ -0,0 +1,506 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// countsFile caches counts of raw reports by source IP, and the daily table
+// summed from them, see Store.Refresh.
+const countsFile = "counts.json"
+
+// countsLog holds counts of reports saved since counts.json was written,
+// a countsEntry per line, appended by Save and merged into counts.json by Refresh.
+const countsLog = "counts.log"
+
+// countsVersion is the version of reportCounts and dailyRow; counts.json of
+// other versions is ignored, so counts are parsed again.
+const countsVersion = 3
+
+type countsJSON struct {
+	Version int                     `json:"version"`
+	Reports map[string]reportCounts `json:"reports"`
+	Daily   []dailyRow              `json:"daily"`
+}
+
+// countsEntry is a line of counts.log.
+type countsEntry struct {
+	Name   string       `json:"name"`
+	Counts reportCounts `json:"counts"`
+}
+
+// reportCounts are the counts of a raw report by source IP, all that Daily
+// and Sources need of it, and what Search selects reports by.
+type reportCounts struct {
+	OrgName   string                `json:"org_name"`
+	ReportID  string                `json:"report_id"`
+	Domain    string                `json:"domain"` // Policy domain, lower-cased
+	DateRange dmark.DateRange       `json:"date_range"`
+	Sources   []dmark.SourceSummary `json:"sources"`
+	Domains   []string              `json:"domains"`   // Domains of records, see recordDomains
+	Selectors []string              `json:"selectors"` // DKIM selectors of records, lower-cased
+
+	// Normalized is DateRange normalized against other reports of the reporter
+	// and policy domain in the store, see dmark.NormalizeRanges;
+	// the daily table counts the sources of the report over it.
+	Normalized dmark.DateRange `json:"normalized"`
+
+	name string // Of the raw report
+}
+
+// group returns the key of reports whose ranges are normalized together.
+func (c reportCounts) group() string {
+	return c.OrgName + " " + c.Domain
+}
+
+func countReport(report *dmark.Feedback) reportCounts {
+	domains, selectors := map[string]bool{}, map[string]bool{}
+	for _, record := range report.Records {
+		for _, domain := range recordDomains(record) {
+			domains[domain] = true
+		}
+		for _, dkim := range record.AuthResult.DKIM {
+			if dkim.Selector != "" {
+				selectors[strings.ToLower(dkim.Selector)] = true
+			}
+		}
+	}
+
+	return reportCounts{
+		OrgName:   report.ReportMetadata.OrgName,
+		ReportID:  report.ReportMetadata.ReportID,
+		Domain:    strings.ToLower(report.PolicyPublished.Domain),
+		DateRange: report.ReportMetadata.DateRange,
+		Sources:   dmark.Sources([]dmark.Feedback{*report}),
+		Domains:   sortedKeys(domains),
+		Selectors: sortedKeys(selectors),
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// countsCache holds counts.json in memory, with counts.log and reports saved
+// since applied, while the file is unchanged. Reports are saved once under
+// a name, so their counts never go stale.
+type countsCache struct {
+	mu        sync.Mutex
+	modTime   time.Time
+	logOffset int64         // Of the first counts.log line not applied yet
+	state     *countsState  // nil until loaded
+	changed   RefreshResult // Reports added and removed since counts.json was read
+}
+
+// countsState is the content of counts.json, updated report by report.
+type countsState struct {
+	reports map[string]reportCounts
+	groups  map[string][]string  // Sorted report names by reportCounts.group
+	daily   map[string]*dailyRow // By dailyRow.key
+}
+
+func newCountsState(decoded countsJSON) *countsState {
+	state := &countsState{
+		reports: decoded.Reports,
+		groups:  map[string][]string{},
+		daily:   map[string]*dailyRow{},
+	}
+	if state.reports == nil {
+		state.reports = map[string]reportCounts{}
+	}
+	for name, counts := range state.reports {
+		state.groups[counts.group()] = append(state.groups[counts.group()], name)
+	}
+	for _, names := range state.groups {
+		sort.Strings(names)
+	}
+	for i := range decoded.Daily {
+		state.daily[decoded.Daily[i].key()] = &decoded.Daily[i]
+	}
+
+	return state
+}
+
+// add counts a report, unless it is counted already.
+func (st *countsState) add(name string, counts reportCounts) bool {
+	if _, ok := st.reports[name]; ok {
+		return false
+	}
+
+	names := st.groups[counts.group()]
+	i := sort.SearchStrings(names, name)
+	names = append(names[:i], append([]string{name}, names[i:]...)...)
+	st.reports[name] = counts
+	st.normalize(counts.group(), names, name, "")
+
+	return true
+}
+
+// remove drops the counts of a report gone from the store.
+func (st *countsState) remove(name string) {
+	counts, ok := st.reports[name]
+	if !ok {
+		return
+	}
+
+	names := []string{}
+	for _, n := range st.groups[counts.group()] {
+		if n != name {
+			names = append(names, n)
+		}
+	}
+	st.normalize(counts.group(), names, "", name)
+	delete(st.reports, name)
+}
+
+// normalize sets the names of a group, with a report added or removed,
+// and counts the sources of the added report in the daily table, subtracts
+// those of the removed one and moves those of reports whose normalized range
+// changed. Other reports of the group are left as they are in the table.
+func (st *countsState) normalize(group string, names []string, added, removed string) {
+	if removed != "" {
+		st.count(st.reports[removed], -1)
+	}
+
+	// NormalizeRanges needs the reporter, the policy domain and the date range only
+	feedbacks := make([]dmark.Feedback, len(names))
+	for i, name := range names {
+		counts := st.reports[name]
+		feedbacks[i].ReportMetadata.OrgName = counts.OrgName
+		feedbacks[i].ReportMetadata.DateRange = counts.DateRange
+		feedbacks[i].PolicyPublished.Domain = counts.Domain
+	}
+	ranges, _ := dmark.NormalizeRanges(feedbacks)
+	for i, name := range names {
+		counts := st.reports[name]
+		if name != added {
+			if counts.Normalized == ranges[i] {
+				continue
+			}
+			st.count(counts, -1)
+		}
+		counts.Normalized = ranges[i]
+		st.count(counts, 1)
+		st.reports[name] = counts
+	}
+
+	if len(names) == 0 {
+		delete(st.groups, group)
+		return
+	}
+	st.groups[group] = names
+}
+
+// count adds the sources of a report to the daily table, or subtracts them with sign -1.
+// Reports within another one, normalized to the zero range, are not counted.
+func (st *countsState) count(counts reportCounts, sign int) {
+	if counts.Normalized == (dmark.DateRange{}) {
+		return
+	}
+	for _, source := range counts.Sources {
+		row := dailyRow{Range: counts.Normalized, Domain: counts.Domain, SourceIP: source.SourceIP}
+		existing, ok := st.daily[row.key()]
+		if !ok {
+			existing = &row
+			st.daily[row.key()] = existing
+		}
+		existing.Merge(scaleCounts(source.Counts, sign))
+		if existing.Counts == (dmark.Counts{}) {
+			delete(st.daily, row.key())
+		}
+	}
+}
+
+func scaleCounts(c dmark.Counts, factor int) dmark.Counts {
+	return dmark.Counts{
+		Messages:    c.Messages * factor,
+		Passed:      c.Passed * factor,
+		DKIMPassed:  c.DKIMPassed * factor,
+		SPFPassed:   c.SPFPassed * factor,
+		Quarantined: c.Quarantined * factor,
+		Rejected:    c.Rejected * factor,
+	}
+}
+
+// RefreshResult describes what Refresh did.
+type RefreshResult struct {
+	Reports int // Reports counted in counts.json
+	Added   int // Reports added since counts.json was written, from counts.log or parsed
+	Removed int // Reports gone from the store, pruned
+}
+
+// Refresh updates counts.json, the counts of raw reports by source IP and the
+// daily table of counts by date range, policy domain and source IP summed
+// from them, that Daily, DailyIn, Sources and Search read instead of parsing
+// reports. Save counts reports right away, in counts.log, and the daily table
+// is updated report by report as they are read from it; Refresh merges the
+// log into counts.json, parses reports saved by other means, e.g. by
+// mailbox2reports, and drops removed ones. Those are parsed and dropped by
+// the methods above too, once per process, so results are the same either
+// way, only slower; run Refresh in the background, e.g. periodically.
+func (s *Store) Refresh(ctx context.Context) (RefreshResult, error) {
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+
+	if err := s.counts.sync(ctx, s.dir, s.reports); err != nil {
+		return RefreshResult{}, err
+	}
+	result := s.counts.changed
+	result.Reports = len(s.counts.state.reports)
+
+	if result.Added == 0 && result.Removed == 0 && !s.counts.modTime.IsZero() {
+		return result, nil
+	}
+	if err := s.counts.write(s.dir); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// countedReports returns counts of raw reports visible through the store,
+// ordered by name: cached ones, and those of reports saved since parsed.
+func (s *Store) countedReports(ctx context.Context) ([]reportCounts, error) {
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+
+	if err := s.counts.sync(ctx, s.dir, s.reports); err != nil {
+		return nil, err
+	}
+
+	result := []reportCounts{}
+	for name, counts := range s.counts.state.reports {
+		if s.visible(counts.Domain) {
+			counts.name = name
+			result = append(result, counts)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+
+	return result, nil
+}
+
+// countedDaily returns rows of the daily table visible through the store.
+func (s *Store) countedDaily(ctx context.Context) ([]dailyRow, error) {
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+
+	if err := s.counts.sync(ctx, s.dir, s.reports); err != nil {
+		return nil, err
+	}
+
+	result := make([]dailyRow, 0, len(s.counts.state.daily))
+	for _, row := range s.counts.state.daily {
+		if s.visible(row.Domain) {
+			result = append(result, *row)
+		}
+	}
+
+	return result, nil
+}
+
+// appendCounts records counts of a saved report in counts.log.
+func appendCounts(dir, name string, counts reportCounts) error {
+	line, err := json.Marshal(countsEntry{Name: name, Counts: counts})
+	if err != nil {
+		return fmt.Errorf("encode counts: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, countsLog), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open counts log: %w", err)
+	}
+	// a single write, so lines of concurrent saves do not interleave
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write counts log: %w", err)
+	}
+
+	return nil
+}
+
+// sync brings the cached counts up to date: it reads counts.json when it
+// changed, applies new lines of counts.log, parses reports not counted yet
+// and drops removed ones. It must be called holding c.mu.
+func (c *countsCache) sync(ctx context.Context, dir string, reports rawReports) error {
+	if err := c.load(dir); err != nil {
+		return err
+	}
+	if err := c.readLog(dir); err != nil {
+		return err
+	}
+
+	names, err := reports.names()
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(names))
+	missing := []string{}
+	for _, name := range names {
+		present[name] = true
+		if _, ok := c.state.reports[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	for name := range c.state.reports {
+		if !present[name] {
+			c.state.remove(name)
+			c.changed.Removed++
+		}
+	}
+
+	return reports.get(ctx, missing, func(report *dmark.Feedback) error {
+		if c.state.add(report.Origin.File, countReport(report)) {
+			c.changed.Added++
+		}
+		return nil
+	})
+}
+
+// load reads counts.json when it changed, starting counts.log over;
+// counts are empty when there is none or it is of another version.
+func (c *countsCache) load(dir string) error {
+	path := filepath.Join(dir, countsFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if c.state == nil || !c.modTime.IsZero() {
+			c.reset(time.Time{}, countsJSON{})
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat counts: %w", err)
+	}
+	if c.state != nil && info.ModTime().Equal(c.modTime) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read counts: %w", err)
+	}
+	decoded := countsJSON{}
+	if err = json.Unmarshal(content, &decoded); err != nil {
+		return fmt.Errorf("decode counts: %w", err)
+	}
+	if decoded.Version != countsVersion {
+		decoded = countsJSON{}
+	}
+	c.reset(info.ModTime(), decoded)
+
+	return nil
+}
+
+func (c *countsCache) reset(modTime time.Time, decoded countsJSON) {
+	c.state = newCountsState(decoded)
+	c.modTime = modTime
+	c.logOffset = 0
+	c.changed = RefreshResult{}
+}
+
+// readLog applies lines appended to counts.log since it was last read.
+func (c *countsCache) readLog(dir string) error {
+	f, err := os.Open(filepath.Join(dir, countsLog))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open counts log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(c.logOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek counts log: %w", err)
+	}
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("read counts log: %w", err)
+	}
+
+	// a line being appended is read next time
+	for {
+		end := bytes.IndexByte(content, '\n')
+		if end < 0 {
+			return nil
+		}
+		line := content[:end]
+		content = content[end+1:]
+		c.logOffset += int64(end + 1)
+
+		entry := countsEntry{}
+		if err = json.Unmarshal(line, &entry); err != nil {
+			continue // torn by a crash; the report is parsed instead
+		}
+		if c.state.add(entry.Name, entry.Counts) {
+			c.changed.Added++
+		}
+	}
+}
+
+// write replaces counts.json with the cached counts and empties counts.log.
+// Lines appended by other processes meanwhile are lost, and their reports
+// parsed instead. It must be called holding c.mu, after sync.
+func (c *countsCache) write(dir string) error {
+	if err := c.readLog(dir); err != nil {
+		return err
+	}
+
+	decoded := countsJSON{
+		Version: countsVersion,
+		Reports: c.state.reports,
+		Daily:   make([]dailyRow, 0, len(c.state.daily)),
+	}
+	for _, row := range c.state.daily {
+		decoded.Daily = append(decoded.Daily, *row)
+	}
+	sort.Slice(decoded.Daily, func(i, j int) bool {
+		return decoded.Daily[i].key() < decoded.Daily[j].key()
+	})
+	content, err := json.Marshal(decoded)
+	if err != nil {
+		return fmt.Errorf("encode counts: %w", err)
+	}
+
+	path := filepath.Join(dir, countsFile)
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("write counts: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace counts: %w", err)
+	}
+	if err = os.Truncate(filepath.Join(dir, countsLog), 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("truncate counts log: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		c.modTime = info.ModTime()
+		c.logOffset = 0
+		c.changed = RefreshResult{}
+	}
+
+	return nil
+}
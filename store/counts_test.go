@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+func saveReport(t *testing.T, s *Store, name, org string, begin, end time.Time, ip string, count int) {
+	t.Helper()
+
+	content := fmt.Sprintf(`<feedback>
+<report_metadata><org_name>%s</org_name><report_id>%s</report_id>
+<date_range><begin>%d</begin><end>%d</end></date_range></report_metadata>
+<policy_published><domain>example.com</domain><p>none</p></policy_published>
+<record><row><source_ip>%s</source_ip><count>%d</count>
+<policy_evaluated><disposition>none</disposition><dkim>pass</dkim><spf>fail</spf></policy_evaluated></row></record>
+</feedback>`, org, name, begin.Unix(), end.Unix(), ip, count)
+	if _, _, err := s.Save(dmark.File{Name: name + ".xml", Content: []byte(content)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDailyIncremental checks the daily table updated report by report
+// matches the one counted from scratch, with reports saved out of order
+// whose ranges overlap or are within another, and with removed reports.
+func TestDailyIncremental(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	saveReport(t, s, "b", "example.net", day.Add(24*time.Hour), day.Add(72*time.Hour), "192.0.2.1", 5)
+	saveReport(t, s, "c", "example.org", day, day.Add(24*time.Hour), "192.0.2.1", 7)
+	if _, err = s.Daily(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// overlaps b, which is clamped to begin the day after
+	saveReport(t, s, "a", "example.net", day.Add(12*time.Hour), day.Add(50*time.Hour), "192.0.2.2", 3)
+	// within a, and within b once a is removed, not counted
+	saveReport(t, s, "d", "example.net", day.Add(30*time.Hour), day.Add(40*time.Hour), "192.0.2.3", 11)
+
+	if _, err = os.Stat(filepath.Join(dir, countsFile)); !os.IsNotExist(err) {
+		t.Errorf("want no counts.json before Refresh, got %v", err)
+	}
+
+	check := func(step string, messages int) {
+		t.Helper()
+
+		daily, err := s.Daily(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, d := range daily {
+			total += d.Messages
+		}
+		if total != messages {
+			t.Errorf("%s: want %d messages, got %d", step, messages, total)
+		}
+		sources, err := s.Sources(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scratch, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer scratch.Close()
+		scratch.reports = s.reports // parsed, as scratch has no counts
+		wantDaily, err := scratch.Daily(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantSources, err := scratch.Sources(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(daily, wantDaily) {
+			t.Errorf("%s: want daily %+v, got %+v", step, wantDaily, daily)
+		}
+		if !reflect.DeepEqual(sources, wantSources) {
+			t.Errorf("%s: want sources %+v, got %+v", step, wantSources, sources)
+		}
+	}
+	check("saved", 15)
+
+	result, err := s.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reports != 4 || result.Added != 4 {
+		t.Errorf("want 4 reports added, got %+v", result)
+	}
+	if info, err := os.Stat(filepath.Join(dir, countsLog)); err != nil || info.Size() != 0 {
+		t.Errorf("want counts.log emptied by Refresh, got %v", err)
+	}
+	check("refreshed", 15)
+
+	if err = os.Remove(filepath.Join(dir, "a.xml")); err != nil {
+		t.Fatal(err)
+	}
+	check("removed", 12)
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	s = reopened
+	check("reopened", 12)
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// DomainDay holds counts of a policy domain for a single day.
+type DomainDay struct {
+	dmark.Counts
+	Day    time.Time `json:"day"` // Midnight UTC, or in the location of DailyIn
+	Domain string    `json:"domain"`
+}
+
+// dailyRow sums counts of a source in raw reports of a policy domain over the
+// same normalized date range, across reporters: usually a UTC day, as most
+// reporters send a report a day. Rows are kept in counts.json, see Refresh.
+type dailyRow struct {
+	dmark.Counts
+	Range    dmark.DateRange `json:"range"`
+	Domain   string          `json:"domain"` // Policy domain, lower-cased
+	SourceIP net.IP          `json:"source_ip"`
+}
+
+func (r dailyRow) key() string {
+	return fmt.Sprintf("%010d %010d %s %s", r.Range.Begin, r.Range.End, r.Domain, r.SourceIP)
+}
+
+// Daily aggregates raw reports and rollups by UTC day and policy domain,
+// sorted by day, then domain. Date ranges are normalized, see dmark.NormalizeRanges.
+// Raw reports are read from the daily table in counts.json, see Refresh.
+func (s *Store) Daily(ctx context.Context) ([]DomainDay, error) {
+	return s.daily(ctx, nil)
+}
+
+// DailyIn is like Daily, but aggregates by day in the location.
+// Counts of a source over a date range, and rollups, spanning several days
+// there are split across them proportionally, see dmark.SplitDays.
+func (s *Store) DailyIn(ctx context.Context, loc *time.Location) ([]DomainDay, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return s.daily(ctx, loc)
+}
+
+// daily buckets by the UTC day reports begin when loc is nil.
+func (s *Store) daily(ctx context.Context, loc *time.Location) ([]DomainDay, error) {
+	rows, err := s.countedDaily(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rollups, err := s.Rollups()
+	if err != nil {
+		return nil, err
+	}
+
+	days := map[string]*DomainDay{}
+	get := func(day time.Time, domain string) *DomainDay {
+		key := day.Format("2006-01-02") + " " + domain
+		d, ok := days[key]
+		if !ok {
+			d = &DomainDay{Day: day, Domain: domain}
+			days[key] = d
+		}
+		return d
+	}
+
+	for _, row := range rows {
+		begin := time.Unix(int64(row.Range.Begin), 0)
+		if loc == nil {
+			get(begin.UTC().Truncate(24*time.Hour), row.Domain).Merge(row.Counts)
+			continue
+		}
+
+		end := time.Unix(int64(row.Range.End), 0)
+		for _, split := range splitCounts(row.Counts, begin, end, loc) {
+			get(split.Day, row.Domain).Merge(split.Counts)
+		}
+	}
+	for _, rollup := range rollups {
+		if loc == nil {
+			get(rollup.Day, rollup.Domain).Merge(rollup.Counts)
+			continue
+		}
+		for _, split := range splitCounts(rollup.Counts, rollup.Day, rollup.Day.Add(24*time.Hour), loc) {
+			get(split.Day, rollup.Domain).Merge(split.Counts)
+		}
+	}
+
+	result := make([]DomainDay, 0, len(days))
+	for _, d := range days {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Day.Equal(result[j].Day) {
+			return result[i].Day.Before(result[j].Day)
+		}
+		return result[i].Domain < result[j].Domain
+	})
+
+	return result, nil
+}
+
+// splitCounts splits counts of a time range across the days in loc it overlaps.
+// Each count is split on its own, so they may not add up exactly per day.
+func splitCounts(counts dmark.Counts, begin, end time.Time, loc *time.Location) []DomainDay {
+	fields := []struct {
+		value int
+		set   func(c *dmark.Counts, v int)
+	}{
+		{counts.Messages, func(c *dmark.Counts, v int) { c.Messages = v }},
+		{counts.Passed, func(c *dmark.Counts, v int) { c.Passed = v }},
+		{counts.DKIMPassed, func(c *dmark.Counts, v int) { c.DKIMPassed = v }},
+		{counts.SPFPassed, func(c *dmark.Counts, v int) { c.SPFPassed = v }},
+		{counts.Quarantined, func(c *dmark.Counts, v int) { c.Quarantined = v }},
+		{counts.Rejected, func(c *dmark.Counts, v int) { c.Rejected = v }},
+	}
+
+	result := []DomainDay{}
+	index := map[int64]int{}
+	for _, field := range fields {
+		for _, split := range dmark.SplitDays(begin, end, field.value, loc) {
+			i, ok := index[split.Day.Unix()]
+			if !ok {
+				i = len(result)
+				index[split.Day.Unix()] = i
+				result = append(result, DomainDay{Day: split.Day})
+			}
+			field.set(&result[i].Counts, split.Count)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/filter"
+)
+
+// Export formats, of a dmark.FlatRecord per row or line.
+const (
+	ExportCSV    = "csv"    // With a header of dmark.FlatColumns
+	ExportNDJSON = "ndjson" // A JSON object per line
+)
+
+// Export writes records of raw reports matching q, and where when set,
+// as flat records in the format, one report at a time, so stores of any
+// size are exported in constant memory. It returns the number of records written.
+func (s *Store) Export(ctx context.Context, w io.Writer, format string, q Query, where *filter.Filter) (int, error) {
+	var write func(records []dmark.FlatRecord) error
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(dmark.FlatColumns); err != nil {
+			return 0, err
+		}
+		write = func(records []dmark.FlatRecord) error {
+			for _, record := range records {
+				if err := cw.Write(record.Strings()); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	case ExportNDJSON:
+		enc := json.NewEncoder(w)
+		write = func(records []dmark.FlatRecord) error {
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		return 0, fmt.Errorf("unsupported format %q, expected %s or %s", format, ExportCSV, ExportNDJSON)
+	}
+
+	written := 0
+	err := s.Each(ctx, q, func(report *dmark.Feedback) error {
+		if where != nil {
+			where.Apply(report)
+		}
+		records := dmark.Flatten(*report)
+		if err := write(records); err != nil {
+			return fmt.Errorf("write records: %w", err)
+		}
+		written += len(records)
+		return nil
+	})
+
+	return written, err
+}
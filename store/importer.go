@@ -0,0 +1,490 @@
+package store
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// maxEntrySize limits the size of a single file in a tarball, a message
+// in an mbox file or another file, as each is read into memory.
+const maxEntrySize = 64 << 20
+
+// ImportProgress describes the state of an import.
+type ImportProgress struct {
+	Total      int    // Files found
+	Done       int    // Files processed, including resumed ones
+	Resumed    int    // Files skipped as processed by a previous run
+	Saved      int    // Reports saved, or that would be saved with DryRun
+	Duplicates int    // Reports already in the store or seen earlier in the import
+	Invalid    int    // Files without valid reports
+	Skipped    int    // Files, tarball entries and mbox messages skipped as larger than 64 MiB
+	Path       string // The last processed file
+}
+
+// Importer imports report files from a directory tree into a store: XML, gzip,
+// zip, email messages (*.eml), mbox files and tarballs (*.tar, *.tar.gz, *.tgz)
+// of any of them. Reports are saved as they are read, so tarballs and mbox files
+// are never held in memory whole. Processed files are recorded with their hashes
+// in a state file, so an interrupted import resumes instead of starting over;
+// files that cannot be read in full, e.g. corrupted tarballs, fail the import
+// and are not recorded, so they are read again.
+type Importer struct {
+	Store     *Store
+	StatePath string // No state is kept when empty
+	Workers   int    // Files read and parsed in parallel, one when zero
+	DryRun    bool   // Count reports that would be saved, without saving them or the state
+
+	// OnProgress is called after each processed file.
+	OnProgress func(p ImportProgress)
+
+	// OnReport is called for each report saved, or that would be saved with DryRun,
+	// with the path of the file it was found in.
+	OnReport func(path string, file dmark.File)
+
+	// OnSkip is called for each file, tarball entry or mbox message skipped
+	// as too large, with the path of the file and the name of what was skipped.
+	OnSkip func(path, name string)
+}
+
+// ImportDir imports all files in dir and its subdirectories, or a single file.
+// When ctx is done, it stops after the files being processed, which can be resumed from.
+// Callbacks are not called concurrently.
+func (im *Importer) ImportDir(ctx context.Context, dir string) (ImportProgress, error) {
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportProgress{}, fmt.Errorf("walk %q: %w", dir, err)
+	}
+
+	run := &importRun{
+		Importer: im,
+		progress: ImportProgress{Total: len(paths)},
+		seen:     map[[sha256.Size]byte]bool{},
+	}
+	if run.state, err = loadState(im.StatePath); err != nil {
+		return run.progress, err
+	}
+
+	if im.StatePath != "" && !im.DryRun {
+		if run.stateFile, err = os.OpenFile(im.StatePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return run.progress, fmt.Errorf("open state file %q: %w", im.StatePath, err)
+		}
+		defer run.stateFile.Close()
+	}
+
+	workers := im.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan string)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				if err := run.file(path); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+send:
+	for _, path := range paths {
+		select {
+		case queue <- path:
+		case err = <-errs:
+			break send
+		case <-ctx.Done():
+			err = ctx.Err()
+			break send
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+
+	return run.progress, err
+}
+
+// ImportReports saves reports read from the file at path,
+// converted from an export of another tool, see the convert package.
+func (im *Importer) ImportReports(path string, reports []dmark.Feedback) (ImportProgress, error) {
+	run := &importRun{
+		Importer: im,
+		progress: ImportProgress{Total: 1},
+		seen:     map[[sha256.Size]byte]bool{},
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	for i := range reports {
+		file, err := dmark.MarshalFile(&reports[i])
+		if err != nil {
+			return run.progress, err
+		}
+		if err = run.save(path, file); err != nil {
+			return run.progress, err
+		}
+	}
+	if len(reports) == 0 {
+		run.progress.Invalid++
+	}
+
+	run.done(path)
+	return run.progress, nil
+}
+
+// importRun is the state of an ImportDir call shared by its workers.
+type importRun struct {
+	*Importer
+	state     map[string]string
+	stateFile *os.File
+
+	mu       sync.Mutex
+	progress ImportProgress
+	seen     map[[sha256.Size]byte]bool // Reports found so far
+}
+
+// file imports reports found in the file, saving each as it is read.
+// Files without valid reports are not an error; files that cannot be read are.
+func (run *importRun) file(path string) error {
+	hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if run.state[path] == hash {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		run.progress.Resumed++
+		run.done(path)
+		return nil
+	}
+
+	valid := 0
+	err = readReports(path, func(file dmark.File) error {
+		if _, err := dmark.ParseBytes(file.Content); err != nil {
+			return nil
+		}
+		valid++
+
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		return run.save(path, file)
+	}, func(name string) {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		run.progress.Skipped++
+		if run.OnSkip != nil {
+			run.OnSkip(path, name)
+		}
+	})
+	if err != nil {
+		// not recorded as processed, so it is read again, saving the rest
+		return err
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if valid == 0 {
+		run.progress.Invalid++
+	}
+
+	if run.stateFile != nil {
+		// the same format as sha256sum output
+		if _, err = fmt.Fprintf(run.stateFile, "%s  %s\n", hash, path); err != nil {
+			return fmt.Errorf("write state file: %w", err)
+		}
+	}
+
+	run.done(path)
+	return nil
+}
+
+// save saves a report unless it is a duplicate, holding run.mu.
+func (run *importRun) save(path string, file dmark.File) error {
+	sum := sha256.Sum256(file.Content)
+	if run.seen[sum] {
+		run.progress.Duplicates++
+		return nil
+	}
+	run.seen[sum] = true
+
+	var (
+		saved bool
+		err   error
+	)
+	if run.DryRun {
+		var exists bool
+		exists, err = run.Store.Has(file)
+		saved = !exists
+	} else {
+		_, saved, err = run.Store.Save(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !saved {
+		run.progress.Duplicates++
+		return nil
+	}
+	run.progress.Saved++
+	if run.OnReport != nil {
+		run.OnReport(path, file)
+	}
+
+	return nil
+}
+
+// done counts the processed file, holding run.mu.
+func (run *importRun) done(path string) {
+	run.progress.Done++
+	run.progress.Path = path
+	if run.OnProgress != nil {
+		run.OnProgress(run.progress)
+	}
+}
+
+// readReports calls fn with each report found in the file at path, as it is
+// read: in an email message, an mbox file, a tarball or a report, possibly
+// compressed. Files, tarball entries and mbox messages larger than maxEntrySize
+// are passed to skip instead.
+func readReports(path string, fn func(file dmark.File) error, skip func(name string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	// errors of fn are returned as they are, others are read errors
+	var fnErr error
+	report := func(file dmark.File) error {
+		fnErr = fn(file)
+		return fnErr
+	}
+
+	name := filepath.Base(path)
+	r := bufio.NewReader(f)
+	prefix, _ := r.Peek(len(mboxFrom))
+	switch {
+	case isTarball(path):
+		err = tarballReports(path, r, report, skip)
+	case strings.HasSuffix(strings.ToLower(name), ".mbox") || bytes.Equal(prefix, mboxFrom):
+		err = mboxReports(r, report, func(i int) { skip(fmt.Sprintf("%s message %d", name, i)) })
+	default:
+		var content []byte
+		if content, err = ioutil.ReadAll(io.LimitReader(r, maxEntrySize+1)); err != nil {
+			break
+		}
+		if len(content) > maxEntrySize {
+			skip(name)
+			return nil
+		}
+		err = eachFile(extractReports(name, content), report)
+	}
+	if err != nil && err != fnErr {
+		return fmt.Errorf("read %q: %w", path, err)
+	}
+
+	return err
+}
+
+func eachFile(files []dmark.File, fn func(file dmark.File) error) error {
+	for _, file := range files {
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractReports returns reports found in the content of a file:
+// an email message, an mbox file or a report, possibly compressed.
+func extractReports(name string, content []byte) []dmark.File {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".eml"):
+		files, _ := dmark.ExtractReports(bytes.NewReader(content))
+		return files
+	case strings.HasSuffix(lower, ".mbox") || bytes.HasPrefix(content, mboxFrom):
+		files := []dmark.File{}
+		mboxReports(bufio.NewReader(bytes.NewReader(content)), func(file dmark.File) error {
+			files = append(files, file)
+			return nil
+		}, func(int) {})
+		return files
+	}
+
+	files, _ := dmark.Decompress(name, content)
+	return files
+}
+
+var mboxFrom = []byte("From ")
+
+// mboxReports calls fn with reports of each message of an mbox file, each
+// following a "From " line, reading a message at a time. Messages larger
+// than maxEntrySize are passed to skip by their number, starting from 1.
+func mboxReports(r *bufio.Reader, fn func(file dmark.File) error, skip func(i int)) error {
+	var message []byte
+	messages, tooLarge := 0, false
+	flush := func() error {
+		if messages == 0 {
+			return nil
+		}
+		if tooLarge {
+			skip(messages)
+			return nil
+		}
+		files, _ := dmark.ExtractReports(bytes.NewReader(message))
+		return eachFile(files, fn)
+	}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if bytes.HasPrefix(line, mboxFrom) {
+			if err := flush(); err != nil {
+				return err
+			}
+			message, messages, tooLarge = nil, messages+1, false
+		} else if messages > 0 && !tooLarge {
+			message = append(message, line...)
+			if len(message) > maxEntrySize {
+				message, tooLarge = nil, true
+			}
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func isTarball(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar") ||
+		strings.HasSuffix(lower, ".tar.gz") ||
+		strings.HasSuffix(lower, ".tgz")
+}
+
+// tarballReports calls fn with reports found in the files of a tarball,
+// reading a file at a time.
+func tarballReports(path string, f io.Reader, fn func(file dmark.File) error, skip func(name string)) error {
+	r := f
+	if !strings.HasSuffix(strings.ToLower(path), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxEntrySize {
+			skip(header.Name)
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err = eachFile(extractReports(filepath.Base(header.Name), content), fn); err != nil {
+			return err
+		}
+	}
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("read %q: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadState reads hashes of processed files by their paths.
+func loadState(path string) (map[string]string, error) {
+	state := map[string]string{}
+	if path == "" {
+		return state, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open state file %q: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "  "); i > 0 {
+			state[line[i+2:]] = line[:i]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read state file %q: %w", path, err)
+	}
+
+	return state, nil
+}
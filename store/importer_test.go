@@ -0,0 +1,103 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testReport(id int) []byte {
+	return []byte(fmt.Sprintf(`<feedback>
+<report_metadata><org_name>example.net</org_name><report_id>%d</report_id>
+<date_range><begin>1577836800</begin><end>1577923200</end></date_range></report_metadata>
+<policy_published><domain>example.com</domain><p>none</p></policy_published>
+<record><row><source_ip>192.0.2.1</source_ip><count>1</count></row></record>
+</feedback>`, id))
+}
+
+func TestImportCorruptedTarball(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i < 3; i++ {
+		content := testReport(i)
+		header := &tar.Header{Name: fmt.Sprintf("report%d.xml", i), Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	in := t.TempDir()
+	tarball := filepath.Join(in, "archive.tar.gz")
+	// truncated within the last entry
+	if err := os.WriteFile(tarball, buf.Bytes()[:buf.Len()-40], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	statePath := filepath.Join(t.TempDir(), "state")
+	importer := &Importer{Store: s, StatePath: statePath}
+
+	_, err = importer.ImportDir(context.Background(), in)
+	if err == nil || !strings.Contains(err.Error(), "archive.tar.gz") {
+		t.Fatalf("want a read error of the tarball, got %v", err)
+	}
+	if state, _ := os.ReadFile(statePath); len(state) > 0 {
+		t.Errorf("want the tarball not recorded as processed, got state %q", state)
+	}
+
+	// fixed, it is read again, saving the rest
+	if err = os.WriteFile(tarball, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	progress, err := importer.ImportDir(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Resumed != 0 || progress.Saved+progress.Duplicates != 3 || progress.Saved == 0 {
+		t.Errorf("want the tarball read again, got %+v", progress)
+	}
+}
+
+func TestImportMbox(t *testing.T) {
+	var mbox bytes.Buffer
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&mbox, "From dmarc@example.net Mon Jan  1 00:00:00 2020\n")
+		fmt.Fprintf(&mbox, "From: dmarc@example.net\nSubject: Report %d\nContent-Type: application/xml\nContent-Disposition: attachment; filename=\"report%d.xml\"\n\n", i, i)
+		mbox.Write(testReport(i))
+		mbox.WriteString("\n\n")
+	}
+
+	in := t.TempDir()
+	if err := os.WriteFile(filepath.Join(in, "inbox"), mbox.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	progress, err := (&Importer{Store: s}).ImportDir(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Saved != 3 || progress.Invalid != 0 {
+		t.Errorf("want 3 reports saved from the mbox file, got %+v", progress)
+	}
+}
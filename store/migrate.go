@@ -0,0 +1,133 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// schemaFile records the layout version of the store directory.
+const schemaFile = "schema.json"
+
+// ErrNewerSchema is returned by Open for stores written by a newer version
+// of this package, which it cannot read safely.
+var ErrNewerSchema = errors.New("store layout is newer than supported")
+
+// migration upgrades the store directory from the previous version to version.
+// Migrations must leave the directory readable by the previous version when
+// they fail halfway, e.g. by writing new files next to old ones and renaming.
+type migration struct {
+	version     int
+	description string
+	migrate     func(dir string) error
+}
+
+// migrations are applied in order by Open; append new ones with the next
+// version when the layout of reports, rollups.json or tokens.json changes.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "record the layout version",
+		migrate:     func(dir string) error { return nil },
+	},
+	{
+		version:     2,
+		description: "record hashes of pruned reports in rollups.json",
+		migrate:     migrateRollupsState,
+	},
+}
+
+// SchemaVersion is the layout version of stores written by this package.
+var SchemaVersion = migrations[len(migrations)-1].version
+
+type schema struct {
+	Version int `json:"version"`
+}
+
+// Version returns the layout version of the store, 0 for stores created
+// before versions were recorded.
+func (s *Store) Version() (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, schemaFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read schema: %w", err)
+	}
+
+	v := schema{}
+	if err = json.Unmarshal(content, &v); err != nil {
+		return 0, fmt.Errorf("decode schema: %w", err)
+	}
+
+	return v.Version, nil
+}
+
+// migrate upgrades the store to SchemaVersion, recording the version after
+// each migration, so an interrupted upgrade resumes from where it stopped.
+func (s *Store) migrate() error {
+	current, err := s.Version()
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("%s has layout version %d, want at most %d: %w", s.dir, current, SchemaVersion, ErrNewerSchema)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		slog.Info("Migrating store", "dir", s.dir, "from", current, "to", m.version, "migration", m.description)
+		if err = m.migrate(s.dir); err != nil {
+			return fmt.Errorf("migrate store to version %d (%s): %w", m.version, m.description, err)
+		}
+		if err = s.writeVersion(m.version); err != nil {
+			return err
+		}
+		current = m.version
+	}
+
+	return nil
+}
+
+func (s *Store) writeVersion(version int) error {
+	content, err := json.Marshal(schema{Version: version})
+	if err != nil {
+		return fmt.Errorf("encode schema: %w", err)
+	}
+
+	tmp := filepath.Join(s.dir, schemaFile+".tmp")
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("write schema: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, schemaFile)); err != nil {
+		return fmt.Errorf("replace schema: %w", err)
+	}
+
+	return nil
+}
+
+// migrateRollupsState wraps the list of rollups in rollups.json
+// in an object, see rollupsState.
+func migrateRollupsState(dir string) error {
+	content, err := ioutil.ReadFile(filepath.Join(dir, rollupsFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read rollups: %w", err)
+	}
+
+	state := rollupsState{}
+	if err = json.Unmarshal(content, &state.Rollups); err != nil {
+		return fmt.Errorf("decode rollups: %w", err)
+	}
+
+	return writeRollups(dir, state)
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Query selects raw reports by policy domain and date range.
+type Query struct {
+	Domain string    // Policy domain, with its subdomains; all domains when empty
+	From   time.Time // Reports whose date range begins at or after From, when set
+	To     time.Time // Reports whose date range begins before To, when set
+}
+
+func (q Query) matches(domain string, begin time.Time) bool {
+	if q.Domain != "" && !subdomainOf(domain, q.Domain) {
+		return false
+	}
+	if !q.From.IsZero() && begin.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !begin.Before(q.To) {
+		return false
+	}
+
+	return true
+}
+
+// subdomainOf reports whether domain is parent or one of its subdomains.
+func subdomainOf(domain, parent string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	parent = strings.TrimSuffix(strings.ToLower(parent), ".")
+
+	return domain == parent || strings.HasSuffix(domain, "."+parent)
+}
+
+// rawReports keeps the raw reports of a store: XML files in the store
+// directory, see dirReports, or a BoltDB file, see boltReports.
+type rawReports interface {
+	save(file dmark.File) (path string, saved bool, err error)
+	has(file dmark.File) (bool, error)
+
+	// each calls fn with reports matching q, with their origin, ordered by name,
+	// and stops with the context error once ctx is done.
+	each(ctx context.Context, q Query, fn func(report *dmark.Feedback) error) error
+
+	// names returns the names of all reports, sorted.
+	names() ([]string, error)
+
+	// get is like each for reports of the names, skipping removed ones.
+	get(ctx context.Context, names []string, fn func(report *dmark.Feedback) error) error
+
+	// remove removes reports by the names of their origin.
+	remove(names []string) error
+
+	close() error
+}
+
+// dirReports keeps raw reports as XML files in dir.
+type dirReports struct {
+	dir string
+}
+
+func (r dirReports) save(file dmark.File) (string, bool, error) {
+	return dmark.SaveFile(r.dir, file)
+}
+
+func (r dirReports) has(file dmark.File) (bool, error) {
+	_, exists, err := dmark.SavedFile(r.dir, file)
+	return exists, err
+}
+
+// each parses every file, as files have no index.
+func (r dirReports) each(ctx context.Context, q Query, fn func(report *dmark.Feedback) error) error {
+	names, err := r.names()
+	if err != nil {
+		return err
+	}
+
+	return r.get(ctx, names, func(report *dmark.Feedback) error {
+		begin, _ := report.ReportMetadata.DateRange.Times()
+		if !q.matches(report.PolicyPublished.Domain, begin) {
+			return nil
+		}
+		return fn(report)
+	})
+}
+
+func (r dirReports) names() ([]string, error) {
+	files, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	names := []string{}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".xml") {
+			names = append(names, f.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (r dirReports) get(ctx context.Context, names []string, fn func(report *dmark.Feedback) error) error {
+	parser := &dmark.Parser{TrackOrigin: true}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		report, err := parser.ParseFile(filepath.Join(r.dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // pruned meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r dirReports) remove(names []string) error {
+	for _, name := range names {
+		path := filepath.Join(r.dir, name)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("remove %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (r dirReports) close() error {
+	return nil
+}
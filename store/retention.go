@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+const rollupsFile = "rollups.json"
+
+// Rollup aggregates records of pruned reports
+// for a single day, policy domain and source IP.
+type Rollup struct {
+	dmark.Counts
+	Day      time.Time `json:"day"` // Midnight UTC of the report date range begin
+	Domain   string    `json:"domain"`
+	SourceIP net.IP    `json:"source_ip"`
+}
+
+func (r Rollup) key() string {
+	return r.Day.Format("2006-01-02") + " " + r.Domain + " " + r.SourceIP.String()
+}
+
+// PruneResult describes what Prune did, or would do with PruneDryRun.
+type PruneResult struct {
+	Reports int // Raw reports removed
+	Records int // Records rolled up
+	Rollups int // Rollups in the store after pruning
+}
+
+// rollupsState is the content of rollups.json.
+type rollupsState struct {
+	Rollups []Rollup `json:"rollups"`
+
+	// Pruned holds the SHA-256 of reports already rolled up, kept until
+	// they are removed, so an interrupted prune does not count them twice.
+	Pruned []string `json:"pruned,omitempty"`
+}
+
+// Rollups returns aggregates of pruned reports, sorted by day, domain and source IP.
+func (s *Store) Rollups() ([]Rollup, error) {
+	state, err := readRollups(s.dir)
+	if err != nil || len(s.domains) == 0 {
+		return state.Rollups, err
+	}
+
+	visible := state.Rollups[:0]
+	for _, rollup := range state.Rollups {
+		if s.visible(rollup.Domain) {
+			visible = append(visible, rollup)
+		}
+	}
+
+	return visible, nil
+}
+
+func readRollups(dir string) (rollupsState, error) {
+	state := rollupsState{Rollups: []Rollup{}}
+	content, err := ioutil.ReadFile(filepath.Join(dir, rollupsFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("read rollups: %w", err)
+	}
+
+	if err = json.Unmarshal(content, &state); err != nil {
+		return state, fmt.Errorf("decode rollups: %w", err)
+	}
+
+	return state, nil
+}
+
+// Prune rolls up raw reports whose date range ended before the given time
+// into daily per-domain, per-source aggregates and removes them.
+// Cancelling ctx stops Prune while it reads reports, without changing the store;
+// once rollups are written, reports are removed regardless of ctx.
+func (s *Store) Prune(ctx context.Context, before time.Time) (PruneResult, error) {
+	return s.prune(ctx, before, false)
+}
+
+// PruneDryRun returns what Prune would do, without changing the store.
+func (s *Store) PruneDryRun(ctx context.Context, before time.Time) (PruneResult, error) {
+	return s.prune(ctx, before, true)
+}
+
+func (s *Store) prune(ctx context.Context, before time.Time, dryRun bool) (PruneResult, error) {
+	result := PruneResult{}
+	if len(s.domains) > 0 {
+		return result, errors.New("prune a store restricted to domains")
+	}
+
+	state, err := readRollups(s.dir)
+	if err != nil {
+		return result, err
+	}
+	rollups := state.Rollups
+	index := map[string]*Rollup{}
+	for i := range rollups {
+		index[rollups[i].key()] = &rollups[i]
+	}
+	added := []*Rollup{}
+
+	// reports rolled up by a prune interrupted before removing them
+	rolledUp := map[string]bool{}
+	for _, sum := range state.Pruned {
+		rolledUp[sum] = true
+	}
+
+	pruned := []string{}
+	sums := []string{}
+	err = s.reports.each(ctx, Query{To: before}, func(report *dmark.Feedback) error {
+		if int64(report.ReportMetadata.DateRange.End) >= before.Unix() {
+			return nil
+		}
+
+		pruned = append(pruned, report.Origin.File)
+		if rolledUp[report.Origin.SHA256] {
+			delete(rolledUp, report.Origin.SHA256)
+			return nil
+		}
+		sums = append(sums, report.Origin.SHA256)
+
+		begin, _ := report.ReportMetadata.DateRange.Times()
+		day := begin.UTC().Truncate(24 * time.Hour)
+		domain := strings.ToLower(report.PolicyPublished.Domain)
+		for _, record := range report.Records {
+			rollup := Rollup{Day: day, Domain: domain, SourceIP: record.Row.SourceIP}
+			existing, ok := index[rollup.key()]
+			if !ok {
+				existing = &rollup
+				index[rollup.key()] = existing
+				added = append(added, existing)
+			}
+			existing.Add(record)
+			result.Records++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	if len(pruned) == 0 {
+		result.Rollups = len(rollups)
+		return result, nil
+	}
+
+	for _, rollup := range added {
+		rollups = append(rollups, *rollup)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollups[i].key() < rollups[j].key()
+	})
+	if dryRun {
+		result.Rollups = len(rollups)
+		result.Reports = len(pruned)
+		return result, nil
+	}
+
+	// hashes of reports rolled up before, but not pruned this time
+	// with an earlier before, are kept until they are removed
+	kept := []string{}
+	for _, sum := range state.Pruned {
+		if rolledUp[sum] {
+			kept = append(kept, sum)
+		}
+	}
+
+	// reports are removed only after their rollups are written, along with
+	// their hashes, so an interrupted prune neither loses nor double-counts data
+	state = rollupsState{Rollups: rollups, Pruned: append(kept, sums...)}
+	if err = writeRollups(s.dir, state); err != nil {
+		return result, err
+	}
+	result.Rollups = len(rollups)
+
+	if err = s.reports.remove(pruned); err != nil {
+		return result, err
+	}
+	result.Reports = len(pruned)
+
+	state.Pruned = kept
+	if err = writeRollups(s.dir, state); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func writeRollups(dir string, state rollupsState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode rollups: %w", err)
+	}
+
+	tmp := filepath.Join(dir, rollupsFile+".tmp")
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("write rollups: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(dir, rollupsFile)); err != nil {
+		return fmt.Errorf("replace rollups: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// failingRemove is raw reports whose remove fails, as if the process
+// was interrupted after writing rollups.
+type failingRemove struct {
+	rawReports
+}
+
+func (failingRemove) remove(names []string) error {
+	return errors.New("interrupted")
+}
+
+func TestPruneInterrupted(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i, count := range []int{3, 4} {
+		begin := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Unix() + int64(i)
+		content := fmt.Sprintf(`<feedback>
+<report_metadata><org_name>example.net</org_name><report_id>%d</report_id>
+<date_range><begin>%d</begin><end>%d</end></date_range></report_metadata>
+<policy_published><domain>example.com</domain><p>none</p></policy_published>
+<record><row><source_ip>192.0.2.1</source_ip><count>%d</count></row></record>
+</feedback>`, i, begin, begin+3600, count)
+		if _, _, err = s.Save(dmark.File{Name: fmt.Sprintf("report%d.xml", i), Content: []byte(content)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports := s.reports
+	s.reports = failingRemove{reports}
+	if _, err = s.Prune(context.Background(), time.Now()); err == nil {
+		t.Fatal("want the error of remove")
+	}
+	s.reports = reports
+
+	result, err := s.Prune(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reports != 2 || result.Records != 0 {
+		t.Errorf("want 2 reports removed without rolling up records again, got %+v", result)
+	}
+
+	rollups, err := s.Rollups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollups) != 1 || rollups[0].Messages != 7 {
+		t.Errorf("want a rollup of 7 messages, got %+v", rollups)
+	}
+
+	state, err := readRollups(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Pruned) != 0 {
+		t.Errorf("want no hashes of pruned reports once removed, got %v", state.Pruned)
+	}
+}
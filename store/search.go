@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// SearchQuery selects records of raw reports, for incident response, like
+// all records of 203.0.113.7 in the last quarter. Empty fields match all;
+// records match all fields that are set.
+type SearchQuery struct {
+	Source   *net.IPNet // Network of the source IP, see ParseSource
+	Domain   string     // Substring of the policy domain or a domain of the record, see recordDomains
+	Selector string     // DKIM selector
+	ReportID string
+	OrgName  string    // Substring of the reporter name
+	From     time.Time // Reports whose date range begins at or after From, when set
+	To       time.Time // Reports whose date range begins before To, when set
+}
+
+// ParseSource parses an IP address, as a network of that address only,
+// or a network in CIDR notation, e.g. "203.0.113.7" or "203.0.113.0/24".
+func ParseSource(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q: %w", s, err)
+	}
+
+	return network, nil
+}
+
+// Search returns reports with records matching q, with those records only,
+// sorted by date range begin. Reports are selected by what counts.json
+// records of them, see Refresh, so only reports with matching records are parsed.
+func (s *Store) Search(ctx context.Context, q SearchQuery) ([]dmark.Feedback, error) {
+	q.Domain = strings.ToLower(q.Domain)
+	q.Selector = strings.ToLower(q.Selector)
+	q.OrgName = strings.ToLower(q.OrgName)
+
+	counted, err := s.countedReports(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, counts := range counted {
+		if q.selects(counts) {
+			names = append(names, counts.name)
+		}
+	}
+
+	result := []dmark.Feedback{}
+	err = s.reports.get(ctx, names, func(report *dmark.Feedback) error {
+		policyDomain := strings.ToLower(report.PolicyPublished.Domain)
+		records := []dmark.Record{}
+		for _, record := range report.Records {
+			if q.matches(policyDomain, record) {
+				records = append(records, record)
+			}
+		}
+		if len(records) > 0 {
+			report.Records = records
+			result = append(result, *report)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ReportMetadata.DateRange.Begin < result[j].ReportMetadata.DateRange.Begin
+	})
+
+	return result, nil
+}
+
+// selects reports whether the report may have matching records.
+func (q SearchQuery) selects(counts reportCounts) bool {
+	if q.ReportID != "" && counts.ReportID != q.ReportID {
+		return false
+	}
+	if q.OrgName != "" && !strings.Contains(strings.ToLower(counts.OrgName), q.OrgName) {
+		return false
+	}
+
+	begin, _ := counts.DateRange.Times()
+	if !(Query{From: q.From, To: q.To}).matches("", begin) {
+		return false
+	}
+
+	if q.Source != nil && !anySource(counts.Sources, q.Source) {
+		return false
+	}
+	if q.Domain != "" && !strings.Contains(counts.Domain, q.Domain) && !anyContains(counts.Domains, q.Domain) {
+		return false
+	}
+	if i := sort.SearchStrings(counts.Selectors, q.Selector); q.Selector != "" && (i == len(counts.Selectors) || counts.Selectors[i] != q.Selector) {
+		return false
+	}
+
+	return true
+}
+
+// matches reports whether the record of a selected report matches.
+func (q SearchQuery) matches(policyDomain string, record dmark.Record) bool {
+	if q.Source != nil && !q.Source.Contains(record.Row.SourceIP) {
+		return false
+	}
+	if q.Domain != "" && !strings.Contains(policyDomain, q.Domain) && !anyContains(recordDomains(record), q.Domain) {
+		return false
+	}
+	if q.Selector != "" {
+		found := false
+		for _, dkim := range record.AuthResult.DKIM {
+			found = found || strings.EqualFold(dkim.Selector, q.Selector)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordDomains returns the lower-cased domains of the record: header from,
+// envelope from and to, and of DKIM signatures and SPF checks.
+func recordDomains(record dmark.Record) []string {
+	domains := []string{
+		record.Identifiers.HeaderFrom,
+		record.Identifiers.EnvelopeFrom,
+		record.Identifiers.EnvelopeTo,
+	}
+	for _, dkim := range record.AuthResult.DKIM {
+		domains = append(domains, dkim.Domain)
+	}
+	for _, spf := range record.AuthResult.SPF {
+		domains = append(domains, spf.Domain)
+	}
+
+	result := domains[:0]
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			result = append(result, domain)
+		}
+	}
+
+	return result
+}
+
+func anySource(sources []dmark.SourceSummary, network *net.IPNet) bool {
+	for _, source := range sources {
+		if network.Contains(source.SourceIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// anyContains reports whether any of values contains substr.
+func anyContains(values []string, substr string) bool {
+	for _, value := range values {
+		if strings.Contains(value, substr) {
+			return true
+		}
+	}
+
+	return false
+}
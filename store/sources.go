@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// SourceHistory is what the store knows about a single source IP.
+// Days include rollups of pruned reports; other fields come from raw reports only.
+type SourceHistory struct {
+	dmark.Counts
+	SourceIP net.IP         `json:"source_ip"`
+	Days     []DomainDay    `json:"days"`    // Daily counts per policy domain, sorted by day, then domain
+	Domains  []SourceDomain `json:"domains"` // Sorted by messages
+	Results  []SourceResult `json:"results"` // Sorted by messages
+	Reports  []SourceReport `json:"reports"` // Sorted by date range begin
+}
+
+// SourceDomain counts messages a source sent as a header from domain.
+type SourceDomain struct {
+	dmark.Counts
+	HeaderFrom string `json:"header_from"`
+}
+
+// SourceResult counts messages of a source with the same evaluation and authentication results.
+type SourceResult struct {
+	PolicyEvaluated dmark.PolicyEvaluated `json:"policy_evaluated"`
+	AuthResult      dmark.AuthResult      `json:"auth_results"`
+	Messages        int                   `json:"messages"`
+}
+
+// SourceReport is a report a source appears in, with counts of its records of the source.
+type SourceReport struct {
+	dmark.Counts
+	OrgName   string          `json:"org_name"`
+	ReportID  string          `json:"report_id"`
+	Domain    string          `json:"domain"` // Policy domain
+	DateRange dmark.DateRange `json:"date_range"`
+	Origin    *dmark.Origin   `json:"origin,omitempty"` // The raw report file
+}
+
+// Sources aggregates raw reports and rollups by source IP,
+// sorted like dmark.Sources, by failed messages, then by total messages.
+// Raw reports are read from the daily table in counts.json, see Refresh.
+func (s *Store) Sources(ctx context.Context) ([]dmark.SourceSummary, error) {
+	rows, err := s.countedDaily(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rollups, err := s.Rollups()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []dmark.SourceSummary{}
+	index := map[string]int{}
+	add := func(ip net.IP, counts dmark.Counts) {
+		key := ip.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(sources)
+			index[key] = i
+			sources = append(sources, dmark.SourceSummary{SourceIP: ip})
+		}
+		sources[i].Merge(counts)
+	}
+	for _, row := range rows {
+		add(row.SourceIP, row.Counts)
+	}
+	for _, rollup := range rollups {
+		add(rollup.SourceIP, rollup.Counts)
+	}
+
+	sort.SliceStable(sources, func(i, j int) bool {
+		if sources[i].Failed() != sources[j].Failed() {
+			return sources[i].Failed() > sources[j].Failed()
+		}
+		if sources[i].Messages != sources[j].Messages {
+			return sources[i].Messages > sources[j].Messages
+		}
+		return sources[i].SourceIP.String() < sources[j].SourceIP.String()
+	})
+
+	return sources, nil
+}
+
+// Source returns the history of a source IP. The history is empty when the store
+// has no records of the source.
+func (s *Store) Source(ctx context.Context, ip net.IP) (SourceHistory, error) {
+	history := SourceHistory{
+		SourceIP: ip,
+		Days:     []DomainDay{},
+		Domains:  []SourceDomain{},
+		Results:  []SourceResult{},
+		Reports:  []SourceReport{},
+	}
+
+	reports, err := s.Reports(ctx)
+	if err != nil {
+		return history, err
+	}
+	rollups, err := s.Rollups()
+	if err != nil {
+		return history, err
+	}
+
+	days := map[string]*DomainDay{}
+	day := func(t time.Time, domain string) *DomainDay {
+		key := t.Format("2006-01-02") + " " + domain
+		d, ok := days[key]
+		if !ok {
+			d = &DomainDay{Day: t, Domain: domain}
+			days[key] = d
+		}
+		return d
+	}
+	domains := map[string]*SourceDomain{}
+	results := map[string]*SourceResult{}
+
+	for _, report := range reports {
+		var sourceReport *SourceReport
+		domain := strings.ToLower(report.PolicyPublished.Domain)
+		begin, _ := report.ReportMetadata.DateRange.Times()
+		begin = begin.UTC().Truncate(24 * time.Hour)
+
+		for _, record := range report.Records {
+			if !record.Row.SourceIP.Equal(ip) {
+				continue
+			}
+
+			if sourceReport == nil {
+				history.Reports = append(history.Reports, SourceReport{
+					OrgName:   report.ReportMetadata.OrgName,
+					ReportID:  report.ReportMetadata.ReportID,
+					Domain:    domain,
+					DateRange: report.ReportMetadata.DateRange,
+					Origin:    report.Origin,
+				})
+				sourceReport = &history.Reports[len(history.Reports)-1]
+			}
+			sourceReport.Add(record)
+			history.Add(record)
+			day(begin, domain).Add(record)
+
+			headerFrom := strings.ToLower(record.Identifiers.HeaderFrom)
+			d, ok := domains[headerFrom]
+			if !ok {
+				d = &SourceDomain{HeaderFrom: headerFrom}
+				domains[headerFrom] = d
+			}
+			d.Add(record)
+
+			evaluated := record.Row.PolicyEvaluated
+			evaluated.Reason = nil
+			key := fmt.Sprintf("%v %v", evaluated, record.AuthResult)
+			r, ok := results[key]
+			if !ok {
+				r = &SourceResult{PolicyEvaluated: evaluated, AuthResult: record.AuthResult}
+				results[key] = r
+			}
+			r.Messages += record.Row.Count
+		}
+	}
+
+	for _, rollup := range rollups {
+		if !rollup.SourceIP.Equal(ip) {
+			continue
+		}
+		history.Merge(rollup.Counts)
+		day(rollup.Day, rollup.Domain).Merge(rollup.Counts)
+	}
+
+	for _, d := range days {
+		history.Days = append(history.Days, *d)
+	}
+	sort.Slice(history.Days, func(i, j int) bool {
+		if !history.Days[i].Day.Equal(history.Days[j].Day) {
+			return history.Days[i].Day.Before(history.Days[j].Day)
+		}
+		return history.Days[i].Domain < history.Days[j].Domain
+	})
+
+	for _, d := range domains {
+		history.Domains = append(history.Domains, *d)
+	}
+	sort.Slice(history.Domains, func(i, j int) bool {
+		if history.Domains[i].Messages != history.Domains[j].Messages {
+			return history.Domains[i].Messages > history.Domains[j].Messages
+		}
+		return history.Domains[i].HeaderFrom < history.Domains[j].HeaderFrom
+	})
+
+	for _, r := range results {
+		history.Results = append(history.Results, *r)
+	}
+	sort.SliceStable(history.Results, func(i, j int) bool {
+		if history.Results[i].Messages != history.Results[j].Messages {
+			return history.Results[i].Messages > history.Results[j].Messages
+		}
+		return fmt.Sprint(history.Results[i]) < fmt.Sprint(history.Results[j])
+	})
+
+	sort.SliceStable(history.Reports, func(i, j int) bool {
+		return history.Reports[i].DateRange.Begin < history.Reports[j].DateRange.Begin
+	})
+
+	return history, nil
+}
@@ -0,0 +1,199 @@
+// Package store keeps DMARC reports in a directory:
+// raw reports as XML files, or in reports.db with OpenBolt, their counts by
+// source IP and day in counts.json and counts.log, daily aggregates of pruned reports in rollups.json,
+// API tokens in tokens.json, tags of sources in tags.json, DNS changes in
+// changes.json and the layout version in schema.json.
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chuhlomin/dmark-go"
+)
+
+// Store is a directory of reports.
+type Store struct {
+	dir     string
+	reports rawReports
+	counts  *countsCache
+	owned   bool     // Whether Close closes reports, false for views
+	domains []string // Policy domains visible through the store, all when empty
+}
+
+// Open returns the store in dir, creating the directory if needed.
+// Raw reports are XML files in the directory, unless it has reports.db,
+// see OpenBolt. Stores of an older layout are upgraded first; stores of
+// a newer one fail with ErrNewerSchema.
+func Open(dir string) (*Store, error) {
+	if _, err := os.Stat(filepath.Join(dir, boltFile)); err == nil {
+		return OpenBolt(dir)
+	}
+
+	return open(dir, dirReports{dir: dir})
+}
+
+// OpenBolt is like Open, but keeps raw reports in a BoltDB file, reports.db
+// in dir, indexed by policy domain and date range, for single-binary setups
+// that query a domain or a period of many reports. The file is locked while
+// reports are used: other processes fail to use them until the store is
+// closed with Close. XML files in dir are not read; import them with an Importer.
+func OpenBolt(dir string) (*Store, error) {
+	reports := &boltReports{path: filepath.Join(dir, boltFile)}
+	s, err := open(dir, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	// create the file, so Open finds it
+	if _, err = os.Stat(reports.path); os.IsNotExist(err) {
+		if _, err = reports.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func open(dir string, reports rawReports) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create dir %q: %w", dir, err)
+	}
+
+	s := &Store{dir: dir, reports: reports, owned: true, counts: &countsCache{}}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close releases the store, closing reports.db of stores opened with OpenBolt
+// once all stores of the directory in the process are closed.
+// Views returned by Domains are closed with their store.
+func (s *Store) Close() error {
+	if !s.owned {
+		return nil
+	}
+	s.owned = false
+
+	return s.reports.close()
+}
+
+// Dir returns the store directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Check verifies that the store directory can be read and written to.
+func (s *Store) Check() error {
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	_, err = dir.Readdirnames(1)
+	dir.Close()
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("read dir: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, ".check-*")
+	if err != nil {
+		return fmt.Errorf("write to dir: %w", err)
+	}
+	f.Close()
+
+	if err = os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("remove check file: %w", err)
+	}
+
+	return nil
+}
+
+// Save stores a raw report, see dmark.SaveFile. Stores opened with OpenBolt
+// return the path of reports.db joined with the name of the report in it,
+// and fail for reports that cannot be parsed, as they are indexed.
+// Saved reports are counted right away, see Refresh.
+func (s *Store) Save(file dmark.File) (path string, saved bool, err error) {
+	path, saved, err = s.reports.save(file)
+	if err != nil || !saved {
+		return path, saved, err
+	}
+
+	// reports failing to parse or be counted are parsed by Refresh instead
+	report, err := dmark.ParseBytes(file.Content)
+	if err == nil {
+		err = appendCounts(s.dir, filepath.Base(path), countReport(report))
+	}
+	if err != nil {
+		slog.Warn("Failed to count report", "path", path, "err", err)
+	}
+
+	return path, true, nil
+}
+
+// Has reports whether the store already has the raw report.
+func (s *Store) Has(file dmark.File) (bool, error) {
+	return s.reports.has(file)
+}
+
+// Reports parses all raw reports in the store, ordered by name, with their
+// origin: the file name, its SHA-256 and the time it was saved.
+func (s *Store) Reports(ctx context.Context) ([]dmark.Feedback, error) {
+	return s.Query(ctx, Query{})
+}
+
+// Query is like Reports, but returns reports matching q only. Stores opened
+// with OpenBolt read matching reports only; others parse all of them.
+func (s *Store) Query(ctx context.Context, q Query) ([]dmark.Feedback, error) {
+	reports := []dmark.Feedback{}
+	err := s.Each(ctx, q, func(report *dmark.Feedback) error {
+		reports = append(reports, *report)
+		return nil
+	})
+
+	return reports, err
+}
+
+// Each calls fn with each raw report matching q, like Query, one at a time
+// instead of keeping them all in memory. It stops at the first error of fn.
+func (s *Store) Each(ctx context.Context, q Query, fn func(report *dmark.Feedback) error) error {
+	return s.reports.each(ctx, q, func(report *dmark.Feedback) error {
+		if !s.visible(report.PolicyPublished.Domain) {
+			return nil
+		}
+		return fn(report)
+	})
+}
+
+// Domains returns a read-only view of the store with reports and rollups of the
+// given policy domains and their subdomains only, for access restricted by domain.
+// Save is not restricted; Prune fails.
+func (s *Store) Domains(domains ...string) *Store {
+	view := &Store{dir: s.dir, reports: s.reports, counts: s.counts}
+	for _, domain := range domains {
+		view.domains = append(view.domains, strings.TrimSuffix(strings.ToLower(domain), "."))
+	}
+
+	return view
+}
+
+func (s *Store) visible(domain string) bool {
+	if len(s.domains) == 0 {
+		return true
+	}
+
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, d := range s.domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
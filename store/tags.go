@@ -0,0 +1,159 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const tagsFile = "tags.json"
+
+// ErrTagNotFound is returned by RemoveTag for unknown IDs.
+var ErrTagNotFound = errors.New("tag not found")
+
+// Tag labels a source IP or network, like "approved vendor",
+// "known spoofing campaign" or "ticket-1234", for its records in all reports
+// or in one report only. Tags are kept in tags.json of the store.
+type Tag struct {
+	ID       string    `json:"id"`
+	Source   string    `json:"source"`              // IP address or network in CIDR notation, see ParseSource
+	ReportID string    `json:"report_id,omitempty"` // Tags records of the report only, when set
+	Label    string    `json:"label"`
+	Note     string    `json:"note,omitempty"`
+	Author   string    `json:"author,omitempty"` // Dashboard user or API token name
+	Created  time.Time `json:"created"`
+}
+
+// Matches reports whether the tag applies to records of the source IP
+// in the report with the ID.
+func (t Tag) Matches(reportID string, ip net.IP) bool {
+	if t.ReportID != "" && t.ReportID != reportID {
+		return false
+	}
+
+	network, err := ParseSource(t.Source)
+	return err == nil && network.Contains(ip)
+}
+
+// TagsOf returns tags applying to the source IP in any report.
+func TagsOf(tags []Tag, ip net.IP) []Tag {
+	result := []Tag{}
+	for _, tag := range tags {
+		if network, err := ParseSource(tag.Source); err == nil && network.Contains(ip) {
+			result = append(result, tag)
+		}
+	}
+
+	return result
+}
+
+// LoadTags reads tags from tags.json of a store, for tools reading reports
+// elsewhere, like reports2html.
+func LoadTags(path string) ([]Tag, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []Tag{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tags: %w", err)
+	}
+
+	tags := []Tag{}
+	if err = json.Unmarshal(content, &tags); err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// Tags returns tags of the store, sorted by creation time.
+func (s *Store) Tags() ([]Tag, error) {
+	return LoadTags(filepath.Join(s.dir, tagsFile))
+}
+
+// AddTag validates the tag and adds it with a new ID and creation time,
+// returning the added tag.
+func (s *Store) AddTag(tag Tag) (Tag, error) {
+	tag.Label = strings.TrimSpace(tag.Label)
+	tag.ReportID = strings.TrimSpace(tag.ReportID)
+	if tag.Label == "" {
+		return tag, errors.New("tag needs a label")
+	}
+	network, err := ParseSource(strings.TrimSpace(tag.Source))
+	if err != nil {
+		return tag, err
+	}
+	if ones, bits := network.Mask.Size(); ones == bits {
+		tag.Source = network.IP.String()
+	} else {
+		tag.Source = network.String()
+	}
+
+	tags, err := s.Tags()
+	if err != nil {
+		return tag, err
+	}
+
+	random := make([]byte, 6)
+	if _, err = rand.Read(random); err != nil {
+		return tag, fmt.Errorf("generate tag ID: %w", err)
+	}
+	tag.ID = hex.EncodeToString(random)
+	tag.Created = time.Now().UTC().Truncate(time.Second)
+
+	if err = s.writeTags(append(tags, tag)); err != nil {
+		return tag, err
+	}
+
+	return tag, nil
+}
+
+// RemoveTag removes the tag with the ID.
+func (s *Store) RemoveTag(id string) error {
+	tags, err := s.Tags()
+	if err != nil {
+		return err
+	}
+
+	kept := tags[:0]
+	for _, tag := range tags {
+		if tag.ID != id {
+			kept = append(kept, tag)
+		}
+	}
+	if len(kept) == len(tags) {
+		return fmt.Errorf("%w: %q", ErrTagNotFound, id)
+	}
+
+	return s.writeTags(kept)
+}
+
+func (s *Store) writeTags(tags []Tag) error {
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Created.Before(tags[j].Created)
+	})
+
+	content, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode tags: %w", err)
+	}
+
+	tmp := filepath.Join(s.dir, tagsFile+".tmp")
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("write tags: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, tagsFile)); err != nil {
+		return fmt.Errorf("replace tags: %w", err)
+	}
+
+	return nil
+}
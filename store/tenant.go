@@ -0,0 +1,54 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// tenantsDir is the directory of tenant stores, see Store.Tenant.
+const tenantsDir = "tenants"
+
+var tenantID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Tenant returns the store of a tenant in tenants/<id> of the store directory,
+// creating it if needed. Reports of a tenant are only visible through its store:
+// neither the parent store nor other tenants read them.
+// IDs are up to 64 letters, digits, "-" and "_". Tenants of stores opened
+// with OpenBolt keep raw reports in their own reports.db; close them with Close.
+func (s *Store) Tenant(id string) (*Store, error) {
+	if !tenantID.MatchString(id) {
+		return nil, fmt.Errorf("invalid tenant ID %q", id)
+	}
+
+	dir := filepath.Join(s.dir, tenantsDir, id)
+	if _, ok := s.reports.(*boltReports); ok {
+		return OpenBolt(dir)
+	}
+
+	return Open(dir)
+}
+
+// Tenants returns IDs of tenants with stores, sorted.
+func (s *Store) Tenants() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, tenantsDir))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tenants dir: %w", err)
+	}
+
+	ids := []string{}
+	for _, f := range files {
+		if f.IsDir() && tenantID.MatchString(f.Name()) {
+			ids = append(ids, f.Name())
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
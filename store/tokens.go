@@ -0,0 +1,167 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const tokensFile = "tokens.json"
+
+// Token scopes.
+const (
+	ScopeIngest = "ingest" // Upload reports
+	ScopeRead   = "read"   // Read reports and counts
+	ScopeTag    = "tag"    // Add and remove tags of sources, see AddTag
+)
+
+// tokenPrefix starts token secrets, to tell them apart in configs and logs.
+const tokenPrefix = "dmk_"
+
+// Token is an API token of the store. Only a hash of its secret is kept.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Hash    string    `json:"hash"` // Hex SHA-256 of the secret
+	Created time.Time `json:"created"`
+}
+
+// Allows reports whether the token has the scope.
+func (t Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tokens returns API tokens of the store, sorted by creation time.
+func (s *Store) Tokens() ([]Token, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, tokensFile))
+	if os.IsNotExist(err) {
+		return []Token{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tokens: %w", err)
+	}
+
+	tokens := []Token{}
+	if err = json.Unmarshal(content, &tokens); err != nil {
+		return nil, fmt.Errorf("decode tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// CreateToken adds an API token with the scopes and returns its secret,
+// which is shown once: the store keeps only its hash.
+func (s *Store) CreateToken(name string, scopes []string) (secret string, token Token, err error) {
+	if len(scopes) == 0 {
+		return "", token, errors.New("token needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if scope != ScopeIngest && scope != ScopeRead && scope != ScopeTag {
+			return "", token, fmt.Errorf("unknown scope %q, expected %s, %s or %s", scope, ScopeIngest, ScopeRead, ScopeTag)
+		}
+	}
+
+	tokens, err := s.Tokens()
+	if err != nil {
+		return "", token, err
+	}
+
+	random := make([]byte, 30)
+	if _, err = rand.Read(random); err != nil {
+		return "", token, fmt.Errorf("generate token: %w", err)
+	}
+	secret = tokenPrefix + base64.RawURLEncoding.EncodeToString(random[6:])
+
+	token = Token{
+		ID:      hex.EncodeToString(random[:6]),
+		Name:    name,
+		Scopes:  scopes,
+		Hash:    hashToken(secret),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	if err = s.writeTokens(append(tokens, token)); err != nil {
+		return "", token, err
+	}
+
+	return secret, token, nil
+}
+
+// RevokeToken removes the API token with the ID.
+func (s *Store) RevokeToken(id string) error {
+	tokens, err := s.Tokens()
+	if err != nil {
+		return err
+	}
+
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if token.ID != id {
+			kept = append(kept, token)
+		}
+	}
+	if len(kept) == len(tokens) {
+		return fmt.Errorf("token %q not found", id)
+	}
+
+	return s.writeTokens(kept)
+}
+
+// LookupToken returns the API token with the secret.
+func (s *Store) LookupToken(secret string) (Token, bool, error) {
+	tokens, err := s.Tokens()
+	if err != nil {
+		return Token{}, false, err
+	}
+
+	hash := []byte(hashToken(secret))
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(token.Hash)) == 1 {
+			return token, true, nil
+		}
+	}
+
+	return Token{}, false, nil
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) writeTokens(tokens []Token) error {
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+
+	content, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode tokens: %w", err)
+	}
+
+	tmp := filepath.Join(s.dir, tokensFile+".tmp")
+	if err = ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("write tokens: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, tokensFile)); err != nil {
+		return fmt.Errorf("replace tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package dmark
+
+import (
+	"sort"
+	"strings"
+)
+
+// SubdomainSummary aggregates records of messages using a subdomain of their
+// policy domain in header_from or envelope_from. Subdomains in header_from are
+// under sp=; sending ones nobody remembers fail DMARC once it is raised.
+type SubdomainSummary struct {
+	Counts
+	Domain       string `json:"domain"`        // The subdomain, lower-cased
+	PolicyDomain string `json:"policy_domain"` // The domain of reports it was seen in
+	HeaderFrom   int    `json:"header_from"`   // Messages with the subdomain in header_from
+	EnvelopeFrom int    `json:"envelope_from"` // Messages with the subdomain in envelope_from
+	Sources      int    `json:"sources"`       // Source IPs sending as the subdomain
+}
+
+// Subdomains aggregates records by subdomains of the policy domain of their
+// reports in header_from and envelope_from (or the domain SPF checked); a record
+// using the subdomain in both is counted once. Summaries are sorted by policy
+// domain, then by messages failing DMARC, then by total messages.
+func Subdomains(reports []Feedback) []SubdomainSummary {
+	subdomains := map[[2]string]*SubdomainSummary{} // By policy domain and subdomain
+	sources := map[[2]string]map[string]bool{}
+	for _, report := range reports {
+		policyDomain := strings.TrimSuffix(strings.ToLower(report.PolicyPublished.Domain), ".")
+		for _, record := range report.Records {
+			headerFrom := subdomainOf(record.Identifiers.HeaderFrom, policyDomain)
+			envelopeFrom := subdomainOf(record.envelopeFrom(), policyDomain)
+
+			for i, domain := range []string{headerFrom, envelopeFrom} {
+				if domain == "" || (i == 1 && domain == headerFrom) {
+					continue
+				}
+
+				key := [2]string{policyDomain, domain}
+				subdomain, ok := subdomains[key]
+				if !ok {
+					subdomain = &SubdomainSummary{Domain: domain, PolicyDomain: policyDomain}
+					subdomains[key] = subdomain
+					sources[key] = map[string]bool{}
+				}
+				subdomain.Add(record)
+				if domain == headerFrom {
+					subdomain.HeaderFrom += record.Row.Count
+				}
+				if domain == envelopeFrom {
+					subdomain.EnvelopeFrom += record.Row.Count
+				}
+				sources[key][record.Row.SourceIP.String()] = true
+			}
+		}
+	}
+
+	result := make([]SubdomainSummary, 0, len(subdomains))
+	for key, subdomain := range subdomains {
+		subdomain.Sources = len(sources[key])
+		result = append(result, *subdomain)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.PolicyDomain != b.PolicyDomain {
+			return a.PolicyDomain < b.PolicyDomain
+		}
+		if a.Failed() != b.Failed() {
+			return a.Failed() > b.Failed()
+		}
+		if a.Messages != b.Messages {
+			return a.Messages > b.Messages
+		}
+		return a.Domain < b.Domain
+	})
+
+	return result
+}
+
+// envelopeFrom returns the envelope_from domain of the record, or the domain
+// SPF checked when the reporter left it out, unless that was the HELO domain.
+func (r Record) envelopeFrom() string {
+	if r.Identifiers.EnvelopeFrom != "" {
+		return r.Identifiers.EnvelopeFrom
+	}
+	for _, result := range r.AuthResult.SPF {
+		if result.Scope != SPFDomainScopeHelo {
+			return result.Domain
+		}
+	}
+
+	return ""
+}
+
+// subdomainOf returns the domain, normalized, when it is a subdomain of
+// the parent, or an empty string.
+func subdomainOf(domain, parent string) string {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if parent == "" || !strings.HasSuffix(domain, "."+parent) {
+		return ""
+	}
+
+	return domain
+}
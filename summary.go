@@ -0,0 +1,486 @@
+package dmark
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Counts holds message counts aggregated over records.
+type Counts struct {
+	Messages    int `json:"messages"`
+	Passed      int `json:"passed"`      // Messages passing DMARC: aligned DKIM or SPF pass
+	DKIMPassed  int `json:"dkim_passed"` // Messages with aligned DKIM pass
+	SPFPassed   int `json:"spf_passed"`  // Messages with aligned SPF pass
+	Quarantined int `json:"quarantined"`
+	Rejected    int `json:"rejected"`
+}
+
+// Add counts messages of the record.
+func (c *Counts) Add(record Record) {
+	count := record.Row.Count
+	evaluated := record.Row.PolicyEvaluated
+
+	c.Messages += count
+	if evaluated.DKIM || evaluated.SPF {
+		c.Passed += count
+	}
+	if evaluated.DKIM {
+		c.DKIMPassed += count
+	}
+	if evaluated.SPF {
+		c.SPFPassed += count
+	}
+
+	switch evaluated.Disposition {
+	case DispositionQuarantine:
+		c.Quarantined += count
+	case DispositionReject:
+		c.Rejected += count
+	}
+}
+
+// Merge adds other counts.
+func (c *Counts) Merge(other Counts) {
+	c.Messages += other.Messages
+	c.Passed += other.Passed
+	c.DKIMPassed += other.DKIMPassed
+	c.SPFPassed += other.SPFPassed
+	c.Quarantined += other.Quarantined
+	c.Rejected += other.Rejected
+}
+
+// Failed returns the number of messages failing DMARC.
+func (c Counts) Failed() int {
+	return c.Messages - c.Passed
+}
+
+// PassRate returns the share of messages passing DMARC, from 0 to 1.
+func (c Counts) PassRate() float64 {
+	if c.Messages == 0 {
+		return 0
+	}
+
+	return float64(c.Passed) / float64(c.Messages)
+}
+
+// Sampling counts messages failing DMARC under a quarantine or reject policy,
+// telling how many of them the policy was applied to when pct is below 100.
+type Sampling struct {
+	Enforceable int `json:"enforceable"` // Messages failing DMARC under a quarantine or reject policy
+	Enforced    int `json:"enforced"`    // Of them, quarantined or rejected
+	SampledOut  int `json:"sampled_out"` // Of them, delivered with the sampled_out override reason
+}
+
+// Add counts messages of the record under the policy published in its report.
+func (s *Sampling) Add(record Record, policy PolicyPublished) {
+	evaluated := record.Row.PolicyEvaluated
+	if evaluated.DKIM || evaluated.SPF || policy.PolicyFor(record.fromDomain(policy), false) <= DispositionNone {
+		return
+	}
+
+	count := record.Row.Count
+	s.Enforceable += count
+	if evaluated.Disposition == DispositionQuarantine || evaluated.Disposition == DispositionReject {
+		s.Enforced += count
+	}
+	for _, reason := range evaluated.Reason {
+		if reason.Type == PolicyOverrideSampledOut {
+			s.SampledOut += count
+			break
+		}
+	}
+}
+
+// Merge adds other counts.
+func (s *Sampling) Merge(other Sampling) {
+	s.Enforceable += other.Enforceable
+	s.Enforced += other.Enforced
+	s.SampledOut += other.SampledOut
+}
+
+// Coverage estimates the effective enforcement coverage: the share of
+// enforceable messages quarantined or rejected, from 0 to 1, or 1 when
+// there are none. Well below 1 with few messages sampled out, receivers
+// override the policy for other reasons, e.g. forwarding; close to pct
+// with no other failing sources left, raising pct is safe.
+func (s Sampling) Coverage() float64 {
+	if s.Enforceable == 0 {
+		return 1
+	}
+
+	return float64(s.Enforced) / float64(s.Enforceable)
+}
+
+// DomainSummary aggregates reports for a single policy domain.
+type DomainSummary struct {
+	Counts
+	Domain    string          `json:"domain"`
+	Policy    PolicyPublished `json:"policy"` // The policy from the most recent report
+	Reports   int             `json:"reports"`
+	DateRange DateRange       `json:"date_range"`
+	Score     Score           `json:"score"`
+	Sampling  Sampling        `json:"sampling"`
+	Sources   []SourceSummary `json:"sources"` // Sorted like Sources
+
+	Recipients []RecipientSummary `json:"recipients"` // Sorted by messages, most first
+	Overrides  []OverrideSummary  `json:"overrides"`  // Sorted like Overrides
+	Receivers  []ReceiverSummary  `json:"receivers"`  // Sorted by messages, most first
+}
+
+// Summary aggregates a set of reports.
+type Summary struct {
+	Counts
+	Reports   int             `json:"reports"`
+	Sampling  Sampling        `json:"sampling"`
+	DateRange DateRange       `json:"date_range"` // From the earliest begin to the latest end
+	Domains   []DomainSummary `json:"domains"`    // Sorted by domain name
+
+	Recipients []RecipientSummary `json:"recipients"` // Of all policy domains, sorted by messages, most first
+	Overrides  []OverrideSummary  `json:"overrides"`  // Of all policy domains, sorted like Overrides
+	Receivers  []ReceiverSummary  `json:"receivers"`  // Of all policy domains, sorted by messages, most first
+}
+
+// RecipientSummary aggregates records of messages sent to a recipient domain,
+// the envelope_to identifier. Reporters receiving mail for many domains,
+// e.g. hosting providers, tell which of them are targeted.
+// Records without envelope_to are not counted.
+type RecipientSummary struct {
+	Counts
+	EnvelopeTo string `json:"envelope_to"`
+}
+
+// ReceiverSummary aggregates reports of a single receiver, by the org_name
+// of report metadata, to compare how receivers evaluate the same mail:
+// a source passing DKIM at one receiver and failing it at another often
+// has a problem only some of them see, like a long key or a broken relay.
+type ReceiverSummary struct {
+	Counts
+	OrgName string `json:"org_name"`
+	Reports int    `json:"reports"`
+}
+
+// Summarize aggregates reports into a Summary.
+func Summarize(reports []Feedback) Summary {
+	summary := Summary{Domains: []DomainSummary{}}
+	domains := map[string]*DomainSummary{}
+	sources := map[string]map[string]*Counts{}    // Per domain, per source IP
+	recipients := map[string]map[string]*Counts{} // Per domain, per envelope_to, "" for all domains
+	recipients[""] = map[string]*Counts{}
+	overrides := map[string]overrideCounts{"": {}}              // Per domain, "" for all domains
+	receivers := map[string]map[string]*ReceiverSummary{"": {}} // Per domain, per org_name, "" for all domains
+
+	for _, report := range reports {
+		name := strings.ToLower(report.PolicyPublished.Domain)
+		domain, ok := domains[name]
+		if !ok {
+			domain = &DomainSummary{Domain: name}
+			domains[name] = domain
+			sources[name] = map[string]*Counts{}
+			recipients[name] = map[string]*Counts{}
+			overrides[name] = overrideCounts{}
+			receivers[name] = map[string]*ReceiverSummary{}
+		}
+
+		dateRange := report.ReportMetadata.DateRange.Normalized()
+		if domain.Reports == 0 || dateRange.End >= domain.DateRange.End {
+			domain.Policy = report.PolicyPublished
+		}
+
+		summary.Reports++
+		domain.Reports++
+		summary.DateRange = extendDateRange(summary.DateRange, dateRange)
+		domain.DateRange = extendDateRange(domain.DateRange, dateRange)
+
+		orgName := strings.TrimSpace(report.ReportMetadata.OrgName)
+		reportReceivers := make([]*ReceiverSummary, 0, 2)
+		for _, key := range []string{"", name} {
+			receiver, ok := receivers[key][orgName]
+			if !ok {
+				receiver = &ReceiverSummary{OrgName: orgName}
+				receivers[key][orgName] = receiver
+			}
+			receiver.Reports++
+			reportReceivers = append(reportReceivers, receiver)
+		}
+
+		for _, record := range report.Records {
+			summary.Add(record)
+			domain.Add(record)
+			summary.Sampling.Add(record, report.PolicyPublished)
+			domain.Sampling.Add(record, report.PolicyPublished)
+			overrides[""].add(report.ReportMetadata.OrgName, record)
+			overrides[name].add(report.ReportMetadata.OrgName, record)
+			for _, receiver := range reportReceivers {
+				receiver.Add(record)
+			}
+
+			source, ok := sources[name][record.Row.SourceIP.String()]
+			if !ok {
+				source = &Counts{}
+				sources[name][record.Row.SourceIP.String()] = source
+			}
+			source.Add(record)
+
+			if to := strings.ToLower(strings.TrimSpace(record.Identifiers.EnvelopeTo)); to != "" {
+				for _, key := range []string{"", name} {
+					recipient, ok := recipients[key][to]
+					if !ok {
+						recipient = &Counts{}
+						recipients[key][to] = recipient
+					}
+					recipient.Add(record)
+				}
+			}
+		}
+	}
+
+	for name, domain := range domains {
+		unknown := 0
+		domain.Sources = make([]SourceSummary, 0, len(sources[name]))
+		for ip, source := range sources[name] {
+			if source.Passed == 0 {
+				unknown += source.Messages
+			}
+			domain.Sources = append(domain.Sources, SourceSummary{Counts: *source, SourceIP: net.ParseIP(ip)})
+		}
+		sortSources(domain.Sources)
+		domain.Score = ComplianceScore(domain.Policy, domain.Counts, unknown)
+		domain.Recipients = recipientSummaries(recipients[name])
+		domain.Overrides = overrides[name].summaries()
+		domain.Receivers = receiverSummaries(receivers[name])
+
+		summary.Domains = append(summary.Domains, *domain)
+	}
+	sort.Slice(summary.Domains, func(i, j int) bool {
+		return summary.Domains[i].Domain < summary.Domains[j].Domain
+	})
+	summary.Recipients = recipientSummaries(recipients[""])
+	summary.Overrides = overrides[""].summaries()
+	summary.Receivers = receiverSummaries(receivers[""])
+
+	return summary
+}
+
+// recipientSummaries sorts counts by envelope_to by messages, then by domain.
+func recipientSummaries(counts map[string]*Counts) []RecipientSummary {
+	result := make([]RecipientSummary, 0, len(counts))
+	for to, c := range counts {
+		result = append(result, RecipientSummary{Counts: *c, EnvelopeTo: to})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+		return result[i].EnvelopeTo < result[j].EnvelopeTo
+	})
+
+	return result
+}
+
+// receiverSummaries sorts receivers by messages, then by org_name.
+func receiverSummaries(receivers map[string]*ReceiverSummary) []ReceiverSummary {
+	result := make([]ReceiverSummary, 0, len(receivers))
+	for _, receiver := range receivers {
+		result = append(result, *receiver)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+		return result[i].OrgName < result[j].OrgName
+	})
+
+	return result
+}
+
+func extendDateRange(dr, other DateRange) DateRange {
+	if dr.Begin == 0 || (other.Begin != 0 && other.Begin < dr.Begin) {
+		dr.Begin = other.Begin
+	}
+	if other.End > dr.End {
+		dr.End = other.End
+	}
+
+	return dr
+}
+
+// SourceSummary aggregates records sent from a single IP address.
+type SourceSummary struct {
+	Counts
+	SourceIP net.IP `json:"source_ip"`
+}
+
+// Sources aggregates records by source IP,
+// sorted by the number of messages failing DMARC, then by total messages.
+func Sources(reports []Feedback) []SourceSummary {
+	sources := map[string]*SourceSummary{}
+	for _, report := range reports {
+		for _, record := range report.Records {
+			key := record.Row.SourceIP.String()
+			source, ok := sources[key]
+			if !ok {
+				source = &SourceSummary{SourceIP: record.Row.SourceIP}
+				sources[key] = source
+			}
+			source.Add(record)
+		}
+	}
+
+	result := make([]SourceSummary, 0, len(sources))
+	for _, source := range sources {
+		result = append(result, *source)
+	}
+	sortSources(result)
+
+	return result
+}
+
+// sortSources sorts sources by the number of messages failing DMARC, then by total messages.
+func sortSources(sources []SourceSummary) {
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Failed() != sources[j].Failed() {
+			return sources[i].Failed() > sources[j].Failed()
+		}
+		if sources[i].Messages != sources[j].Messages {
+			return sources[i].Messages > sources[j].Messages
+		}
+		return sources[i].SourceIP.String() < sources[j].SourceIP.String()
+	})
+}
+
+// DayCounts holds counts for a single day.
+type DayCounts struct {
+	Counts
+	Day time.Time `json:"day"` // Midnight UTC
+}
+
+// DailyCounts aggregates records by the UTC day their report date range begins,
+// normalized by DateRange.Times, sorted by day. Days without reports are omitted.
+func DailyCounts(reports []Feedback) []DayCounts {
+	days := map[int64]*DayCounts{}
+	for _, report := range reports {
+		begin, _ := report.ReportMetadata.DateRange.Times()
+		day := begin.UTC().Truncate(24 * time.Hour)
+		counts, ok := days[day.Unix()]
+		if !ok {
+			counts = &DayCounts{Day: day}
+			days[day.Unix()] = counts
+		}
+		for _, record := range report.Records {
+			counts.Add(record)
+		}
+	}
+
+	result := make([]DayCounts, 0, len(days))
+	for _, counts := range days {
+		result = append(result, *counts)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Day.Before(result[j].Day)
+	})
+
+	return result
+}
+
+// DailyCountsIn aggregates records by day in the location, UTC when nil.
+// Records of reports whose date range spans several days are split
+// across the days proportionally to the overlap, see SplitDays;
+// date ranges are normalized first, see NormalizeRanges.
+func DailyCountsIn(reports []Feedback, loc *time.Location) []DayCounts {
+	days := map[int64]*DayCounts{}
+	ranges, _ := NormalizeRanges(reports)
+	for i, report := range reports {
+		if ranges[i] == (DateRange{}) {
+			continue // within another report
+		}
+		begin := time.Unix(int64(ranges[i].Begin), 0)
+		end := time.Unix(int64(ranges[i].End), 0)
+		for _, record := range report.Records {
+			for _, split := range SplitDays(begin, end, record.Row.Count, loc) {
+				counts, ok := days[split.Day.Unix()]
+				if !ok {
+					counts = &DayCounts{Day: split.Day}
+					days[split.Day.Unix()] = counts
+				}
+				record.Row.Count = split.Count
+				counts.Add(record)
+			}
+		}
+	}
+
+	result := make([]DayCounts, 0, len(days))
+	for _, counts := range days {
+		result = append(result, *counts)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Day.Before(result[j].Day)
+	})
+
+	return result
+}
+
+// DaySplit is the part of messages of a date range falling on a day.
+type DaySplit struct {
+	Day   time.Time // Midnight in the location
+	Count int
+}
+
+// SplitDays splits count messages of the range from begin to end across
+// the days in the location (UTC when nil) the range overlaps, proportionally
+// to the overlap. Counts are rounded by the largest remainder, so they add up
+// to count; days getting no messages are omitted. Days are 23 or 25 hours long
+// on daylight saving time changes.
+func SplitDays(begin, end time.Time, count int, loc *time.Location) []DaySplit {
+	if loc == nil {
+		loc = time.UTC
+	}
+	begin, end = begin.In(loc), end.In(loc)
+	day := time.Date(begin.Year(), begin.Month(), begin.Day(), 0, 0, 0, 0, loc)
+
+	total := int64(end.Sub(begin) / time.Second)
+	if total <= 0 {
+		return []DaySplit{{Day: day, Count: count}}
+	}
+
+	splits := []DaySplit{}
+	remainders := []int64{}
+	assigned := 0
+	for start := begin; start.Before(end); {
+		next := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+		stop := next
+		if end.Before(stop) {
+			stop = end
+		}
+
+		share := int64(count) * int64(stop.Sub(start)/time.Second)
+		splits = append(splits, DaySplit{Day: day, Count: int(share / total)})
+		remainders = append(remainders, share%total)
+		assigned += int(share / total)
+
+		start, day = stop, next
+	}
+
+	// the rest goes to days with the largest remainders, earlier days first on ties
+	order := make([]int, len(splits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	for i := 0; assigned < count; i++ {
+		splits[order[i%len(order)]].Count++
+		assigned++
+	}
+
+	result := splits[:0]
+	for _, split := range splits {
+		if split.Count > 0 {
+			result = append(result, split)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,346 @@
+// Package templatefuncs provides functions available to reports2html templates.
+//
+// Custom functions can be added with Register, either from a package
+// imported into a custom build, or from a Go plugin loaded with reports2html -plugin:
+//
+//	package main
+//
+//	import "github.com/chuhlomin/dmark-go/templatefuncs"
+//
+//	func init() {
+//		templatefuncs.Register("shout", strings.ToUpper)
+//	}
+package templatefuncs
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/dmark-go"
+	"github.com/chuhlomin/dmark-go/i18n"
+)
+
+var (
+	mu     sync.Mutex
+	custom = template.FuncMap{}
+)
+
+// Register makes fn available to templates under the given name,
+// replacing a built-in function with the same name.
+func Register(name string, fn interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	custom[name] = fn
+}
+
+// FuncMap returns built-in and registered functions, formatting in English.
+func FuncMap() template.FuncMap {
+	return LocalizedFuncMap(i18n.English)
+}
+
+// LocalizedFuncMap returns built-in and registered functions,
+// where formatTime, percent and formatNumber follow the locale and
+// t and tn translate text, see i18n.Locale Translate and Plural:
+//
+//	{{ t "Messages" }}: {{ tn "%s rejected" .Rejected }}
+func LocalizedFuncMap(locale *i18n.Locale) template.FuncMap {
+	funcs := template.FuncMap{
+		"string":        String,
+		"formatTime":    locale.FormatTime,
+		"percent":       locale.Percent,
+		"formatNumber":  locale.FormatNumber,
+		"t":             locale.Translate,
+		"tn":            locale.Plural,
+		"lang":          func() string { return locale.Lang },
+		"humanizeCount": HumanizeCount,
+		"countryFlag":   CountryFlag,
+		"passFailClass": PassFailClass,
+		"groupBy":       GroupBy,
+		"sortBy":        SortBy,
+		"sortRecords":   SortRecords,
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for name, fn := range custom {
+		funcs[name] = fn
+	}
+
+	return funcs
+}
+
+// String returns the text representation of val.
+func String(val encoding.TextMarshaler) string {
+	text, err := val.MarshalText()
+	if err != nil {
+		slog.Error("Failed to marshal text", "value", fmt.Sprintf("%T", val), "err", err)
+		return ""
+	}
+	return string(text)
+}
+
+// FormatTime formats seconds since epoch in UTC,
+// using the optional layout or "2006-01-02 15:04:05 UTC".
+func FormatTime(epoch int, layout ...string) string {
+	l := "2006-01-02 15:04:05 UTC"
+	if len(layout) > 0 {
+		l = layout[0]
+	}
+
+	return time.Unix(int64(epoch), 0).UTC().Format(l)
+}
+
+// Percent returns part of total as a percentage with one decimal, e.g. "42.5%".
+func Percent(part, total int) string {
+	if total == 0 {
+		return "0.0%"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+}
+
+// HumanizeCount shortens large counts, e.g. 1234 to "1.2k" and 5600000 to "5.6M".
+func HumanizeCount(n int) string {
+	switch {
+	case n < 0:
+		return "-" + HumanizeCount(-n)
+	case n < 1000:
+		return fmt.Sprintf("%d", n)
+	case n < 1000000:
+		return trimZero(fmt.Sprintf("%.1f", float64(n)/1e3)) + "k"
+	case n < 1000000000:
+		return trimZero(fmt.Sprintf("%.1f", float64(n)/1e6)) + "M"
+	default:
+		return trimZero(fmt.Sprintf("%.1f", float64(n)/1e9)) + "G"
+	}
+}
+
+func trimZero(s string) string {
+	return strings.TrimSuffix(s, ".0")
+}
+
+// CountryFlag returns the flag emoji for a two-letter ISO 3166 country code.
+func CountryFlag(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+
+	const regionalIndicatorA = 0x1F1E6
+	return string([]rune{
+		rune(regionalIndicatorA + int(code[0]-'A')),
+		rune(regionalIndicatorA + int(code[1]-'A')),
+	})
+}
+
+// PassFailClass returns a CSS class name for an authentication result:
+// "pass", "fail" or "neutral".
+func PassFailClass(val interface{}) string {
+	switch v := val.(type) {
+	case dmark.Result:
+		if v {
+			return "pass"
+		}
+		return "fail"
+	case *dmark.Result:
+		return PassFailClass(*v)
+	case dmark.DKIMResult:
+		switch v {
+		case dmark.DKIMResultPass:
+			return "pass"
+		case dmark.DKIMResultFail, dmark.DKIMResultPermError:
+			return "fail"
+		}
+	case dmark.SPFResult:
+		switch v {
+		case dmark.SPFResultPass:
+			return "pass"
+		case dmark.SPFResultFail, dmark.SPFResultSoftFail, dmark.SPFResultPermError:
+			return "fail"
+		}
+	case dmark.Disposition:
+		switch v {
+		case dmark.DispositionNone:
+			return "pass"
+		case dmark.DispositionQuarantine, dmark.DispositionReject:
+			return "fail"
+		}
+	}
+
+	return "neutral"
+}
+
+// Group is a set of items sharing the same key.
+type Group struct {
+	Key   string
+	Items []interface{}
+}
+
+// GroupBy groups the items of a slice by the value of a dotted field path,
+// e.g. "Identifiers.HeaderFrom". Groups are ordered by first appearance.
+func GroupBy(items interface{}, path string) ([]Group, error) {
+	values, err := sliceValues(items)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Group{}
+	index := map[string]int{}
+	for _, item := range values {
+		field, err := fieldByPath(item, path)
+		if err != nil {
+			return nil, err
+		}
+
+		key := keyString(field)
+		i, ok := index[key]
+		if !ok {
+			i = len(result)
+			index[key] = i
+			result = append(result, Group{Key: key})
+		}
+		result[i].Items = append(result[i].Items, item.Interface())
+	}
+
+	return result, nil
+}
+
+// SortBy returns a copy of a slice sorted by the value of a dotted field path,
+// e.g. "Row.Count". Pass "desc" as the last argument to sort in descending order.
+func SortBy(items interface{}, path string, order ...string) ([]interface{}, error) {
+	values, err := sliceValues(items)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]reflect.Value, len(values))
+	for i, item := range values {
+		if keys[i], err = fieldByPath(item, path); err != nil {
+			return nil, err
+		}
+	}
+
+	indexes := make([]int, len(values))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	desc := len(order) > 0 && strings.EqualFold(order[0], "desc")
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if desc {
+			return less(keys[indexes[j]], keys[indexes[i]])
+		}
+		return less(keys[indexes[i]], keys[indexes[j]])
+	})
+
+	result := make([]interface{}, len(values))
+	for i, index := range indexes {
+		result[i] = values[index].Interface()
+	}
+
+	return result, nil
+}
+
+// SortRecords returns a copy of records sorted by an order of
+// dmark.ParseRecordOrder, e.g. "header_from,count desc", or by
+// dmark.DefaultRecordOrder without one.
+func SortRecords(records []dmark.Record, order ...string) ([]dmark.Record, error) {
+	orders := []dmark.RecordOrder{}
+	if len(order) > 0 {
+		var err error
+		if orders, err = dmark.ParseRecordOrder(strings.Join(order, ",")); err != nil {
+			return nil, err
+		}
+	}
+
+	result := append([]dmark.Record{}, records...)
+	dmark.SortRecords(result, orders...)
+
+	return result, nil
+}
+
+func sliceValues(items interface{}) ([]reflect.Value, error) {
+	v := reflect.ValueOf(items)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected slice, got %T", items)
+	}
+
+	result := make([]reflect.Value, v.Len())
+	for i := range result {
+		result[i] = v.Index(i)
+	}
+
+	return result, nil
+}
+
+func fieldByPath(v reflect.Value, path string) (reflect.Value, error) {
+	if path == "" || path == "." {
+		return v, nil
+	}
+
+	for _, name := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("can't get field %q of %s", name, v.Type())
+		}
+
+		field := v.FieldByName(name)
+		if !field.IsValid() {
+			return reflect.Value{}, fmt.Errorf("no field %q in %s", name, v.Type())
+		}
+		v = field
+	}
+
+	return v, nil
+}
+
+var ipType = reflect.TypeOf(net.IP{})
+
+func keyString(v reflect.Value) string {
+	if v.Type() == ipType {
+		return v.Interface().(net.IP).String()
+	}
+
+	if v.CanInterface() {
+		if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+			if text, err := marshaler.MarshalText(); err == nil {
+				return string(text)
+			}
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func less(a, b reflect.Value) bool {
+	switch {
+	case a.Type() == ipType:
+		return bytes.Compare(a.Interface().(net.IP).To16(), b.Interface().(net.IP).To16()) < 0
+	case a.Kind() >= reflect.Int && a.Kind() <= reflect.Int64:
+		return a.Int() < b.Int()
+	case a.Kind() >= reflect.Uint && a.Kind() <= reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case a.Kind() == reflect.Float32 || a.Kind() == reflect.Float64:
+		return a.Float() < b.Float()
+	case a.Kind() == reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+
+	return keyString(a) < keyString(b)
+}
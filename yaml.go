@@ -0,0 +1,40 @@
+package dmark
+
+// MarshalYAML methods follow the Marshaler interface of YAML libraries,
+// so that enums are written as their text values instead of numbers.
+
+func (a Alignment) MarshalYAML() (interface{}, error) {
+	return yamlText(a.MarshalText())
+}
+
+func (disp Disposition) MarshalYAML() (interface{}, error) {
+	return yamlText(disp.MarshalText())
+}
+
+func (fo Fo) MarshalYAML() (interface{}, error) {
+	return yamlText(fo.MarshalText())
+}
+
+func (r Result) MarshalYAML() (interface{}, error) {
+	return yamlText(r.MarshalText())
+}
+
+func (po PolicyOverride) MarshalYAML() (interface{}, error) {
+	return yamlText(po.MarshalText())
+}
+
+func (dkimr DKIMResult) MarshalYAML() (interface{}, error) {
+	return yamlText(dkimr.MarshalText())
+}
+
+func (sds SPFDomainScope) MarshalYAML() (interface{}, error) {
+	return yamlText(sds.MarshalText())
+}
+
+func (spfr SPFResult) MarshalYAML() (interface{}, error) {
+	return yamlText(spfr.MarshalText())
+}
+
+func yamlText(text []byte, err error) (interface{}, error) {
+	return string(text), err
+}
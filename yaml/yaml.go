@@ -0,0 +1,423 @@
+// Package yaml writes reports as YAML, which is easier to read and diff than JSON,
+// for example when keeping report snapshots in Git.
+//
+// Field names are the `yaml` tag names, or the `json` tag names when there is none,
+// so the same names as in JSON are used. Values implementing MarshalYAML
+// (like enums) or encoding.TextMarshaler are written as the values they return.
+// Output is block style with sorted map keys; strings are quoted when they
+// could be read as another type.
+package yaml
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Marshaler is implemented by values that are written as another value.
+type Marshaler interface {
+	MarshalYAML() (interface{}, error)
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Marshal returns the YAML document of v.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(reflect.ValueOf(v), 0, false); err != nil {
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// encode writes v. When afterKey is set, the cursor follows "key:" of a mapping
+// at column indent, otherwise it is at column indent already (the start of a line or after "- ").
+func (e *encoder) encode(v reflect.Value, indent int, afterKey bool) error {
+	v, err := resolve(v)
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		entries := make([]entry, 0, len(fields))
+		for _, f := range fields {
+			value, ok := fieldByIndex(v, f.index)
+			if !ok || f.omitEmpty && isEmpty(value) {
+				continue
+			}
+			entries = append(entries, entry{f.name, value})
+		}
+		return e.mapping(entries, indent, afterKey)
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("yaml: unsupported map key type %s", v.Type().Key())
+		}
+		entries := make([]entry, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			entries = append(entries, entry{key.String(), v.MapIndex(key)})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+		return e.mapping(entries, indent, afterKey)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			break
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.scalar(quote(base64.StdEncoding.EncodeToString(bytesOf(v))), afterKey)
+			return nil
+		}
+		return e.sequence(v, indent, afterKey)
+	}
+
+	s, err := scalar(v)
+	if err != nil {
+		return err
+	}
+	e.scalar(s, afterKey)
+	return nil
+}
+
+type entry struct {
+	key   string
+	value reflect.Value
+}
+
+func (e *encoder) mapping(entries []entry, indent int, afterKey bool) error {
+	if len(entries) == 0 {
+		e.scalar("{}", afterKey)
+		return nil
+	}
+
+	if afterKey {
+		e.buf.WriteByte('\n')
+		indent += 2
+	}
+
+	for i, en := range entries {
+		if afterKey || i > 0 {
+			e.indent(indent)
+		}
+		e.buf.WriteString(str(en.key))
+		e.buf.WriteByte(':')
+		if err := e.encode(en.value, indent, true); err != nil {
+			return fmt.Errorf("%s: %w", en.key, err)
+		}
+	}
+
+	return nil
+}
+
+// sequence writes items of v; under a mapping key they are not indented further.
+func (e *encoder) sequence(v reflect.Value, indent int, afterKey bool) error {
+	if v.Len() == 0 {
+		e.scalar("[]", afterKey)
+		return nil
+	}
+
+	if afterKey {
+		e.buf.WriteByte('\n')
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if afterKey || i > 0 {
+			e.indent(indent)
+		}
+		e.buf.WriteString("- ")
+		if err := e.encode(v.Index(i), indent+2, false); err != nil {
+			return fmt.Errorf("%d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) scalar(s string, afterKey bool) {
+	if afterKey {
+		e.buf.WriteByte(' ')
+	}
+	e.buf.WriteString(s)
+	e.buf.WriteByte('\n')
+}
+
+func (e *encoder) indent(n int) {
+	for i := 0; i < n; i++ {
+		e.buf.WriteByte(' ')
+	}
+}
+
+// resolve dereferences pointers and interfaces and replaces values
+// implementing Marshaler or encoding.TextMarshaler with what they return.
+func resolve(v reflect.Value) (reflect.Value, error) {
+	for {
+		if !v.IsValid() {
+			return v, nil
+		}
+
+		if v.Kind() != reflect.Ptr || !v.IsNil() {
+			if m, ok := asInterface(v, marshalerType); ok {
+				replacement, err := m.(Marshaler).MarshalYAML()
+				if err != nil {
+					return v, err
+				}
+				v = reflect.ValueOf(replacement)
+				continue
+			}
+			if m, ok := asInterface(v, textMarshalerType); ok && !(v.Kind() == reflect.Slice && v.IsNil()) {
+				text, err := m.(encoding.TextMarshaler).MarshalText()
+				if err != nil {
+					return v, err
+				}
+				return reflect.ValueOf(string(text)), nil
+			}
+		}
+
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if v.IsNil() {
+				return reflect.Value{}, nil
+			}
+			v = v.Elem()
+		default:
+			return v, nil
+		}
+	}
+}
+
+// asInterface returns v, or its address for pointer receivers, as t.
+func asInterface(v reflect.Value, t reflect.Type) (interface{}, bool) {
+	if v.Kind() == reflect.Interface {
+		return nil, false
+	}
+	if v.Type().Implements(t) {
+		return v.Interface(), true
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(t) {
+		return v.Addr().Interface(), true
+	}
+	if reflect.PtrTo(v.Type()).Implements(t) {
+		// copied values are not addressable
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface(), true
+	}
+
+	return nil, false
+}
+
+func scalar(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "null", nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return ".nan", nil
+		case math.IsInf(f, 1):
+			return ".inf", nil
+		case math.IsInf(f, -1):
+			return "-.inf", nil
+		}
+		bits := 64
+		if v.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		return strconv.FormatFloat(f, 'g', -1, bits), nil
+	case reflect.String:
+		return str(v.String()), nil
+	case reflect.Map, reflect.Slice:
+		return "null", nil // nil, others are containers
+	}
+
+	return "", fmt.Errorf("yaml: unsupported type %s", v.Type())
+}
+
+// str returns s as a plain scalar when it can not be read as anything else, quoted otherwise.
+func str(s string) string {
+	if plain(s) {
+		return s
+	}
+	return quote(s)
+}
+
+func quote(s string) string {
+	// Go escapes are a subset of YAML double-quoted escapes
+	return strconv.Quote(s)
+}
+
+// reserved are plain scalars read as booleans or null by YAML 1.1 or 1.2 parsers.
+var reserved = map[string]bool{
+	"y": true, "yes": true, "n": true, "no": true,
+	"true": true, "false": true, "on": true, "off": true,
+	"null": true, "~": true,
+}
+
+func plain(s string) bool {
+	if s == "" || reserved[strings.ToLower(s)] || s[len(s)-1] == ' ' {
+		return false
+	}
+
+	first, _ := utf8.DecodeRuneInString(s)
+	if first < utf8.RuneSelf && !isLetter(byte(first)) {
+		// digits may start numbers or timestamps, punctuation YAML indicators
+		return false
+	}
+
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			if !strconv.IsPrint(r) {
+				return false
+			}
+			continue
+		}
+		if !isLetter(byte(r)) && !(r >= '0' && r <= '9') && !strings.ContainsRune(" ._/@+=-", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func bytesOf(v reflect.Value) []byte {
+	if v.Kind() == reflect.Slice {
+		return v.Bytes()
+	}
+
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields returns exported fields, including those of embedded structs,
+// which are hidden by fields of the same name at a shallower depth, like in encoding/json.
+func structFields(t reflect.Type) []field {
+	fields := []field{}
+	depths := map[string]int{}
+
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			spec, ok := sf.Tag.Lookup("yaml")
+			if !ok {
+				spec = sf.Tag.Get("json")
+			}
+			name, options, _ := strings.Cut(spec, ",")
+			if name == "-" && options == "" {
+				continue
+			}
+
+			fieldIndex := append(append([]int{}, index...), i)
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, fieldIndex)
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+
+			if name == "" {
+				name = sf.Name
+			}
+			if depth, ok := depths[name]; ok && depth <= len(index) {
+				continue
+			}
+			depths[name] = len(index)
+			fields = append(fields, field{
+				name:      name,
+				index:     fieldIndex,
+				omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+			})
+		}
+	}
+	walk(t, nil)
+
+	// drop fields hidden by shallower ones found later
+	result := fields[:0]
+	for _, f := range fields {
+		if depths[f.name] == len(f.index)-1 {
+			result = append(result, f)
+		}
+	}
+
+	return result
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but reports nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// isEmpty reports whether omitempty drops v, like in encoding/json.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}